@@ -0,0 +1,183 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+
+	cachev3 "github.com/envoyproxy/go-control-plane/pkg/cache/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/log"
+)
+
+// loader syncs the snapshots from a directory of YAML files, e.g. the
+// checkout of a GitOps repository, with a file per node ID named
+// <node>.yaml. A file lists the discovery responses of the node, one per
+// type, in the format of the JSON codec:
+//
+//	# test-id.yaml
+//	- version_info: "1"
+//	  type_url: type.googleapis.com/envoy.config.cluster.v3.Cluster
+//	  resources:
+//	  - "@type": type.googleapis.com/envoy.config.cluster.v3.Cluster
+//	    name: example_proxy_cluster
+//	    connect_timeout: 5s
+//
+// The snapshots are set once consistent, and cleared once their file is
+// removed.
+type loader struct {
+	dir   string
+	cache cachev3.SnapshotCache
+	log   log.Logger
+
+	// onLoad is optionally called with the loaded snapshots, e.g. to persist
+	// them
+	onLoad func(node string, snapshot cachev3.Snapshot)
+
+	// onClear is optionally called with the cleared nodes
+	onClear func(node string)
+
+	// modified are the modification times of the loaded files by node ID
+	modified map[string]time.Time
+}
+
+func newLoader(dir string, cache cachev3.SnapshotCache, logger log.Logger) *loader {
+	return &loader{dir: dir, cache: cache, log: logger, modified: make(map[string]time.Time)}
+}
+
+// run syncs the directory at the interval until the context is done.
+func (l *loader) run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if _, err := l.sync(); err != nil {
+				l.log.Errorf("config sync: %v", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// sync loads the changed files, and returns the number of snapshots set. The
+// files failing to load are skipped and reported in the error, so that a bad
+// commit keeps the last good snapshot of its node.
+func (l *loader) sync() (int, error) {
+	paths, err := filepath.Glob(filepath.Join(l.dir, "*.yaml"))
+	if err != nil {
+		return 0, err
+	}
+
+	var failures []string
+	loaded := 0
+	seen := make(map[string]bool, len(paths))
+	for _, path := range paths {
+		node, err := url.PathUnescape(strings.TrimSuffix(filepath.Base(path), ".yaml"))
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", path, err))
+			continue
+		}
+		seen[node] = true
+
+		info, err := os.Stat(path)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", path, err))
+			continue
+		}
+		if modified, exists := l.modified[node]; exists && modified.Equal(info.ModTime()) {
+			continue
+		}
+
+		snapshot, err := loadSnapshot(path)
+		if err == nil {
+			err = snapshot.Consistent()
+		}
+		if err == nil {
+			err = l.cache.SetSnapshot(node, snapshot)
+		}
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", path, err))
+			continue
+		}
+		l.modified[node] = info.ModTime()
+		loaded++
+		l.log.Infof("loaded the snapshot of node %q from %s", node, path)
+		if l.onLoad != nil {
+			l.onLoad(node, snapshot)
+		}
+	}
+
+	for node := range l.modified {
+		if !seen[node] {
+			delete(l.modified, node)
+			l.cache.ClearSnapshot(node)
+			l.log.Infof("cleared the snapshot of node %q", node)
+			if l.onClear != nil {
+				l.onClear(node)
+			}
+		}
+	}
+
+	if len(failures) > 0 {
+		return loaded, fmt.Errorf("failed to load %s", strings.Join(failures, "; "))
+	}
+	return loaded, nil
+}
+
+// loadSnapshot reads a YAML snapshot file.
+func loadSnapshot(path string) (cachev3.Snapshot, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return cachev3.Snapshot{}, err
+	}
+	var doc interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return cachev3.Snapshot{}, err
+	}
+	// YAML is a superset of JSON, once the keys are strings
+	js, err := json.Marshal(jsonValue(doc))
+	if err != nil {
+		return cachev3.Snapshot{}, err
+	}
+	return cachev3.JSONCodec{}.Unmarshal(js)
+}
+
+// jsonValue converts the YAML maps to JSON objects.
+func jsonValue(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[interface{}]interface{}:
+		out := make(map[string]interface{}, len(value))
+		for key, item := range value {
+			out[fmt.Sprint(key)] = jsonValue(item)
+		}
+		return out
+	case []interface{}:
+		for i, item := range value {
+			value[i] = jsonValue(item)
+		}
+	}
+	return value
+}
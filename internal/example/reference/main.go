@@ -0,0 +1,309 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+// The reference control plane wires the subsystems of the library the way a
+// production deployment would:
+//
+//   - a v3 xDS server over gRPC, optionally with mTLS,
+//   - a snapshot cache loaded from a directory of YAML files (GitOps),
+//     persisted to a state directory and restored on start,
+//   - Prometheus metrics, the admin API and UI, and health checks over HTTP,
+//   - the gRPC health service, and a graceful drain on SIGTERM.
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+
+	"github.com/envoyproxy/go-control-plane/internal/example"
+	cachev3 "github.com/envoyproxy/go-control-plane/pkg/cache/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/log"
+	admin "github.com/envoyproxy/go-control-plane/pkg/server/admin/v3"
+	metrics "github.com/envoyproxy/go-control-plane/pkg/server/callbacks/metrics/v3"
+	callbacks "github.com/envoyproxy/go-control-plane/pkg/server/callbacks/v3"
+	serverv3 "github.com/envoyproxy/go-control-plane/pkg/server/v3"
+)
+
+// config is the command line configuration.
+type config struct {
+	xdsAddr  string
+	httpAddr string
+
+	configDir    string
+	stateDir     string
+	syncInterval time.Duration
+
+	certFile string
+	keyFile  string
+	caFile   string
+
+	adminToken   string
+	drainTimeout time.Duration
+}
+
+// controlPlane holds the wired subsystems.
+type controlPlane struct {
+	cfg    config
+	log    log.Logger
+	cache  cachev3.SnapshotCache
+	server serverv3.Server
+	loader *loader
+
+	grpcServer *grpc.Server
+	httpServer *http.Server
+	health     *health.Server
+
+	xdsListener  net.Listener
+	httpListener net.Listener
+
+	// ready is set once the snapshots are loaded, and reset on drain
+	ready int32
+}
+
+func newControlPlane(cfg config, logger log.Logger) (*controlPlane, error) {
+	cp := &controlPlane{cfg: cfg, log: logger, health: health.NewServer()}
+	cp.cache = cachev3.NewSnapshotCache(true, cachev3.IDHash{}, logger)
+
+	// the callbacks export the metrics and record the versions for the admin API
+	registry := prometheus.NewRegistry()
+	meters := metrics.NewCallbacks("")
+	registry.MustRegister(meters, prometheus.NewGoCollector())
+	recorder := admin.NewRecorder(cachev3.IDHash{}, 100)
+	cp.server = serverv3.NewServer(context.Background(), cp.cache, callbacks.Chain{meters, recorder})
+
+	var opts []grpc.ServerOption
+	if cfg.certFile != "" {
+		creds, err := serverCredentials(cfg.certFile, cfg.keyFile, cfg.caFile)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, grpc.Creds(creds))
+	}
+	// see internal/example/server.go for the stream limit
+	opts = append(opts, grpc.MaxConcurrentStreams(1000000))
+	cp.grpcServer = grpc.NewServer(opts...)
+	serverv3.RegisterServices(cp.grpcServer, cp.server)
+	healthpb.RegisterHealthServer(cp.grpcServer, cp.health)
+
+	handler := &admin.Handler{Cache: cp.cache, Recorder: recorder}
+	if cfg.adminToken != "" {
+		handler.Authenticate = admin.BearerTokens(map[string]admin.Role{cfg.adminToken: admin.RoleOperator})
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	mux.Handle("/admin/", http.StripPrefix("/admin", adminHandler{handler}))
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, _ *http.Request) {
+		if atomic.LoadInt32(&cp.ready) == 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	cp.httpServer = &http.Server{Handler: mux}
+
+	// the persisted snapshots are served until the config directory loads
+	store := state{dir: cfg.stateDir, codec: cachev3.BinaryCodec{}}
+	if cfg.stateDir != "" {
+		if err := os.MkdirAll(cfg.stateDir, 0700); err != nil {
+			return nil, err
+		}
+		restored, err := store.restore(cp.cache)
+		if err != nil {
+			return nil, fmt.Errorf("restore state: %v", err)
+		}
+		logger.Infof("restored %d snapshots from %s", restored, cfg.stateDir)
+	}
+	if cfg.configDir != "" {
+		cp.loader = newLoader(cfg.configDir, cp.cache, logger)
+		if cfg.stateDir != "" {
+			cp.loader.onLoad = func(node string, snapshot cachev3.Snapshot) {
+				if err := store.save(node, snapshot); err != nil {
+					logger.Errorf("persist the snapshot of %q: %v", node, err)
+				}
+			}
+			cp.loader.onClear = func(node string) {
+				if err := store.remove(node); err != nil {
+					logger.Errorf("remove the snapshot of %q: %v", node, err)
+				}
+			}
+		}
+		if _, err := cp.loader.sync(); err != nil {
+			logger.Errorf("config sync: %v", err)
+		}
+	}
+
+	var err error
+	if cp.xdsListener, err = net.Listen("tcp", cfg.xdsAddr); err != nil {
+		return nil, err
+	}
+	if cp.httpListener, err = net.Listen("tcp", cfg.httpAddr); err != nil {
+		cp.xdsListener.Close()
+		return nil, err
+	}
+	return cp, nil
+}
+
+// serverCredentials requires the clients to present a certificate signed by
+// the CA, if any.
+func serverCredentials(certFile, keyFile, caFile string) (credentials.TransportCredentials, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	if caFile != "" {
+		pem, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate in %s", caFile)
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return credentials.NewTLS(tlsConfig), nil
+}
+
+// adminHandler serves the admin API over HTTP.
+type adminHandler struct {
+	*admin.Handler
+}
+
+func (h adminHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, code, err := h.Handler.ServeHTTP(req)
+	if err != nil {
+		http.Error(w, err.Error(), code)
+		return
+	}
+	if code == http.StatusOK && req.URL.Path != admin.UIPath {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	w.WriteHeader(code)
+	_, _ = w.Write(body)
+}
+
+// serve runs the servers until the context is done, then drains the streams.
+func (cp *controlPlane) serve(ctx context.Context) error {
+	errs := make(chan error, 2)
+	go func() { errs <- cp.grpcServer.Serve(cp.xdsListener) }()
+	go func() { errs <- cp.httpServer.Serve(cp.httpListener) }()
+	if cp.loader != nil {
+		go cp.loader.run(ctx, cp.cfg.syncInterval)
+	}
+
+	cp.health.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+	atomic.StoreInt32(&cp.ready, 1)
+	cp.log.Infof("xDS server listening on %s, HTTP on %s", cp.xdsListener.Addr(), cp.httpListener.Addr())
+
+	var err error
+	select {
+	case <-ctx.Done():
+	case err = <-errs:
+	}
+	cp.drain()
+	if err == http.ErrServerClosed {
+		err = nil
+	}
+	return err
+}
+
+// drain fails the health checks, so that the load balancers stop sending the
+// new streams, and disconnects the nodes so that they reconnect to the other
+// replicas, before stopping the servers.
+func (cp *controlPlane) drain() {
+	atomic.StoreInt32(&cp.ready, 0)
+	cp.health.Shutdown()
+
+	draining := status.New(codes.Unavailable, "control plane draining")
+	for _, node := range cp.cache.GetStatusKeys() {
+		cp.server.DisconnectNode(node, draining, 0)
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		cp.grpcServer.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(cp.cfg.drainTimeout):
+		cp.log.Warnf("drain timeout, closing the remaining streams")
+		cp.grpcServer.Stop()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cp.cfg.drainTimeout)
+	defer cancel()
+	_ = cp.httpServer.Shutdown(ctx)
+}
+
+func main() {
+	var cfg config
+	logger := example.Logger{}
+	flag.BoolVar(&logger.Debug, "debug", false, "Enable debug logging")
+	flag.StringVar(&cfg.xdsAddr, "xds", ":18000", "xDS server address")
+	flag.StringVar(&cfg.httpAddr, "http", ":18001", "Metrics, admin and health check address")
+	flag.StringVar(&cfg.configDir, "config", "", "Directory of the YAML snapshots by node ID")
+	flag.StringVar(&cfg.stateDir, "state", "", "Directory persisting the snapshots")
+	flag.DurationVar(&cfg.syncInterval, "sync", 10*time.Second, "Interval between the config directory syncs")
+	flag.StringVar(&cfg.certFile, "cert", "", "Server certificate, enabling TLS")
+	flag.StringVar(&cfg.keyFile, "key", "", "Server private key")
+	flag.StringVar(&cfg.caFile, "ca", "", "Client CA, enabling mTLS")
+	flag.StringVar(&cfg.adminToken, "admin-token", "", "Bearer token of the admin API operators")
+	flag.DurationVar(&cfg.drainTimeout, "drain", 30*time.Second, "Graceful drain timeout")
+	flag.Parse()
+
+	cp, err := newControlPlane(cfg, logger)
+	if err != nil {
+		logger.Errorf("%v", err)
+		os.Exit(1)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-signals
+		cancel()
+	}()
+
+	if err := cp.serve(ctx); err != nil {
+		logger.Errorf("%v", err)
+		os.Exit(1)
+	}
+}
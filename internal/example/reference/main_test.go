@@ -0,0 +1,154 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	yaml "gopkg.in/yaml.v2"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	clusterservice "github.com/envoyproxy/go-control-plane/envoy/service/cluster/v3"
+	discovery "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	"github.com/envoyproxy/go-control-plane/internal/example"
+	cachev3 "github.com/envoyproxy/go-control-plane/pkg/cache/v3"
+)
+
+// writeSnapshot writes the example snapshot of a node in the YAML format of
+// the loader.
+func writeSnapshot(t *testing.T, dir, node string) {
+	js, err := cachev3.JSONCodec{}.Marshal(example.GenerateSnapshot())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc interface{}
+	if err := json.Unmarshal(js, &doc); err != nil {
+		t.Fatal(err)
+	}
+	data, err := yaml.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, node+".yaml"), data, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func get(t *testing.T, url, token string) (int, string) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	return resp.StatusCode, string(body)
+}
+
+func TestReferenceControlPlane(t *testing.T) {
+	dir, err := ioutil.TempDir("", "reference")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	configDir := filepath.Join(dir, "config")
+	if err := os.Mkdir(configDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	writeSnapshot(t, configDir, "test-id")
+
+	cfg := config{
+		xdsAddr:      "127.0.0.1:0",
+		httpAddr:     "127.0.0.1:0",
+		configDir:    configDir,
+		stateDir:     filepath.Join(dir, "state"),
+		syncInterval: 10 * time.Millisecond,
+		adminToken:   "secret",
+		drainTimeout: time.Second,
+	}
+	cp, err := newControlPlane(cfg, example.Logger{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- cp.serve(ctx) }()
+
+	conn, err := grpc.Dial(cp.xdsListener.Addr().String(), grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	resp, err := clusterservice.NewClusterDiscoveryServiceClient(conn).FetchClusters(ctx, &discovery.DiscoveryRequest{
+		Node: &core.Node{Id: "test-id"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Resources) != 1 {
+		t.Errorf("FetchClusters() => got %d clusters, want 1", len(resp.Resources))
+	}
+	check, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+	if err != nil || check.Status != healthpb.HealthCheckResponse_SERVING {
+		t.Errorf("health check => got %v, %v, want serving", check, err)
+	}
+
+	base := "http://" + cp.httpListener.Addr().String()
+	if code, _ := get(t, base+"/readyz", ""); code != http.StatusOK {
+		t.Errorf("/readyz => got %d, want 200", code)
+	}
+	if code, body := get(t, base+"/metrics", ""); code != http.StatusOK || !strings.Contains(body, "xds_requests_total") {
+		t.Errorf("/metrics => got %d, want the request counters", code)
+	}
+	if code, body := get(t, base+"/admin/snapshots/test-id", "secret"); code != http.StatusOK || !strings.Contains(body, example.ClusterName) {
+		t.Errorf("/admin/snapshots => got %d %s, want the snapshot", code, body)
+	}
+	if code, _ := get(t, base+"/admin/nodes", ""); code != http.StatusUnauthorized {
+		t.Errorf("/admin/nodes without a token => got %d, want 401", code)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("serve() => got %v", err)
+	}
+
+	// a restart serves the persisted snapshots without the config directory
+	cfg.configDir = ""
+	restarted, err := newControlPlane(cfg, example.Logger{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restarted.xdsListener.Close()
+	defer restarted.httpListener.Close()
+	if _, err := restarted.cache.GetSnapshot("test-id"); err != nil {
+		t.Errorf("restored snapshot => got %v", err)
+	}
+}
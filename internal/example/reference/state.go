@@ -0,0 +1,95 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	cachev3 "github.com/envoyproxy/go-control-plane/pkg/cache/v3"
+)
+
+// state persists the snapshots in a directory, with a file per node ID, so
+// that a restarted control plane serves the last known configuration before
+// the config source is reachable again.
+type state struct {
+	dir   string
+	codec cachev3.Codec
+}
+
+const stateSuffix = ".snapshot"
+
+func (s state) path(node string) string {
+	return filepath.Join(s.dir, url.PathEscape(node)+stateSuffix)
+}
+
+// save writes the snapshot of a node atomically.
+func (s state) save(node string, snapshot cachev3.Snapshot) error {
+	data, err := s.codec.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(s.dir, ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path(node))
+}
+
+// remove deletes the snapshot of a node.
+func (s state) remove(node string) error {
+	if err := os.Remove(s.path(node)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// restore sets the persisted snapshots in the cache, and returns the number
+// of restored nodes.
+func (s state) restore(cache cachev3.SnapshotCache) (int, error) {
+	paths, err := filepath.Glob(filepath.Join(s.dir, "*"+stateSuffix))
+	if err != nil {
+		return 0, err
+	}
+	for i, path := range paths {
+		node, err := url.PathUnescape(strings.TrimSuffix(filepath.Base(path), stateSuffix))
+		if err != nil {
+			return i, err
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return i, err
+		}
+		snapshot, err := s.codec.Unmarshal(data)
+		if err != nil {
+			return i, err
+		}
+		if err := cache.SetSnapshot(node, snapshot); err != nil {
+			return i, err
+		}
+	}
+	return len(paths), nil
+}
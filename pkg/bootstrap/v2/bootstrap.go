@@ -0,0 +1,289 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+// Package bootstrap generates the minimal Envoy bootstrap configuration to
+// connect a proxy to the management server.
+package bootstrap
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/ptypes"
+	pstruct "github.com/golang/protobuf/ptypes/struct"
+
+	cluster "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	endpoint "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	auth "github.com/envoyproxy/go-control-plane/envoy/api/v2/auth"
+	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	endpointv2 "github.com/envoyproxy/go-control-plane/envoy/api/v2/endpoint"
+	bootstrap "github.com/envoyproxy/go-control-plane/envoy/config/bootstrap/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/resource/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/wellknown"
+)
+
+const (
+	// Ads mode fetches all the resources over one aggregated gRPC stream.
+	Ads = "ads"
+
+	// Xds mode fetches each type over its own gRPC stream.
+	Xds = "xds"
+
+	// Rest mode polls each type over HTTP.
+	Rest = "rest"
+
+	// XdsCluster is the name of the static cluster of the management server.
+	XdsCluster = "xds_cluster"
+)
+
+// Config describes the node and how it connects to the management server.
+type Config struct {
+	// NodeID and NodeCluster identify the node to the server, e.g. to the
+	// NodeHash of the cache.
+	NodeID      string
+	NodeCluster string
+
+	// Metadata is the optional node metadata.
+	Metadata map[string]string
+
+	// Mode is the management protocol, Ads if empty.
+	Mode string
+
+	// ServerAddress and ServerPort locate the management server. Addresses that
+	// are not IPs are resolved with DNS.
+	ServerAddress string
+	ServerPort    uint32
+
+	// TLS optionally secures the connections to the management server.
+	TLS *TLS
+
+	// ConnectTimeout to the management server, 1s if zero.
+	ConnectTimeout time.Duration
+
+	// RefreshDelay is the polling interval of the Rest mode, 1s if zero.
+	RefreshDelay time.Duration
+
+	// AdminAddress and AdminPort locate the admin interface, 127.0.0.1 and
+	// 19000 if empty.
+	AdminAddress string
+	AdminPort    uint32
+
+	// AdminAccessLogPath is the access log of the admin interface, /dev/null
+	// if empty.
+	AdminAccessLogPath string
+}
+
+// TLS lists the files of the client certificate and of the trusted CA of the
+// management server connections.
+type TLS struct {
+	CertFile string
+	KeyFile  string
+	CAFile   string
+
+	// ServerName is the optional SNI of the management server.
+	ServerName string
+}
+
+// New returns the bootstrap of the configuration. The listeners and clusters
+// are fetched from the management server, which also serves the routes,
+// endpoints, and secrets that they reference.
+func New(config Config) (*bootstrap.Bootstrap, error) {
+	if config.NodeID == "" || config.NodeCluster == "" {
+		return nil, fmt.Errorf("node ID and cluster are required")
+	}
+	if config.ServerAddress == "" || config.ServerPort == 0 {
+		return nil, fmt.Errorf("management server address and port are required")
+	}
+	if config.Mode == "" {
+		config.Mode = Ads
+	}
+	if config.ConnectTimeout == 0 {
+		config.ConnectTimeout = time.Second
+	}
+	if config.RefreshDelay == 0 {
+		config.RefreshDelay = time.Second
+	}
+	if config.AdminAddress == "" {
+		config.AdminAddress = "127.0.0.1"
+	}
+	if config.AdminPort == 0 {
+		config.AdminPort = 19000
+	}
+	if config.AdminAccessLogPath == "" {
+		config.AdminAccessLogPath = "/dev/null"
+	}
+
+	out := &bootstrap.Bootstrap{
+		Node: &core.Node{
+			Id:       config.NodeID,
+			Cluster:  config.NodeCluster,
+			Metadata: nodeMetadata(config.Metadata),
+		},
+		Admin: &bootstrap.Admin{
+			AccessLogPath: config.AdminAccessLogPath,
+			Address:       socketAddress(config.AdminAddress, config.AdminPort),
+		},
+		DynamicResources: &bootstrap.Bootstrap_DynamicResources{},
+		StaticResources:  &bootstrap.Bootstrap_StaticResources{},
+	}
+
+	source := &core.ConfigSource{ResourceApiVersion: resource.DefaultAPIVersion}
+	switch config.Mode {
+	case Ads:
+		out.DynamicResources.AdsConfig = grpcSource()
+		source.ConfigSourceSpecifier = &core.ConfigSource_Ads{Ads: &core.AggregatedConfigSource{}}
+	case Xds:
+		source.ConfigSourceSpecifier = &core.ConfigSource_ApiConfigSource{ApiConfigSource: grpcSource()}
+	case Rest:
+		source.ConfigSourceSpecifier = &core.ConfigSource_ApiConfigSource{
+			ApiConfigSource: &core.ApiConfigSource{
+				ApiType:             core.ApiConfigSource_REST,
+				TransportApiVersion: resource.DefaultAPIVersion,
+				ClusterNames:        []string{XdsCluster},
+				RefreshDelay:        ptypes.DurationProto(config.RefreshDelay),
+			},
+		}
+	default:
+		return nil, fmt.Errorf("unknown management protocol %q", config.Mode)
+	}
+	out.DynamicResources.CdsConfig = source
+	out.DynamicResources.LdsConfig = source
+
+	xds, err := xdsCluster(config)
+	if err != nil {
+		return nil, err
+	}
+	out.StaticResources.Clusters = []*cluster.Cluster{xds}
+
+	if err := out.Validate(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Marshal returns the bootstrap of the configuration as JSON, e.g. for the
+// --config-path flag of Envoy.
+func Marshal(config Config) ([]byte, error) {
+	out, err := New(config)
+	if err != nil {
+		return nil, err
+	}
+	buf := &bytes.Buffer{}
+	if err := (&jsonpb.Marshaler{OrigName: true, Indent: "  "}).Marshal(buf, out); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func grpcSource() *core.ApiConfigSource {
+	return &core.ApiConfigSource{
+		ApiType:                   core.ApiConfigSource_GRPC,
+		TransportApiVersion:       resource.DefaultAPIVersion,
+		SetNodeOnFirstMessageOnly: true,
+		GrpcServices: []*core.GrpcService{{
+			TargetSpecifier: &core.GrpcService_EnvoyGrpc_{
+				EnvoyGrpc: &core.GrpcService_EnvoyGrpc{ClusterName: XdsCluster},
+			},
+		}},
+	}
+}
+
+func xdsCluster(config Config) (*cluster.Cluster, error) {
+	discovery := cluster.Cluster_STATIC
+	if net.ParseIP(config.ServerAddress) == nil {
+		discovery = cluster.Cluster_STRICT_DNS
+	}
+	out := &cluster.Cluster{
+		Name:                 XdsCluster,
+		ConnectTimeout:       ptypes.DurationProto(config.ConnectTimeout),
+		ClusterDiscoveryType: &cluster.Cluster_Type{Type: discovery},
+		LoadAssignment: &endpoint.ClusterLoadAssignment{
+			ClusterName: XdsCluster,
+			Endpoints: []*endpointv2.LocalityLbEndpoints{{
+				LbEndpoints: []*endpointv2.LbEndpoint{{
+					HostIdentifier: &endpointv2.LbEndpoint_Endpoint{
+						Endpoint: &endpointv2.Endpoint{
+							Address: socketAddress(config.ServerAddress, config.ServerPort),
+						},
+					},
+				}},
+			}},
+		},
+	}
+	if config.Mode != Rest {
+		out.Http2ProtocolOptions = &core.Http2ProtocolOptions{}
+	}
+
+	if config.TLS != nil {
+		tls := &auth.UpstreamTlsContext{
+			Sni:              config.TLS.ServerName,
+			CommonTlsContext: &auth.CommonTlsContext{},
+		}
+		if config.TLS.CertFile != "" || config.TLS.KeyFile != "" {
+			tls.CommonTlsContext.TlsCertificates = []*auth.TlsCertificate{{
+				CertificateChain: fileSource(config.TLS.CertFile),
+				PrivateKey:       fileSource(config.TLS.KeyFile),
+			}}
+		}
+		if config.TLS.CAFile != "" {
+			tls.CommonTlsContext.ValidationContextType = &auth.CommonTlsContext_ValidationContext{
+				ValidationContext: &auth.CertificateValidationContext{TrustedCa: fileSource(config.TLS.CAFile)},
+			}
+		}
+		if config.Mode != Rest {
+			tls.CommonTlsContext.AlpnProtocols = []string{"h2"}
+		}
+		any, err := ptypes.MarshalAny(tls)
+		if err != nil {
+			return nil, err
+		}
+		out.TransportSocket = &core.TransportSocket{
+			Name:       wellknown.TransportSocketTls,
+			ConfigType: &core.TransportSocket_TypedConfig{TypedConfig: any},
+		}
+	}
+	return out, nil
+}
+
+func nodeMetadata(metadata map[string]string) *pstruct.Struct {
+	if len(metadata) == 0 {
+		return nil
+	}
+	out := &pstruct.Struct{Fields: make(map[string]*pstruct.Value, len(metadata))}
+	for key, value := range metadata {
+		out.Fields[key] = &pstruct.Value{Kind: &pstruct.Value_StringValue{StringValue: value}}
+	}
+	return out
+}
+
+func socketAddress(address string, port uint32) *core.Address {
+	return &core.Address{
+		Address: &core.Address_SocketAddress{
+			SocketAddress: &core.SocketAddress{
+				Protocol: core.SocketAddress_TCP,
+				Address:  address,
+				PortSpecifier: &core.SocketAddress_PortValue{
+					PortValue: port,
+				},
+			},
+		},
+	}
+}
+
+func fileSource(filename string) *core.DataSource {
+	return &core.DataSource{Specifier: &core.DataSource_Filename{Filename: filename}}
+}
@@ -0,0 +1,105 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package bootstrap_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/ptypes"
+
+	cluster "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	auth "github.com/envoyproxy/go-control-plane/envoy/api/v2/auth"
+	bootstrapconfig "github.com/envoyproxy/go-control-plane/envoy/config/bootstrap/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/bootstrap/v2"
+)
+
+func TestNew(t *testing.T) {
+	config := bootstrap.Config{
+		NodeID:        "test-id",
+		NodeCluster:   "test-cluster",
+		Metadata:      map[string]string{"tenant": "a"},
+		ServerAddress: "127.0.0.1",
+		ServerPort:    18000,
+	}
+	for _, mode := range []string{bootstrap.Ads, bootstrap.Xds, bootstrap.Rest} {
+		config.Mode = mode
+		out, err := bootstrap.New(config)
+		if err != nil {
+			t.Fatalf("New(%s) => got error %v", mode, err)
+		}
+		if out.GetNode().GetId() != "test-id" || out.GetNode().GetMetadata().GetFields()["tenant"].GetStringValue() != "a" {
+			t.Errorf("New(%s) node => got %v", mode, out.GetNode())
+		}
+		if (out.GetDynamicResources().GetAdsConfig() != nil) != (mode == bootstrap.Ads) {
+			t.Errorf("New(%s) ADS config => got %v", mode, out.GetDynamicResources().GetAdsConfig())
+		}
+		xds := out.GetStaticResources().GetClusters()[0]
+		if xds.GetName() != bootstrap.XdsCluster || xds.GetType() != cluster.Cluster_STATIC ||
+			(xds.GetHttp2ProtocolOptions() != nil) == (mode == bootstrap.Rest) {
+			t.Errorf("New(%s) management server cluster => got %v", mode, xds)
+		}
+	}
+
+	config.Mode = "grpc"
+	if _, err := bootstrap.New(config); err == nil {
+		t.Error("New() with an unknown mode => got no error")
+	}
+	if _, err := bootstrap.New(bootstrap.Config{NodeID: "test-id", NodeCluster: "test-cluster"}); err == nil {
+		t.Error("New() without a server => got no error")
+	}
+}
+
+func TestNewTLS(t *testing.T) {
+	out, err := bootstrap.New(bootstrap.Config{
+		NodeID:        "test-id",
+		NodeCluster:   "test-cluster",
+		ServerAddress: "xds.example.com",
+		ServerPort:    443,
+		TLS:           &bootstrap.TLS{CertFile: "cert.pem", KeyFile: "key.pem", CAFile: "ca.pem", ServerName: "xds.example.com"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	xds := out.GetStaticResources().GetClusters()[0]
+	if xds.GetType() != cluster.Cluster_STRICT_DNS {
+		t.Errorf("cluster type => got %v, want STRICT_DNS", xds.GetType())
+	}
+	tls := &auth.UpstreamTlsContext{}
+	if err := ptypes.UnmarshalAny(xds.GetTransportSocket().GetTypedConfig(), tls); err != nil {
+		t.Fatal(err)
+	}
+	common := tls.GetCommonTlsContext()
+	if tls.GetSni() != "xds.example.com" || common.GetTlsCertificates()[0].GetPrivateKey().GetFilename() != "key.pem" ||
+		common.GetValidationContext().GetTrustedCa().GetFilename() != "ca.pem" {
+		t.Errorf("TLS context => got %v", tls)
+	}
+}
+
+func TestMarshal(t *testing.T) {
+	config := bootstrap.Config{NodeID: "test-id", NodeCluster: "test-cluster", ServerAddress: "127.0.0.1", ServerPort: 18000}
+	data, err := bootstrap.Marshal(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := &bootstrapconfig.Bootstrap{}
+	if err := jsonpb.Unmarshal(bytes.NewReader(data), out); err != nil {
+		t.Fatal(err)
+	}
+	if err := out.Validate(); err != nil || out.GetAdmin().GetAddress().GetSocketAddress().GetPortValue() != 19000 {
+		t.Errorf("Marshal() => got %s", data)
+	}
+}
@@ -0,0 +1,157 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+// Package compat serves the v3 clients from a v2 cache, so that a single cache
+// serves a fleet migrating from the v2 to the v3 transport API:
+//
+//	snapshots := cachev2.NewSnapshotCache(true, cachev2.IDHash{}, nil)
+//	v2 := serverv2.NewServer(ctx, snapshots, nil)
+//	v3 := serverv3.NewServer(ctx, compat.V3(snapshots), nil)
+//
+// The v3 resources are wire compatible with the v2 resources, so the marshaled
+// resources are only relabeled with the v3 type URLs. The deprecated v2 fields
+// removed from v3 are ignored by the v3 clients, and the nested typed configs
+// keep their v2 type URLs.
+package compat
+
+import (
+	"context"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/any"
+
+	discoveryv2 "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	discoveryv3 "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	cachev2 "github.com/envoyproxy/go-control-plane/pkg/cache/v2"
+	cachev3 "github.com/envoyproxy/go-control-plane/pkg/cache/v3"
+	resourcev2 "github.com/envoyproxy/go-control-plane/pkg/resource/v2"
+	resourcev3 "github.com/envoyproxy/go-control-plane/pkg/resource/v3"
+)
+
+// v2TypeURLs are the v2 type URLs indexed by the v3 type URLs.
+var v2TypeURLs = map[string]string{
+	resourcev3.EndpointType:    resourcev2.EndpointType,
+	resourcev3.ClusterType:     resourcev2.ClusterType,
+	resourcev3.RouteType:       resourcev2.RouteType,
+	resourcev3.ScopedRouteType: resourcev2.ScopedRouteType,
+	resourcev3.ListenerType:    resourcev2.ListenerType,
+	resourcev3.SecretType:      resourcev2.SecretType,
+	resourcev3.RuntimeType:     resourcev2.RuntimeType,
+}
+
+// v3TypeURLs are the v3 type URLs indexed by the v2 type URLs.
+var v3TypeURLs = make(map[string]string, len(v2TypeURLs))
+
+func init() {
+	for v3, v2 := range v2TypeURLs {
+		v3TypeURLs[v2] = v3
+	}
+}
+
+// V3 adapts a v2 cache to serve the v3 requests.
+func V3(cache cachev2.Cache) cachev3.Cache {
+	return &v3Cache{cache: cache}
+}
+
+type v3Cache struct {
+	cache cachev2.Cache
+}
+
+// CreateWatch translates the request and the response of a v2 watch. The
+// returned channel is closed if the request cannot be translated.
+func (c *v3Cache) CreateWatch(request *cachev3.Request) (chan cachev3.Response, func()) {
+	out := make(chan cachev3.Response, 1)
+	v2Request, err := toV2Request(request)
+	if err != nil {
+		close(out)
+		return out, nil
+	}
+
+	value, cancel := c.cache.CreateWatch(v2Request)
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-done:
+		case resp, ok := <-value:
+			if !ok {
+				close(out)
+				return
+			}
+			translated, err := toV3Response(request, resp)
+			if err != nil {
+				close(out)
+				return
+			}
+			out <- translated
+		}
+	}()
+
+	var once sync.Once
+	return out, func() {
+		once.Do(func() { close(done) })
+		if cancel != nil {
+			cancel()
+		}
+	}
+}
+
+// Fetch translates the request and the response of a v2 fetch.
+func (c *v3Cache) Fetch(ctx context.Context, request *cachev3.Request) (cachev3.Response, error) {
+	v2Request, err := toV2Request(request)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.cache.Fetch(ctx, v2Request)
+	if err != nil {
+		return nil, err
+	}
+	return toV3Response(request, resp)
+}
+
+func toV2Request(request *cachev3.Request) (*cachev2.Request, error) {
+	data, err := proto.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	out := &discoveryv2.DiscoveryRequest{}
+	if err := proto.Unmarshal(data, out); err != nil {
+		return nil, err
+	}
+	if typeURL, exists := v2TypeURLs[out.TypeUrl]; exists {
+		out.TypeUrl = typeURL
+	}
+	return out, nil
+}
+
+func toV3Response(request *cachev3.Request, resp cachev2.Response) (cachev3.Response, error) {
+	v2Response, err := resp.GetDiscoveryResponse()
+	if err != nil {
+		return nil, err
+	}
+	out := &discoveryv3.DiscoveryResponse{
+		VersionInfo: v2Response.VersionInfo,
+		TypeUrl:     request.TypeUrl,
+		Nonce:       v2Response.Nonce,
+		Resources:   make([]*any.Any, len(v2Response.Resources)),
+	}
+	for i, resource := range v2Response.Resources {
+		typeURL := resource.TypeUrl
+		if v3, exists := v3TypeURLs[typeURL]; exists {
+			typeURL = v3
+		}
+		out.Resources[i] = &any.Any{TypeUrl: typeURL, Value: resource.Value}
+	}
+	return &cachev3.PassthroughResponse{Request: request, DiscoveryResponse: out}, nil
+}
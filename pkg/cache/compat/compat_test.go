@@ -0,0 +1,88 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package compat_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+
+	cluster "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	discovery "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/compat"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
+	cachev2 "github.com/envoyproxy/go-control-plane/pkg/cache/v2"
+	resourcev3 "github.com/envoyproxy/go-control-plane/pkg/resource/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/test/resource/v2"
+)
+
+func TestV3(t *testing.T) {
+	snapshots := cachev2.NewSnapshotCache(false, cachev2.IDHash{}, nil)
+	c := compat.V3(snapshots)
+	node := &core.Node{Id: "node"}
+
+	// the watch is responded once the snapshot is set
+	value, cancel := c.CreateWatch(&discovery.DiscoveryRequest{Node: node, TypeUrl: resourcev3.ClusterType})
+	defer cancel()
+	snapshot := cachev2.NewSnapshot("1", nil, []types.Resource{resource.MakeCluster(resource.Xds, "backend")}, nil, nil, nil, nil)
+	if err := snapshots.SetSnapshot("node", snapshot); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case out := <-value:
+		resp, err := out.GetDiscoveryResponse()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.VersionInfo != "1" || resp.TypeUrl != resourcev3.ClusterType || len(resp.Resources) != 1 ||
+			resp.Resources[0].TypeUrl != resourcev3.ClusterType {
+			t.Fatalf("CreateWatch() => got %v, want a v3 cluster", resp)
+		}
+		got := &cluster.Cluster{}
+		if err := ptypes.UnmarshalAny(resp.Resources[0], got); err != nil || got.Name != "backend" {
+			t.Errorf("v3 cluster => got %v, %v, want backend", got, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("failed to receive the response")
+	}
+
+	// the fetch is translated in both directions
+	out, err := c.Fetch(context.Background(), &discovery.DiscoveryRequest{Node: node, TypeUrl: resourcev3.ClusterType})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version, _ := out.GetVersion(); version != "1" || out.GetRequest().TypeUrl != resourcev3.ClusterType {
+		t.Errorf("Fetch() => got version %q for %s", version, out.GetRequest().TypeUrl)
+	}
+	if _, err := c.Fetch(context.Background(), &discovery.DiscoveryRequest{Node: node, TypeUrl: resourcev3.ClusterType, VersionInfo: "1"}); err == nil {
+		t.Error("Fetch() with the current version => got no error")
+	}
+
+	// the cancelled watches are released
+	value, cancel = c.CreateWatch(&discovery.DiscoveryRequest{Node: node, TypeUrl: resourcev3.ClusterType, VersionInfo: "1"})
+	cancel()
+	cancel()
+	if got := snapshots.GetStatusInfo("node").GetNumWatches(); got != 0 {
+		t.Errorf("watches after cancel => got %d, want 0", got)
+	}
+	select {
+	case out := <-value:
+		t.Errorf("cancelled watch => got %v", out)
+	case <-time.After(10 * time.Millisecond):
+	}
+}
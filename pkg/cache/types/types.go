@@ -1,6 +1,8 @@
 package types
 
 import (
+	"time"
+
 	"github.com/golang/protobuf/proto"
 )
 
@@ -12,6 +14,14 @@ type Resource interface {
 // MarshaledResource is an alias for the serialized binary array.
 type MarshaledResource = []byte
 
+// ResourceWithTTL is a resource with an optional time-to-live. The clients
+// remove the resource once the TTL expires without a refresh, e.g. when the
+// control plane is unreachable.
+type ResourceWithTTL struct {
+	Resource Resource
+	TTL      *time.Duration
+}
+
 // SkipFetchError is the error returned when the cache fetch is short
 // circuited due to the client's version already being up-to-date.
 type SkipFetchError struct{}
@@ -31,5 +41,6 @@ const (
 	Listener
 	Secret
 	Runtime
+	ScopedRoute
 	UnknownType // token to count the total number of supported types
 )
@@ -0,0 +1,179 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package cache
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
+)
+
+// Admission vetoes or mutates the snapshots before SetSnapshot applies them,
+// e.g. to enforce the policies of a central policy engine. Admit returns an
+// error to reject the snapshot of the node, or modifies the snapshot in
+// place to mutate it. The admitted snapshot is a copy with its own maps, so
+// the changes do not leak to the caller or to the snapshots of the cache.
+// A Rego policy, for instance, is an AdmissionFunc evaluating a prepared
+// query against the snapshot rendered by JSONCodec.
+type Admission interface {
+	Admit(ctx context.Context, node string, snapshot *Snapshot) error
+}
+
+// AdmissionFunc adapts a function to the Admission interface.
+type AdmissionFunc func(ctx context.Context, node string, snapshot *Snapshot) error
+
+// Admit implements Admission.
+func (f AdmissionFunc) Admit(ctx context.Context, node string, snapshot *Snapshot) error {
+	return f(ctx, node, snapshot)
+}
+
+// WithAdmission calls the admission controllers in order before SetSnapshot
+// applies a snapshot, after the signature is verified. The snapshot is
+// rejected with the first error. The admission runs without the cache lock,
+// so the concurrent updates of a node are applied in the order they are
+// admitted.
+//
+// UpsertResources admits the updated snapshot of the node too, of which only
+// the upserted type is applied. That admission holds the cache lock, so that
+// the concurrent updates are not lost, and slow controllers delay the other
+// updates meanwhile.
+func WithAdmission(admissions ...Admission) SnapshotCacheOption {
+	return func(cache *snapshotCache) {
+		cache.admissions = append(cache.admissions, admissions...)
+	}
+}
+
+// admit runs the admission controllers on a copy of the snapshot, since its
+// maps are shared with the caller and with the snapshots of the cache, and
+// returns the admitted copy.
+func (cache *snapshotCache) admit(ctx context.Context, node string, snapshot Snapshot) (Snapshot, error) {
+	if len(cache.admissions) == 0 {
+		return snapshot, nil
+	}
+	builder := NewSnapshotBuilderFrom(snapshot)
+	for typ := range snapshot.Resources {
+		if _, err := builder.mutable(GetResponseTypeURL(types.ResponseType(typ))); err != nil {
+			return Snapshot{}, err
+		}
+	}
+	admitted := builder.snapshot
+	admitted.Signature = snapshot.Signature
+	admitted.HealthOnly = snapshot.HealthOnly
+	for _, admission := range cache.admissions {
+		if err := admission.Admit(ctx, node, &admitted); err != nil {
+			return Snapshot{}, fmt.Errorf("snapshot for node %s not admitted: %v", node, err)
+		}
+	}
+	return admitted, nil
+}
+
+// AdmissionReview is the body of the requests of the HTTP webhook.
+type AdmissionReview struct {
+	Node string `json:"node"`
+
+	// Snapshot is rendered by the JSON codec, as an array of discovery
+	// responses.
+	Snapshot json.RawMessage `json:"snapshot"`
+}
+
+// AdmissionResponse is the body of the responses of the HTTP webhook.
+type AdmissionResponse struct {
+	Allowed bool   `json:"allowed"`
+	Reason  string `json:"reason,omitempty"`
+
+	// Snapshot optionally replaces the reviewed snapshot, rendered by the
+	// JSON codec. The version gates, the TTLs and the variants are dropped
+	// from the replaced snapshot, see Codec.
+	Snapshot json.RawMessage `json:"snapshot,omitempty"`
+}
+
+// HTTPAdmission is a reference admission controller posting the snapshots
+// to a webhook as an AdmissionReview, and expecting an AdmissionResponse.
+// The snapshots are rejected on a webhook failure.
+type HTTPAdmission struct {
+	// URL of the webhook.
+	URL string
+
+	// Client optionally sets the HTTP client.
+	Client *http.Client
+
+	// Timeout of the webhook requests, 10 seconds if zero.
+	Timeout time.Duration
+}
+
+var _ Admission = &HTTPAdmission{}
+
+// Admit implements Admission.
+func (h *HTTPAdmission) Admit(ctx context.Context, node string, snapshot *Snapshot) error {
+	codec := JSONCodec{}
+	rendered, err := codec.Marshal(*snapshot)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(AdmissionReview{Node: node, Snapshot: rendered})
+	if err != nil {
+		return err
+	}
+
+	timeout := h.Timeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequest(http.MethodPost, h.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	client := h.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("admission webhook: %v", err)
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("admission webhook: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("admission webhook: status %d", resp.StatusCode)
+	}
+
+	var out AdmissionResponse
+	if err := json.Unmarshal(data, &out); err != nil {
+		return fmt.Errorf("admission webhook: %v", err)
+	}
+	if !out.Allowed {
+		return fmt.Errorf("denied: %s", out.Reason)
+	}
+	if len(out.Snapshot) > 0 {
+		mutated, err := codec.Unmarshal(out.Snapshot)
+		if err != nil {
+			return fmt.Errorf("admission webhook snapshot: %v", err)
+		}
+		*snapshot = mutated
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package cache_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/v2"
+	rsrc "github.com/envoyproxy/go-control-plane/pkg/resource/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/test/resource/v2"
+)
+
+func TestAdmission(t *testing.T) {
+	c := cache.NewSnapshotCache(false, cache.IDHash{}, nil, cache.WithAdmission(
+		cache.AdmissionFunc(func(_ context.Context, node string, snapshot *cache.Snapshot) error {
+			if node == "denied" {
+				return errors.New("node is denied")
+			}
+			return nil
+		}),
+		cache.AdmissionFunc(func(_ context.Context, _ string, snapshot *cache.Snapshot) error {
+			// strip the runtimes
+			snapshot.Resources[types.Runtime] = cache.Resources{}
+			return nil
+		}),
+	))
+
+	if err := c.SetSnapshot("denied", snapshot); err == nil {
+		t.Error("SetSnapshot() of a denied node => got no error")
+	}
+	if _, err := c.GetSnapshot("denied"); err == nil {
+		t.Error("GetSnapshot() of a denied node => got a snapshot")
+	}
+
+	if err := c.SetSnapshot(key, snapshot); err != nil {
+		t.Fatal(err)
+	}
+	got, err := c.GetSnapshot(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(got.GetResources(rsrc.RuntimeType)); n != 0 {
+		t.Errorf("mutated runtimes => got %d, want 0", n)
+	}
+	if n := len(snapshot.GetResources(rsrc.RuntimeType)); n != 1 {
+		t.Errorf("caller runtimes => got %d, want 1", n)
+	}
+}
+
+func TestAdmissionCopies(t *testing.T) {
+	c := cache.NewSnapshotCache(false, cache.IDHash{}, nil, cache.WithAdmission(
+		cache.AdmissionFunc(func(_ context.Context, _ string, snapshot *cache.Snapshot) error {
+			// strip the clusters in place
+			for name := range snapshot.Resources[types.Cluster].Items {
+				delete(snapshot.Resources[types.Cluster].Items, name)
+			}
+			if len(snapshot.Resources[types.Listener].Items) > 1 {
+				return errors.New("too many listeners")
+			}
+			return nil
+		}),
+	))
+	if err := c.SetSnapshot(key, snapshot); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(snapshot.GetResources(rsrc.ClusterType)); n != 1 {
+		t.Errorf("caller clusters => got %d, want 1", n)
+	}
+	got, _ := c.GetSnapshot(key)
+	if n := len(got.GetResources(rsrc.ClusterType)); n != 0 {
+		t.Errorf("admitted clusters => got %d, want 0", n)
+	}
+
+	// the upserts are admitted too, without modifying the stored snapshot
+	if err := c.UpsertResources(key, rsrc.ClusterType, []types.Resource{testCluster}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if after, _ := c.GetSnapshot(key); len(after.GetResources(rsrc.ClusterType)) != 0 {
+		t.Errorf("upserted clusters => got %d, want the admitted 0", len(after.GetResources(rsrc.ClusterType)))
+	}
+	if err := c.UpsertResources(key, rsrc.ListenerType, []types.Resource{resource.MakeTCPListener("other", 9000, clusterName)}, nil); err == nil {
+		t.Error("UpsertResources() of a denied snapshot => got no error")
+	}
+	if after, _ := c.GetSnapshot(key); len(after.GetResources(rsrc.ListenerType)) != 1 {
+		t.Errorf("denied listeners => got %d, want 1", len(after.GetResources(rsrc.ListenerType)))
+	}
+}
+
+func TestHTTPAdmission(t *testing.T) {
+	var reviewed cache.AdmissionReview
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&reviewed); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		out := cache.AdmissionResponse{Allowed: reviewed.Node != "denied", Reason: "policy"}
+		if reviewed.Node == "mutated" {
+			stripped := snapshot.WithRuntimes(version2, nil)
+			out.Snapshot, _ = cache.JSONCodec{}.Marshal(stripped)
+		}
+		_ = json.NewEncoder(w).Encode(out)
+	}))
+	defer webhook.Close()
+	c := cache.NewSnapshotCache(false, cache.IDHash{}, nil, cache.WithAdmission(&cache.HTTPAdmission{URL: webhook.URL}))
+
+	if err := c.SetSnapshot(key, snapshot); err != nil {
+		t.Fatal(err)
+	}
+	if reviewed.Node != key || len(reviewed.Snapshot) == 0 {
+		t.Errorf("review => got node %q with %d bytes, want node %q with the snapshot", reviewed.Node, len(reviewed.Snapshot), key)
+	}
+
+	if err := c.SetSnapshot("denied", snapshot); err == nil {
+		t.Error("SetSnapshot() denied by the webhook => got no error")
+	}
+
+	if err := c.SetSnapshot("mutated", snapshot); err != nil {
+		t.Fatal(err)
+	}
+	got, err := c.GetSnapshot("mutated")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.GetVersion(rsrc.RuntimeType) != version2 || len(got.GetResources(rsrc.ClusterType)) != 1 {
+		t.Errorf("mutated snapshot => got runtime version %q and %d clusters, want %q and 1",
+			got.GetVersion(rsrc.RuntimeType), len(got.GetResources(rsrc.ClusterType)), version2)
+	}
+
+	webhook.Close()
+	if err := c.SetSnapshot(key, snapshot); err == nil {
+		t.Error("SetSnapshot() with the webhook down => got no error")
+	}
+}
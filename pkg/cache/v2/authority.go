@@ -0,0 +1,106 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package cache
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/envoyproxy/go-control-plane/pkg/xdstp"
+)
+
+// AuthorityRouter routes the requests for xdstp names to the cache of the
+// name authority, so one server serves the resources owned by several
+// authorities per the xDS federation design. A backing cache may hold the
+// resources locally or fetch them from the upstream server of the authority.
+//
+// The clients subscribe to the resources of each authority separately, so a
+// request must not mix the names of several authorities or mix xdstp names
+// with the legacy ones. Such requests, as well as the requests for unknown
+// authorities, are rejected: the watches are closed, which terminates the
+// stream on the server, and Fetch returns an error.
+type AuthorityRouter struct {
+	// Authorities are the caches indexed by authority. The empty authority
+	// of the "xdstp:///" names is a valid key.
+	Authorities map[string]Cache
+
+	// Legacy is the optional cache of the requests for the legacy names and
+	// of the wildcard requests.
+	Legacy Cache
+}
+
+var _ Cache = &AuthorityRouter{}
+
+// Authority returns the authority of the request names. Legacy requests,
+// including the wildcard ones, have no authority.
+func Authority(request *Request) (authority string, federated bool, err error) {
+	for i, name := range request.ResourceNames {
+		if !xdstp.IsXDSTP(name) {
+			if federated {
+				return "", false, fmt.Errorf("legacy name %q mixed with xdstp names", name)
+			}
+			continue
+		}
+		urn, err := xdstp.Parse(name)
+		if err != nil {
+			return "", false, err
+		}
+		switch {
+		case i == 0:
+			authority, federated = urn.Authority, true
+		case !federated:
+			return "", false, fmt.Errorf("xdstp name %q mixed with legacy names", name)
+		case urn.Authority != authority:
+			return "", false, fmt.Errorf("names of authorities %q and %q in one request", authority, urn.Authority)
+		}
+	}
+	return authority, federated, nil
+}
+
+func (router *AuthorityRouter) cache(request *Request) (Cache, error) {
+	authority, federated, err := Authority(request)
+	if err != nil {
+		return nil, err
+	}
+	if !federated {
+		if router.Legacy == nil {
+			return nil, fmt.Errorf("no cache for legacy names of type %q", request.TypeUrl)
+		}
+		return router.Legacy, nil
+	}
+	cache, exists := router.Authorities[authority]
+	if !exists {
+		return nil, fmt.Errorf("unknown authority %q", authority)
+	}
+	return cache, nil
+}
+
+func (router *AuthorityRouter) CreateWatch(request *Request) (chan Response, func()) {
+	cache, err := router.cache(request)
+	if err != nil {
+		value := make(chan Response, 0)
+		close(value)
+		return value, nil
+	}
+	return cache.CreateWatch(request)
+}
+
+func (router *AuthorityRouter) Fetch(ctx context.Context, request *Request) (Response, error) {
+	cache, err := router.cache(request)
+	if err != nil {
+		return nil, err
+	}
+	return cache.Fetch(ctx, request)
+}
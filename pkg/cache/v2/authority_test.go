@@ -0,0 +1,86 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package cache_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/envoyproxy/go-control-plane/pkg/cache/v2"
+	rsrc "github.com/envoyproxy/go-control-plane/pkg/resource/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/test/resource/v2"
+)
+
+func TestAuthorityRouter(t *testing.T) {
+	name := func(authority, id string) string {
+		return "xdstp://" + authority + "/envoy.api.v2.ClusterLoadAssignment/" + id
+	}
+	a := cache.NewLinearCache(rsrc.EndpointType)
+	if err := a.UpdateResource(name("a", "x"), resource.MakeEndpoint(name("a", "x"), 8080)); err != nil {
+		t.Fatal(err)
+	}
+	b := cache.NewLinearCache(rsrc.EndpointType)
+	if err := b.UpdateResource(name("b", "x"), resource.MakeEndpoint(name("b", "x"), 8080)); err != nil {
+		t.Fatal(err)
+	}
+	legacy := cache.NewLinearCache(rsrc.EndpointType)
+	if err := legacy.UpdateResource(clusterName, testEndpoint); err != nil {
+		t.Fatal(err)
+	}
+	router := &cache.AuthorityRouter{
+		Authorities: map[string]cache.Cache{"a": a, "b": b},
+		Legacy:      legacy,
+	}
+
+	served := func(names ...string) []string {
+		t.Helper()
+		value, _ := router.CreateWatch(&cache.Request{TypeUrl: rsrc.EndpointType, ResourceNames: names})
+		out, more := <-value
+		if !more {
+			return nil
+		}
+		var got []string
+		for _, res := range out.(*cache.RawResponse).Resources {
+			got = append(got, cache.GetResourceName(res))
+		}
+		return got
+	}
+	for _, want := range []string{name("a", "x"), name("b", "x"), clusterName} {
+		if got := served(want); len(got) != 1 || got[0] != want {
+			t.Errorf("routed %q => got %v, want %q", want, got, want)
+		}
+	}
+
+	for _, names := range [][]string{
+		{name("a", "x"), name("b", "x")},
+		{name("a", "x"), clusterName},
+		{clusterName, name("a", "x")},
+		{name("c", "x")},
+		{"xdstp://a/bad"},
+	} {
+		if got := served(names...); got != nil {
+			t.Errorf("rejected %v => got %v, want a closed watch", names, got)
+		}
+		if _, err := router.Fetch(context.Background(), &cache.Request{TypeUrl: rsrc.EndpointType, ResourceNames: names}); err == nil {
+			t.Errorf("rejected Fetch(%v) => got no error", names)
+		}
+	}
+
+	// wildcard requests go to the legacy cache
+	router.Legacy = nil
+	if got := served(); got != nil {
+		t.Errorf("wildcard without a legacy cache => got %v, want a closed watch", got)
+	}
+}
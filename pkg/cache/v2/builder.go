@@ -0,0 +1,158 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package cache
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
+)
+
+// SnapshotBuilder derives the snapshots from one another with structural
+// sharing. The snapshots are immutable once built: the cache, its views and
+// the callers of GetSnapshot share their maps without copying them, so a
+// snapshot must not be modified in place. The builder copies the maps of a
+// type on its first change after a build, so the unchanged types are shared
+// by the successive snapshots, and reading a snapshot never copies it.
+//
+//	builder := cache.NewSnapshotBuilderFrom(previous)
+//	builder.SetResource(resource.EndpointType, endpoints)
+//	next := builder.Build("v2")
+//
+// A builder is not safe for concurrent use.
+type SnapshotBuilder struct {
+	snapshot Snapshot
+
+	// owned marks the types whose maps are not shared with a built snapshot
+	owned [types.UnknownType]bool
+
+	// changed marks the types changed since the last build
+	changed [types.UnknownType]bool
+}
+
+// NewSnapshotBuilder creates a builder of an empty snapshot.
+func NewSnapshotBuilder() *SnapshotBuilder {
+	return &SnapshotBuilder{}
+}
+
+// NewSnapshotBuilderFrom creates a builder sharing the resources of a
+// snapshot until they change. The signature and the health-only flag of the
+// snapshot are dropped.
+func NewSnapshotBuilderFrom(snapshot Snapshot) *SnapshotBuilder {
+	return &SnapshotBuilder{snapshot: Snapshot{Resources: snapshot.Resources}}
+}
+
+// SetResource adds or replaces resources of a type. The version gate and the
+// TTL of a replaced resource are dropped.
+func (b *SnapshotBuilder) SetResource(typeURL string, resources ...types.Resource) error {
+	typ, err := b.mutable(typeURL)
+	if err != nil {
+		return err
+	}
+	for _, res := range resources {
+		name := GetResourceName(res)
+		b.snapshot.Resources[typ].Items[name] = res
+		b.drop(typ, name)
+	}
+	return nil
+}
+
+// SetResourceWithTTL adds or replaces a resource of a type with a TTL.
+func (b *SnapshotBuilder) SetResourceWithTTL(typeURL string, res types.Resource, ttl time.Duration) error {
+	if err := b.SetResource(typeURL, res); err != nil {
+		return err
+	}
+	resources := &b.snapshot.Resources[GetResponseType(typeURL)]
+	if resources.TTLs == nil {
+		resources.TTLs = make(map[string]time.Duration)
+	}
+	resources.TTLs[GetResourceName(res)] = ttl
+	return nil
+}
+
+// RemoveResource removes resources of a type by name.
+func (b *SnapshotBuilder) RemoveResource(typeURL string, names ...string) error {
+	typ, err := b.mutable(typeURL)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		delete(b.snapshot.Resources[typ].Items, name)
+		b.drop(typ, name)
+	}
+	return nil
+}
+
+// Build freezes the snapshot, setting the version of the types changed since
+// the last build, or of all the types on the first build. The builder keeps
+// the resources to derive the next snapshot.
+func (b *SnapshotBuilder) Build(version string) Snapshot {
+	for typ := range b.snapshot.Resources {
+		if b.changed[typ] || b.snapshot.Resources[typ].Version == "" {
+			b.snapshot.Resources[typ].Version = version
+		}
+		if b.snapshot.Resources[typ].Items == nil {
+			b.snapshot.Resources[typ].Items = make(map[string]types.Resource)
+		}
+	}
+	b.owned = [types.UnknownType]bool{}
+	b.changed = [types.UnknownType]bool{}
+	return b.snapshot
+}
+
+// mutable copies the maps of a type if they are shared with a snapshot.
+func (b *SnapshotBuilder) mutable(typeURL string) (types.ResponseType, error) {
+	typ := GetResponseType(typeURL)
+	if typ == types.UnknownType {
+		return typ, fmt.Errorf("unknown type URL %q", typeURL)
+	}
+	b.changed[typ] = true
+	if b.owned[typ] {
+		return typ, nil
+	}
+	b.owned[typ] = true
+
+	resources := &b.snapshot.Resources[typ]
+	resources.Items = copyItems(resources.Items)
+	if resources.Gates != nil {
+		gates := make(map[string]VersionGate, len(resources.Gates))
+		for name, gate := range resources.Gates {
+			gates[name] = gate
+		}
+		resources.Gates = gates
+	}
+	if resources.TTLs != nil {
+		ttls := make(map[string]time.Duration, len(resources.TTLs))
+		for name, ttl := range resources.TTLs {
+			ttls[name] = ttl
+		}
+		resources.TTLs = ttls
+	}
+	if resources.Variants != nil {
+		variants := make(map[string][]Variant, len(resources.Variants))
+		for name, set := range resources.Variants {
+			variants[name] = append([]Variant(nil), set...)
+		}
+		resources.Variants = variants
+	}
+	return typ, nil
+}
+
+// drop removes the version gate and the TTL of a changed resource.
+func (b *SnapshotBuilder) drop(typ types.ResponseType, name string) {
+	delete(b.snapshot.Resources[typ].Gates, name)
+	delete(b.snapshot.Resources[typ].TTLs, name)
+}
@@ -0,0 +1,83 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package cache_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/v2"
+	rsrc "github.com/envoyproxy/go-control-plane/pkg/resource/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/test/resource/v2"
+)
+
+func sameMap(a, b interface{}) bool {
+	return reflect.ValueOf(a).Pointer() == reflect.ValueOf(b).Pointer()
+}
+
+func TestSnapshotBuilder(t *testing.T) {
+	builder := cache.NewSnapshotBuilder()
+	if err := builder.SetResource(rsrc.ClusterType, testCluster); err != nil {
+		t.Fatal(err)
+	}
+	if err := builder.SetResourceWithTTL(rsrc.EndpointType, testEndpoint, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	first := builder.Build(version)
+	if got := first.GetVersion(rsrc.ListenerType); got != version {
+		t.Errorf("first build => got listener version %q, want %q", got, version)
+	}
+	if got := first.GetTTLs(rsrc.EndpointType)[clusterName]; got != time.Minute {
+		t.Errorf("first build => got TTL %v, want 1m", got)
+	}
+
+	if err := builder.SetResource(rsrc.EndpointType, resource.MakeEndpoint(clusterName, 9090)); err != nil {
+		t.Fatal(err)
+	}
+	second := builder.Build(version2)
+
+	if !sameMap(first.Resources[types.Cluster].Items, second.Resources[types.Cluster].Items) {
+		t.Error("unchanged type => got the resources copied, want them shared")
+	}
+	if got := second.GetVersion(rsrc.ClusterType); got != version {
+		t.Errorf("unchanged type => got version %q, want %q", got, version)
+	}
+	if sameMap(first.Resources[types.Endpoint].Items, second.Resources[types.Endpoint].Items) {
+		t.Error("changed type => got the resources shared with the previous snapshot")
+	}
+	if got := second.GetVersion(rsrc.EndpointType); got != version2 {
+		t.Errorf("changed type => got version %q, want %q", got, version2)
+	}
+	if first.GetResources(rsrc.EndpointType)[clusterName] != testEndpoint {
+		t.Error("previous snapshot => got the endpoint replaced")
+	}
+	if _, exists := second.GetTTLs(rsrc.EndpointType)[clusterName]; exists {
+		t.Error("replaced resource => got its TTL kept")
+	}
+
+	derived := cache.NewSnapshotBuilderFrom(second)
+	if err := derived.RemoveResource(rsrc.ClusterType, clusterName); err != nil {
+		t.Fatal(err)
+	}
+	third := derived.Build("z")
+	if len(third.GetResources(rsrc.ClusterType)) != 0 || len(second.GetResources(rsrc.ClusterType)) != 1 {
+		t.Error("removal => got the derived snapshot shared with its source")
+	}
+	if err := derived.SetResource("unknown"); err == nil {
+		t.Error("SetResource() with an unknown type => got no error")
+	}
+}
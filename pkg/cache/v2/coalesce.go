@@ -0,0 +1,71 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package cache
+
+import (
+	"sync/atomic"
+
+	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
+)
+
+// responseGroup is the response shared by the open watches of a node hash
+// with the same type, resource names and version when a snapshot update fans
+// out. With many proxies sharing a node hash, the resources are filtered once
+// and marshaled once for the group rather than once per watch. Each watch
+// still gets its own response with its own request, since the server sets
+// the stream nonce on the discovery response.
+type responseGroup struct {
+	// resources are the filtered resources
+	resources []types.Resource
+
+	// held is set if the ADS name check holds the watches
+	held bool
+
+	// marshaled holds the marshaled resources once a response is marshaled
+	marshaled atomic.Value
+}
+
+// responseGroups are the response groups of a fan-out indexed by response
+// keys, see responseKey. The groups only live for a fan-out, under the cache
+// lock.
+type responseGroups map[string]*responseGroup
+
+// coalesce returns the key of the group of a watch, or false if the response
+// varies by node, i.e. the type has version gates. The watches receiving the
+// resource TTLs are grouped apart, since their marshaled resources differ.
+func (groups responseGroups) coalesce(request *Request, snapshot *Snapshot, version string, ttls bool) (string, bool) {
+	typ := GetResponseType(request.TypeUrl)
+	if groups == nil || typ == types.UnknownType || len(snapshot.Resources[typ].Gates) > 0 {
+		return "", false
+	}
+	if ttls {
+		return responseKey(request, version) + "/ttl", true
+	}
+	return responseKey(request, version), true
+}
+
+// groupResponse creates the response of a watch from its group.
+func (cache *snapshotCache) groupResponse(request *Request, snapshot *Snapshot, group *responseGroup, version string) *RawResponse {
+	return &RawResponse{
+		Request:   request,
+		Version:   version,
+		Resources: group.resources,
+		TTLs:      cache.resourceTTLs(request, snapshot),
+		Marshaled: cache.marshaled,
+		group:     group,
+
+		marshalScope: cache.marshalScope(cache.hash.ID(request.Node), snapshot),
+	}
+}
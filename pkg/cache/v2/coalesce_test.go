@@ -0,0 +1,76 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package cache_test
+
+import (
+	"fmt"
+	"testing"
+
+	discovery "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/v2"
+	rsrc "github.com/envoyproxy/go-control-plane/pkg/resource/v2"
+)
+
+func TestCoalescedFanout(t *testing.T) {
+	c := cache.NewSnapshotCache(false, clusterHash{}, logger{t: t})
+	var watches []chan cache.Response
+	for i := 0; i < 3; i++ {
+		value, _ := c.CreateWatch(&discovery.DiscoveryRequest{
+			Node:          &core.Node{Id: fmt.Sprintf("proxy-%d", i), Cluster: "edge"},
+			TypeUrl:       rsrc.ClusterType,
+			ResourceNames: []string{clusterName},
+		})
+		watches = append(watches, value)
+	}
+	wildcard, _ := c.CreateWatch(&discovery.DiscoveryRequest{Node: &core.Node{Id: "wildcard", Cluster: "edge"}, TypeUrl: rsrc.ClusterType})
+
+	if err := c.SetSnapshot("edge", snapshot); err != nil {
+		t.Fatal(err)
+	}
+
+	var shared *discovery.DiscoveryResponse
+	for i, value := range watches {
+		out := (<-value).(*cache.RawResponse)
+		if got := out.GetRequest().GetNode().GetId(); got != fmt.Sprintf("proxy-%d", i) {
+			t.Errorf("coalesced response => got the request of %q, want proxy-%d", got, i)
+		}
+		resp, err := out.GetDiscoveryResponse()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(resp.Resources) != 1 {
+			t.Fatalf("coalesced response => got %d resources, want 1", len(resp.Resources))
+		}
+		if shared == nil {
+			shared = resp
+			continue
+		}
+		if resp == shared {
+			t.Error("coalesced response => got the discovery response of another watch, want its own")
+		}
+		if resp.Resources[0] != shared.Resources[0] {
+			t.Error("coalesced response => got the resources marshaled again, want them shared")
+		}
+	}
+
+	resp, err := (<-wildcard).GetDiscoveryResponse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Resources) != 1 || resp.Resources[0] == shared.Resources[0] {
+		t.Errorf("wildcard response => got %v, want its own resources", resp.Resources)
+	}
+}
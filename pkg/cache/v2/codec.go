@@ -0,0 +1,177 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package cache
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/any"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	discovery "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
+)
+
+// Codec serializes the snapshots, e.g. to persist or replicate them. The
+// snapshot versions and resources are serialized, but not the signatures,
+// version gates, TTLs, and health-only flags.
+type Codec interface {
+	Marshal(Snapshot) ([]byte, error)
+	Unmarshal([]byte) (Snapshot, error)
+}
+
+// BinaryCodec serializes the snapshots as a sequence of length-delimited
+// binary discovery responses, one per type.
+type BinaryCodec struct{}
+
+// JSONCodec serializes the snapshots as a JSON array of discovery responses,
+// one per type, which are human-auditable at a size cost.
+type JSONCodec struct {
+	// Indent optionally indents the output.
+	Indent string
+}
+
+var _ Codec = BinaryCodec{}
+var _ Codec = JSONCodec{}
+
+// Marshal implements Codec.
+func (BinaryCodec) Marshal(snapshot Snapshot) ([]byte, error) {
+	responses, err := snapshotResponses(snapshot)
+	if err != nil {
+		return nil, err
+	}
+	var out []byte
+	for _, response := range responses {
+		buf := proto.NewBuffer(nil)
+		buf.SetDeterministic(true)
+		if err := buf.Marshal(response); err != nil {
+			return nil, err
+		}
+		out = protowire.AppendBytes(out, buf.Bytes())
+	}
+	return out, nil
+}
+
+// Unmarshal implements Codec.
+func (BinaryCodec) Unmarshal(data []byte) (Snapshot, error) {
+	var responses []*discovery.DiscoveryResponse
+	for len(data) > 0 {
+		value, n := protowire.ConsumeBytes(data)
+		if n < 0 {
+			return Snapshot{}, errors.New("truncated snapshot")
+		}
+		data = data[n:]
+		response := &discovery.DiscoveryResponse{}
+		if err := proto.Unmarshal(value, response); err != nil {
+			return Snapshot{}, err
+		}
+		responses = append(responses, response)
+	}
+	return responsesSnapshot(responses)
+}
+
+// Marshal implements Codec.
+func (c JSONCodec) Marshal(snapshot Snapshot) ([]byte, error) {
+	responses, err := snapshotResponses(snapshot)
+	if err != nil {
+		return nil, err
+	}
+	marshaler := &jsonpb.Marshaler{OrigName: true}
+	out := make([]json.RawMessage, 0, len(responses))
+	for _, response := range responses {
+		buf := &bytes.Buffer{}
+		if err := marshaler.Marshal(buf, response); err != nil {
+			return nil, err
+		}
+		out = append(out, buf.Bytes())
+	}
+	if c.Indent != "" {
+		return json.MarshalIndent(out, "", c.Indent)
+	}
+	return json.Marshal(out)
+}
+
+// Unmarshal implements Codec.
+func (JSONCodec) Unmarshal(data []byte) (Snapshot, error) {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return Snapshot{}, err
+	}
+	responses := make([]*discovery.DiscoveryResponse, 0, len(raw))
+	for _, value := range raw {
+		response := &discovery.DiscoveryResponse{}
+		if err := jsonpb.Unmarshal(bytes.NewReader(value), response); err != nil {
+			return Snapshot{}, err
+		}
+		responses = append(responses, response)
+	}
+	return responsesSnapshot(responses)
+}
+
+// snapshotResponses returns a response per type, with the resources sorted by
+// name and marshaled deterministically.
+func snapshotResponses(snapshot Snapshot) ([]*discovery.DiscoveryResponse, error) {
+	var out []*discovery.DiscoveryResponse
+	for typ, resources := range snapshot.Resources {
+		if resources.Version == "" && len(resources.Items) == 0 {
+			continue
+		}
+		response := &discovery.DiscoveryResponse{
+			VersionInfo: resources.Version,
+			TypeUrl:     GetResponseTypeURL(types.ResponseType(typ)),
+		}
+		names := make([]string, 0, len(resources.Items))
+		for name := range resources.Items {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			value, err := MarshalResource(resources.Items[name])
+			if err != nil {
+				return nil, fmt.Errorf("resource %q: %v", name, err)
+			}
+			response.Resources = append(response.Resources, &any.Any{TypeUrl: response.TypeUrl, Value: value})
+		}
+		out = append(out, response)
+	}
+	return out, nil
+}
+
+func responsesSnapshot(responses []*discovery.DiscoveryResponse) (Snapshot, error) {
+	var out Snapshot
+	for _, response := range responses {
+		typ := GetResponseType(response.TypeUrl)
+		if typ == types.UnknownType {
+			return Snapshot{}, fmt.Errorf("unknown type %q", response.TypeUrl)
+		}
+		items := make([]types.Resource, 0, len(response.Resources))
+		for _, value := range response.Resources {
+			resource := &ptypes.DynamicAny{}
+			if err := ptypes.UnmarshalAny(value, resource); err != nil {
+				return Snapshot{}, err
+			}
+			items = append(items, resource.Message)
+		}
+		out.Resources[typ] = NewResources(response.VersionInfo, items)
+	}
+	return out, nil
+}
@@ -0,0 +1,69 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package cache_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+
+	"github.com/envoyproxy/go-control-plane/pkg/cache/v2"
+	rsrc "github.com/envoyproxy/go-control-plane/pkg/resource/v2"
+)
+
+func TestCodecs(t *testing.T) {
+	codecs := map[string]cache.Codec{
+		"binary": cache.BinaryCodec{},
+		"json":   cache.JSONCodec{Indent: "  "},
+	}
+	for name, codec := range codecs {
+		data, err := codec.Marshal(snapshot)
+		if err != nil {
+			t.Fatalf("%s: marshal => got error %v", name, err)
+		}
+		again, err := codec.Marshal(snapshot)
+		if err != nil || !bytes.Equal(data, again) {
+			t.Errorf("%s: marshal is not deterministic", name)
+		}
+		out, err := codec.Unmarshal(data)
+		if err != nil {
+			t.Fatalf("%s: unmarshal => got error %v", name, err)
+		}
+		for _, typeURL := range []string{rsrc.EndpointType, rsrc.ClusterType, rsrc.RouteType,
+			rsrc.ListenerType, rsrc.SecretType, rsrc.RuntimeType} {
+			if got, want := out.GetVersion(typeURL), snapshot.GetVersion(typeURL); got != want {
+				t.Errorf("%s: %s version => got %q, want %q", name, typeURL, got, want)
+			}
+			got, want := out.GetResources(typeURL), snapshot.GetResources(typeURL)
+			if len(got) != len(want) {
+				t.Errorf("%s: %s resources => got %v, want %v", name, typeURL, got, want)
+				continue
+			}
+			for resourceName, resource := range want {
+				if !proto.Equal(got[resourceName], resource) {
+					t.Errorf("%s: %s %q => got %v, want %v", name, typeURL, resourceName, got[resourceName], resource)
+				}
+			}
+		}
+	}
+
+	if _, err := (cache.BinaryCodec{}).Unmarshal([]byte{0x10}); err == nil {
+		t.Error("binary: unmarshal truncated data => got no error")
+	}
+	if _, err := (cache.JSONCodec{}).Unmarshal([]byte(`[{"type_url": "unknown"}]`)); err == nil {
+		t.Error("json: unmarshal unknown type => got no error")
+	}
+}
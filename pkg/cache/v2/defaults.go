@@ -0,0 +1,193 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package cache
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/duration"
+
+	cluster "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	route "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	auth "github.com/envoyproxy/go-control-plane/envoy/api/v2/auth"
+	routev2 "github.com/envoyproxy/go-control-plane/envoy/api/v2/route"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
+	"github.com/envoyproxy/go-control-plane/pkg/resource/v2"
+)
+
+// Defaults are organization-wide settings injected into the snapshot clusters
+// and routes. A default is applied only to the resources that do not set the
+// value explicitly. Zero values are not injected.
+type Defaults struct {
+	// ConnectTimeout for the clusters.
+	ConnectTimeout *duration.Duration
+
+	// MinimumTLSVersion for the clusters with an upstream TLS transport socket.
+	MinimumTLSVersion auth.TlsParameters_TlsProtocol
+
+	// RetryPolicy for the virtual hosts of the route configurations.
+	RetryPolicy *routev2.RetryPolicy
+
+	// RouteTimeout for the routes forwarding to the clusters.
+	RouteTimeout *duration.Duration
+}
+
+// Injection records a default value set on a resource.
+type Injection struct {
+	// TypeURL of the resource.
+	TypeURL string
+
+	// Name of the resource.
+	Name string
+
+	// Field path of the injected value within the resource.
+	Field string
+}
+
+func (i Injection) String() string {
+	return fmt.Sprintf("%s/%s: %s", i.TypeURL, i.Name, i.Field)
+}
+
+// ApplyDefaults injects the defaults into the snapshot resources and reports
+// the injected values. The modified resources are copies, so the resource
+// objects are never changed in place and can be shared across snapshots.
+func (s *Snapshot) ApplyDefaults(defaults Defaults) ([]Injection, error) {
+	var out []Injection
+
+	clusters, injected, err := applyDefaults(s.Resources[types.Cluster].Items, func(res types.Resource) ([]string, error) {
+		return defaults.applyCluster(res.(*cluster.Cluster))
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, injection := range injected {
+		injection.TypeURL = resource.ClusterType
+		out = append(out, injection)
+	}
+
+	routes, injected, err := applyDefaults(s.Resources[types.Route].Items, func(res types.Resource) ([]string, error) {
+		return defaults.applyRoute(res.(*route.RouteConfiguration)), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, injection := range injected {
+		injection.TypeURL = resource.RouteType
+		out = append(out, injection)
+	}
+
+	s.Resources[types.Cluster].Items = clusters
+	s.Resources[types.Route].Items = routes
+	return out, nil
+}
+
+// applyDefaults applies a function to copies of the resources in the name
+// order, and returns a new resource map if any of the copies is modified.
+func applyDefaults(items map[string]types.Resource, apply func(types.Resource) ([]string, error)) (map[string]types.Resource, []Injection, error) {
+	names := make([]string, 0, len(items))
+	for name := range items {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var out []Injection
+	modified := make(map[string]types.Resource)
+	for _, name := range names {
+		res := proto.Clone(items[name])
+		fields, err := apply(res)
+		if err != nil {
+			return nil, nil, fmt.Errorf("resource %q: %v", name, err)
+		}
+		if len(fields) == 0 {
+			continue
+		}
+		modified[name] = res
+		for _, field := range fields {
+			out = append(out, Injection{Name: name, Field: field})
+		}
+	}
+	if len(modified) == 0 {
+		return items, nil, nil
+	}
+
+	updated := make(map[string]types.Resource, len(items))
+	for name, res := range items {
+		updated[name] = res
+	}
+	for name, res := range modified {
+		updated[name] = res
+	}
+	return updated, out, nil
+}
+
+func (defaults Defaults) applyCluster(c *cluster.Cluster) ([]string, error) {
+	var fields []string
+	if defaults.ConnectTimeout != nil && c.ConnectTimeout == nil {
+		c.ConnectTimeout = proto.Clone(defaults.ConnectTimeout).(*duration.Duration)
+		fields = append(fields, "connect_timeout")
+	}
+
+	if defaults.MinimumTLSVersion != auth.TlsParameters_TLS_AUTO && c.GetTransportSocket().GetTypedConfig() != nil {
+		config := c.GetTransportSocket().GetTypedConfig()
+		tls := &auth.UpstreamTlsContext{}
+		if !ptypes.Is(config, tls) {
+			return fields, nil
+		}
+		if err := ptypes.UnmarshalAny(config, tls); err != nil {
+			return nil, err
+		}
+		if tls.CommonTlsContext == nil {
+			tls.CommonTlsContext = &auth.CommonTlsContext{}
+		}
+		if tls.CommonTlsContext.TlsParams == nil {
+			tls.CommonTlsContext.TlsParams = &auth.TlsParameters{}
+		}
+		if tls.CommonTlsContext.TlsParams.TlsMinimumProtocolVersion == auth.TlsParameters_TLS_AUTO {
+			tls.CommonTlsContext.TlsParams.TlsMinimumProtocolVersion = defaults.MinimumTLSVersion
+			packed, err := ptypes.MarshalAny(tls)
+			if err != nil {
+				return nil, err
+			}
+			config.Value = packed.Value
+			fields = append(fields, "transport_socket.typed_config.common_tls_context.tls_params.tls_minimum_protocol_version")
+		}
+	}
+	return fields, nil
+}
+
+func (defaults Defaults) applyRoute(r *route.RouteConfiguration) []string {
+	var fields []string
+	for _, vh := range r.VirtualHosts {
+		if defaults.RetryPolicy != nil && vh.RetryPolicy == nil {
+			vh.RetryPolicy = proto.Clone(defaults.RetryPolicy).(*routev2.RetryPolicy)
+			fields = append(fields, fmt.Sprintf("virtual_hosts[%s].retry_policy", vh.Name))
+		}
+		if defaults.RouteTimeout == nil {
+			continue
+		}
+		for i, rt := range vh.Routes {
+			action := rt.GetRoute()
+			if action == nil || action.Timeout != nil {
+				continue
+			}
+			action.Timeout = proto.Clone(defaults.RouteTimeout).(*duration.Duration)
+			fields = append(fields, fmt.Sprintf("virtual_hosts[%s].routes[%d].route.timeout", vh.Name, i))
+		}
+	}
+	return fields
+}
@@ -0,0 +1,100 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package cache_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+
+	cluster "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	route "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	auth "github.com/envoyproxy/go-control-plane/envoy/api/v2/auth"
+	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	v2route "github.com/envoyproxy/go-control-plane/envoy/api/v2/route"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/v2"
+	rsrc "github.com/envoyproxy/go-control-plane/pkg/resource/v2"
+)
+
+func TestApplyDefaults(t *testing.T) {
+	tlsContext, err := ptypes.MarshalAny(&auth.UpstreamTlsContext{Sni: "example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tlsCluster := &cluster.Cluster{
+		Name: "tls",
+		TransportSocket: &core.TransportSocket{
+			Name:       "envoy.transport_sockets.tls",
+			ConfigType: &core.TransportSocket_TypedConfig{TypedConfig: tlsContext},
+		},
+	}
+	explicitRoute := proto.Clone(testRoute).(*route.RouteConfiguration)
+	explicitRoute.Name = "explicit"
+	explicitRoute.VirtualHosts[0].RetryPolicy = &v2route.RetryPolicy{RetryOn: "connect-failure"}
+	explicitRoute.VirtualHosts[0].Routes[0].GetRoute().Timeout = ptypes.DurationProto(time.Minute)
+
+	snap := cache.NewSnapshot(version, nil,
+		[]types.Resource{testCluster, tlsCluster},
+		[]types.Resource{testRoute, explicitRoute}, nil, nil, nil)
+	original := proto.Clone(tlsCluster)
+
+	injected, err := snap.ApplyDefaults(cache.Defaults{
+		ConnectTimeout:    ptypes.DurationProto(time.Second),
+		MinimumTLSVersion: auth.TlsParameters_TLSv1_2,
+		RetryPolicy:       &v2route.RetryPolicy{RetryOn: "5xx"},
+		RouteTimeout:      ptypes.DurationProto(10 * time.Second),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []cache.Injection{
+		{TypeURL: rsrc.ClusterType, Name: "tls", Field: "connect_timeout"},
+		{TypeURL: rsrc.ClusterType, Name: "tls", Field: "transport_socket.typed_config.common_tls_context.tls_params.tls_minimum_protocol_version"},
+		{TypeURL: rsrc.RouteType, Name: routeName, Field: "virtual_hosts[" + routeName + "].retry_policy"},
+		{TypeURL: rsrc.RouteType, Name: routeName, Field: "virtual_hosts[" + routeName + "].routes[0].route.timeout"},
+	}
+	if !reflect.DeepEqual(injected, want) {
+		t.Errorf("injections => got %v, want %v", injected, want)
+	}
+
+	if !proto.Equal(tlsCluster, original) {
+		t.Error("resource must not be modified in place")
+	}
+	if got := snap.GetResources(rsrc.ClusterType)[clusterName]; got != testCluster {
+		t.Error("unmodified resource must not be copied")
+	}
+
+	gotCluster := snap.GetResources(rsrc.ClusterType)["tls"].(*cluster.Cluster)
+	gotTLS := &auth.UpstreamTlsContext{}
+	if err := ptypes.UnmarshalAny(gotCluster.GetTransportSocket().GetTypedConfig(), gotTLS); err != nil {
+		t.Fatal(err)
+	}
+	if got := gotTLS.GetCommonTlsContext().GetTlsParams().GetTlsMinimumProtocolVersion(); got != auth.TlsParameters_TLSv1_2 {
+		t.Errorf("minimum TLS version => got %v, want %v", got, auth.TlsParameters_TLSv1_2)
+	}
+	if gotTLS.Sni != "example.com" {
+		t.Errorf("TLS context must be preserved, got %v", gotTLS)
+	}
+
+	gotRoute := snap.GetResources(rsrc.RouteType)["explicit"].(*route.RouteConfiguration)
+	if got := gotRoute.VirtualHosts[0].RetryPolicy.RetryOn; got != "connect-failure" {
+		t.Errorf("explicit retry policy => got %q", got)
+	}
+}
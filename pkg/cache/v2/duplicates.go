@@ -0,0 +1,181 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package cache
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
+)
+
+// DuplicateNameError is a resource name found more than once within a type,
+// which the clients reject. The producers of the duplicates are listed when
+// they are known from the ownership labels, see Ownership.
+type DuplicateNameError struct {
+	Node      string
+	TypeURL   string
+	Name      string
+	Producers []string
+}
+
+func (e *DuplicateNameError) Error() string {
+	msg := fmt.Sprintf("duplicate resource %q of %s", e.Name, e.TypeURL)
+	if e.Node != "" {
+		msg += " for node " + e.Node
+	}
+	if len(e.Producers) > 0 {
+		msg += fmt.Sprintf(" from %q", strings.Join(e.Producers, `", "`))
+	}
+	return msg
+}
+
+// duplicateName returns the first duplicate name of the resources, in order.
+func duplicateName(resources []types.Resource) (string, bool) {
+	seen := make(map[string]struct{}, len(resources))
+	for _, res := range resources {
+		name := GetResourceName(res)
+		if name == "" {
+			continue
+		}
+		if _, exists := seen[name]; exists {
+			return name, true
+		}
+		seen[name] = struct{}{}
+	}
+	return "", false
+}
+
+// NewSnapshotStrict is NewSnapshot rejecting the resource names listed more
+// than once within a type, which NewSnapshot silently replaces by the last
+// resource of the name.
+func NewSnapshotStrict(version string,
+	endpoints []types.Resource,
+	clusters []types.Resource,
+	routes []types.Resource,
+	listeners []types.Resource,
+	runtimes []types.Resource,
+	secrets []types.Resource) (Snapshot, error) {
+	out := NewSnapshot(version, endpoints, clusters, routes, listeners, runtimes, secrets)
+	for typ, resources := range [types.UnknownType][]types.Resource{
+		types.Endpoint: endpoints,
+		types.Cluster:  clusters,
+		types.Route:    routes,
+		types.Listener: listeners,
+		types.Runtime:  runtimes,
+		types.Secret:   secrets,
+	} {
+		if len(out.Resources[typ].Items) == len(resources) {
+			continue
+		}
+		if name, exists := duplicateName(resources); exists {
+			return Snapshot{}, &DuplicateNameError{TypeURL: GetResponseTypeURL(types.ResponseType(typ)), Name: name}
+		}
+	}
+	return out, nil
+}
+
+// WithStrictNames rejects the duplicate resource names within a type:
+//
+//   - SetSnapshot rejects the snapshots indexing resources of the same name
+//     under several keys,
+//   - UpsertResources and UpsertOwnedResources reject the resources listing
+//     a name more than once,
+//   - the responses listing a name more than once fail, so that the server
+//     fails the type rather than sending a response the client rejects.
+//
+// The errors are *DuplicateNameError, listing the producers of the
+// duplicates with the ownership labels, see WithOwnership.
+func WithStrictNames() SnapshotCacheOption {
+	return func(cache *snapshotCache) {
+		cache.strictNames = true
+	}
+}
+
+// checkSnapshotNames verifies that the resources of a snapshot are indexed
+// by their names, so that no two keys send resources of the same name.
+func (cache *snapshotCache) checkSnapshotNames(node string, snapshot *Snapshot) error {
+	for typ := range snapshot.Resources {
+		keys := make(map[string][]string)
+		for key, res := range snapshot.Resources[typ].Items {
+			if name := GetResourceName(res); name != "" {
+				keys[name] = append(keys[name], key)
+			}
+		}
+		for name, indexed := range keys {
+			if len(indexed) > 1 {
+				sort.Strings(indexed)
+				return cache.duplicateError(node, GetResponseTypeURL(types.ResponseType(typ)), name, indexed...)
+			}
+		}
+	}
+	return nil
+}
+
+// checkUpsertNames verifies that the upserted resources list their names
+// once, on behalf of an optional writer.
+func (cache *snapshotCache) checkUpsertNames(node, typeURL, writer string, resources []types.Resource) error {
+	name, exists := duplicateName(resources)
+	if !exists {
+		return nil
+	}
+	err := cache.duplicateError(node, typeURL, name, name)
+	if writer != "" && !containsString(err.Producers, writer) {
+		err.Producers = append(err.Producers, writer)
+	}
+	return err
+}
+
+// checkResponseNames verifies that the resources of a response list their
+// names once, given the resources indexed by key they are selected from.
+func (cache *snapshotCache) checkResponseNames(request *Request, indexed map[string]types.Resource, resources []types.Resource) error {
+	name, exists := duplicateName(resources)
+	if !exists {
+		return nil
+	}
+	var keys []string
+	for key, res := range indexed {
+		if GetResourceName(res) == name {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return cache.duplicateError(cache.hash.ID(request.Node), request.TypeUrl, name, keys...)
+}
+
+// duplicateError creates the error of a duplicate name, with the owners of
+// the keys of the duplicates if the ownership is enabled.
+func (cache *snapshotCache) duplicateError(node, typeURL, name string, keys ...string) *DuplicateNameError {
+	err := &DuplicateNameError{Node: node, TypeURL: typeURL, Name: name}
+	if cache.ownership == nil {
+		return err
+	}
+	for _, key := range keys {
+		if owner, exists := cache.ownership.Owner(node, typeURL, key); exists && !containsString(err.Producers, owner) {
+			err.Producers = append(err.Producers, owner)
+		}
+	}
+	return err
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
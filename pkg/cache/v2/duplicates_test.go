@@ -0,0 +1,75 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package cache_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/v2"
+	rsrc "github.com/envoyproxy/go-control-plane/pkg/resource/v2"
+)
+
+func TestNewSnapshotStrict(t *testing.T) {
+	if _, err := cache.NewSnapshotStrict(version, []types.Resource{testEndpoint}, []types.Resource{testCluster}, nil, nil, nil, nil); err != nil {
+		t.Errorf("NewSnapshotStrict() => got %v, want no error", err)
+	}
+	_, err := cache.NewSnapshotStrict(version, nil, []types.Resource{testCluster, testCluster}, nil, nil, nil, nil)
+	dup, ok := err.(*cache.DuplicateNameError)
+	if !ok || dup.TypeURL != rsrc.ClusterType || dup.Name != clusterName {
+		t.Errorf("NewSnapshotStrict() with a duplicate cluster => got %v, want a duplicate %s", err, clusterName)
+	}
+}
+
+func TestStrictNames(t *testing.T) {
+	ownership := cache.NewOwnership(cache.RejectConflicts, nil)
+	c := cache.NewSnapshotCache(false, group{}, logger{t: t}, cache.WithStrictNames(), cache.WithOwnership(ownership))
+	owned := c.(cache.OwnedUpserter)
+	if err := c.SetSnapshot(key, snapshot); err != nil {
+		t.Fatal(err)
+	}
+	if err := owned.UpsertOwnedResources("discovery", key, rsrc.ClusterType, []types.Resource{testCluster}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// a resource indexed under another key is a duplicate on the wire
+	aliased := snapshot
+	aliased.Resources[types.Cluster] = cache.Resources{
+		Version: version2,
+		Items:   map[string]types.Resource{clusterName: testCluster, "alias": testCluster},
+	}
+	err := c.SetSnapshot(key, aliased)
+	dup, ok := err.(*cache.DuplicateNameError)
+	if !ok || dup.Name != clusterName || !reflect.DeepEqual(dup.Producers, []string{"discovery"}) {
+		t.Errorf("SetSnapshot() with an aliased cluster => got %v, want a duplicate from discovery", err)
+	}
+
+	// the writer of the duplicates is listed along with the owner
+	err = owned.UpsertOwnedResources("gitops", key, rsrc.ClusterType, []types.Resource{testCluster, testCluster}, nil)
+	dup, ok = err.(*cache.DuplicateNameError)
+	if !ok || dup.Node != key || !reflect.DeepEqual(dup.Producers, []string{"discovery", "gitops"}) {
+		t.Errorf("UpsertOwnedResources() with a duplicate => got %v, want a duplicate from discovery and gitops", err)
+	}
+	if err := c.UpsertResources(key, rsrc.ClusterType, []types.Resource{testCluster, testCluster}, nil); err == nil {
+		t.Error("UpsertResources() with a duplicate => got no error")
+	}
+
+	// the non-strict caches keep the last resource of a name
+	lax := cache.NewSnapshotCache(false, group{}, logger{t: t})
+	if err := lax.SetSnapshot(key, aliased); err != nil {
+		t.Errorf("SetSnapshot() without strict names => got %v", err)
+	}
+}
@@ -0,0 +1,62 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package cache
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"time"
+
+	auth "github.com/envoyproxy/go-control-plane/envoy/api/v2/auth"
+	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+)
+
+// CertificateExpiry returns the earliest NotAfter time of the inline PEM
+// certificates in a secret, i.e. the TLS certificate chain or the trusted CA
+// of a validation context. The zero time is returned for secrets without
+// inline certificates, e.g. ones referring to files on the client host.
+func CertificateExpiry(secret *auth.Secret) (time.Time, error) {
+	var source *core.DataSource
+	switch {
+	case secret.GetTlsCertificate() != nil:
+		source = secret.GetTlsCertificate().GetCertificateChain()
+	case secret.GetValidationContext() != nil:
+		source = secret.GetValidationContext().GetTrustedCa()
+	}
+
+	data := source.GetInlineBytes()
+	if data == nil {
+		data = []byte(source.GetInlineString())
+	}
+
+	var expiry time.Time
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return expiry, nil
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if expiry.IsZero() || cert.NotAfter.Before(expiry) {
+			expiry = cert.NotAfter
+		}
+	}
+}
@@ -0,0 +1,34 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package cache_test
+
+import (
+	"testing"
+	"time"
+
+	auth "github.com/envoyproxy/go-control-plane/envoy/api/v2/auth"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/v2"
+)
+
+func TestCertificateExpiry(t *testing.T) {
+	want := time.Date(2019, time.August, 9, 23, 8, 42, 0, time.UTC)
+	if got, err := cache.CertificateExpiry(testSecret[0]); err != nil || !got.Equal(want) {
+		t.Errorf("CertificateExpiry(%q) => got %v, %v, want %v", testSecret[0].Name, got, err, want)
+	}
+	if got, err := cache.CertificateExpiry(&auth.Secret{Name: "empty"}); err != nil || !got.IsZero() {
+		t.Errorf("CertificateExpiry(empty) => got %v, %v, want zero time", got, err)
+	}
+
+}
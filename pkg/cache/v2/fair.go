@@ -0,0 +1,130 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package cache
+
+import (
+	"sort"
+
+	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
+)
+
+// WithFairNotifications builds the responses to the watches notified by an
+// update in a separate goroutine, round-robin across the watches with a
+// quantum of resources read per turn, so that the watches of a few resources
+// are not starved behind the watches of the whole collection. The update
+// returns without waiting for the responses.
+//
+// The responses carry the version of the update that notified them. The
+// resources read in the later turns may be newer, in which case the clients
+// are responded once more, since their version is behind the resources.
+func WithFairNotifications(quantum int) LinearCacheOption {
+	return func(cache *LinearCache) {
+		cache.quantum = quantum
+	}
+}
+
+// notification is a response built by the fair scheduler.
+type notification struct {
+	value     chan Response
+	version   string
+	pending   []string
+	names     []string
+	resources []types.Resource
+	versions  []uint64
+}
+
+// schedule queues the responses to the notified watches, and starts the
+// scheduler goroutine unless it runs. The cache mutex must be held.
+func (cache *LinearCache) schedule(notifyList map[chan Response][]string) {
+	version := cache.currentVersion()
+	for value, stale := range notifyList {
+		cache.notifications = append(cache.notifications, &notification{value: value, version: version, pending: stale})
+	}
+	if len(cache.watchAll) > 0 {
+		var all []string
+		if err := cache.store.Range(func(name string, _ types.Resource) {
+			all = append(all, name)
+		}); err != nil {
+			for value := range cache.watchAll {
+				close(value)
+			}
+		} else {
+			sort.Strings(all)
+			for value := range cache.watchAll {
+				cache.notifications = append(cache.notifications, &notification{value: value, version: version, pending: all})
+			}
+		}
+		cache.watchAll = make(watches)
+	}
+	if !cache.draining && len(cache.notifications) > 0 {
+		cache.draining = true
+		go cache.drain()
+	}
+}
+
+func (cache *LinearCache) drain() {
+	for {
+		cache.mu.Lock()
+		more := cache.turn()
+		cache.mu.Unlock()
+		if !more {
+			return
+		}
+	}
+}
+
+// turn reads a quantum of the resources of the next notification, sends the
+// response once complete or queues the notification back, and returns
+// whether more notifications are queued. The cache mutex must be held.
+func (cache *LinearCache) turn() bool {
+	if len(cache.notifications) == 0 {
+		return cache.more()
+	}
+	next := cache.notifications[0]
+	cache.notifications = cache.notifications[1:]
+
+	n := cache.quantum
+	if n > len(next.pending) {
+		n = len(next.pending)
+	}
+	for _, name := range next.pending[:n] {
+		resource, err := cache.store.Get(name)
+		if err != nil {
+			close(next.value)
+			return cache.more()
+		}
+		if resource != nil {
+			next.names = append(next.names, name)
+			next.resources = append(next.resources, resource)
+			next.versions = append(next.versions, cache.versionVector[name])
+		}
+	}
+	next.pending = next.pending[n:]
+
+	if len(next.pending) > 0 {
+		cache.notifications = append(cache.notifications, next)
+	} else {
+		cache.send(next.value, next.names, next.resources, next.versions, next.version)
+	}
+	return cache.more()
+}
+
+func (cache *LinearCache) more() bool {
+	if len(cache.notifications) == 0 {
+		cache.draining = false
+		return false
+	}
+	return true
+}
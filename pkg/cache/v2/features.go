@@ -0,0 +1,70 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package cache
+
+import (
+	"time"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	"github.com/envoyproxy/go-control-plane/pkg/wellknown"
+)
+
+// ClientFeatures is the set of the features advertised by a client in the
+// node client_features, see the wellknown client feature names.
+type ClientFeatures map[string]bool
+
+// NewClientFeatures parses the features advertised by a node.
+func NewClientFeatures(node *core.Node) ClientFeatures {
+	names := node.GetClientFeatures()
+	if len(names) == 0 {
+		return nil
+	}
+	features := make(ClientFeatures, len(names))
+	for _, name := range names {
+		features[name] = true
+	}
+	return features
+}
+
+// Has returns true if the client advertises the feature.
+func (features ClientFeatures) Has(name string) bool {
+	return features[name]
+}
+
+// ResourceTTL returns true if the client accepts the resources wrapped in
+// the discovery resource envelope with a TTL, and their heartbeats.
+func (features ClientFeatures) ResourceTTL() bool {
+	return features[wellknown.ClientFeatureResourceTTL] && features[wellknown.ClientFeatureResourceInSotW]
+}
+
+// WithClientFeatureChecks only uses the response features advertised by the
+// nodes in their client features. The resource TTLs and the heartbeats are
+// only sent to the clients advertising them: the other clients receive the
+// resources without the envelope, since older clients reject or misread the
+// wrapped resources.
+func WithClientFeatureChecks() SnapshotCacheOption {
+	return func(cache *snapshotCache) {
+		cache.featureChecks = true
+	}
+}
+
+// resourceTTLs returns the TTLs of the request type, or nil if the client
+// does not advertise the resource TTLs with the feature checks.
+func (cache *snapshotCache) resourceTTLs(request *Request, snapshot *Snapshot) map[string]time.Duration {
+	if cache.featureChecks && !NewClientFeatures(request.GetNode()).ResourceTTL() {
+		return nil
+	}
+	return snapshot.GetTTLs(request.TypeUrl)
+}
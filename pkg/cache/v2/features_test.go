@@ -0,0 +1,102 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package cache_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	discovery "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/v2"
+	rsrc "github.com/envoyproxy/go-control-plane/pkg/resource/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/wellknown"
+)
+
+var ttlFeatures = []string{wellknown.ClientFeatureResourceTTL, wellknown.ClientFeatureResourceInSotW}
+
+func TestNewClientFeatures(t *testing.T) {
+	if features := cache.NewClientFeatures(nil); features.Has(wellknown.ClientFeatureResourceTTL) || features.ResourceTTL() {
+		t.Errorf("NewClientFeatures(nil) => got %v, want none", features)
+	}
+	features := cache.NewClientFeatures(&core.Node{ClientFeatures: []string{wellknown.ClientFeatureResourceTTL}})
+	if !features.Has(wellknown.ClientFeatureResourceTTL) {
+		t.Errorf("Has(%q) => got false, want true", wellknown.ClientFeatureResourceTTL)
+	}
+	if features.ResourceTTL() {
+		t.Error("ResourceTTL() without the resources in SotW => got true, want false")
+	}
+	if !cache.NewClientFeatures(&core.Node{ClientFeatures: ttlFeatures}).ResourceTTL() {
+		t.Error("ResourceTTL() => got false, want true")
+	}
+}
+
+func TestClientFeatureChecks(t *testing.T) {
+	ttl := time.Minute
+	withTTL := cache.NewSnapshotWithTTLs(version,
+		[]types.ResourceWithTTL{{Resource: testEndpoint, TTL: &ttl}},
+		nil, nil, nil, nil, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c := cache.NewSnapshotCache(false, group{}, logger{t: t},
+		cache.WithClientFeatureChecks(), cache.WithHeartbeats(ctx, 10*time.Millisecond))
+	legacy := &core.Node{Id: key}
+	current := &core.Node{Id: key, ClientFeatures: ttlFeatures}
+	if err := c.SetSnapshot(key, withTTL); err != nil {
+		t.Fatal(err)
+	}
+	typeURL := func(node *core.Node) string {
+		value, _ := c.CreateWatch(&discovery.DiscoveryRequest{Node: node, TypeUrl: rsrc.EndpointType, ResourceNames: names[rsrc.EndpointType]})
+		resp, err := (<-value).GetDiscoveryResponse()
+		if err != nil || len(resp.Resources) != 1 {
+			t.Fatalf("GetDiscoveryResponse() => got %v, %v", resp, err)
+		}
+		return resp.Resources[0].TypeUrl
+	}
+
+	// the clients without the features receive the plain resources
+	if got := typeURL(legacy); got != rsrc.EndpointType {
+		t.Errorf("legacy client resource => got %q, want %q", got, rsrc.EndpointType)
+	}
+
+	// the v2 resource envelope has no TTL field
+	ttlField := (&discovery.Resource{}).ProtoReflect().Descriptor().Fields().ByName("ttl")
+	if ttlField == nil {
+		t.Skip("resource TTLs are not supported")
+	}
+	if got := typeURL(current); got == rsrc.EndpointType {
+		t.Errorf("client resource => got %q, want the resource envelope", got)
+	}
+
+	// the heartbeats are only sent to the clients advertising the TTLs
+	value, _ := c.CreateWatch(&discovery.DiscoveryRequest{Node: legacy, TypeUrl: rsrc.EndpointType, ResourceNames: names[rsrc.EndpointType], VersionInfo: version})
+	select {
+	case out := <-value:
+		t.Errorf("legacy client heartbeat => got %v, want none", out)
+	case <-time.After(50 * time.Millisecond):
+	}
+	value, _ = c.CreateWatch(&discovery.DiscoveryRequest{Node: current, TypeUrl: rsrc.EndpointType, ResourceNames: names[rsrc.EndpointType], VersionInfo: version})
+	select {
+	case out := <-value:
+		if !out.(*cache.RawResponse).Heartbeat {
+			t.Errorf("heartbeat => got %v, want a heartbeat", out)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("failed to receive heartbeat")
+	}
+}
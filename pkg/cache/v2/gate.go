@@ -0,0 +1,74 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package cache
+
+import (
+	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
+)
+
+// VersionGate annotates a resource with the minimum client build version that
+// supports it. Older clients receive a downgraded resource or none at all,
+// which prevents rejections of the whole response in mixed version fleets.
+//
+// Dropping a resource may break the references across types, e.g. an EDS
+// resource for a dropped cluster is never requested in ADS mode, so the
+// dependent resources should be gated as well.
+type VersionGate struct {
+	// Minimum semantic version of the client build.
+	Major, Minor, Patch uint32
+
+	// Downgrade optionally converts the resource for older clients. It must
+	// return a copy since the snapshot resources are shared. The resource is
+	// dropped for older clients if the function is nil or returns nil.
+	Downgrade func(types.Resource) types.Resource
+}
+
+// Allows checks whether the node build version is at least the gate version.
+// Nodes that do not report a build version are considered older.
+func (gate VersionGate) Allows(node *core.Node) bool {
+	version := node.GetUserAgentBuildVersion().GetVersion()
+	if version == nil {
+		return false
+	}
+	if version.GetMajorNumber() != gate.Major {
+		return version.GetMajorNumber() > gate.Major
+	}
+	if version.GetMinorNumber() != gate.Minor {
+		return version.GetMinorNumber() > gate.Minor
+	}
+	return version.GetPatch() >= gate.Patch
+}
+
+// applyGates selects the resources that can be served to the node.
+func applyGates(node *core.Node, resources map[string]types.Resource, gates map[string]VersionGate) map[string]types.Resource {
+	if len(gates) == 0 {
+		return resources
+	}
+	out := make(map[string]types.Resource, len(resources))
+	for name, resource := range resources {
+		gate, exists := gates[name]
+		if !exists || gate.Allows(node) {
+			out[name] = resource
+			continue
+		}
+		if gate.Downgrade != nil {
+			if downgraded := gate.Downgrade(resource); downgraded != nil {
+				out[name] = downgraded
+			}
+		}
+	}
+	return out
+}
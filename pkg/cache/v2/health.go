@@ -0,0 +1,411 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package cache
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+
+	endpoint "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
+	"github.com/envoyproxy/go-control-plane/pkg/log"
+)
+
+// HealthSource is an origin of the endpoint health statuses.
+type HealthSource int
+
+const (
+	// HealthProducer is the status declared in the snapshot endpoints.
+	HealthProducer HealthSource = iota
+	// HealthHDS is the status reported by the proxies over HDS.
+	HealthHDS
+	// HealthExternal is the status reported by an external health checker.
+	HealthExternal
+)
+
+func (source HealthSource) String() string {
+	switch source {
+	case HealthProducer:
+		return "producer"
+	case HealthHDS:
+		return "hds"
+	case HealthExternal:
+		return "external"
+	}
+	return "unknown"
+}
+
+// EndpointKey identifies an endpoint of a cluster.
+type EndpointKey struct {
+	Cluster string
+	Address string
+	Port    uint32
+}
+
+func (key EndpointKey) String() string {
+	return fmt.Sprintf("%s/%s:%d", key.Cluster, key.Address, key.Port)
+}
+
+// HealthChecker is an external health checker polled by the health merger.
+type HealthChecker interface {
+	// Check returns the statuses of the endpoints. The endpoints missing from
+	// the result are not changed.
+	Check(ctx context.Context, endpoints []EndpointKey) (map[EndpointKey]core.HealthStatus, error)
+}
+
+// HealthMerger combines the endpoint health statuses declared by the producer,
+// reported over HDS, and reported by an external checker, and sets the merged
+// snapshots in the cache.
+//
+// The final status of an endpoint is the status of the first source in the
+// precedence order with an observation, except that the endpoints declared as
+// draining by the producer always drain. The reported statuses only change
+// after a number of consecutive observations, so that a flapping endpoint does
+// not flap in the proxies.
+//
+// The producer sets the snapshots in the merger instead of the cache:
+//
+//	merger := NewHealthMerger(snapshotCache, WithHealthChecker(checker))
+//	go merger.Run(ctx, 5*time.Second)
+//	merger.SetSnapshot(node, snapshot)
+//
+// The snapshots updated on health changes are marked as health-only, see
+// WithHealthCoalescing.
+type HealthMerger struct {
+	cache              SnapshotCache
+	precedence         []HealthSource
+	healthyThreshold   int
+	unhealthyThreshold int
+	checker            HealthChecker
+	log                log.Logger
+
+	snapshots    map[string]Snapshot
+	observations map[HealthSource]map[EndpointKey]*healthObservation
+	generation   int
+	mu           sync.Mutex
+}
+
+// healthObservation tracks the consecutive observations of a status distinct
+// from the current status. The status is only set once the first status is
+// observed for the threshold.
+type healthObservation struct {
+	status    core.HealthStatus
+	set       bool
+	candidate core.HealthStatus
+	count     int
+}
+
+// HealthMergerOption configures the health merger.
+type HealthMergerOption func(*HealthMerger)
+
+// WithHealthPrecedence sets the order of the health sources, the first one
+// taking precedence. The default order is HDS, external, then producer.
+func WithHealthPrecedence(sources ...HealthSource) HealthMergerOption {
+	return func(m *HealthMerger) {
+		m.precedence = sources
+	}
+}
+
+// WithHealthThresholds sets the number of consecutive observations to mark an
+// endpoint healthy and to mark it unhealthy. The defaults are 2 and 2.
+func WithHealthThresholds(healthy, unhealthy int) HealthMergerOption {
+	return func(m *HealthMerger) {
+		m.healthyThreshold = healthy
+		m.unhealthyThreshold = unhealthy
+	}
+}
+
+// WithHealthChecker sets the external health checker.
+func WithHealthChecker(checker HealthChecker) HealthMergerOption {
+	return func(m *HealthMerger) {
+		m.checker = checker
+	}
+}
+
+// WithHealthLogger sets the logger of the health merger.
+func WithHealthLogger(logger log.Logger) HealthMergerOption {
+	return func(m *HealthMerger) {
+		m.log = logger
+	}
+}
+
+// NewHealthMerger creates a health merger feeding a snapshot cache.
+func NewHealthMerger(cache SnapshotCache, opts ...HealthMergerOption) *HealthMerger {
+	m := &HealthMerger{
+		cache:              cache,
+		precedence:         []HealthSource{HealthHDS, HealthExternal, HealthProducer},
+		healthyThreshold:   2,
+		unhealthyThreshold: 2,
+		snapshots:          make(map[string]Snapshot),
+		observations:       make(map[HealthSource]map[EndpointKey]*healthObservation),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// SetSnapshot sets the snapshot of a node with the declared health statuses,
+// and sets the merged snapshot in the cache.
+func (m *HealthMerger) SetSnapshot(node string, snapshot Snapshot) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.snapshots[node] = snapshot
+	return m.cache.SetSnapshot(node, m.merge(snapshot))
+}
+
+// ClearSnapshot forgets the snapshot of a node and clears it in the cache.
+// The observations of the endpoints no longer in any snapshot are dropped.
+func (m *HealthMerger) ClearSnapshot(node string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.snapshots, node)
+	m.cache.ClearSnapshot(node)
+	m.prune()
+}
+
+// prune drops the observations of the endpoints missing from the snapshots.
+func (m *HealthMerger) prune() {
+	declared := make(map[EndpointKey]bool)
+	for _, snapshot := range m.snapshots {
+		for _, res := range snapshot.Resources[types.Endpoint].Items {
+			forEachEndpoint(res, func(key EndpointKey, _ *core.HealthStatus) {
+				declared[key] = true
+			})
+		}
+	}
+	for _, observations := range m.observations {
+		for key := range observations {
+			if !declared[key] {
+				delete(observations, key)
+			}
+		}
+	}
+}
+
+// Report records an observation of the endpoint health by a source. The
+// snapshots including the endpoint are updated if its status changes.
+func (m *HealthMerger) Report(source HealthSource, key EndpointKey, status core.HealthStatus) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.observe(source, key, status) {
+		m.publish(map[string]bool{key.Cluster: true})
+	}
+}
+
+// Health returns the merged status of an endpoint with a declared status.
+func (m *HealthMerger) Health(key EndpointKey, declared core.HealthStatus) core.HealthStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.health(key, declared)
+}
+
+// Run polls the external health checker at every interval until the context
+// is done.
+func (m *HealthMerger) Run(ctx context.Context, interval time.Duration) {
+	if m.checker == nil {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.poll(ctx)
+		}
+	}
+}
+
+// poll checks the endpoints of all snapshots with the external checker.
+func (m *HealthMerger) poll(ctx context.Context) {
+	m.mu.Lock()
+	seen := make(map[EndpointKey]bool)
+	var keys []EndpointKey
+	for _, snapshot := range m.snapshots {
+		for _, res := range snapshot.Resources[types.Endpoint].Items {
+			forEachEndpoint(res, func(key EndpointKey, _ *core.HealthStatus) {
+				if !seen[key] {
+					seen[key] = true
+					keys = append(keys, key)
+				}
+			})
+		}
+	}
+	m.mu.Unlock()
+
+	statuses, err := m.checker.Check(ctx, keys)
+	if err != nil {
+		if m.log != nil {
+			m.log.Warnf("external health check failed: %v", err)
+		}
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	changed := make(map[string]bool)
+	for key, status := range statuses {
+		if m.observe(HealthExternal, key, status) {
+			changed[key.Cluster] = true
+		}
+	}
+	if len(changed) > 0 {
+		m.publish(changed)
+	}
+}
+
+// observe applies the hysteresis to an observation, and returns whether the
+// status of the source changed.
+func (m *HealthMerger) observe(source HealthSource, key EndpointKey, status core.HealthStatus) bool {
+	if m.observations[source] == nil {
+		m.observations[source] = make(map[EndpointKey]*healthObservation)
+	}
+	current, exists := m.observations[source][key]
+	if !exists {
+		current = &healthObservation{candidate: status}
+		m.observations[source][key] = current
+	}
+	if current.set && status == current.status {
+		current.count = 0
+		return false
+	}
+	if status != current.candidate {
+		current.candidate = status
+		current.count = 0
+	}
+	current.count++
+	threshold := m.unhealthyThreshold
+	if status == core.HealthStatus_HEALTHY {
+		threshold = m.healthyThreshold
+	}
+	if current.count < threshold {
+		return false
+	}
+	if m.log != nil {
+		m.log.Infof("endpoint %v is %v from %v after %d observations", key, status, source, current.count)
+	}
+	current.status = status
+	current.set = true
+	current.count = 0
+	return true
+}
+
+func (m *HealthMerger) health(key EndpointKey, declared core.HealthStatus) core.HealthStatus {
+	if declared == core.HealthStatus_DRAINING {
+		return declared
+	}
+	for _, source := range m.precedence {
+		if source == HealthProducer {
+			if declared != core.HealthStatus_UNKNOWN {
+				return declared
+			}
+			continue
+		}
+		if observation, exists := m.observations[source][key]; exists && observation.set {
+			return observation.status
+		}
+	}
+	return declared
+}
+
+// publish sets the merged snapshots including the changed clusters.
+func (m *HealthMerger) publish(clusters map[string]bool) {
+	m.generation++
+	for node, snapshot := range m.snapshots {
+		affected := false
+		for name := range snapshot.Resources[types.Endpoint].Items {
+			if clusters[name] {
+				affected = true
+				break
+			}
+		}
+		if !affected {
+			continue
+		}
+		merged := m.merge(snapshot)
+		merged.HealthOnly = true
+		if err := m.cache.SetSnapshot(node, merged); err != nil && m.log != nil {
+			m.log.Errorf("failed to set the merged snapshot for node %s: %v", node, err)
+		}
+	}
+}
+
+// merge overrides the endpoint statuses of the snapshot, and extends the
+// endpoint version if any status is overridden.
+func (m *HealthMerger) merge(snapshot Snapshot) Snapshot {
+	base := snapshot.Resources[types.Endpoint]
+	items := make(map[string]types.Resource, len(base.Items))
+	overridden := false
+	for name, res := range base.Items {
+		cla, ok := res.(*endpoint.ClusterLoadAssignment)
+		if !ok {
+			items[name] = res
+			continue
+		}
+		changed := false
+		forEachEndpoint(cla, func(key EndpointKey, status *core.HealthStatus) {
+			changed = changed || m.health(key, *status) != *status
+		})
+		if !changed {
+			items[name] = res
+			continue
+		}
+		merged := proto.Clone(cla).(*endpoint.ClusterLoadAssignment)
+		forEachEndpoint(merged, func(key EndpointKey, status *core.HealthStatus) {
+			*status = m.health(key, *status)
+		})
+		items[name] = merged
+		overridden = true
+	}
+	if !overridden {
+		return snapshot
+	}
+
+	out := snapshot
+	out.Resources[types.Endpoint] = Resources{
+		Version:  fmt.Sprintf("%s+health.%d", base.Version, m.generation),
+		Items:    items,
+		Gates:    base.Gates,
+		TTLs:     base.TTLs,
+		Variants: base.Variants,
+	}
+	return out
+}
+
+// forEachEndpoint calls the function with the socket address and the status
+// of each endpoint of a cluster load assignment.
+func forEachEndpoint(res types.Resource, fn func(EndpointKey, *core.HealthStatus)) {
+	cla, ok := res.(*endpoint.ClusterLoadAssignment)
+	if !ok {
+		return
+	}
+	for _, locality := range cla.GetEndpoints() {
+		for _, lb := range locality.GetLbEndpoints() {
+			address := lb.GetEndpoint().GetAddress().GetSocketAddress()
+			if address == nil {
+				continue
+			}
+			key := EndpointKey{Cluster: cla.ClusterName, Address: address.Address, Port: address.GetPortValue()}
+			fn(key, &lb.HealthStatus)
+		}
+	}
+}
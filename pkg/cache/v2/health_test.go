@@ -0,0 +1,136 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package cache_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	endpoint "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/v2"
+	rsrc "github.com/envoyproxy/go-control-plane/pkg/resource/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/test/resource/v2"
+)
+
+type checker map[cache.EndpointKey]core.HealthStatus
+
+func (c checker) Check(context.Context, []cache.EndpointKey) (map[cache.EndpointKey]core.HealthStatus, error) {
+	return c, nil
+}
+
+func TestHealthMerger(t *testing.T) {
+	c := cache.NewSnapshotCache(false, group{}, logger{t: t})
+	external := checker{}
+	m := cache.NewHealthMerger(c, cache.WithHealthChecker(external), cache.WithHealthThresholds(2, 1))
+
+	declared := resource.MakeEndpoint(clusterName, 8080)
+	snap := cache.NewSnapshot("v1", []types.Resource{declared}, nil, nil, nil, nil, nil)
+	if err := m.SetSnapshot(key, snap); err != nil {
+		t.Fatal(err)
+	}
+	ep := cache.EndpointKey{Cluster: clusterName, Address: "127.0.0.1", Port: 8080}
+	status := func() (string, core.HealthStatus) {
+		got, err := c.GetSnapshot(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cla := got.GetResources(rsrc.EndpointType)[clusterName].(*endpoint.ClusterLoadAssignment)
+		return got.GetVersion(rsrc.EndpointType), cla.Endpoints[0].LbEndpoints[0].HealthStatus
+	}
+	if version, got := status(); version != "v1" || got != core.HealthStatus_UNKNOWN {
+		t.Errorf("without observations => got %q %v, want the declared snapshot", version, got)
+	}
+
+	// the first external observation sets the status
+	external[ep] = core.HealthStatus_UNHEALTHY
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	m.Run(ctx, 10*time.Millisecond)
+	if version, got := status(); version == "v1" || got != core.HealthStatus_UNHEALTHY {
+		t.Errorf("external unhealthy => got %q %v", version, got)
+	}
+	if got, _ := c.GetSnapshot(key); !got.HealthOnly {
+		t.Error("health update => got a topology snapshot, want health-only")
+	}
+	if declared.Endpoints[0].LbEndpoints[0].HealthStatus != core.HealthStatus_UNKNOWN {
+		t.Error("the declared snapshot is modified")
+	}
+
+	// HDS takes precedence, once the healthy threshold is reached
+	m.Report(cache.HealthHDS, ep, core.HealthStatus_HEALTHY)
+	if _, got := status(); got != core.HealthStatus_UNHEALTHY {
+		t.Errorf("first HDS healthy => got %v, want UNHEALTHY with hysteresis", got)
+	}
+	m.Report(cache.HealthHDS, ep, core.HealthStatus_HEALTHY)
+	if _, got := status(); got != core.HealthStatus_HEALTHY {
+		t.Errorf("HDS healthy => got %v, want HEALTHY", got)
+	}
+	m.Report(cache.HealthHDS, ep, core.HealthStatus_UNHEALTHY)
+	if _, got := status(); got != core.HealthStatus_UNHEALTHY {
+		t.Errorf("HDS unhealthy => got %v, want UNHEALTHY", got)
+	}
+	m.Report(cache.HealthHDS, ep, core.HealthStatus_HEALTHY)
+	if _, got := status(); got != core.HealthStatus_UNHEALTHY {
+		t.Errorf("single HDS healthy => got %v, want UNHEALTHY with hysteresis", got)
+	}
+	m.Report(cache.HealthHDS, ep, core.HealthStatus_HEALTHY)
+	if _, got := status(); got != core.HealthStatus_HEALTHY {
+		t.Errorf("second HDS healthy => got %v, want HEALTHY", got)
+	}
+
+	// the declared draining endpoints always drain
+	draining := resource.MakeEndpoint(clusterName, 8080)
+	draining.Endpoints[0].LbEndpoints[0].HealthStatus = core.HealthStatus_DRAINING
+	if err := m.SetSnapshot(key, cache.NewSnapshot("v2", []types.Resource{draining}, nil, nil, nil, nil, nil)); err != nil {
+		t.Fatal(err)
+	}
+	if version, got := status(); version != "v2" || got != core.HealthStatus_DRAINING {
+		t.Errorf("declared draining => got %q %v, want DRAINING", version, got)
+	}
+
+	// the producer may take precedence
+	m = cache.NewHealthMerger(c, cache.WithHealthPrecedence(cache.HealthProducer, cache.HealthHDS))
+	m.Report(cache.HealthHDS, ep, core.HealthStatus_UNHEALTHY)
+	m.Report(cache.HealthHDS, ep, core.HealthStatus_UNHEALTHY)
+	if got := m.Health(ep, core.HealthStatus_DEGRADED); got != core.HealthStatus_DEGRADED {
+		t.Errorf("Health(degraded) => got %v, want DEGRADED", got)
+	}
+	if got := m.Health(ep, core.HealthStatus_UNKNOWN); got != core.HealthStatus_UNHEALTHY {
+		t.Errorf("Health(unknown) => got %v, want UNHEALTHY", got)
+	}
+}
+
+func TestHealthMergerPrune(t *testing.T) {
+	c := cache.NewSnapshotCache(false, group{}, logger{t: t})
+	m := cache.NewHealthMerger(c, cache.WithHealthThresholds(1, 1))
+	snap := cache.NewSnapshot("v1", []types.Resource{resource.MakeEndpoint(clusterName, 8080)}, nil, nil, nil, nil, nil)
+	if err := m.SetSnapshot(key, snap); err != nil {
+		t.Fatal(err)
+	}
+	ep := cache.EndpointKey{Cluster: clusterName, Address: "127.0.0.1", Port: 8080}
+	m.Report(cache.HealthHDS, ep, core.HealthStatus_UNHEALTHY)
+	if got := m.Health(ep, core.HealthStatus_UNKNOWN); got != core.HealthStatus_UNHEALTHY {
+		t.Errorf("Health() => got %v, want UNHEALTHY", got)
+	}
+
+	// the observations of the cleared endpoints are dropped
+	m.ClearSnapshot(key)
+	if got := m.Health(ep, core.HealthStatus_UNKNOWN); got != core.HealthStatus_UNKNOWN {
+		t.Errorf("Health() after ClearSnapshot => got %v, want UNKNOWN", got)
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package cache
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"sync"
+
+	"github.com/golang/protobuf/ptypes/any"
+)
+
+// ResponseCache is a bounded LRU of marshaled response resources shared across
+// the nodes. When many clients are at the same state, the responses are
+// marshaled once. The entries are keyed by the type URL, the snapshot version
+// and the requested resource names, so it must only be used if the snapshot
+// versions identify the resource contents across the nodes, e.g. when the
+// versions are content hashes or the nodes share the snapshots.
+type ResponseCache struct {
+	maxEntries int
+	maxBytes   int
+
+	entries map[string]*list.Element
+	order   *list.List
+	bytes   int
+	stats   ResponseCacheStats
+	mu      sync.Mutex
+}
+
+// ResponseCacheStats are the counters of a response cache.
+type ResponseCacheStats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+
+	// Entries and Bytes are the current size of the cache.
+	Entries int
+	Bytes   int
+}
+
+type responseEntry struct {
+	key       string
+	resources []*any.Any
+	size      int
+}
+
+// NewResponseCache creates a response cache bounded by the number of entries
+// and the total size of the marshaled resources. Zero disables a bound.
+func NewResponseCache(maxEntries, maxBytes int) *ResponseCache {
+	return &ResponseCache{
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		entries:    make(map[string]*list.Element),
+		order:      list.New(),
+	}
+}
+
+// Stats returns the cache counters.
+func (c *ResponseCache) Stats() ResponseCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := c.stats
+	out.Entries = c.order.Len()
+	out.Bytes = c.bytes
+	return out
+}
+
+// Purge evicts all entries.
+func (c *ResponseCache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stats.Evictions += uint64(c.order.Len())
+	c.entries = make(map[string]*list.Element)
+	c.order.Init()
+	c.bytes = 0
+}
+
+func (c *ResponseCache) get(key string) ([]*any.Any, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, exists := c.entries[key]
+	if !exists {
+		c.stats.Misses++
+		return nil, false
+	}
+	c.stats.Hits++
+	c.order.MoveToFront(elem)
+	return elem.Value.(*responseEntry).resources, true
+}
+
+func (c *ResponseCache) add(key string, resources []*any.Any) {
+	size := 0
+	for _, res := range resources {
+		size += len(res.Value)
+	}
+	if c.maxBytes > 0 && size > c.maxBytes {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, exists := c.entries[key]; exists {
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&responseEntry{key: key, resources: resources, size: size})
+	c.bytes += size
+
+	for (c.maxEntries > 0 && c.order.Len() > c.maxEntries) || (c.maxBytes > 0 && c.bytes > c.maxBytes) {
+		oldest := c.order.Back().Value.(*responseEntry)
+		c.order.Remove(c.order.Back())
+		delete(c.entries, oldest.key)
+		c.bytes -= oldest.size
+		c.stats.Evictions++
+	}
+}
+
+// responseKey identifies the response resources for a request.
+func responseKey(request *Request, version string) string {
+	names := append([]string(nil), request.ResourceNames...)
+	sort.Strings(names)
+	h := sha256.New()
+	for _, name := range names {
+		h.Write([]byte(name))
+		h.Write([]byte{0})
+	}
+	return request.TypeUrl + "/" + version + "/" + hex.EncodeToString(h.Sum(nil))
+}
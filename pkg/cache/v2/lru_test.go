@@ -0,0 +1,73 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package cache_test
+
+import (
+	"context"
+	"testing"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/v2"
+	rsrc "github.com/envoyproxy/go-control-plane/pkg/resource/v2"
+)
+
+func TestResponseCache(t *testing.T) {
+	responses := cache.NewResponseCache(1, 0)
+	c := cache.NewSnapshotCache(false, cache.IDHash{}, nil, cache.WithResponseCache(responses))
+	for _, node := range []string{"a", "b"} {
+		if err := c.SetSnapshot(node, snapshot); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var first *cache.Request
+	for i, node := range []string{"a", "b"} {
+		req := &cache.Request{Node: &core.Node{Id: node}, TypeUrl: rsrc.ClusterType}
+		w, _ := c.CreateWatch(req)
+		out, err := (<-w).GetDiscoveryResponse()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(out.Resources) != 1 || out.VersionInfo != version {
+			t.Errorf("response for node %q => got %v", node, out)
+		}
+		if i == 0 {
+			first = req
+			continue
+		}
+		resp, err := c.Fetch(context.Background(), &cache.Request{Node: first.Node, TypeUrl: rsrc.ClusterType})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if shared, _ := resp.GetDiscoveryResponse(); shared.Resources[0] != out.Resources[0] {
+			t.Error("expected marshaled resources to be shared")
+		}
+	}
+
+	// a different type evicts the single entry
+	w, _ := c.CreateWatch(&cache.Request{Node: &core.Node{Id: "a"}, TypeUrl: rsrc.EndpointType})
+	<-w
+
+	stats := responses.Stats()
+	want := cache.ResponseCacheStats{Hits: 2, Misses: 2, Evictions: 1, Entries: 1, Bytes: stats.Bytes}
+	if stats != want || stats.Bytes == 0 {
+		t.Errorf("Stats() => got %+v, want %+v", stats, want)
+	}
+
+	responses.Purge()
+	if stats := responses.Stats(); stats.Entries != 0 || stats.Bytes != 0 {
+		t.Errorf("Stats() after purge => got %+v", stats)
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package cache
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/golang/protobuf/ptypes/any"
+
+	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
+)
+
+// MarshalCache shares the marshaled resources across the responses, so that
+// a resource is marshaled once per version instead of once per stream. The
+// entries are keyed by the type URL and the name of the resources, and hold
+// the last marshaled version: a new version replaces the entry.
+//
+// The cache must only be shared by the responses in which a version
+// identifies the contents of a resource, e.g. the responses of a single
+// linear cache. A snapshot cache shares the entries across the nodes only if
+// the versions are content hashes, see HashVersions, and otherwise keeps the
+// entries of each node apart, since the nodes may reuse the same versions for
+// different contents.
+type MarshalCache struct {
+	// hits and misses are atomic counters, first in the struct to be 64-bit
+	// aligned on 32-bit machines
+	hits   uint64
+	misses uint64
+
+	mu      sync.RWMutex
+	entries map[marshalKey]marshalEntry
+}
+
+// MarshalCacheStats are the counters of a marshal cache.
+type MarshalCacheStats struct {
+	Hits   uint64
+	Misses uint64
+
+	// Entries is the current number of resources in the cache.
+	Entries int
+}
+
+type marshalKey struct {
+	// scope is the node of the entries that are not shared across the nodes
+	scope   string
+	typeURL string
+	name    string
+}
+
+type marshalEntry struct {
+	version string
+	value   *any.Any
+}
+
+// NewMarshalCache creates an empty marshal cache.
+func NewMarshalCache() *MarshalCache {
+	return &MarshalCache{entries: make(map[marshalKey]marshalEntry)}
+}
+
+// Stats returns the cache counters.
+func (c *MarshalCache) Stats() MarshalCacheStats {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return MarshalCacheStats{
+		Hits:    atomic.LoadUint64(&c.hits),
+		Misses:  atomic.LoadUint64(&c.misses),
+		Entries: len(c.entries),
+	}
+}
+
+// Forget removes the entry of a resource, e.g. once the resource is deleted.
+func (c *MarshalCache) Forget(typeURL, name string) {
+	c.forget("", typeURL, name)
+}
+
+func (c *MarshalCache) forget(scope, typeURL, name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, marshalKey{scope: scope, typeURL: typeURL, name: name})
+}
+
+// marshal returns the shared marshaled resource at the version, marshaling
+// it on a miss. The returned value must not be modified.
+func (c *MarshalCache) marshal(scope, typeURL, name, version string, resource types.Resource) (*any.Any, error) {
+	key := marshalKey{scope: scope, typeURL: typeURL, name: name}
+	c.mu.RLock()
+	entry, exists := c.entries[key]
+	c.mu.RUnlock()
+	if exists && entry.version == version {
+		atomic.AddUint64(&c.hits, 1)
+		return entry.value, nil
+	}
+	atomic.AddUint64(&c.misses, 1)
+
+	marshaled, err := MarshalResource(resource)
+	if err != nil {
+		return nil, err
+	}
+	value := &any.Any{TypeUrl: typeURL, Value: marshaled}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = marshalEntry{version: version, value: value}
+	return value, nil
+}
+
+// marshalScope returns the scope of the marshaled resources of a node
+// snapshot: the versions provided by HashVersions identify the contents, and
+// the resources are shared across the nodes.
+func (cache *snapshotCache) marshalScope(node string, snapshot *Snapshot) string {
+	if snapshot.Signature == nil {
+		switch cache.versions.(type) {
+		case HashVersions, *HashVersions:
+			return ""
+		}
+	}
+	return node
+}
+
+// forgetMarshaled removes the marshaled resources of a node that are absent
+// from the updated snapshot. The shared resources are removed as well, and are
+// marshaled again for the other nodes still holding them. The cache lock must
+// be held.
+func (cache *snapshotCache) forgetMarshaled(node string, previous, snapshot *Snapshot) {
+	if cache.marshaled == nil {
+		return
+	}
+	scope := cache.marshalScope(node, previous)
+	for typ := range previous.Resources {
+		typeURL := GetResponseTypeURL(types.ResponseType(typ))
+		for name := range previous.Resources[typ].Items {
+			if _, exists := snapshot.Resources[typ].Items[name]; !exists {
+				cache.marshaled.forget(scope, typeURL, name)
+			}
+		}
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package cache_test
+
+import (
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+
+	cluster "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	discovery "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	envoy_type "github.com/envoyproxy/go-control-plane/envoy/type"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/v2"
+	rsrc "github.com/envoyproxy/go-control-plane/pkg/resource/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/test/resource/v2"
+)
+
+func TestSnapshotMarshalCache(t *testing.T) {
+	marshaled := cache.NewMarshalCache()
+	c := cache.NewSnapshotCache(false, cache.IDHash{}, nil, cache.WithMarshalCache(marshaled),
+		cache.WithVersionProvider(cache.HashVersions{}))
+	snap := cache.NewSnapshot(version, nil, resource.MakeClusters(resource.Ads, "cluster", 2), nil, nil, nil, nil)
+	for _, node := range []string{"a", "b"} {
+		if err := c.SetSnapshot(node, snap); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	get := func(node string, names ...string) *discovery.DiscoveryResponse {
+		t.Helper()
+		w, _ := c.CreateWatch(&discovery.DiscoveryRequest{Node: &core.Node{Id: node}, TypeUrl: rsrc.ClusterType, ResourceNames: names})
+		resp, err := (<-w).GetDiscoveryResponse()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	all := get("a")
+	named := get("b", "cluster-1")
+	if len(all.Resources) != 2 || len(named.Resources) != 1 {
+		t.Fatalf("responses => got %d and %d resources, want 2 and 1", len(all.Resources), len(named.Resources))
+	}
+	if named.Resources[0] != all.Resources[0] && named.Resources[0] != all.Resources[1] {
+		t.Error("named response => got a new marshaled resource, want the shared one")
+	}
+	if stats := marshaled.Stats(); stats.Hits != 1 || stats.Misses != 2 {
+		t.Errorf("Stats() => got %+v, want 1 hit and 2 misses", stats)
+	}
+}
+
+func TestSnapshotMarshalCacheNodes(t *testing.T) {
+	marshaled := cache.NewMarshalCache()
+	c := cache.NewSnapshotCache(false, cache.IDHash{}, nil, cache.WithMarshalCache(marshaled))
+
+	// the nodes use the same version for different contents
+	for _, node := range []string{"a", "b"} {
+		cluster := resource.MakeCluster(resource.Ads, clusterName)
+		cluster.AltStatName = node
+		if err := c.SetSnapshot(node, cache.NewSnapshot(version, nil, []types.Resource{cluster}, nil, nil, nil, nil)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, node := range []string{"a", "b"} {
+		w, _ := c.CreateWatch(&discovery.DiscoveryRequest{Node: &core.Node{Id: node}, TypeUrl: rsrc.ClusterType})
+		resp, err := (<-w).GetDiscoveryResponse()
+		if err != nil {
+			t.Fatal(err)
+		}
+		out := &cluster.Cluster{}
+		if err := ptypes.UnmarshalAny(resp.Resources[0], out); err != nil {
+			t.Fatal(err)
+		}
+		if out.AltStatName != node {
+			t.Errorf("cluster of node %q => got the cluster of node %q", node, out.AltStatName)
+		}
+	}
+	if stats := marshaled.Stats(); stats.Entries != 2 {
+		t.Errorf("Stats() => got %d entries, want 2", stats.Entries)
+	}
+
+	// the removed resources are forgotten
+	if err := c.UpsertResources("a", rsrc.ClusterType, nil, []string{clusterName}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SetSnapshot("b", cache.NewSnapshot(version2, nil, nil, nil, nil, nil, nil)); err != nil {
+		t.Fatal(err)
+	}
+	if stats := marshaled.Stats(); stats.Entries != 0 {
+		t.Errorf("Stats() after the removals => got %d entries, want 0", stats.Entries)
+	}
+}
+
+func TestSnapshotMarshalCacheGates(t *testing.T) {
+	c := cache.NewSnapshotCache(false, cache.IDHash{}, nil, cache.WithMarshalCache(cache.NewMarshalCache()))
+	snap := cache.NewSnapshot(version, nil, []types.Resource{testCluster}, nil, nil, nil, nil)
+	if err := snap.SetVersionGate(rsrc.ClusterType, clusterName, cache.VersionGate{
+		Major: 1,
+		Minor: 16,
+		Downgrade: func(res types.Resource) types.Resource {
+			out := proto.Clone(res).(*cluster.Cluster)
+			out.AltStatName = "downgraded"
+			return out
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	current := &core.Node{
+		Id: "current",
+		UserAgentVersionType: &core.Node_UserAgentBuildVersion{
+			UserAgentBuildVersion: &core.BuildVersion{Version: &envoy_type.SemanticVersion{MajorNumber: 1, MinorNumber: 17}},
+		},
+	}
+	legacy := &core.Node{Id: "legacy"}
+	get := func(node *core.Node) *cluster.Cluster {
+		t.Helper()
+		if err := c.SetSnapshot(node.Id, snap); err != nil {
+			t.Fatal(err)
+		}
+		w, _ := c.CreateWatch(&discovery.DiscoveryRequest{Node: node, TypeUrl: rsrc.ClusterType})
+		resp, err := (<-w).GetDiscoveryResponse()
+		if err != nil || len(resp.Resources) != 1 {
+			t.Fatalf("GetDiscoveryResponse() => got %v, %v", resp, err)
+		}
+		out := &cluster.Cluster{}
+		if err := ptypes.UnmarshalAny(resp.Resources[0], out); err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+
+	// the gated resources are not shared through the marshal cache
+	if got := get(current); got.AltStatName != "" {
+		t.Errorf("current node cluster => got alt stat name %q, want the ungated cluster", got.AltStatName)
+	}
+	if got := get(legacy); got.AltStatName != "downgraded" {
+		t.Errorf("legacy node cluster => got alt stat name %q, want the downgraded cluster", got.AltStatName)
+	}
+}
@@ -0,0 +1,180 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package cache
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+
+	route "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	routev2 "github.com/envoyproxy/go-control-plane/envoy/api/v2/route"
+	envoy_type "github.com/envoyproxy/go-control-plane/envoy/type"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
+)
+
+// MirrorPolicy mirrors a percentage of the requests of a route to a cluster.
+type MirrorPolicy struct {
+	Cluster string
+
+	// Percent of the requests mirrored, with a precision of 0.0001%.
+	Percent float64
+
+	// RuntimeKey optionally overrides the percentage at runtime.
+	RuntimeKey string
+}
+
+// MirrorAudit records a change of the mirror policies of a route.
+type MirrorAudit struct {
+	Time    time.Time
+	Route   string
+	Cluster string
+
+	// Percent and Previous are the mirrored percentages after and before the
+	// change, zero if the policy is added or removed.
+	Percent  float64
+	Previous float64
+}
+
+// Mirrors sets the route mirror policies with safety checks, since a mirror
+// mistakenly set to a full percentage or to the route destination doubles the
+// production traffic.
+type Mirrors struct {
+	// MaxPercent caps the mirrored percentage of each policy, 10% if zero.
+	MaxPercent float64
+
+	// Audit is optionally called with the changes of the mirror policies.
+	Audit func(MirrorAudit)
+}
+
+// Set replaces the mirror policies of the named route in the snapshot. The
+// policies are rejected if a mirror cluster is missing from the snapshot, is a
+// destination of the route, or if a percentage exceeds the cap.
+//
+// The route configuration is copied, and its version is not changed, so the
+// policies should be set on a new snapshot before it is set in the cache.
+func (m Mirrors) Set(snapshot *Snapshot, routeName string, policies ...MirrorPolicy) error {
+	maxPercent := m.MaxPercent
+	if maxPercent == 0 {
+		maxPercent = 10
+	}
+
+	configName, config, found := findRoute(snapshot.Resources[types.Route].Items, routeName)
+	if found == nil {
+		return fmt.Errorf("route %q not found", routeName)
+	}
+	action := found.GetRoute()
+	if action == nil {
+		return fmt.Errorf("route %q does not forward to clusters", routeName)
+	}
+	destinations := map[string]bool{action.GetCluster(): true}
+	for _, weighted := range action.GetWeightedClusters().GetClusters() {
+		destinations[weighted.GetName()] = true
+	}
+
+	mirrors := make([]*routev2.RouteAction_RequestMirrorPolicy, 0, len(policies))
+	for _, policy := range policies {
+		if _, exists := snapshot.Resources[types.Cluster].Items[policy.Cluster]; !exists {
+			return fmt.Errorf("mirror cluster %q of route %q not found", policy.Cluster, routeName)
+		}
+		if destinations[policy.Cluster] {
+			return fmt.Errorf("mirror cluster %q is a destination of route %q", policy.Cluster, routeName)
+		}
+		if policy.Percent <= 0 || policy.Percent > maxPercent {
+			return fmt.Errorf("mirror percentage %v of route %q is not within (0, %v]", policy.Percent, routeName, maxPercent)
+		}
+		mirrors = append(mirrors, &routev2.RouteAction_RequestMirrorPolicy{
+			Cluster: policy.Cluster,
+			RuntimeFraction: &core.RuntimeFractionalPercent{
+				DefaultValue: &envoy_type.FractionalPercent{
+					Numerator:   uint32(policy.Percent*10000 + 0.5),
+					Denominator: envoy_type.FractionalPercent_MILLION,
+				},
+				RuntimeKey: policy.RuntimeKey,
+			},
+		})
+	}
+
+	if m.Audit != nil {
+		m.audit(routeName, action.GetRequestMirrorPolicies(), mirrors)
+	}
+
+	config = proto.Clone(config).(*route.RouteConfiguration)
+	_, _, found = findRoute(map[string]types.Resource{configName: config}, routeName)
+	found.GetRoute().RequestMirrorPolicies = mirrors
+
+	routes := snapshot.Resources[types.Route]
+	routes.Items = copyItems(routes.Items)
+	routes.Items[configName] = config
+	snapshot.Resources[types.Route] = routes
+	return nil
+}
+
+// findRoute returns the first route with the name in the route configurations.
+func findRoute(items map[string]types.Resource, routeName string) (string, *route.RouteConfiguration, *routev2.Route) {
+	for name, res := range items {
+		config, ok := res.(*route.RouteConfiguration)
+		if !ok {
+			continue
+		}
+		for _, host := range config.GetVirtualHosts() {
+			for _, r := range host.GetRoutes() {
+				if r.GetName() == routeName {
+					return name, config, r
+				}
+			}
+		}
+	}
+	return "", nil, nil
+}
+
+func (m Mirrors) audit(routeName string, previous, next []*routev2.RouteAction_RequestMirrorPolicy) {
+	percent := func(policies []*routev2.RouteAction_RequestMirrorPolicy) map[string]float64 {
+		out := make(map[string]float64, len(policies))
+		for _, policy := range policies {
+			out[policy.Cluster] = 100
+			if fraction := policy.GetRuntimeFraction().GetDefaultValue(); fraction != nil {
+				out[policy.Cluster] = fractionalPercent(fraction)
+			}
+		}
+		return out
+	}
+	before, after := percent(previous), percent(next)
+	now := time.Now()
+	for _, policy := range next {
+		if before[policy.Cluster] != after[policy.Cluster] {
+			m.Audit(MirrorAudit{Time: now, Route: routeName, Cluster: policy.Cluster,
+				Percent: after[policy.Cluster], Previous: before[policy.Cluster]})
+		}
+	}
+	for _, policy := range previous {
+		if _, exists := after[policy.Cluster]; !exists {
+			m.Audit(MirrorAudit{Time: now, Route: routeName, Cluster: policy.Cluster,
+				Previous: before[policy.Cluster]})
+		}
+	}
+}
+
+func fractionalPercent(fraction *envoy_type.FractionalPercent) float64 {
+	switch fraction.GetDenominator() {
+	case envoy_type.FractionalPercent_TEN_THOUSAND:
+		return float64(fraction.GetNumerator()) / 100
+	case envoy_type.FractionalPercent_MILLION:
+		return float64(fraction.GetNumerator()) / 10000
+	}
+	return float64(fraction.GetNumerator())
+}
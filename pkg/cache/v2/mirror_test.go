@@ -0,0 +1,82 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package cache_test
+
+import (
+	"testing"
+
+	route "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/v2"
+	rsrc "github.com/envoyproxy/go-control-plane/pkg/resource/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/test/resource/v2"
+)
+
+func TestMirrors(t *testing.T) {
+	config := resource.MakeRoute(routeName, clusterName)
+	config.VirtualHosts[0].Routes[0].Name = "default"
+	snap := cache.NewSnapshot(version, nil,
+		[]types.Resource{testCluster, resource.MakeCluster(resource.Ads, "shadow")},
+		[]types.Resource{config}, nil, nil, nil)
+
+	var audits []cache.MirrorAudit
+	mirrors := cache.Mirrors{MaxPercent: 5, Audit: func(audit cache.MirrorAudit) { audits = append(audits, audit) }}
+
+	tests := []struct {
+		route  string
+		policy cache.MirrorPolicy
+	}{
+		{"missing", cache.MirrorPolicy{Cluster: "shadow", Percent: 1}},
+		{"default", cache.MirrorPolicy{Cluster: "missing", Percent: 1}},
+		{"default", cache.MirrorPolicy{Cluster: clusterName, Percent: 1}},
+		{"default", cache.MirrorPolicy{Cluster: "shadow", Percent: 50}},
+		{"default", cache.MirrorPolicy{Cluster: "shadow"}},
+	}
+	for _, test := range tests {
+		if err := mirrors.Set(&snap, test.route, test.policy); err == nil {
+			t.Errorf("Set(%s, %+v) => got no error", test.route, test.policy)
+		}
+	}
+	if len(audits) != 0 {
+		t.Errorf("audits of rejected policies => got %v", audits)
+	}
+
+	if err := mirrors.Set(&snap, "default", cache.MirrorPolicy{Cluster: "shadow", Percent: 2.5, RuntimeKey: "mirror.shadow"}); err != nil {
+		t.Fatal(err)
+	}
+	got := snap.GetResources(rsrc.RouteType)[routeName].(*route.RouteConfiguration)
+	policies := got.VirtualHosts[0].Routes[0].GetRoute().RequestMirrorPolicies
+	if len(policies) != 1 || policies[0].Cluster != "shadow" ||
+		policies[0].RuntimeFraction.DefaultValue.Numerator != 25000 || policies[0].RuntimeFraction.RuntimeKey != "mirror.shadow" {
+		t.Errorf("mirror policies => got %v", policies)
+	}
+	if len(config.VirtualHosts[0].Routes[0].GetRoute().RequestMirrorPolicies) != 0 {
+		t.Error("the shared route configuration is modified")
+	}
+	if len(audits) != 1 || audits[0].Cluster != "shadow" || audits[0].Percent != 2.5 || audits[0].Previous != 0 {
+		t.Errorf("audits => got %+v, want shadow added at 2.5%%", audits)
+	}
+
+	// the unchanged policies are not audited, and the removed ones are
+	if err := mirrors.Set(&snap, "default", cache.MirrorPolicy{Cluster: "shadow", Percent: 2.5}); err != nil {
+		t.Fatal(err)
+	}
+	if err := mirrors.Set(&snap, "default"); err != nil {
+		t.Fatal(err)
+	}
+	if len(audits) != 2 || audits[1].Percent != 0 || audits[1].Previous != 2.5 {
+		t.Errorf("audits => got %+v, want shadow removed", audits)
+	}
+}
@@ -16,27 +16,41 @@ package cache
 
 import (
 	"context"
-	"errors"
+	"fmt"
 )
 
 // MuxCache multiplexes across several caches using a classification function.
-// If there is no matching cache for a classification result, the cache
-// responds with an empty closed channel, which effectively terminates the
-// stream on the server. It might be preferred to respond with a "nil" channel
-// instead which will leave the stream open in case the stream is aggregated by
-// making sure there is always a matching cache.
+// If there is no matching cache for a classification result, the request is
+// passed to the default cache. Without a default cache, the cache responds
+// with an empty closed channel, which effectively terminates the stream on the
+// server. It might be preferred to respond with a "nil" channel instead which
+// will leave the stream open in case the stream is aggregated by making sure
+// there is always a matching cache.
 type MuxCache struct {
-	// Classification functions.
-	Classify func(Request) string
+	// Classification functions. The requests are classified by type URL if
+	// nil.
+	Classify func(*Request) string
 	// Muxed caches.
 	Caches map[string]Cache
+	// Default is the optional cache of the unmatched requests.
+	Default Cache
 }
 
 var _ Cache = &MuxCache{}
 
+func (mux *MuxCache) cache(request *Request) (Cache, bool) {
+	key := request.TypeUrl
+	if mux.Classify != nil {
+		key = mux.Classify(request)
+	}
+	if cache, exists := mux.Caches[key]; exists {
+		return cache, true
+	}
+	return mux.Default, mux.Default != nil
+}
+
 func (mux *MuxCache) CreateWatch(request *Request) (chan Response, func()) {
-	key := mux.Classify(*request)
-	cache, exists := mux.Caches[key]
+	cache, exists := mux.cache(request)
 	if !exists {
 		value := make(chan Response, 0)
 		close(value)
@@ -46,5 +60,9 @@ func (mux *MuxCache) CreateWatch(request *Request) (chan Response, func()) {
 }
 
 func (mux *MuxCache) Fetch(ctx context.Context, request *Request) (Response, error) {
-	return nil, errors.New("not implemented")
+	cache, exists := mux.cache(request)
+	if !exists {
+		return nil, fmt.Errorf("no cache for type %q", request.TypeUrl)
+	}
+	return cache.Fetch(ctx, request)
 }
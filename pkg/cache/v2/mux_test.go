@@ -0,0 +1,64 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package cache_test
+
+import (
+	"context"
+	"testing"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/v2"
+	rsrc "github.com/envoyproxy/go-control-plane/pkg/resource/v2"
+)
+
+func TestMuxCache(t *testing.T) {
+	snapshots := cache.NewSnapshotCache(false, group{}, logger{t: t})
+	if err := snapshots.SetSnapshot(key, snapshot); err != nil {
+		t.Fatal(err)
+	}
+	eds := cache.NewLinearCache(rsrc.EndpointType)
+	if err := eds.UpdateResource("linear", testEndpoint); err != nil {
+		t.Fatal(err)
+	}
+	mux := &cache.MuxCache{
+		Caches:  map[string]cache.Cache{rsrc.EndpointType: eds},
+		Default: snapshots,
+	}
+
+	value, _ := mux.CreateWatch(&cache.Request{TypeUrl: rsrc.EndpointType, ResourceNames: []string{"linear"}})
+	if got, _ := (<-value).GetVersion(); got == version {
+		t.Errorf("EDS response => got version %q, want the linear cache", got)
+	}
+	value, _ = mux.CreateWatch(&cache.Request{TypeUrl: rsrc.ClusterType})
+	if got, _ := (<-value).GetVersion(); got != version {
+		t.Errorf("CDS response => got version %q, want the snapshot cache", got)
+	}
+	if _, err := mux.Fetch(context.Background(), &cache.Request{TypeUrl: rsrc.ClusterType}); err != nil {
+		t.Errorf("Fetch() => got error %v", err)
+	}
+
+	// without a default cache, the unmatched watches are closed
+	mux = &cache.MuxCache{
+		Classify: func(request *cache.Request) string { return request.Node.GetId() },
+		Caches:   map[string]cache.Cache{key: snapshots},
+	}
+	value, _ = mux.CreateWatch(&cache.Request{TypeUrl: rsrc.ClusterType, Node: &core.Node{Id: "other"}})
+	if _, more := <-value; more {
+		t.Error("unmatched watch => got a response, want closed")
+	}
+	if _, err := mux.Fetch(context.Background(), &cache.Request{TypeUrl: rsrc.ClusterType, Node: &core.Node{Id: "other"}}); err == nil {
+		t.Error("unmatched Fetch() => got no error")
+	}
+}
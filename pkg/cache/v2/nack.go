@@ -0,0 +1,100 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package cache
+
+import (
+	"errors"
+	"time"
+
+	"google.golang.org/grpc/status"
+)
+
+// NackFunc is called with the version of a type rejected by a node, and the
+// error detail reported by the node.
+type NackFunc func(node, typeURL, version string, err error)
+
+// trackAck records the acknowledgement status of a request, and handles the
+// rejection of the version last responded for the type.
+func (cache *snapshotCache) trackAck(node string, request *Request) {
+	if request.ResponseNonce == "" {
+		return
+	}
+
+	cache.mu.Lock()
+	info, ok := cache.status[node]
+	if !ok {
+		cache.mu.Unlock()
+		return
+	}
+	snapshot, exists := cache.snapshots[node]
+	typeURL := request.TypeUrl
+
+	info.mu.Lock()
+	sent := info.sent[typeURL]
+	ackStatus := info.ackStatus[typeURL]
+	if request.ErrorDetail == nil {
+		now := time.Now()
+		latency, measured := cache.ackLatency(node, typeURL, request.VersionInfo, now)
+		if measured || ackStatus.AckedVersion != request.VersionInfo {
+			ackStatus.AckLatency = latency
+		}
+		ackStatus.AckedVersion = request.VersionInfo
+		ackStatus.AckTime = now
+		ackStatus.ResourceNames = request.ResourceNames
+		info.ackStatus[typeURL] = ackStatus
+		if exists && sent == request.VersionInfo && snapshot.GetVersion(typeURL) == sent {
+			info.acked[typeURL] = snapshot
+		}
+		info.mu.Unlock()
+		cache.mu.Unlock()
+		if measured && cache.onAcked != nil {
+			cache.onAcked(node, typeURL, request.VersionInfo, latency)
+		}
+		return
+	}
+	ackStatus.NackedVersion = sent
+	ackStatus.NackTime = time.Now()
+	ackStatus.ErrorDetail = request.ErrorDetail
+	info.ackStatus[typeURL] = ackStatus
+	acked, rollback := info.acked[typeURL]
+	info.mu.Unlock()
+
+	// roll back only if the rejected version is still the latest
+	if rollback && cache.rollback && exists && snapshot.GetVersion(typeURL) == sent && acked.GetVersion(typeURL) != sent {
+		if cache.log != nil {
+			cache.log.Warnf("node %q rejected %s version %q, rolling back to version %q",
+				node, typeURL, sent, acked.GetVersion(typeURL))
+		}
+		// the other types keep their current versions
+		typ := GetResponseType(typeURL)
+		rolled := snapshot
+		rolled.Resources[typ] = acked.Resources[typ]
+		rolled.Signature = nil
+		rolled.HealthOnly = false
+		cache.mutableSnapshots()[node] = rolled
+		cache.recordVersions(node, &rolled)
+		cache.respondWatches(node, rolled)
+	}
+	cache.mu.Unlock()
+
+	if cache.onNack != nil {
+		// the error is nil for the details with an OK code
+		err := status.ErrorProto(request.ErrorDetail)
+		if err == nil {
+			err = errors.New(request.ErrorDetail.GetMessage())
+		}
+		cache.onNack(node, typeURL, sent, err)
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package cache_test
+
+import (
+	"testing"
+
+	"google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/codes"
+
+	discovery "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/v2"
+	rsrc "github.com/envoyproxy/go-control-plane/pkg/resource/v2"
+)
+
+func TestSnapshotCacheRollback(t *testing.T) {
+	type nack struct {
+		node, typeURL, version, message string
+	}
+	var nacks []nack
+	c := cache.NewSnapshotCache(false, group{}, logger{t: t},
+		cache.WithAutoRollback(),
+		cache.WithNackCallback(func(node, typeURL, version string, err error) {
+			nacks = append(nacks, nack{node, typeURL, version, err.Error()})
+		}))
+	if err := c.SetSnapshot(key, snapshot); err != nil {
+		t.Fatal(err)
+	}
+
+	// the first version is acknowledged
+	value, _ := c.CreateWatch(&discovery.DiscoveryRequest{TypeUrl: rsrc.ClusterType})
+	if got, _ := (<-value).GetVersion(); got != version {
+		t.Fatalf("version => got %q, want %q", got, version)
+	}
+	value, _ = c.CreateWatch(&discovery.DiscoveryRequest{TypeUrl: rsrc.ClusterType, VersionInfo: version, ResponseNonce: "1"})
+
+	// the second version is rejected
+	bad := cache.NewSnapshot(version2, nil, []types.Resource{testCluster}, nil, nil, nil, nil)
+	if err := c.SetSnapshot(key, bad); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := (<-value).GetVersion(); got != version2 {
+		t.Fatalf("version => got %q, want %q", got, version2)
+	}
+	value, _ = c.CreateWatch(&discovery.DiscoveryRequest{TypeUrl: rsrc.ClusterType, VersionInfo: version, ResponseNonce: "2",
+		ErrorDetail: &status.Status{Code: int32(codes.Internal), Message: "bad cluster"}})
+
+	want := []nack{{key, rsrc.ClusterType, version2, "rpc error: code = Internal desc = bad cluster"}}
+	if len(nacks) != 1 || nacks[0] != want[0] {
+		t.Errorf("NACKs => got %v, want %v", nacks, want)
+	}
+	snap, _ := c.GetSnapshot(key)
+	if got := snap.GetVersion(rsrc.ClusterType); got != version {
+		t.Errorf("rolled back version => got %q, want %q", got, version)
+	}
+	if got := snap.GetVersion(rsrc.EndpointType); got != version2 {
+		t.Errorf("endpoints version after the rollback => got %q, want %q", got, version2)
+	}
+	select {
+	case out := <-value:
+		t.Errorf("watch of the rolled back version => got %v", out)
+	default:
+	}
+
+	// the rejection of an outdated version is not rolled back
+	if err := c.SetSnapshot(key, bad); err != nil {
+		t.Fatal(err)
+	}
+	<-value
+	if err := c.SetSnapshot(key, cache.NewSnapshot("z", nil, []types.Resource{testCluster}, nil, nil, nil, nil)); err != nil {
+		t.Fatal(err)
+	}
+	c.CreateWatch(&discovery.DiscoveryRequest{TypeUrl: rsrc.ClusterType, VersionInfo: version, ResponseNonce: "3",
+		ErrorDetail: &status.Status{Message: "bad cluster"}})
+	if snap, _ := c.GetSnapshot(key); snap.GetVersion(rsrc.ClusterType) != "z" || len(nacks) != 2 {
+		t.Errorf("snapshot version => got %q with NACKs %v, want z", snap.GetVersion(rsrc.ClusterType), nacks)
+	}
+}
+
+func TestSnapshotCacheAckStatus(t *testing.T) {
+	c := cache.NewSnapshotCache(false, group{}, logger{t: t})
+	if err := c.SetSnapshot(key, snapshot); err != nil {
+		t.Fatal(err)
+	}
+	value, _ := c.CreateWatch(&discovery.DiscoveryRequest{TypeUrl: rsrc.ClusterType})
+	<-value
+	value, _ = c.CreateWatch(&discovery.DiscoveryRequest{TypeUrl: rsrc.ClusterType, VersionInfo: version, ResponseNonce: "1"})
+	got := c.GetStatusInfo(key).GetAckStatus()[rsrc.ClusterType]
+	if got.AckedVersion != version || got.AckTime.IsZero() || !got.Converged(version) {
+		t.Errorf("ACK status => got %+v, want %q acknowledged", got, version)
+	}
+
+	if err := c.SetSnapshot(key, cache.NewSnapshot(version2, nil, []types.Resource{testCluster}, nil, nil, nil, nil)); err != nil {
+		t.Fatal(err)
+	}
+	<-value
+	c.CreateWatch(&discovery.DiscoveryRequest{TypeUrl: rsrc.ClusterType, VersionInfo: version, ResponseNonce: "2",
+		ErrorDetail: &status.Status{Code: int32(codes.InvalidArgument), Message: "bad cluster"}})
+	got = c.GetStatusInfo(key).GetAckStatus()[rsrc.ClusterType]
+	if got.AckedVersion != version || got.NackedVersion != version2 || got.ErrorDetail.GetMessage() != "bad cluster" || got.Converged(version2) {
+		t.Errorf("NACK status => got %+v, want %q rejected", got, version2)
+	}
+	if _, exists := c.GetStatusInfo(key).GetAckStatus()[rsrc.ListenerType]; exists {
+		t.Error("ACK status of an unrequested type => got a status")
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package cache
+
+import (
+	"github.com/envoyproxy/go-control-plane/pkg/xdstp"
+)
+
+// nameMatcher matches the snapshot resource names against the requested
+// names. The xdstp names match in their canonical form, regardless of the
+// order of the context params, and the xdstp globs match all the resources
+// of their collection. The legacy names match exactly.
+type nameMatcher struct {
+	names map[string]bool
+	globs []*xdstp.URN
+}
+
+func newNameMatcher(names []string) nameMatcher {
+	out := nameMatcher{names: make(map[string]bool, len(names))}
+	for _, name := range names {
+		if !xdstp.IsXDSTP(name) {
+			out.names[name] = true
+			continue
+		}
+		urn, err := xdstp.Parse(name)
+		if err != nil {
+			out.names[name] = true
+			continue
+		}
+		if urn.IsGlob() {
+			out.globs = append(out.globs, urn)
+		} else {
+			out.names[urn.String()] = true
+		}
+	}
+	return out
+}
+
+func (m nameMatcher) matches(name string) bool {
+	if !xdstp.IsXDSTP(name) {
+		return m.names[name]
+	}
+	urn, err := xdstp.Parse(name)
+	if err != nil {
+		return m.names[name]
+	}
+	if m.names[urn.String()] {
+		return true
+	}
+	for _, glob := range m.globs {
+		if glob.Matches(urn) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,68 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package cache_test
+
+import (
+	"sort"
+	"testing"
+
+	discovery "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/v2"
+	rsrc "github.com/envoyproxy/go-control-plane/pkg/resource/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/test/resource/v2"
+)
+
+func TestXDSTPNames(t *testing.T) {
+	const prefix = "xdstp://auth/envoy.api.v2.ClusterLoadAssignment/"
+	c := cache.NewSnapshotCache(true, cache.IDHash{}, nil)
+	snap := cache.NewSnapshot(version, []types.Resource{
+		resource.MakeEndpoint(prefix+"tenant/a?zone=z&region=r", 8080),
+		resource.MakeEndpoint(prefix+"tenant/b?region=r&zone=z", 8080),
+		resource.MakeEndpoint(prefix+"other/c?region=r&zone=z", 8080),
+		resource.MakeEndpoint(clusterName, 8080),
+	}, nil, nil, nil, nil, nil)
+	if err := c.SetSnapshot(key, snap); err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(names ...string) []string {
+		t.Helper()
+		w, _ := c.CreateWatch(&discovery.DiscoveryRequest{Node: &core.Node{Id: key}, TypeUrl: rsrc.EndpointType, ResourceNames: names})
+		select {
+		case out := <-w:
+			var got []string
+			for _, res := range out.(*cache.RawResponse).Resources {
+				got = append(got, cache.GetResourceName(res))
+			}
+			sort.Strings(got)
+			return got
+		default:
+			return nil
+		}
+	}
+
+	all := []string{clusterName, prefix + "other/c?region=r&zone=z", prefix + "tenant/a?zone=z&region=r", prefix + "tenant/b?region=r&zone=z"}
+	if got := get(clusterName, prefix+"tenant/a?region=r&zone=z", prefix+"tenant/b?zone=z&region=r", prefix+"other/c?region=r&zone=z"); len(got) != 4 {
+		t.Errorf("reordered context params => got %v, want %v", got, all)
+	}
+	if got := get(clusterName, prefix+"tenant/*?region=r&zone=z", prefix+"other/*?zone=z&region=r"); len(got) != 4 {
+		t.Errorf("collection globs => got %v, want %v", got, all)
+	}
+	if got := get(clusterName, prefix+"tenant/*?region=r&zone=z"); got != nil {
+		t.Errorf("ADS request missing a resource => got %v, want no response", got)
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package cache
+
+import (
+	"time"
+
+	"github.com/envoyproxy/go-control-plane/pkg/resource/v2"
+)
+
+// adsOrder is the make-before-break order of the types in the xDS protocol.
+var adsOrder = []string{
+	resource.ClusterType,
+	resource.EndpointType,
+	resource.ListenerType,
+	resource.ScopedRouteType,
+	resource.RouteType,
+}
+
+// WithOrderedADS sequences the responses to a node in the make-before-break
+// order of the xDS protocol: the clusters, the endpoints, the listeners, the
+// scoped routes and then the routes. A response of a type is held while the
+// node has not acknowledged the snapshot version of an earlier type it
+// subscribes to, so that a large update does not reach the node before the
+// resources it references, which causes transient 404s and rejections. The
+// other types are not held.
+//
+// A rejected version holds the later types until the node acknowledges a
+// newer snapshot of the rejected type. The acknowledgements are tracked by
+// node, so the nodes should not share their node IDs. The initial request of
+// a type at the current version, e.g. of a client reconnecting after a
+// restart or a failover of the control plane, acknowledges the version.
+func WithOrderedADS() SnapshotCacheOption {
+	return func(cache *snapshotCache) {
+		cache.ordered = true
+	}
+}
+
+// held checks whether the response of a type waits for the node to
+// acknowledge an earlier type. The status mutex must be held.
+func (info *statusInfo) held(snapshot *Snapshot, typeURL string) bool {
+	if !isOrdered(typeURL) {
+		return false
+	}
+	for _, earlier := range adsOrder {
+		if earlier == typeURL {
+			return false
+		}
+		if info.subscribed(earlier) && info.ackStatus[earlier].AckedVersion != snapshot.GetVersion(earlier) {
+			return true
+		}
+	}
+	return false
+}
+
+// subscribed checks whether the node has requested a type. The status mutex
+// must be held.
+func (info *statusInfo) subscribed(typeURL string) bool {
+	if _, sent := info.sent[typeURL]; sent {
+		return true
+	}
+	for _, watch := range info.watches {
+		if watch.Request.TypeUrl == typeURL {
+			return true
+		}
+	}
+	return false
+}
+
+// isOrdered checks whether a type is sequenced by WithOrderedADS.
+func isOrdered(typeURL string) bool {
+	for _, ordered := range adsOrder {
+		if ordered == typeURL {
+			return true
+		}
+	}
+	return false
+}
+
+// ackInitial records the version of the initial request of a type as
+// acknowledged, since the client reconnects with the version it applied. The
+// status mutex must be held.
+func (info *statusInfo) ackInitial(snapshot Snapshot, request *Request) {
+	typeURL := request.TypeUrl
+	version := snapshot.GetVersion(typeURL)
+	ackStatus := info.ackStatus[typeURL]
+	if ackStatus.AckedVersion != version {
+		ackStatus.AckedVersion = version
+		ackStatus.AckTime = time.Now()
+	}
+	ackStatus.ResourceNames = request.ResourceNames
+	info.ackStatus[typeURL] = ackStatus
+	info.sent[typeURL] = version
+	info.acked[typeURL] = snapshot
+}
@@ -0,0 +1,184 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package cache_test
+
+import (
+	"testing"
+
+	discovery "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	route "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/v2"
+	rsrc "github.com/envoyproxy/go-control-plane/pkg/resource/v2"
+)
+
+func TestOrderedADS(t *testing.T) {
+	c := cache.NewSnapshotCache(false, group{}, logger{t: t}, cache.WithOrderedADS())
+	if err := c.SetSnapshot(key, snapshot); err != nil {
+		t.Fatal(err)
+	}
+	watch := func(typeURL, version, nonce string) chan cache.Response {
+		value, _ := c.CreateWatch(&discovery.DiscoveryRequest{
+			Node:          &core.Node{Id: key},
+			TypeUrl:       typeURL,
+			ResourceNames: names[typeURL],
+			VersionInfo:   version,
+			ResponseNonce: nonce,
+		})
+		return value
+	}
+	responded := func(value chan cache.Response) bool {
+		select {
+		case <-value:
+			return true
+		default:
+			return false
+		}
+	}
+
+	if !responded(watch(rsrc.ClusterType, "", "")) {
+		t.Fatal("clusters => got no response")
+	}
+	endpoints := watch(rsrc.EndpointType, "", "")
+	listeners := watch(rsrc.ListenerType, "", "")
+	if responded(endpoints) || responded(listeners) {
+		t.Fatal("endpoints and listeners before the clusters acknowledgement => got a response")
+	}
+	if !responded(watch(rsrc.RuntimeType, "", "")) {
+		t.Error("runtimes => got no response, want not held")
+	}
+
+	// the clusters acknowledgement releases the endpoints, but the listeners
+	// wait for the endpoints acknowledgement
+	clusters := watch(rsrc.ClusterType, version, "1")
+	if !responded(endpoints) {
+		t.Fatal("endpoints after the clusters acknowledgement => got no response")
+	}
+	if responded(listeners) {
+		t.Fatal("listeners before the endpoints acknowledgement => got a response")
+	}
+	watch(rsrc.EndpointType, version, "2")
+	if !responded(listeners) {
+		t.Fatal("listeners after the endpoints acknowledgement => got no response")
+	}
+
+	// a new cluster version holds the endpoints again
+	endpoints = watch(rsrc.EndpointType, version, "3")
+	next := cache.NewSnapshot(version2,
+		[]types.Resource{testEndpoint},
+		[]types.Resource{testCluster},
+		[]types.Resource{testRoute},
+		[]types.Resource{testListener},
+		[]types.Resource{testRuntime},
+		[]types.Resource{testSecret[0]})
+	if err := c.SetSnapshot(key, next); err != nil {
+		t.Fatal(err)
+	}
+	if !responded(clusters) {
+		t.Fatal("clusters of the new snapshot => got no response")
+	}
+	if responded(endpoints) {
+		t.Fatal("endpoints of the new snapshot before the clusters acknowledgement => got a response")
+	}
+	watch(rsrc.ClusterType, version2, "4")
+	if !responded(endpoints) {
+		t.Error("endpoints of the new snapshot after the clusters acknowledgement => got no response")
+	}
+}
+
+func TestOrderedADSUpsert(t *testing.T) {
+	c := cache.NewSnapshotCache(false, group{}, logger{t: t}, cache.WithOrderedADS())
+	if err := c.SetSnapshot(key, snapshot); err != nil {
+		t.Fatal(err)
+	}
+	watch := func(typeURL, version, nonce string) chan cache.Response {
+		value, _ := c.CreateWatch(&discovery.DiscoveryRequest{
+			Node:          &core.Node{Id: key},
+			TypeUrl:       typeURL,
+			ResourceNames: names[typeURL],
+			VersionInfo:   version,
+			ResponseNonce: nonce,
+		})
+		return value
+	}
+
+	if resp := <-watch(rsrc.ClusterType, "", ""); resp == nil {
+		t.Fatal("clusters => got no response")
+	}
+	endpoints := watch(rsrc.EndpointType, "", "")
+
+	// the upserted endpoints wait for the clusters acknowledgement
+	if err := c.UpsertResources(key, rsrc.EndpointType, []types.Resource{testEndpoint}, nil); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case resp := <-endpoints:
+		t.Fatalf("upserted endpoints before the clusters acknowledgement => got %v", resp)
+	default:
+	}
+	watch(rsrc.ClusterType, version, "1")
+	select {
+	case resp := <-endpoints:
+		if got, want := resp.GetRequest().TypeUrl, rsrc.EndpointType; got != want {
+			t.Errorf("upserted endpoints => got %q, want %q", got, want)
+		}
+	default:
+		t.Error("upserted endpoints after the clusters acknowledgement => got no response")
+	}
+}
+
+func TestOrderedADSReconnect(t *testing.T) {
+	c := cache.NewSnapshotCache(false, group{}, logger{t: t}, cache.WithOrderedADS())
+	scoped := snapshot.WithScopedRoutes(version, []types.Resource{&route.ScopedRouteConfiguration{Name: "scope", RouteConfigurationName: routeName}})
+	if err := c.SetSnapshot(key, scoped); err != nil {
+		t.Fatal(err)
+	}
+	watch := func(typeURL, version, nonce string) chan cache.Response {
+		value, _ := c.CreateWatch(&discovery.DiscoveryRequest{
+			Node:          &core.Node{Id: key},
+			TypeUrl:       typeURL,
+			ResourceNames: names[typeURL],
+			VersionInfo:   version,
+			ResponseNonce: nonce,
+		})
+		return value
+	}
+	responded := func(value chan cache.Response) bool {
+		select {
+		case <-value:
+			return true
+		default:
+			return false
+		}
+	}
+
+	// a client reconnecting to a new control plane already has the clusters
+	watch(rsrc.ClusterType, version, "")
+	listeners := watch(rsrc.ListenerType, "", "")
+	if !responded(listeners) {
+		t.Fatal("listeners after the reconnection at the current clusters => got no response")
+	}
+
+	// the scoped routes wait for the listeners acknowledgement
+	scopes := watch(rsrc.ScopedRouteType, "", "")
+	if responded(scopes) {
+		t.Fatal("scoped routes before the listeners acknowledgement => got a response")
+	}
+	watch(rsrc.ListenerType, version, "1")
+	if !responded(scopes) {
+		t.Error("scoped routes after the listeners acknowledgement => got no response")
+	}
+}
@@ -0,0 +1,245 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
+)
+
+// ConflictPolicy is the handling of the writes of a resource by a producer
+// other than its owner.
+type ConflictPolicy int
+
+const (
+	// RejectConflicts rejects the writes of the non-owners.
+	RejectConflicts ConflictPolicy = iota
+
+	// FlagConflicts applies the writes of the non-owners and reports the
+	// conflicts. The owner is unchanged, unless the resource is removed.
+	FlagConflicts
+)
+
+// Conflict is a write of a resource by a producer other than its owner. The
+// node is empty for the linear caches.
+type Conflict struct {
+	Node    string
+	TypeURL string
+	Name    string
+	Owner   string
+	Writer  string
+}
+
+func (c Conflict) Error() string {
+	if c.Node == "" {
+		return fmt.Sprintf("resource %q of %s is owned by %q, not %q", c.Name, c.TypeURL, c.Owner, c.Writer)
+	}
+	return fmt.Sprintf("resource %q of %s for node %s is owned by %q, not %q", c.Name, c.TypeURL, c.Node, c.Owner, c.Writer)
+}
+
+type ownershipKey struct {
+	node    string
+	typeURL string
+	name    string
+}
+
+// Ownership labels the resources written to the caches by several producers,
+// e.g. the endpoints from the service discovery and the clusters from a
+// GitOps pipeline, with their owners. The first producer writing a resource
+// owns it until it removes it, and the writes of the other producers are
+// conflicts handled by the policy. The owned writes are UpsertOwnedResources
+// of the snapshot caches and UpdateOwnedResource and DeleteOwnedResource of
+// the linear caches.
+//
+// The other writes of the caches with an ownership registry are checked as the
+// writes of an anonymous producer, which never owns the resources:
+// UpsertResources of the snapshot caches, and UpdateResource, DeleteResource
+// and the transactions of the linear caches. SetSnapshot and ClearSnapshot
+// replace the whole snapshot of a node, and release all its resources.
+type Ownership struct {
+	policy     ConflictPolicy
+	onConflict func(Conflict)
+
+	mu     sync.Mutex
+	owners map[ownershipKey]string
+}
+
+// NewOwnership creates an ownership registry reporting the conflicts to the
+// optional function.
+func NewOwnership(policy ConflictPolicy, onConflict func(Conflict)) *Ownership {
+	return &Ownership{policy: policy, onConflict: onConflict, owners: make(map[ownershipKey]string)}
+}
+
+// Owner returns the owner of a resource.
+func (o *Ownership) Owner(node, typeURL, name string) (string, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	owner, exists := o.owners[ownershipKey{node: node, typeURL: typeURL, name: name}]
+	return owner, exists
+}
+
+// Override transfers a resource to an owner, or releases it if the owner is
+// empty, e.g. to hand the resource over to another producer.
+func (o *Ownership) Override(node, typeURL, name, owner string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	key := ownershipKey{node: node, typeURL: typeURL, name: name}
+	if owner == "" {
+		delete(o.owners, key)
+	} else {
+		o.owners[key] = owner
+	}
+}
+
+// write applies a write of the resources by a writer unless it is a rejected
+// conflict, then claims the unowned written resources for the writer, unless
+// anonymous, and releases the removed resources. The conflicts are reported
+// after the write.
+func (o *Ownership) write(node, typeURL, writer string, written, removed []string, apply func() error) error {
+	o.mu.Lock()
+	conflicts, err := o.check(node, typeURL, writer, written, removed)
+	if err == nil {
+		if err = apply(); err == nil {
+			o.claim(node, typeURL, writer, written, removed)
+		}
+	}
+	o.mu.Unlock()
+
+	o.report(conflicts)
+	return err
+}
+
+// check returns the conflicts of a write, and the first one if the policy
+// rejects them. The mutex must be held.
+func (o *Ownership) check(node, typeURL, writer string, written, removed []string) ([]Conflict, error) {
+	var conflicts []Conflict
+	for _, names := range [][]string{written, removed} {
+		for _, name := range names {
+			owner, exists := o.owners[ownershipKey{node: node, typeURL: typeURL, name: name}]
+			if exists && owner != writer {
+				conflicts = append(conflicts, Conflict{Node: node, TypeURL: typeURL, Name: name, Owner: owner, Writer: writer})
+			}
+		}
+	}
+	if len(conflicts) > 0 && o.policy == RejectConflicts {
+		return conflicts, conflicts[0]
+	}
+	return conflicts, nil
+}
+
+// claim updates the owners after an applied write. The mutex must be held.
+func (o *Ownership) claim(node, typeURL, writer string, written, removed []string) {
+	for _, name := range removed {
+		delete(o.owners, ownershipKey{node: node, typeURL: typeURL, name: name})
+	}
+	if writer == "" {
+		return
+	}
+	for _, name := range written {
+		key := ownershipKey{node: node, typeURL: typeURL, name: name}
+		if _, exists := o.owners[key]; !exists {
+			o.owners[key] = writer
+		}
+	}
+}
+
+func (o *Ownership) report(conflicts []Conflict) {
+	if o.onConflict != nil {
+		for _, conflict := range conflicts {
+			o.onConflict(conflict)
+		}
+	}
+}
+
+// release releases all the resources of a node.
+func (o *Ownership) release(node string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for key := range o.owners {
+		if key.node == node {
+			delete(o.owners, key)
+		}
+	}
+}
+
+// OwnedUpserter is implemented by the snapshot caches updating the resources
+// on behalf of their owners.
+type OwnedUpserter interface {
+	// UpsertOwnedResources is UpsertResources on behalf of an owner, checked
+	// against the ownership registry of the cache, see WithOwnership.
+	UpsertOwnedResources(owner string, node string, typeURL string, resources []types.Resource, removed []string) error
+}
+
+var _ OwnedUpserter = &snapshotCache{}
+
+// WithOwnership checks the owners of the resources written by
+// UpsertOwnedResources, and of the other writes, see Ownership.
+func WithOwnership(ownership *Ownership) SnapshotCacheOption {
+	return func(cache *snapshotCache) {
+		cache.ownership = ownership
+	}
+}
+
+// UpsertOwnedResources is UpsertResources on behalf of an owner, see
+// Ownership. The snapshot is unchanged if a conflict is rejected.
+func (cache *snapshotCache) UpsertOwnedResources(owner string, node string, typeURL string, resources []types.Resource, removed []string) error {
+	if cache.ownership == nil {
+		return errors.New("no ownership registry, see WithOwnership")
+	}
+	if cache.strictNames {
+		if err := cache.checkUpsertNames(node, typeURL, owner, resources); err != nil {
+			return err
+		}
+	}
+	written := make([]string, 0, len(resources))
+	for _, item := range resources {
+		written = append(written, GetResourceName(item))
+	}
+	return cache.ownership.write(node, typeURL, owner, written, removed, func() error {
+		return cache.upsertResources(node, typeURL, resources, removed)
+	})
+}
+
+// WithLinearOwnership checks the owners of the resources written by
+// UpdateOwnedResource and DeleteOwnedResource, and of the other writes, see
+// Ownership.
+func WithLinearOwnership(ownership *Ownership) LinearCacheOption {
+	return func(cache *LinearCache) {
+		cache.ownership = ownership
+	}
+}
+
+// UpdateOwnedResource is UpdateResource on behalf of an owner, see Ownership.
+func (cache *LinearCache) UpdateOwnedResource(owner string, name string, res types.Resource) error {
+	if cache.ownership == nil {
+		return errors.New("no ownership registry, see WithLinearOwnership")
+	}
+	return cache.ownership.write("", cache.typeURL, owner, []string{name}, nil, func() error {
+		return cache.updateResource(name, res)
+	})
+}
+
+// DeleteOwnedResource is DeleteResource on behalf of an owner, see Ownership.
+func (cache *LinearCache) DeleteOwnedResource(owner string, name string) error {
+	if cache.ownership == nil {
+		return errors.New("no ownership registry, see WithLinearOwnership")
+	}
+	return cache.ownership.write("", cache.typeURL, owner, nil, []string{name}, func() error {
+		return cache.deleteResource(name)
+	})
+}
@@ -0,0 +1,150 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package cache_test
+
+import (
+	"testing"
+
+	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/v2"
+	rsrc "github.com/envoyproxy/go-control-plane/pkg/resource/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/test/resource/v2"
+)
+
+func TestOwnershipRejectConflicts(t *testing.T) {
+	ownership := cache.NewOwnership(cache.RejectConflicts, nil)
+	c := cache.NewSnapshotCache(false, group{}, logger{t: t}, cache.WithOwnership(ownership))
+	owned := c.(cache.OwnedUpserter)
+	if err := c.SetSnapshot(key, snapshot); err != nil {
+		t.Fatal(err)
+	}
+	added := []types.Resource{resource.MakeCluster(resource.Ads, "added")}
+
+	if err := owned.UpsertOwnedResources("gitops", key, rsrc.ClusterType, added, nil); err != nil {
+		t.Fatal(err)
+	}
+	if owner, _ := ownership.Owner(key, rsrc.ClusterType, "added"); owner != "gitops" {
+		t.Errorf("Owner() => got %q, want gitops", owner)
+	}
+
+	err := owned.UpsertOwnedResources("discovery", key, rsrc.ClusterType, nil, []string{"added"})
+	if conflict, ok := err.(cache.Conflict); !ok || conflict.Owner != "gitops" || conflict.Writer != "discovery" {
+		t.Errorf("removal by a non-owner => got %v, want a conflict", err)
+	}
+	got, _ := c.GetSnapshot(key)
+	if _, exists := got.GetResources(rsrc.ClusterType)["added"]; !exists {
+		t.Error("rejected removal => got the resource removed")
+	}
+
+	ownership.Override(key, rsrc.ClusterType, "added", "discovery")
+	if err := owned.UpsertOwnedResources("discovery", key, rsrc.ClusterType, nil, []string{"added"}); err != nil {
+		t.Errorf("removal after the override => got %v", err)
+	}
+	if _, exists := ownership.Owner(key, rsrc.ClusterType, "added"); exists {
+		t.Error("removed resource => got an owner")
+	}
+}
+
+func TestOwnershipFlagConflicts(t *testing.T) {
+	var conflicts []cache.Conflict
+	ownership := cache.NewOwnership(cache.FlagConflicts, func(conflict cache.Conflict) {
+		conflicts = append(conflicts, conflict)
+	})
+	c := cache.NewLinearCache(rsrc.EndpointType, cache.WithLinearOwnership(ownership))
+
+	if err := c.UpdateOwnedResource("discovery", "a", resource.MakeEndpoint("a", 8080)); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.UpdateOwnedResource("gitops", "a", resource.MakeEndpoint("a", 9090)); err != nil {
+		t.Errorf("flagged write => got %v", err)
+	}
+	if len(conflicts) != 1 || conflicts[0].Name != "a" || conflicts[0].Owner != "discovery" {
+		t.Errorf("conflicts => got %v, want the write of a by gitops", conflicts)
+	}
+	if owner, _ := ownership.Owner("", rsrc.EndpointType, "a"); owner != "discovery" {
+		t.Errorf("Owner() after a flagged write => got %q, want discovery", owner)
+	}
+	if err := c.DeleteOwnedResource("discovery", "a"); err != nil {
+		t.Fatal(err)
+	}
+	if len(conflicts) != 1 {
+		t.Errorf("removal by the owner => got conflicts %v", conflicts)
+	}
+}
+
+func TestOwnershipUncheckedWrites(t *testing.T) {
+	ownership := cache.NewOwnership(cache.RejectConflicts, nil)
+	c := cache.NewSnapshotCache(false, group{}, logger{t: t}, cache.WithOwnership(ownership))
+	owned := c.(cache.OwnedUpserter)
+	if err := c.SetSnapshot(key, snapshot); err != nil {
+		t.Fatal(err)
+	}
+	if err := owned.UpsertOwnedResources("gitops", key, rsrc.ClusterType, []types.Resource{testCluster}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// the unchecked writes are anonymous
+	err := c.UpsertResources(key, rsrc.ClusterType, nil, []string{clusterName})
+	if conflict, ok := err.(cache.Conflict); !ok || conflict.Owner != "gitops" || conflict.Writer != "" {
+		t.Errorf("anonymous removal => got %v, want a conflict", err)
+	}
+	if err := c.UpsertResources(key, rsrc.ClusterType, []types.Resource{resource.MakeCluster(resource.Ads, "anonymous")}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, exists := ownership.Owner(key, rsrc.ClusterType, "anonymous"); exists {
+		t.Error("anonymous write => got an owner")
+	}
+
+	// the snapshots release the resources of the node
+	if err := c.SetSnapshot(key, snapshot); err != nil {
+		t.Fatal(err)
+	}
+	if _, exists := ownership.Owner(key, rsrc.ClusterType, clusterName); exists {
+		t.Error("Owner() after SetSnapshot => got an owner")
+	}
+	if err := owned.UpsertOwnedResources("gitops", key, rsrc.ClusterType, []types.Resource{testCluster}, nil); err != nil {
+		t.Fatal(err)
+	}
+	c.ClearSnapshot(key)
+	if _, exists := ownership.Owner(key, rsrc.ClusterType, clusterName); exists {
+		t.Error("Owner() after ClearSnapshot => got an owner")
+	}
+}
+
+func TestOwnershipTxn(t *testing.T) {
+	ownership := cache.NewOwnership(cache.RejectConflicts, nil)
+	c := cache.NewLinearCache(rsrc.EndpointType, cache.WithLinearOwnership(ownership))
+	if err := c.UpdateOwnedResource("discovery", "a", resource.MakeEndpoint("a", 8080)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.DeleteResource("a"); err == nil {
+		t.Error("anonymous delete => got no conflict")
+	}
+	txn := cache.NewTxn()
+	txn.DeleteResource(c, "a")
+	if _, ok := txn.Commit().(cache.Conflict); !ok {
+		t.Error("anonymous transaction => got no conflict")
+	}
+	if owner, _ := ownership.Owner("", rsrc.EndpointType, "a"); owner != "discovery" {
+		t.Errorf("rejected transaction => got owner %q, want %q", owner, "discovery")
+	}
+
+	ownership.Override("", rsrc.EndpointType, "a", "")
+	txn.DeleteResource(c, "a")
+	if err := txn.Commit(); err != nil {
+		t.Errorf("transaction after the release => got %v", err)
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package cache
+
+import (
+	"time"
+
+	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
+)
+
+// VersionAckedFunc is called with the propagation latency of a version of a
+// type to a node, from the update setting the version to its first
+// acknowledgement by the node.
+type VersionAckedFunc func(node, typeURL, version string, latency time.Duration)
+
+// WithVersionAckedCallback calls the function with the propagation latency
+// of the versions acknowledged by the nodes, e.g. to measure the rollout
+// speed against an objective. The latency is also reported by the
+// acknowledgement statuses, see AckStatus.
+func WithVersionAckedCallback(onAcked VersionAckedFunc) SnapshotCacheOption {
+	return func(cache *snapshotCache) {
+		cache.onAcked = onAcked
+	}
+}
+
+// versionUpdate is the time a version of a type was set for a node.
+type versionUpdate struct {
+	version string
+	time    time.Time
+	acked   bool
+}
+
+// recordVersions records the time of the versions changed by a snapshot of
+// a node. The cache lock must be held.
+func (cache *snapshotCache) recordVersions(node string, snapshot *Snapshot) {
+	now := time.Now()
+	updates := cache.versionUpdates[node]
+	if updates == nil {
+		updates = make(map[string]*versionUpdate)
+		cache.versionUpdates[node] = updates
+	}
+	for typ := types.ResponseType(0); typ < types.UnknownType; typ++ {
+		typeURL := GetResponseTypeURL(typ)
+		version := snapshot.Resources[typ].Version
+		if update, exists := updates[typeURL]; exists && update.version == version {
+			continue
+		}
+		updates[typeURL] = &versionUpdate{version: version, time: now}
+	}
+}
+
+// ackLatency returns the propagation latency of a version on its first
+// acknowledgement. The cache lock must be held.
+func (cache *snapshotCache) ackLatency(node, typeURL, version string, now time.Time) (time.Duration, bool) {
+	update, exists := cache.versionUpdates[node][typeURL]
+	if !exists || update.acked || update.version != version {
+		return 0, false
+	}
+	update.acked = true
+	return now.Sub(update.time), true
+}
@@ -0,0 +1,63 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package cache_test
+
+import (
+	"testing"
+	"time"
+
+	discovery "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/v2"
+	rsrc "github.com/envoyproxy/go-control-plane/pkg/resource/v2"
+)
+
+func TestSnapshotCachePropagationLatency(t *testing.T) {
+	type acked struct {
+		typeURL, version string
+		latency          time.Duration
+	}
+	var got []acked
+	c := cache.NewSnapshotCache(false, group{}, logger{t: t},
+		cache.WithVersionAckedCallback(func(node, typeURL, version string, latency time.Duration) {
+			got = append(got, acked{typeURL, version, latency})
+		}))
+	if err := c.SetSnapshot(key, snapshot); err != nil {
+		t.Fatal(err)
+	}
+
+	value, _ := c.CreateWatch(&discovery.DiscoveryRequest{TypeUrl: rsrc.ClusterType})
+	<-value
+	time.Sleep(10 * time.Millisecond)
+	_, cancel := c.CreateWatch(&discovery.DiscoveryRequest{TypeUrl: rsrc.ClusterType, VersionInfo: version, ResponseNonce: "1"})
+	cancel()
+
+	if len(got) != 1 || got[0].typeURL != rsrc.ClusterType || got[0].version != version || got[0].latency < 10*time.Millisecond {
+		t.Fatalf("acknowledged versions => got %v, want %s of %s after 10ms", got, version, rsrc.ClusterType)
+	}
+	status := c.GetStatusInfo(key).GetAckStatus()[rsrc.ClusterType]
+	if status.AckLatency != got[0].latency {
+		t.Errorf("AckLatency => got %v, want %v", status.AckLatency, got[0].latency)
+	}
+
+	// the repeated acknowledgements are not measured again
+	_, cancel = c.CreateWatch(&discovery.DiscoveryRequest{TypeUrl: rsrc.ClusterType, VersionInfo: version, ResponseNonce: "2"})
+	cancel()
+	if len(got) != 1 {
+		t.Errorf("acknowledged versions => got %v, want one", got)
+	}
+	if status := c.GetStatusInfo(key).GetAckStatus()[rsrc.ClusterType]; status.AckLatency != got[0].latency {
+		t.Errorf("AckLatency after a repeated acknowledgement => got %v, want %v", status.AckLatency, got[0].latency)
+	}
+}
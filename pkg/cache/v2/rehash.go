@@ -0,0 +1,82 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package cache
+
+import (
+	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+)
+
+// nodeID hashes a node with the current hash.
+func (cache *snapshotCache) nodeID(node *core.Node) string {
+	cache.mu.RLock()
+	defer cache.mu.RUnlock()
+	return cache.hash.ID(node)
+}
+
+// SetNodeHash replaces the node hash. The open watches hashed to another node
+// ID are moved to the status of the new ID, and responded at once if the
+// snapshot of the new ID has another version than the watch. The statuses
+// left without watches keep the acknowledgements of the previous node IDs
+// until they are cleared.
+func (cache *snapshotCache) SetNodeHash(hash NodeHash) int {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	cache.hash = hash
+
+	moved := make(map[string]map[int64]ResponseWatch)
+	for nodeID, info := range cache.status {
+		info.mu.Lock()
+		for id, watch := range info.watches {
+			target := hash.ID(watch.Request.Node)
+			if target == nodeID {
+				continue
+			}
+			if moved[target] == nil {
+				moved[target] = make(map[int64]ResponseWatch)
+			}
+			moved[target][id] = watch
+			delete(info.watches, id)
+		}
+		info.mu.Unlock()
+	}
+
+	count := 0
+	for nodeID, watches := range moved {
+		info, ok := cache.status[nodeID]
+		snapshot, exists := cache.snapshots[nodeID]
+		for id, watch := range watches {
+			count++
+			if !ok {
+				info = newStatusInfo(watch.Request.Node)
+				cache.mutableStatus()[nodeID] = info
+				ok = true
+			}
+			version := snapshot.GetVersion(watch.Request.TypeUrl)
+			info.mu.Lock()
+			if exists && version != watch.Request.VersionInfo && cache.respond(watch.Request, watch.Response, &snapshot, version) {
+				info.sent[watch.Request.TypeUrl] = version
+				delete(cache.movedWatches, id)
+			} else {
+				info.watches[id] = watch
+				cache.movedWatches[id] = nodeID
+			}
+			info.mu.Unlock()
+			if cache.log != nil {
+				cache.log.Debugf("moved watch %d for %s to node %q", id, watch.Request.TypeUrl, nodeID)
+			}
+		}
+	}
+	return count
+}
@@ -0,0 +1,85 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package cache_test
+
+import (
+	"testing"
+
+	discovery "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/v2"
+	rsrc "github.com/envoyproxy/go-control-plane/pkg/resource/v2"
+)
+
+type clusterHash struct{}
+
+func (clusterHash) ID(node *core.Node) string {
+	return node.GetCluster()
+}
+
+func TestSetNodeHash(t *testing.T) {
+	c := cache.NewSnapshotCache(false, cache.IDHash{}, logger{t: t})
+	if err := c.SetSnapshot("a", snapshot); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SetSnapshot("edge", cache.NewSnapshot(version2, nil, []types.Resource{testCluster}, nil, nil, nil, nil)); err != nil {
+		t.Fatal(err)
+	}
+	responded, _ := c.CreateWatch(&discovery.DiscoveryRequest{
+		Node:        &core.Node{Id: "a", Cluster: "edge"},
+		TypeUrl:     rsrc.ClusterType,
+		VersionInfo: version,
+	})
+	open, cancel := c.CreateWatch(&discovery.DiscoveryRequest{
+		Node:    &core.Node{Id: "b", Cluster: "other"},
+		TypeUrl: rsrc.ClusterType,
+	})
+	unchanged, _ := c.CreateWatch(&discovery.DiscoveryRequest{
+		Node:        &core.Node{Id: "edge"},
+		TypeUrl:     rsrc.ClusterType,
+		VersionInfo: version2,
+	})
+
+	if got := c.SetNodeHash(clusterHash{}); got != 3 {
+		t.Errorf("SetNodeHash() => got %d moved watches, want 3", got)
+	}
+	select {
+	case out := <-responded:
+		if got := out.(*cache.RawResponse).Version; got != version2 {
+			t.Errorf("moved watch => got version %q, want %q", got, version2)
+		}
+	default:
+		t.Error("moved watch => got no response")
+	}
+	select {
+	case out := <-open:
+		t.Errorf("watch without a snapshot => got %v, want none", out)
+	case out := <-unchanged:
+		t.Errorf("watch with an unknown cluster => got %v, want none", out)
+	default:
+	}
+
+	if got := c.GetStatusInfo("other").GetNumWatches(); got != 1 {
+		t.Errorf("moved status => got %d watches, want 1", got)
+	}
+	cancel()
+	if got := c.GetStatusInfo("other").GetNumWatches(); got != 0 {
+		t.Errorf("cancelled moved watch => got %d watches, want 0", got)
+	}
+	if got := c.GetStatusInfo("a").GetNumWatches(); got != 0 {
+		t.Errorf("previous status => got %d watches, want 0", got)
+	}
+}
@@ -15,14 +15,19 @@
 package cache
 
 import (
+	"sort"
+
 	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
 
 	cluster "github.com/envoyproxy/go-control-plane/envoy/api/v2"
 	endpoint "github.com/envoyproxy/go-control-plane/envoy/api/v2"
 	listener "github.com/envoyproxy/go-control-plane/envoy/api/v2"
 	route "github.com/envoyproxy/go-control-plane/envoy/api/v2"
 	auth "github.com/envoyproxy/go-control-plane/envoy/api/v2/auth"
+	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
 	hcm "github.com/envoyproxy/go-control-plane/envoy/config/filter/network/http_connection_manager/v2"
+	tcp "github.com/envoyproxy/go-control-plane/envoy/config/filter/network/tcp_proxy/v2"
 	runtime "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v2"
 	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
 	"github.com/envoyproxy/go-control-plane/pkg/resource/v2"
@@ -38,6 +43,8 @@ func GetResponseType(typeURL string) types.ResponseType {
 		return types.Cluster
 	case resource.RouteType:
 		return types.Route
+	case resource.ScopedRouteType:
+		return types.ScopedRoute
 	case resource.ListenerType:
 		return types.Listener
 	case resource.SecretType:
@@ -48,6 +55,27 @@ func GetResponseType(typeURL string) types.ResponseType {
 	return types.UnknownType
 }
 
+// GetResponseTypeURL returns the xDS type URL for a valid response type.
+func GetResponseTypeURL(typ types.ResponseType) string {
+	switch typ {
+	case types.Endpoint:
+		return resource.EndpointType
+	case types.Cluster:
+		return resource.ClusterType
+	case types.Route:
+		return resource.RouteType
+	case types.ScopedRoute:
+		return resource.ScopedRouteType
+	case types.Listener:
+		return resource.ListenerType
+	case types.Secret:
+		return resource.SecretType
+	case types.Runtime:
+		return resource.RuntimeType
+	}
+	return ""
+}
+
 // GetResourceName returns the resource name for a valid xDS response type.
 func GetResourceName(res types.Resource) string {
 	switch v := res.(type) {
@@ -57,6 +85,8 @@ func GetResourceName(res types.Resource) string {
 		return v.GetName()
 	case *route.RouteConfiguration:
 		return v.GetName()
+	case *route.ScopedRouteConfiguration:
+		return v.GetName()
 	case *listener.Listener:
 		return v.GetName()
 	case *auth.Secret:
@@ -81,7 +111,7 @@ func MarshalResource(resource types.Resource) (types.MarshaledResource, error) {
 }
 
 // GetResourceReferences returns the names for dependent resources (EDS cluster
-// names for CDS, RDS routes names for LDS).
+// names for CDS, RDS routes names for LDS and SRDS).
 func GetResourceReferences(resources map[string]types.Resource) map[string]bool {
 	out := make(map[string]bool)
 	for _, res := range resources {
@@ -107,6 +137,8 @@ func GetResourceReferences(resources map[string]types.Resource) map[string]bool
 			// References to clusters in both routes (and listeners) are not included
 			// in the result, because the clusters are retrieved in bulk currently,
 			// and not by name.
+		case *route.ScopedRouteConfiguration:
+			out[v.RouteConfigurationName] = true
 		case *listener.Listener:
 			// extract route configuration names from HTTP connection manager
 			for _, chain := range v.FilterChains {
@@ -124,6 +156,12 @@ func GetResourceReferences(resources map[string]types.Resource) map[string]bool
 					if rds, ok := config.RouteSpecifier.(*hcm.HttpConnectionManager_Rds); ok && rds != nil && rds.Rds != nil {
 						out[rds.Rds.RouteConfigName] = true
 					}
+
+					// the inline scopes reference the routes directly, while the
+					// scopes fetched over SRDS are listed in the snapshot
+					for _, scope := range config.GetScopedRoutes().GetScopedRouteConfigurationsList().GetScopedRouteConfigurations() {
+						out[scope.RouteConfigurationName] = true
+					}
 				}
 			}
 		case *runtime.Runtime:
@@ -132,3 +170,139 @@ func GetResourceReferences(resources map[string]types.Resource) map[string]bool
 	}
 	return out
 }
+
+// GetSecretReferences returns the names of the secrets referenced over SDS by
+// the TLS transport sockets of listeners and clusters. The result is indexed
+// by the secret name with the sorted names of the referencing resources.
+// Secrets without an SDS config source are static and not included.
+func GetSecretReferences(resources map[string]types.Resource) map[string][]string {
+	out := make(map[string][]string)
+	for name, res := range resources {
+		var secrets []string
+		switch v := res.(type) {
+		case *cluster.Cluster:
+			secrets = append(secrets, getTransportSocketSecrets(v.TransportSocket, &auth.UpstreamTlsContext{})...)
+			for _, match := range v.TransportSocketMatches {
+				secrets = append(secrets, getTransportSocketSecrets(match.TransportSocket, &auth.UpstreamTlsContext{})...)
+			}
+		case *listener.Listener:
+			for _, chain := range v.FilterChains {
+				secrets = append(secrets, getTransportSocketSecrets(chain.TransportSocket, &auth.DownstreamTlsContext{})...)
+			}
+		}
+		for _, secret := range secrets {
+			out[secret] = appendUnique(out[secret], name)
+		}
+	}
+	for _, names := range out {
+		sort.Strings(names)
+	}
+	return out
+}
+
+// GetClusterReferences returns the names of the clusters referenced by the
+// routes, by the inline routes of the listeners, and by the TCP proxy
+// listeners. The result is indexed by the cluster name with the sorted names
+// of the referencing resources.
+func GetClusterReferences(resources map[string]types.Resource) map[string][]string {
+	out := make(map[string][]string)
+	for name, res := range resources {
+		var clusters []string
+		switch v := res.(type) {
+		case *route.RouteConfiguration:
+			clusters = getRouteClusters(v)
+		case *listener.Listener:
+			for _, chain := range v.FilterChains {
+				for _, filter := range chain.Filters {
+					switch filter.Name {
+					case wellknown.HTTPConnectionManager:
+						config := resource.GetHTTPConnectionManager(filter)
+						clusters = append(clusters, getRouteClusters(config.GetRouteConfig())...)
+					case wellknown.TCPProxy:
+						config := &tcp.TcpProxy{}
+						if filter.GetTypedConfig() == nil || ptypes.UnmarshalAny(filter.GetTypedConfig(), config) != nil {
+							continue
+						}
+						if config.GetCluster() != "" {
+							clusters = append(clusters, config.GetCluster())
+						}
+						for _, weighted := range config.GetWeightedClusters().GetClusters() {
+							clusters = append(clusters, weighted.GetName())
+						}
+					}
+				}
+			}
+		}
+		for _, cluster := range clusters {
+			out[cluster] = appendUnique(out[cluster], name)
+		}
+	}
+	for _, names := range out {
+		sort.Strings(names)
+	}
+	return out
+}
+
+// getRouteClusters returns the destination and the mirror clusters of the
+// routes. The clusters selected by a request header are not included.
+func getRouteClusters(config *route.RouteConfiguration) []string {
+	var out []string
+	for _, host := range config.GetVirtualHosts() {
+		for _, r := range host.GetRoutes() {
+			action := r.GetRoute()
+			if action.GetCluster() != "" {
+				out = append(out, action.GetCluster())
+			}
+			for _, weighted := range action.GetWeightedClusters().GetClusters() {
+				out = append(out, weighted.GetName())
+			}
+			for _, mirror := range action.GetRequestMirrorPolicies() {
+				out = append(out, mirror.GetCluster())
+			}
+		}
+	}
+	return out
+}
+
+// tlsContext is implemented by both upstream and downstream TLS contexts.
+type tlsContext interface {
+	proto.Message
+	GetCommonTlsContext() *auth.CommonTlsContext
+}
+
+// getTransportSocketSecrets extracts the SDS secret names from a TLS transport socket.
+func getTransportSocketSecrets(socket *core.TransportSocket, tls tlsContext) []string {
+	config := socket.GetTypedConfig()
+	if config == nil || !ptypes.Is(config, tls) {
+		return nil
+	}
+	if err := ptypes.UnmarshalAny(config, tls); err != nil {
+		return nil
+	}
+
+	var out []string
+	add := func(sds *auth.SdsSecretConfig) {
+		if sds.GetSdsConfig() != nil && sds.GetName() != "" {
+			out = append(out, sds.GetName())
+		}
+	}
+	common := tls.GetCommonTlsContext()
+	for _, sds := range common.GetTlsCertificateSdsSecretConfigs() {
+		add(sds)
+	}
+	add(common.GetValidationContextSdsSecretConfig())
+	add(common.GetCombinedValidationContext().GetValidationContextSdsSecretConfig())
+	if downstream, ok := tls.(*auth.DownstreamTlsContext); ok {
+		add(downstream.GetSessionTicketKeysSdsSecretConfig())
+	}
+	return out
+}
+
+func appendUnique(names []string, name string) []string {
+	for _, existing := range names {
+		if existing == name {
+			return names
+		}
+	}
+	return append(names, name)
+}
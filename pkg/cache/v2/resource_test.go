@@ -128,6 +128,10 @@ func TestGetResourceReferences(t *testing.T) {
 			in:  testRoute,
 			out: map[string]bool{},
 		},
+		{
+			in:  &route.ScopedRouteConfiguration{Name: "scope0", RouteConfigurationName: routeName},
+			out: map[string]bool{routeName: true},
+		},
 		{
 			in:  testEndpoint,
 			out: map[string]bool{},
@@ -0,0 +1,42 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package cache
+
+import (
+	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
+)
+
+// WithRuntimes returns a copy of the snapshot with the runtime layers
+// replaced at a version, and the other types unchanged. The runtimes do not
+// reference the other types, so the copy is as consistent as the snapshot.
+// The signature of the snapshot is dropped since the digest changes.
+func (s *Snapshot) WithRuntimes(version string, runtimes []types.Resource) Snapshot {
+	out := *s
+	out.Resources[types.Runtime] = NewResources(version, runtimes)
+	out.Signature = nil
+	out.HealthOnly = false
+	return out
+}
+
+// UpdateRuntimes replaces the runtime layers in the snapshot of a node, so
+// that only the runtime watches of the node are responded. The update is not
+// atomic with the concurrent snapshot updates of the node.
+func UpdateRuntimes(cache SnapshotCache, node string, version string, runtimes ...types.Resource) error {
+	snapshot, err := cache.GetSnapshot(node)
+	if err != nil {
+		return err
+	}
+	return cache.SetSnapshot(node, snapshot.WithRuntimes(version, runtimes))
+}
@@ -0,0 +1,59 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package cache_test
+
+import (
+	"testing"
+
+	discovery "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/v2"
+	rsrc "github.com/envoyproxy/go-control-plane/pkg/resource/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/test/resource/v2"
+)
+
+func TestUpdateRuntimes(t *testing.T) {
+	c := cache.NewSnapshotCache(false, group{}, logger{t: t})
+	if err := cache.UpdateRuntimes(c, key, version2); err == nil {
+		t.Error("UpdateRuntimes() without a snapshot => got no error")
+	}
+	if err := c.SetSnapshot(key, snapshot); err != nil {
+		t.Fatal(err)
+	}
+	clusters, _ := c.CreateWatch(&discovery.DiscoveryRequest{TypeUrl: rsrc.ClusterType, VersionInfo: version})
+	runtimes, _ := c.CreateWatch(&discovery.DiscoveryRequest{TypeUrl: rsrc.RuntimeType, VersionInfo: version})
+
+	layer := resource.MakeRuntime("layer")
+	if err := cache.UpdateRuntimes(c, key, version2, layer); err != nil {
+		t.Fatal(err)
+	}
+	out := (<-runtimes).(*cache.RawResponse)
+	if out.Version != version2 || len(out.Resources) != 1 || out.Resources[0] != types.Resource(layer) {
+		t.Errorf("runtimes => got %v, want the layer at %q", out, version2)
+	}
+	select {
+	case out := <-clusters:
+		t.Errorf("clusters => got %v, want none", out)
+	default:
+	}
+
+	updated, _ := c.GetSnapshot(key)
+	if updated.GetVersion(rsrc.ClusterType) != version || len(updated.GetResources(rsrc.ClusterType)) != 1 {
+		t.Errorf("updated clusters => got %v, want unchanged", updated.GetResources(rsrc.ClusterType))
+	}
+	if snapshot.GetVersion(rsrc.RuntimeType) != version {
+		t.Errorf("original runtimes => got version %q, want %q", snapshot.GetVersion(rsrc.RuntimeType), version)
+	}
+}
@@ -0,0 +1,33 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package cache
+
+import (
+	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
+)
+
+// WithScopedRoutes returns a copy of the snapshot with the scoped route
+// configurations replaced at a version, and the other types unchanged. The
+// scopes reference the route configurations of the snapshot by name, so the
+// routes of new scopes must be added to the snapshot for it to stay
+// consistent. The signature of the snapshot is dropped since the digest
+// changes.
+func (s *Snapshot) WithScopedRoutes(version string, scopedRoutes []types.Resource) Snapshot {
+	out := *s
+	out.Resources[types.ScopedRoute] = NewResources(version, scopedRoutes)
+	out.Signature = nil
+	out.HealthOnly = false
+	return out
+}
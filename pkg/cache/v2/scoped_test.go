@@ -0,0 +1,57 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package cache_test
+
+import (
+	"testing"
+
+	route "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/v2"
+	rsrc "github.com/envoyproxy/go-control-plane/pkg/resource/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/test/resource/v2"
+)
+
+func TestScopedRoutes(t *testing.T) {
+	scope := &route.ScopedRouteConfiguration{Name: "tenant-a", RouteConfigurationName: "tenant-a-routes"}
+	routes := []types.Resource{testRoute, resource.MakeRoute("tenant-a-routes", clusterName)}
+	snap := cache.NewSnapshot("1",
+		[]types.Resource{testEndpoint},
+		[]types.Resource{testCluster},
+		routes,
+		[]types.Resource{testListener},
+		nil, nil)
+	snap = snap.WithScopedRoutes("1", []types.Resource{scope})
+
+	if err := snap.Consistent(); err != nil {
+		t.Errorf("Consistent() => got %v, want no error", err)
+	}
+	if err := snap.Validate(); err != nil {
+		t.Errorf("Validate() => got %v, want no error", err)
+	}
+	if got := snap.GetResources(rsrc.ScopedRouteType); len(got) != 1 || got["tenant-a"] != scope {
+		t.Errorf("GetResources(scoped routes) => got %v, want tenant-a", got)
+	}
+
+	dangling := snap.WithScopedRoutes("2", []types.Resource{scope, &route.ScopedRouteConfiguration{Name: "tenant-b", RouteConfigurationName: "tenant-b-routes"}})
+	if err := dangling.Consistent(); err == nil {
+		t.Error("Consistent() => got no error, want mismatched routes")
+	}
+	err := dangling.Validate()
+	verr, ok := err.(*cache.ValidationError)
+	if !ok || len(verr.Errors) != 1 || verr.Errors[0].TypeURL != rsrc.ScopedRouteType || verr.Errors[0].Reference != "tenant-b-routes" {
+		t.Errorf("Validate() => got %v, want missing tenant-b-routes", err)
+	}
+}
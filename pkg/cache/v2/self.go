@@ -0,0 +1,162 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	pstruct "github.com/golang/protobuf/ptypes/struct"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	runtime "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
+	"github.com/envoyproxy/go-control-plane/pkg/resource/v2"
+)
+
+// SelfConfig models the operational settings of the control plane itself,
+// e.g. the log level or the rate limits, as a runtime layer in the snapshot
+// of a dedicated node. The layer is served over RTDS like any other, so the
+// settings can be inspected and changed with the regular tooling, and it is
+// consumed through a watch on the cache like by any client, so the settings
+// change in the order of the snapshot versions.
+//
+// The node must not be served to the xDS clients, e.g. with
+// server.GuardSelfNode, and the stream limits of a server are applied with
+// server.HandleLimits.
+type SelfConfig struct {
+	// Cache serves the layer and is watched for its changes.
+	Cache SnapshotCache
+
+	// Node is the ID of the control plane node. The node hash of the cache
+	// must map a node with the ID to the same key.
+	Node string
+
+	// Layer is the name of the runtime layer.
+	Layer string
+
+	// set serializes the writers creating the snapshot of the node
+	set sync.Mutex
+
+	mu       sync.Mutex
+	handlers map[string][]func(*pstruct.Value)
+	applied  map[string]*pstruct.Value
+}
+
+// Handle registers a function called with the value of a layer field once
+// it changes, or with nil once the field is removed. The functions are
+// called in the watching goroutine, see Run.
+func (c *SelfConfig) Handle(key string, fn func(*pstruct.Value)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.handlers == nil {
+		c.handlers = make(map[string][]func(*pstruct.Value))
+	}
+	c.handlers[key] = append(c.handlers[key], fn)
+}
+
+// Set replaces the layer fields in the snapshot of the node, in place so that
+// the concurrent updates of the other types are kept. The version of the
+// layer is computed by the cache, see UpsertResources. The node gets a
+// snapshot with only the layer if it has none.
+func (c *SelfConfig) Set(fields map[string]*pstruct.Value) error {
+	c.set.Lock()
+	defer c.set.Unlock()
+	layer := []types.Resource{&runtime.Runtime{Name: c.Layer, Layer: &pstruct.Struct{Fields: fields}}}
+	if _, err := c.Cache.GetSnapshot(c.Node); err == nil {
+		return c.Cache.UpsertResources(c.Node, resource.RuntimeType, layer, nil)
+	}
+	version, err := resourcesVersion(map[string]types.Resource{c.Layer: layer[0]})
+	if err != nil {
+		return err
+	}
+	snapshot := Snapshot{}
+	return c.Cache.SetSnapshot(c.Node, snapshot.WithRuntimes(version, layer))
+}
+
+// Run watches the layer and calls the handlers of the changed fields until
+// the context is done or the watch is closed.
+func (c *SelfConfig) Run(ctx context.Context) error {
+	request := &Request{
+		Node:          &core.Node{Id: c.Node},
+		TypeUrl:       resource.RuntimeType,
+		ResourceNames: []string{c.Layer},
+	}
+	for {
+		value, cancel := c.Cache.CreateWatch(request)
+		var resp Response
+		var more bool
+		select {
+		case resp, more = <-value:
+		case <-ctx.Done():
+			if cancel != nil {
+				cancel()
+			}
+			return ctx.Err()
+		}
+		if !more {
+			return errors.New("runtime watch closed")
+		}
+
+		out, err := resp.GetDiscoveryResponse()
+		if err != nil {
+			return err
+		}
+		fields := map[string]*pstruct.Value{}
+		for _, res := range out.GetResources() {
+			layer := &runtime.Runtime{}
+			if err := ptypes.UnmarshalAny(res, layer); err != nil {
+				return err
+			}
+			if layer.GetName() == c.Layer {
+				fields = layer.GetLayer().GetFields()
+			}
+		}
+		c.apply(fields)
+
+		// the next watch responds to the next version
+		request = &Request{
+			Node:          request.Node,
+			TypeUrl:       request.TypeUrl,
+			ResourceNames: request.ResourceNames,
+			VersionInfo:   out.GetVersionInfo(),
+		}
+	}
+}
+
+// apply calls the handlers of the fields changed since the last layer.
+func (c *SelfConfig) apply(fields map[string]*pstruct.Value) {
+	c.mu.Lock()
+	var calls []func()
+	for key, handlers := range c.handlers {
+		value, previous := fields[key], c.applied[key]
+		if proto.Equal(value, previous) && (value == nil) == (previous == nil) {
+			continue
+		}
+		for _, fn := range handlers {
+			fn, value := fn, value
+			calls = append(calls, func() { fn(value) })
+		}
+	}
+	c.applied = fields
+	c.mu.Unlock()
+
+	for _, call := range calls {
+		call()
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package cache_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	pstruct "github.com/golang/protobuf/ptypes/struct"
+
+	"github.com/envoyproxy/go-control-plane/pkg/cache/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/log"
+)
+
+func TestSelfConfig(t *testing.T) {
+	self := &cache.SelfConfig{
+		Cache: cache.NewSnapshotCache(false, cache.IDHash{}, nil),
+		Node:  "control-plane",
+		Layer: "self",
+	}
+	logger := log.NewLevelLogger(log.LoggerFuncs{}, log.InfoLevel)
+	levels := make(chan *pstruct.Value, 10)
+	self.Handle("log.level", func(value *pstruct.Value) {
+		if level, err := log.ParseLevel(value.GetStringValue()); err == nil {
+			logger.SetLevel(level)
+		} else if value == nil {
+			logger.SetLevel(log.InfoLevel)
+		}
+		levels <- value
+	})
+	rates := make(chan *pstruct.Value, 10)
+	self.Handle("server.request_rate", func(value *pstruct.Value) {
+		rates <- value
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- self.Run(ctx)
+	}()
+
+	next := func(values chan *pstruct.Value) *pstruct.Value {
+		t.Helper()
+		select {
+		case value := <-values:
+			return value
+		case <-time.After(time.Second):
+			t.Fatal("handler was not called")
+			return nil
+		}
+	}
+	str := func(s string) *pstruct.Value {
+		return &pstruct.Value{Kind: &pstruct.Value_StringValue{StringValue: s}}
+	}
+	num := func(n float64) *pstruct.Value {
+		return &pstruct.Value{Kind: &pstruct.Value_NumberValue{NumberValue: n}}
+	}
+
+	if err := self.Set(map[string]*pstruct.Value{"log.level": str("debug")}); err != nil {
+		t.Fatal(err)
+	}
+	if got := next(levels).GetStringValue(); got != "debug" || logger.Level() != log.DebugLevel {
+		t.Errorf("log level => got %q and %v, want debug", got, logger.Level())
+	}
+
+	// only the handlers of the changed fields are called
+	if err := self.Set(map[string]*pstruct.Value{"log.level": str("debug"), "server.request_rate": num(10)}); err != nil {
+		t.Fatal(err)
+	}
+	if got := next(rates).GetNumberValue(); got != 10 {
+		t.Errorf("request rate => got %v, want 10", got)
+	}
+	select {
+	case value := <-levels:
+		t.Errorf("unchanged log level => got %v, want no call", value)
+	default:
+	}
+
+	if err := self.Set(map[string]*pstruct.Value{"server.request_rate": num(10)}); err != nil {
+		t.Fatal(err)
+	}
+	if got := next(levels); got != nil || logger.Level() != log.InfoLevel {
+		t.Errorf("removed log level => got %v and %v, want nil", got, logger.Level())
+	}
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("Run() => got %v, want %v", err, context.Canceled)
+	}
+}
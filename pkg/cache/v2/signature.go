@@ -0,0 +1,117 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package cache
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Signer produces a detached signature of a snapshot digest, e.g. with a key
+// held by a KMS or a keyless signing service.
+type Signer interface {
+	Sign(digest []byte) ([]byte, error)
+}
+
+// Verifier checks a detached signature of a snapshot digest.
+type Verifier interface {
+	Verify(digest []byte, signature []byte) error
+}
+
+// ErrInvalidSignature is returned for snapshots without a valid signature.
+var ErrInvalidSignature = errors.New("invalid snapshot signature")
+
+// Digest computes a SHA-256 digest over the versions and the deterministically
+// serialized resources of the snapshot. The signature and the version gates
+// are not covered.
+func (s *Snapshot) Digest() ([]byte, error) {
+	h := sha256.New()
+	write := func(b []byte) {
+		var size [8]byte
+		binary.BigEndian.PutUint64(size[:], uint64(len(b)))
+		h.Write(size[:])
+		h.Write(b)
+	}
+
+	for typ, resources := range s.Resources {
+		names := make([]string, 0, len(resources.Items))
+		for name := range resources.Items {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		write([]byte{byte(typ)})
+		write([]byte(resources.Version))
+		for _, name := range names {
+			marshaled, err := MarshalResource(resources.Items[name])
+			if err != nil {
+				return nil, fmt.Errorf("resource %q: %v", name, err)
+			}
+			write([]byte(name))
+			write(marshaled)
+		}
+	}
+	return h.Sum(nil), nil
+}
+
+// Sign sets the snapshot signature produced by the signer. The snapshot must
+// not be modified after signing.
+func (s *Snapshot) Sign(signer Signer) error {
+	digest, err := s.Digest()
+	if err != nil {
+		return err
+	}
+	signature, err := signer.Sign(digest)
+	if err != nil {
+		return err
+	}
+	s.Signature = signature
+	return nil
+}
+
+// VerifySignature checks the snapshot signature with the verifier.
+func (s *Snapshot) VerifySignature(verifier Verifier) error {
+	if len(s.Signature) == 0 {
+		return ErrInvalidSignature
+	}
+	digest, err := s.Digest()
+	if err != nil {
+		return err
+	}
+	return verifier.Verify(digest, s.Signature)
+}
+
+// Ed25519Signer signs snapshots with an Ed25519 private key.
+type Ed25519Signer ed25519.PrivateKey
+
+// Sign implements Signer.
+func (key Ed25519Signer) Sign(digest []byte) ([]byte, error) {
+	return ed25519.Sign(ed25519.PrivateKey(key), digest), nil
+}
+
+// Ed25519Verifier verifies snapshot signatures with an Ed25519 public key.
+type Ed25519Verifier ed25519.PublicKey
+
+// Verify implements Verifier.
+func (key Ed25519Verifier) Verify(digest []byte, signature []byte) error {
+	if !ed25519.Verify(ed25519.PublicKey(key), digest, signature) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
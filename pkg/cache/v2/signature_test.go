@@ -0,0 +1,56 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package cache_test
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"testing"
+
+	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/test/resource/v2"
+)
+
+func TestSnapshotSignature(t *testing.T) {
+	private := ed25519.NewKeyFromSeed(bytes.Repeat([]byte{1}, ed25519.SeedSize))
+	verifier := cache.Ed25519Verifier(private.Public().(ed25519.PublicKey))
+	c := cache.NewSnapshotCache(true, group{}, nil, cache.WithVerifier(verifier))
+
+	if err := c.SetSnapshot(key, snapshot); err == nil {
+		t.Error("expected unsigned snapshot to be rejected")
+	}
+
+	signed := cache.NewSnapshot(version, []types.Resource{testEndpoint}, []types.Resource{testCluster}, nil, nil, nil, nil)
+	if err := signed.Sign(cache.Ed25519Signer(private)); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SetSnapshot(key, signed); err != nil {
+		t.Errorf("SetSnapshot(signed) => got %v", err)
+	}
+	if snap, _ := c.GetSnapshot(key); !bytes.Equal(snap.Signature, signed.Signature) {
+		t.Errorf("GetSnapshot() signature => got %x, want %x", snap.Signature, signed.Signature)
+	}
+
+	// the signature does not cover the modified snapshot
+	tampered := signed
+	tampered.Resources[types.Endpoint] = cache.NewResources(version, []types.Resource{resource.MakeEndpoint(clusterName, 9090)})
+	if err := tampered.VerifySignature(verifier); err != cache.ErrInvalidSignature {
+		t.Errorf("VerifySignature(tampered) => got %v, want %v", err, cache.ErrInvalidSignature)
+	}
+	if err := c.SetSnapshot(key, tampered); err == nil {
+		t.Error("expected tampered snapshot to be rejected")
+	}
+}
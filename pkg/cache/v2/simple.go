@@ -17,10 +17,16 @@ package cache
 import (
 	"context"
 	"fmt"
+	"runtime/trace"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	discovery "github.com/envoyproxy/go-control-plane/envoy/api/v2"
 	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
 	"github.com/envoyproxy/go-control-plane/pkg/log"
 )
@@ -47,10 +53,18 @@ type SnapshotCache interface {
 	// the version differs from the snapshot version.
 	SetSnapshot(node string, snapshot Snapshot) error
 
-	// GetSnapshots gets the snapshot for a node.
+	// GetSnapshots gets the snapshot for a node. The snapshot shares its
+	// resources with the cache and must not be modified, see SnapshotBuilder.
 	GetSnapshot(node string) (Snapshot, error)
 
+	// UpsertResources updates the resources of a type in the snapshot of a
+	// node, without rebuilding the snapshot. Only the open watches of the
+	// type are responded.
+	UpsertResources(node string, typeURL string, resources []types.Resource, removed []string) error
+
 	// ClearSnapshot removes all status and snapshot information associated with a node.
+	// The open watches of the node are handled according to the clear mode, see
+	// WithClearMode.
 	ClearSnapshot(node string)
 
 	// GetStatusInfo retrieves status information for a node ID.
@@ -58,8 +72,34 @@ type SnapshotCache interface {
 
 	// GetStatusKeys retrieves node IDs for all statuses.
 	GetStatusKeys() []string
+
+	// GetUsage reports the approximate memory retained by the snapshots.
+	GetUsage(TenantFunc) Usage
+
+	// View returns an immutable point-in-time view of the snapshots and the
+	// statuses, to iterate over the nodes without blocking the updates.
+	View() View
+
+	// SetNodeHash replaces the node hash, e.g. on resharding, and moves the
+	// open watches to the node IDs of the new hash without closing the
+	// streams. It returns the number of watches moved.
+	SetNodeHash(NodeHash) int
+}
+
+// ResourceReader is implemented by the snapshot caches reading the resources
+// of a node without copying the snapshot.
+type ResourceReader interface {
+	// GetResource returns a resource of a type in the snapshot of a node. The
+	// resource is shared with the cache and must not be modified.
+	GetResource(node string, typeURL string, name string) (types.Resource, error)
+
+	// ListResourceNames returns the sorted names of the resources of a type in
+	// the snapshot of a node.
+	ListResourceNames(node string, typeURL string) ([]string, error)
 }
 
+var _ ResourceReader = &snapshotCache{}
+
 type snapshotCache struct {
 	// watchCount is an atomic counter incremented for each watch. This needs to
 	// be the first field in the struct to guarantee that it is 64-bit aligned,
@@ -78,9 +118,76 @@ type snapshotCache struct {
 	// status information for all nodes indexed by node IDs
 	status map[string]*statusInfo
 
+	// snapshotsShared and statusShared are set once the maps are shared with
+	// a view, see View
+	snapshotsShared bool
+	statusShared    bool
+
 	// hash is the hashing function for Envoy nodes
 	hash NodeHash
 
+	// movedWatches are the node IDs of the watches moved by SetNodeHash
+	// indexed by watch IDs
+	movedWatches map[int64]string
+
+	// verifier optionally checks the snapshot signatures
+	verifier Verifier
+
+	// admissions optionally veto or mutate the snapshots
+	admissions []Admission
+
+	// ownership optionally checks the owners of the upserted resources
+	ownership *Ownership
+
+	// responses optionally shares the marshaled responses across the nodes
+	responses *ResponseCache
+
+	// marshaled optionally shares the marshaled resources across the responses
+	marshaled *MarshalCache
+
+	// healthInterval optionally delays the health-only snapshot updates
+	healthInterval time.Duration
+
+	// healthUpdates are the delayed health-only updates indexed by node IDs
+	healthUpdates map[string]*time.Timer
+
+	// heartbeatInterval optionally refreshes the resource TTLs until the
+	// heartbeat context is done
+	heartbeatInterval time.Duration
+	heartbeatCtx      context.Context
+
+	// onNack is optionally called with the rejected versions
+	onNack NackFunc
+
+	// onAcked is optionally called with the propagation latencies
+	onAcked VersionAckedFunc
+
+	// versionUpdates are the times of the versions set by type URLs indexed
+	// by node IDs
+	versionUpdates map[string]map[string]*versionUpdate
+
+	// versions optionally replaces the versions of the snapshots
+	versions VersionProvider
+
+	// strictNames rejects the duplicate resource names within a type
+	strictNames bool
+
+	// featureChecks only sends the TTLs to the clients advertising them
+	featureChecks bool
+
+	// stableVersions keeps the versions of the unchanged types
+	stableVersions bool
+
+	// rollback reverts the rejected types to the resources last acknowledged
+	rollback bool
+
+	// clearMode handles the open watches of the cleared nodes
+	clearMode ClearMode
+
+	// ordered holds the responses until the earlier types are acknowledged,
+	// see WithOrderedADS
+	ordered bool
+
 	mu sync.RWMutex
 }
 
@@ -95,34 +202,227 @@ type snapshotCache struct {
 // is OK.
 //
 // Logger is optional.
-func NewSnapshotCache(ads bool, hash NodeHash, logger log.Logger) SnapshotCache {
-	return &snapshotCache{
-		log:       logger,
-		ads:       ads,
-		snapshots: make(map[string]Snapshot),
-		status:    make(map[string]*statusInfo),
-		hash:      hash,
+func NewSnapshotCache(ads bool, hash NodeHash, logger log.Logger, opts ...SnapshotCacheOption) SnapshotCache {
+	cache := &snapshotCache{
+		log:           logger,
+		ads:           ads,
+		snapshots:     make(map[string]Snapshot),
+		status:        make(map[string]*statusInfo),
+		hash:          hash,
+		movedWatches:  make(map[int64]string),
+		healthUpdates: make(map[string]*time.Timer),
+
+		versionUpdates: make(map[string]map[string]*versionUpdate),
+	}
+	for _, opt := range opts {
+		opt(cache)
+	}
+	if cache.heartbeatInterval > 0 {
+		go cache.sendHeartbeats()
+	}
+	return cache
+}
+
+// SnapshotCacheOption configures the snapshot cache.
+type SnapshotCacheOption func(*snapshotCache)
+
+// WithVerifier rejects the snapshots without a valid signature in SetSnapshot,
+// so that only the snapshots produced by a trusted pipeline are served.
+func WithVerifier(verifier Verifier) SnapshotCacheOption {
+	return func(cache *snapshotCache) {
+		cache.verifier = verifier
+	}
+}
+
+// WithResponseCache reuses the marshaled responses from the response cache.
+func WithResponseCache(responses *ResponseCache) SnapshotCacheOption {
+	return func(cache *snapshotCache) {
+		cache.responses = responses
+	}
+}
+
+// WithMarshalCache reuses the marshaled resources from the marshal cache, at
+// the version of their type. Unlike the response cache, the resources are
+// shared by the responses to different resource names. The resources are only
+// shared across the nodes with WithVersionProvider(HashVersions{}), since the
+// other versions may not identify the contents. The types with version gates
+// are not shared, since their resources vary by node. The resources removed
+// from the snapshots are forgotten.
+func WithMarshalCache(marshaled *MarshalCache) SnapshotCacheOption {
+	return func(cache *snapshotCache) {
+		cache.marshaled = marshaled
+	}
+}
+
+// WithHealthCoalescing delays the responses to the snapshots marked as
+// health-only by the interval, so that the flapping endpoints are batched in
+// a single response. The other snapshots are responded immediately, along with
+// any delayed health changes.
+func WithHealthCoalescing(interval time.Duration) SnapshotCacheOption {
+	return func(cache *snapshotCache) {
+		cache.healthInterval = interval
+	}
+}
+
+// WithHeartbeats refreshes the TTLs of the snapshot resources at every
+// interval until the context is done. The interval should be well under the
+// TTLs, so that the resources are not removed by the clients while the
+// snapshots are unchanged.
+func WithHeartbeats(ctx context.Context, interval time.Duration) SnapshotCacheOption {
+	return func(cache *snapshotCache) {
+		cache.heartbeatCtx = ctx
+		cache.heartbeatInterval = interval
+	}
+}
+
+// WithNackCallback calls the function with the versions rejected by the
+// nodes.
+func WithNackCallback(onNack NackFunc) SnapshotCacheOption {
+	return func(cache *snapshotCache) {
+		cache.onNack = onNack
+	}
+}
+
+// WithAutoRollback reverts the rejected type in the snapshot of a node to the
+// resources of the type the node last acknowledged. The other types keep
+// their current versions. The rollback lasts until the next SetSnapshot for
+// the node.
+func WithAutoRollback() SnapshotCacheOption {
+	return func(cache *snapshotCache) {
+		cache.rollback = true
+	}
+}
+
+// ClearMode defines what the clients with open watches receive once the
+// snapshot of their node is cleared.
+type ClearMode int
+
+const (
+	// ClearFreeze keeps the open watches without a response, so that the
+	// clients keep their configuration until the next snapshot of the node
+	// responds the watches.
+	ClearFreeze ClearMode = iota
+
+	// ClearSendEmpty responds the open watches with empty responses at
+	// ClearedVersion, so that the clients remove the listeners and the
+	// clusters, along with the resources they depend on. The named resources,
+	// e.g. the endpoints, are kept by the clients until then.
+	ClearSendEmpty
+
+	// ClearCloseWatches closes the open watches, so that the server closes the
+	// streams (or only fails the types with the type isolation) and the
+	// clients reconnect.
+	ClearCloseWatches
+)
+
+// ClearedVersion is the version of the empty responses sent by ClearSendEmpty.
+const ClearedVersion = "cleared"
+
+// WithClearMode sets how ClearSnapshot handles the open watches of the node,
+// ClearFreeze by default.
+func WithClearMode(mode ClearMode) SnapshotCacheOption {
+	return func(cache *snapshotCache) {
+		cache.clearMode = mode
 	}
 }
 
 // SetSnapshotCache updates a snapshot for a node.
 func (cache *snapshotCache) SetSnapshot(node string, snapshot Snapshot) error {
+	ctx, task := trace.NewTask(context.Background(), "xds.SetSnapshot")
+	defer task.End()
+	if trace.IsEnabled() {
+		trace.Log(ctx, "node", node)
+	}
+
+	if cache.verifier != nil {
+		if err := snapshot.VerifySignature(cache.verifier); err != nil {
+			return fmt.Errorf("snapshot for node %s: %v", node, err)
+		}
+	}
+	snapshot, err := cache.admit(ctx, node, snapshot)
+	if err != nil {
+		return err
+	}
+	if cache.strictNames {
+		if err := cache.checkSnapshotNames(node, &snapshot); err != nil {
+			return err
+		}
+	}
+
+	// the resources of the node are released once the cache is unlocked,
+	// since the ownership writes lock the cache
+	replaced := false
+	if cache.ownership != nil {
+		defer func() {
+			if replaced {
+				cache.ownership.release(node)
+			}
+		}()
+	}
 	cache.mu.Lock()
 	defer cache.mu.Unlock()
 
+	if err := cache.provideVersions(node, &snapshot); err != nil {
+		return err
+	}
+	if cache.stableVersions {
+		cache.stabilizeVersions(node, &snapshot)
+	}
+
 	// update the existing entry
-	cache.snapshots[node] = snapshot
+	previous := cache.snapshots[node]
+	cache.forgetMarshaled(node, &previous, &snapshot)
+	cache.mutableSnapshots()[node] = snapshot
+	cache.recordVersions(node, &snapshot)
+	replaced = true
+
+	// delay the health-only updates, once for a batch
+	if cache.healthInterval > 0 && snapshot.HealthOnly {
+		if _, pending := cache.healthUpdates[node]; !pending {
+			cache.healthUpdates[node] = time.AfterFunc(cache.healthInterval, func() {
+				cache.flushHealthUpdates(node)
+			})
+		}
+		return nil
+	}
+	if timer, pending := cache.healthUpdates[node]; pending {
+		timer.Stop()
+		delete(cache.healthUpdates, node)
+	}
+
+	defer trace.StartRegion(ctx, "xds.fanout").End()
+	cache.respondWatches(node, snapshot)
+	return nil
+}
+
+// flushHealthUpdates responds with the latest snapshot after the delay.
+func (cache *snapshotCache) flushHealthUpdates(node string) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
 
-	// trigger existing watches for which version changed
+	delete(cache.healthUpdates, node)
+	if snapshot, exists := cache.snapshots[node]; exists {
+		cache.respondWatches(node, snapshot)
+	}
+}
+
+// respondWatches triggers the existing watches for which the version changed.
+func (cache *snapshotCache) respondWatches(node string, snapshot Snapshot) {
 	if info, ok := cache.status[node]; ok {
 		info.mu.Lock()
+		groups := make(responseGroups)
 		for id, watch := range info.watches {
 			version := snapshot.GetVersion(watch.Request.TypeUrl)
 			if version != watch.Request.VersionInfo {
+				if cache.ordered && info.held(&snapshot, watch.Request.TypeUrl) {
+					continue
+				}
 				if cache.log != nil {
 					cache.log.Debugf("respond open watch %d%v with new version %q", id, watch.Request.ResourceNames, version)
 				}
-				cache.respond(watch.Request, watch.Response, snapshot.GetResources(watch.Request.TypeUrl), version)
+				if cache.respondGroup(watch.Request, watch.Response, &snapshot, version, groups) {
+					info.sent[watch.Request.TypeUrl] = version
+				}
 
 				// discard the watch
 				delete(info.watches, id)
@@ -130,8 +430,6 @@ func (cache *snapshotCache) SetSnapshot(node string, snapshot Snapshot) error {
 		}
 		info.mu.Unlock()
 	}
-
-	return nil
 }
 
 // GetSnapshots gets the snapshot for a node, and returns an error if not found.
@@ -146,13 +444,97 @@ func (cache *snapshotCache) GetSnapshot(node string) (Snapshot, error) {
 	return snap, nil
 }
 
+// GetResource returns a resource of a type in the snapshot of a node.
+func (cache *snapshotCache) GetResource(node string, typeURL string, name string) (types.Resource, error) {
+	typ := GetResponseType(typeURL)
+	if typ == types.UnknownType {
+		return nil, fmt.Errorf("unknown type URL %q", typeURL)
+	}
+
+	cache.mu.RLock()
+	defer cache.mu.RUnlock()
+
+	snap, ok := cache.snapshots[node]
+	if !ok {
+		return nil, fmt.Errorf("no snapshot found for node %s", node)
+	}
+	res, ok := snap.Resources[typ].Items[name]
+	if !ok {
+		return nil, fmt.Errorf("no resource %q of %s for node %s", name, typeURL, node)
+	}
+	return res, nil
+}
+
+// ListResourceNames returns the sorted names of the resources of a type in
+// the snapshot of a node.
+func (cache *snapshotCache) ListResourceNames(node string, typeURL string) ([]string, error) {
+	typ := GetResponseType(typeURL)
+	if typ == types.UnknownType {
+		return nil, fmt.Errorf("unknown type URL %q", typeURL)
+	}
+
+	cache.mu.RLock()
+	defer cache.mu.RUnlock()
+
+	snap, ok := cache.snapshots[node]
+	if !ok {
+		return nil, fmt.Errorf("no snapshot found for node %s", node)
+	}
+	items := snap.Resources[typ].Items
+	names := make([]string, 0, len(items))
+	for name := range items {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
 // ClearSnapshot clears snapshot and info for a node.
 func (cache *snapshotCache) ClearSnapshot(node string) {
+	if cache.ownership != nil {
+		defer cache.ownership.release(node)
+	}
 	cache.mu.Lock()
 	defer cache.mu.Unlock()
 
-	delete(cache.snapshots, node)
-	delete(cache.status, node)
+	if previous, exists := cache.snapshots[node]; exists {
+		cache.forgetMarshaled(node, &previous, &Snapshot{})
+	}
+	delete(cache.mutableSnapshots(), node)
+	delete(cache.versionUpdates, node)
+	if timer, pending := cache.healthUpdates[node]; pending {
+		timer.Stop()
+		delete(cache.healthUpdates, node)
+	}
+
+	info, ok := cache.status[node]
+	if !ok {
+		return
+	}
+	info.mu.Lock()
+	defer info.mu.Unlock()
+	switch cache.clearMode {
+	case ClearSendEmpty:
+		cleared := NewSnapshot(ClearedVersion, nil, nil, nil, nil, nil, nil)
+		for id, watch := range info.watches {
+			cache.respond(watch.Request, watch.Response, &cleared, ClearedVersion)
+			delete(info.watches, id)
+		}
+	case ClearCloseWatches:
+		for id, watch := range info.watches {
+			close(watch.Response)
+			delete(info.watches, id)
+		}
+	}
+
+	// the frozen watches are kept in a status without the acknowledgements
+	if len(info.watches) == 0 {
+		delete(cache.mutableStatus(), node)
+		return
+	}
+	info.sent = make(map[string]string)
+	info.acked = make(map[string]Snapshot)
+	info.ackStatus = make(map[string]AckStatus)
 }
 
 // nameSet creates a map from a string slice to value true.
@@ -176,15 +558,18 @@ func superset(names map[string]bool, resources map[string]types.Resource) error
 
 // CreateWatch returns a watch for an xDS request.
 func (cache *snapshotCache) CreateWatch(request *Request) (chan Response, func()) {
-	nodeID := cache.hash.ID(request.Node)
+	cache.trackAck(cache.nodeID(request.Node), request)
 
 	cache.mu.Lock()
 	defer cache.mu.Unlock()
 
+	// the hash may change concurrently, see SetNodeHash
+	nodeID := cache.hash.ID(request.Node)
+
 	info, ok := cache.status[nodeID]
 	if !ok {
 		info = newStatusInfo(request.Node)
-		cache.status[nodeID] = info
+		cache.mutableStatus()[nodeID] = info
 	}
 
 	// update last watch request time
@@ -198,8 +583,26 @@ func (cache *snapshotCache) CreateWatch(request *Request) (chan Response, func()
 	snapshot, exists := cache.snapshots[nodeID]
 	version := snapshot.GetVersion(request.TypeUrl)
 
-	// if the requested version is up-to-date or missing a response, leave an open watch
-	if !exists || request.VersionInfo == version {
+	// the initial request at the current version acknowledges it
+	initial := exists && request.ResponseNonce == "" && request.ErrorDetail == nil &&
+		request.VersionInfo != "" && request.VersionInfo == version
+	if initial {
+		info.mu.Lock()
+		info.ackInitial(snapshot, request)
+		info.mu.Unlock()
+	}
+
+	// an acknowledgement may release the held responses of the later types
+	if exists && cache.ordered && (request.ResponseNonce != "" || initial) && isOrdered(request.TypeUrl) {
+		defer cache.respondWatches(nodeID, snapshot)
+	}
+
+	// if the requested version is up-to-date or missing a response, leave an
+	// open watch, as well as for a held response
+	info.mu.RLock()
+	held := exists && cache.ordered && info.held(&snapshot, request.TypeUrl)
+	info.mu.RUnlock()
+	if !exists || request.VersionInfo == version || held {
 		watchID := cache.nextWatchID()
 		if cache.log != nil {
 			cache.log.Debugf("open watch %d for %s%v from nodeID %q, version %q", watchID,
@@ -212,7 +615,11 @@ func (cache *snapshotCache) CreateWatch(request *Request) (chan Response, func()
 	}
 
 	// otherwise, the watch may be responded immediately
-	cache.respond(request, value, snapshot.GetResources(request.TypeUrl), version)
+	if cache.respond(request, value, &snapshot, version) {
+		info.mu.Lock()
+		info.sent[request.TypeUrl] = version
+		info.mu.Unlock()
+	}
 
 	return value, nil
 }
@@ -227,6 +634,10 @@ func (cache *snapshotCache) cancelWatch(nodeID string, watchID int64) func() {
 		// uses the cache mutex
 		cache.mu.Lock()
 		defer cache.mu.Unlock()
+		if moved, ok := cache.movedWatches[watchID]; ok {
+			nodeID = moved
+			delete(cache.movedWatches, watchID)
+		}
 		if info, ok := cache.status[nodeID]; ok {
 			info.mu.Lock()
 			delete(info.watches, watchID)
@@ -235,17 +646,95 @@ func (cache *snapshotCache) cancelWatch(nodeID string, watchID int64) func() {
 	}
 }
 
+func (cache *snapshotCache) sendHeartbeats() {
+	if ttlField == nil {
+		return
+	}
+	ticker := time.NewTicker(cache.heartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-cache.heartbeatCtx.Done():
+			return
+		case <-ticker.C:
+			cache.respondHeartbeats()
+		}
+	}
+}
+
+// respondHeartbeats responds to the up-to-date watches with the resources
+// having a TTL, without their contents.
+func (cache *snapshotCache) respondHeartbeats() {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	for node, info := range cache.status {
+		snapshot, exists := cache.snapshots[node]
+		if !exists {
+			continue
+		}
+		info.mu.Lock()
+		for id, watch := range info.watches {
+			ttls := cache.resourceTTLs(watch.Request, &snapshot)
+			version := snapshot.GetVersion(watch.Request.TypeUrl)
+			if len(ttls) == 0 || watch.Request.VersionInfo != version {
+				continue
+			}
+			resources := make(map[string]types.Resource, len(ttls))
+			for name, resource := range snapshot.GetResourcesForNode(watch.Request.TypeUrl, watch.Request.Node) {
+				if _, exists := ttls[name]; exists {
+					resources[name] = resource
+				}
+			}
+			out := createResponse(watch.Request, resources, version)
+			if len(out.Resources) == 0 {
+				continue
+			}
+			out.TTLs = ttls
+			out.Heartbeat = true
+			watch.Response <- out
+			delete(info.watches, id)
+		}
+		info.mu.Unlock()
+	}
+}
+
 // Respond to a watch with the snapshot value. The value channel should have capacity not to block.
+// Returns false if the watch is not responded.
 // TODO(kuat) do not respond always, see issue https://github.com/envoyproxy/go-control-plane/issues/46
-func (cache *snapshotCache) respond(request *Request, value chan Response, resources map[string]types.Resource, version string) {
+func (cache *snapshotCache) respond(request *Request, value chan Response, snapshot *Snapshot, version string) bool {
+	return cache.respondGroup(request, value, snapshot, version, nil)
+}
+
+// respondGroup responds to a watch of a fan-out, sharing the response with
+// the other watches of its group.
+func (cache *snapshotCache) respondGroup(request *Request, value chan Response, snapshot *Snapshot, version string, groups responseGroups) bool {
+	key, coalesced := groups.coalesce(request, snapshot, version, len(cache.resourceTTLs(request, snapshot)) > 0)
+	if group, exists := groups[key]; coalesced && exists {
+		if group.held {
+			return false
+		}
+		value <- cache.groupResponse(request, snapshot, group, version)
+		return true
+	}
+
+	resources := snapshot.GetResourcesForNode(request.TypeUrl, request.Node)
+	resources = resolveVariants(resources, snapshot.GetVariants(request.TypeUrl), request.ResourceNames)
+
 	// for ADS, the request names must match the snapshot names
 	// if they do not, then the watch is never responded, and it is expected that envoy makes another request
 	if len(request.ResourceNames) != 0 && cache.ads {
-		if err := superset(nameSet(request.ResourceNames), resources); err != nil {
-			if cache.log != nil {
-				cache.log.Debugf("ADS mode: not responding to request: %v", err)
+		matcher := newNameMatcher(request.ResourceNames)
+		for name := range resources {
+			if !matcher.matches(name) {
+				if cache.log != nil {
+					cache.log.Debugf("ADS mode: not responding to request: %q not listed", name)
+				}
+				if coalesced {
+					groups[key] = &responseGroup{held: true}
+				}
+				return false
 			}
-			return
 		}
 	}
 	if cache.log != nil {
@@ -253,19 +742,68 @@ func (cache *snapshotCache) respond(request *Request, value chan Response, resou
 			request.TypeUrl, request.ResourceNames, request.VersionInfo, version)
 	}
 
-	value <- createResponse(request, resources, version)
+	out := cache.createResponse(request, snapshot, resources, version)
+	if raw, ok := out.(*RawResponse); ok && coalesced && raw.err == nil {
+		raw.group = &responseGroup{resources: raw.Resources}
+		groups[key] = raw.group
+	}
+	value <- out
+	return true
 }
 
-func createResponse(request *Request, resources map[string]types.Resource, version string) Response {
+// createResponse reuses the marshaled resources from the response and the
+// marshal caches if they are set. Types with version gates use neither since
+// the resources vary by node, and types with TTLs skip the response cache.
+func (cache *snapshotCache) createResponse(request *Request, snapshot *Snapshot, resources map[string]types.Resource, version string) Response {
+	out := createResponse(request, resources, version)
+	gated := len(snapshot.Resources[GetResponseType(request.TypeUrl)].Gates) > 0
+	if !gated {
+		out.Marshaled = cache.marshaled
+		out.marshalScope = cache.marshalScope(cache.hash.ID(request.Node), snapshot)
+	}
+	if cache.strictNames {
+		if out.err = cache.checkResponseNames(request, resources, out.Resources); out.err != nil {
+			return out
+		}
+	}
+	if ttls := cache.resourceTTLs(request, snapshot); len(ttls) > 0 {
+		out.TTLs = ttls
+		return out
+	}
+	if cache.responses == nil || gated {
+		return out
+	}
+
+	key := responseKey(request, version)
+	marshaled, exists := cache.responses.get(key)
+	if !exists {
+		resp, err := out.GetDiscoveryResponse()
+		if err != nil {
+			return out
+		}
+		marshaled = resp.Resources
+		cache.responses.add(key, marshaled)
+	}
+	return &PassthroughResponse{
+		Request: request,
+		DiscoveryResponse: &discovery.DiscoveryResponse{
+			VersionInfo: version,
+			Resources:   marshaled,
+			TypeUrl:     request.TypeUrl,
+		},
+	}
+}
+
+func createResponse(request *Request, resources map[string]types.Resource, version string) *RawResponse {
 	filtered := make([]types.Resource, 0, len(resources))
 
 	// Reply only with the requested resources. Envoy may ask each resource
 	// individually in a separate stream. It is ok to reply with the same version
 	// on separate streams since requests do not share their response versions.
 	if len(request.ResourceNames) != 0 {
-		set := nameSet(request.ResourceNames)
+		matcher := newNameMatcher(request.ResourceNames)
 		for name, resource := range resources {
-			if set[name] {
+			if matcher.matches(name) {
 				filtered = append(filtered, resource)
 			}
 		}
@@ -284,12 +822,13 @@ func createResponse(request *Request, resources map[string]types.Resource, versi
 
 // Fetch implements the cache fetch function.
 // Fetch is called on multiple streams, so responding to individual names with the same version works.
+// The nodes without a snapshot get a NotFound error.
 func (cache *snapshotCache) Fetch(ctx context.Context, request *Request) (Response, error) {
-	nodeID := cache.hash.ID(request.Node)
-
 	cache.mu.RLock()
 	defer cache.mu.RUnlock()
 
+	nodeID := cache.hash.ID(request.Node)
+
 	if snapshot, exists := cache.snapshots[nodeID]; exists {
 		// Respond only if the request version is distinct from the current snapshot state.
 		// It might be beneficial to hold the request since Envoy will re-attempt the refresh.
@@ -301,12 +840,13 @@ func (cache *snapshotCache) Fetch(ctx context.Context, request *Request) (Respon
 			return nil, &types.SkipFetchError{}
 		}
 
-		resources := snapshot.GetResources(request.TypeUrl)
-		out := createResponse(request, resources, version)
+		resources := snapshot.GetResourcesForNode(request.TypeUrl, request.Node)
+		resources = resolveVariants(resources, snapshot.GetVariants(request.TypeUrl), request.ResourceNames)
+		out := cache.createResponse(request, &snapshot, resources, version)
 		return out, nil
 	}
 
-	return nil, fmt.Errorf("missing snapshot for %q", nodeID)
+	return nil, status.Errorf(codes.NotFound, "missing snapshot for %q", nodeID)
 }
 
 // GetStatusInfo retrieves the status info for the node.
@@ -21,6 +21,9 @@ import (
 	"testing"
 	"time"
 
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/duration"
+
 	discovery "github.com/envoyproxy/go-control-plane/envoy/api/v2"
 	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
 	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
@@ -275,3 +278,196 @@ func TestSnapshotClear(t *testing.T) {
 		t.Errorf("keys should be empty")
 	}
 }
+
+func TestSnapshotClearModes(t *testing.T) {
+	for _, mode := range []cache.ClearMode{cache.ClearFreeze, cache.ClearSendEmpty, cache.ClearCloseWatches} {
+		c := cache.NewSnapshotCache(true, group{}, logger{t: t}, cache.WithClearMode(mode))
+		if err := c.SetSnapshot(key, snapshot); err != nil {
+			t.Fatal(err)
+		}
+		value, _ := c.CreateWatch(&discovery.DiscoveryRequest{TypeUrl: rsrc.ClusterType, VersionInfo: version})
+		c.ClearSnapshot(key)
+
+		switch mode {
+		case cache.ClearFreeze:
+			select {
+			case out := <-value:
+				t.Errorf("frozen watch => got %v, want none", out)
+			default:
+			}
+			if info := c.GetStatusInfo(key); info == nil || info.GetNumWatches() != 1 {
+				t.Errorf("frozen status => got %v, want the open watch", info)
+			}
+			if err := c.SetSnapshot(key, cache.NewSnapshot(version2, nil, []types.Resource{testCluster}, nil, nil, nil, nil)); err != nil {
+				t.Fatal(err)
+			}
+			if out := <-value; out.(*cache.RawResponse).Version != version2 {
+				t.Errorf("frozen watch after a snapshot => got %v, want version %q", out, version2)
+			}
+		case cache.ClearSendEmpty:
+			out := (<-value).(*cache.RawResponse)
+			if out.Version != cache.ClearedVersion || len(out.Resources) != 0 {
+				t.Errorf("cleared watch => got %v, want an empty response at %q", out, cache.ClearedVersion)
+			}
+			if info := c.GetStatusInfo(key); info != nil {
+				t.Errorf("cleared status => got %v, want none", info)
+			}
+		case cache.ClearCloseWatches:
+			if _, more := <-value; more {
+				t.Error("closed watch => got a response, want closed")
+			}
+			if info := c.GetStatusInfo(key); info != nil {
+				t.Errorf("cleared status => got %v, want none", info)
+			}
+		}
+	}
+}
+
+func TestSnapshotCacheHealthCoalescing(t *testing.T) {
+	c := cache.NewSnapshotCache(true, group{}, logger{t: t}, cache.WithHealthCoalescing(100*time.Millisecond))
+	if err := c.SetSnapshot(key, snapshot); err != nil {
+		t.Fatal(err)
+	}
+	watch := func(v string) chan cache.Response {
+		value, _ := c.CreateWatch(&discovery.DiscoveryRequest{TypeUrl: rsrc.EndpointType, ResourceNames: names[rsrc.EndpointType], VersionInfo: v})
+		return value
+	}
+	health := func(v string, port uint32) cache.Snapshot {
+		out := snapshot
+		out.Resources[types.Endpoint] = cache.NewResources(v, []types.Resource{resource.MakeEndpoint(clusterName, port)})
+		out.HealthOnly = true
+		return out
+	}
+
+	// the health-only updates are batched in one response with the latest
+	value := watch(version)
+	start := time.Now()
+	for i, v := range []string{"h1", "h2", "h3"} {
+		if err := c.SetSnapshot(key, health(v, uint32(9000+i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	select {
+	case out := <-value:
+		if gotVersion, _ := out.GetVersion(); gotVersion != "h3" || time.Since(start) < 100*time.Millisecond {
+			t.Errorf("health-only response => got version %q after %v, want h3 after the interval", gotVersion, time.Since(start))
+		}
+	case <-time.After(time.Second):
+		t.Fatal("failed to receive health-only response")
+	}
+
+	// a topology update flushes the pending health changes immediately
+	value = watch("h3")
+	if err := c.SetSnapshot(key, health("h4", 9004)); err != nil {
+		t.Fatal(err)
+	}
+	topology := snapshot
+	topology.Resources[types.Endpoint] = cache.NewResources("t1", []types.Resource{resource.MakeEndpoint(clusterName, 9005)})
+	if err := c.SetSnapshot(key, topology); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case out := <-value:
+		if gotVersion, _ := out.GetVersion(); gotVersion != "t1" {
+			t.Errorf("topology response => got version %q, want t1", gotVersion)
+		}
+	default:
+		t.Fatal("failed to receive topology response immediately")
+	}
+}
+
+func TestSnapshotCacheGetResource(t *testing.T) {
+	c := cache.NewSnapshotCache(false, group{}, logger{t: t})
+	reader := c.(cache.ResourceReader)
+	if _, err := reader.GetResource(key, rsrc.ClusterType, clusterName); err == nil {
+		t.Error("GetResource() without a snapshot => got no error")
+	}
+	if err := c.SetSnapshot(key, snapshot); err != nil {
+		t.Fatal(err)
+	}
+	if res, err := reader.GetResource(key, rsrc.ClusterType, clusterName); err != nil || res != testCluster {
+		t.Errorf("GetResource() => got %v, %v, want %s", res, err, clusterName)
+	}
+	if _, err := reader.GetResource(key, rsrc.ClusterType, "missing"); err == nil {
+		t.Error("GetResource() of a missing resource => got no error")
+	}
+	if _, err := reader.GetResource(key, "unknown", clusterName); err == nil {
+		t.Error("GetResource() of an unknown type => got no error")
+	}
+	if names, err := reader.ListResourceNames(key, rsrc.ClusterType); err != nil || !reflect.DeepEqual(names, []string{clusterName}) {
+		t.Errorf("ListResourceNames() => got %v, %v, want [%s]", names, err, clusterName)
+	}
+	if names, err := reader.ListResourceNames(key, rsrc.ScopedRouteType); err != nil || len(names) != 0 {
+		t.Errorf("ListResourceNames() of an empty type => got %v, %v, want none", names, err)
+	}
+}
+
+func TestSnapshotCacheHeartbeats(t *testing.T) {
+	ttl := time.Minute
+	withTTL := cache.NewSnapshotWithTTLs(version,
+		[]types.ResourceWithTTL{{Resource: testEndpoint, TTL: &ttl}},
+		[]types.ResourceWithTTL{{Resource: testCluster}},
+		nil, nil, nil, nil)
+	if got := withTTL.GetTTLs(rsrc.EndpointType); !reflect.DeepEqual(got, map[string]time.Duration{clusterName: ttl}) {
+		t.Errorf("GetTTLs() => got %v, want %s TTL", got, clusterName)
+	}
+	if got := withTTL.GetTTLs(rsrc.ClusterType); got != nil {
+		t.Errorf("GetTTLs() => got %v, want none", got)
+	}
+
+	// the v2 resource envelope has no TTL field
+	ttlField := (&discovery.Resource{}).ProtoReflect().Descriptor().Fields().ByName("ttl")
+	if ttlField == nil {
+		t.Skip("resource TTLs are not supported")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c := cache.NewSnapshotCache(false, group{}, logger{t: t}, cache.WithHeartbeats(ctx, 10*time.Millisecond))
+	if err := c.SetSnapshot(key, withTTL); err != nil {
+		t.Fatal(err)
+	}
+	unwrap := func(out cache.Response) *discovery.Resource {
+		resp, err := out.GetDiscoveryResponse()
+		if err != nil || len(resp.Resources) != 1 {
+			t.Fatalf("GetDiscoveryResponse() => got %v, %v", resp, err)
+		}
+		wrapper := &discovery.Resource{}
+		if err := ptypes.UnmarshalAny(resp.Resources[0], wrapper); err != nil {
+			t.Fatal(err)
+		}
+		got, err := ptypes.Duration(wrapper.ProtoReflect().Get(ttlField).Message().Interface().(*duration.Duration))
+		if err != nil || wrapper.Name != clusterName || got != ttl {
+			t.Errorf("wrapped resource => got %v, want %s with TTL %v", wrapper, clusterName, ttl)
+		}
+		return wrapper
+	}
+
+	// the resources are wrapped with their TTLs
+	value, _ := c.CreateWatch(&discovery.DiscoveryRequest{TypeUrl: rsrc.EndpointType, ResourceNames: names[rsrc.EndpointType]})
+	if wrapper := unwrap(<-value); wrapper.Resource == nil {
+		t.Error("response => got no resource, want the endpoint")
+	}
+
+	// the up-to-date watches receive heartbeats without the resources
+	value, _ = c.CreateWatch(&discovery.DiscoveryRequest{TypeUrl: rsrc.EndpointType, ResourceNames: names[rsrc.EndpointType], VersionInfo: version})
+	select {
+	case out := <-value:
+		if gotVersion, _ := out.GetVersion(); gotVersion != version {
+			t.Errorf("heartbeat => got version %q, want %q", gotVersion, version)
+		}
+		if wrapper := unwrap(out); wrapper.Resource != nil {
+			t.Errorf("heartbeat => got resource %v, want none", wrapper.Resource)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("failed to receive heartbeat")
+	}
+
+	// the types without TTLs receive no heartbeats
+	value, _ = c.CreateWatch(&discovery.DiscoveryRequest{TypeUrl: rsrc.ClusterType, VersionInfo: version})
+	select {
+	case out := <-value:
+		t.Errorf("cluster heartbeat => got %v, want none", out)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
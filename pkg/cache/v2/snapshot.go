@@ -17,7 +17,10 @@ package cache
 import (
 	"errors"
 	"fmt"
+	"sort"
+	"time"
 
+	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
 	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
 )
 
@@ -28,6 +31,18 @@ type Resources struct {
 
 	// Items in the group indexed by name.
 	Items map[string]types.Resource
+
+	// Gates are the optional client version requirements indexed by name.
+	Gates map[string]VersionGate
+
+	// TTLs are the optional resource time-to-live values indexed by name.
+	// The TTLs are only sent to the clients of the v3 API, since the resource
+	// envelope of the v2 API has no TTL.
+	TTLs map[string]time.Duration
+
+	// Variants are the optional xdstp resource variant sets indexed by the
+	// name without context params, see Variant.
+	Variants map[string][]Variant
 }
 
 // IndexResourcesByName creates a map from the resource name to the resource.
@@ -47,11 +62,38 @@ func NewResources(version string, items []types.Resource) Resources {
 	}
 }
 
+// NewResourcesWithTTL creates a new resource group with the resource TTLs.
+func NewResourcesWithTTL(version string, items []types.ResourceWithTTL) Resources {
+	out := Resources{
+		Version: version,
+		Items:   make(map[string]types.Resource, len(items)),
+	}
+	for _, item := range items {
+		name := GetResourceName(item.Resource)
+		out.Items[name] = item.Resource
+		if item.TTL != nil {
+			if out.TTLs == nil {
+				out.TTLs = make(map[string]time.Duration)
+			}
+			out.TTLs[name] = *item.TTL
+		}
+	}
+	return out
+}
+
 // Snapshot is an internally consistent snapshot of xDS resources.
 // Consistency is important for the convergence as different resource types
 // from the snapshot may be delivered to the proxy in arbitrary order.
 type Snapshot struct {
 	Resources [types.UnknownType]Resources
+
+	// Signature is the optional detached signature of the snapshot digest.
+	Signature []byte
+
+	// HealthOnly marks the snapshot as only changing the endpoint health
+	// statuses from the previous snapshot of the node. The responses to such
+	// snapshots may be delayed, see WithHealthCoalescing.
+	HealthOnly bool
 }
 
 // NewSnapshot creates a snapshot from response types and a version.
@@ -72,10 +114,29 @@ func NewSnapshot(version string,
 	return out
 }
 
+// NewSnapshotWithTTLs creates a snapshot of resources with TTLs from response
+// types and a version.
+func NewSnapshotWithTTLs(version string,
+	endpoints []types.ResourceWithTTL,
+	clusters []types.ResourceWithTTL,
+	routes []types.ResourceWithTTL,
+	listeners []types.ResourceWithTTL,
+	runtimes []types.ResourceWithTTL,
+	secrets []types.ResourceWithTTL) Snapshot {
+	out := Snapshot{}
+	out.Resources[types.Endpoint] = NewResourcesWithTTL(version, endpoints)
+	out.Resources[types.Cluster] = NewResourcesWithTTL(version, clusters)
+	out.Resources[types.Route] = NewResourcesWithTTL(version, routes)
+	out.Resources[types.Listener] = NewResourcesWithTTL(version, listeners)
+	out.Resources[types.Runtime] = NewResourcesWithTTL(version, runtimes)
+	out.Resources[types.Secret] = NewResourcesWithTTL(version, secrets)
+	return out
+}
+
 // Consistent check verifies that the dependent resources are exactly listed in the
 // snapshot:
 // - all EDS resources are listed by name in CDS resources
-// - all RDS resources are listed by name in LDS resources
+// - all RDS resources are listed by name in LDS or SRDS resources
 //
 // Note that clusters and listeners are requested without name references, so
 // Envoy will accept the snapshot list of clusters as-is even if it does not match
@@ -93,12 +154,78 @@ func (s *Snapshot) Consistent() error {
 	}
 
 	routes := GetResourceReferences(s.Resources[types.Listener].Items)
+	for name := range GetResourceReferences(s.Resources[types.ScopedRoute].Items) {
+		routes[name] = true
+	}
 	if len(routes) != len(s.Resources[types.Route].Items) {
 		return fmt.Errorf("mismatched route reference and resource lengths: %v != %d", routes, len(s.Resources[types.Route].Items))
 	}
 	return superset(routes, s.Resources[types.Route].Items)
 }
 
+// GetSecretReferences returns the secrets referenced over SDS by the snapshot
+// listeners and clusters, indexed by the secret name with the sorted names of
+// the referencing resources.
+func (s *Snapshot) GetSecretReferences() map[string][]string {
+	if s == nil {
+		return nil
+	}
+	out := GetSecretReferences(s.Resources[types.Listener].Items)
+	for secret, names := range GetSecretReferences(s.Resources[types.Cluster].Items) {
+		for _, name := range names {
+			out[secret] = appendUnique(out[secret], name)
+		}
+		sort.Strings(out[secret])
+	}
+	return out
+}
+
+// UnusedSecrets returns the sorted names of the snapshot secrets which are not
+// referenced by any listener or cluster in the snapshot.
+func (s *Snapshot) UnusedSecrets() []string {
+	if s == nil {
+		return nil
+	}
+	references := s.GetSecretReferences()
+	var out []string
+	for name := range s.Resources[types.Secret].Items {
+		if _, exists := references[name]; !exists {
+			out = append(out, name)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// MissingSecrets returns the sorted names of the secrets referenced over SDS
+// by the snapshot listeners and clusters but absent from the snapshot.
+func (s *Snapshot) MissingSecrets() []string {
+	if s == nil {
+		return nil
+	}
+	var out []string
+	for name := range s.GetSecretReferences() {
+		if _, exists := s.Resources[types.Secret].Items[name]; !exists {
+			out = append(out, name)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// ConsistentSecrets verifies that all SDS secret references resolve to the
+// snapshot secrets. The check is separate from Consistent since the secrets
+// can be served by another SDS server.
+func (s *Snapshot) ConsistentSecrets() error {
+	if s == nil {
+		return errors.New("nil snapshot")
+	}
+	if missing := s.MissingSecrets(); len(missing) > 0 {
+		return fmt.Errorf("missing secrets referenced over SDS: %v", missing)
+	}
+	return nil
+}
+
 // GetResources selects snapshot resources by type.
 func (s *Snapshot) GetResources(typeURL string) map[string]types.Resource {
 	if s == nil {
@@ -111,6 +238,18 @@ func (s *Snapshot) GetResources(typeURL string) map[string]types.Resource {
 	return s.Resources[typ].Items
 }
 
+// GetTTLs returns the resource TTLs for a type, indexed by name.
+func (s *Snapshot) GetTTLs(typeURL string) map[string]time.Duration {
+	if s == nil {
+		return nil
+	}
+	typ := GetResponseType(typeURL)
+	if typ == types.UnknownType {
+		return nil
+	}
+	return s.Resources[typ].TTLs
+}
+
 // GetVersion returns the version for a resource type.
 func (s *Snapshot) GetVersion(typeURL string) string {
 	if s == nil {
@@ -122,3 +261,32 @@ func (s *Snapshot) GetVersion(typeURL string) string {
 	}
 	return s.Resources[typ].Version
 }
+
+// GetResourcesForNode selects snapshot resources by type and applies the
+// version gates for the node.
+func (s *Snapshot) GetResourcesForNode(typeURL string, node *core.Node) map[string]types.Resource {
+	if s == nil {
+		return nil
+	}
+	typ := GetResponseType(typeURL)
+	if typ == types.UnknownType {
+		return nil
+	}
+	return applyGates(node, s.Resources[typ].Items, s.Resources[typ].Gates)
+}
+
+// SetVersionGate annotates a snapshot resource with the minimum client version.
+func (s *Snapshot) SetVersionGate(typeURL string, name string, gate VersionGate) error {
+	typ := GetResponseType(typeURL)
+	if typ == types.UnknownType {
+		return fmt.Errorf("unknown type URL %q", typeURL)
+	}
+	if _, exists := s.Resources[typ].Items[name]; !exists {
+		return fmt.Errorf("missing resource %q", name)
+	}
+	if s.Resources[typ].Gates == nil {
+		s.Resources[typ].Gates = make(map[string]VersionGate)
+	}
+	s.Resources[typ].Gates[name] = gate
+	return nil
+}
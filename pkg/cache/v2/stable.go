@@ -0,0 +1,75 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package cache
+
+import (
+	"reflect"
+
+	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
+)
+
+// WithStableVersions keeps the previous version of the types whose resources
+// are unchanged by SetSnapshot, so that bumping the version of a whole
+// snapshot only pushes the changed types to the clients. The resources are
+// compared by their deterministic serialization, unless the snapshots share
+// the resources, see SnapshotBuilder.
+//
+// The types with version gates or variants, which vary by client, keep the
+// version set by the snapshot, and so do the signed snapshots.
+func WithStableVersions() SnapshotCacheOption {
+	return func(cache *snapshotCache) {
+		cache.stableVersions = true
+	}
+}
+
+// stabilizeVersions replaces the versions of the unchanged types by their
+// previous versions. The cache lock must be held.
+func (cache *snapshotCache) stabilizeVersions(node string, snapshot *Snapshot) {
+	previous, exists := cache.snapshots[node]
+	if !exists || snapshot.Signature != nil {
+		return
+	}
+	for typ := range snapshot.Resources {
+		current, old := &snapshot.Resources[typ], previous.Resources[typ]
+		if current.Version == old.Version || old.Version == "" ||
+			len(current.Gates) > 0 || len(old.Gates) > 0 ||
+			len(current.Variants) > 0 || len(old.Variants) > 0 ||
+			!reflect.DeepEqual(current.TTLs, old.TTLs) {
+			continue
+		}
+		if sameResources(current.Items, old.Items) {
+			if cache.log != nil {
+				cache.log.Debugf("node %s: unchanged %s resources keep version %q", node, GetResponseTypeURL(types.ResponseType(typ)), old.Version)
+			}
+			current.Version = old.Version
+		}
+	}
+}
+
+// sameResources compares the resources by name and content.
+func sameResources(a, b map[string]types.Resource) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	if len(a) == 0 || reflect.ValueOf(a).Pointer() == reflect.ValueOf(b).Pointer() {
+		return true
+	}
+	hashA, err := resourcesVersion(a)
+	if err != nil {
+		return false
+	}
+	hashB, err := resourcesVersion(b)
+	return err == nil && hashA == hashB
+}
@@ -0,0 +1,69 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package cache_test
+
+import (
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+
+	discovery "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/v2"
+	rsrc "github.com/envoyproxy/go-control-plane/pkg/resource/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/test/resource/v2"
+)
+
+func TestStableVersions(t *testing.T) {
+	c := cache.NewSnapshotCache(false, group{}, logger{t: t}, cache.WithStableVersions())
+	if err := c.SetSnapshot(key, snapshot); err != nil {
+		t.Fatal(err)
+	}
+	clusters, _ := c.CreateWatch(&discovery.DiscoveryRequest{TypeUrl: rsrc.ClusterType, VersionInfo: version})
+	endpoints, _ := c.CreateWatch(&discovery.DiscoveryRequest{TypeUrl: rsrc.EndpointType, ResourceNames: []string{clusterName}, VersionInfo: version})
+
+	// the same cluster contents in a new message, and a changed endpoint
+	next := cache.NewSnapshot(version2,
+		[]types.Resource{resource.MakeEndpoint(clusterName, 9090)},
+		[]types.Resource{proto.Clone(testCluster)},
+		[]types.Resource{testRoute},
+		[]types.Resource{testListener},
+		[]types.Resource{testRuntime},
+		[]types.Resource{testSecret[0]})
+	if err := c.SetSnapshot(key, next); err != nil {
+		t.Fatal(err)
+	}
+
+	got, _ := c.GetSnapshot(key)
+	if v := got.GetVersion(rsrc.ClusterType); v != version {
+		t.Errorf("unchanged clusters => got version %q, want %q", v, version)
+	}
+	if v := got.GetVersion(rsrc.EndpointType); v != version2 {
+		t.Errorf("changed endpoints => got version %q, want %q", v, version2)
+	}
+	select {
+	case out := <-clusters:
+		t.Errorf("unchanged clusters => got a push %v", out)
+	default:
+	}
+	select {
+	case out := <-endpoints:
+		if v, _ := out.GetVersion(); v != version2 {
+			t.Errorf("changed endpoints => got version %q, want %q", v, version2)
+		}
+	default:
+		t.Error("changed endpoints => got no push")
+	}
+}
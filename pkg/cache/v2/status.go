@@ -15,9 +15,14 @@
 package cache
 
 import (
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
+	pstruct "github.com/golang/protobuf/ptypes/struct"
+	"google.golang.org/genproto/googleapis/rpc/status"
+
 	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
 )
 
@@ -40,6 +45,75 @@ func (IDHash) ID(node *core.Node) string {
 
 var _ NodeHash = IDHash{}
 
+// MetadataHash uses the node metadata fields as the node hash, e.g. the
+// "cluster" and "zone" fields to share a snapshot among the nodes of a zone.
+//
+// The keys are tried in order, and the first key with all the fields present
+// in the metadata is used. The field values are joined with the separator.
+// The nested fields are selected by dotted paths, e.g. "labels.app". The
+// string, number and boolean values are supported.
+type MetadataHash struct {
+	// Keys are the field lists tried in order.
+	Keys [][]string
+
+	// Separator joins the field values, "/" if empty.
+	Separator string
+
+	// Fallback hashes the nodes matching no key, IDHash if nil.
+	Fallback NodeHash
+}
+
+var _ NodeHash = MetadataHash{}
+
+// ID returns the joined metadata field values of the first matching key.
+func (h MetadataHash) ID(node *core.Node) string {
+	separator := h.Separator
+	if separator == "" {
+		separator = "/"
+	}
+	for _, key := range h.Keys {
+		values := make([]string, 0, len(key))
+		for _, field := range key {
+			value, exists := metadataField(node.GetMetadata(), field)
+			if !exists {
+				break
+			}
+			values = append(values, value)
+		}
+		if len(values) == len(key) && len(key) > 0 {
+			return strings.Join(values, separator)
+		}
+	}
+	if h.Fallback != nil {
+		return h.Fallback.ID(node)
+	}
+	return IDHash{}.ID(node)
+}
+
+// metadataField formats the scalar value at the dotted path.
+func metadataField(metadata *pstruct.Struct, path string) (string, bool) {
+	fields := strings.Split(path, ".")
+	for i, field := range fields {
+		value, exists := metadata.GetFields()[field]
+		if !exists {
+			return "", false
+		}
+		if i < len(fields)-1 {
+			metadata = value.GetStructValue()
+			continue
+		}
+		switch kind := value.GetKind().(type) {
+		case *pstruct.Value_StringValue:
+			return kind.StringValue, true
+		case *pstruct.Value_NumberValue:
+			return strconv.FormatFloat(kind.NumberValue, 'g', -1, 64), true
+		case *pstruct.Value_BoolValue:
+			return strconv.FormatBool(kind.BoolValue), true
+		}
+	}
+	return "", false
+}
+
 // StatusInfo tracks the server state for the remote Envoy node.
 // Not all fields are used by all cache implementations.
 type StatusInfo interface {
@@ -51,6 +125,40 @@ type StatusInfo interface {
 
 	// GetLastWatchRequestTime returns the timestamp of the last discovery watch request.
 	GetLastWatchRequestTime() time.Time
+
+	// GetAckStatus returns the acknowledgement status of the requested types
+	// indexed by type URL.
+	GetAckStatus() map[string]AckStatus
+
+	// GetAckedSnapshot returns the snapshot of the last version of a type
+	// acknowledged by the node, if known.
+	GetAckedSnapshot(typeURL string) (Snapshot, bool)
+}
+
+// AckStatus records the last versions of a type acknowledged and rejected by
+// a node.
+type AckStatus struct {
+	AckedVersion string
+	AckTime      time.Time
+
+	// AckLatency is the propagation latency of the acknowledged version, from
+	// the update setting it to its first acknowledgement, if measured.
+	AckLatency time.Duration
+
+	// ResourceNames are the resource names subscribed by the acknowledging
+	// request, empty for the wildcard subscriptions.
+	ResourceNames []string
+
+	// NackedVersion is the last version responded before a rejection, with
+	// the error detail reported by the node.
+	NackedVersion string
+	NackTime      time.Time
+	ErrorDetail   *status.Status
+}
+
+// Converged returns true if the version is acknowledged and not rejected since.
+func (s AckStatus) Converged(version string) bool {
+	return s.AckedVersion == version && !s.NackTime.After(s.AckTime)
 }
 
 type statusInfo struct {
@@ -63,6 +171,16 @@ type statusInfo struct {
 	// the timestamp of the last watch request
 	lastWatchRequestTime time.Time
 
+	// sent are the last versions responded indexed by type URL
+	sent map[string]string
+
+	// acked are the snapshots of the last acknowledged versions indexed by
+	// type URL
+	acked map[string]Snapshot
+
+	// ackStatus are the acknowledgement statuses indexed by type URL
+	ackStatus map[string]AckStatus
+
 	// mutex to protect the status fields.
 	// should not acquire mutex of the parent cache after acquiring this mutex.
 	mu sync.RWMutex
@@ -80,8 +198,11 @@ type ResponseWatch struct {
 // newStatusInfo initializes a status info data structure.
 func newStatusInfo(node *core.Node) *statusInfo {
 	out := statusInfo{
-		node:    node,
-		watches: make(map[int64]ResponseWatch),
+		node:      node,
+		watches:   make(map[int64]ResponseWatch),
+		sent:      make(map[string]string),
+		acked:     make(map[string]Snapshot),
+		ackStatus: make(map[string]AckStatus),
 	}
 	return &out
 }
@@ -103,3 +224,20 @@ func (info *statusInfo) GetLastWatchRequestTime() time.Time {
 	defer info.mu.RUnlock()
 	return info.lastWatchRequestTime
 }
+
+func (info *statusInfo) GetAckStatus() map[string]AckStatus {
+	info.mu.RLock()
+	defer info.mu.RUnlock()
+	out := make(map[string]AckStatus, len(info.ackStatus))
+	for typeURL, ackStatus := range info.ackStatus {
+		out[typeURL] = ackStatus
+	}
+	return out
+}
+
+func (info *statusInfo) GetAckedSnapshot(typeURL string) (Snapshot, bool) {
+	info.mu.RLock()
+	defer info.mu.RUnlock()
+	snapshot, exists := info.acked[typeURL]
+	return snapshot, exists
+}
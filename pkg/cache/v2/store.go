@@ -0,0 +1,76 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package cache
+
+import (
+	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
+)
+
+// ResourceStore holds the resources of a LinearCache indexed by name, e.g. in
+// an on-disk store with an in-memory index for the large EDS collections.
+// The cache calls the store under its lock, so the store needs not be safe
+// for concurrent use, and the latency of the store delays the responses and
+// the updates of the cache.
+type ResourceStore interface {
+	// Get returns a resource, or nil if the resource is missing.
+	Get(name string) (types.Resource, error)
+
+	// Set adds or replaces a resource.
+	Set(name string, resource types.Resource) error
+
+	// Delete removes a resource if it exists.
+	Delete(name string) error
+
+	// Range calls the function for each resource in any order.
+	Range(func(name string, resource types.Resource)) error
+
+	// Len returns the number of resources.
+	Len() int
+}
+
+// memoryStore is the default store of a LinearCache.
+type memoryStore map[string]types.Resource
+
+var _ ResourceStore = memoryStore{}
+
+// NewMemoryStore creates an in-memory resource store.
+func NewMemoryStore() ResourceStore {
+	return make(memoryStore)
+}
+
+func (store memoryStore) Get(name string) (types.Resource, error) {
+	return store[name], nil
+}
+
+func (store memoryStore) Set(name string, resource types.Resource) error {
+	store[name] = resource
+	return nil
+}
+
+func (store memoryStore) Delete(name string) error {
+	delete(store, name)
+	return nil
+}
+
+func (store memoryStore) Range(f func(string, types.Resource)) error {
+	for name, resource := range store {
+		f(name, resource)
+	}
+	return nil
+}
+
+func (store memoryStore) Len() int {
+	return len(store)
+}
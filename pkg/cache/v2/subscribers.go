@@ -0,0 +1,113 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package cache
+
+import (
+	"time"
+
+	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
+)
+
+// WithUnwatchedCallback calls the function with the resources left without
+// subscribers for the grace period, e.g. so that an on-demand producer stops
+// generating and deletes the resources nobody watches. The grace period
+// absorbs the reconnections of the streams. The function is called without
+// the cache lock, so it may delete the resource.
+func WithUnwatchedCallback(grace time.Duration, onUnwatched func(name string)) LinearCacheOption {
+	return func(cache *LinearCache) {
+		cache.grace = grace
+		cache.onUnwatched = onUnwatched
+	}
+}
+
+// NumSubscribers returns the number of watches tracking a resource name, by
+// name or as a wildcard. Unlike NumWatches, a watch tracks its names from its
+// creation until its cancellation, which the server invokes once the stream
+// requests the type again or closes, so a responded watch still counts.
+func (cache *LinearCache) NumSubscribers(name string) int {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	return cache.subscribers[name] + cache.wildcardSubscribers
+}
+
+// subscribe counts the subscription of a watch to the names, or to all the
+// resources if the names are empty. The returned function releases the
+// subscription once, with the cache lock held.
+func (cache *LinearCache) subscribe(names []string) func() {
+	if len(names) == 0 {
+		cache.wildcardSubscribers++
+		for name, timer := range cache.unwatched {
+			timer.Stop()
+			delete(cache.unwatched, name)
+		}
+	}
+	for _, name := range names {
+		cache.subscribers[name]++
+		if timer, exists := cache.unwatched[name]; exists {
+			timer.Stop()
+			delete(cache.unwatched, name)
+		}
+	}
+
+	released := false
+	return func() {
+		if released {
+			return
+		}
+		released = true
+		if len(names) == 0 {
+			cache.wildcardSubscribers--
+			if cache.wildcardSubscribers == 0 {
+				_ = cache.store.Range(func(name string, _ types.Resource) {
+					if cache.subscribers[name] == 0 {
+						cache.scheduleUnwatched(name)
+					}
+				})
+			}
+		}
+		for _, name := range names {
+			cache.subscribers[name]--
+			if cache.subscribers[name] == 0 {
+				delete(cache.subscribers, name)
+				if cache.wildcardSubscribers == 0 {
+					cache.scheduleUnwatched(name)
+				}
+			}
+		}
+	}
+}
+
+// scheduleUnwatched calls the unwatched callback after the grace period,
+// unless the name is subscribed again. The cache lock must be held.
+func (cache *LinearCache) scheduleUnwatched(name string) {
+	if cache.onUnwatched == nil {
+		return
+	}
+	if _, pending := cache.unwatched[name]; pending {
+		return
+	}
+	var timer *time.Timer
+	timer = time.AfterFunc(cache.grace, func() {
+		cache.mu.Lock()
+		if cache.unwatched[name] != timer {
+			cache.mu.Unlock()
+			return
+		}
+		delete(cache.unwatched, name)
+		cache.mu.Unlock()
+		cache.onUnwatched(name)
+	})
+	cache.unwatched[name] = timer
+}
@@ -0,0 +1,157 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package cache
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
+	"github.com/envoyproxy/go-control-plane/pkg/resource/v2"
+)
+
+// AckFunc waits until the node acknowledges a version of a type, e.g. as
+// reported by the stream callbacks.
+type AckFunc func(ctx context.Context, node, typeURL, version string) error
+
+// ListenerSwap replaces a listener with a listener of another name in a
+// blue/green sequence:
+//
+//  1. the new listener is added next to the old one,
+//  2. once the node acknowledges it, the old listener drains for a delay,
+//  3. the old listener is removed in a follow-up snapshot.
+//
+// Replacing a listener in place instead drains the old listener for the drain
+// time of the proxy, with no confirmation that the new one is accepted.
+//
+// The new listener is removed again if the node does not acknowledge it. A
+// single swap runs at a time for each node.
+type ListenerSwap struct {
+	Cache SnapshotCache
+
+	// Ack waits for the acknowledgement of the listener versions.
+	Ack AckFunc
+
+	// DrainDelay is the time to drain the old listener after the new one is
+	// acknowledged.
+	DrainDelay time.Duration
+
+	mu       sync.Mutex
+	swapping map[string]bool
+}
+
+// Swap replaces the old listener of the node snapshot with the next listener.
+// The resources referenced by the next listener, e.g. its routes, must already
+// be in the snapshot. The swap fails if the listeners of the snapshot are
+// changed by another writer in the meantime, or if another swap of the node
+// is in progress.
+func (s *ListenerSwap) Swap(ctx context.Context, node, old string, next types.Resource) error {
+	typeURL := resource.ListenerType
+	name := GetResourceName(next)
+	if name == old {
+		return fmt.Errorf("listener %q must be replaced by a listener of another name", old)
+	}
+
+	s.mu.Lock()
+	if s.swapping[node] {
+		s.mu.Unlock()
+		return fmt.Errorf("a listener swap is already in progress for node %s", node)
+	}
+	if s.swapping == nil {
+		s.swapping = make(map[string]bool)
+	}
+	s.swapping[node] = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.swapping, node)
+		s.mu.Unlock()
+	}()
+
+	snapshot, err := s.Cache.GetSnapshot(node)
+	if err != nil {
+		return err
+	}
+	listeners := snapshot.Resources[types.Listener]
+	if _, exists := listeners.Items[old]; !exists {
+		return fmt.Errorf("listener %q not found for node %s", old, node)
+	}
+	if _, exists := listeners.Items[name]; exists {
+		return fmt.Errorf("listener %q already exists for node %s", name, node)
+	}
+
+	// add the next listener
+	added := listeners
+	added.Version = fmt.Sprintf("%s+swap.%s", listeners.Version, name)
+	added.Items = copyItems(listeners.Items)
+	added.Items[name] = next
+	snapshot.Resources[types.Listener] = added
+	if err := s.Cache.SetSnapshot(node, snapshot); err != nil {
+		return err
+	}
+	if err := s.Ack(ctx, node, typeURL, added.Version); err != nil {
+		if rollbackErr := s.rollback(node, listeners, added.Version); rollbackErr != nil {
+			return fmt.Errorf("listener %q not acknowledged: %v, and not removed: %v", name, err, rollbackErr)
+		}
+		return fmt.Errorf("listener %q not acknowledged: %v", name, err)
+	}
+
+	// drain the old listener
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(s.DrainDelay):
+	}
+
+	// remove the old listener from the latest snapshot
+	snapshot, err = s.Cache.GetSnapshot(node)
+	if err != nil {
+		return err
+	}
+	current := snapshot.Resources[types.Listener]
+	if current.Version != added.Version {
+		return fmt.Errorf("listeners of node %s changed to version %q during the swap", node, current.Version)
+	}
+	removed := current
+	removed.Version = fmt.Sprintf("%s+swap.%s.done", listeners.Version, name)
+	removed.Items = copyItems(current.Items)
+	delete(removed.Items, old)
+	snapshot.Resources[types.Listener] = removed
+	if err := s.Cache.SetSnapshot(node, snapshot); err != nil {
+		return err
+	}
+	if err := s.Ack(ctx, node, typeURL, removed.Version); err != nil {
+		return fmt.Errorf("listener %q removal not acknowledged: %v", old, err)
+	}
+	return nil
+}
+
+// rollback restores the listeners of the node before a swap, unless they were
+// changed by another writer since the next listener was added.
+func (s *ListenerSwap) rollback(node string, listeners Resources, added string) error {
+	snapshot, err := s.Cache.GetSnapshot(node)
+	if err != nil {
+		return err
+	}
+	if current := snapshot.Resources[types.Listener].Version; current != added {
+		return fmt.Errorf("listeners of node %s changed to version %q during the swap", node, current)
+	}
+	restored := listeners
+	restored.Version = added + ".rollback"
+	snapshot.Resources[types.Listener] = restored
+	return s.Cache.SetSnapshot(node, snapshot)
+}
@@ -0,0 +1,118 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package cache_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/envoyproxy/go-control-plane/pkg/cache/v2"
+	rsrc "github.com/envoyproxy/go-control-plane/pkg/resource/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/test/resource/v2"
+)
+
+func TestListenerSwap(t *testing.T) {
+	c := cache.NewSnapshotCache(false, group{}, logger{t: t})
+	if err := c.SetSnapshot(key, snapshot); err != nil {
+		t.Fatal(err)
+	}
+	// the port 0 binds the listeners to distinct ephemeral ports
+	next := resource.MakeHTTPListener(resource.Ads, "listener-green", 0, routeName)
+
+	// the listeners seen by the node at each acknowledged version
+	var acked [][]string
+	swap := &cache.ListenerSwap{
+		Cache:      c,
+		DrainDelay: 10 * time.Millisecond,
+		Ack: func(_ context.Context, node, typeURL, version string) error {
+			snap, _ := c.GetSnapshot(node)
+			if typeURL != rsrc.ListenerType || snap.GetVersion(typeURL) != version {
+				return errors.New("unexpected version")
+			}
+			var names []string
+			for name := range snap.GetResources(typeURL) {
+				names = append(names, name)
+			}
+			acked = append(acked, names)
+			return nil
+		},
+	}
+
+	if err := swap.Swap(context.Background(), key, listenerName, resource.MakeHTTPListener(resource.Ads, listenerName, 0, routeName)); err == nil {
+		t.Error("Swap() with the same name => got no error")
+	}
+	if err := swap.Swap(context.Background(), key, "missing", next); err == nil {
+		t.Error("Swap() of a missing listener => got no error")
+	}
+
+	start := time.Now()
+	if err := swap.Swap(context.Background(), key, listenerName, next); err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(start) < swap.DrainDelay {
+		t.Errorf("Swap() => done in %v, want the drain delay", time.Since(start))
+	}
+	if len(acked) != 2 || len(acked[0]) != 2 || len(acked[1]) != 1 || acked[1][0] != "listener-green" {
+		t.Errorf("acknowledged listeners => got %v, want both then the new one", acked)
+	}
+	got, _ := c.GetSnapshot(key)
+	if got.GetVersion(rsrc.ListenerType) == version || got.GetVersion(rsrc.RouteType) != version {
+		t.Errorf("versions => got listeners %q and routes %q", got.GetVersion(rsrc.ListenerType), got.GetVersion(rsrc.RouteType))
+	}
+
+	// the new listener is removed if it is not acknowledged
+	swap.Ack = func(context.Context, string, string, string) error { return errors.New("rejected") }
+	if err := swap.Swap(context.Background(), key, "listener-green", resource.MakeHTTPListener(resource.Ads, "listener-blue", 0, routeName)); err == nil {
+		t.Error("Swap() without acknowledgement => got no error")
+	}
+	got, _ = c.GetSnapshot(key)
+	if listeners := got.GetResources(rsrc.ListenerType); len(listeners) != 1 || listeners["listener-green"] == nil {
+		t.Errorf("listeners after the failed swap => got %v, want the old one", listeners)
+	}
+}
+
+func TestListenerSwapSingleWriter(t *testing.T) {
+	c := cache.NewSnapshotCache(false, group{}, logger{t: t})
+	if err := c.SetSnapshot(key, snapshot); err != nil {
+		t.Fatal(err)
+	}
+	// the acknowledgements wait for the release
+	acking := make(chan struct{}, 2)
+	release := make(chan struct{})
+	swap := &cache.ListenerSwap{
+		Cache: c,
+		Ack: func(context.Context, string, string, string) error {
+			acking <- struct{}{}
+			<-release
+			return nil
+		},
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- swap.Swap(context.Background(), key, listenerName, resource.MakeHTTPListener(resource.Ads, "listener-green", 0, routeName))
+	}()
+	<-acking
+	if err := swap.Swap(context.Background(), key, listenerName, resource.MakeHTTPListener(resource.Ads, "listener-blue", 0, routeName)); err == nil {
+		t.Error("concurrent Swap() => got no error")
+	}
+
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,154 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package cache
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	auth "github.com/envoyproxy/go-control-plane/envoy/api/v2/auth"
+	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+)
+
+// TicketKeySize is the size of a TLS session ticket key expected by Envoy.
+const TicketKeySize = 80
+
+// TicketKeyRotator manages the rotation of TLS session ticket keys. The first
+// key of the secret encrypts the new tickets, and a number of previous keys are
+// retained to decrypt the tickets issued before the rotation, so that sessions
+// resume across rotations and across the proxies sharing the keys.
+//
+// A new key is staged as decrypt-only for one rotation, after the encryption
+// key, and only promoted to the encryption key by the next rotation. The
+// proxies do not receive a secret at the same time, and the staging ensures
+// that every proxy can decrypt the tickets encrypted with a new key before any
+// proxy starts issuing them.
+//
+// The keys are distributed with a publish function, e.g. as an SDS secret
+// updated in a LinearCache, or inline in the listener TLS contexts.
+type TicketKeyRotator struct {
+	name    string
+	retain  int
+	publish func(*auth.Secret) error
+	rand    io.Reader
+
+	// keys ordered from the encryption key, and the staged decrypt-only key
+	keys   [][]byte
+	staged []byte
+	mu     sync.Mutex
+}
+
+// NewTicketKeyRotator creates a rotator for the secret name retaining the
+// given number of previous keys. The publish function is invoked with the
+// secret after each rotation.
+func NewTicketKeyRotator(name string, retain int, publish func(*auth.Secret) error) *TicketKeyRotator {
+	if retain < 0 {
+		retain = 0
+	}
+	return &TicketKeyRotator{name: name, retain: retain, publish: publish, rand: rand.Reader}
+}
+
+// Rotate promotes the staged key to the encryption key, stages a new key,
+// drops the keys beyond the retained count and publishes the secret. The first
+// rotation has no key to stage against and uses the new key for encryption at
+// once.
+func (r *TicketKeyRotator) Rotate() error {
+	key := make([]byte, TicketKeySize)
+	if _, err := io.ReadFull(r.rand, key); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	switch {
+	case len(r.keys) == 0:
+		r.keys = [][]byte{key}
+	case r.staged == nil:
+		r.staged = key
+	default:
+		r.keys = append([][]byte{r.staged}, r.keys...)
+		r.staged = key
+	}
+	if len(r.keys) > r.retain+1 {
+		r.keys = r.keys[:r.retain+1]
+	}
+	secret := r.secret()
+	r.mu.Unlock()
+
+	if r.publish == nil {
+		return nil
+	}
+	return r.publish(secret)
+}
+
+// Run rotates the keys immediately and then at every interval until the
+// context is done. Publishing errors stop the rotation.
+func (r *TicketKeyRotator) Run(ctx context.Context, interval time.Duration) error {
+	if interval <= 0 {
+		return errors.New("rotation interval must be positive")
+	}
+	if err := r.Rotate(); err != nil {
+		return err
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			if err := r.Rotate(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Secret returns the current keys as an SDS secret.
+func (r *TicketKeyRotator) Secret() *auth.Secret {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.secret()
+}
+
+// SessionTicketKeys returns the current keys for inlining into the downstream
+// TLS contexts of the listeners.
+func (r *TicketKeyRotator) SessionTicketKeys() *auth.TlsSessionTicketKeys {
+	return r.Secret().GetSessionTicketKeys()
+}
+
+func (r *TicketKeyRotator) secret() *auth.Secret {
+	ordered := r.keys
+	if r.staged != nil {
+		ordered = make([][]byte, 0, len(r.keys)+1)
+		ordered = append(ordered, r.keys[0], r.staged)
+		ordered = append(ordered, r.keys[1:]...)
+	}
+	keys := make([]*core.DataSource, 0, len(ordered))
+	for _, key := range ordered {
+		keys = append(keys, &core.DataSource{
+			Specifier: &core.DataSource_InlineBytes{InlineBytes: key},
+		})
+	}
+	return &auth.Secret{
+		Name: r.name,
+		Type: &auth.Secret_SessionTicketKeys{
+			SessionTicketKeys: &auth.TlsSessionTicketKeys{Keys: keys},
+		},
+	}
+}
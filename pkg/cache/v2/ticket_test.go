@@ -0,0 +1,91 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package cache_test
+
+import (
+	"bytes"
+	"testing"
+
+	auth "github.com/envoyproxy/go-control-plane/envoy/api/v2/auth"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/v2"
+	rsrc "github.com/envoyproxy/go-control-plane/pkg/resource/v2"
+)
+
+func TestTicketKeyRotator(t *testing.T) {
+	const name = "ticket-keys"
+	c := cache.NewLinearCache(rsrc.SecretType)
+	r := cache.NewTicketKeyRotator(name, 2, func(secret *auth.Secret) error {
+		return c.UpdateResource(secret.Name, secret)
+	})
+
+	var previous [][]byte
+	for i := 0; i < 5; i++ {
+		if err := r.Rotate(); err != nil {
+			t.Fatal(err)
+		}
+		keys := r.SessionTicketKeys().GetKeys()
+		// the encryption key, the staged key and the retained keys
+		want := i + 1
+		if want > 4 {
+			want = 4
+		}
+		if len(keys) != want {
+			t.Fatalf("keys after %d rotations => got %d, want %d", i+1, len(keys), want)
+		}
+		for _, key := range keys {
+			if len(key.GetInlineBytes()) != cache.TicketKeySize {
+				t.Errorf("key size => got %d, want %d", len(key.GetInlineBytes()), cache.TicketKeySize)
+			}
+		}
+		switch {
+		case i == 1:
+			// the second key is staged behind the first one
+			if !bytes.Equal(keys[0].GetInlineBytes(), previous[0]) {
+				t.Errorf("encryption key after %d rotations is not the first key", i+1)
+			}
+		case i > 1:
+			// the staged key is promoted and the encryption key is retained
+			if !bytes.Equal(keys[0].GetInlineBytes(), previous[1]) {
+				t.Errorf("encryption key after %d rotations is not the staged key", i+1)
+			}
+			if !bytes.Equal(keys[2].GetInlineBytes(), previous[0]) {
+				t.Errorf("key 2 after %d rotations is not the previous encryption key", i+1)
+			}
+			for j := 3; j < len(keys); j++ {
+				if !bytes.Equal(keys[j].GetInlineBytes(), previous[j-1]) {
+					t.Errorf("key %d after %d rotations is not the retained previous key", j, i+1)
+				}
+			}
+		}
+		previous = previous[:0]
+		for _, key := range keys {
+			previous = append(previous, key.GetInlineBytes())
+		}
+	}
+
+	w, _ := c.CreateWatch(&cache.Request{TypeUrl: rsrc.SecretType, ResourceNames: []string{name}})
+	select {
+	case resp := <-w:
+		out, err := resp.GetDiscoveryResponse()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(out.Resources) != 1 {
+			t.Errorf("published secrets => got %d, want 1", len(out.Resources))
+		}
+	default:
+		t.Error("secret is not published")
+	}
+}
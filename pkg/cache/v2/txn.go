@@ -0,0 +1,180 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package cache
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
+)
+
+// Txn batches the updates of several linear caches, e.g. a cluster and its
+// endpoints, and commits them atomically: the watches are notified once all
+// the updates are applied, so that no response observes a partial update,
+// and the invariants across the types are kept. The snapshot caches update
+// several types atomically with SetSnapshot instead.
+//
+// A transaction is not safe for concurrent use, and is empty once committed.
+type Txn struct {
+	caches []*LinearCache
+
+	// writes by cache and resource name, a nil resource deletes the resource
+	writes map[*LinearCache]map[string]types.Resource
+}
+
+// NewTxn creates an empty transaction.
+func NewTxn() *Txn {
+	return &Txn{writes: make(map[*LinearCache]map[string]types.Resource)}
+}
+
+// UpdateResource adds or replaces a resource of a cache in the transaction.
+func (txn *Txn) UpdateResource(cache *LinearCache, name string, res types.Resource) error {
+	if res == nil {
+		return errors.New("nil resource")
+	}
+	txn.write(cache, name, res)
+	return nil
+}
+
+// DeleteResource removes a resource of a cache in the transaction.
+func (txn *Txn) DeleteResource(cache *LinearCache, name string) {
+	txn.write(cache, name, nil)
+}
+
+func (txn *Txn) write(cache *LinearCache, name string, res types.Resource) {
+	if txn.writes[cache] == nil {
+		txn.writes[cache] = make(map[string]types.Resource)
+		txn.caches = append(txn.caches, cache)
+	}
+	txn.writes[cache][name] = res
+}
+
+// txnWrite is an applied write, with the previous resource to roll it back.
+type txnWrite struct {
+	cache    *LinearCache
+	name     string
+	previous types.Resource
+}
+
+// Commit applies the updates, and notifies the watches of the updated
+// resources. The updates are rolled back if a store fails.
+func (txn *Txn) Commit() error {
+	caches := txn.caches
+	writes := txn.writes
+	txn.caches = nil
+	txn.writes = make(map[*LinearCache]map[string]types.Resource)
+
+	// the writes of the caches with an ownership registry are checked as
+	// anonymous, and release the deleted resources once the caches are
+	// unlocked, since the ownership writes lock the caches
+	for _, cache := range caches {
+		if cache.ownership == nil {
+			continue
+		}
+		written, removed := txnNames(writes[cache])
+		cache.ownership.mu.Lock()
+		conflicts, err := cache.ownership.check("", cache.typeURL, "", written, removed)
+		cache.ownership.mu.Unlock()
+		cache.ownership.report(conflicts)
+		if err != nil {
+			return err
+		}
+	}
+	committed := false
+	defer func() {
+		for _, cache := range caches {
+			if committed && cache.ownership != nil {
+				written, removed := txnNames(writes[cache])
+				cache.ownership.mu.Lock()
+				cache.ownership.claim("", cache.typeURL, "", written, removed)
+				cache.ownership.mu.Unlock()
+			}
+		}
+	}()
+
+	// the caches are locked in a global order to prevent deadlocks between
+	// the concurrent transactions
+	sort.Slice(caches, func(i, j int) bool { return caches[i].id < caches[j].id })
+	for _, cache := range caches {
+		cache.mu.Lock()
+		defer cache.mu.Unlock()
+	}
+
+	var applied []txnWrite
+	for _, cache := range caches {
+		for name, res := range writes[cache] {
+			previous, err := cache.store.Get(name)
+			if err == nil {
+				if res == nil {
+					err = cache.store.Delete(name)
+				} else {
+					err = cache.store.Set(name, res)
+				}
+			}
+			if err != nil {
+				rollback(applied)
+				return err
+			}
+			applied = append(applied, txnWrite{cache: cache, name: name, previous: previous})
+		}
+	}
+
+	for _, cache := range caches {
+		cache.version++
+		modified := make(map[string]struct{}, len(writes[cache]))
+		for name, res := range writes[cache] {
+			if res == nil {
+				delete(cache.versionVector, name)
+				if cache.marshaled != nil {
+					cache.marshaled.Forget(cache.typeURL, name)
+				}
+			} else {
+				cache.versionVector[name] = cache.version
+			}
+			modified[name] = struct{}{}
+		}
+		cache.provideVersion()
+		cache.notifyAll(modified)
+	}
+	committed = true
+	return nil
+}
+
+// txnNames splits the names of the writes of a cache into the written and the
+// removed names.
+func txnNames(writes map[string]types.Resource) (written, removed []string) {
+	for name, res := range writes {
+		if res == nil {
+			removed = append(removed, name)
+		} else {
+			written = append(written, name)
+		}
+	}
+	return written, removed
+}
+
+// rollback restores the previous resources of the applied writes, on a best
+// effort basis.
+func rollback(applied []txnWrite) {
+	for i := len(applied) - 1; i >= 0; i-- {
+		write := applied[i]
+		if write.previous == nil {
+			_ = write.cache.store.Delete(write.name)
+		} else {
+			_ = write.cache.store.Set(write.name, write.previous)
+		}
+	}
+}
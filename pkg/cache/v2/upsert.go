@@ -0,0 +1,154 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"sort"
+
+	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
+)
+
+// UpsertResources adds or replaces the resources of a type in the snapshot of
+// a node, and removes the resources named in removed. The version of the type
+// is recomputed from the resources, so that the replicas of the control plane
+// agree on it (or by the provider, see WithVersionProvider), and only the
+// open watches of the type are responded. The other types of the snapshot are
+// unchanged.
+//
+// The updated snapshot is admitted by the admission controllers, see
+// WithAdmission. The version gates and the TTLs of the replaced and the
+// removed resources are dropped. The snapshot is not checked for
+// consistency, e.g. a removed route may still be referenced by a listener.
+// The snapshots of the caches with a verifier cannot be updated in place,
+// since the signature no longer matches.
+func (cache *snapshotCache) UpsertResources(node string, typeURL string, resources []types.Resource, removed []string) error {
+	if cache.ownership == nil {
+		return cache.upsertResources(node, typeURL, resources, removed)
+	}
+	written := make([]string, 0, len(resources))
+	for _, item := range resources {
+		written = append(written, GetResourceName(item))
+	}
+	return cache.ownership.write(node, typeURL, "", written, removed, func() error {
+		return cache.upsertResources(node, typeURL, resources, removed)
+	})
+}
+
+func (cache *snapshotCache) upsertResources(node string, typeURL string, resources []types.Resource, removed []string) error {
+	typ := GetResponseType(typeURL)
+	if typ == types.UnknownType {
+		return fmt.Errorf("unknown type URL %q", typeURL)
+	}
+	if cache.verifier != nil {
+		return fmt.Errorf("snapshot for node %s: signed snapshots cannot be updated in place", node)
+	}
+	if cache.strictNames {
+		if err := cache.checkUpsertNames(node, typeURL, "", resources); err != nil {
+			return err
+		}
+	}
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	snapshot, exists := cache.snapshots[node]
+	if !exists {
+		return fmt.Errorf("no snapshot found for node %s", node)
+	}
+
+	// the maps of the previous snapshot may be shared with the callers of
+	// GetSnapshot and with the views, so the builder copies them
+	previous := snapshot.Resources[typ]
+	builder := NewSnapshotBuilderFrom(snapshot)
+	if err := builder.RemoveResource(typeURL, removed...); err != nil {
+		return err
+	}
+	if err := builder.SetResource(typeURL, resources...); err != nil {
+		return err
+	}
+	admitted, err := cache.admit(context.Background(), node, builder.snapshot)
+	if err != nil {
+		return err
+	}
+	updated := admitted.Resources[typ]
+
+	version, err := cache.typeVersion(typeURL, updated.Items, previous.Version)
+	if err != nil {
+		return fmt.Errorf("snapshot for node %s: %v", node, err)
+	}
+	if version == previous.Version {
+		return nil
+	}
+	updated.Version = version
+
+	current := snapshot
+	snapshot.Resources[typ] = updated
+	snapshot.Signature = nil
+	snapshot.HealthOnly = false
+	cache.forgetMarshaled(node, &current, &snapshot)
+	cache.mutableSnapshots()[node] = snapshot
+	cache.recordVersions(node, &snapshot)
+
+	if info, ok := cache.status[node]; ok {
+		info.mu.Lock()
+		groups := make(responseGroups)
+		for id, watch := range info.watches {
+			if watch.Request.TypeUrl != typeURL || watch.Request.VersionInfo == version {
+				continue
+			}
+			if cache.ordered && info.held(&snapshot, typeURL) {
+				continue
+			}
+			if cache.respondGroup(watch.Request, watch.Response, &snapshot, version, groups) {
+				info.sent[typeURL] = version
+			}
+			delete(info.watches, id)
+		}
+		info.mu.Unlock()
+	}
+	return nil
+}
+
+// resourcesVersion computes a version from the names and the deterministically
+// serialized resources.
+func resourcesVersion(items map[string]types.Resource) (string, error) {
+	names := make([]string, 0, len(items))
+	for name := range items {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	h := sha256.New()
+	write := func(b []byte) {
+		var size [8]byte
+		binary.BigEndian.PutUint64(size[:], uint64(len(b)))
+		h.Write(size[:])
+		h.Write(b)
+	}
+	for _, name := range names {
+		marshaled, err := MarshalResource(items[name])
+		if err != nil {
+			return "", fmt.Errorf("resource %q: %v", name, err)
+		}
+		write([]byte(name))
+		write(marshaled)
+	}
+	return hex.EncodeToString(h.Sum(nil)[:8]), nil
+}
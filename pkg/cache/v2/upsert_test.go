@@ -0,0 +1,90 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package cache_test
+
+import (
+	"testing"
+
+	discovery "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/v2"
+	rsrc "github.com/envoyproxy/go-control-plane/pkg/resource/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/test/resource/v2"
+)
+
+func TestUpsertResources(t *testing.T) {
+	c := cache.NewSnapshotCache(false, group{}, nil)
+	if err := c.UpsertResources(key, rsrc.ClusterType, nil, nil); err == nil {
+		t.Error("UpsertResources() without a snapshot => got no error")
+	}
+	if err := c.SetSnapshot(key, snapshot); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.UpsertResources(key, "unknown", nil, nil); err == nil {
+		t.Error("UpsertResources() with an unknown type => got no error")
+	}
+
+	node := &core.Node{Id: key}
+	clusters, _ := c.CreateWatch(&discovery.DiscoveryRequest{Node: node, TypeUrl: rsrc.ClusterType, VersionInfo: version})
+	endpoints, _ := c.CreateWatch(&discovery.DiscoveryRequest{Node: node, TypeUrl: rsrc.EndpointType, VersionInfo: version, ResourceNames: []string{clusterName}})
+
+	added := resource.MakeCluster(resource.Ads, "cluster1")
+	if err := c.UpsertResources(key, rsrc.ClusterType, []types.Resource{added}, nil); err != nil {
+		t.Fatal(err)
+	}
+	var upserted string
+	select {
+	case out := <-clusters:
+		upserted, _ = out.GetVersion()
+		if n := len(out.(*cache.RawResponse).Resources); upserted == version || n != 2 {
+			t.Errorf("clusters response => got version %q with %d clusters, want a new version with 2", upserted, n)
+		}
+	default:
+		t.Fatal("clusters watch => got no response")
+	}
+	select {
+	case out := <-endpoints:
+		t.Errorf("endpoints watch => got %v, want none", out)
+	default:
+	}
+
+	snap, _ := c.GetSnapshot(key)
+	if got := snap.GetVersion(rsrc.EndpointType); got != version {
+		t.Errorf("endpoints version => got %q, want %q", got, version)
+	}
+	if got := snapshot.GetResources(rsrc.ClusterType); len(got) != 1 {
+		t.Errorf("original snapshot clusters => got %d, want 1", len(got))
+	}
+
+	// the same update keeps the version
+	if err := c.UpsertResources(key, rsrc.ClusterType, []types.Resource{added}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if snap, _ = c.GetSnapshot(key); snap.GetVersion(rsrc.ClusterType) != upserted {
+		t.Errorf("repeated upsert version => got %q, want %q", snap.GetVersion(rsrc.ClusterType), upserted)
+	}
+
+	if err := c.UpsertResources(key, rsrc.ClusterType, nil, []string{"cluster1"}); err != nil {
+		t.Fatal(err)
+	}
+	snap, _ = c.GetSnapshot(key)
+	if got := snap.GetResources(rsrc.ClusterType); len(got) != 1 || got[clusterName] == nil {
+		t.Errorf("removed cluster => got %v, want only %s", got, clusterName)
+	}
+	if got := snap.GetVersion(rsrc.ClusterType); got == upserted || got == version {
+		t.Errorf("removed cluster version => got %q, want a new version", got)
+	}
+}
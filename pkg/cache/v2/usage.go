@@ -0,0 +1,91 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package cache
+
+import (
+	"github.com/golang/protobuf/proto"
+)
+
+// TenantFunc maps a node ID to the tenant owning the node.
+type TenantFunc func(node string) string
+
+// Usage is the approximate memory retained by the snapshot cache in bytes.
+// The resources shared by several snapshots are counted for each node.
+type Usage struct {
+	// Nodes is the usage of the snapshots by node ID.
+	Nodes map[string]int `json:"nodes"`
+
+	// Tenants is the usage of the snapshots aggregated by tenant.
+	Tenants map[string]int `json:"tenants,omitempty"`
+
+	// Responses is the size of the shared marshaled response cache.
+	Responses int `json:"responses"`
+
+	// Total is the sum of the snapshot and the response cache usage.
+	Total int `json:"total"`
+}
+
+// Size estimates the memory retained by the snapshot from the serialized size
+// of the resources, the names and the versions.
+func (s *Snapshot) Size() int {
+	if s == nil {
+		return 0
+	}
+	size := len(s.Signature)
+	for _, resources := range s.Resources {
+		size += len(resources.Version)
+		for name, res := range resources.Items {
+			size += len(name) + proto.Size(res)
+		}
+		for name := range resources.Gates {
+			size += len(name)
+		}
+		for name, variants := range resources.Variants {
+			size += len(name)
+			for _, variant := range variants {
+				size += proto.Size(variant.Resource)
+			}
+		}
+	}
+	return size
+}
+
+// GetUsage reports the memory usage by node, and by tenant if the tenant
+// function is set. The snapshots are shared with the cache like a view, so
+// they are measured without the cache lock.
+func (cache *snapshotCache) GetUsage(tenant TenantFunc) Usage {
+	cache.mu.Lock()
+	cache.snapshotsShared = true
+	snapshots := cache.snapshots
+	cache.mu.Unlock()
+
+	out := Usage{Nodes: make(map[string]int, len(snapshots))}
+	if tenant != nil {
+		out.Tenants = make(map[string]int)
+	}
+	for node, snapshot := range snapshots {
+		size := snapshot.Size()
+		out.Nodes[node] = size
+		out.Total += size
+		if tenant != nil {
+			out.Tenants[tenant(node)] += size
+		}
+	}
+	if cache.responses != nil {
+		out.Responses = cache.responses.Stats().Bytes
+		out.Total += out.Responses
+	}
+	return out
+}
@@ -0,0 +1,118 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
+	"github.com/envoyproxy/go-control-plane/pkg/resource/v2"
+)
+
+// ReferenceError is a reference to a resource missing from a snapshot.
+type ReferenceError struct {
+	// TypeURL and Name identify the referencing resource.
+	TypeURL string
+	Name    string
+
+	// ReferenceTypeURL and Reference identify the missing resource.
+	ReferenceTypeURL string
+	Reference        string
+}
+
+func (e ReferenceError) Error() string {
+	return fmt.Sprintf("%s %q references missing %s %q",
+		shortTypeName(e.TypeURL), e.Name, shortTypeName(e.ReferenceTypeURL), e.Reference)
+}
+
+func shortTypeName(typeURL string) string {
+	return typeURL[strings.LastIndex(typeURL, ".")+1:]
+}
+
+// ValidationError lists the dangling references of a snapshot.
+type ValidationError struct {
+	Errors []ReferenceError
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		messages[i] = err.Error()
+	}
+	return fmt.Sprintf("%d invalid references: %s", len(e.Errors), strings.Join(messages, "; "))
+}
+
+// Validate verifies that the references across the snapshot types resolve,
+// i.e. that the snapshot includes:
+//
+//   - the clusters referenced by the routes and the TCP proxy listeners,
+//   - the routes referenced over RDS by the listeners and the scoped routes,
+//   - the load assignments of the EDS clusters,
+//   - the secrets referenced over SDS by the listeners and the clusters.
+//
+// Unlike Consistent, Validate reports all the dangling references at once
+// with a *ValidationError, and allows the unreferenced resources.
+func (s *Snapshot) Validate() error {
+	if s == nil {
+		return errors.New("nil snapshot")
+	}
+	var out []ReferenceError
+	check := func(typeURL string, references map[string][]string, referenceTypeURL string, typ types.ResponseType) {
+		for reference, names := range references {
+			if _, exists := s.Resources[typ].Items[reference]; exists {
+				continue
+			}
+			for _, name := range names {
+				out = append(out, ReferenceError{
+					TypeURL:          typeURL,
+					Name:             name,
+					ReferenceTypeURL: referenceTypeURL,
+					Reference:        reference,
+				})
+			}
+		}
+	}
+
+	check(resource.RouteType, GetClusterReferences(s.Resources[types.Route].Items), resource.ClusterType, types.Cluster)
+	check(resource.ListenerType, GetClusterReferences(s.Resources[types.Listener].Items), resource.ClusterType, types.Cluster)
+	check(resource.ListenerType, byReferrer(s.Resources[types.Listener].Items), resource.RouteType, types.Route)
+	check(resource.ScopedRouteType, byReferrer(s.Resources[types.ScopedRoute].Items), resource.RouteType, types.Route)
+	check(resource.ClusterType, byReferrer(s.Resources[types.Cluster].Items), resource.EndpointType, types.Endpoint)
+	check(resource.ListenerType, GetSecretReferences(s.Resources[types.Listener].Items), resource.SecretType, types.Secret)
+	check(resource.ClusterType, GetSecretReferences(s.Resources[types.Cluster].Items), resource.SecretType, types.Secret)
+
+	if len(out) == 0 {
+		return nil
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Error() < out[j].Error()
+	})
+	return &ValidationError{Errors: out}
+}
+
+// byReferrer indexes the resource references by the referenced name with the
+// names of the referencing resources.
+func byReferrer(resources map[string]types.Resource) map[string][]string {
+	out := make(map[string][]string)
+	for name, res := range resources {
+		for reference := range GetResourceReferences(map[string]types.Resource{name: res}) {
+			out[reference] = append(out[reference], name)
+		}
+	}
+	return out
+}
@@ -0,0 +1,184 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package cache
+
+import (
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
+	"github.com/envoyproxy/go-control-plane/pkg/xdstp"
+)
+
+// Variant is a variant of an xdstp resource served to the clients requesting
+// the resource with matching context params, e.g. a listener per zone for the
+// clients that append their zone to the requested names.
+//
+// A requested name matches a variant if it has all the constraint params with
+// equal values, and the other params are ignored. The variant with the most
+// constraints wins, and the ties go to the variant added first. The resource
+// is served under the requested name, so the client finds it in the response.
+//
+// The resources of the snapshot with the exact requested name take precedence
+// over the variants. The version gates do not apply to the variants.
+type Variant struct {
+	// Constraints are the context params required by the variant. A variant
+	// without constraints is the default for the clients matching no other.
+	Constraints map[string]string
+
+	// Resource is served to the matching clients. Its name is replaced by the
+	// requested name in a copy.
+	Resource types.Resource
+}
+
+// AddVariant adds a resource variant to the variant set of an xdstp name. The
+// name must not have context params, since the params of the requested names
+// are matched against the variant constraints instead.
+func (s *Snapshot) AddVariant(typeURL string, name string, variant Variant) error {
+	typ := GetResponseType(typeURL)
+	if typ == types.UnknownType {
+		return fmt.Errorf("unknown type URL %q", typeURL)
+	}
+	urn, err := xdstp.Parse(name)
+	if err != nil {
+		return err
+	}
+	if urn.IsGlob() {
+		return fmt.Errorf("variant name %q is a glob", name)
+	}
+	if len(urn.ContextParams) > 0 {
+		return fmt.Errorf("variant name %q has context params", name)
+	}
+	if urn.TypeURL() != typeURL {
+		return fmt.Errorf("variant name %q does not match type URL %q", name, typeURL)
+	}
+	if variant.Resource == nil {
+		return fmt.Errorf("missing variant resource for %q", name)
+	}
+
+	constraints := make(map[string]string, len(variant.Constraints))
+	for key, value := range variant.Constraints {
+		constraints[key] = value
+	}
+	if s.Resources[typ].Variants == nil {
+		s.Resources[typ].Variants = make(map[string][]Variant)
+	}
+	key := urn.String()
+	s.Resources[typ].Variants[key] = append(s.Resources[typ].Variants[key], Variant{
+		Constraints: constraints,
+		Resource:    variant.Resource,
+	})
+	return nil
+}
+
+// GetVariants returns the resource variant sets for a type, indexed by the
+// name without context params.
+func (s *Snapshot) GetVariants(typeURL string) map[string][]Variant {
+	if s == nil {
+		return nil
+	}
+	typ := GetResponseType(typeURL)
+	if typ == types.UnknownType {
+		return nil
+	}
+	return s.Resources[typ].Variants
+}
+
+// matches checks whether the context params satisfy the variant constraints.
+func (variant Variant) matches(params map[string]string) bool {
+	for key, value := range variant.Constraints {
+		if got, exists := params[key]; !exists || got != value {
+			return false
+		}
+	}
+	return true
+}
+
+// selectVariant selects the matching variant with the most constraints.
+func selectVariant(variants []Variant, params map[string]string) (Variant, bool) {
+	var out Variant
+	found := false
+	for _, variant := range variants {
+		if !variant.matches(params) {
+			continue
+		}
+		if !found || len(variant.Constraints) > len(out.Constraints) {
+			out = variant
+			found = true
+		}
+	}
+	return out, found
+}
+
+// resolveVariants adds the selected variants for the requested xdstp names
+// that are not in the resources, indexed by the canonical requested names.
+// The resources are copied if any variant is added.
+func resolveVariants(resources map[string]types.Resource, variants map[string][]Variant, names []string) map[string]types.Resource {
+	if len(variants) == 0 || len(names) == 0 {
+		return resources
+	}
+	out := resources
+	copied := false
+	for _, name := range names {
+		if !xdstp.IsXDSTP(name) {
+			continue
+		}
+		urn, err := xdstp.Parse(name)
+		if err != nil || urn.IsGlob() {
+			continue
+		}
+		requested := urn.String()
+		if _, exists := out[requested]; exists {
+			continue
+		}
+		base := *urn
+		base.ContextParams = nil
+		variant, found := selectVariant(variants[base.String()], urn.ContextParams)
+		if !found {
+			continue
+		}
+		renamed, err := renameResource(variant.Resource, requested)
+		if err != nil {
+			continue
+		}
+		if !copied {
+			out = make(map[string]types.Resource, len(resources)+len(names))
+			for key, value := range resources {
+				out[key] = value
+			}
+			copied = true
+		}
+		out[requested] = renamed
+	}
+	return out
+}
+
+// renameResource returns a copy of the resource with the name field replaced.
+func renameResource(res types.Resource, name string) (types.Resource, error) {
+	out := proto.Clone(res)
+	msg := proto.MessageReflect(out)
+	fields := msg.Descriptor().Fields()
+	field := fields.ByName("name")
+	if field == nil {
+		field = fields.ByName("cluster_name")
+	}
+	if field == nil || field.Kind() != protoreflect.StringKind {
+		return nil, fmt.Errorf("resource %s has no name field", msg.Descriptor().FullName())
+	}
+	msg.Set(field, protoreflect.ValueOfString(name))
+	return out, nil
+}
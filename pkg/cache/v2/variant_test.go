@@ -0,0 +1,123 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package cache_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	discovery "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	endpoint "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/v2"
+	rsrc "github.com/envoyproxy/go-control-plane/pkg/resource/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/test/resource/v2"
+)
+
+func TestVariants(t *testing.T) {
+	name := variantName("backend")
+	snap := cache.NewSnapshot(version, []types.Resource{
+		resource.MakeEndpoint(name+"?zone=pinned", 9000),
+	}, nil, nil, nil, nil, nil)
+	variants := []struct {
+		constraints map[string]string
+		port        uint32
+	}{
+		{nil, 8000},
+		{map[string]string{"zone": "a"}, 8001},
+		{map[string]string{"zone": "a", "tier": "gold"}, 8002},
+		{map[string]string{"tier": "gold"}, 8003},
+	}
+	for _, variant := range variants {
+		if err := snap.AddVariant(rsrc.EndpointType, name, cache.Variant{
+			Constraints: variant.constraints,
+			Resource:    resource.MakeEndpoint(name, variant.port),
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c := cache.NewSnapshotCache(false, cache.IDHash{}, nil)
+	if err := c.SetSnapshot(key, snap); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		requested string
+		want      string
+		port      uint32
+	}{
+		{requested: name + "?zone=b", want: name + "?zone=b", port: 8000},
+		{requested: name + "?zone=a", want: name + "?zone=a", port: 8001},
+		{requested: name + "?zone=a&tier=gold", want: name + "?tier=gold&zone=a", port: 8002},
+		{requested: name + "?tier=gold&zone=b", want: name + "?tier=gold&zone=b", port: 8003},
+		{requested: name + "?zone=pinned", want: name + "?zone=pinned", port: 9000},
+	}
+	for _, test := range tests {
+		out, err := c.Fetch(context.Background(), &discovery.DiscoveryRequest{
+			Node:          &core.Node{Id: key},
+			TypeUrl:       rsrc.EndpointType,
+			ResourceNames: []string{test.requested},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		resources := out.(*cache.RawResponse).Resources
+		if len(resources) != 1 {
+			t.Fatalf("variant for %q => got %d resources, want 1", test.requested, len(resources))
+		}
+		cla := resources[0].(*endpoint.ClusterLoadAssignment)
+		if got := cla.GetClusterName(); got != test.want {
+			t.Errorf("variant name for %q => got %q, want %q", test.requested, got, test.want)
+		}
+		port := cla.GetEndpoints()[0].GetLbEndpoints()[0].GetEndpoint().GetAddress().GetSocketAddress().GetPortValue()
+		if port != test.port {
+			t.Errorf("variant for %q => got port %d, want %d", test.requested, port, test.port)
+		}
+	}
+
+	if got := cache.GetResourceName(snap.GetVariants(rsrc.EndpointType)[name][0].Resource); got != name {
+		t.Errorf("variant resource renamed in place => got %q, want %q", got, name)
+	}
+	if got := snap.GetResources(rsrc.EndpointType); len(got) != 1 {
+		t.Errorf("snapshot resources => got %d, want 1", len(got))
+	}
+}
+
+func TestAddVariantErrors(t *testing.T) {
+	name := variantName("backend")
+	res := resource.MakeEndpoint(name, 8080)
+	snap := cache.Snapshot{}
+	for _, test := range []struct {
+		typeURL, name string
+		res           types.Resource
+	}{
+		{typeURL: "unknown", name: name, res: res},
+		{typeURL: rsrc.EndpointType, name: clusterName, res: res},
+		{typeURL: rsrc.EndpointType, name: variantName("*"), res: res},
+		{typeURL: rsrc.EndpointType, name: name + "?zone=a", res: res},
+		{typeURL: rsrc.ClusterType, name: name, res: res},
+		{typeURL: rsrc.EndpointType, name: name},
+	} {
+		if err := snap.AddVariant(test.typeURL, test.name, cache.Variant{Resource: test.res}); err == nil {
+			t.Errorf("AddVariant(%q, %q) => got no error", test.typeURL, test.name)
+		}
+	}
+}
+
+func variantName(id string) string {
+	return "xdstp://auth/" + strings.TrimPrefix(rsrc.EndpointType, "type.googleapis.com/") + "/" + id
+}
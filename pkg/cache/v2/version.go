@@ -0,0 +1,181 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
+)
+
+// VersionProvider computes the version info of the resources of a type sent
+// to the clients, e.g. a counter, a content hash, or the commit SHA of the
+// configuration repository of a GitOps control plane.
+type VersionProvider interface {
+	// Version returns the version of the resources of a type. The previous
+	// version is empty for the first version of the type.
+	Version(typeURL string, resources map[string]types.Resource, previous string) (string, error)
+}
+
+// VersionProviderFunc is a function implementing VersionProvider.
+type VersionProviderFunc func(typeURL string, resources map[string]types.Resource, previous string) (string, error)
+
+// Version implements VersionProvider.
+func (f VersionProviderFunc) Version(typeURL string, resources map[string]types.Resource, previous string) (string, error) {
+	return f(typeURL, resources, previous)
+}
+
+// CounterVersions increments a decimal counter at every version, starting
+// from 1 or from a previous version that is not a counter.
+type CounterVersions struct{}
+
+// Version implements VersionProvider.
+func (CounterVersions) Version(_ string, _ map[string]types.Resource, previous string) (string, error) {
+	n, err := strconv.ParseUint(previous, 10, 64)
+	if err != nil {
+		n = 0
+	}
+	return strconv.FormatUint(n+1, 10), nil
+}
+
+// HashVersions computes the versions from the names and the deterministically
+// serialized resources, so that the replicas of the control plane agree on
+// the versions, and the unchanged resources keep their version.
+type HashVersions struct{}
+
+// Version implements VersionProvider.
+func (HashVersions) Version(_ string, resources map[string]types.Resource, _ string) (string, error) {
+	return resourcesVersion(resources)
+}
+
+// ExternalVersion uses an externally supplied version, e.g. the commit SHA
+// of the last synchronized configuration, for all the types. The version must
+// change along with the resources.
+func ExternalVersion(version func() string) VersionProvider {
+	return VersionProviderFunc(func(string, map[string]types.Resource, string) (string, error) {
+		v := version()
+		if v == "" {
+			return "", errors.New("empty external version")
+		}
+		return v, nil
+	})
+}
+
+// WithVersionProvider replaces the versions of the snapshots set by
+// SetSnapshot, and of the types updated by UpsertResources, by the versions
+// of the provider. The versions of the signed snapshots are kept. Without a
+// provider, UpsertResources hashes the resources.
+func WithVersionProvider(provider VersionProvider) SnapshotCacheOption {
+	return func(cache *snapshotCache) {
+		cache.versions = provider
+	}
+}
+
+// provideVersions sets the versions of the snapshot types from the provider,
+// given the previous snapshot of the node. The cache lock must be held.
+func (cache *snapshotCache) provideVersions(node string, snapshot *Snapshot) error {
+	if cache.versions == nil || snapshot.Signature != nil {
+		return nil
+	}
+	previous := cache.snapshots[node]
+	for typ := range snapshot.Resources {
+		typeURL := GetResponseTypeURL(types.ResponseType(typ))
+		version, err := cache.versions.Version(typeURL, snapshot.Resources[typ].Items, previous.Resources[typ].Version)
+		if err != nil {
+			return fmt.Errorf("snapshot for node %s: %s version: %v", node, typeURL, err)
+		}
+		snapshot.Resources[typ].Version = version
+	}
+	return nil
+}
+
+// typeVersion computes the version of the resources of a type updated in
+// place, by content hash unless a provider is set.
+func (cache *snapshotCache) typeVersion(typeURL string, items map[string]types.Resource, previous string) (string, error) {
+	if cache.versions == nil {
+		return resourcesVersion(items)
+	}
+	return cache.versions.Version(typeURL, items, previous)
+}
+
+// linearVersionHistory is the number of past versions a linear cache with a
+// version provider recognizes in the requests. The clients at older versions
+// receive all their requested resources.
+const linearVersionHistory = 128
+
+// WithLinearVersionProvider sends the versions of the provider instead of
+// the counter versions, e.g. WithLinearVersionProvider(HashVersions{}). The
+// provider is called with all the resources of the collection at every
+// update, and the counter version is sent if the provider fails.
+func WithLinearVersionProvider(provider VersionProvider) LinearCacheOption {
+	return func(cache *LinearCache) {
+		cache.versions = provider
+	}
+}
+
+// currentVersion returns the version info of the collection.
+func (cache *LinearCache) currentVersion() string {
+	if cache.versions == nil {
+		return cache.versionPrefix + strconv.FormatUint(cache.version, 10)
+	}
+	return cache.versionInfo
+}
+
+// parseVersion returns the counter version of a request version info.
+func (cache *LinearCache) parseVersion(versionInfo string) (uint64, error) {
+	if cache.versions != nil {
+		if version, exists := cache.versionHistory[versionInfo]; exists {
+			return version, nil
+		}
+		return 0, errors.New("unknown version")
+	}
+	if !strings.HasPrefix(versionInfo, cache.versionPrefix) {
+		return 0, errors.New("mis-matched version prefix")
+	}
+	return strconv.ParseUint(versionInfo[len(cache.versionPrefix):], 0, 64)
+}
+
+// provideVersion computes the version info of the current counter version
+// with the provider. The cache lock must be held.
+func (cache *LinearCache) provideVersion() {
+	if cache.versions == nil {
+		return
+	}
+	resources := make(map[string]types.Resource, cache.store.Len())
+	err := cache.store.Range(func(name string, resource types.Resource) {
+		resources[name] = resource
+	})
+	version := ""
+	if err == nil {
+		version, err = cache.versions.Version(cache.typeURL, resources, cache.versionInfo)
+	}
+	if err != nil || version == "" {
+		version = cache.versionPrefix + strconv.FormatUint(cache.version, 10)
+	}
+	cache.versionInfo = version
+
+	// a repeated version, e.g. a content hash, refers to the latest counter
+	if _, exists := cache.versionHistory[version]; !exists {
+		cache.versionOrder = append(cache.versionOrder, version)
+	}
+	cache.versionHistory[version] = cache.version
+	if len(cache.versionOrder) > linearVersionHistory {
+		delete(cache.versionHistory, cache.versionOrder[0])
+		cache.versionOrder = cache.versionOrder[1:]
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package cache_test
+
+import (
+	"testing"
+
+	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/v2"
+	rsrc "github.com/envoyproxy/go-control-plane/pkg/resource/v2"
+)
+
+func TestCounterVersions(t *testing.T) {
+	for previous, want := range map[string]string{"": "1", "1": "2", "41": "42", "abc": "1"} {
+		if got, err := (cache.CounterVersions{}).Version(rsrc.ClusterType, nil, previous); err != nil || got != want {
+			t.Errorf("Version(%q) => got %q, %v, want %q", previous, got, err, want)
+		}
+	}
+}
+
+func TestVersionProvider(t *testing.T) {
+	commit := "3f2a9c1"
+	c := cache.NewSnapshotCache(false, group{}, logger{t: t},
+		cache.WithVersionProvider(cache.ExternalVersion(func() string { return commit })))
+	if err := c.SetSnapshot(key, snapshot); err != nil {
+		t.Fatal(err)
+	}
+	got, err := c.GetSnapshot(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, typeURL := range []string{rsrc.ClusterType, rsrc.EndpointType, rsrc.ListenerType} {
+		if version := got.GetVersion(typeURL); version != commit {
+			t.Errorf("%s version => got %q, want %q", typeURL, version, commit)
+		}
+	}
+
+	// the upserted types take the version of the provider
+	commit = "8b0e7d4"
+	if err := c.UpsertResources(key, rsrc.ClusterType, nil, []string{clusterName}); err != nil {
+		t.Fatal(err)
+	}
+	got, _ = c.GetSnapshot(key)
+	if version := got.GetVersion(rsrc.ClusterType); version != commit {
+		t.Errorf("upserted version => got %q, want %q", version, commit)
+	}
+
+	// the snapshots are rejected without a version
+	commit = ""
+	if err := c.SetSnapshot(key, snapshot); err == nil {
+		t.Error("SetSnapshot() with an empty version => got no error")
+	}
+
+	hashed := cache.NewSnapshotCache(false, group{}, logger{t: t}, cache.WithVersionProvider(cache.HashVersions{}))
+	if err := hashed.SetSnapshot(key, snapshot); err != nil {
+		t.Fatal(err)
+	}
+	first, _ := hashed.GetSnapshot(key)
+	renamed := cache.NewSnapshot(version2, []types.Resource{testEndpoint}, []types.Resource{testCluster}, nil, nil, nil, nil)
+	if err := hashed.SetSnapshot(key, renamed); err != nil {
+		t.Fatal(err)
+	}
+	second, _ := hashed.GetSnapshot(key)
+	if a, b := first.GetVersion(rsrc.ClusterType), second.GetVersion(rsrc.ClusterType); a != b || a == version {
+		t.Errorf("hashed versions => got %q and %q, want the same content hash", a, b)
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package cache
+
+import (
+	"sort"
+)
+
+// View is an immutable point-in-time view of the snapshots and the statuses
+// of a snapshot cache. The view is read without the cache lock, so iterating
+// over a large fleet does not block the snapshot updates. The status infos
+// of the view are live, and report the current watches and acknowledgements
+// of the nodes.
+type View struct {
+	snapshots map[string]Snapshot
+	status    map[string]*statusInfo
+}
+
+// GetSnapshot returns the snapshot of a node in the view.
+func (v View) GetSnapshot(node string) (Snapshot, bool) {
+	snapshot, exists := v.snapshots[node]
+	return snapshot, exists
+}
+
+// GetSnapshotKeys returns the sorted node IDs with a snapshot in the view.
+func (v View) GetSnapshotKeys() []string {
+	out := make([]string, 0, len(v.snapshots))
+	for node := range v.snapshots {
+		out = append(out, node)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// GetStatusInfo returns the status of a node in the view, or nil.
+func (v View) GetStatusInfo(node string) StatusInfo {
+	info, exists := v.status[node]
+	if !exists {
+		return nil
+	}
+	return info
+}
+
+// GetStatusKeys returns the sorted node IDs with a status in the view.
+func (v View) GetStatusKeys() []string {
+	out := make([]string, 0, len(v.status))
+	for node := range v.status {
+		out = append(out, node)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// View returns a view of the cache. The maps of the cache are shared with the
+// view, and copied on the next write.
+func (cache *snapshotCache) View() View {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	cache.snapshotsShared = true
+	cache.statusShared = true
+	return View{snapshots: cache.snapshots, status: cache.status}
+}
+
+// mutableSnapshots returns the snapshots for a write, copied if a view shares
+// them. The cache lock must be held for writing.
+func (cache *snapshotCache) mutableSnapshots() map[string]Snapshot {
+	if cache.snapshotsShared {
+		snapshots := make(map[string]Snapshot, len(cache.snapshots))
+		for node, snapshot := range cache.snapshots {
+			snapshots[node] = snapshot
+		}
+		cache.snapshots = snapshots
+		cache.snapshotsShared = false
+	}
+	return cache.snapshots
+}
+
+// mutableStatus returns the statuses for a write, copied if a view shares
+// them. The cache lock must be held for writing.
+func (cache *snapshotCache) mutableStatus() map[string]*statusInfo {
+	if cache.statusShared {
+		status := make(map[string]*statusInfo, len(cache.status))
+		for node, info := range cache.status {
+			status[node] = info
+		}
+		cache.status = status
+		cache.statusShared = false
+	}
+	return cache.status
+}
@@ -0,0 +1,89 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package cache_test
+
+import (
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+
+	discovery "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/v2"
+	rsrc "github.com/envoyproxy/go-control-plane/pkg/resource/v2"
+)
+
+func TestView(t *testing.T) {
+	c := cache.NewSnapshotCache(false, cache.IDHash{}, nil)
+	if err := c.SetSnapshot("a", snapshot); err != nil {
+		t.Fatal(err)
+	}
+	c.CreateWatch(&discovery.DiscoveryRequest{Node: &core.Node{Id: "a"}, TypeUrl: rsrc.ClusterType, VersionInfo: version})
+	view := c.View()
+
+	if err := c.SetSnapshot("b", snapshot); err != nil {
+		t.Fatal(err)
+	}
+	c.ClearSnapshot("a")
+
+	if got, exists := view.GetSnapshot("a"); !exists || got.GetVersion(rsrc.ClusterType) != version {
+		t.Errorf("view snapshot => got %v, want version %q", got, version)
+	}
+	if got := view.GetSnapshotKeys(); !reflect.DeepEqual(got, []string{"a"}) {
+		t.Errorf("view snapshot keys => got %v, want [a]", got)
+	}
+	if info := view.GetStatusInfo("a"); info == nil || info.GetNode().GetId() != "a" {
+		t.Errorf("view status => got %v, want node a", info)
+	}
+	if info := view.GetStatusInfo("b"); info != nil {
+		t.Errorf("view status => got %v, want none", info)
+	}
+
+	view = c.View()
+	if got := view.GetSnapshotKeys(); !reflect.DeepEqual(got, []string{"b"}) {
+		t.Errorf("new view snapshot keys => got %v, want [b]", got)
+	}
+	if _, exists := view.GetSnapshot("a"); exists {
+		t.Error("new view cleared snapshot => got a snapshot")
+	}
+}
+
+func TestViewConcurrentUpdates(t *testing.T) {
+	c := cache.NewSnapshotCache(false, cache.IDHash{}, nil)
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			_ = c.SetSnapshot(strconv.Itoa(i%10), snapshot)
+			if i%7 == 0 {
+				c.ClearSnapshot(strconv.Itoa(i % 10))
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			view := c.View()
+			for _, node := range view.GetSnapshotKeys() {
+				if _, exists := view.GetSnapshot(node); !exists {
+					t.Errorf("view snapshot %q => got none", node)
+				}
+			}
+		}
+	}()
+	wg.Wait()
+}
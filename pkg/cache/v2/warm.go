@@ -0,0 +1,161 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package cache
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
+)
+
+// WarmPool pre-provisions the clusters of a traffic shift. The warm clusters
+// are added to the snapshots before any route sends traffic to them, so that
+// the proxies create the clusters and health check the endpoints. The rollout
+// controller increases the weights once the clusters are ready:
+//
+//	pool := NewWarmPool(merger, 0.9)
+//	pool.Add(canary, canaryEndpoints)
+//	merger.SetSnapshot(node, pool.Apply(snapshot))
+//	if err := pool.WaitReady(ctx, "canary", time.Second); err == nil {
+//		// shift the traffic, and promote the cluster to the snapshots
+//		pool.Remove("canary")
+//	}
+//
+// The readiness is based on the endpoint statuses merged by the health merger
+// from HDS and the external checkers.
+type WarmPool struct {
+	health     *HealthMerger
+	minHealthy float64
+
+	clusters   map[string]warmCluster
+	generation int
+	mu         sync.Mutex
+}
+
+type warmCluster struct {
+	cluster   types.Resource
+	endpoints types.Resource
+}
+
+// NewWarmPool creates a warm pool. The clusters are ready once the fraction of
+// the healthy endpoints reaches the minimum.
+func NewWarmPool(health *HealthMerger, minHealthy float64) *WarmPool {
+	return &WarmPool{
+		health:     health,
+		minHealthy: minHealthy,
+		clusters:   make(map[string]warmCluster),
+	}
+}
+
+// Add registers a warm cluster with its load assignment.
+func (p *WarmPool) Add(cluster, endpoints types.Resource) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.clusters[GetResourceName(cluster)] = warmCluster{cluster: cluster, endpoints: endpoints}
+	p.generation++
+}
+
+// Remove unregisters a warm cluster, once it is promoted to the snapshots or
+// abandoned.
+func (p *WarmPool) Remove(name string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, exists := p.clusters[name]; exists {
+		delete(p.clusters, name)
+		p.generation++
+	}
+}
+
+// Apply adds the warm clusters missing from the snapshot, and extends the
+// cluster and endpoint versions with the pool generation.
+func (p *WarmPool) Apply(snapshot Snapshot) Snapshot {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.clusters) == 0 {
+		return snapshot
+	}
+
+	out := snapshot
+	clusters := snapshot.Resources[types.Cluster]
+	endpoints := snapshot.Resources[types.Endpoint]
+	clusters.Items = copyItems(clusters.Items)
+	endpoints.Items = copyItems(endpoints.Items)
+	for name, warm := range p.clusters {
+		if _, exists := clusters.Items[name]; exists {
+			continue
+		}
+		clusters.Items[name] = warm.cluster
+		endpoints.Items[GetResourceName(warm.endpoints)] = warm.endpoints
+	}
+	clusters.Version = fmt.Sprintf("%s+warm.%d", clusters.Version, p.generation)
+	endpoints.Version = fmt.Sprintf("%s+warm.%d", endpoints.Version, p.generation)
+	out.Resources[types.Cluster] = clusters
+	out.Resources[types.Endpoint] = endpoints
+	return out
+}
+
+func copyItems(items map[string]types.Resource) map[string]types.Resource {
+	out := make(map[string]types.Resource, len(items))
+	for name, item := range items {
+		out[name] = item
+	}
+	return out
+}
+
+// Ready returns whether the warm cluster is ready with the fraction of its
+// healthy endpoints.
+func (p *WarmPool) Ready(name string) (bool, float64, error) {
+	p.mu.Lock()
+	warm, exists := p.clusters[name]
+	p.mu.Unlock()
+	if !exists {
+		return false, 0, fmt.Errorf("no warm cluster %q", name)
+	}
+
+	var total, healthy int
+	forEachEndpoint(warm.endpoints, func(key EndpointKey, declared *core.HealthStatus) {
+		total++
+		if p.health.Health(key, *declared) == core.HealthStatus_HEALTHY {
+			healthy++
+		}
+	})
+	if total == 0 {
+		return false, 0, nil
+	}
+	fraction := float64(healthy) / float64(total)
+	return fraction >= p.minHealthy, fraction, nil
+}
+
+// WaitReady polls the readiness of the warm cluster at every interval until
+// it is ready or the context is done.
+func (p *WarmPool) WaitReady(ctx context.Context, name string, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		ready, fraction, err := p.Ready(name)
+		if err != nil || ready {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("warm cluster %q is %.0f%% healthy: %v", name, 100*fraction, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
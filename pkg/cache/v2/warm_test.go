@@ -0,0 +1,86 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package cache_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/v2"
+	rsrc "github.com/envoyproxy/go-control-plane/pkg/resource/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/test/resource/v2"
+)
+
+func TestWarmPool(t *testing.T) {
+	c := cache.NewSnapshotCache(false, group{}, logger{t: t})
+	merger := cache.NewHealthMerger(c, cache.WithHealthThresholds(1, 1))
+	pool := cache.NewWarmPool(merger, 0.5)
+
+	canary := resource.MakeCluster(resource.Ads, "canary")
+	pool.Add(canary, resource.MakeEndpoints("canary", 9000, 4))
+	snap := pool.Apply(snapshot)
+	if got := snap.GetResources(rsrc.ClusterType); len(got) != 2 || got["canary"] != canary {
+		t.Errorf("Apply() clusters => got %v, want the warm cluster added", got)
+	}
+	if got := snap.GetResources(rsrc.EndpointType); len(got) != 2 || got["canary"] == nil {
+		t.Errorf("Apply() endpoints => got %v, want the warm endpoints added", got)
+	}
+	if snap.GetVersion(rsrc.ClusterType) == version || snap.GetVersion(rsrc.RouteType) != version {
+		t.Errorf("Apply() versions => got %q, %q", snap.GetVersion(rsrc.ClusterType), snap.GetVersion(rsrc.RouteType))
+	}
+	if len(snapshot.GetResources(rsrc.ClusterType)) != 1 {
+		t.Error("the applied snapshot is modified")
+	}
+	if err := snap.Consistent(); err != nil {
+		t.Errorf("Apply() => got inconsistent snapshot: %v", err)
+	}
+	if err := merger.SetSnapshot(key, snap); err != nil {
+		t.Fatal(err)
+	}
+
+	// the cluster is ready once half of the endpoints are healthy
+	for i, status := range []core.HealthStatus{core.HealthStatus_HEALTHY, core.HealthStatus_UNHEALTHY, core.HealthStatus_HEALTHY} {
+		merger.Report(cache.HealthHDS, cache.EndpointKey{Cluster: "canary", Address: "127.0.0.1", Port: uint32(9000 + i)}, status)
+		ready, fraction, err := pool.Ready("canary")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := i == 2; ready != want {
+			t.Errorf("Ready() after %d reports => got %v with %v healthy, want %v", i+1, ready, fraction, want)
+		}
+	}
+	if err := pool.WaitReady(context.Background(), "canary", time.Millisecond); err != nil {
+		t.Errorf("WaitReady() => got %v", err)
+	}
+
+	// the cluster is not applied once promoted
+	pool.Remove("canary")
+	if _, _, err := pool.Ready("canary"); err == nil {
+		t.Error("Ready() after removal => got no error")
+	}
+	if got := pool.Apply(snapshot); got.GetVersion(rsrc.ClusterType) != version {
+		t.Errorf("Apply() on empty pool => got version %q, want %q", got.GetVersion(rsrc.ClusterType), version)
+	}
+
+	// an unhealthy cluster is never ready
+	pool.Add(resource.MakeCluster(resource.Ads, "broken"), resource.MakeEndpoint("broken", 9100))
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := pool.WaitReady(ctx, "broken", time.Millisecond); err == nil {
+		t.Error("WaitReady() on unhealthy cluster => got no error")
+	}
+}
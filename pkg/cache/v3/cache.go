@@ -19,11 +19,16 @@ package cache
 import (
 	"context"
 	"fmt"
+	"runtime/trace"
 	"sync/atomic"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/any"
+	"google.golang.org/protobuf/reflect/protoreflect"
 
 	discovery "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
 	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
-	"github.com/golang/protobuf/ptypes/any"
 )
 
 // Request is an alias for the discovery request type.
@@ -85,8 +90,32 @@ type RawResponse struct {
 	// Resources to be included in the response.
 	Resources []types.Resource
 
+	// TTLs are the optional resource TTLs indexed by name. The resources with
+	// a TTL are wrapped in the discovery resource envelope.
+	TTLs map[string]time.Duration
+
+	// Heartbeat marks the response as only refreshing the TTLs of the
+	// resources, which are sent without their contents.
+	Heartbeat bool
+
+	// Marshaled optionally shares the marshaled resources with the other
+	// responses, at the response version. The resources without a known
+	// name are not shared.
+	Marshaled *MarshalCache
+
+	// marshalScope is the scope of the resources in the marshal cache, empty
+	// for the resources shared across the nodes
+	marshalScope string
+
 	// marshaledResponse holds an atomic reference to the serialized discovery response.
 	marshaledResponse atomic.Value
+
+	// group optionally shares the marshaled resources with the responses to
+	// the same update, see responseGroup
+	group *responseGroup
+
+	// err optionally fails the response, see WithStrictNames
+	err error
 }
 
 var _ Response = &RawResponse{}
@@ -106,22 +135,44 @@ var _ Response = &PassthroughResponse{}
 // This is necessary because the marshalled response does not change across the calls.
 // This caching behavior is important in high throughput scenarios because grpc marshalling has a cost and it drives the cpu utilization under load.
 func (r *RawResponse) GetDiscoveryResponse() (*discovery.DiscoveryResponse, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
 
 	marshaledResponse := r.marshaledResponse.Load()
 
+	if marshaledResponse == nil && r.group != nil {
+		if marshaledResources, ok := r.group.marshaled.Load().([]*any.Any); ok {
+			marshaledResponse = &discovery.DiscoveryResponse{
+				VersionInfo: r.Version,
+				Resources:   marshaledResources,
+				TypeUrl:     r.Request.TypeUrl,
+			}
+			r.marshaledResponse.Store(marshaledResponse)
+		}
+	}
+
 	if marshaledResponse == nil {
+		defer trace.StartRegion(context.Background(), "xds.marshal").End()
 
 		marshaledResources := make([]*any.Any, len(r.Resources))
 
 		for i, resource := range r.Resources {
-			marshaledResource, err := MarshalResource(resource)
-			if err != nil {
-				return nil, err
+			var marshaledAny *any.Any
+			if !r.Heartbeat {
+				var err error
+				if marshaledAny, err = r.marshalResource(resource); err != nil {
+					return nil, err
+				}
 			}
-			marshaledResources[i] = &any.Any{
-				TypeUrl: r.Request.TypeUrl,
-				Value:   marshaledResource,
+			if ttl, exists := r.TTLs[GetResourceName(resource)]; exists && ttlField != nil {
+				wrapped, err := wrapResource(GetResourceName(resource), marshaledAny, ttl)
+				if err != nil {
+					return nil, err
+				}
+				marshaledAny = wrapped
 			}
+			marshaledResources[i] = marshaledAny
 		}
 
 		marshaledResponse = &discovery.DiscoveryResponse{
@@ -131,11 +182,38 @@ func (r *RawResponse) GetDiscoveryResponse() (*discovery.DiscoveryResponse, erro
 		}
 
 		r.marshaledResponse.Store(marshaledResponse)
+		if r.group != nil {
+			r.group.marshaled.Store(marshaledResources)
+		}
 	}
 
 	return marshaledResponse.(*discovery.DiscoveryResponse), nil
 }
 
+// marshalResource marshals a resource, or reuses it from the marshal cache.
+func (r *RawResponse) marshalResource(resource types.Resource) (*any.Any, error) {
+	if name := GetResourceName(resource); r.Marshaled != nil && name != "" {
+		return r.Marshaled.marshal(r.marshalScope, r.Request.TypeUrl, name, r.Version, resource)
+	}
+	marshaled, err := MarshalResource(resource)
+	if err != nil {
+		return nil, err
+	}
+	return &any.Any{TypeUrl: r.Request.TypeUrl, Value: marshaled}, nil
+}
+
+// ttlField is the TTL field of the discovery resource envelope, or nil if the
+// API version has none.
+var ttlField = (&discovery.Resource{}).ProtoReflect().Descriptor().Fields().ByName("ttl")
+
+// wrapResource wraps a resource in the discovery resource envelope with a TTL.
+// The resource is omitted from the heartbeats.
+func wrapResource(name string, resource *any.Any, ttl time.Duration) (*any.Any, error) {
+	wrapper := &discovery.Resource{Name: name, Resource: resource}
+	wrapper.ProtoReflect().Set(ttlField, protoreflect.ValueOfMessage(ptypes.DurationProto(ttl).ProtoReflect()))
+	return ptypes.MarshalAny(wrapper)
+}
+
 // GetRequest returns the original Discovery Request.
 func (r *RawResponse) GetRequest() *discovery.DiscoveryRequest {
 	return r.Request
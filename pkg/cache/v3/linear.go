@@ -18,10 +18,15 @@ package cache
 import (
 	"context"
 	"errors"
+	"fmt"
 	"strconv"
-	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/golang/protobuf/ptypes/any"
+
+	discovery "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
 	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
 )
 
@@ -33,10 +38,14 @@ type watches = map[chan Response]struct{}
 // should be combined with other caches via type URL muxing. It can be used to
 // supply EDS entries, for example, uniformly across a fleet of proxies.
 type LinearCache struct {
+	// Unique ID ordering the caches locked by a transaction.
+	id uint64
 	// Type URL specific to the cache.
 	typeURL string
 	// Collection of resources indexed by name.
-	resources map[string]types.Resource
+	store ResourceStore
+	// Initial resources added to the store on creation.
+	initial map[string]types.Resource
 	// Watches open by clients, indexed by resource name. Whenever resources
 	// are changed, the watch is triggered.
 	watches map[string]watches
@@ -48,7 +57,31 @@ type LinearCache struct {
 	versionPrefix string
 	// Versions for each resource by name.
 	versionVector map[string]uint64
-	mu            sync.Mutex
+	// Optional provider of the version info, the current version info, and
+	// the counter versions of the recent version infos.
+	versions       VersionProvider
+	versionInfo    string
+	versionHistory map[string]uint64
+	versionOrder   []string
+	// Optional cache of the marshaled resources shared across the responses.
+	marshaled *MarshalCache
+	// Resources read per turn of the fair notifications, if set.
+	quantum int
+	// Notifications built by the fair scheduler, in the round-robin order.
+	notifications []*notification
+	// Set while the fair scheduler goroutine runs.
+	draining bool
+	// Optional registry of the resource owners.
+	ownership *Ownership
+	// Subscriptions by resource name, and to all the resources.
+	subscribers         map[string]int
+	wildcardSubscribers int
+	// Optional callback of the unwatched resources after a grace period, and
+	// the pending calls by resource name.
+	grace       time.Duration
+	onUnwatched func(name string)
+	unwatched   map[string]*time.Timer
+	mu          sync.Mutex
 }
 
 var _ Cache = &LinearCache{}
@@ -68,50 +101,150 @@ func WithVersionPrefix(prefix string) LinearCacheOption {
 // WithInitialResources initializes the initial set of resources.
 func WithInitialResources(resources map[string]types.Resource) LinearCacheOption {
 	return func(cache *LinearCache) {
-		cache.resources = resources
-		for name := range resources {
-			cache.versionVector[name] = 0
-		}
+		cache.initial = resources
+	}
+}
+
+// WithResourceStore keeps the resources in a store instead of the memory of
+// the cache. The resources already in the store are served at the initial
+// version.
+func WithResourceStore(store ResourceStore) LinearCacheOption {
+	return func(cache *LinearCache) {
+		cache.store = store
 	}
 }
 
+// WithLinearMarshalCache marshals each resource once per version, and shares
+// the marshaled resources across the responses. The marshal cache must not be
+// shared with another cache of the same type URL.
+func WithLinearMarshalCache(marshaled *MarshalCache) LinearCacheOption {
+	return func(cache *LinearCache) {
+		cache.marshaled = marshaled
+	}
+}
+
+// linearCacheIDs is the last assigned cache ID.
+var linearCacheIDs uint64
+
 // NewLinearCache creates a new cache. See the comments on the struct definition.
+// It panics if the initial resources cannot be added to the store, see
+// OpenLinearCache.
 func NewLinearCache(typeURL string, opts ...LinearCacheOption) *LinearCache {
+	out, err := OpenLinearCache(typeURL, opts...)
+	if err != nil {
+		panic(err.Error())
+	}
+	return out
+}
+
+// OpenLinearCache creates a new cache like NewLinearCache, and returns an
+// error if the initial resources cannot be added to the store or the
+// resources already in the store cannot be read, e.g. a store on disk.
+func OpenLinearCache(typeURL string, opts ...LinearCacheOption) (*LinearCache, error) {
 	out := &LinearCache{
+		id:            atomic.AddUint64(&linearCacheIDs, 1),
 		typeURL:       typeURL,
-		resources:     make(map[string]types.Resource),
+		store:         NewMemoryStore(),
 		watches:       make(map[string]watches),
 		watchAll:      make(watches),
 		version:       0,
 		versionVector: make(map[string]uint64),
+		subscribers:   make(map[string]int),
+		unwatched:     make(map[string]*time.Timer),
 	}
 	for _, opt := range opts {
 		opt(out)
 	}
-	return out
+	for name, resource := range out.initial {
+		if err := out.store.Set(name, resource); err != nil {
+			return nil, fmt.Errorf("initial resource %q: %v", name, err)
+		}
+	}
+	out.initial = nil
+	if err := out.store.Range(func(name string, _ types.Resource) {
+		out.versionVector[name] = 0
+	}); err != nil {
+		return nil, fmt.Errorf("resource store: %v", err)
+	}
+	if out.versions != nil {
+		out.versionHistory = make(map[string]uint64)
+		out.provideVersion()
+	}
+	return out, nil
 }
 
+// respond sends the resources to the watch, or closes the watch if the store
+// or the marshaling fails, in which case the server closes the stream.
 func (cache *LinearCache) respond(value chan Response, staleResources []string) {
+	var names []string
 	var resources []types.Resource
+	var versions []uint64
+	var err error
 	// TODO: optimize the resources slice creations across different clients
 	if len(staleResources) == 0 {
-		resources = make([]types.Resource, 0, len(cache.resources))
-		for _, resource := range cache.resources {
+		resources = make([]types.Resource, 0, cache.store.Len())
+		err = cache.store.Range(func(name string, resource types.Resource) {
+			names = append(names, name)
 			resources = append(resources, resource)
-		}
+			versions = append(versions, cache.versionVector[name])
+		})
 	} else {
 		resources = make([]types.Resource, 0, len(staleResources))
+		seen := make(map[string]struct{}, len(staleResources))
 		for _, name := range staleResources {
-			resource := cache.resources[name]
+			// the names requested more than once are sent once
+			if _, exists := seen[name]; exists {
+				continue
+			}
+			seen[name] = struct{}{}
+			var resource types.Resource
+			if resource, err = cache.store.Get(name); err != nil {
+				break
+			}
 			if resource != nil {
+				names = append(names, name)
 				resources = append(resources, resource)
+				versions = append(versions, cache.versionVector[name])
 			}
 		}
 	}
-	value <- &RawResponse{
-		Request:   &Request{TypeUrl: cache.typeURL},
-		Resources: resources,
-		Version:   cache.versionPrefix + strconv.FormatUint(cache.version, 10),
+	if err != nil {
+		close(value)
+		return
+	}
+	cache.send(value, names, resources, versions, cache.currentVersion())
+}
+
+// send sends the named resources to the watch at a version, given the
+// versions of the resources when they were read.
+func (cache *LinearCache) send(value chan Response, names []string, resources []types.Resource, versions []uint64, version string) {
+	var err error
+	request := &Request{TypeUrl: cache.typeURL}
+	if cache.marshaled == nil {
+		value <- &RawResponse{
+			Request:   request,
+			Resources: resources,
+			Version:   version,
+		}
+		return
+	}
+
+	// the marshaled resources are shared at the resource versions
+	marshaled := make([]*any.Any, len(resources))
+	for i, resource := range resources {
+		resourceVersion := strconv.FormatUint(versions[i], 10)
+		if marshaled[i], err = cache.marshaled.marshal("", cache.typeURL, names[i], resourceVersion, resource); err != nil {
+			close(value)
+			return
+		}
+	}
+	value <- &PassthroughResponse{
+		Request: request,
+		DiscoveryResponse: &discovery.DiscoveryResponse{
+			VersionInfo: version,
+			Resources:   marshaled,
+			TypeUrl:     cache.typeURL,
+		},
 	}
 }
 
@@ -124,6 +257,10 @@ func (cache *LinearCache) notifyAll(modified map[string]struct{}) {
 		}
 		delete(cache.watches, name)
 	}
+	if cache.quantum > 0 {
+		cache.schedule(notifyList)
+		return
+	}
 	for value, stale := range notifyList {
 		cache.respond(value, stale)
 	}
@@ -135,15 +272,30 @@ func (cache *LinearCache) notifyAll(modified map[string]struct{}) {
 
 // UpdateResource updates a resource in the collection.
 func (cache *LinearCache) UpdateResource(name string, res types.Resource) error {
+	if res == nil {
+		return errors.New("nil resource")
+	}
+	if cache.ownership != nil {
+		return cache.ownership.write("", cache.typeURL, "", []string{name}, nil, func() error {
+			return cache.updateResource(name, res)
+		})
+	}
+	return cache.updateResource(name, res)
+}
+
+func (cache *LinearCache) updateResource(name string, res types.Resource) error {
 	if res == nil {
 		return errors.New("nil resource")
 	}
 	cache.mu.Lock()
 	defer cache.mu.Unlock()
 
+	if err := cache.store.Set(name, res); err != nil {
+		return err
+	}
 	cache.version += 1
 	cache.versionVector[name] = cache.version
-	cache.resources[name] = res
+	cache.provideVersion()
 
 	// TODO: batch watch closures to prevent rapid updates
 	cache.notifyAll(map[string]struct{}{name: {}})
@@ -153,12 +305,27 @@ func (cache *LinearCache) UpdateResource(name string, res types.Resource) error
 
 // DeleteResource removes a resource in the collection.
 func (cache *LinearCache) DeleteResource(name string) error {
+	if cache.ownership != nil {
+		return cache.ownership.write("", cache.typeURL, "", nil, []string{name}, func() error {
+			return cache.deleteResource(name)
+		})
+	}
+	return cache.deleteResource(name)
+}
+
+func (cache *LinearCache) deleteResource(name string) error {
 	cache.mu.Lock()
 	defer cache.mu.Unlock()
 
+	if err := cache.store.Delete(name); err != nil {
+		return err
+	}
 	cache.version += 1
 	delete(cache.versionVector, name)
-	delete(cache.resources, name)
+	cache.provideVersion()
+	if cache.marshaled != nil {
+		cache.marshaled.Forget(cache.typeURL, name)
+	}
 
 	// TODO: batch watch closures to prevent rapid updates
 	cache.notifyAll(map[string]struct{}{name: {}})
@@ -177,18 +344,13 @@ func (cache *LinearCache) CreateWatch(request *Request) (chan Response, func())
 	stale := false
 	staleResources := []string{} // empty means all
 
-	// strip version prefix if it is present
-	var lastVersion uint64
-	var err error
-	if strings.HasPrefix(request.VersionInfo, cache.versionPrefix) {
-		lastVersion, err = strconv.ParseUint(request.VersionInfo[len(cache.versionPrefix):], 0, 64)
-	} else {
-		err = errors.New("mis-matched version prefix")
-	}
-
 	cache.mu.Lock()
 	defer cache.mu.Unlock()
 
+	// the counter version of the request, without the version prefix
+	lastVersion, err := cache.parseVersion(request.VersionInfo)
+	release := cache.subscribe(request.ResourceNames)
+
 	if err != nil {
 		stale = true
 		staleResources = request.ResourceNames
@@ -205,7 +367,11 @@ func (cache *LinearCache) CreateWatch(request *Request) (chan Response, func())
 	}
 	if stale {
 		cache.respond(value, staleResources)
-		return value, nil
+		return value, func() {
+			cache.mu.Lock()
+			defer cache.mu.Unlock()
+			release()
+		}
 	}
 	// Create open watches since versions are up to date.
 	if len(request.ResourceNames) == 0 {
@@ -214,6 +380,7 @@ func (cache *LinearCache) CreateWatch(request *Request) (chan Response, func())
 			cache.mu.Lock()
 			defer cache.mu.Unlock()
 			delete(cache.watchAll, value)
+			release()
 		}
 	}
 	for _, name := range request.ResourceNames {
@@ -236,6 +403,7 @@ func (cache *LinearCache) CreateWatch(request *Request) (chan Response, func())
 				delete(cache.watches, name)
 			}
 		}
+		release()
 	}
 }
 
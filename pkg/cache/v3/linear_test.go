@@ -16,11 +16,17 @@
 package cache
 
 import (
+	"errors"
 	"fmt"
 	"testing"
+	"time"
 
-	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/any"
 	wrappers "github.com/golang/protobuf/ptypes/wrappers"
+
+	discovery "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
 )
 
 const (
@@ -144,6 +150,39 @@ func TestLinearVersionPrefix(t *testing.T) {
 	checkWatchCount(t, c, "a", 1)
 }
 
+func TestLinearVersionProvider(t *testing.T) {
+	c := NewLinearCache(testType, WithLinearVersionProvider(HashVersions{}),
+		WithInitialResources(map[string]types.Resource{"a": testResource("a")}))
+	initial := c.currentVersion()
+
+	w, _ := c.CreateWatch(&Request{ResourceNames: []string{"a"}, TypeUrl: testType, VersionInfo: initial})
+	mustBlock(t, w)
+	c.UpdateResource("a", testResource("aa"))
+	changed := c.currentVersion()
+	if changed == initial {
+		t.Fatalf("changed resource => got version %q, want a new version", changed)
+	}
+	verifyResponse(t, w, changed, 1)
+
+	// the content hash of the initial resources is served again
+	c.UpdateResource("a", testResource("a"))
+	if got := c.currentVersion(); got != initial {
+		t.Errorf("reverted resource => got version %q, want %q", got, initial)
+	}
+	w, _ = c.CreateWatch(&Request{TypeUrl: testType, VersionInfo: initial})
+	mustBlock(t, w)
+
+	// the unknown versions receive the requested resources
+	w, _ = c.CreateWatch(&Request{ResourceNames: []string{"a"}, TypeUrl: testType, VersionInfo: "unknown"})
+	verifyResponse(t, w, initial, 1)
+}
+
+func TestLinearDuplicateNames(t *testing.T) {
+	c := NewLinearCache(testType, WithInitialResources(map[string]types.Resource{"a": testResource("a")}))
+	w, _ := c.CreateWatch(&Request{ResourceNames: []string{"a", "a"}, TypeUrl: testType})
+	verifyResponse(t, w, "0", 1)
+}
+
 func TestLinearDeletion(t *testing.T) {
 	c := NewLinearCache(testType, WithInitialResources(map[string]types.Resource{"a": testResource("a"), "b": testResource("b")}))
 	w, _ := c.CreateWatch(&Request{ResourceNames: []string{"a"}, TypeUrl: testType, VersionInfo: "0"})
@@ -241,3 +280,286 @@ func TestLinearConcurrentSetWatch(t *testing.T) {
 		}(i)
 	}
 }
+
+// failingStore fails the operations once failing is set.
+type failingStore struct {
+	ResourceStore
+	failing bool
+}
+
+func (store *failingStore) Set(name string, resource types.Resource) error {
+	if store.failing {
+		return errors.New("store unavailable")
+	}
+	return store.ResourceStore.Set(name, resource)
+}
+
+func (store *failingStore) Range(f func(string, types.Resource)) error {
+	if store.failing {
+		return errors.New("store unavailable")
+	}
+	return store.ResourceStore.Range(f)
+}
+
+func TestLinearResourceStore(t *testing.T) {
+	store := &failingStore{ResourceStore: NewMemoryStore()}
+	if err := store.Set("a", testResource("a")); err != nil {
+		t.Fatal(err)
+	}
+	c := NewLinearCache(testType, WithResourceStore(store), WithInitialResources(map[string]types.Resource{"b": testResource("b")}))
+	w, _ := c.CreateWatch(&Request{TypeUrl: testType})
+	verifyResponse(t, w, "0", 2)
+
+	store.failing = true
+	if err := c.UpdateResource("c", testResource("c")); err == nil {
+		t.Error("UpdateResource() with a failing store => got no error")
+	}
+	w, _ = c.CreateWatch(&Request{TypeUrl: testType})
+	if _, more := <-w; more {
+		t.Error("watch with a failing store => got a response, want closed")
+	}
+	if store.Len() != 2 {
+		t.Errorf("store => got %d resources, want 2", store.Len())
+	}
+}
+
+func TestOpenLinearCache(t *testing.T) {
+	store := &failingStore{ResourceStore: NewMemoryStore(), failing: true}
+	if _, err := OpenLinearCache(testType, WithResourceStore(store)); err == nil {
+		t.Error("OpenLinearCache() with a failing store => got no error")
+	}
+	store.failing = false
+	c, err := OpenLinearCache(testType, WithResourceStore(store), WithInitialResources(map[string]types.Resource{"a": testResource("a")}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, _ := c.CreateWatch(&Request{TypeUrl: testType})
+	verifyResponse(t, w, "0", 1)
+}
+
+func TestLinearMarshalCache(t *testing.T) {
+	marshaled := NewMarshalCache()
+	c := NewLinearCache(testType, WithInitialResources(map[string]types.Resource{"a": testResource("a"), "b": testResource("b")}), WithLinearMarshalCache(marshaled))
+	get := func() *discovery.DiscoveryResponse {
+		t.Helper()
+		w, _ := c.CreateWatch(&Request{TypeUrl: testType})
+		resp, err := (<-w).GetDiscoveryResponse()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	index := func(resp *discovery.DiscoveryResponse) map[string]*any.Any {
+		out := make(map[string]*any.Any)
+		for _, res := range resp.Resources {
+			value := &wrappers.StringValue{}
+			if err := ptypes.UnmarshalAny(res, value); err != nil {
+				t.Fatal(err)
+			}
+			out[value.Value] = res
+		}
+		return out
+	}
+
+	first := index(get())
+	second := index(get())
+	if len(first) != 2 || first["a"] != second["a"] || first["b"] != second["b"] {
+		t.Errorf("shared resources => got %v and %v, want the same values", first, second)
+	}
+	if stats := marshaled.Stats(); stats.Hits != 2 || stats.Misses != 2 || stats.Entries != 2 {
+		t.Errorf("Stats() => got %+v, want 2 hits, 2 misses and 2 entries", stats)
+	}
+
+	c.UpdateResource("a", testResource("aa"))
+	third := index(get())
+	if third["aa"] == nil || third["b"] != first["b"] {
+		t.Errorf("updated resources => got %v, want aa and the shared b", third)
+	}
+
+	c.DeleteResource("b")
+	if stats := marshaled.Stats(); stats.Entries != 1 {
+		t.Errorf("Stats() after deletion => got %d entries, want 1", stats.Entries)
+	}
+}
+
+func TestLinearFairNotifications(t *testing.T) {
+	c := NewLinearCache(testType, WithInitialResources(map[string]types.Resource{
+		"a": testResource("a"), "b": testResource("b"), "c": testResource("c"), "d": testResource("d"),
+	}), WithFairNotifications(1))
+	whale, _ := c.CreateWatch(&Request{TypeUrl: testType, VersionInfo: "0"})
+	small, _ := c.CreateWatch(&Request{ResourceNames: []string{"a"}, TypeUrl: testType, VersionInfo: "0"})
+
+	// the turns are taken by the test instead of the scheduler goroutine
+	c.mu.Lock()
+	c.draining = true
+	c.mu.Unlock()
+	if err := c.UpdateResource("a", testResource("aa")); err != nil {
+		t.Fatal(err)
+	}
+	turns := 0
+	for {
+		c.mu.Lock()
+		more := c.turn()
+		c.mu.Unlock()
+		turns++
+		if len(small) > 0 {
+			break
+		}
+		if !more {
+			t.Fatal("small watch was not responded")
+		}
+	}
+	if turns > 2 {
+		t.Errorf("small watch => got responded after %d turns, want at most 2", turns)
+	}
+	mustBlock(t, whale)
+	verifyResponse(t, small, "1", 1)
+
+	for {
+		c.mu.Lock()
+		more := c.turn()
+		c.mu.Unlock()
+		if !more {
+			break
+		}
+	}
+	verifyResponse(t, whale, "1", 4)
+
+	// the scheduler goroutine drains the notifications
+	whale, _ = c.CreateWatch(&Request{TypeUrl: testType, VersionInfo: "1"})
+	if err := c.UpdateResource("b", testResource("bb")); err != nil {
+		t.Fatal(err)
+	}
+	verifyResponse(t, whale, "2", 4)
+}
+
+func TestLinearFairMarshalCache(t *testing.T) {
+	c := NewLinearCache(testType, WithInitialResources(map[string]types.Resource{
+		"a": testResource("a"), "b": testResource("b"),
+	}), WithFairNotifications(1), WithLinearMarshalCache(NewMarshalCache()))
+	whale, _ := c.CreateWatch(&Request{TypeUrl: testType, VersionInfo: "0"})
+
+	// the turns are taken by the test instead of the scheduler goroutine
+	c.mu.Lock()
+	c.draining = true
+	c.mu.Unlock()
+	if err := c.UpdateResource("b", testResource("bb")); err != nil {
+		t.Fatal(err)
+	}
+	c.mu.Lock()
+	c.turn()
+	c.mu.Unlock()
+
+	// a is updated after it was read for the notification
+	if err := c.UpdateResource("a", testResource("aa")); err != nil {
+		t.Fatal(err)
+	}
+	for {
+		c.mu.Lock()
+		more := c.turn()
+		c.mu.Unlock()
+		if !more {
+			break
+		}
+	}
+	verifyResponse(t, whale, "1", 2)
+
+	w, _ := c.CreateWatch(&Request{ResourceNames: []string{"a"}, TypeUrl: testType})
+	resp, err := (<-w).GetDiscoveryResponse()
+	if err != nil || len(resp.Resources) != 1 {
+		t.Fatalf("GetDiscoveryResponse() => got %v, %v", resp, err)
+	}
+	value := &wrappers.StringValue{}
+	if err := ptypes.UnmarshalAny(resp.Resources[0], value); err != nil {
+		t.Fatal(err)
+	}
+	if value.Value != "aa" {
+		t.Errorf("resource a => got %q, want %q", value.Value, "aa")
+	}
+}
+
+func TestLinearTxn(t *testing.T) {
+	clusters := NewLinearCache(testType)
+	endpoints := NewLinearCache(testType, WithInitialResources(map[string]types.Resource{"old": testResource("old")}))
+	wc, _ := clusters.CreateWatch(&Request{TypeUrl: testType, VersionInfo: "0"})
+	we, _ := endpoints.CreateWatch(&Request{TypeUrl: testType, VersionInfo: "0"})
+
+	txn := NewTxn()
+	if err := txn.UpdateResource(clusters, "a", nil); err == nil {
+		t.Error("expected error on nil resource")
+	}
+	_ = txn.UpdateResource(clusters, "a", testResource("a"))
+	_ = txn.UpdateResource(endpoints, "a", testResource("a"))
+	_ = txn.UpdateResource(endpoints, "b", testResource("b"))
+	txn.DeleteResource(endpoints, "old")
+	mustBlock(t, wc)
+	mustBlock(t, we)
+
+	if err := txn.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	verifyResponse(t, wc, "1", 1)
+	verifyResponse(t, we, "1", 2)
+}
+
+func TestLinearTxnRollback(t *testing.T) {
+	clusters := NewLinearCache(testType, WithInitialResources(map[string]types.Resource{"a": testResource("a")}))
+	store := &failingStore{ResourceStore: NewMemoryStore()}
+	endpoints := NewLinearCache(testType, WithResourceStore(store))
+	store.failing = true
+	w, _ := clusters.CreateWatch(&Request{TypeUrl: testType, VersionInfo: "0"})
+
+	txn := NewTxn()
+	_ = txn.UpdateResource(clusters, "a", testResource("aa"))
+	_ = txn.UpdateResource(endpoints, "b", testResource("b"))
+	if err := txn.Commit(); err == nil {
+		t.Fatal("expected error on store failure")
+	}
+	mustBlock(t, w)
+	if res, _ := clusters.store.Get("a"); res.(*wrappers.StringValue).Value != "a" {
+		t.Errorf("rolled back resource => got %v, want a", res)
+	}
+}
+
+func TestLinearSubscribers(t *testing.T) {
+	unwatched := make(chan string, 2)
+	c := NewLinearCache(testType, WithInitialResources(map[string]types.Resource{"a": testResource("a"), "b": testResource("b")}),
+		WithUnwatchedCallback(10*time.Millisecond, func(name string) { unwatched <- name }))
+
+	// a responded watch still subscribes until it is cancelled
+	w, cancelA := c.CreateWatch(&Request{ResourceNames: []string{"a"}, TypeUrl: testType})
+	verifyResponse(t, w, "0", 1)
+	if n := c.NumSubscribers("a"); n != 1 {
+		t.Errorf("subscribers of a => got %d, want 1", n)
+	}
+	_, cancelAll := c.CreateWatch(&Request{TypeUrl: testType, VersionInfo: "0"})
+	if n := c.NumSubscribers("b"); n != 1 {
+		t.Errorf("subscribers of b => got %d, want 1", n)
+	}
+
+	// the wildcard watch keeps the resources watched
+	cancelA()
+	cancelA()
+	if n := c.NumSubscribers("a"); n != 1 {
+		t.Errorf("subscribers of a => got %d, want 1", n)
+	}
+	cancelAll()
+	if n := c.NumSubscribers("a"); n != 0 {
+		t.Errorf("subscribers of a => got %d, want 0", n)
+	}
+
+	// a subscription within the grace period keeps the resource
+	_, cancelB := c.CreateWatch(&Request{ResourceNames: []string{"b"}, TypeUrl: testType, VersionInfo: "0"})
+	if got := <-unwatched; got != "a" {
+		t.Errorf("unwatched => got %q, want a", got)
+	}
+	select {
+	case got := <-unwatched:
+		t.Errorf("unwatched => got %q, want none", got)
+	case <-time.After(20 * time.Millisecond):
+	}
+	cancelB()
+	if got := <-unwatched; got != "b" {
+		t.Errorf("unwatched => got %q, want b", got)
+	}
+}
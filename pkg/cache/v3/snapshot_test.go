@@ -16,8 +16,19 @@
 package cache_test
 
 import (
+	"reflect"
 	"testing"
 
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+
+	cluster "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	listener "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
+	route "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	routev2 "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	auth "github.com/envoyproxy/go-control-plane/envoy/extensions/transport_sockets/tls/v3"
+	envoy_type "github.com/envoyproxy/go-control-plane/envoy/type/v3"
 	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
 	"github.com/envoyproxy/go-control-plane/pkg/cache/v3"
 	rsrc "github.com/envoyproxy/go-control-plane/pkg/resource/v3"
@@ -62,3 +73,166 @@ func TestSnapshotGetters(t *testing.T) {
 		t.Errorf("got non-empty version for unknown type: %#v", out)
 	}
 }
+
+func TestSnapshotVersionGates(t *testing.T) {
+	nodeVersion := func(major, minor, patch uint32) *core.Node {
+		return &core.Node{
+			UserAgentVersionType: &core.Node_UserAgentBuildVersion{
+				UserAgentBuildVersion: &core.BuildVersion{
+					Version: &envoy_type.SemanticVersion{MajorNumber: major, MinorNumber: minor, Patch: patch},
+				},
+			},
+		}
+	}
+
+	snap := cache.NewSnapshot(version, nil, []types.Resource{testCluster}, []types.Resource{testRoute}, nil, nil, nil)
+	if err := snap.SetVersionGate("not a type", clusterName, cache.VersionGate{}); err == nil {
+		t.Error("expected an error for unknown type")
+	}
+	if err := snap.SetVersionGate(rsrc.ClusterType, "missing", cache.VersionGate{}); err == nil {
+		t.Error("expected an error for missing resource")
+	}
+	if err := snap.SetVersionGate(rsrc.RouteType, routeName, cache.VersionGate{Major: 1, Minor: 16, Patch: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if err := snap.SetVersionGate(rsrc.ClusterType, clusterName, cache.VersionGate{
+		Major: 1,
+		Minor: 16,
+		Patch: 2,
+		Downgrade: func(res types.Resource) types.Resource {
+			out := proto.Clone(res).(*cluster.Cluster)
+			out.AltStatName = "downgraded"
+			return out
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		node       *core.Node
+		allowed    bool
+		downgraded bool
+	}{
+		{node: nil, allowed: false},
+		{node: nodeVersion(1, 15, 9), allowed: false},
+		{node: nodeVersion(1, 16, 1), allowed: false},
+		{node: nodeVersion(1, 16, 2), allowed: true},
+		{node: nodeVersion(1, 17, 0), allowed: true},
+		{node: nodeVersion(2, 0, 0), allowed: true},
+	} {
+		routes := snap.GetResourcesForNode(rsrc.RouteType, tc.node)
+		if _, exists := routes[routeName]; exists != tc.allowed {
+			t.Errorf("route for %v => got %t, want %t", tc.node.GetUserAgentBuildVersion(), exists, tc.allowed)
+		}
+		clusters := snap.GetResourcesForNode(rsrc.ClusterType, tc.node)
+		if got := clusters[clusterName].(*cluster.Cluster).AltStatName == "downgraded"; got == tc.allowed {
+			t.Errorf("downgraded cluster for %v => got %t, want %t", tc.node.GetUserAgentBuildVersion(), got, !tc.allowed)
+		}
+	}
+
+	if testCluster.AltStatName != "" {
+		t.Error("snapshot resource must not be modified by the downgrade")
+	}
+}
+
+func TestSnapshotSecrets(t *testing.T) {
+	tlsContext, err := ptypes.MarshalAny(&auth.DownstreamTlsContext{
+		CommonTlsContext: &auth.CommonTlsContext{
+			TlsCertificateSdsSecretConfigs: []*auth.SdsSecretConfig{{
+				Name:      tlsName,
+				SdsConfig: &core.ConfigSource{ConfigSourceSpecifier: &core.ConfigSource_Ads{Ads: &core.AggregatedConfigSource{}}},
+			}},
+			ValidationContextType: &auth.CommonTlsContext_ValidationContextSdsSecretConfig{
+				ValidationContextSdsSecretConfig: &auth.SdsSecretConfig{
+					Name:      "missing",
+					SdsConfig: &core.ConfigSource{ConfigSourceSpecifier: &core.ConfigSource_Ads{Ads: &core.AggregatedConfigSource{}}},
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tlsListener := proto.Clone(testListener).(*listener.Listener)
+	tlsListener.FilterChains[0].TransportSocket = &core.TransportSocket{
+		Name:       "envoy.transport_sockets.tls",
+		ConfigType: &core.TransportSocket_TypedConfig{TypedConfig: tlsContext},
+	}
+
+	if err := snapshot.ConsistentSecrets(); err != nil {
+		t.Errorf("got inconsistent secrets for %#v: %v", snapshot, err)
+	}
+
+	snap := cache.NewSnapshot(version, nil, nil, nil, []types.Resource{tlsListener}, nil,
+		[]types.Resource{testSecret[0], testSecret[1]})
+	want := map[string][]string{tlsName: {listenerName}, "missing": {listenerName}}
+	if got := snap.GetSecretReferences(); !reflect.DeepEqual(got, want) {
+		t.Errorf("GetSecretReferences() => got %v, want %v", got, want)
+	}
+	if got, want := snap.UnusedSecrets(), []string{rootName}; !reflect.DeepEqual(got, want) {
+		t.Errorf("UnusedSecrets() => got %v, want %v", got, want)
+	}
+	if got, want := snap.MissingSecrets(), []string{"missing"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("MissingSecrets() => got %v, want %v", got, want)
+	}
+	if err := snap.ConsistentSecrets(); err == nil {
+		t.Errorf("got consistent secrets for %#v", snap)
+	}
+}
+
+func TestSnapshotSize(t *testing.T) {
+	empty := cache.NewSnapshot("", nil, nil, nil, nil, nil, nil)
+	if size := empty.Size(); size != 0 {
+		t.Errorf("Size() of empty snapshot => got %d, want 0", size)
+	}
+	single := cache.NewSnapshot(version, nil, []types.Resource{testCluster}, nil, nil, nil, nil)
+	if size := snapshot.Size(); size <= single.Size() || single.Size() < proto.Size(testCluster) {
+		t.Errorf("Size() => got %d for the test snapshot and %d for a single cluster", size, single.Size())
+	}
+
+	c := cache.NewSnapshotCache(false, cache.IDHash{}, nil)
+	for _, node := range []string{"a1", "a2", "b1"} {
+		if err := c.SetSnapshot(node, snapshot); err != nil {
+			t.Fatal(err)
+		}
+	}
+	usage := c.GetUsage(func(node string) string { return node[:1] })
+	size := snapshot.Size()
+	if usage.Nodes["a1"] != size || usage.Tenants["a"] != 2*size || usage.Tenants["b"] != size || usage.Total != 3*size {
+		t.Errorf("GetUsage() => got %+v, want %d bytes per node", usage, size)
+	}
+}
+
+func TestSnapshotValidate(t *testing.T) {
+	if err := snapshot.Validate(); err != nil {
+		t.Errorf("Validate() => got %v", err)
+	}
+
+	shadow := proto.Clone(testRoute).(*route.RouteConfiguration)
+	shadow.VirtualHosts[0].Routes[0].GetRoute().RequestMirrorPolicies = []*routev2.RouteAction_RequestMirrorPolicy{{Cluster: "shadow"}}
+	snap := cache.NewSnapshot(version, nil,
+		[]types.Resource{resource.MakeCluster(resource.Ads, "eds")},
+		[]types.Resource{shadow},
+		[]types.Resource{testListener, resource.MakeHTTPListener(resource.Ads, "other", 8080, "missing"), resource.MakeTCPListener("tcp", 9000, "upstream")},
+		nil, nil)
+	err := snap.Validate()
+	invalid, ok := err.(*cache.ValidationError)
+	if !ok {
+		t.Fatalf("Validate() => got %v, want a validation error", err)
+	}
+	want := []cache.ReferenceError{
+		{TypeURL: rsrc.ClusterType, Name: "eds", ReferenceTypeURL: rsrc.EndpointType, Reference: "eds"},
+		{TypeURL: rsrc.ListenerType, Name: "other", ReferenceTypeURL: rsrc.RouteType, Reference: "missing"},
+		{TypeURL: rsrc.ListenerType, Name: "tcp", ReferenceTypeURL: rsrc.ClusterType, Reference: "upstream"},
+		{TypeURL: rsrc.RouteType, Name: routeName, ReferenceTypeURL: rsrc.ClusterType, Reference: clusterName},
+		{TypeURL: rsrc.RouteType, Name: routeName, ReferenceTypeURL: rsrc.ClusterType, Reference: "shadow"},
+	}
+	if !reflect.DeepEqual(invalid.Errors, want) {
+		t.Errorf("Validate() => got %v, want %v", invalid.Errors, want)
+	}
+
+	var nilSnapshot *cache.Snapshot
+	if err := nilSnapshot.Validate(); err == nil {
+		t.Error("Validate() of nil snapshot => got no error")
+	}
+}
@@ -19,7 +19,10 @@ import (
 	"reflect"
 	"testing"
 
+	pstruct "github.com/golang/protobuf/ptypes/struct"
+
 	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/conversion"
 )
 
 func TestIDHash(t *testing.T) {
@@ -32,6 +35,39 @@ func TestIDHash(t *testing.T) {
 	}
 }
 
+func TestMetadataHash(t *testing.T) {
+	metadata, err := conversion.MessageToStruct(&core.Locality{Region: "us", Zone: "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	metadata.Fields["cluster"] = &pstruct.Value{Kind: &pstruct.Value_StringValue{StringValue: "web"}}
+	metadata.Fields["shard"] = &pstruct.Value{Kind: &pstruct.Value_NumberValue{NumberValue: 3}}
+	metadata.Fields["labels"] = &pstruct.Value{Kind: &pstruct.Value_StructValue{StructValue: &pstruct.Struct{
+		Fields: map[string]*pstruct.Value{"canary": {Kind: &pstruct.Value_BoolValue{BoolValue: true}}},
+	}}}
+	node := &core.Node{Id: "test", Metadata: metadata}
+
+	tests := []struct {
+		hash MetadataHash
+		want string
+	}{
+		{MetadataHash{Keys: [][]string{{"cluster", "zone"}}}, "web/a"},
+		{MetadataHash{Keys: [][]string{{"cluster", "shard", "labels.canary"}}, Separator: ":"}, "web:3:true"},
+		{MetadataHash{Keys: [][]string{{"cluster", "missing"}, {"region"}}}, "us"},
+		{MetadataHash{Keys: [][]string{{"missing"}, {"labels.missing"}, {"cluster.nested"}}}, "test"},
+		{MetadataHash{Keys: [][]string{{"missing"}}, Fallback: MetadataHash{Keys: [][]string{{"cluster"}}}}, "web"},
+		{MetadataHash{}, "test"},
+	}
+	for _, test := range tests {
+		if got := test.hash.ID(node); got != test.want {
+			t.Errorf("MetadataHash%+v.ID() => got %q, want %q", test.hash, got, test.want)
+		}
+	}
+	if got := (MetadataHash{Keys: [][]string{{"cluster"}}}).ID(nil); got != "" {
+		t.Errorf("MetadataHash.ID(nil) => got %q, want empty", got)
+	}
+}
+
 func TestNewStatusInfo(t *testing.T) {
 	node := &core.Node{Id: "test"}
 	info := newStatusInfo(node)
@@ -0,0 +1,236 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+// Package credentials provides the per-RPC credentials of the clients dialing
+// an upstream management server, e.g. in a hierarchy of control planes:
+//
+//	creds := credentials.PerRPC(credentials.ServiceAccountFile(credentials.KubernetesTokenPath))
+//	conn, err := grpc.Dial(upstream, grpc.WithTransportCredentials(tls), grpc.WithPerRPCCredentials(creds))
+//
+// The tokens are cached and refreshed ahead of their expiry.
+package credentials
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	grpccreds "google.golang.org/grpc/credentials"
+)
+
+// Token is a bearer token. A zero expiry never expires.
+type Token struct {
+	Value  string
+	Expiry time.Time
+}
+
+// TokenSource returns the tokens, e.g. from an OAuth2 token source:
+//
+//	credentials.TokenSourceFunc(func(context.Context) (credentials.Token, error) {
+//		token, err := oauthSource.Token()
+//		if err != nil {
+//			return credentials.Token{}, err
+//		}
+//		return credentials.Token{Value: token.AccessToken, Expiry: token.Expiry}, nil
+//	})
+type TokenSource interface {
+	Token(ctx context.Context) (Token, error)
+}
+
+// TokenSourceFunc is a function implementing TokenSource.
+type TokenSourceFunc func(ctx context.Context) (Token, error)
+
+// Token implements TokenSource.
+func (f TokenSourceFunc) Token(ctx context.Context) (Token, error) {
+	return f(ctx)
+}
+
+// Option configures the per-RPC credentials.
+type Option func(*perRPC)
+
+// WithRefreshMargin refreshes the tokens ahead of their expiry by the margin,
+// one minute by default.
+func WithRefreshMargin(margin time.Duration) Option {
+	return func(c *perRPC) {
+		c.margin = margin
+	}
+}
+
+// WithInsecureTransport allows sending the tokens without transport
+// security, e.g. through a local sidecar. The tokens are only sent over TLS
+// by default.
+func WithInsecureTransport() Option {
+	return func(c *perRPC) {
+		c.insecure = true
+	}
+}
+
+// PerRPC returns the per-RPC credentials sending the tokens of the source in
+// the authorization header. A token failing to refresh is used until it
+// expires, so that a transient failure of the source does not fail the
+// streams.
+func PerRPC(source TokenSource, opts ...Option) grpccreds.PerRPCCredentials {
+	c := &perRPC{source: source, margin: time.Minute}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+type perRPC struct {
+	source   TokenSource
+	margin   time.Duration
+	insecure bool
+
+	mu    sync.Mutex
+	token Token
+}
+
+// GetRequestMetadata implements credentials.PerRPCCredentials.
+func (c *perRPC) GetRequestMetadata(ctx context.Context, _ ...string) (map[string]string, error) {
+	token, err := c.current(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{"authorization": "Bearer " + token.Value}, nil
+}
+
+// RequireTransportSecurity implements credentials.PerRPCCredentials.
+func (c *perRPC) RequireTransportSecurity() bool {
+	return !c.insecure
+}
+
+func (c *perRPC) current(ctx context.Context) (Token, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if c.token.Value != "" && (c.token.Expiry.IsZero() || now.Add(c.margin).Before(c.token.Expiry)) {
+		return c.token, nil
+	}
+	token, err := c.source.Token(ctx)
+	if err == nil && token.Value == "" {
+		err = errors.New("empty token")
+	}
+	if err != nil {
+		if c.token.Value != "" && now.Before(c.token.Expiry) {
+			return c.token, nil
+		}
+		return Token{}, fmt.Errorf("token refresh: %v", err)
+	}
+	c.token = token
+	return token, nil
+}
+
+// KubernetesTokenPath is the path of the Kubernetes service account token.
+// The projected tokens are rotated by the kubelet.
+const KubernetesTokenPath = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+// ServiceAccountFile reads the tokens from a file, e.g. a projected
+// Kubernetes service account token, which is read again on refresh. The
+// expiry of a JWT is read from its claims, and the other tokens are read
+// again every five minutes.
+func ServiceAccountFile(path string) TokenSource {
+	return TokenSourceFunc(func(context.Context) (Token, error) {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return Token{}, err
+		}
+		value := strings.TrimSpace(string(data))
+		expiry, ok := jwtExpiry(value)
+		if !ok {
+			expiry = time.Now().Add(5 * time.Minute)
+		}
+		return Token{Value: value, Expiry: expiry}, nil
+	})
+}
+
+// MetadataIdentityURL is the identity endpoint of the GCP metadata server.
+const MetadataIdentityURL = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/identity"
+
+// MetadataIdentity fetches the ID tokens of the GCP service account of the
+// instance for an audience, e.g. the URL of the upstream server.
+type MetadataIdentity struct {
+	Audience string
+
+	// URL optionally overrides MetadataIdentityURL.
+	URL string
+
+	// Client optionally overrides the default HTTP client.
+	Client *http.Client
+}
+
+var _ TokenSource = MetadataIdentity{}
+
+// Token implements TokenSource.
+func (m MetadataIdentity) Token(ctx context.Context) (Token, error) {
+	endpoint := m.URL
+	if endpoint == "" {
+		endpoint = MetadataIdentityURL
+	}
+	client := m.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	req, err := http.NewRequest(http.MethodGet, endpoint+"?audience="+url.QueryEscape(m.Audience), nil)
+	if err != nil {
+		return Token{}, err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return Token{}, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return Token{}, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return Token{}, fmt.Errorf("metadata server returned status %d", resp.StatusCode)
+	}
+	value := strings.TrimSpace(string(body))
+	expiry, ok := jwtExpiry(value)
+	if !ok {
+		return Token{}, errors.New("metadata server returned no ID token")
+	}
+	return Token{Value: value, Expiry: expiry}, nil
+}
+
+// jwtExpiry reads the expiry claim of a JWT, without verifying it.
+func jwtExpiry(token string) (time.Time, bool) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}, false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return time.Time{}, false
+	}
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Exp == 0 {
+		return time.Time{}, false
+	}
+	return time.Unix(claims.Exp, 0), true
+}
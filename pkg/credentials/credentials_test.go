@@ -0,0 +1,130 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package credentials_test
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/envoyproxy/go-control-plane/pkg/credentials"
+)
+
+func jwt(expiry time.Time) string {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"exp":%d}`, expiry.Unix())))
+	return "e30." + payload + ".sig"
+}
+
+func TestPerRPCRefresh(t *testing.T) {
+	ctx := context.Background()
+	calls := 0
+	var failure error
+	ttl := time.Hour
+	creds := credentials.PerRPC(credentials.TokenSourceFunc(func(context.Context) (credentials.Token, error) {
+		calls++
+		return credentials.Token{Value: fmt.Sprintf("token-%d", calls), Expiry: time.Now().Add(ttl)}, failure
+	}))
+	if !creds.RequireTransportSecurity() {
+		t.Error("RequireTransportSecurity() => got false, want true")
+	}
+
+	for i := 0; i < 2; i++ {
+		md, err := creds.GetRequestMetadata(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := md["authorization"]; got != "Bearer token-1" {
+			t.Errorf("GetRequestMetadata() => got %q, want the cached token", got)
+		}
+	}
+
+	// the tokens expiring within the margin are refreshed
+	ttl = 30 * time.Second
+	creds = credentials.PerRPC(credentials.TokenSourceFunc(func(context.Context) (credentials.Token, error) {
+		calls++
+		return credentials.Token{Value: fmt.Sprintf("token-%d", calls), Expiry: time.Now().Add(ttl)}, failure
+	}))
+	first, _ := creds.GetRequestMetadata(ctx)
+	second, _ := creds.GetRequestMetadata(ctx)
+	if first["authorization"] == second["authorization"] {
+		t.Errorf("expiring token => got %q twice, want a refresh", first["authorization"])
+	}
+
+	// a failed refresh keeps the unexpired token
+	failure = errors.New("unavailable")
+	third, err := creds.GetRequestMetadata(ctx)
+	if err != nil || third["authorization"] != second["authorization"] {
+		t.Errorf("failed refresh => got %v, %v, want the unexpired token", third, err)
+	}
+}
+
+func TestServiceAccountFile(t *testing.T) {
+	file, err := ioutil.TempFile("", "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	expiry := time.Now().Add(time.Hour).Truncate(time.Second)
+	if _, err := file.WriteString(jwt(expiry) + "\n"); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	token, err := credentials.ServiceAccountFile(file.Name()).Token(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.Value != jwt(expiry) || !token.Expiry.Equal(expiry) {
+		t.Errorf("Token() => got %+v, want the JWT expiring at %v", token, expiry)
+	}
+}
+
+func TestMetadataIdentity(t *testing.T) {
+	expiry := time.Now().Add(time.Hour).Truncate(time.Second)
+	metadata := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata-Flavor") != "Google" || r.URL.Query().Get("audience") != "https://upstream" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		fmt.Fprint(w, jwt(expiry))
+	}))
+	defer metadata.Close()
+
+	source := credentials.MetadataIdentity{Audience: "https://upstream", URL: metadata.URL}
+	token, err := source.Token(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !token.Expiry.Equal(expiry) {
+		t.Errorf("Token() => got expiry %v, want %v", token.Expiry, expiry)
+	}
+
+	source.Audience = "other"
+	if _, err := source.Token(context.Background()); err == nil {
+		t.Error("Token() with a rejected request => got no error")
+	}
+
+	creds := credentials.PerRPC(source, credentials.WithInsecureTransport())
+	if creds.RequireTransportSecurity() {
+		t.Error("RequireTransportSecurity() with an insecure transport => got true")
+	}
+}
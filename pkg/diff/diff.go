@@ -0,0 +1,320 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+// Package diff computes the semantic differences between Envoy resources.
+//
+// The differences are reported by field path, e.g.
+//
+//	~ listener-0.filter_chains[0].filters[envoy.http_connection_manager].typed_config.stat_prefix: "http" -> "ingress"
+//
+// The Any fields are unpacked, the repeated messages with names are matched by
+// name regardless of their order, and the map entries are matched by key.
+package diff
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	protov2 "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+
+	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
+)
+
+// Kind is the kind of a change.
+type Kind int
+
+const (
+	// Added is a value set only in the new resource.
+	Added Kind = iota
+	// Removed is a value set only in the old resource.
+	Removed
+	// Modified is a value set in both resources.
+	Modified
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Added:
+		return "+"
+	case Removed:
+		return "-"
+	}
+	return "~"
+}
+
+// Change is a difference at a field path. The values are in the compact text
+// format, and empty if not set or omitted.
+type Change struct {
+	Kind Kind
+	Path string
+	Old  string
+	New  string
+}
+
+func (c Change) String() string {
+	switch {
+	case c.Old == "" && c.New == "":
+		return fmt.Sprintf("%s %s", c.Kind, c.Path)
+	case c.Kind == Added:
+		return fmt.Sprintf("+ %s: %s", c.Path, c.New)
+	case c.Kind == Removed:
+		return fmt.Sprintf("- %s: %s", c.Path, c.Old)
+	}
+	return fmt.Sprintf("~ %s: %s -> %s", c.Path, c.Old, c.New)
+}
+
+// Format renders the changes one per line.
+func Format(changes []Change) string {
+	var out strings.Builder
+	for _, change := range changes {
+		out.WriteString(change.String())
+		out.WriteByte('\n')
+	}
+	return out.String()
+}
+
+// Messages compares two messages of the same type.
+func Messages(old, new proto.Message) []Change {
+	var out []Change
+	compareMessages("", proto.MessageReflect(old), proto.MessageReflect(new), &out)
+	return out
+}
+
+// Resources compares two sets of resources indexed by name, e.g. the
+// resources of a type in two snapshots. The paths start with the resource
+// names, and the changes are sorted by name.
+func Resources(old, new map[string]types.Resource) []Change {
+	names := make([]string, 0, len(old)+len(new))
+	for name := range old {
+		names = append(names, name)
+	}
+	for name := range new {
+		if _, exists := old[name]; !exists {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var out []Change
+	for _, name := range names {
+		before, inOld := old[name]
+		after, inNew := new[name]
+		switch {
+		case !inOld:
+			out = append(out, Change{Kind: Added, Path: name, New: text(proto.MessageReflect(after))})
+		case !inNew:
+			out = append(out, Change{Kind: Removed, Path: name, Old: text(proto.MessageReflect(before))})
+		default:
+			compareMessages(name, proto.MessageReflect(before), proto.MessageReflect(after), &out)
+		}
+	}
+	return out
+}
+
+func compareMessages(path string, old, new protoreflect.Message, out *[]Change) {
+	if old.Descriptor().FullName() != new.Descriptor().FullName() {
+		*out = append(*out, Change{Kind: Modified, Path: path, Old: text(old), New: text(new)})
+		return
+	}
+	if old.Descriptor().FullName() == "google.protobuf.Any" {
+		compareAny(path, old, new, out)
+		return
+	}
+
+	fields := old.Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		fieldPath := join(path, string(fd.Name()))
+		switch {
+		case fd.IsList():
+			compareLists(fieldPath, fd, old.Get(fd).List(), new.Get(fd).List(), out)
+		case fd.IsMap():
+			compareMaps(fieldPath, fd, old.Get(fd).Map(), new.Get(fd).Map(), out)
+		case !fd.HasPresence() && (old.Has(fd) || new.Has(fd)):
+			// the scalars without presence are compared against the defaults
+			compareValues(fieldPath, fd, true, true, old.Get(fd), new.Get(fd), out)
+		default:
+			compareValues(fieldPath, fd, old.Has(fd), new.Has(fd), old.Get(fd), new.Get(fd), out)
+		}
+	}
+}
+
+// compareAny compares the unpacked messages if they are of a known type.
+func compareAny(path string, old, new protoreflect.Message, out *[]Change) {
+	oldMsg, oldErr := unpack(old)
+	newMsg, newErr := unpack(new)
+	if oldErr != nil || newErr != nil {
+		if !protov2.Equal(old.Interface(), new.Interface()) {
+			*out = append(*out, Change{Kind: Modified, Path: path, Old: text(old), New: text(new)})
+		}
+		return
+	}
+	compareMessages(path, oldMsg, newMsg, out)
+}
+
+func unpack(any protoreflect.Message) (protoreflect.Message, error) {
+	fields := any.Descriptor().Fields()
+	typeURL := any.Get(fields.ByName("type_url")).String()
+	value := any.Get(fields.ByName("value")).Bytes()
+	mt, err := protoregistry.GlobalTypes.FindMessageByURL(typeURL)
+	if err != nil {
+		return nil, err
+	}
+	msg := mt.New()
+	if err := protov2.Unmarshal(value, msg.Interface()); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// compareLists matches the messages by name if all elements have distinct
+// names, or by position otherwise.
+func compareLists(path string, fd protoreflect.FieldDescriptor, old, new protoreflect.List, out *[]Change) {
+	oldNames, oldNamed := listNames(fd, old)
+	newNames, newNamed := listNames(fd, new)
+	if !oldNamed || !newNamed {
+		for i := 0; i < old.Len() || i < new.Len(); i++ {
+			elemPath := fmt.Sprintf("%s[%d]", path, i)
+			compareValues(elemPath, fd, i < old.Len(), i < new.Len(), listGet(old, i), listGet(new, i), out)
+		}
+		return
+	}
+
+	// the old order followed by the new names
+	for i, name := range oldNames {
+		j := indexOf(newNames, name)
+		compareValues(fmt.Sprintf("%s[%s]", path, name), fd, true, j >= 0, old.Get(i), listGet(new, j), out)
+	}
+	for j, name := range newNames {
+		if indexOf(oldNames, name) < 0 {
+			compareValues(fmt.Sprintf("%s[%s]", path, name), fd, false, true, protoreflect.Value{}, new.Get(j), out)
+		}
+	}
+}
+
+// listNames returns the element names if the list holds messages with
+// distinct non-empty names.
+func listNames(fd protoreflect.FieldDescriptor, list protoreflect.List) ([]string, bool) {
+	if fd.Kind() != protoreflect.MessageKind {
+		return nil, false
+	}
+	name := fd.Message().Fields().ByName("name")
+	if name == nil || name.Kind() != protoreflect.StringKind || name.IsList() {
+		return nil, false
+	}
+	names := make([]string, list.Len())
+	for i := range names {
+		names[i] = list.Get(i).Message().Get(name).String()
+		if names[i] == "" || indexOf(names[:i], names[i]) >= 0 {
+			return nil, false
+		}
+	}
+	return names, true
+}
+
+func compareMaps(path string, fd protoreflect.FieldDescriptor, old, new protoreflect.Map, out *[]Change) {
+	keys := make(map[string]protoreflect.MapKey)
+	collect := func(key protoreflect.MapKey, _ protoreflect.Value) bool {
+		keys[key.String()] = key
+		return true
+	}
+	old.Range(collect)
+	new.Range(collect)
+	sorted := make([]string, 0, len(keys))
+	for key := range keys {
+		sorted = append(sorted, key)
+	}
+	sort.Strings(sorted)
+
+	for _, key := range sorted {
+		mk := keys[key]
+		compareValues(fmt.Sprintf("%s[%s]", path, key), fd.MapValue(),
+			old.Has(mk), new.Has(mk), old.Get(mk), new.Get(mk), out)
+	}
+}
+
+// compareValues compares the singular values of the field.
+func compareValues(path string, fd protoreflect.FieldDescriptor, hasOld, hasNew bool,
+	old, new protoreflect.Value, out *[]Change) {
+	switch {
+	case !hasOld && !hasNew:
+	case !hasOld:
+		*out = append(*out, Change{Kind: Added, Path: path, New: format(fd, new)})
+	case !hasNew:
+		*out = append(*out, Change{Kind: Removed, Path: path, Old: format(fd, old)})
+	case fd.Kind() == protoreflect.MessageKind || fd.Kind() == protoreflect.GroupKind:
+		compareMessages(path, old.Message(), new.Message(), out)
+	case !equal(fd, old, new):
+		*out = append(*out, Change{Kind: Modified, Path: path, Old: format(fd, old), New: format(fd, new)})
+	}
+}
+
+func equal(fd protoreflect.FieldDescriptor, a, b protoreflect.Value) bool {
+	switch fd.Kind() {
+	case protoreflect.BytesKind:
+		return bytes.Equal(a.Bytes(), b.Bytes())
+	case protoreflect.EnumKind:
+		return a.Enum() == b.Enum()
+	}
+	return a.Interface() == b.Interface()
+}
+
+func format(fd protoreflect.FieldDescriptor, v protoreflect.Value) string {
+	switch fd.Kind() {
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return text(v.Message())
+	case protoreflect.EnumKind:
+		if value := fd.Enum().Values().ByNumber(v.Enum()); value != nil {
+			return string(value.Name())
+		}
+		return fmt.Sprint(v.Enum())
+	case protoreflect.StringKind:
+		return fmt.Sprintf("%q", v.String())
+	case protoreflect.BytesKind:
+		return fmt.Sprintf("%q", v.Bytes())
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+func text(m protoreflect.Message) string {
+	return "{" + proto.CompactTextString(proto.MessageV1(m.Interface())) + "}"
+}
+
+func listGet(list protoreflect.List, i int) protoreflect.Value {
+	if i < 0 || i >= list.Len() {
+		return protoreflect.Value{}
+	}
+	return list.Get(i)
+}
+
+func indexOf(names []string, name string) int {
+	for i, n := range names {
+		if n == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func join(path, field string) string {
+	if path == "" {
+		return field
+	}
+	return path + "." + field
+}
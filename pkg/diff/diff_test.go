@@ -0,0 +1,124 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package diff_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/golang/protobuf/ptypes"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	listener "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
+	route "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	hcm "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
+	"github.com/envoyproxy/go-control-plane/pkg/diff"
+	"github.com/envoyproxy/go-control-plane/pkg/test/resource/v3"
+)
+
+func paths(changes []diff.Change) []string {
+	out := make([]string, 0, len(changes))
+	for _, change := range changes {
+		out = append(out, change.String())
+	}
+	return out
+}
+
+func TestMessagesEqual(t *testing.T) {
+	a := resource.MakeHTTPListener(resource.Ads, "listener", 80, "route")
+	b := resource.MakeHTTPListener(resource.Ads, "listener", 80, "route")
+	if got := diff.Messages(a, b); len(got) != 0 {
+		t.Errorf("Messages() => got %v, want none", paths(got))
+	}
+}
+
+func TestMessagesScalars(t *testing.T) {
+	a := resource.MakeEndpoint("cluster", 80)
+	b := resource.MakeEndpoint("cluster", 81)
+	b.Endpoints[0].LbEndpoints[0].GetEndpoint().GetAddress().GetSocketAddress().Protocol = core.SocketAddress_UDP
+	want := []string{
+		"~ endpoints[0].lb_endpoints[0].endpoint.address.socket_address.protocol: TCP -> UDP",
+		"~ endpoints[0].lb_endpoints[0].endpoint.address.socket_address.port_value: 80 -> 81",
+	}
+	if got := paths(diff.Messages(a, b)); !reflect.DeepEqual(got, want) {
+		t.Errorf("Messages() => got %q, want %q", got, want)
+	}
+}
+
+func TestMessagesAny(t *testing.T) {
+	a := resource.MakeHTTPListener(resource.Ads, "listener", 80, "route")
+	b := resource.MakeHTTPListener(resource.Ads, "listener", 80, "route")
+	manager := &hcm.HttpConnectionManager{}
+	if err := ptypes.UnmarshalAny(b.FilterChains[0].Filters[0].GetTypedConfig(), manager); err != nil {
+		t.Fatal(err)
+	}
+	manager.StatPrefix = "ingress"
+	any, err := ptypes.MarshalAny(manager)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.FilterChains[0].Filters[0].ConfigType = &listener.Filter_TypedConfig{TypedConfig: any}
+
+	want := []string{`~ filter_chains[0].filters[envoy.filters.network.http_connection_manager].typed_config.stat_prefix: "http" -> "ingress"`}
+	if got := paths(diff.Messages(a, b)); !reflect.DeepEqual(got, want) {
+		t.Errorf("Messages() => got %q, want %q", got, want)
+	}
+}
+
+func TestMessagesNamedOrder(t *testing.T) {
+	a := resource.MakeRoute("route", "cluster")
+	a.VirtualHosts[0].Name = "a"
+	b := resource.MakeRoute("route", "cluster")
+	b.VirtualHosts[0].Name = "b"
+	a.VirtualHosts = append(a.VirtualHosts, b.VirtualHosts[0])
+
+	// reordering the named elements is not a change
+	c := resource.MakeRoute("route", "cluster")
+	c.VirtualHosts = []*route.VirtualHost{a.VirtualHosts[1], a.VirtualHosts[0]}
+	if got := diff.Messages(a, c); len(got) != 0 {
+		t.Errorf("Messages() => got %v, want none", paths(got))
+	}
+
+	c.VirtualHosts = c.VirtualHosts[:1]
+	got := diff.Messages(a, c)
+	if len(got) != 1 || got[0].Kind != diff.Removed || got[0].Path != "virtual_hosts[a]" {
+		t.Errorf("Messages() => got %v, want virtual host a removed", paths(got))
+	}
+}
+
+func TestResources(t *testing.T) {
+	old := map[string]types.Resource{
+		"a": resource.MakeCluster(resource.Ads, "a"),
+		"b": resource.MakeCluster(resource.Ads, "b"),
+	}
+	new := map[string]types.Resource{
+		"b": resource.MakeCluster(resource.Xds, "b"),
+		"c": resource.MakeCluster(resource.Ads, "c"),
+	}
+	got := diff.Resources(old, new)
+	kinds := make(map[string]diff.Kind)
+	for _, change := range got {
+		kinds[change.Path] = change.Kind
+	}
+	if kinds["a"] != diff.Removed || kinds["c"] != diff.Added || len(got) < 3 {
+		t.Errorf("Resources() => got %v", paths(got))
+	}
+	for _, change := range got[1 : len(got)-1] {
+		if change.Kind != diff.Modified && change.Path[:2] != "b." {
+			t.Errorf("Resources() => unexpected change %v", change)
+		}
+	}
+}
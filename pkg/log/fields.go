@@ -0,0 +1,171 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package log
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The standard field keys of the contextual loggers.
+const (
+	StreamIDKey = "stream_id"
+	NodeIDKey   = "node_id"
+	TypeURLKey  = "type_url"
+)
+
+// FieldLogger is a structured logger carrying key/value fields, which are
+// logged with every message.
+type FieldLogger interface {
+	Logger
+
+	// With returns a logger with the key/value pairs added to the fields.
+	With(keysAndValues ...interface{}) FieldLogger
+}
+
+// With adds the key/value fields to a logger. A structured logger carries
+// the fields as such, and the other loggers prefix the messages with the
+// fields in the key=value format. With returns nil for a nil logger.
+func With(logger Logger, keysAndValues ...interface{}) Logger {
+	switch l := logger.(type) {
+	case nil:
+		return nil
+	case FieldLogger:
+		return l.With(keysAndValues...)
+	}
+	return &prefixLogger{logger: logger, prefix: formatFields(keysAndValues) + ": "}
+}
+
+// formatFields formats the key/value pairs as space-separated key=value.
+func formatFields(keysAndValues []interface{}) string {
+	parts := make([]string, 0, (len(keysAndValues)+1)/2)
+	for i := 0; i < len(keysAndValues); i += 2 {
+		if i+1 == len(keysAndValues) {
+			parts = append(parts, fmt.Sprintf("%v=", keysAndValues[i]))
+			break
+		}
+		parts = append(parts, fmt.Sprintf("%v=%v", keysAndValues[i], keysAndValues[i+1]))
+	}
+	return strings.Join(parts, " ")
+}
+
+// prefixLogger prefixes the messages of a plain logger with the fields.
+type prefixLogger struct {
+	logger Logger
+	prefix string
+}
+
+func (l *prefixLogger) With(keysAndValues ...interface{}) FieldLogger {
+	return &prefixLogger{logger: l.logger, prefix: strings.TrimSuffix(l.prefix, ": ") + " " + formatFields(keysAndValues) + ": "}
+}
+
+func (l *prefixLogger) Debugf(format string, args ...interface{}) {
+	l.logger.Debugf(l.prefix+format, args...)
+}
+
+func (l *prefixLogger) Infof(format string, args ...interface{}) {
+	l.logger.Infof(l.prefix+format, args...)
+}
+
+func (l *prefixLogger) Warnf(format string, args ...interface{}) {
+	l.logger.Warnf(l.prefix+format, args...)
+}
+
+func (l *prefixLogger) Errorf(format string, args ...interface{}) {
+	l.logger.Errorf(l.prefix+format, args...)
+}
+
+// SugaredLogger is the key/value logging interface of *zap.SugaredLogger.
+type SugaredLogger interface {
+	Debugw(msg string, keysAndValues ...interface{})
+	Infow(msg string, keysAndValues ...interface{})
+	Warnw(msg string, keysAndValues ...interface{})
+	Errorw(msg string, keysAndValues ...interface{})
+}
+
+// Zap adapts a zap sugared logger, e.g. zap.S().
+func Zap(logger SugaredLogger) FieldLogger {
+	return &zapLogger{logger: logger}
+}
+
+type zapLogger struct {
+	logger SugaredLogger
+	fields []interface{}
+}
+
+func (l *zapLogger) With(keysAndValues ...interface{}) FieldLogger {
+	fields := make([]interface{}, 0, len(l.fields)+len(keysAndValues))
+	fields = append(append(fields, l.fields...), keysAndValues...)
+	return &zapLogger{logger: l.logger, fields: fields}
+}
+
+func (l *zapLogger) Debugf(format string, args ...interface{}) {
+	l.logger.Debugw(fmt.Sprintf(format, args...), l.fields...)
+}
+
+func (l *zapLogger) Infof(format string, args ...interface{}) {
+	l.logger.Infow(fmt.Sprintf(format, args...), l.fields...)
+}
+
+func (l *zapLogger) Warnf(format string, args ...interface{}) {
+	l.logger.Warnw(fmt.Sprintf(format, args...), l.fields...)
+}
+
+func (l *zapLogger) Errorf(format string, args ...interface{}) {
+	l.logger.Errorw(fmt.Sprintf(format, args...), l.fields...)
+}
+
+// Fields adapts a logger constructor taking a field map, e.g. the
+// WithFields method of a logrus logger:
+//
+//	logger := log.Fields(func(fields map[string]interface{}) log.Logger {
+//		return logrus.WithFields(fields)
+//	})
+func Fields(withFields func(fields map[string]interface{}) Logger) FieldLogger {
+	return &fieldsLogger{withFields: withFields, logger: withFields(nil)}
+}
+
+type fieldsLogger struct {
+	withFields func(map[string]interface{}) Logger
+	fields     map[string]interface{}
+	logger     Logger
+}
+
+func (l *fieldsLogger) With(keysAndValues ...interface{}) FieldLogger {
+	fields := make(map[string]interface{}, len(l.fields)+len(keysAndValues)/2)
+	for key, value := range l.fields {
+		fields[key] = value
+	}
+	for i := 0; i+1 < len(keysAndValues); i += 2 {
+		fields[fmt.Sprint(keysAndValues[i])] = keysAndValues[i+1]
+	}
+	return &fieldsLogger{withFields: l.withFields, fields: fields, logger: l.withFields(fields)}
+}
+
+func (l *fieldsLogger) Debugf(format string, args ...interface{}) {
+	l.logger.Debugf(format, args...)
+}
+
+func (l *fieldsLogger) Infof(format string, args ...interface{}) {
+	l.logger.Infof(format, args...)
+}
+
+func (l *fieldsLogger) Warnf(format string, args ...interface{}) {
+	l.logger.Warnf(format, args...)
+}
+
+func (l *fieldsLogger) Errorf(format string, args ...interface{}) {
+	l.logger.Errorf(format, args...)
+}
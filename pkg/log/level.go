@@ -0,0 +1,98 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package log
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+)
+
+// Level is the minimum severity of the logged messages.
+type Level int32
+
+const (
+	DebugLevel Level = iota
+	InfoLevel
+	WarnLevel
+	ErrorLevel
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+func (l Level) String() string {
+	if l < DebugLevel || l > ErrorLevel {
+		return fmt.Sprintf("Level(%d)", int32(l))
+	}
+	return levelNames[l]
+}
+
+// ParseLevel parses a level name, case-insensitively.
+func ParseLevel(name string) (Level, error) {
+	for i, level := range levelNames {
+		if strings.EqualFold(name, level) {
+			return Level(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown log level %q", name)
+}
+
+// LevelLogger drops the messages of the wrapped logger below a level that
+// can be changed at any time, e.g. from a runtime layer.
+type LevelLogger struct {
+	Logger
+	level int32
+}
+
+// NewLevelLogger wraps a logger with a level.
+func NewLevelLogger(logger Logger, level Level) *LevelLogger {
+	return &LevelLogger{Logger: logger, level: int32(level)}
+}
+
+// Level returns the current level.
+func (l *LevelLogger) Level() Level {
+	return Level(atomic.LoadInt32(&l.level))
+}
+
+// SetLevel changes the level.
+func (l *LevelLogger) SetLevel(level Level) {
+	atomic.StoreInt32(&l.level, int32(level))
+}
+
+// Debugf logs a formatted debugging message.
+func (l *LevelLogger) Debugf(format string, args ...interface{}) {
+	if l.Level() <= DebugLevel {
+		l.Logger.Debugf(format, args...)
+	}
+}
+
+// Infof logs a formatted informational message.
+func (l *LevelLogger) Infof(format string, args ...interface{}) {
+	if l.Level() <= InfoLevel {
+		l.Logger.Infof(format, args...)
+	}
+}
+
+// Warnf logs a formatted warning message.
+func (l *LevelLogger) Warnf(format string, args ...interface{}) {
+	if l.Level() <= WarnLevel {
+		l.Logger.Warnf(format, args...)
+	}
+}
+
+// Errorf logs a formatted error message.
+func (l *LevelLogger) Errorf(format string, args ...interface{}) {
+	l.Logger.Errorf(format, args...)
+}
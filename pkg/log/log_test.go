@@ -14,6 +14,7 @@
 package log
 
 import (
+	"fmt"
 	"log"
 	"testing"
 
@@ -69,3 +70,71 @@ func TestNilLoggerFuncs(t *testing.T) {
 	xdsLogger.Warnf("warn")
 	xdsLogger.Errorf("error")
 }
+
+func TestLevelLogger(t *testing.T) {
+	var got []string
+	record := func(level string) func(string, ...interface{}) {
+		return func(string, ...interface{}) { got = append(got, level) }
+	}
+	logger := NewLevelLogger(LoggerFuncs{
+		DebugFunc: record("debug"),
+		InfoFunc:  record("info"),
+		WarnFunc:  record("warn"),
+		ErrorFunc: record("error"),
+	}, WarnLevel)
+
+	logAll := func() {
+		logger.Debugf("debug")
+		logger.Infof("info")
+		logger.Warnf("warn")
+		logger.Errorf("error")
+	}
+	logAll()
+	assert.Equal(t, []string{"warn", "error"}, got)
+
+	level, err := ParseLevel("DEBUG")
+	assert.NoError(t, err)
+	logger.SetLevel(level)
+	got = nil
+	logAll()
+	assert.Equal(t, []string{"debug", "info", "warn", "error"}, got)
+
+	_, err = ParseLevel("verbose")
+	assert.Error(t, err)
+	assert.Equal(t, "info", InfoLevel.String())
+}
+
+type sugared struct {
+	lines []string
+}
+
+func (s *sugared) record(msg string, keysAndValues []interface{}) {
+	s.lines = append(s.lines, fmt.Sprintf("%s %v", msg, keysAndValues))
+}
+
+func (s *sugared) Debugw(msg string, kv ...interface{}) { s.record(msg, kv) }
+func (s *sugared) Infow(msg string, kv ...interface{})  { s.record(msg, kv) }
+func (s *sugared) Warnw(msg string, kv ...interface{})  { s.record(msg, kv) }
+func (s *sugared) Errorw(msg string, kv ...interface{}) { s.record(msg, kv) }
+
+func TestWith(t *testing.T) {
+	var got []string
+	record := func(format string, args ...interface{}) { got = append(got, fmt.Sprintf(format, args...)) }
+	var logger Logger = LoggerFuncs{InfoFunc: record}
+	logger = With(logger, StreamIDKey, 1)
+	logger = With(logger, NodeIDKey, "node")
+	logger.Infof("hello %s", "world")
+	assert.Equal(t, []string{"stream_id=1 node_id=node: hello world"}, got)
+	assert.Nil(t, With(nil, StreamIDKey, 1))
+
+	zap := &sugared{}
+	With(With(Zap(zap), StreamIDKey, 1), NodeIDKey, "node").Warnf("hello")
+	assert.Equal(t, []string{"hello [stream_id 1 node_id node]"}, zap.lines)
+
+	var fields []map[string]interface{}
+	With(Fields(func(f map[string]interface{}) Logger {
+		fields = append(fields, f)
+		return LoggerFuncs{}
+	}), StreamIDKey, 1).Errorf("hello")
+	assert.Equal(t, []map[string]interface{}{nil, {StreamIDKey: 1}}, fields)
+}
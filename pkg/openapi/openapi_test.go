@@ -0,0 +1,70 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package openapi_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	discovery "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/openapi"
+)
+
+func TestAddMessage(t *testing.T) {
+	doc := openapi.NewDocument("test", "v1")
+	ref := doc.AddMessage(&discovery.DiscoveryResponse{})
+	if ref.Ref != "#/components/schemas/envoy.service.discovery.v3.DiscoveryResponse" {
+		t.Errorf("AddMessage() => got %q", ref.Ref)
+	}
+
+	response := doc.Components.Schemas["envoy.service.discovery.v3.DiscoveryResponse"]
+	if response == nil {
+		t.Fatalf("missing response schema in %v", doc.Components.Schemas)
+	}
+	if got := response.Properties["version_info"]; got.Type != "string" {
+		t.Errorf("string field => got %+v", got)
+	}
+	if got := response.Properties["resources"]; got.Type != "array" || got.Items.Properties["@type"] == nil {
+		t.Errorf("repeated Any field => got %+v", got)
+	}
+	if got := response.Properties["control_plane"]; got.Ref != "#/components/schemas/envoy.config.core.v3.ControlPlane" {
+		t.Errorf("message field => got %+v", got)
+	}
+
+	node := doc.Components.Schemas["envoy.config.core.v3.Node"]
+	if node != nil {
+		t.Errorf("unreferenced message => got %+v", node)
+	}
+	doc.AddMessage(&discovery.DiscoveryRequest{})
+	node = doc.Components.Schemas["envoy.config.core.v3.Node"]
+	if node == nil {
+		t.Fatal("missing nested message schema")
+	}
+	if got := node.Properties["metadata"]; got.Type != "object" || got.AdditionalProperties == nil {
+		t.Errorf("struct field => got %+v", got)
+	}
+
+	address := doc.Components.Schemas["envoy.config.core.v3.SocketAddress"]
+	if got := address.Properties["protocol"]; got.Type != "string" || len(got.Enum) != 2 {
+		t.Errorf("enum field => got %+v", got)
+	}
+	if got := address.Properties["port_value"]; got.Type != "integer" {
+		t.Errorf("uint32 field => got %+v", got)
+	}
+
+	if _, err := json.Marshal(doc); err != nil {
+		t.Error(err)
+	}
+}
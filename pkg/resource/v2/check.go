@@ -0,0 +1,53 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package resource
+
+import (
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+
+	api "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	auth "github.com/envoyproxy/go-control-plane/envoy/api/v2/auth"
+	runtime "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v2"
+)
+
+// typeMessages are the generated messages of the resource types.
+var typeMessages = []struct {
+	typeURL string
+	message proto.Message
+}{
+	{EndpointType, &api.ClusterLoadAssignment{}},
+	{ClusterType, &api.Cluster{}},
+	{RouteType, &api.RouteConfiguration{}},
+	{ScopedRouteType, &api.ScopedRouteConfiguration{}},
+	{ListenerType, &api.Listener{}},
+	{SecretType, &auth.Secret{}},
+	{RuntimeType, &runtime.Runtime{}},
+}
+
+// CheckTypes verifies that the resource types match the generated messages
+// in use, which differ when mixing the packages of several versions of the
+// module, e.g. with a replace directive or a partial vendoring. The check is
+// meant for the unit tests of the applications, rather than for the startup.
+func CheckTypes() error {
+	for _, typ := range typeMessages {
+		if got := "type.googleapis.com/" + proto.MessageName(typ.message); got != typ.typeURL {
+			return fmt.Errorf("resource type %q does not match the generated message %q: "+
+				"the envoy and pkg packages must come from the same go-control-plane version", typ.typeURL, got)
+		}
+	}
+	return nil
+}
@@ -16,6 +16,7 @@ const (
 	EndpointType        = apiTypePrefix + "ClusterLoadAssignment"
 	ClusterType         = apiTypePrefix + "Cluster"
 	RouteType           = apiTypePrefix + "RouteConfiguration"
+	ScopedRouteType     = apiTypePrefix + "ScopedRouteConfiguration"
 	ListenerType        = apiTypePrefix + "Listener"
 	SecretType          = apiTypePrefix + "auth.Secret"
 	RuntimeType         = discoveryTypePrefix + "Runtime"
@@ -26,12 +27,13 @@ const (
 
 // Fetch urls in xDS v2.
 const (
-	FetchEndpoints = "/v2/discovery:endpoints"
-	FetchClusters  = "/v2/discovery:clusters"
-	FetchListeners = "/v2/discovery:listeners"
-	FetchRoutes    = "/v2/discovery:routes"
-	FetchSecrets   = "/v2/discovery:secrets"
-	FetchRuntimes  = "/v2/discovery:runtime"
+	FetchEndpoints    = "/v2/discovery:endpoints"
+	FetchClusters     = "/v2/discovery:clusters"
+	FetchListeners    = "/v2/discovery:listeners"
+	FetchRoutes       = "/v2/discovery:routes"
+	FetchScopedRoutes = "/v2/discovery:scoped-routes"
+	FetchSecrets      = "/v2/discovery:secrets"
+	FetchRuntimes     = "/v2/discovery:runtime"
 )
 
 // DefaultAPIVersion is the api version
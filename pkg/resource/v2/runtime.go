@@ -0,0 +1,113 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package resource
+
+import (
+	"fmt"
+
+	pstruct "github.com/golang/protobuf/ptypes/struct"
+	"gopkg.in/yaml.v2"
+
+	runtime "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v2"
+)
+
+// MakeRuntime creates a runtime layer from the values. The name of the layer
+// must match the name of an RTDS layer of the bootstrap runtime. The nested
+// maps are kept nested, and Envoy reads them as keys joined with dots, e.g.
+// {"health_check": {"min_interval": 5}} sets "health_check.min_interval".
+//
+// The values are booleans, numbers, strings and maps. Envoy rejects the
+// lists in runtime layers, so lists are an error.
+func MakeRuntime(name string, layer map[string]interface{}) (*runtime.Runtime, error) {
+	if name == "" {
+		return nil, fmt.Errorf("runtime layer name is required")
+	}
+	fields, err := runtimeFields(layer)
+	if err != nil {
+		return nil, fmt.Errorf("runtime layer %q: %v", name, err)
+	}
+	return &runtime.Runtime{Name: name, Layer: &pstruct.Struct{Fields: fields}}, nil
+}
+
+// MakeRuntimeFromYAML creates a runtime layer from a YAML map of the values,
+// see MakeRuntime.
+func MakeRuntimeFromYAML(name string, data []byte) (*runtime.Runtime, error) {
+	layer := make(map[string]interface{})
+	if err := yaml.Unmarshal(data, &layer); err != nil {
+		return nil, fmt.Errorf("runtime layer %q: %v", name, err)
+	}
+	return MakeRuntime(name, layer)
+}
+
+func runtimeFields(values map[string]interface{}) (map[string]*pstruct.Value, error) {
+	fields := make(map[string]*pstruct.Value, len(values))
+	for key, value := range values {
+		field, err := runtimeValue(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", key, err)
+		}
+		fields[key] = field
+	}
+	return fields, nil
+}
+
+func runtimeValue(value interface{}) (*pstruct.Value, error) {
+	switch v := value.(type) {
+	case bool:
+		return &pstruct.Value{Kind: &pstruct.Value_BoolValue{BoolValue: v}}, nil
+	case string:
+		return &pstruct.Value{Kind: &pstruct.Value_StringValue{StringValue: v}}, nil
+	case int:
+		return numberValue(float64(v)), nil
+	case int32:
+		return numberValue(float64(v)), nil
+	case int64:
+		return numberValue(float64(v)), nil
+	case uint:
+		return numberValue(float64(v)), nil
+	case uint32:
+		return numberValue(float64(v)), nil
+	case uint64:
+		return numberValue(float64(v)), nil
+	case float32:
+		return numberValue(float64(v)), nil
+	case float64:
+		return numberValue(v), nil
+	case map[string]interface{}:
+		fields, err := runtimeFields(v)
+		if err != nil {
+			return nil, err
+		}
+		return &pstruct.Value{Kind: &pstruct.Value_StructValue{StructValue: &pstruct.Struct{Fields: fields}}}, nil
+	case map[interface{}]interface{}:
+		// YAML maps have untyped keys
+		values := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			name, ok := key.(string)
+			if !ok {
+				return nil, fmt.Errorf("key %v is not a string", key)
+			}
+			values[name] = item
+		}
+		return runtimeValue(values)
+	case []interface{}:
+		return nil, fmt.Errorf("lists are not supported in runtime layers")
+	}
+	return nil, fmt.Errorf("unsupported runtime value %T", value)
+}
+
+func numberValue(v float64) *pstruct.Value {
+	return &pstruct.Value{Kind: &pstruct.Value_NumberValue{NumberValue: v}}
+}
@@ -0,0 +1,66 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package resource_test
+
+import (
+	"testing"
+
+	"github.com/envoyproxy/go-control-plane/pkg/resource/v2"
+)
+
+func TestMakeRuntime(t *testing.T) {
+	layer, err := resource.MakeRuntime("admin", map[string]interface{}{
+		"enabled":      true,
+		"health_check": map[string]interface{}{"min_interval": 5},
+		"mode":         "strict",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := layer.Layer.Fields
+	if layer.Name != "admin" || !fields["enabled"].GetBoolValue() || fields["mode"].GetStringValue() != "strict" {
+		t.Errorf("runtime => got %v, want the admin layer", layer)
+	}
+	if got := fields["health_check"].GetStructValue().Fields["min_interval"].GetNumberValue(); got != 5 {
+		t.Errorf("nested value => got %v, want 5", got)
+	}
+
+	layer, err = resource.MakeRuntimeFromYAML("static", []byte("health_check:\n  min_interval: 5\nratio: 0.5\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := layer.Layer.Fields["health_check"].GetStructValue().Fields["min_interval"].GetNumberValue(); got != 5 {
+		t.Errorf("YAML nested value => got %v, want 5", got)
+	}
+	if got := layer.Layer.Fields["ratio"].GetNumberValue(); got != 0.5 {
+		t.Errorf("YAML value => got %v, want 0.5", got)
+	}
+
+	for _, test := range []struct {
+		name  string
+		layer map[string]interface{}
+	}{
+		{name: "", layer: nil},
+		{name: "lists", layer: map[string]interface{}{"hosts": []interface{}{"a"}}},
+		{name: "nil", layer: map[string]interface{}{"value": nil}},
+	} {
+		if _, err := resource.MakeRuntime(test.name, test.layer); err == nil {
+			t.Errorf("MakeRuntime(%q, %v) => got no error", test.name, test.layer)
+		}
+	}
+	if _, err := resource.MakeRuntimeFromYAML("keys", []byte("a:\n  1: b\n")); err == nil {
+		t.Error("MakeRuntimeFromYAML() with a numeric key => got no error")
+	}
+}
@@ -0,0 +1,425 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+// Package admin provides an HTTP introspection API for the snapshot cache
+// with role-based access control.
+package admin
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+
+	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/diff"
+	"github.com/envoyproxy/go-control-plane/pkg/resource/v2"
+)
+
+// Role is the access level of an admin API user. Each role includes the
+// permissions of the lower ones.
+type Role int
+
+const (
+	// RoleNone has no access.
+	RoleNone Role = iota
+	// RoleViewer reads the resources, except for the contents of the secrets.
+	RoleViewer
+	// RoleOperator reads all resources and uses the mutating endpoints.
+	RoleOperator
+)
+
+// ErrUnauthenticated is returned by authenticators for requests without valid
+// credentials.
+var ErrUnauthenticated = errors.New("unauthenticated")
+
+// Authenticator identifies the role of the admin API user making a request.
+type Authenticator func(*http.Request) (Role, error)
+
+// BearerTokens authenticates the requests with the bearer tokens in the
+// Authorization header, mapping the tokens to the roles.
+func BearerTokens(tokens map[string]Role) Authenticator {
+	return func(req *http.Request) (Role, error) {
+		header := req.Header.Get("Authorization")
+		if !strings.HasPrefix(header, "Bearer ") {
+			return RoleNone, ErrUnauthenticated
+		}
+		role, exists := tokens[strings.TrimPrefix(header, "Bearer ")]
+		if !exists {
+			return RoleNone, ErrUnauthenticated
+		}
+		return role, nil
+	}
+}
+
+// Admin API paths.
+const (
+	NodesPath     = "/nodes"
+	SnapshotsPath = "/snapshots/"
+	ResourcesPath = "/resources/"
+	UsagePath     = "/usage"
+	DiffPath      = "/diff/"
+	StatusPath    = "/status"
+	NACKsPath     = "/nacks"
+	UIPath        = "/ui"
+)
+
+// Handler serves the admin API:
+//
+//	GET    /nodes            lists the node IDs with open watches (viewer)
+//	GET    /snapshots/{node} returns the node snapshot (viewer, secrets redacted)
+//	GET    /resources/{node}?type={type URL}
+//	                         lists the resource names of a type in the node snapshot (viewer)
+//	GET    /resources/{node}?type={type URL}&name={name}
+//	                         returns a resource of the node snapshot (viewer, secrets redacted)
+//	GET    /usage            reports the memory usage by node and tenant (viewer)
+//	GET    /diff/{node}?against={other}
+//	                         compares the node snapshot to another node (viewer, secrets by name)
+//	DELETE /snapshots/{node} clears the node snapshot (operator)
+//	GET    /openapi.json     describes the admin API (viewer)
+//	GET    /status           reports the node versions and convergence (viewer)
+//	GET    /nacks            lists the recent NACKs (viewer)
+//	GET    /ui               serves the read-only web UI (public, the UI asks for a token)
+type Handler struct {
+	// Cache is the introspected snapshot cache.
+	Cache cache.SnapshotCache
+
+	// Authenticate identifies the user role. All requests are rejected if it
+	// is not set.
+	Authenticate Authenticator
+
+	// Tenant optionally aggregates the usage reports by tenant.
+	Tenant cache.TenantFunc
+
+	// Recorder optionally reports the accepted versions and the NACKs. It must
+	// be registered with the server callbacks.
+	Recorder *Recorder
+}
+
+// NodeStatus is the state of a node.
+type NodeStatus struct {
+	Node string `json:"node"`
+
+	// Versions are the snapshot versions by type URL.
+	Versions map[string]string `json:"versions"`
+
+	// Accepted are the versions accepted by the node by type URL, as recorded
+	// by the recorder or else by the cache.
+	Accepted map[string]string `json:"accepted,omitempty"`
+
+	// Converged is set once the node accepted the snapshot versions of all
+	// the types with resources in the snapshot.
+	Converged bool `json:"converged"`
+
+	Watches     int       `json:"watches"`
+	LastRequest time.Time `json:"last_request"`
+}
+
+// Snapshot is the JSON representation of a snapshot.
+type Snapshot struct {
+	Resources map[string]Resources `json:"resources"`
+
+	// Signature is the detached snapshot signature, if any.
+	Signature []byte `json:"signature,omitempty"`
+}
+
+// Resources is the JSON representation of a versioned group of resources.
+type Resources struct {
+	Version string                     `json:"version"`
+	Items   map[string]json.RawMessage `json:"items"`
+}
+
+// ServeHTTP authorizes and serves an admin API request, returning the response
+// body and the HTTP status code.
+func (h *Handler) ServeHTTP(req *http.Request) ([]byte, int, error) {
+	// the UI holds no data
+	if path.Clean(req.URL.Path) == UIPath && req.Method == http.MethodGet {
+		return []byte(ui), http.StatusOK, nil
+	}
+
+	if h.Authenticate == nil {
+		return nil, http.StatusUnauthorized, ErrUnauthenticated
+	}
+	role, err := h.Authenticate(req)
+	if err != nil || role == RoleNone {
+		return nil, http.StatusUnauthorized, ErrUnauthenticated
+	}
+
+	p := path.Clean(req.URL.Path)
+	switch {
+	case p == NodesPath && req.Method == http.MethodGet:
+		return marshalJSON(h.Cache.View().GetStatusKeys())
+
+	case p == OpenAPIPath && req.Method == http.MethodGet:
+		return marshalJSON(OpenAPI())
+
+	case p == StatusPath && req.Method == http.MethodGet:
+		return marshalJSON(h.status())
+
+	case p == NACKsPath && req.Method == http.MethodGet:
+		nacks := []NACK{}
+		if h.Recorder != nil {
+			nacks = h.Recorder.NACKs()
+		}
+		return marshalJSON(nacks)
+
+	case p == UsagePath && req.Method == http.MethodGet:
+		return marshalJSON(h.Cache.GetUsage(h.Tenant))
+
+	case strings.HasPrefix(p, SnapshotsPath) && req.Method == http.MethodGet:
+		snap, err := h.Cache.GetSnapshot(strings.TrimPrefix(p, SnapshotsPath))
+		if err != nil {
+			return nil, http.StatusNotFound, err
+		}
+		out, err := convert(&snap, role >= RoleOperator)
+		if err != nil {
+			return nil, http.StatusInternalServerError, err
+		}
+		return marshalJSON(out)
+
+	case strings.HasPrefix(p, ResourcesPath) && req.Method == http.MethodGet:
+		return h.resource(strings.TrimPrefix(p, ResourcesPath), req.URL.Query().Get("type"), req.URL.Query().Get("name"), role >= RoleOperator)
+
+	case strings.HasPrefix(p, DiffPath) && req.Method == http.MethodGet:
+		against, err := h.Cache.GetSnapshot(req.URL.Query().Get("against"))
+		if err != nil {
+			return nil, http.StatusNotFound, err
+		}
+		snap, err := h.Cache.GetSnapshot(strings.TrimPrefix(p, DiffPath))
+		if err != nil {
+			return nil, http.StatusNotFound, err
+		}
+		return marshalJSON(compare(&against, &snap, role >= RoleOperator))
+
+	case strings.HasPrefix(p, SnapshotsPath) && req.Method == http.MethodDelete:
+		if role < RoleOperator {
+			return nil, http.StatusForbidden, fmt.Errorf("operator role required")
+		}
+		node := strings.TrimPrefix(p, SnapshotsPath)
+		h.Cache.ClearSnapshot(node)
+		if h.Recorder != nil {
+			h.Recorder.Forget(node)
+		}
+		return nil, http.StatusNoContent, nil
+	}
+
+	return nil, http.StatusNotFound, fmt.Errorf("no endpoint")
+}
+
+// resource lists the resource names of a type in the node snapshot, or
+// returns a resource if the name is set, without copying the snapshot.
+func (h *Handler) resource(node, typeURL, name string, secrets bool) ([]byte, int, error) {
+	if cache.GetResponseType(typeURL) == types.UnknownType {
+		return nil, http.StatusBadRequest, fmt.Errorf("unknown type URL %q", typeURL)
+	}
+	reader, ok := h.Cache.(cache.ResourceReader)
+	if !ok {
+		reader = snapshotReader{h.Cache}
+	}
+	if name == "" {
+		names, err := reader.ListResourceNames(node, typeURL)
+		if err != nil {
+			return nil, http.StatusNotFound, err
+		}
+		return marshalJSON(names)
+	}
+	res, err := reader.GetResource(node, typeURL, name)
+	if err != nil {
+		return nil, http.StatusNotFound, err
+	}
+	if typeURL == resource.SecretType && !secrets {
+		return marshalJSON(map[string]string{"name": name})
+	}
+	buf := &bytes.Buffer{}
+	if err := (&jsonpb.Marshaler{OrigName: true}).Marshal(buf, res); err != nil {
+		return nil, http.StatusInternalServerError, fmt.Errorf("marshal error: %v", err)
+	}
+	return buf.Bytes(), http.StatusOK, nil
+}
+
+// snapshotReader reads the resources from the snapshots of the caches that
+// do not implement cache.ResourceReader.
+type snapshotReader struct {
+	cache cache.SnapshotCache
+}
+
+func (r snapshotReader) GetResource(node, typeURL, name string) (types.Resource, error) {
+	snap, err := r.cache.GetSnapshot(node)
+	if err != nil {
+		return nil, err
+	}
+	res, exists := snap.GetResources(typeURL)[name]
+	if !exists {
+		return nil, fmt.Errorf("no resource %q of %s for node %s", name, typeURL, node)
+	}
+	return res, nil
+}
+
+func (r snapshotReader) ListResourceNames(node, typeURL string) ([]string, error) {
+	snap, err := r.cache.GetSnapshot(node)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(snap.GetResources(typeURL)))
+	for name := range snap.GetResources(typeURL) {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+var resourceTypes = []string{
+	resource.EndpointType,
+	resource.ClusterType,
+	resource.RouteType,
+	resource.ScopedRouteType,
+	resource.ListenerType,
+	resource.SecretType,
+	resource.RuntimeType,
+}
+
+// convert marshals the snapshot resources to JSON. The secrets are reduced
+// to their names unless requested otherwise.
+func convert(snap *cache.Snapshot, secrets bool) (*Snapshot, error) {
+	out := &Snapshot{Resources: make(map[string]Resources), Signature: snap.Signature}
+	marshaler := &jsonpb.Marshaler{OrigName: true}
+	for _, typeURL := range resourceTypes {
+		group := Resources{Version: snap.GetVersion(typeURL), Items: make(map[string]json.RawMessage)}
+		for name, res := range snap.GetResources(typeURL) {
+			if typeURL == resource.SecretType && !secrets {
+				redacted, _ := json.Marshal(map[string]string{"name": name})
+				group.Items[name] = redacted
+				continue
+			}
+			buf := &bytes.Buffer{}
+			if err := marshaler.Marshal(buf, res); err != nil {
+				return nil, fmt.Errorf("marshal error: %v", err)
+			}
+			group.Items[name] = buf.Bytes()
+		}
+		out.Resources[typeURL] = group
+	}
+	return out, nil
+}
+
+// status reports the state of the nodes with the status info, from a view
+// of the cache.
+func (h *Handler) status() []NodeStatus {
+	view := h.Cache.View()
+	keys := view.GetStatusKeys()
+	out := make([]NodeStatus, 0, len(keys))
+	for _, node := range keys {
+		status := NodeStatus{Node: node, Versions: make(map[string]string)}
+		info := view.GetStatusInfo(node)
+		if info != nil {
+			status.Watches = info.GetNumWatches()
+			status.LastRequest = info.GetLastWatchRequestTime()
+		}
+		snap, exists := view.GetSnapshot(node)
+		if exists {
+			for _, typeURL := range resourceTypes {
+				status.Versions[typeURL] = snap.GetVersion(typeURL)
+			}
+		}
+		if h.Recorder != nil {
+			status.Accepted = h.Recorder.Accepted(node)
+		} else if info != nil {
+			// fall back to the acknowledgements tracked by the cache
+			for typeURL, ack := range info.GetAckStatus() {
+				if status.Accepted == nil {
+					status.Accepted = make(map[string]string)
+				}
+				status.Accepted[typeURL] = ack.AckedVersion
+			}
+		}
+		if exists {
+			status.Converged = true
+			for _, typeURL := range resourceTypes {
+				if len(snap.GetResources(typeURL)) > 0 && status.Accepted[typeURL] != status.Versions[typeURL] {
+					status.Converged = false
+				}
+			}
+		}
+		out = append(out, status)
+	}
+	return out
+}
+
+// compare renders the semantic differences by type URL. The secret contents
+// are omitted unless requested otherwise.
+func compare(old, new *cache.Snapshot, secrets bool) map[string][]string {
+	out := make(map[string][]string)
+	for _, typeURL := range resourceTypes {
+		before, after := old.GetResources(typeURL), new.GetResources(typeURL)
+		var changes []diff.Change
+		if typeURL == resource.SecretType && !secrets {
+			changes = compareNames(before, after)
+		} else {
+			changes = diff.Resources(before, after)
+		}
+		if oldVersion, newVersion := old.GetVersion(typeURL), new.GetVersion(typeURL); oldVersion != newVersion {
+			changes = append([]diff.Change{{Kind: diff.Modified, Path: "version", Old: oldVersion, New: newVersion}}, changes...)
+		}
+		for _, change := range changes {
+			out[typeURL] = append(out[typeURL], change.String())
+		}
+	}
+	return out
+}
+
+// compareNames reports the changed resources without their contents.
+func compareNames(old, new map[string]types.Resource) []diff.Change {
+	names := make([]string, 0, len(old)+len(new))
+	for name := range old {
+		names = append(names, name)
+	}
+	for name := range new {
+		if _, exists := old[name]; !exists {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var out []diff.Change
+	for _, name := range names {
+		before, inOld := old[name]
+		after, inNew := new[name]
+		switch {
+		case !inOld:
+			out = append(out, diff.Change{Kind: diff.Added, Path: name})
+		case !inNew:
+			out = append(out, diff.Change{Kind: diff.Removed, Path: name})
+		case !proto.Equal(before, after):
+			out = append(out, diff.Change{Kind: diff.Modified, Path: name})
+		}
+	}
+	return out
+}
+
+func marshalJSON(v interface{}) ([]byte, int, error) {
+	out, err := json.Marshal(v)
+	if err != nil {
+		return nil, http.StatusInternalServerError, fmt.Errorf("marshal error: %v", err)
+	}
+	return out, http.StatusOK, nil
+}
@@ -0,0 +1,197 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package admin_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	discovery "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/openapi"
+	rsrc "github.com/envoyproxy/go-control-plane/pkg/resource/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/server/admin/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/test/resource/v2"
+)
+
+func TestHandler(t *testing.T) {
+	c := cache.NewSnapshotCache(false, cache.IDHash{}, nil)
+	snapshot := cache.NewSnapshot("1",
+		nil,
+		[]types.Resource{resource.MakeCluster(resource.Xds, "cluster")},
+		nil, nil, nil,
+		[]types.Resource{resource.MakeSecrets("tls", "root")[0]})
+	if err := c.SetSnapshot("node", snapshot); err != nil {
+		t.Fatal(err)
+	}
+	c.CreateWatch(&cache.Request{Node: &core.Node{Id: "node"}, TypeUrl: rsrc.ClusterType, VersionInfo: "1"})
+
+	h := &admin.Handler{
+		Cache: c,
+		Authenticate: admin.BearerTokens(map[string]admin.Role{
+			"viewer":   admin.RoleViewer,
+			"operator": admin.RoleOperator,
+		}),
+		Tenant:   func(string) string { return "tenant" },
+		Recorder: admin.NewRecorder(cache.IDHash{}, 10),
+	}
+	serve := func(method, path, token string) ([]byte, int) {
+		req := httptest.NewRequest(method, path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		out, code, _ := h.ServeHTTP(req)
+		return out, code
+	}
+
+	if _, code := serve(http.MethodGet, admin.NodesPath, ""); code != http.StatusUnauthorized {
+		t.Errorf("anonymous request => got %d, want %d", code, http.StatusUnauthorized)
+	}
+	if _, code := serve(http.MethodGet, admin.NodesPath, "unknown"); code != http.StatusUnauthorized {
+		t.Errorf("unknown token => got %d, want %d", code, http.StatusUnauthorized)
+	}
+	if out, code := serve(http.MethodGet, admin.NodesPath, "viewer"); code != http.StatusOK || string(out) != `["node"]` {
+		t.Errorf("nodes => got %d %s", code, out)
+	}
+
+	out, code := serve(http.MethodGet, admin.OpenAPIPath, "viewer")
+	var doc openapi.Document
+	if err := json.Unmarshal(out, &doc); code != http.StatusOK || err != nil {
+		t.Fatalf("openapi => got %d %s", code, out)
+	}
+	if op := doc.Paths[admin.SnapshotsPath+"{node}"]["delete"]; op == nil || op.Responses["403"].Description == "" {
+		t.Errorf("openapi snapshots => got %+v", doc.Paths[admin.SnapshotsPath+"{node}"])
+	}
+
+	out, code = serve(http.MethodGet, admin.UsagePath, "viewer")
+	var usage cache.Usage
+	if err := json.Unmarshal(out, &usage); code != http.StatusOK || err != nil {
+		t.Fatalf("usage => got %d %s", code, out)
+	}
+	if size := snapshot.Size(); usage.Nodes["node"] != size || usage.Tenants["tenant"] != size || usage.Total != size {
+		t.Errorf("usage => got %+v, want %d bytes", usage, size)
+	}
+
+	// viewers see the clusters but not the secret contents
+	out, code = serve(http.MethodGet, admin.SnapshotsPath+"node", "viewer")
+	if code != http.StatusOK {
+		t.Fatalf("snapshot => got %d, want %d", code, http.StatusOK)
+	}
+	var snap admin.Snapshot
+	if err := json.Unmarshal(out, &snap); err != nil {
+		t.Fatal(err)
+	}
+	if _, exists := snap.Resources[rsrc.ClusterType].Items["cluster"]; !exists {
+		t.Errorf("snapshot clusters => got %v", snap.Resources[rsrc.ClusterType])
+	}
+	if secret := string(snap.Resources[rsrc.SecretType].Items["tls"]); secret != `{"name":"tls"}` {
+		t.Errorf("viewer secret => got %s, want redacted", secret)
+	}
+	if out, _ := serve(http.MethodGet, admin.SnapshotsPath+"node", "operator"); !strings.Contains(string(out), "certificate_chain") {
+		t.Errorf("operator snapshot => got %s, want secret contents", out)
+	}
+	if _, code := serve(http.MethodGet, admin.SnapshotsPath+"missing", "viewer"); code != http.StatusNotFound {
+		t.Errorf("missing snapshot => got %d, want %d", code, http.StatusNotFound)
+	}
+
+	// the single resources are read without the snapshot
+	if out, code := serve(http.MethodGet, admin.ResourcesPath+"node?type="+rsrc.ClusterType, "viewer"); code != http.StatusOK || string(out) != `["cluster"]` {
+		t.Errorf("resource names => got %d %s", code, out)
+	}
+	if out, code := serve(http.MethodGet, admin.ResourcesPath+"node?type="+rsrc.ClusterType+"&name=cluster", "viewer"); code != http.StatusOK || !strings.Contains(string(out), `"name":"cluster"`) {
+		t.Errorf("resource => got %d %s", code, out)
+	}
+	if out, _ := serve(http.MethodGet, admin.ResourcesPath+"node?type="+rsrc.SecretType+"&name=tls", "viewer"); string(out) != `{"name":"tls"}` {
+		t.Errorf("viewer secret resource => got %s, want redacted", out)
+	}
+	if _, code := serve(http.MethodGet, admin.ResourcesPath+"node?type="+rsrc.ClusterType+"&name=missing", "viewer"); code != http.StatusNotFound {
+		t.Errorf("missing resource => got %d, want %d", code, http.StatusNotFound)
+	}
+	if _, code := serve(http.MethodGet, admin.ResourcesPath+"node?type=unknown", "viewer"); code != http.StatusBadRequest {
+		t.Errorf("unknown type => got %d, want %d", code, http.StatusBadRequest)
+	}
+
+	// the diffs are reported by field path, and the secrets by name to viewers
+	other := resource.MakeSecrets("tls", "root")[1]
+	other.Name = "tls"
+	if err := c.SetSnapshot("other", cache.NewSnapshot("2",
+		nil,
+		[]types.Resource{resource.MakeCluster(resource.Ads, "cluster")},
+		nil, nil, nil,
+		[]types.Resource{other})); err != nil {
+		t.Fatal(err)
+	}
+	out, code = serve(http.MethodGet, admin.DiffPath+"node?against=other", "viewer")
+	var changes map[string][]string
+	if err := json.Unmarshal(out, &changes); code != http.StatusOK || err != nil {
+		t.Fatalf("diff => got %d %s", code, out)
+	}
+	if got := changes[rsrc.ClusterType]; len(got) != 3 || got[0] != `~ version: 2 -> 1` || got[2] != "- cluster.eds_cluster_config.eds_config.ads: {}" {
+		t.Errorf("cluster diff => got %q", got)
+	}
+	if got := changes[rsrc.SecretType]; len(got) != 2 || got[1] != "~ tls" {
+		t.Errorf("viewer secret diff => got %q, want redacted", got)
+	}
+	if _, code := serve(http.MethodGet, admin.DiffPath+"node?against=missing", "viewer"); code != http.StatusNotFound {
+		t.Errorf("missing diff => got %d, want %d", code, http.StatusNotFound)
+	}
+
+	// the convergence follows the accepted versions
+	status := func() admin.NodeStatus {
+		out, code := serve(http.MethodGet, admin.StatusPath, "viewer")
+		var nodes []admin.NodeStatus
+		if err := json.Unmarshal(out, &nodes); code != http.StatusOK || err != nil || len(nodes) != 1 {
+			t.Fatalf("status => got %d %s", code, out)
+		}
+		return nodes[0]
+	}
+	if got := status(); got.Node != "node" || got.Versions[rsrc.ClusterType] != "1" || got.Watches != 1 || got.Converged {
+		t.Errorf("status => got %+v, want not converged", got)
+	}
+	h.Recorder.OnStreamRequest(1, &discovery.DiscoveryRequest{Node: &core.Node{Id: "node"}, TypeUrl: rsrc.ClusterType, VersionInfo: "1"})
+	if got := status(); got.Converged {
+		t.Errorf("status => got %+v, want not converged before the secrets are accepted", got)
+	}
+	h.Recorder.OnStreamRequest(1, &discovery.DiscoveryRequest{TypeUrl: rsrc.SecretType, VersionInfo: "1"})
+	if got := status(); !got.Converged {
+		t.Errorf("status => got %+v, want converged", got)
+	}
+	if out, _ := serve(http.MethodGet, admin.NACKsPath, "viewer"); string(out) != "[]" {
+		t.Errorf("nacks => got %s, want none", out)
+	}
+
+	if out, code := serve(http.MethodGet, admin.UIPath, ""); code != http.StatusOK || !strings.Contains(string(out), "<html>") {
+		t.Errorf("ui => got %d", code)
+	}
+
+	// mutations require the operator role
+	if _, code := serve(http.MethodDelete, admin.SnapshotsPath+"node", "viewer"); code != http.StatusForbidden {
+		t.Errorf("viewer delete => got %d, want %d", code, http.StatusForbidden)
+	}
+	if _, code := serve(http.MethodDelete, admin.SnapshotsPath+"node", "operator"); code != http.StatusNoContent {
+		t.Errorf("operator delete => got %d, want %d", code, http.StatusNoContent)
+	}
+	if _, err := c.GetSnapshot("node"); err == nil {
+		t.Error("expected snapshot to be cleared")
+	}
+	if got := h.Recorder.Accepted("node"); len(got) != 0 {
+		t.Errorf("accepted versions after delete => got %v, want none", got)
+	}
+}
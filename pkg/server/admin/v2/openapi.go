@@ -0,0 +1,219 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package admin
+
+import (
+	"github.com/envoyproxy/go-control-plane/pkg/openapi"
+)
+
+// OpenAPIPath is the path of the OpenAPI description of the admin API.
+const OpenAPIPath = "/openapi.json"
+
+// OpenAPI describes the admin API.
+func OpenAPI() *openapi.Document {
+	doc := openapi.NewDocument("Control plane admin", "v1")
+	doc.Info.Description = "Introspects the snapshot cache. The viewers read the resources " +
+		"without the secret contents, and the operators use the mutating endpoints."
+	doc.Components.SecuritySchemes = map[string]openapi.SecurityScheme{
+		"bearer": {Type: "http", Scheme: "bearer"},
+	}
+	doc.Security = []openapi.Requirement{{"bearer": {}}}
+
+	str := &openapi.Schema{Type: "string"}
+	integer := &openapi.Schema{Type: "integer"}
+	counts := &openapi.Schema{Type: "object", AdditionalProperties: integer}
+	doc.Components.Schemas["Resources"] = &openapi.Schema{
+		Type: "object",
+		Properties: map[string]*openapi.Schema{
+			"version": str,
+			"items": {
+				Type:                 "object",
+				Description:          "The resources in the JSON mapping indexed by name.",
+				AdditionalProperties: &openapi.Schema{Type: "object"},
+			},
+		},
+	}
+	doc.Components.Schemas["Snapshot"] = &openapi.Schema{
+		Type: "object",
+		Properties: map[string]*openapi.Schema{
+			"resources": {
+				Type:                 "object",
+				Description:          "The resource groups indexed by type URL.",
+				AdditionalProperties: openapi.Ref("Resources"),
+			},
+			"signature": {Type: "string", Format: "byte"},
+		},
+	}
+	doc.Components.Schemas["Usage"] = &openapi.Schema{
+		Type: "object",
+		Properties: map[string]*openapi.Schema{
+			"nodes":     counts,
+			"tenants":   counts,
+			"responses": integer,
+			"total":     integer,
+		},
+	}
+	doc.Components.Schemas["Diff"] = &openapi.Schema{
+		Type:                 "object",
+		Description:          "The changes by field path indexed by type URL.",
+		AdditionalProperties: &openapi.Schema{Type: "array", Items: str},
+	}
+
+	doc.Components.Schemas["NodeStatus"] = &openapi.Schema{
+		Type: "object",
+		Properties: map[string]*openapi.Schema{
+			"node":         str,
+			"versions":     {Type: "object", Description: "The snapshot versions by type URL.", AdditionalProperties: str},
+			"accepted":     {Type: "object", Description: "The accepted versions by type URL.", AdditionalProperties: str},
+			"converged":    {Type: "boolean"},
+			"watches":      integer,
+			"last_request": {Type: "string", Format: "date-time"},
+		},
+	}
+	doc.Components.Schemas["NACK"] = &openapi.Schema{
+		Type: "object",
+		Properties: map[string]*openapi.Schema{
+			"time":     {Type: "string", Format: "date-time"},
+			"node":     str,
+			"type_url": str,
+			"version":  {Type: "string", Description: "The last version accepted by the node."},
+			"nonce":    str,
+			"message":  str,
+		},
+	}
+
+	node := openapi.Parameter{Name: "node", In: "path", Required: true, Schema: str}
+	errors := map[string]openapi.Response{
+		"401": {Description: "The credentials are not valid."},
+		"404": {Description: "The snapshot is not found."},
+	}
+	responses := func(code string, response openapi.Response) map[string]openapi.Response {
+		out := map[string]openapi.Response{code: response}
+		for code, response := range errors {
+			out[code] = response
+		}
+		return out
+	}
+
+	doc.Paths[NodesPath] = openapi.PathItem{
+		"get": {
+			Summary:     "Lists the node IDs with open watches.",
+			OperationID: "listNodes",
+			Responses: responses("200", openapi.Response{
+				Description: "The node IDs.",
+				Content:     openapi.JSON(&openapi.Schema{Type: "array", Items: str}),
+			}),
+		},
+	}
+	doc.Paths[UsagePath] = openapi.PathItem{
+		"get": {
+			Summary:     "Reports the memory usage by node and tenant.",
+			OperationID: "getUsage",
+			Responses: responses("200", openapi.Response{
+				Description: "The usage in bytes.",
+				Content:     openapi.JSON(openapi.Ref("Usage")),
+			}),
+		},
+	}
+	doc.Paths[StatusPath] = openapi.PathItem{
+		"get": {
+			Summary:     "Reports the node versions and convergence.",
+			OperationID: "getStatus",
+			Responses: responses("200", openapi.Response{
+				Description: "The node states.",
+				Content:     openapi.JSON(&openapi.Schema{Type: "array", Items: openapi.Ref("NodeStatus")}),
+			}),
+		},
+	}
+	doc.Paths[NACKsPath] = openapi.PathItem{
+		"get": {
+			Summary:     "Lists the recent NACKs, the latest first.",
+			OperationID: "listNACKs",
+			Responses: responses("200", openapi.Response{
+				Description: "The NACKs.",
+				Content:     openapi.JSON(&openapi.Schema{Type: "array", Items: openapi.Ref("NACK")}),
+			}),
+		},
+	}
+	doc.Paths[SnapshotsPath+"{node}"] = openapi.PathItem{
+		"get": {
+			Summary:     "Returns the node snapshot.",
+			OperationID: "getSnapshot",
+			Parameters:  []openapi.Parameter{node},
+			Responses: responses("200", openapi.Response{
+				Description: "The snapshot.",
+				Content:     openapi.JSON(openapi.Ref("Snapshot")),
+			}),
+		},
+		"delete": {
+			Summary:     "Clears the node snapshot. Requires the operator role.",
+			OperationID: "clearSnapshot",
+			Parameters:  []openapi.Parameter{node},
+			Responses: responses("204", openapi.Response{
+				Description: "The snapshot is cleared.",
+			}),
+		},
+	}
+	doc.Paths[SnapshotsPath+"{node}"]["delete"].Responses["403"] = openapi.Response{
+		Description: "The user is not an operator.",
+	}
+	doc.Paths[ResourcesPath+"{node}"] = openapi.PathItem{
+		"get": {
+			Summary: "Lists the resource names of a type in the node snapshot, " +
+				"or returns a resource if the name is set.",
+			OperationID: "getResources",
+			Parameters: []openapi.Parameter{node, {
+				Name:     "type",
+				In:       "query",
+				Required: true,
+				Schema:   str,
+			}, {
+				Name:   "name",
+				In:     "query",
+				Schema: str,
+			}},
+			Responses: responses("200", openapi.Response{
+				Description: "The sorted resource names, or the resource in the JSON mapping.",
+				Content:     openapi.JSON(&openapi.Schema{Type: "object"}),
+			}),
+		},
+	}
+	doc.Paths[ResourcesPath+"{node}"]["get"].Responses["400"] = openapi.Response{
+		Description: "The type URL is unknown.",
+	}
+	doc.Paths[DiffPath+"{node}"] = openapi.PathItem{
+		"get": {
+			Summary:     "Compares the node snapshot to the snapshot of another node.",
+			OperationID: "diffSnapshots",
+			Parameters: []openapi.Parameter{node, {
+				Name:     "against",
+				In:       "query",
+				Required: true,
+				Schema:   str,
+			}},
+			Responses: responses("200", openapi.Response{
+				Description: "The changes from the other snapshot.",
+				Content:     openapi.JSON(openapi.Ref("Diff")),
+			}),
+		},
+	}
+	doc.Paths[OpenAPIPath] = openapi.PathItem{
+		"get": {
+			OperationID: "openAPI",
+			Responses:   responses("200", openapi.Response{Description: "This document."}),
+		},
+	}
+	return doc
+}
@@ -0,0 +1,183 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package admin
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	discovery "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/server/v2"
+)
+
+// NACK is a rejected configuration update.
+type NACK struct {
+	Time    time.Time `json:"time"`
+	Node    string    `json:"node"`
+	TypeURL string    `json:"type_url"`
+	// Version is the last version accepted by the node.
+	Version string `json:"version"`
+	Nonce   string `json:"nonce"`
+	Message string `json:"message"`
+}
+
+// Recorder tracks the versions accepted by the nodes and the recent NACKs
+// from the stream requests. It is a set of server callbacks.
+type Recorder struct {
+	hash  cache.NodeHash
+	limit int
+
+	streams map[int64]string
+	acked   map[string]map[string]string
+	nacks   []NACK
+	// accepted is closed and replaced on every accepted version
+	accepted chan struct{}
+	mu       sync.Mutex
+}
+
+var _ server.Callbacks = &Recorder{}
+
+// NewRecorder creates a recorder retaining a number of recent NACKs.
+func NewRecorder(hash cache.NodeHash, limit int) *Recorder {
+	return &Recorder{
+		hash:     hash,
+		limit:    limit,
+		streams:  make(map[int64]string),
+		acked:    make(map[string]map[string]string),
+		accepted: make(chan struct{}),
+	}
+}
+
+// Accepted returns the versions accepted by the node by type URL.
+func (r *Recorder) Accepted(node string) map[string]string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make(map[string]string, len(r.acked[node]))
+	for typeURL, version := range r.acked[node] {
+		out[typeURL] = version
+	}
+	return out
+}
+
+// WaitAccepted waits until the node accepts the version of a type, or the
+// context is done. It implements cache.AckFunc.
+func (r *Recorder) WaitAccepted(ctx context.Context, node, typeURL, version string) error {
+	for {
+		r.mu.Lock()
+		current, accepted := r.acked[node][typeURL], r.accepted
+		r.mu.Unlock()
+		if current == version {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("node %s accepted version %q instead of %q: %v", node, current, version, ctx.Err())
+		case <-accepted:
+		}
+	}
+}
+
+// NACKs returns the recent NACKs, the latest first.
+func (r *Recorder) NACKs() []NACK {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make([]NACK, len(r.nacks))
+	for i, nack := range r.nacks {
+		out[len(out)-1-i] = nack
+	}
+	return out
+}
+
+// OnStreamOpen is a no-op.
+func (r *Recorder) OnStreamOpen(context.Context, int64, string) error {
+	return nil
+}
+
+// Forget drops the versions accepted by the node, e.g. once its snapshot is
+// cleared.
+func (r *Recorder) Forget(node string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.acked, node)
+}
+
+// OnStreamClosed forgets the stream node, and the versions accepted by the
+// node once it has no other open stream.
+func (r *Recorder) OnStreamClosed(id int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	node, exists := r.streams[id]
+	if !exists {
+		return
+	}
+	delete(r.streams, id)
+	for _, other := range r.streams {
+		if other == node {
+			return
+		}
+	}
+	delete(r.acked, node)
+}
+
+// OnStreamRequest records the accepted version or the NACK. The node is only
+// required in the first request on the stream.
+func (r *Recorder) OnStreamRequest(id int64, req *discovery.DiscoveryRequest) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if req.Node != nil {
+		r.streams[id] = r.hash.ID(req.Node)
+	}
+	node := r.streams[id]
+
+	if req.ErrorDetail != nil {
+		r.nacks = append(r.nacks, NACK{
+			Time:    time.Now(),
+			Node:    node,
+			TypeURL: req.TypeUrl,
+			Version: req.VersionInfo,
+			Nonce:   req.ResponseNonce,
+			Message: req.ErrorDetail.Message,
+		})
+		if len(r.nacks) > r.limit {
+			r.nacks = r.nacks[len(r.nacks)-r.limit:]
+		}
+		return nil
+	}
+	if req.VersionInfo != "" {
+		if r.acked[node] == nil {
+			r.acked[node] = make(map[string]string)
+		}
+		r.acked[node][req.TypeUrl] = req.VersionInfo
+		close(r.accepted)
+		r.accepted = make(chan struct{})
+	}
+	return nil
+}
+
+// OnStreamResponse is a no-op.
+func (r *Recorder) OnStreamResponse(int64, *discovery.DiscoveryRequest, *discovery.DiscoveryResponse) {
+}
+
+// OnFetchRequest is a no-op.
+func (r *Recorder) OnFetchRequest(context.Context, *discovery.DiscoveryRequest) error {
+	return nil
+}
+
+// OnFetchResponse is a no-op.
+func (r *Recorder) OnFetchResponse(*discovery.DiscoveryRequest, *discovery.DiscoveryResponse) {
+}
@@ -0,0 +1,92 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package admin_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/status"
+
+	discovery "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/v2"
+	rsrc "github.com/envoyproxy/go-control-plane/pkg/resource/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/server/admin/v2"
+)
+
+func TestRecorder(t *testing.T) {
+	r := admin.NewRecorder(cache.IDHash{}, 2)
+
+	// the node is only sent in the first request
+	r.OnStreamRequest(1, &discovery.DiscoveryRequest{Node: &core.Node{Id: "node"}, TypeUrl: rsrc.ClusterType})
+	r.OnStreamRequest(1, &discovery.DiscoveryRequest{TypeUrl: rsrc.ClusterType, VersionInfo: "1", ResponseNonce: "1"})
+	for i := 0; i < 3; i++ {
+		r.OnStreamRequest(1, &discovery.DiscoveryRequest{
+			TypeUrl:       rsrc.ClusterType,
+			VersionInfo:   "1",
+			ResponseNonce: fmt.Sprint(i + 2),
+			ErrorDetail:   &status.Status{Message: fmt.Sprint("rejected ", i)},
+		})
+	}
+
+	if got := r.Accepted("node"); len(got) != 1 || got[rsrc.ClusterType] != "1" {
+		t.Errorf("Accepted() => got %v, want version 1", got)
+	}
+	nacks := r.NACKs()
+	if len(nacks) != 2 || nacks[0].Message != "rejected 2" || nacks[1].Message != "rejected 1" || nacks[0].Node != "node" {
+		t.Errorf("NACKs() => got %+v, want the latest two", nacks)
+	}
+
+	// the accepted versions are kept until the last stream of the node closes
+	r.OnStreamRequest(2, &discovery.DiscoveryRequest{Node: &core.Node{Id: "node"}, TypeUrl: rsrc.ListenerType})
+	r.OnStreamClosed(1)
+	if got := r.Accepted("node"); got[rsrc.ClusterType] != "1" {
+		t.Errorf("Accepted() with an open stream => got %v", got)
+	}
+	r.OnStreamClosed(2)
+	r.OnStreamRequest(1, &discovery.DiscoveryRequest{TypeUrl: rsrc.ClusterType, VersionInfo: "2"})
+	if got := r.Accepted("node"); len(got) != 0 {
+		t.Errorf("Accepted() after close => got %v, want none", got)
+	}
+}
+
+func TestRecorderWaitAccepted(t *testing.T) {
+	r := admin.NewRecorder(cache.IDHash{}, 2)
+	var _ cache.AckFunc = r.WaitAccepted
+
+	done := make(chan error)
+	go func() {
+		done <- r.WaitAccepted(context.Background(), "node", rsrc.ListenerType, "2")
+	}()
+	r.OnStreamRequest(1, &discovery.DiscoveryRequest{Node: &core.Node{Id: "node"}, TypeUrl: rsrc.ListenerType, VersionInfo: "1"})
+	r.OnStreamRequest(1, &discovery.DiscoveryRequest{TypeUrl: rsrc.ListenerType, VersionInfo: "2"})
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("WaitAccepted() => got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("WaitAccepted() is not done after the version is accepted")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := r.WaitAccepted(ctx, "node", rsrc.ListenerType, "3"); err == nil {
+		t.Error("WaitAccepted() of a version never accepted => got no error")
+	}
+}
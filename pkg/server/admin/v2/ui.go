@@ -0,0 +1,159 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package admin
+
+// ui is the read-only fleet status page. It polls the admin API relative to
+// its path with the bearer token entered by the user, which is kept in the
+// session storage.
+const ui = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Control plane</title>
+<style>
+body { font-family: sans-serif; margin: 1em 2em; color: #222; }
+table { border-collapse: collapse; margin-bottom: 1.5em; }
+th, td { border-bottom: 1px solid #ddd; padding: 0.3em 0.8em; text-align: left; font-size: 0.9em; }
+tr.node { cursor: pointer; }
+tr.node:hover { background: #f3f3f3; }
+.ok { color: #1a7f37; }
+.stale { color: #b35900; }
+.error { color: #c00; }
+pre { background: #f6f8fa; padding: 0.8em; overflow: auto; font-size: 0.85em; }
+</style>
+</head>
+<body>
+<h1>Control plane</h1>
+<p>
+  <label>Token <input id="token" type="password" size="30"></label>
+  <span id="error" class="error"></span>
+</p>
+
+<h2>Nodes</h2>
+<table>
+  <thead><tr><th>Node</th><th>State</th><th>Versions</th><th>Watches</th><th>Last request</th></tr></thead>
+  <tbody id="nodes"></tbody>
+</table>
+
+<h2>Recent NACKs</h2>
+<table>
+  <thead><tr><th>Time</th><th>Node</th><th>Type</th><th>Accepted version</th><th>Error</th></tr></thead>
+  <tbody id="nacks"></tbody>
+</table>
+
+<h2>Configuration <span id="selected"></span></h2>
+<p><label>Search <input id="search" size="40"></label></p>
+<div id="config"></div>
+
+<script>
+var token = document.getElementById("token");
+var search = document.getElementById("search");
+var snapshot = null;
+token.value = sessionStorage.getItem("token") || "";
+token.onchange = function() { sessionStorage.setItem("token", token.value); refresh(); };
+search.oninput = render;
+
+function get(path) {
+  return fetch(path, {headers: {"Authorization": "Bearer " + token.value}}).then(function(resp) {
+    if (!resp.ok) { throw new Error(path + ": " + resp.status); }
+    return resp.json();
+  });
+}
+
+function shortType(typeURL) {
+  return typeURL.substring(typeURL.lastIndexOf(".") + 1);
+}
+
+function cell(row, text, cls) {
+  var td = row.insertCell();
+  td.textContent = text;
+  if (cls) { td.className = cls; }
+}
+
+function refresh() {
+  get("status").then(function(nodes) {
+    var body = document.getElementById("nodes");
+    body.innerHTML = "";
+    nodes.forEach(function(node) {
+      var row = body.insertRow();
+      row.className = "node";
+      row.onclick = function() { select(node.node); };
+      cell(row, node.node);
+      if (!node.accepted) { cell(row, "unknown"); }
+      else if (node.converged) { cell(row, "converged", "ok"); }
+      else { cell(row, "updating", "stale"); }
+      var versions = [];
+      Object.keys(node.versions).sort().forEach(function(typeURL) {
+        if (node.versions[typeURL]) {
+          var accepted = node.accepted && node.accepted[typeURL];
+          versions.push(shortType(typeURL) + " " + node.versions[typeURL] +
+            (accepted && accepted !== node.versions[typeURL] ? " (at " + accepted + ")" : ""));
+        }
+      });
+      cell(row, versions.join(", "));
+      cell(row, node.watches);
+      cell(row, node.last_request);
+    });
+    document.getElementById("error").textContent = "";
+  }).catch(function(err) { document.getElementById("error").textContent = err.message; });
+
+  get("nacks").then(function(nacks) {
+    var body = document.getElementById("nacks");
+    body.innerHTML = "";
+    nacks.forEach(function(nack) {
+      var row = body.insertRow();
+      cell(row, nack.time);
+      cell(row, nack.node);
+      cell(row, shortType(nack.type_url));
+      cell(row, nack.version);
+      cell(row, nack.message, "error");
+    });
+  }).catch(function() {});
+}
+
+function select(node) {
+  document.getElementById("selected").textContent = "for " + node;
+  get("snapshots/" + encodeURIComponent(node)).then(function(snap) {
+    snapshot = snap;
+    render();
+  }).catch(function(err) { document.getElementById("error").textContent = err.message; });
+}
+
+function render() {
+  var out = document.getElementById("config");
+  out.innerHTML = "";
+  if (!snapshot) { return; }
+  var query = search.value.toLowerCase();
+  Object.keys(snapshot.resources).sort().forEach(function(typeURL) {
+    var group = snapshot.resources[typeURL];
+    Object.keys(group.items).sort().forEach(function(name) {
+      var text = JSON.stringify(group.items[name], null, 2);
+      if (query && (name + text).toLowerCase().indexOf(query) < 0) { return; }
+      var title = document.createElement("h3");
+      title.textContent = shortType(typeURL) + " " + name + " (version " + group.version + ")";
+      var pre = document.createElement("pre");
+      pre.textContent = text;
+      out.appendChild(title);
+      out.appendChild(pre);
+    });
+  });
+}
+
+refresh();
+setInterval(refresh, 5000);
+</script>
+</body>
+</html>
+`
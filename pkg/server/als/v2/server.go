@@ -0,0 +1,220 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+// Package als provides a receiver of the Access Log Service, to collect the
+// access logs of the proxies alongside the xDS server:
+//
+//	accessloggrpc.RegisterAccessLogServiceServer(grpcServer, als.NewServer(handler))
+package als
+
+import (
+	"context"
+	"io"
+	"sync/atomic"
+	"time"
+
+	alf "github.com/envoyproxy/go-control-plane/envoy/data/accesslog/v2"
+	accessloggrpc "github.com/envoyproxy/go-control-plane/envoy/service/accesslog/v2"
+)
+
+// Identifier is the node and the log name of a stream.
+type Identifier = accessloggrpc.StreamAccessLogsMessage_Identifier
+
+// Handler processes the access log entries. Returning an error closes the
+// stream, and the proxy reconnects.
+type Handler interface {
+	HandleHTTP(context.Context, *Identifier, []*alf.HTTPAccessLogEntry) error
+	HandleTCP(context.Context, *Identifier, []*alf.TCPAccessLogEntry) error
+}
+
+// HandlerFuncs is a convenience type for implementing the Handler interface.
+type HandlerFuncs struct {
+	HTTPFunc func(context.Context, *Identifier, []*alf.HTTPAccessLogEntry) error
+	TCPFunc  func(context.Context, *Identifier, []*alf.TCPAccessLogEntry) error
+}
+
+var _ Handler = HandlerFuncs{}
+
+// HandleHTTP invokes HTTPFunc.
+func (h HandlerFuncs) HandleHTTP(ctx context.Context, id *Identifier, entries []*alf.HTTPAccessLogEntry) error {
+	if h.HTTPFunc != nil {
+		return h.HTTPFunc(ctx, id, entries)
+	}
+	return nil
+}
+
+// HandleTCP invokes TCPFunc.
+func (h HandlerFuncs) HandleTCP(ctx context.Context, id *Identifier, entries []*alf.TCPAccessLogEntry) error {
+	if h.TCPFunc != nil {
+		return h.TCPFunc(ctx, id, entries)
+	}
+	return nil
+}
+
+// Server receives the access log streams. The messages of a stream are queued
+// for the handler, and a full queue either blocks the stream, which applies
+// the gRPC flow control to the proxy, or drops the messages.
+type Server struct {
+	handler       Handler
+	batchSize     int
+	flushInterval time.Duration
+	queueSize     int
+	drop          bool
+
+	// dropped counts the entries dropped on a full queue
+	dropped int64
+}
+
+// Option sets a server option.
+type Option func(*Server)
+
+// WithBatching accumulates the entries of a stream until there are size
+// entries or for the interval, whichever comes first. The entries of each
+// message are handled at once by default.
+func WithBatching(size int, interval time.Duration) Option {
+	return func(s *Server) {
+		s.batchSize = size
+		s.flushInterval = interval
+	}
+}
+
+// WithQueueSize sets the number of messages of a stream queued for the
+// handler, 16 by default.
+func WithQueueSize(size int) Option {
+	return func(s *Server) {
+		s.queueSize = size
+	}
+}
+
+// WithDropOnOverflow drops the messages on a full queue instead of blocking
+// the stream.
+func WithDropOnOverflow() Option {
+	return func(s *Server) {
+		s.drop = true
+	}
+}
+
+// NewServer creates an access log receiver with a handler.
+func NewServer(handler Handler, opts ...Option) *Server {
+	s := &Server{handler: handler, queueSize: 16}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+var _ accessloggrpc.AccessLogServiceServer = &Server{}
+
+// Dropped returns the number of entries dropped on a full queue.
+func (s *Server) Dropped() int64 {
+	return atomic.LoadInt64(&s.dropped)
+}
+
+// StreamAccessLogs implements the access log service.
+func (s *Server) StreamAccessLogs(stream accessloggrpc.AccessLogService_StreamAccessLogsServer) error {
+	ctx := stream.Context()
+	queue := make(chan *accessloggrpc.StreamAccessLogsMessage, s.queueSize)
+	errs := make(chan error, 1)
+	go func() {
+		defer close(queue)
+		for {
+			msg, err := stream.Recv()
+			if err != nil {
+				if err != io.EOF {
+					errs <- err
+				}
+				return
+			}
+			if s.drop {
+				select {
+				case queue <- msg:
+				default:
+					atomic.AddInt64(&s.dropped, int64(len(msg.GetHttpLogs().GetLogEntry())+len(msg.GetTcpLogs().GetLogEntry())))
+				}
+				continue
+			}
+			select {
+			case queue <- msg:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var ticker <-chan time.Time
+	if s.flushInterval > 0 {
+		t := time.NewTicker(s.flushInterval)
+		defer t.Stop()
+		ticker = t.C
+	}
+
+	b := &batch{}
+	for {
+		select {
+		case msg, more := <-queue:
+			if !more {
+				if err := s.flush(ctx, b); err != nil {
+					return err
+				}
+				select {
+				case err := <-errs:
+					return err
+				default:
+					return nil
+				}
+			}
+			// the identifier is only sent in the first message of a stream
+			if msg.Identifier != nil {
+				if err := s.flush(ctx, b); err != nil {
+					return err
+				}
+				b.identifier = msg.Identifier
+			}
+			b.http = append(b.http, msg.GetHttpLogs().GetLogEntry()...)
+			b.tcp = append(b.tcp, msg.GetTcpLogs().GetLogEntry()...)
+			if len(b.http)+len(b.tcp) >= s.batchSize {
+				if err := s.flush(ctx, b); err != nil {
+					return err
+				}
+			}
+		case <-ticker:
+			if err := s.flush(ctx, b); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// batch accumulates the entries of a stream.
+type batch struct {
+	identifier *Identifier
+	http       []*alf.HTTPAccessLogEntry
+	tcp        []*alf.TCPAccessLogEntry
+}
+
+func (s *Server) flush(ctx context.Context, b *batch) error {
+	if len(b.http) > 0 {
+		if err := s.handler.HandleHTTP(ctx, b.identifier, b.http); err != nil {
+			return err
+		}
+		b.http = nil
+	}
+	if len(b.tcp) > 0 {
+		if err := s.handler.HandleTCP(ctx, b.identifier, b.tcp); err != nil {
+			return err
+		}
+		b.tcp = nil
+	}
+	return nil
+}
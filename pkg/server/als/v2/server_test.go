@@ -0,0 +1,181 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package als_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+
+	"google.golang.org/grpc"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	alf "github.com/envoyproxy/go-control-plane/envoy/data/accesslog/v2"
+	accessloggrpc "github.com/envoyproxy/go-control-plane/envoy/service/accesslog/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/server/als/v2"
+)
+
+type mockStream struct {
+	recv chan *accessloggrpc.StreamAccessLogsMessage
+	grpc.ServerStream
+}
+
+func (stream *mockStream) Context() context.Context {
+	return context.Background()
+}
+
+func (stream *mockStream) SendAndClose(*accessloggrpc.StreamAccessLogsResponse) error {
+	return nil
+}
+
+func (stream *mockStream) Recv() (*accessloggrpc.StreamAccessLogsMessage, error) {
+	msg, more := <-stream.recv
+	if !more {
+		return nil, io.EOF
+	}
+	return msg, nil
+}
+
+func makeMockStream(msgs ...*accessloggrpc.StreamAccessLogsMessage) *mockStream {
+	stream := &mockStream{recv: make(chan *accessloggrpc.StreamAccessLogsMessage, len(msgs))}
+	for _, msg := range msgs {
+		stream.recv <- msg
+	}
+	close(stream.recv)
+	return stream
+}
+
+func httpLogs(id *als.Identifier, n int) *accessloggrpc.StreamAccessLogsMessage {
+	entries := make([]*alf.HTTPAccessLogEntry, n)
+	for i := range entries {
+		entries[i] = &alf.HTTPAccessLogEntry{}
+	}
+	return &accessloggrpc.StreamAccessLogsMessage{
+		Identifier: id,
+		LogEntries: &accessloggrpc.StreamAccessLogsMessage_HttpLogs{
+			HttpLogs: &accessloggrpc.StreamAccessLogsMessage_HTTPAccessLogEntries{LogEntry: entries},
+		},
+	}
+}
+
+func tcpLogs(n int) *accessloggrpc.StreamAccessLogsMessage {
+	entries := make([]*alf.TCPAccessLogEntry, n)
+	for i := range entries {
+		entries[i] = &alf.TCPAccessLogEntry{}
+	}
+	return &accessloggrpc.StreamAccessLogsMessage{
+		LogEntries: &accessloggrpc.StreamAccessLogsMessage_TcpLogs{
+			TcpLogs: &accessloggrpc.StreamAccessLogsMessage_TCPAccessLogEntries{LogEntry: entries},
+		},
+	}
+}
+
+type recorder struct {
+	mu      sync.Mutex
+	batches []string
+	names   []string
+}
+
+func (r *recorder) handler() als.Handler {
+	record := func(id *als.Identifier, kind string, n int) {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.batches = append(r.batches, kind+strconv.Itoa(n))
+		r.names = append(r.names, id.GetLogName())
+	}
+	return als.HandlerFuncs{
+		HTTPFunc: func(_ context.Context, id *als.Identifier, entries []*alf.HTTPAccessLogEntry) error {
+			record(id, "http", len(entries))
+			return nil
+		},
+		TCPFunc: func(_ context.Context, id *als.Identifier, entries []*alf.TCPAccessLogEntry) error {
+			record(id, "tcp", len(entries))
+			return nil
+		},
+	}
+}
+
+func TestStreamAccessLogs(t *testing.T) {
+	id := &als.Identifier{Node: &core.Node{Id: "a"}, LogName: "log"}
+	r := &recorder{}
+	s := als.NewServer(r.handler())
+	if err := s.StreamAccessLogs(makeMockStream(httpLogs(id, 2), tcpLogs(1), httpLogs(nil, 1))); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"http2", "tcp1", "http1"}; !reflect.DeepEqual(r.batches, want) {
+		t.Errorf("batches => got %v, want %v", r.batches, want)
+	}
+	if want := []string{"log", "log", "log"}; !reflect.DeepEqual(r.names, want) {
+		t.Errorf("log names => got %v, want %v", r.names, want)
+	}
+}
+
+func TestStreamAccessLogsBatching(t *testing.T) {
+	r := &recorder{}
+	s := als.NewServer(r.handler(), als.WithBatching(3, 0))
+	if err := s.StreamAccessLogs(makeMockStream(httpLogs(nil, 1), httpLogs(nil, 1), tcpLogs(1), httpLogs(nil, 1))); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"http2", "tcp1", "http1"}; !reflect.DeepEqual(r.batches, want) {
+		t.Errorf("batches => got %v, want %v", r.batches, want)
+	}
+}
+
+func TestStreamAccessLogsHandlerError(t *testing.T) {
+	s := als.NewServer(als.HandlerFuncs{
+		HTTPFunc: func(context.Context, *als.Identifier, []*alf.HTTPAccessLogEntry) error {
+			return errors.New("unavailable")
+		},
+	})
+	if err := s.StreamAccessLogs(makeMockStream(httpLogs(nil, 1))); err == nil {
+		t.Error("handler error => got none")
+	}
+}
+
+func TestStreamAccessLogsDropOnOverflow(t *testing.T) {
+	release := make(chan struct{})
+	var mu sync.Mutex
+	handled := 0
+	s := als.NewServer(als.HandlerFuncs{
+		HTTPFunc: func(_ context.Context, _ *als.Identifier, entries []*alf.HTTPAccessLogEntry) error {
+			<-release
+			mu.Lock()
+			defer mu.Unlock()
+			handled += len(entries)
+			return nil
+		},
+	}, als.WithQueueSize(1), als.WithDropOnOverflow())
+
+	stream := &mockStream{recv: make(chan *accessloggrpc.StreamAccessLogsMessage)}
+	done := make(chan error)
+	go func() {
+		done <- s.StreamAccessLogs(stream)
+	}()
+	for i := 0; i < 3; i++ {
+		stream.recv <- httpLogs(nil, 1)
+	}
+	close(stream.recv)
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if dropped := s.Dropped(); dropped < 1 || int(dropped)+handled != 3 {
+		t.Errorf("entries => got %d dropped and %d handled, want 3 with a drop", dropped, handled)
+	}
+}
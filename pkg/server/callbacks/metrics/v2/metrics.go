@@ -0,0 +1,179 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+// Package metrics provides server callbacks exporting Prometheus metrics.
+package metrics
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	discovery "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/server/v2"
+)
+
+// Callbacks exports the activity of the server as Prometheus metrics:
+//
+//   - xds_streams_total and xds_active_streams count the streams,
+//   - xds_requests_total and xds_responses_total count the stream and fetch
+//     requests and responses by type URL,
+//   - xds_nacks_total counts the responses rejected by the proxies,
+//   - xds_response_latency_seconds is the time taken by the proxies to
+//     acknowledge or reject the stream responses.
+//
+// The callbacks are a Prometheus collector:
+//
+//	metrics := NewCallbacks("envoy")
+//	prometheus.MustRegister(metrics)
+//	srv := server.NewServer(ctx, snapshotCache, metrics)
+type Callbacks struct {
+	streams   prometheus.Counter
+	active    prometheus.Gauge
+	requests  *prometheus.CounterVec
+	responses *prometheus.CounterVec
+	nacks     *prometheus.CounterVec
+	latency   *prometheus.HistogramVec
+
+	mu      sync.Mutex
+	pending map[int64]map[string]pendingResponse
+}
+
+type pendingResponse struct {
+	nonce string
+	sent  time.Time
+}
+
+var _ server.Callbacks = &Callbacks{}
+var _ prometheus.Collector = &Callbacks{}
+
+// NewCallbacks creates the metrics with an optional namespace.
+func NewCallbacks(namespace string) *Callbacks {
+	labels := []string{"type_url"}
+	return &Callbacks{
+		streams: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "xds_streams_total",
+			Help:      "Number of opened xDS streams.",
+		}),
+		active: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "xds_active_streams",
+			Help:      "Number of open xDS streams.",
+		}),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "xds_requests_total",
+			Help:      "Number of xDS requests.",
+		}, labels),
+		responses: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "xds_responses_total",
+			Help:      "Number of xDS responses.",
+		}, labels),
+		nacks: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "xds_nacks_total",
+			Help:      "Number of xDS responses rejected by the proxies.",
+		}, labels),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "xds_response_latency_seconds",
+			Help:      "Time taken by the proxies to acknowledge or reject the xDS responses.",
+			Buckets:   prometheus.ExponentialBuckets(0.005, 2, 12),
+		}, labels),
+		pending: make(map[int64]map[string]pendingResponse),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *Callbacks) Describe(ch chan<- *prometheus.Desc) {
+	c.streams.Describe(ch)
+	c.active.Describe(ch)
+	c.requests.Describe(ch)
+	c.responses.Describe(ch)
+	c.nacks.Describe(ch)
+	c.latency.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (c *Callbacks) Collect(ch chan<- prometheus.Metric) {
+	c.streams.Collect(ch)
+	c.active.Collect(ch)
+	c.requests.Collect(ch)
+	c.responses.Collect(ch)
+	c.nacks.Collect(ch)
+	c.latency.Collect(ch)
+}
+
+// OnStreamOpen counts the stream.
+func (c *Callbacks) OnStreamOpen(context.Context, int64, string) error {
+	c.streams.Inc()
+	c.active.Inc()
+	return nil
+}
+
+// OnStreamClosed counts the stream closure.
+func (c *Callbacks) OnStreamClosed(id int64) {
+	c.active.Dec()
+	c.mu.Lock()
+	delete(c.pending, id)
+	c.mu.Unlock()
+}
+
+// OnStreamRequest counts the request, and records the latency of the
+// acknowledged or rejected response.
+func (c *Callbacks) OnStreamRequest(id int64, req *discovery.DiscoveryRequest) error {
+	c.requests.WithLabelValues(req.TypeUrl).Inc()
+	if req.ErrorDetail != nil {
+		c.nacks.WithLabelValues(req.TypeUrl).Inc()
+	}
+
+	c.mu.Lock()
+	response, exists := c.pending[id][req.TypeUrl]
+	if exists && response.nonce == req.ResponseNonce {
+		delete(c.pending[id], req.TypeUrl)
+	}
+	c.mu.Unlock()
+	if exists && response.nonce == req.ResponseNonce {
+		c.latency.WithLabelValues(req.TypeUrl).Observe(time.Since(response.sent).Seconds())
+	}
+	return nil
+}
+
+// OnStreamResponse counts the response, and records it awaiting the
+// acknowledgement.
+func (c *Callbacks) OnStreamResponse(id int64, _ *discovery.DiscoveryRequest, resp *discovery.DiscoveryResponse) {
+	c.responses.WithLabelValues(resp.TypeUrl).Inc()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.pending[id] == nil {
+		c.pending[id] = make(map[string]pendingResponse)
+	}
+	c.pending[id][resp.TypeUrl] = pendingResponse{nonce: resp.Nonce, sent: time.Now()}
+}
+
+// OnFetchRequest counts the request.
+func (c *Callbacks) OnFetchRequest(_ context.Context, req *discovery.DiscoveryRequest) error {
+	c.requests.WithLabelValues(req.TypeUrl).Inc()
+	return nil
+}
+
+// OnFetchResponse counts the response.
+func (c *Callbacks) OnFetchResponse(_ *discovery.DiscoveryRequest, resp *discovery.DiscoveryResponse) {
+	c.responses.WithLabelValues(resp.TypeUrl).Inc()
+}
@@ -0,0 +1,77 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package metrics_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/genproto/googleapis/rpc/status"
+
+	discovery "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/resource/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/server/callbacks/metrics/v2"
+)
+
+func TestCallbacks(t *testing.T) {
+	c := metrics.NewCallbacks("test")
+	registry := prometheus.NewPedanticRegistry()
+	if err := registry.Register(c); err != nil {
+		t.Fatal(err)
+	}
+
+	_ = c.OnStreamOpen(context.Background(), 1, resource.AnyType)
+	_ = c.OnStreamOpen(context.Background(), 2, resource.ClusterType)
+	c.OnStreamClosed(2)
+
+	_ = c.OnStreamRequest(1, &discovery.DiscoveryRequest{TypeUrl: resource.ClusterType})
+	c.OnStreamResponse(1, nil, &discovery.DiscoveryResponse{TypeUrl: resource.ClusterType, Nonce: "1"})
+	_ = c.OnStreamRequest(1, &discovery.DiscoveryRequest{TypeUrl: resource.ClusterType, ResponseNonce: "1"})
+	c.OnStreamResponse(1, nil, &discovery.DiscoveryResponse{TypeUrl: resource.ClusterType, Nonce: "2"})
+	_ = c.OnStreamRequest(1, &discovery.DiscoveryRequest{TypeUrl: resource.ClusterType, ResponseNonce: "2", ErrorDetail: &status.Status{}})
+	_ = c.OnFetchRequest(context.Background(), &discovery.DiscoveryRequest{TypeUrl: resource.RouteType})
+	c.OnFetchResponse(nil, &discovery.DiscoveryResponse{TypeUrl: resource.RouteType})
+
+	want := `
+# HELP test_xds_active_streams Number of open xDS streams.
+# TYPE test_xds_active_streams gauge
+test_xds_active_streams 1
+# HELP test_xds_nacks_total Number of xDS responses rejected by the proxies.
+# TYPE test_xds_nacks_total counter
+test_xds_nacks_total{type_url="CLUSTER"} 1
+# HELP test_xds_requests_total Number of xDS requests.
+# TYPE test_xds_requests_total counter
+test_xds_requests_total{type_url="CLUSTER"} 3
+test_xds_requests_total{type_url="ROUTE"} 1
+# HELP test_xds_responses_total Number of xDS responses.
+# TYPE test_xds_responses_total counter
+test_xds_responses_total{type_url="CLUSTER"} 2
+test_xds_responses_total{type_url="ROUTE"} 1
+# HELP test_xds_streams_total Number of opened xDS streams.
+# TYPE test_xds_streams_total counter
+test_xds_streams_total 2
+`
+	names := []string{"test_xds_active_streams", "test_xds_nacks_total", "test_xds_requests_total", "test_xds_responses_total", "test_xds_streams_total"}
+	want = strings.NewReplacer("CLUSTER", resource.ClusterType, "ROUTE", resource.RouteType).Replace(want)
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(want), names...); err != nil {
+		t.Error(err)
+	}
+	if got := testutil.CollectAndCount(c, "test_xds_response_latency_seconds"); got != 1 {
+		t.Errorf("latency histograms => got %d, want 1", got)
+	}
+}
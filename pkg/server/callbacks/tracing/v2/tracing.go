@@ -0,0 +1,316 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+// Package tracing provides server callbacks tracing the xDS streams.
+package tracing
+
+import (
+	"context"
+	"strconv"
+	"sync"
+
+	discovery "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/server/v2"
+)
+
+// The span attributes.
+const (
+	StreamIDAttribute      = "xds.stream_id"
+	NodeIDAttribute        = "xds.node_id"
+	TypeURLAttribute       = "xds.type_url"
+	VersionAttribute       = "xds.version_info"
+	NonceAttribute         = "xds.nonce"
+	ResourceCountAttribute = "xds.resource_count"
+)
+
+// Tracer starts the spans, e.g. an adapter of an OpenTelemetry tracer:
+//
+//	func (t otelTracer) Start(ctx context.Context, name string, attributes map[string]string) (context.Context, tracing.Span) {
+//		ctx, span := t.tracer.Start(ctx, name, trace.WithAttributes(toKeyValues(attributes)...))
+//		return ctx, otelSpan{span}
+//	}
+//
+// The spans started with the context of a span are its children.
+type Tracer interface {
+	Start(ctx context.Context, name string, attributes map[string]string) (context.Context, Span)
+}
+
+// Span is a span started by a tracer.
+type Span interface {
+	// SetAttributes adds attributes to the span.
+	SetAttributes(attributes map[string]string)
+
+	// AddEvent records an event in the span.
+	AddEvent(name string, attributes map[string]string)
+
+	// SetError marks the span as failed.
+	SetError(message string)
+
+	// End completes the span.
+	End()
+}
+
+// Callbacks traces the streams of the server:
+//
+//   - an xds.stream span lasts from the opening to the closing of a stream,
+//     and carries the node ID once known,
+//   - an xds.request child span is recorded for each request, and fails for
+//     the NACKs,
+//   - an xds.response child span lasts from the sending of a response to its
+//     acknowledgement, or ends with a superseded or abandoned event if a newer
+//     response of the type is sent or the stream closes first. The span
+//     measures the propagation of a version to the proxy,
+//   - an xds.fetch span is recorded for each REST request,
+//   - an xds.propagation span lasts from the update of a snapshot by
+//     SetSnapshot to the acknowledgement of its version of a type by the
+//     node, and carries the trace of the update to the proxy.
+type Callbacks struct {
+	tracer Tracer
+
+	mu           sync.Mutex
+	streams      map[int64]*stream
+	propagations map[string]map[string]propagation
+}
+
+type stream struct {
+	ctx       context.Context
+	span      Span
+	node      string
+	responses map[string]pendingResponse
+}
+
+type pendingResponse struct {
+	nonce   string
+	version string
+	span    Span
+}
+
+// propagation is the pending propagation of a version of a type to a node.
+type propagation struct {
+	version string
+	span    Span
+}
+
+var _ server.Callbacks = &Callbacks{}
+
+// NewCallbacks creates the callbacks with a tracer.
+func NewCallbacks(tracer Tracer) *Callbacks {
+	return &Callbacks{
+		tracer:       tracer,
+		streams:      make(map[int64]*stream),
+		propagations: make(map[string]map[string]propagation),
+	}
+}
+
+// SetSnapshot sets the snapshot of a node in the cache, and starts an
+// xds.propagation span for each type with a new version, as a child of the
+// span of the context, e.g. the span of the API call updating the
+// configuration. The span records the responses sending the version to the
+// node, and ends with its acknowledgement or rejection by any stream of the
+// node, or with a superseded event once a newer version of the type is set.
+//
+//	err := callbacks.SetSnapshot(ctx, snapshotCache, node, snapshot)
+func (c *Callbacks) SetSnapshot(ctx context.Context, snapshotCache cache.SnapshotCache, node string, snapshot cache.Snapshot) error {
+	previous, _ := snapshotCache.GetSnapshot(node)
+
+	// the spans are pending before the cache may respond to the watches
+	started := make(map[string]propagation)
+	var superseded []Span
+	c.mu.Lock()
+	pending := c.propagations[node]
+	if pending == nil {
+		pending = make(map[string]propagation)
+		c.propagations[node] = pending
+	}
+	for typ := types.ResponseType(0); typ < types.UnknownType; typ++ {
+		typeURL := cache.GetResponseTypeURL(typ)
+		version := snapshot.Resources[typ].Version
+		if len(snapshot.Resources[typ].Items) == 0 || version == previous.GetVersion(typeURL) {
+			continue
+		}
+		if p, exists := pending[typeURL]; exists {
+			if p.version == version {
+				continue
+			}
+			superseded = append(superseded, p.span)
+		}
+		_, span := c.tracer.Start(ctx, "xds.propagation", map[string]string{
+			NodeIDAttribute:  node,
+			TypeURLAttribute: typeURL,
+			VersionAttribute: version,
+		})
+		pending[typeURL] = propagation{version: version, span: span}
+		started[typeURL] = pending[typeURL]
+	}
+	c.mu.Unlock()
+
+	for _, span := range superseded {
+		span.AddEvent("superseded", nil)
+		span.End()
+	}
+
+	err := snapshotCache.SetSnapshot(node, snapshot)
+	if err != nil {
+		c.mu.Lock()
+		for typeURL, p := range started {
+			if c.propagations[node][typeURL].span == p.span {
+				delete(c.propagations[node], typeURL)
+			}
+		}
+		c.mu.Unlock()
+		for _, p := range started {
+			p.span.SetError(err.Error())
+			p.span.End()
+		}
+	}
+	return err
+}
+
+// OnStreamOpen starts the stream span.
+func (c *Callbacks) OnStreamOpen(ctx context.Context, id int64, typeURL string) error {
+	ctx, span := c.tracer.Start(ctx, "xds.stream", map[string]string{
+		StreamIDAttribute: strconv.FormatInt(id, 10),
+		TypeURLAttribute:  typeURL,
+	})
+	c.mu.Lock()
+	c.streams[id] = &stream{ctx: ctx, span: span, responses: make(map[string]pendingResponse)}
+	c.mu.Unlock()
+	return nil
+}
+
+// OnStreamClosed ends the stream span and the pending response spans.
+func (c *Callbacks) OnStreamClosed(id int64) {
+	c.mu.Lock()
+	st, exists := c.streams[id]
+	delete(c.streams, id)
+	c.mu.Unlock()
+	if !exists {
+		return
+	}
+	for _, response := range st.responses {
+		response.span.AddEvent("abandoned", nil)
+		response.span.End()
+	}
+	st.span.End()
+}
+
+// OnStreamRequest records the request span, and ends the span of the
+// acknowledged or rejected response.
+func (c *Callbacks) OnStreamRequest(id int64, req *discovery.DiscoveryRequest) error {
+	c.mu.Lock()
+	st, exists := c.streams[id]
+	if !exists {
+		c.mu.Unlock()
+		return nil
+	}
+	node := req.GetNode().GetId()
+	if node != "" && node != st.node {
+		st.node = node
+		st.span.SetAttributes(map[string]string{NodeIDAttribute: node})
+	}
+	response, acked := st.responses[req.TypeUrl]
+	acked = acked && response.nonce == req.ResponseNonce
+	var propagated propagation
+	if acked {
+		delete(st.responses, req.TypeUrl)
+		if p, exists := c.propagations[st.node][req.TypeUrl]; exists && p.version == response.version {
+			propagated = p
+			delete(c.propagations[st.node], req.TypeUrl)
+		}
+	}
+	node = st.node
+	c.mu.Unlock()
+
+	_, span := c.tracer.Start(st.ctx, "xds.request", requestAttributes(req, node))
+	if req.ErrorDetail != nil {
+		span.SetError(req.ErrorDetail.GetMessage())
+	}
+	span.End()
+
+	if acked {
+		if req.ErrorDetail != nil {
+			response.span.AddEvent("nack", map[string]string{VersionAttribute: req.VersionInfo})
+			response.span.SetError(req.ErrorDetail.GetMessage())
+		} else {
+			response.span.AddEvent("ack", map[string]string{VersionAttribute: req.VersionInfo})
+		}
+		response.span.End()
+	}
+	if propagated.span != nil {
+		attributes := map[string]string{StreamIDAttribute: strconv.FormatInt(id, 10)}
+		if req.ErrorDetail != nil {
+			propagated.span.AddEvent("nack", attributes)
+			propagated.span.SetError(req.ErrorDetail.GetMessage())
+		} else {
+			propagated.span.AddEvent("ack", attributes)
+		}
+		propagated.span.End()
+	}
+	return nil
+}
+
+// OnStreamResponse starts the response span, awaiting the acknowledgement.
+func (c *Callbacks) OnStreamResponse(id int64, _ *discovery.DiscoveryRequest, resp *discovery.DiscoveryResponse) {
+	c.mu.Lock()
+	st, exists := c.streams[id]
+	if !exists {
+		c.mu.Unlock()
+		return
+	}
+	previous, superseded := st.responses[resp.TypeUrl]
+	_, span := c.tracer.Start(st.ctx, "xds.response", map[string]string{
+		StreamIDAttribute: strconv.FormatInt(id, 10),
+		NodeIDAttribute:   st.node,
+		TypeURLAttribute:  resp.TypeUrl,
+		VersionAttribute:  resp.VersionInfo,
+		NonceAttribute:    resp.Nonce,
+	})
+	st.responses[resp.TypeUrl] = pendingResponse{nonce: resp.Nonce, version: resp.VersionInfo, span: span}
+	p, propagating := c.propagations[st.node][resp.TypeUrl]
+	propagating = propagating && p.version == resp.VersionInfo
+	c.mu.Unlock()
+
+	if superseded {
+		previous.span.AddEvent("superseded", nil)
+		previous.span.End()
+	}
+	if propagating {
+		p.span.AddEvent("sent", map[string]string{
+			StreamIDAttribute: strconv.FormatInt(id, 10),
+			NonceAttribute:    resp.Nonce,
+		})
+	}
+}
+
+// OnFetchRequest records the fetch span.
+func (c *Callbacks) OnFetchRequest(ctx context.Context, req *discovery.DiscoveryRequest) error {
+	_, span := c.tracer.Start(ctx, "xds.fetch", requestAttributes(req, req.GetNode().GetId()))
+	span.End()
+	return nil
+}
+
+// OnFetchResponse is a no-op.
+func (c *Callbacks) OnFetchResponse(*discovery.DiscoveryRequest, *discovery.DiscoveryResponse) {}
+
+func requestAttributes(req *discovery.DiscoveryRequest, node string) map[string]string {
+	return map[string]string{
+		NodeIDAttribute:        node,
+		TypeURLAttribute:       req.TypeUrl,
+		VersionAttribute:       req.VersionInfo,
+		NonceAttribute:         req.ResponseNonce,
+		ResourceCountAttribute: strconv.Itoa(len(req.ResourceNames)),
+	}
+}
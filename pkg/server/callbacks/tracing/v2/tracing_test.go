@@ -0,0 +1,140 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package tracing_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"google.golang.org/genproto/googleapis/rpc/status"
+
+	discovery "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/resource/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/server/callbacks/tracing/v2"
+	testresource "github.com/envoyproxy/go-control-plane/pkg/test/resource/v2"
+)
+
+type span struct {
+	name       string
+	parent     *span
+	attributes map[string]string
+	events     []string
+	err        string
+	ended      bool
+}
+
+func (s *span) SetAttributes(attributes map[string]string) {
+	for key, value := range attributes {
+		s.attributes[key] = value
+	}
+}
+
+func (s *span) AddEvent(name string, _ map[string]string) { s.events = append(s.events, name) }
+func (s *span) SetError(message string)                   { s.err = message }
+func (s *span) End()                                      { s.ended = true }
+
+type spanKey struct{}
+
+type tracer struct {
+	spans []*span
+}
+
+func (t *tracer) Start(ctx context.Context, name string, attributes map[string]string) (context.Context, tracing.Span) {
+	parent, _ := ctx.Value(spanKey{}).(*span)
+	out := &span{name: name, parent: parent, attributes: attributes}
+	t.spans = append(t.spans, out)
+	return context.WithValue(ctx, spanKey{}, out), out
+}
+
+func (t *tracer) named(name string) []*span {
+	var out []*span
+	for _, s := range t.spans {
+		if s.name == name {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+func TestCallbacks(t *testing.T) {
+	tr := &tracer{}
+	c := tracing.NewCallbacks(tr)
+	node := &core.Node{Id: "proxy"}
+
+	_ = c.OnStreamOpen(context.Background(), 1, resource.AnyType)
+	_ = c.OnStreamRequest(1, &discovery.DiscoveryRequest{Node: node, TypeUrl: resource.ClusterType})
+	c.OnStreamResponse(1, nil, &discovery.DiscoveryResponse{TypeUrl: resource.ClusterType, VersionInfo: "1", Nonce: "1"})
+	c.OnStreamResponse(1, nil, &discovery.DiscoveryResponse{TypeUrl: resource.ClusterType, VersionInfo: "2", Nonce: "2"})
+	_ = c.OnStreamRequest(1, &discovery.DiscoveryRequest{TypeUrl: resource.ClusterType, VersionInfo: "1", ResponseNonce: "2",
+		ErrorDetail: &status.Status{Message: "rejected"}})
+	c.OnStreamResponse(1, nil, &discovery.DiscoveryResponse{TypeUrl: resource.ListenerType, VersionInfo: "1", Nonce: "3"})
+	c.OnStreamClosed(1)
+
+	streams := tr.named("xds.stream")
+	if len(streams) != 1 || !streams[0].ended || streams[0].attributes[tracing.NodeIDAttribute] != "proxy" {
+		t.Fatalf("stream spans => got %+v, want one ended span of the node", streams)
+	}
+	requests := tr.named("xds.request")
+	if len(requests) != 2 || requests[0].parent != streams[0] || requests[1].err != "rejected" {
+		t.Errorf("request spans => got %+v, want two children of the stream with a NACK", requests)
+	}
+
+	var events [][]string
+	for _, response := range tr.named("xds.response") {
+		if !response.ended || response.parent != streams[0] {
+			t.Errorf("response span => got %+v, want an ended child of the stream", response)
+		}
+		events = append(events, response.events)
+	}
+	want := [][]string{{"superseded"}, {"nack"}, {"abandoned"}}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("response events => got %v, want %v", events, want)
+	}
+}
+
+func TestPropagation(t *testing.T) {
+	tr := &tracer{}
+	c := tracing.NewCallbacks(tr)
+	snapshotCache := cache.NewSnapshotCache(true, cache.IDHash{}, nil)
+	ctx, update := tr.Start(context.Background(), "update", nil)
+	clusters := []types.Resource{testresource.MakeCluster(testresource.Ads, "cluster")}
+
+	if err := c.SetSnapshot(ctx, snapshotCache, "proxy", cache.NewSnapshot("1", nil, clusters, nil, nil, nil, nil)); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SetSnapshot(ctx, snapshotCache, "proxy", cache.NewSnapshot("2", nil, clusters, nil, nil, nil, nil)); err != nil {
+		t.Fatal(err)
+	}
+	_ = c.OnStreamOpen(context.Background(), 1, resource.AnyType)
+	_ = c.OnStreamRequest(1, &discovery.DiscoveryRequest{Node: &core.Node{Id: "proxy"}, TypeUrl: resource.ClusterType})
+	c.OnStreamResponse(1, nil, &discovery.DiscoveryResponse{TypeUrl: resource.ClusterType, VersionInfo: "2", Nonce: "1"})
+	_ = c.OnStreamRequest(1, &discovery.DiscoveryRequest{TypeUrl: resource.ClusterType, VersionInfo: "2", ResponseNonce: "1"})
+
+	var events [][]string
+	for _, propagation := range tr.named("xds.propagation") {
+		if !propagation.ended || propagation.parent != update || propagation.attributes[tracing.TypeURLAttribute] != resource.ClusterType {
+			t.Errorf("propagation span => got %+v, want an ended child of the update", propagation)
+		}
+		events = append(events, propagation.events)
+	}
+	want := [][]string{{"superseded"}, {"sent", "ack"}}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("propagation events => got %v, want %v", events, want)
+	}
+}
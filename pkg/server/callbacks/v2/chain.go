@@ -0,0 +1,93 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+// Package callbacks composes server callbacks.
+package callbacks
+
+import (
+	"context"
+
+	discovery "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/server/v2"
+)
+
+// Chain invokes an ordered list of callbacks, e.g. for metrics, logging and
+// authorization to share the callbacks of a server:
+//
+//	srv := server.NewServer(ctx, snapshotCache, callbacks.Chain{auth, metrics, logger})
+//
+// The callbacks returning an error short-circuit the chain: the error is
+// returned and the following callbacks are not invoked for the stream open,
+// stream request and fetch request events. The stream is then closed, so the
+// callbacks placed after the failed one should not expect a request for every
+// opened stream.
+//
+// The stream closed and response events are invoked on all the callbacks.
+// As the server invokes the stream closed event even if the stream open event
+// fails, all the callbacks receive it, including the ones not notified of the
+// stream opening.
+type Chain []server.Callbacks
+
+var _ server.Callbacks = Chain{}
+
+// OnStreamOpen invokes the callbacks until one returns an error.
+func (c Chain) OnStreamOpen(ctx context.Context, id int64, typeURL string) error {
+	for _, cb := range c {
+		if err := cb.OnStreamOpen(ctx, id, typeURL); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// OnStreamClosed invokes all the callbacks.
+func (c Chain) OnStreamClosed(id int64) {
+	for _, cb := range c {
+		cb.OnStreamClosed(id)
+	}
+}
+
+// OnStreamRequest invokes the callbacks until one returns an error.
+func (c Chain) OnStreamRequest(id int64, req *discovery.DiscoveryRequest) error {
+	for _, cb := range c {
+		if err := cb.OnStreamRequest(id, req); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// OnStreamResponse invokes all the callbacks.
+func (c Chain) OnStreamResponse(id int64, req *discovery.DiscoveryRequest, resp *discovery.DiscoveryResponse) {
+	for _, cb := range c {
+		cb.OnStreamResponse(id, req, resp)
+	}
+}
+
+// OnFetchRequest invokes the callbacks until one returns an error.
+func (c Chain) OnFetchRequest(ctx context.Context, req *discovery.DiscoveryRequest) error {
+	for _, cb := range c {
+		if err := cb.OnFetchRequest(ctx, req); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// OnFetchResponse invokes all the callbacks.
+func (c Chain) OnFetchResponse(req *discovery.DiscoveryRequest, resp *discovery.DiscoveryResponse) {
+	for _, cb := range c {
+		cb.OnFetchResponse(req, resp)
+	}
+}
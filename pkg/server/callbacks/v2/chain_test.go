@@ -0,0 +1,84 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package callbacks_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	discovery "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/server/callbacks/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/server/v2"
+)
+
+func TestChain(t *testing.T) {
+	var events []string
+	record := func(name string, fail bool) server.Callbacks {
+		var err error
+		if fail {
+			err = errors.New(name)
+		}
+		return server.CallbackFuncs{
+			StreamOpenFunc: func(context.Context, int64, string) error {
+				events = append(events, name+".open")
+				return err
+			},
+			StreamClosedFunc: func(int64) {
+				events = append(events, name+".closed")
+			},
+			StreamRequestFunc: func(int64, *discovery.DiscoveryRequest) error {
+				events = append(events, name+".request")
+				return err
+			},
+			StreamResponseFunc: func(int64, *discovery.DiscoveryRequest, *discovery.DiscoveryResponse) {
+				events = append(events, name+".response")
+			},
+			FetchRequestFunc: func(context.Context, *discovery.DiscoveryRequest) error {
+				events = append(events, name+".fetch")
+				return err
+			},
+		}
+	}
+
+	chain := callbacks.Chain{record("a", false), record("b", false)}
+	if err := chain.OnStreamOpen(context.Background(), 1, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := chain.OnStreamRequest(1, &discovery.DiscoveryRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	chain.OnStreamResponse(1, &discovery.DiscoveryRequest{}, &discovery.DiscoveryResponse{})
+	chain.OnStreamClosed(1)
+	want := []string{"a.open", "b.open", "a.request", "b.request", "a.response", "b.response", "a.closed", "b.closed"}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("events => got %v, want %v", events, want)
+	}
+
+	events = nil
+	chain = callbacks.Chain{record("auth", true), record("metrics", false)}
+	if err := chain.OnStreamOpen(context.Background(), 2, ""); err == nil || err.Error() != "auth" {
+		t.Errorf("OnStreamOpen() => got %v, want the auth error", err)
+	}
+	if err := chain.OnFetchRequest(context.Background(), &discovery.DiscoveryRequest{}); err == nil {
+		t.Error("OnFetchRequest() => got no error")
+	}
+	chain.OnStreamClosed(2)
+	want = []string{"auth.open", "auth.fetch", "auth.closed", "metrics.closed"}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("events => got %v, want %v", events, want)
+	}
+}
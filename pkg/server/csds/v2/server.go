@@ -0,0 +1,263 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+// Package csds provides an implementation of the Client Status Discovery
+// Service, to query the configuration of the connected proxies.
+package csds
+
+import (
+	"context"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/any"
+	"google.golang.org/grpc/codes"
+	grpcstatus "google.golang.org/grpc/status"
+
+	admin "github.com/envoyproxy/go-control-plane/envoy/admin/v2alpha"
+	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	status "github.com/envoyproxy/go-control-plane/envoy/service/status/v2"
+	matcher "github.com/envoyproxy/go-control-plane/envoy/type/matcher"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/resource/v2"
+)
+
+// Server answers the client status requests from a snapshot cache. The
+// configuration of a node is the last version of each type acknowledged by
+// the node, and its status compares it with the snapshot of the node:
+//
+//   - SYNCED if the node acknowledged the snapshot version,
+//   - ERROR if the node rejected the snapshot version,
+//   - STALE if the node acknowledged an earlier version,
+//   - NOT_SENT otherwise.
+//
+// The listeners, clusters, routes and scoped routes are reported, restricted
+// to the resource names subscribed by the node. The nodes are matched by
+// ID only, and the node metadata matchers are not supported.
+type Server interface {
+	status.ClientStatusDiscoveryServiceServer
+}
+
+// NewServer creates a client status server from a snapshot cache.
+func NewServer(config cache.SnapshotCache) Server {
+	return &server{cache: config}
+}
+
+type server struct {
+	cache cache.SnapshotCache
+}
+
+func (s *server) StreamClientStatus(stream status.ClientStatusDiscoveryService_StreamClientStatusServer) error {
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		resp, err := s.clientStatus(req)
+		if err != nil {
+			return err
+		}
+		if err := stream.Send(resp); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *server) FetchClientStatus(_ context.Context, req *status.ClientStatusRequest) (*status.ClientStatusResponse, error) {
+	return s.clientStatus(req)
+}
+
+func (s *server) clientStatus(req *status.ClientStatusRequest) (*status.ClientStatusResponse, error) {
+	matchers := make([]func(string) bool, 0, len(req.NodeMatchers))
+	for _, nodeMatcher := range req.NodeMatchers {
+		if len(nodeMatcher.NodeMetadatas) > 0 {
+			return nil, grpcstatus.Error(codes.Unimplemented, "node metadata matchers are not supported")
+		}
+		match, err := stringMatcher(nodeMatcher.NodeId)
+		if err != nil {
+			return nil, grpcstatus.Errorf(codes.InvalidArgument, "node ID matcher: %v", err)
+		}
+		matchers = append(matchers, match)
+	}
+
+	view := s.cache.View()
+	out := &status.ClientStatusResponse{}
+	for _, key := range view.GetStatusKeys() {
+		info := view.GetStatusInfo(key)
+		if info == nil {
+			continue
+		}
+		node := info.GetNode()
+		if !matchNode(matchers, node) {
+			continue
+		}
+		snapshot, _ := view.GetSnapshot(key)
+		out.Config = append(out.Config, clientConfig(node, snapshot, info))
+	}
+	return out, nil
+}
+
+// matchNode matches the node ID with any matcher, or all the nodes without
+// matchers.
+func matchNode(matchers []func(string) bool, node *core.Node) bool {
+	if len(matchers) == 0 {
+		return true
+	}
+	for _, match := range matchers {
+		if match(node.GetId()) {
+			return true
+		}
+	}
+	return false
+}
+
+func stringMatcher(m *matcher.StringMatcher) (func(string) bool, error) {
+	if m == nil {
+		return func(string) bool { return true }, nil
+	}
+	fold := func(value string) string {
+		if m.IgnoreCase {
+			return strings.ToLower(value)
+		}
+		return value
+	}
+	switch pattern := m.MatchPattern.(type) {
+	case *matcher.StringMatcher_Exact:
+		return func(value string) bool { return fold(value) == fold(pattern.Exact) }, nil
+	case *matcher.StringMatcher_Prefix:
+		return func(value string) bool { return strings.HasPrefix(fold(value), fold(pattern.Prefix)) }, nil
+	case *matcher.StringMatcher_Suffix:
+		return func(value string) bool { return strings.HasSuffix(fold(value), fold(pattern.Suffix)) }, nil
+	case *matcher.StringMatcher_SafeRegex:
+		re, err := regexp.Compile("^(?:" + pattern.SafeRegex.GetRegex() + ")$")
+		if err != nil {
+			return nil, err
+		}
+		return re.MatchString, nil
+	}
+	return nil, grpcstatus.Errorf(codes.Unimplemented, "unsupported string matcher %T", m.MatchPattern)
+}
+
+func clientConfig(node *core.Node, snapshot cache.Snapshot, info cache.StatusInfo) *status.ClientConfig {
+	ackStatus := info.GetAckStatus()
+	out := &status.ClientConfig{Node: node}
+	for _, typeURL := range []string{resource.ListenerType, resource.ClusterType, resource.RouteType, resource.ScopedRouteType} {
+		config := &status.PerXdsConfig{Status: configStatus(snapshot.GetVersion(typeURL), ackStatus[typeURL])}
+		acked, _ := info.GetAckedSnapshot(typeURL)
+		version := acked.GetVersion(typeURL)
+		updated, _ := ptypes.TimestampProto(ackStatus[typeURL].AckTime)
+		resources := marshalResources(acked, typeURL, ackStatus[typeURL].ResourceNames)
+
+		switch typeURL {
+		case resource.ListenerType:
+			dump := &admin.ListenersConfigDump{VersionInfo: version}
+			for _, res := range resources {
+				dump.DynamicListeners = append(dump.DynamicListeners, &admin.ListenersConfigDump_DynamicListener{
+					Name: res.name,
+					ActiveState: &admin.ListenersConfigDump_DynamicListenerState{
+						VersionInfo: version,
+						Listener:    res.any,
+						LastUpdated: updated,
+					},
+				})
+			}
+			config.PerXdsConfig = &status.PerXdsConfig_ListenerConfig{ListenerConfig: dump}
+		case resource.ClusterType:
+			dump := &admin.ClustersConfigDump{VersionInfo: version}
+			for _, res := range resources {
+				dump.DynamicActiveClusters = append(dump.DynamicActiveClusters, &admin.ClustersConfigDump_DynamicCluster{
+					VersionInfo: version,
+					Cluster:     res.any,
+					LastUpdated: updated,
+				})
+			}
+			config.PerXdsConfig = &status.PerXdsConfig_ClusterConfig{ClusterConfig: dump}
+		case resource.RouteType:
+			dump := &admin.RoutesConfigDump{}
+			for _, res := range resources {
+				dump.DynamicRouteConfigs = append(dump.DynamicRouteConfigs, &admin.RoutesConfigDump_DynamicRouteConfig{
+					VersionInfo: version,
+					RouteConfig: res.any,
+					LastUpdated: updated,
+				})
+			}
+			config.PerXdsConfig = &status.PerXdsConfig_RouteConfig{RouteConfig: dump}
+		case resource.ScopedRouteType:
+			// the scopes are reported as a single set, since the name of the
+			// set is only known to the listeners
+			dump := &admin.ScopedRoutesConfigDump{}
+			if len(resources) > 0 {
+				scopes := &admin.ScopedRoutesConfigDump_DynamicScopedRouteConfigs{
+					VersionInfo: version,
+					LastUpdated: updated,
+				}
+				for _, res := range resources {
+					scopes.ScopedRouteConfigs = append(scopes.ScopedRouteConfigs, res.any)
+				}
+				dump.DynamicScopedRouteConfigs = append(dump.DynamicScopedRouteConfigs, scopes)
+			}
+			config.PerXdsConfig = &status.PerXdsConfig_ScopedRouteConfig{ScopedRouteConfig: dump}
+		}
+		out.XdsConfig = append(out.XdsConfig, config)
+	}
+	return out
+}
+
+// configStatus compares the acknowledgement status with the snapshot version.
+func configStatus(version string, ackStatus cache.AckStatus) status.ConfigStatus {
+	switch {
+	case version != "" && ackStatus.Converged(version):
+		return status.ConfigStatus_SYNCED
+	case version != "" && ackStatus.NackedVersion == version && ackStatus.NackTime.After(ackStatus.AckTime):
+		return status.ConfigStatus_ERROR
+	case ackStatus.AckedVersion != "":
+		return status.ConfigStatus_STALE
+	}
+	return status.ConfigStatus_NOT_SENT
+}
+
+type namedResource struct {
+	name string
+	any  *any.Any
+}
+
+// marshalResources returns the subscribed resources of a type sorted by name,
+// or all of them for a wildcard subscription. The resources failing to marshal
+// are skipped.
+func marshalResources(snapshot cache.Snapshot, typeURL string, names []string) []namedResource {
+	items := snapshot.GetResources(typeURL)
+	subscribed := make(map[string]bool, len(names))
+	for _, name := range names {
+		subscribed[name] = true
+	}
+	out := make([]namedResource, 0, len(items))
+	for name, item := range items {
+		if len(names) > 0 && !subscribed[name] {
+			continue
+		}
+		value, err := ptypes.MarshalAny(item)
+		if err != nil {
+			continue
+		}
+		out = append(out, namedResource{name: name, any: value})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].name < out[j].name })
+	return out
+}
@@ -0,0 +1,116 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package csds_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang/protobuf/ptypes"
+	rpc "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/codes"
+	grpcstatus "google.golang.org/grpc/status"
+
+	route "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	status "github.com/envoyproxy/go-control-plane/envoy/service/status/v2"
+	matcher "github.com/envoyproxy/go-control-plane/envoy/type/matcher"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/v2"
+	rsrc "github.com/envoyproxy/go-control-plane/pkg/resource/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/server/csds/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/test/resource/v2"
+)
+
+func nodeIDMatcher(pattern *matcher.StringMatcher) *status.ClientStatusRequest {
+	return &status.ClientStatusRequest{NodeMatchers: []*matcher.NodeMatcher{{NodeId: pattern}}}
+}
+
+func TestFetchClientStatus(t *testing.T) {
+	c := cache.NewSnapshotCache(false, cache.IDHash{}, nil)
+	node := &core.Node{Id: "a"}
+	c.CreateWatch(&cache.Request{Node: node, TypeUrl: rsrc.ClusterType})
+	c.CreateWatch(&cache.Request{Node: node, TypeUrl: rsrc.RouteType})
+	c.CreateWatch(&cache.Request{Node: node, TypeUrl: rsrc.ScopedRouteType})
+	snapshot := cache.NewSnapshot("x", nil,
+		[]types.Resource{resource.MakeCluster(resource.Ads, "cluster0")},
+		[]types.Resource{resource.MakeRoute("route0", "cluster0")}, nil, nil, nil)
+	snapshot = snapshot.WithScopedRoutes("x", []types.Resource{
+		&route.ScopedRouteConfiguration{Name: "scope0", RouteConfigurationName: "route0"},
+		&route.ScopedRouteConfiguration{Name: "scope1", RouteConfigurationName: "route0"},
+	})
+	if err := c.SetSnapshot("a", snapshot); err != nil {
+		t.Fatal(err)
+	}
+	c.CreateWatch(&cache.Request{Node: node, TypeUrl: rsrc.ClusterType, VersionInfo: "x", ResponseNonce: "1"})
+	c.CreateWatch(&cache.Request{Node: node, TypeUrl: rsrc.RouteType, ResponseNonce: "2",
+		ErrorDetail: &rpc.Status{Code: int32(codes.InvalidArgument), Message: "rejected"}})
+	c.CreateWatch(&cache.Request{Node: node, TypeUrl: rsrc.ScopedRouteType, VersionInfo: "x", ResponseNonce: "3",
+		ResourceNames: []string{"scope1"}})
+	c.CreateWatch(&cache.Request{Node: &core.Node{Id: "b"}, TypeUrl: rsrc.ClusterType})
+
+	s := csds.NewServer(c)
+	resp, err := s.FetchClientStatus(context.Background(), nodeIDMatcher(&matcher.StringMatcher{
+		MatchPattern: &matcher.StringMatcher_Exact{Exact: "A"},
+		IgnoreCase:   true,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Config) != 1 || resp.Config[0].Node.Id != "a" {
+		t.Fatalf("configs => got %v, want node a", resp.Config)
+	}
+	want := []status.ConfigStatus{status.ConfigStatus_NOT_SENT, status.ConfigStatus_SYNCED, status.ConfigStatus_ERROR, status.ConfigStatus_SYNCED}
+	if len(resp.Config[0].XdsConfig) != len(want) {
+		t.Fatalf("xDS configs => got %d, want %d", len(resp.Config[0].XdsConfig), len(want))
+	}
+	for i, config := range resp.Config[0].XdsConfig {
+		if config.Status != want[i] {
+			t.Errorf("status %d => got %v, want %v", i, config.Status, want[i])
+		}
+	}
+	clusters := resp.Config[0].XdsConfig[1].GetClusterConfig()
+	if clusters.VersionInfo != "x" || len(clusters.DynamicActiveClusters) != 1 {
+		t.Errorf("cluster config => got %v, want version x with a cluster", clusters)
+	}
+	if routes := resp.Config[0].XdsConfig[2].GetRouteConfig(); len(routes.DynamicRouteConfigs) != 0 {
+		t.Errorf("route config => got %v, want none acknowledged", routes)
+	}
+	scopes := resp.Config[0].XdsConfig[3].GetScopedRouteConfig().GetDynamicScopedRouteConfigs()
+	if len(scopes) != 1 || scopes[0].VersionInfo != "x" || len(scopes[0].ScopedRouteConfigs) != 1 {
+		t.Fatalf("scoped route config => got %v, want version x with the subscribed scope", scopes)
+	}
+	scope := &route.ScopedRouteConfiguration{}
+	if err := ptypes.UnmarshalAny(scopes[0].ScopedRouteConfigs[0], scope); err != nil || scope.Name != "scope1" {
+		t.Errorf("scoped route => got %v, %v, want scope1", scope, err)
+	}
+
+	resp, err = s.FetchClientStatus(context.Background(), &status.ClientStatusRequest{})
+	if err != nil || len(resp.Config) != 2 {
+		t.Errorf("all configs => got %v, %v, want 2", resp, err)
+	}
+	resp, err = s.FetchClientStatus(context.Background(), nodeIDMatcher(&matcher.StringMatcher{
+		MatchPattern: &matcher.StringMatcher_Prefix{Prefix: "c"},
+	}))
+	if err != nil || len(resp.Config) != 0 {
+		t.Errorf("unmatched configs => got %v, %v, want none", resp, err)
+	}
+	_, err = s.FetchClientStatus(context.Background(), &status.ClientStatusRequest{
+		NodeMatchers: []*matcher.NodeMatcher{{NodeMetadatas: []*matcher.StructMatcher{{}}}},
+	})
+	if grpcstatus.Code(err) != codes.Unimplemented {
+		t.Errorf("metadata matcher => got error %v, want unimplemented", err)
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+// Package extauthz provides a skeleton of the external authorization service,
+// to co-host the authorization logic with the control plane:
+//
+//	auth.RegisterAuthorizationServer(grpcServer, extauthz.NewServer(check))
+package extauthz
+
+import (
+	"context"
+
+	"github.com/golang/protobuf/ptypes/wrappers"
+	rpc "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	auth "github.com/envoyproxy/go-control-plane/envoy/service/auth/v2"
+	envoy_type "github.com/envoyproxy/go-control-plane/envoy/type"
+)
+
+// CheckFunc authorizes a request. Returning an error fails the check, and the
+// proxy applies its failure mode, e.g. allows the request with
+// failure_mode_allow.
+type CheckFunc func(context.Context, *auth.CheckRequest) (*auth.CheckResponse, error)
+
+// NewServer creates an authorization server from a check function.
+func NewServer(check CheckFunc) auth.AuthorizationServer {
+	return &server{check: check}
+}
+
+type server struct {
+	check CheckFunc
+}
+
+func (s *server) Check(ctx context.Context, req *auth.CheckRequest) (*auth.CheckResponse, error) {
+	resp, err := s.check(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if resp == nil {
+		return nil, status.Error(codes.Internal, "missing check response")
+	}
+	return resp, nil
+}
+
+// OkResponse allows the request, and adds or overrides the headers of the
+// request sent upstream.
+func OkResponse(headers ...*core.HeaderValueOption) *auth.CheckResponse {
+	return &auth.CheckResponse{
+		Status: &rpc.Status{Code: int32(codes.OK)},
+		HttpResponse: &auth.CheckResponse_OkResponse{
+			OkResponse: &auth.OkHttpResponse{Headers: headers},
+		},
+	}
+}
+
+// DeniedResponse denies the request, and sends a response with the HTTP
+// status, the body and the headers to the downstream client instead.
+func DeniedResponse(code envoy_type.StatusCode, body string, headers ...*core.HeaderValueOption) *auth.CheckResponse {
+	return &auth.CheckResponse{
+		Status: &rpc.Status{Code: int32(codes.PermissionDenied)},
+		HttpResponse: &auth.CheckResponse_DeniedResponse{
+			DeniedResponse: &auth.DeniedHttpResponse{
+				Status:  &envoy_type.HttpStatus{Code: code},
+				Headers: headers,
+				Body:    body,
+			},
+		},
+	}
+}
+
+// Header sets a header, replacing the existing values.
+func Header(key, value string) *core.HeaderValueOption {
+	return &core.HeaderValueOption{
+		Header: &core.HeaderValue{Key: key, Value: value},
+		Append: &wrappers.BoolValue{Value: false},
+	}
+}
+
+// AppendHeader appends a value to a header.
+func AppendHeader(key, value string) *core.HeaderValueOption {
+	return &core.HeaderValueOption{
+		Header: &core.HeaderValue{Key: key, Value: value},
+		Append: &wrappers.BoolValue{Value: true},
+	}
+}
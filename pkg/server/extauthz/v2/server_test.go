@@ -0,0 +1,80 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package extauthz_test
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	auth "github.com/envoyproxy/go-control-plane/envoy/service/auth/v2"
+	envoy_type "github.com/envoyproxy/go-control-plane/envoy/type"
+	"github.com/envoyproxy/go-control-plane/pkg/server/extauthz/v2"
+)
+
+func checkRequest(path string) *auth.CheckRequest {
+	return &auth.CheckRequest{Attributes: &auth.AttributeContext{
+		Request: &auth.AttributeContext_Request{
+			Http: &auth.AttributeContext_HttpRequest{Path: path},
+		},
+	}}
+}
+
+func TestCheck(t *testing.T) {
+	s := extauthz.NewServer(func(_ context.Context, req *auth.CheckRequest) (*auth.CheckResponse, error) {
+		switch req.GetAttributes().GetRequest().GetHttp().GetPath() {
+		case "/public":
+			return extauthz.OkResponse(extauthz.Header("x-user", "anonymous"), extauthz.AppendHeader("x-tag", "public")), nil
+		case "/private":
+			return extauthz.DeniedResponse(envoy_type.StatusCode_Unauthorized, "login required", extauthz.Header("www-authenticate", "Bearer")), nil
+		case "/missing":
+			return nil, nil
+		}
+		return nil, status.Error(codes.Unavailable, "policy unavailable")
+	})
+
+	resp, err := s.Check(context.Background(), checkRequest("/public"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code := codes.Code(resp.Status.Code); code != codes.OK {
+		t.Errorf("allowed status => got %v, want %v", code, codes.OK)
+	}
+	headers := resp.GetOkResponse().GetHeaders()
+	if len(headers) != 2 || headers[0].Header.Key != "x-user" || headers[0].Append.Value || !headers[1].Append.Value {
+		t.Errorf("allowed headers => got %v, want x-user set and x-tag appended", headers)
+	}
+
+	resp, err = s.Check(context.Background(), checkRequest("/private"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code := codes.Code(resp.Status.Code); code != codes.PermissionDenied {
+		t.Errorf("denied status => got %v, want %v", code, codes.PermissionDenied)
+	}
+	denied := resp.GetDeniedResponse()
+	if denied.GetStatus().GetCode() != envoy_type.StatusCode_Unauthorized || denied.GetBody() != "login required" || len(denied.GetHeaders()) != 1 {
+		t.Errorf("denied response => got %v, want 401 with a body and a header", denied)
+	}
+
+	if _, err := s.Check(context.Background(), checkRequest("/missing")); status.Code(err) != codes.Internal {
+		t.Errorf("missing response => got %v, want internal error", err)
+	}
+	if _, err := s.Check(context.Background(), checkRequest("/other")); status.Code(err) != codes.Unavailable {
+		t.Errorf("check error => got %v, want unavailable", err)
+	}
+}
@@ -0,0 +1,219 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+// Package grpcweb serves gRPC services to browsers with the gRPC-Web protocol,
+// without a separate translating proxy.
+//
+// The requests are translated to the gRPC over HTTP/2 protocol and served by
+// the gRPC server handler, and the trailers are sent in the response body:
+//
+//	web := &grpcweb.Handler{Server: grpcServer, AllowedOrigins: []string{"https://dashboard"}}
+//	http.ListenAndServe(":8080", web)
+//
+// Both the binary (application/grpc-web) and the base64 text
+// (application/grpc-web-text) encodings are supported. The client streaming
+// and bidirectional streaming methods are not supported by the browsers.
+package grpcweb
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+
+	"google.golang.org/grpc"
+)
+
+const (
+	contentTypeWeb  = "application/grpc-web"
+	contentTypeText = "application/grpc-web-text"
+
+	// trailerFlag marks the frame holding the trailers.
+	trailerFlag = 0x80
+)
+
+// IsGRPCWebRequest reports whether the request uses the gRPC-Web protocol.
+func IsGRPCWebRequest(req *http.Request) bool {
+	return req.Method == http.MethodPost && strings.HasPrefix(req.Header.Get("Content-Type"), contentTypeWeb)
+}
+
+// Handler serves the gRPC-Web requests with a gRPC server.
+type Handler struct {
+	// Server serves the translated requests.
+	Server *grpc.Server
+
+	// AllowedOrigins are the origins allowed to make cross-origin requests, or
+	// "*" for any origin. The cross-origin requests are denied by default.
+	AllowedOrigins []string
+}
+
+// ServeHTTP translates and serves a gRPC-Web request, or a CORS preflight
+// request.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	origin := req.Header.Get("Origin")
+	if origin != "" && h.allowed(origin) {
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Set("Access-Control-Expose-Headers", "grpc-status, grpc-message, grpc-status-details-bin")
+		w.Header().Add("Vary", "Origin")
+	}
+
+	if req.Method == http.MethodOptions && req.Header.Get("Access-Control-Request-Method") != "" {
+		if origin == "" || !h.allowed(origin) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Header().Set("Access-Control-Allow-Methods", http.MethodPost)
+		w.Header().Set("Access-Control-Allow-Headers", req.Header.Get("Access-Control-Request-Headers"))
+		w.Header().Set("Access-Control-Max-Age", "600")
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if !IsGRPCWebRequest(req) {
+		http.Error(w, "not a gRPC-Web request", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	// the content subtype, e.g. "+proto", is retained
+	contentType := contentTypeWeb
+	text := strings.HasPrefix(req.Header.Get("Content-Type"), contentTypeText)
+	if text {
+		contentType = contentTypeText
+	}
+	subtype := strings.TrimPrefix(req.Header.Get("Content-Type"), contentType)
+	if i := strings.Index(subtype, ";"); i >= 0 {
+		subtype = subtype[:i]
+	}
+
+	// the gRPC server handler only accepts HTTP/2 requests
+	grpcReq := req.WithContext(req.Context())
+	grpcReq.ProtoMajor, grpcReq.ProtoMinor, grpcReq.Proto = 2, 0, "HTTP/2"
+	grpcReq.Header = req.Header.Clone()
+	grpcReq.Header.Set("Content-Type", "application/grpc"+subtype)
+	grpcReq.Header.Set("Te", "trailers")
+	grpcReq.Header.Del("Content-Length")
+	grpcReq.ContentLength = -1
+	if text {
+		grpcReq.Body = ioutil.NopCloser(base64.NewDecoder(base64.StdEncoding, req.Body))
+	}
+
+	out := &responseWriter{
+		w:           w,
+		header:      make(http.Header),
+		text:        text,
+		contentType: contentType + subtype,
+	}
+	h.Server.ServeHTTP(out, grpcReq)
+	out.finish()
+}
+
+func (h *Handler) allowed(origin string) bool {
+	for _, allowed := range h.AllowedOrigins {
+		if allowed == "*" || allowed == origin {
+			return true
+		}
+	}
+	return false
+}
+
+// responseWriter moves the trailers of a gRPC response into the body.
+type responseWriter struct {
+	w           http.ResponseWriter
+	header      http.Header
+	text        bool
+	contentType string
+	code        int
+}
+
+func (r *responseWriter) Header() http.Header {
+	return r.header
+}
+
+func (r *responseWriter) WriteHeader(code int) {
+	if r.code != 0 {
+		return
+	}
+	r.code = code
+	for key, values := range r.header {
+		if key == "Trailer" || key == "Content-Type" || strings.HasPrefix(key, http.TrailerPrefix) {
+			continue
+		}
+		r.w.Header()[key] = values
+	}
+	r.w.Header().Set("Content-Type", r.contentType)
+	r.w.WriteHeader(code)
+}
+
+func (r *responseWriter) Write(b []byte) (int, error) {
+	r.WriteHeader(http.StatusOK)
+	if r.text {
+		// each write is padded, as allowed for the text encoding
+		if _, err := io.WriteString(r.w, base64.StdEncoding.EncodeToString(b)); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+	return r.w.Write(b)
+}
+
+func (r *responseWriter) Flush() {
+	r.WriteHeader(http.StatusOK)
+	if flusher, ok := r.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// finish writes the declared and the undeclared trailers in a trailer frame,
+// unless the request was rejected before reaching the gRPC server.
+func (r *responseWriter) finish() {
+	r.WriteHeader(http.StatusOK)
+	if r.code != http.StatusOK {
+		return
+	}
+
+	trailers := make(map[string][]string)
+	for _, declared := range r.header["Trailer"] {
+		for _, key := range strings.Split(declared, ",") {
+			key = http.CanonicalHeaderKey(strings.TrimSpace(key))
+			if values := r.header[key]; len(values) > 0 {
+				trailers[key] = values
+			}
+		}
+	}
+	for key, values := range r.header {
+		if strings.HasPrefix(key, http.TrailerPrefix) {
+			trailers[strings.TrimPrefix(key, http.TrailerPrefix)] = values
+		}
+	}
+	keys := make([]string, 0, len(trailers))
+	for key := range trailers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var block bytes.Buffer
+	for _, key := range keys {
+		for _, value := range trailers[key] {
+			block.WriteString(strings.ToLower(key) + ": " + value + "\r\n")
+		}
+	}
+	frame := make([]byte, 5, 5+block.Len())
+	frame[0] = trailerFlag
+	binary.BigEndian.PutUint32(frame[1:], uint32(block.Len()))
+	r.Write(append(frame, block.Bytes()...))
+	r.Flush()
+}
@@ -0,0 +1,162 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package grpcweb_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	"github.com/envoyproxy/go-control-plane/pkg/server/grpcweb"
+)
+
+func frame(flag byte, payload []byte) []byte {
+	out := make([]byte, 5, 5+len(payload))
+	out[0] = flag
+	binary.BigEndian.PutUint32(out[1:], uint32(len(payload)))
+	return append(out, payload...)
+}
+
+// frames splits the response body into the data and the trailer frames.
+func frames(t *testing.T, body []byte) (data [][]byte, trailers string) {
+	for len(body) > 0 {
+		if len(body) < 5 {
+			t.Fatalf("truncated frame %q", body)
+		}
+		size := binary.BigEndian.Uint32(body[1:5])
+		payload := body[5 : 5+size]
+		if body[0]&0x80 != 0 {
+			trailers += string(payload)
+		} else {
+			data = append(data, payload)
+		}
+		body = body[5+size:]
+	}
+	return data, trailers
+}
+
+func TestHandler(t *testing.T) {
+	grpcServer := grpc.NewServer()
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus("xds", healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(grpcServer, healthServer)
+	srv := httptest.NewServer(&grpcweb.Handler{Server: grpcServer, AllowedOrigins: []string{"https://dashboard"}})
+	defer srv.Close()
+
+	request, err := proto.Marshal(&healthpb.HealthCheckRequest{Service: "xds"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	call := func(contentType string, body []byte) (*http.Response, []byte) {
+		req, err := http.NewRequest(http.MethodPost, srv.URL+"/grpc.health.v1.Health/Check", bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set("Origin", "https://dashboard")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		out, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp, out
+	}
+
+	resp, body := call("application/grpc-web+proto", frame(0, request))
+	if got := resp.Header.Get("Content-Type"); got != "application/grpc-web+proto" {
+		t.Errorf("content type => got %q", got)
+	}
+	if got := resp.Header.Get("Access-Control-Allow-Origin"); got != "https://dashboard" {
+		t.Errorf("allowed origin => got %q", got)
+	}
+	data, trailers := frames(t, body)
+	if len(data) != 1 || !strings.Contains(trailers, "grpc-status: 0\r\n") {
+		t.Fatalf("response => got %d messages, trailers %q", len(data), trailers)
+	}
+	out := &healthpb.HealthCheckResponse{}
+	if err := proto.Unmarshal(data[0], out); err != nil || out.Status != healthpb.HealthCheckResponse_SERVING {
+		t.Errorf("response => got %v, %v", out, err)
+	}
+
+	resp, body = call("application/grpc-web-text", []byte(base64.StdEncoding.EncodeToString(frame(0, request))))
+	if got := resp.Header.Get("Content-Type"); got != "application/grpc-web-text" {
+		t.Errorf("text content type => got %q", got)
+	}
+	// the padded chunks are decoded by quantum
+	var decoded []byte
+	for i := 0; i+4 <= len(body); i += 4 {
+		part, err := base64.StdEncoding.DecodeString(string(body[i : i+4]))
+		if err != nil {
+			t.Fatalf("text response %q => %v", body, err)
+		}
+		decoded = append(decoded, part...)
+	}
+	if data, trailers := frames(t, decoded); len(data) != 1 || !strings.Contains(trailers, "grpc-status: 0\r\n") {
+		t.Errorf("text response => got %d messages, trailers %q", len(data), trailers)
+	}
+
+	// the errors are reported in the trailers
+	_, body = call("application/grpc-web+proto", frame(0, mustMarshal(t, &healthpb.HealthCheckRequest{Service: "unknown"})))
+	if _, trailers := frames(t, body); !strings.Contains(trailers, "grpc-status: 5\r\n") {
+		t.Errorf("unknown service => got trailers %q, want NotFound", trailers)
+	}
+}
+
+func mustMarshal(t *testing.T, msg proto.Message) []byte {
+	out, err := proto.Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestPreflight(t *testing.T) {
+	h := &grpcweb.Handler{Server: grpc.NewServer(), AllowedOrigins: []string{"https://dashboard"}}
+	for origin, want := range map[string]int{
+		"https://dashboard": http.StatusNoContent,
+		"https://other":     http.StatusForbidden,
+	} {
+		req := httptest.NewRequest(http.MethodOptions, "/grpc.health.v1.Health/Check", nil)
+		req.Header.Set("Origin", origin)
+		req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+		req.Header.Set("Access-Control-Request-Headers", "content-type,x-grpc-web")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != want {
+			t.Errorf("preflight from %s => got %d, want %d", origin, rec.Code, want)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("plain request => got %d, want %d", rec.Code, http.StatusUnsupportedMediaType)
+	}
+}
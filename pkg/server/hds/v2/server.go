@@ -0,0 +1,202 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+// Package hds provides an implementation of the Health Discovery Service, to
+// delegate the active health checking of endpoints to the proxies.
+package hds
+
+import (
+	"context"
+	"io"
+	"sync"
+	"sync/atomic"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	hds "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v2"
+)
+
+// Provider assigns the health checks to the proxies.
+type Provider interface {
+	// HealthChecks returns the clusters and endpoints that a node should
+	// health check, or nil to assign none yet.
+	HealthChecks(node *core.Node, capability *hds.Capability) (*hds.HealthCheckSpecifier, error)
+}
+
+// Callbacks observe the health checking streams.
+type Callbacks interface {
+	// OnStreamOpen is called once a stream is open with a stream ID.
+	// Returning an error will end processing and close the stream. OnStreamClosed will still be called.
+	OnStreamOpen(context.Context, int64) error
+	// OnStreamClosed is called immediately prior to closing a stream with a stream ID.
+	OnStreamClosed(int64)
+	// OnHealthCheckRequest is called once a node declares its capabilities on a stream.
+	// Returning an error will end processing and close the stream. OnStreamClosed will still be called.
+	OnHealthCheckRequest(int64, *hds.HealthCheckRequest) error
+	// OnEndpointHealthResponse is called once a node reports the health of the endpoints.
+	OnEndpointHealthResponse(int64, *core.Node, *hds.EndpointHealthResponse)
+}
+
+// Server is a health discovery server.
+type Server interface {
+	hds.HealthDiscoveryServiceServer
+
+	// Refresh sends the current health checks to the open streams of a node
+	// ID, or of all the nodes if empty, e.g. once the assignments change.
+	Refresh(node string)
+}
+
+// NewServer creates a health discovery server from a provider and optional
+// callbacks.
+func NewServer(ctx context.Context, provider Provider, callbacks Callbacks) Server {
+	return &server{ctx: ctx, provider: provider, callbacks: callbacks, streams: make(map[int64]*streamInfo)}
+}
+
+type server struct {
+	ctx       context.Context
+	provider  Provider
+	callbacks Callbacks
+
+	// streamCount for counting bi-di streams
+	streamCount int64
+
+	mu      sync.Mutex
+	streams map[int64]*streamInfo
+}
+
+// streamInfo tracks an open stream for the refreshes.
+type streamInfo struct {
+	node    string
+	refresh chan struct{}
+}
+
+func (s *server) StreamHealthCheck(stream hds.HealthDiscoveryService_StreamHealthCheckServer) error {
+	id := atomic.AddInt64(&s.streamCount, 1)
+	if s.callbacks != nil {
+		if err := s.callbacks.OnStreamOpen(stream.Context(), id); err != nil {
+			return err
+		}
+		defer s.callbacks.OnStreamClosed(id)
+	}
+	defer func() {
+		s.mu.Lock()
+		delete(s.streams, id)
+		s.mu.Unlock()
+	}()
+
+	requests := make(chan *hds.HealthCheckRequestOrEndpointHealthResponse)
+	errs := make(chan error, 1)
+	go func() {
+		for {
+			req, err := stream.Recv()
+			if err != nil {
+				errs <- err
+				return
+			}
+			select {
+			case requests <- req:
+			case <-stream.Context().Done():
+				return
+			}
+		}
+	}()
+
+	refresh := make(chan struct{}, 1)
+	var request *hds.HealthCheckRequest
+	send := func() error {
+		specifier, err := s.provider.HealthChecks(request.Node, request.Capability)
+		if err != nil {
+			return status.Errorf(codes.Unavailable, "health checks of node %q: %v", request.Node.Id, err)
+		}
+		if specifier == nil {
+			return nil
+		}
+		return stream.Send(specifier)
+	}
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			return nil
+		case <-stream.Context().Done():
+			return nil
+		case err := <-errs:
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		case <-refresh:
+			if err := send(); err != nil {
+				return err
+			}
+		case req := <-requests:
+			if hc := req.GetHealthCheckRequest(); hc != nil {
+				if hc.Node == nil {
+					return status.Error(codes.InvalidArgument, "node is required in the health check request")
+				}
+				if s.callbacks != nil {
+					if err := s.callbacks.OnHealthCheckRequest(id, hc); err != nil {
+						return err
+					}
+				}
+				request = hc
+				s.mu.Lock()
+				s.streams[id] = &streamInfo{node: hc.Node.Id, refresh: refresh}
+				s.mu.Unlock()
+				if err := send(); err != nil {
+					return err
+				}
+			} else if health := req.GetEndpointHealthResponse(); health != nil {
+				if request == nil {
+					return status.Error(codes.FailedPrecondition, "health check request is required before the endpoint health")
+				}
+				if s.callbacks != nil {
+					s.callbacks.OnEndpointHealthResponse(id, request.Node, health)
+				}
+			}
+		}
+	}
+}
+
+func (s *server) FetchHealthCheck(_ context.Context, req *hds.HealthCheckRequestOrEndpointHealthResponse) (*hds.HealthCheckSpecifier, error) {
+	hc := req.GetHealthCheckRequest()
+	if hc == nil || hc.Node == nil {
+		return nil, status.Error(codes.InvalidArgument, "health check request with a node is required")
+	}
+	specifier, err := s.provider.HealthChecks(hc.Node, hc.Capability)
+	if err != nil {
+		return nil, status.Errorf(codes.Unavailable, "health checks of node %q: %v", hc.Node.Id, err)
+	}
+	if specifier == nil {
+		specifier = &hds.HealthCheckSpecifier{}
+	}
+	return specifier, nil
+}
+
+func (s *server) Refresh(node string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, info := range s.streams {
+		if node != "" && info.node != node {
+			continue
+		}
+		// a pending refresh already sends the latest health checks
+		select {
+		case info.refresh <- struct{}{}:
+		default:
+		}
+	}
+}
@@ -0,0 +1,209 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package hds_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	hds "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v2"
+	server "github.com/envoyproxy/go-control-plane/pkg/server/hds/v2"
+)
+
+type mockStream struct {
+	ctx  context.Context
+	recv chan *hds.HealthCheckRequestOrEndpointHealthResponse
+	sent chan *hds.HealthCheckSpecifier
+	grpc.ServerStream
+}
+
+func (stream *mockStream) Context() context.Context {
+	return stream.ctx
+}
+
+func (stream *mockStream) Send(resp *hds.HealthCheckSpecifier) error {
+	stream.sent <- resp
+	return nil
+}
+
+func (stream *mockStream) Recv() (*hds.HealthCheckRequestOrEndpointHealthResponse, error) {
+	req, more := <-stream.recv
+	if !more {
+		return nil, status.Error(codes.Canceled, "empty")
+	}
+	return req, nil
+}
+
+func makeMockStream() *mockStream {
+	return &mockStream{
+		ctx:  context.Background(),
+		recv: make(chan *hds.HealthCheckRequestOrEndpointHealthResponse, 10),
+		sent: make(chan *hds.HealthCheckSpecifier, 10),
+	}
+}
+
+type provider struct {
+	mu       sync.Mutex
+	clusters map[string]string
+}
+
+func (p *provider) HealthChecks(node *core.Node, _ *hds.Capability) (*hds.HealthCheckSpecifier, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	cluster, exists := p.clusters[node.Id]
+	if !exists {
+		return nil, nil
+	}
+	return &hds.HealthCheckSpecifier{ClusterHealthChecks: []*hds.ClusterHealthCheck{{ClusterName: cluster}}}, nil
+}
+
+func (p *provider) assign(node, cluster string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.clusters[node] = cluster
+}
+
+type callbacks struct {
+	mu      sync.Mutex
+	opened  int
+	closed  int
+	reports map[string]int
+}
+
+func (c *callbacks) OnStreamOpen(context.Context, int64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.opened++
+	return nil
+}
+
+func (c *callbacks) OnStreamClosed(int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed++
+}
+
+func (c *callbacks) OnHealthCheckRequest(int64, *hds.HealthCheckRequest) error {
+	return nil
+}
+
+func (c *callbacks) OnEndpointHealthResponse(_ int64, node *core.Node, resp *hds.EndpointHealthResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.reports[node.Id] += len(resp.EndpointsHealth)
+}
+
+func healthCheckRequest(node string) *hds.HealthCheckRequestOrEndpointHealthResponse {
+	return &hds.HealthCheckRequestOrEndpointHealthResponse{
+		RequestType: &hds.HealthCheckRequestOrEndpointHealthResponse_HealthCheckRequest{
+			HealthCheckRequest: &hds.HealthCheckRequest{Node: &core.Node{Id: node}},
+		},
+	}
+}
+
+func endpointHealthResponse(statuses ...core.HealthStatus) *hds.HealthCheckRequestOrEndpointHealthResponse {
+	resp := &hds.EndpointHealthResponse{}
+	for _, st := range statuses {
+		resp.EndpointsHealth = append(resp.EndpointsHealth, &hds.EndpointHealth{HealthStatus: st})
+	}
+	return &hds.HealthCheckRequestOrEndpointHealthResponse{
+		RequestType: &hds.HealthCheckRequestOrEndpointHealthResponse_EndpointHealthResponse{
+			EndpointHealthResponse: resp,
+		},
+	}
+}
+
+func expectCluster(t *testing.T, stream *mockStream, want string) {
+	t.Helper()
+	select {
+	case resp := <-stream.sent:
+		if got := resp.ClusterHealthChecks[0].ClusterName; got != want {
+			t.Errorf("cluster => got %q, want %q", got, want)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("no health check specifier for %q", want)
+	}
+}
+
+func TestStreamHealthCheck(t *testing.T) {
+	p := &provider{clusters: map[string]string{"a": "cluster0"}}
+	cb := &callbacks{reports: make(map[string]int)}
+	s := server.NewServer(context.Background(), p, cb)
+
+	stream := makeMockStream()
+	done := make(chan error)
+	go func() {
+		done <- s.StreamHealthCheck(stream)
+	}()
+
+	stream.recv <- healthCheckRequest("a")
+	expectCluster(t, stream, "cluster0")
+
+	p.assign("a", "cluster1")
+	s.Refresh("b")
+	s.Refresh("a")
+	expectCluster(t, stream, "cluster1")
+	select {
+	case resp := <-stream.sent:
+		t.Errorf("unexpected specifier %v", resp)
+	default:
+	}
+
+	stream.recv <- endpointHealthResponse(core.HealthStatus_HEALTHY, core.HealthStatus_UNHEALTHY)
+	close(stream.recv)
+	if err := <-done; status.Code(err) != codes.Canceled {
+		t.Errorf("StreamHealthCheck => got error %v, want canceled", err)
+	}
+
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	if cb.opened != 1 || cb.closed != 1 {
+		t.Errorf("streams => got %d opened and %d closed, want 1", cb.opened, cb.closed)
+	}
+	if got := cb.reports["a"]; got != 2 {
+		t.Errorf("reported endpoints => got %d, want 2", got)
+	}
+}
+
+func TestStreamHealthCheckWithoutRequest(t *testing.T) {
+	s := server.NewServer(context.Background(), &provider{}, nil)
+	stream := makeMockStream()
+	stream.recv <- endpointHealthResponse(core.HealthStatus_HEALTHY)
+	if err := s.StreamHealthCheck(stream); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("StreamHealthCheck => got error %v, want failed precondition", err)
+	}
+}
+
+func TestFetchHealthCheck(t *testing.T) {
+	s := server.NewServer(context.Background(), &provider{clusters: map[string]string{"a": "cluster0"}}, nil)
+	resp, err := s.FetchHealthCheck(context.Background(), healthCheckRequest("a"))
+	if err != nil || resp.ClusterHealthChecks[0].ClusterName != "cluster0" {
+		t.Errorf("FetchHealthCheck => got %v, %v", resp, err)
+	}
+	resp, err = s.FetchHealthCheck(context.Background(), healthCheckRequest("b"))
+	if err != nil || len(resp.ClusterHealthChecks) != 0 {
+		t.Errorf("FetchHealthCheck => got %v, %v, want empty", resp, err)
+	}
+	if _, err := s.FetchHealthCheck(context.Background(), endpointHealthResponse()); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("FetchHealthCheck => got error %v, want invalid argument", err)
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	rls "github.com/envoyproxy/go-control-plane/envoy/service/ratelimit/v2"
+)
+
+// MemoryLimiter counts the hits in fixed windows of the limit unit, in the
+// memory of the server. The counts are not shared between the replicas of
+// the control plane, so each replica enforces the limits separately.
+type MemoryLimiter struct {
+	mu       sync.Mutex
+	counters map[string]*counter
+	// swept is the number of counters after the last sweep
+	swept int
+	now   func() time.Time
+}
+
+type counter struct {
+	window time.Time
+	expiry time.Time
+	// hits is wider than the added hits, so that it does not wrap
+	hits uint64
+}
+
+var _ Limiter = &MemoryLimiter{}
+
+// NewMemoryLimiter creates an in-memory limiter.
+func NewMemoryLimiter() *MemoryLimiter {
+	return &MemoryLimiter{counters: make(map[string]*counter), now: time.Now}
+}
+
+// unitDuration returns the duration of a limit unit.
+func unitDuration(unit rls.RateLimitResponse_RateLimit_Unit) (time.Duration, error) {
+	switch unit {
+	case rls.RateLimitResponse_RateLimit_SECOND:
+		return time.Second, nil
+	case rls.RateLimitResponse_RateLimit_MINUTE:
+		return time.Minute, nil
+	case rls.RateLimitResponse_RateLimit_HOUR:
+		return time.Hour, nil
+	case rls.RateLimitResponse_RateLimit_DAY:
+		return 24 * time.Hour, nil
+	}
+	return 0, status.Errorf(codes.InvalidArgument, "unknown rate limit unit %v", unit)
+}
+
+// Take implements Limiter.
+func (l *MemoryLimiter) Take(_ context.Context, key string, limit Limit, hits uint32) (uint32, bool, error) {
+	unit, err := unitDuration(limit.Unit)
+	if err != nil {
+		return 0, false, err
+	}
+	now := l.now()
+	window := now.Truncate(unit)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sweep(now)
+	c, exists := l.counters[key]
+	if !exists || !c.window.Equal(window) {
+		c = &counter{window: window, expiry: window.Add(unit)}
+		l.counters[key] = c
+	}
+	c.hits += uint64(hits)
+	if c.hits > uint64(limit.RequestsPerUnit) {
+		return 0, true, nil
+	}
+	return limit.RequestsPerUnit - uint32(c.hits), false, nil
+}
+
+// sweep removes the expired counters once their number doubles, so that the
+// descriptors limited per value do not accumulate.
+func (l *MemoryLimiter) sweep(now time.Time) {
+	if len(l.counters) < 2*l.swept || len(l.counters) < 64 {
+		return
+	}
+	for key, c := range l.counters {
+		if !now.Before(c.expiry) {
+			delete(l.counters, key)
+		}
+	}
+	l.swept = len(l.counters)
+}
@@ -0,0 +1,155 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+// Package ratelimit provides an embedded rate limit service, to enforce the
+// global rate limits of the proxies from the control plane:
+//
+//	rules := map[string][]ratelimit.Rule{"edge": {{
+//		Entries: []ratelimit.Entry{{Key: "remote_address"}},
+//		Limit:   ratelimit.Limit{RequestsPerUnit: 100, Unit: rls.RateLimitResponse_RateLimit_SECOND},
+//	}}}
+//	rls.RegisterRateLimitServiceServer(grpcServer, ratelimit.NewServer(ratelimit.NewMemoryLimiter(), rules))
+package ratelimit
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	rl "github.com/envoyproxy/go-control-plane/envoy/api/v2/ratelimit"
+	rls "github.com/envoyproxy/go-control-plane/envoy/service/ratelimit/v2"
+)
+
+// Limit is the number of requests allowed per time unit.
+type Limit struct {
+	// Name optionally identifies the limit in the responses.
+	Name            string
+	RequestsPerUnit uint32
+	Unit            rls.RateLimitResponse_RateLimit_Unit
+}
+
+// Entry matches a descriptor entry by key, and by value unless the value is
+// empty. The descriptors matching an entry without a value are limited per
+// value, e.g. per remote address.
+type Entry struct {
+	Key   string
+	Value string
+}
+
+// Rule applies a limit to the descriptors matching its entries.
+type Rule struct {
+	Entries []Entry
+	Limit   Limit
+}
+
+// Matches checks that the descriptor has the entries of the rule in order.
+func (r Rule) Matches(descriptor *rl.RateLimitDescriptor) bool {
+	if len(descriptor.GetEntries()) != len(r.Entries) {
+		return false
+	}
+	for i, entry := range descriptor.GetEntries() {
+		if entry.Key != r.Entries[i].Key || (r.Entries[i].Value != "" && entry.Value != r.Entries[i].Value) {
+			return false
+		}
+	}
+	return true
+}
+
+// DescriptorKey identifies the counter of a descriptor in a domain. The
+// domain and the entries are prefixed by their lengths, so that distinct
+// descriptors have distinct keys whatever their characters.
+func DescriptorKey(domain string, descriptor *rl.RateLimitDescriptor) string {
+	var b strings.Builder
+	writePart(&b, domain)
+	for _, entry := range descriptor.GetEntries() {
+		writePart(&b, entry.Key)
+		writePart(&b, entry.Value)
+	}
+	return b.String()
+}
+
+func writePart(b *strings.Builder, part string) {
+	b.WriteString(strconv.Itoa(len(part)))
+	b.WriteString(":")
+	b.WriteString(part)
+}
+
+// Limiter counts the hits of the descriptors. Take adds the hits to the
+// counter of the key in the current time unit, and returns the requests
+// remaining under the limit, and whether the limit is exceeded.
+type Limiter interface {
+	Take(ctx context.Context, key string, limit Limit, hits uint32) (remaining uint32, over bool, err error)
+}
+
+// NewServer creates a rate limit server from a limiter and the rules by
+// domain. The first rule matching a descriptor applies, and the descriptors
+// without a matching rule are not limited.
+func NewServer(limiter Limiter, rules map[string][]Rule) rls.RateLimitServiceServer {
+	return &server{limiter: limiter, rules: rules}
+}
+
+type server struct {
+	limiter Limiter
+	rules   map[string][]Rule
+}
+
+func (s *server) ShouldRateLimit(ctx context.Context, req *rls.RateLimitRequest) (*rls.RateLimitResponse, error) {
+	if req.Domain == "" {
+		return nil, status.Error(codes.InvalidArgument, "rate limit domain is required")
+	}
+	hits := req.HitsAddend
+	if hits == 0 {
+		hits = 1
+	}
+
+	out := &rls.RateLimitResponse{OverallCode: rls.RateLimitResponse_OK}
+	for _, descriptor := range req.Descriptors {
+		rule, exists := s.match(req.Domain, descriptor)
+		if !exists {
+			out.Statuses = append(out.Statuses, &rls.RateLimitResponse_DescriptorStatus{Code: rls.RateLimitResponse_OK})
+			continue
+		}
+		remaining, over, err := s.limiter.Take(ctx, DescriptorKey(req.Domain, descriptor), rule.Limit, hits)
+		if err != nil {
+			return nil, err
+		}
+		code := rls.RateLimitResponse_OK
+		if over {
+			code = rls.RateLimitResponse_OVER_LIMIT
+			out.OverallCode = rls.RateLimitResponse_OVER_LIMIT
+		}
+		out.Statuses = append(out.Statuses, &rls.RateLimitResponse_DescriptorStatus{
+			Code: code,
+			CurrentLimit: &rls.RateLimitResponse_RateLimit{
+				Name:            rule.Limit.Name,
+				RequestsPerUnit: rule.Limit.RequestsPerUnit,
+				Unit:            rule.Limit.Unit,
+			},
+			LimitRemaining: remaining,
+		})
+	}
+	return out, nil
+}
+
+func (s *server) match(domain string, descriptor *rl.RateLimitDescriptor) (Rule, bool) {
+	for _, rule := range s.rules[domain] {
+		if rule.Matches(descriptor) {
+			return rule, true
+		}
+	}
+	return Rule{}, false
+}
@@ -0,0 +1,122 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package ratelimit_test
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	rl "github.com/envoyproxy/go-control-plane/envoy/api/v2/ratelimit"
+	rls "github.com/envoyproxy/go-control-plane/envoy/service/ratelimit/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/server/ratelimit/v2"
+)
+
+func descriptor(kv ...string) *rl.RateLimitDescriptor {
+	out := &rl.RateLimitDescriptor{}
+	for i := 0; i+1 < len(kv); i += 2 {
+		out.Entries = append(out.Entries, &rl.RateLimitDescriptor_Entry{Key: kv[i], Value: kv[i+1]})
+	}
+	return out
+}
+
+func TestRuleMatches(t *testing.T) {
+	rule := ratelimit.Rule{Entries: []ratelimit.Entry{{Key: "path", Value: "/login"}, {Key: "remote_address"}}}
+	tests := []struct {
+		descriptor *rl.RateLimitDescriptor
+		want       bool
+	}{
+		{descriptor: descriptor("path", "/login", "remote_address", "10.0.0.1"), want: true},
+		{descriptor: descriptor("path", "/login", "remote_address", "10.0.0.2"), want: true},
+		{descriptor: descriptor("path", "/", "remote_address", "10.0.0.1")},
+		{descriptor: descriptor("remote_address", "10.0.0.1", "path", "/login")},
+		{descriptor: descriptor("path", "/login")},
+	}
+	for _, test := range tests {
+		if got := rule.Matches(test.descriptor); got != test.want {
+			t.Errorf("Matches(%v) => got %v, want %v", test.descriptor, got, test.want)
+		}
+	}
+}
+
+func TestDescriptorKey(t *testing.T) {
+	if a, b := ratelimit.DescriptorKey("edge", descriptor("a", "b|c=d")), ratelimit.DescriptorKey("edge", descriptor("a", "b", "c", "d")); a == b {
+		t.Errorf("DescriptorKey() of distinct descriptors => got %q twice", a)
+	}
+	if a, b := ratelimit.DescriptorKey("edge|a=b", descriptor()), ratelimit.DescriptorKey("edge", descriptor("a", "b")); a == b {
+		t.Errorf("DescriptorKey() of distinct domains => got %q twice", a)
+	}
+}
+
+func TestMemoryLimiterOverflow(t *testing.T) {
+	l := ratelimit.NewMemoryLimiter()
+	limit := ratelimit.Limit{RequestsPerUnit: 10, Unit: rls.RateLimitResponse_RateLimit_HOUR}
+	for i := 0; i < 2; i++ {
+		if _, over, err := l.Take(context.Background(), "key", limit, math.MaxUint32); err != nil || !over {
+			t.Errorf("Take() #%d => got over %v, %v, want over the limit", i, over, err)
+		}
+	}
+	if _, over, _ := l.Take(context.Background(), "key", limit, 1); !over {
+		t.Error("Take() after the overflow => got under the limit")
+	}
+}
+
+func TestShouldRateLimit(t *testing.T) {
+	s := ratelimit.NewServer(ratelimit.NewMemoryLimiter(), map[string][]ratelimit.Rule{
+		"edge": {{
+			Entries: []ratelimit.Entry{{Key: "remote_address"}},
+			Limit:   ratelimit.Limit{Name: "per_client", RequestsPerUnit: 2, Unit: rls.RateLimitResponse_RateLimit_HOUR},
+		}},
+	})
+	request := func(address string, hits uint32) *rls.RateLimitResponse {
+		resp, err := s.ShouldRateLimit(context.Background(), &rls.RateLimitRequest{
+			Domain:      "edge",
+			Descriptors: []*rl.RateLimitDescriptor{descriptor("remote_address", address), descriptor("path", "/")},
+			HitsAddend:  hits,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	resp := request("10.0.0.1", 0)
+	if resp.OverallCode != rls.RateLimitResponse_OK || resp.Statuses[0].LimitRemaining != 1 || resp.Statuses[0].CurrentLimit.Name != "per_client" {
+		t.Errorf("first request => got %v, want OK with 1 remaining", resp)
+	}
+	if resp.Statuses[1].Code != rls.RateLimitResponse_OK || resp.Statuses[1].CurrentLimit != nil {
+		t.Errorf("unmatched descriptor => got %v, want OK without a limit", resp.Statuses[1])
+	}
+	if resp = request("10.0.0.1", 2); resp.OverallCode != rls.RateLimitResponse_OVER_LIMIT || resp.Statuses[0].Code != rls.RateLimitResponse_OVER_LIMIT {
+		t.Errorf("over the limit => got %v, want OVER_LIMIT", resp)
+	}
+	if resp = request("10.0.0.2", 1); resp.OverallCode != rls.RateLimitResponse_OK {
+		t.Errorf("other client => got %v, want OK", resp)
+	}
+
+	if _, err := s.ShouldRateLimit(context.Background(), &rls.RateLimitRequest{}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("missing domain => got %v, want invalid argument", err)
+	}
+	s = ratelimit.NewServer(ratelimit.NewMemoryLimiter(), map[string][]ratelimit.Rule{"edge": {{Entries: []ratelimit.Entry{{Key: "path"}}}}})
+	if _, err := s.ShouldRateLimit(context.Background(), &rls.RateLimitRequest{
+		Domain:      "edge",
+		Descriptors: []*rl.RateLimitDescriptor{descriptor("path", "/")},
+	}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("unknown unit => got %v, want invalid argument", err)
+	}
+}
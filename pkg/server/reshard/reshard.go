@@ -0,0 +1,215 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+// Package reshard provides a coordinator for migrating nodes between control
+// plane replicas.
+package reshard
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/envoyproxy/go-control-plane/pkg/log"
+)
+
+// Disconnector terminates the open streams for a node. It is implemented by
+// both v2 and v3 xDS servers.
+type Disconnector interface {
+	DisconnectNode(node string, st *status.Status, delay time.Duration) int
+}
+
+// HandoffFunc transfers the ownership of the node snapshot to the target
+// replica. The node is disconnected only after the handoff succeeds, so that
+// the reconnecting proxy finds its snapshot at the new owner.
+type HandoffFunc func(ctx context.Context, node string, target string) error
+
+// Migration moves a node to the target replica.
+type Migration struct {
+	// Node ID to migrate.
+	Node string
+
+	// Target replica identifier passed to the handoff function.
+	Target string
+}
+
+// Progress reports the state of a resharding run.
+type Progress struct {
+	// Total number of migrations in the run.
+	Total int
+
+	// Migrated is the number of nodes handed off and disconnected.
+	Migrated int
+
+	// Failed is the number of nodes for which the handoff failed.
+	Failed int
+
+	// Streams is the number of streams disconnected so far.
+	Streams int
+
+	// Errors are the handoff errors indexed by node ID.
+	Errors map[string]error
+}
+
+// Done checks whether all migrations of the run are processed.
+func (p Progress) Done() bool {
+	return p.Migrated+p.Failed == p.Total
+}
+
+// Coordinator migrates nodes in batches to avoid a thundering herd of
+// reconnecting proxies. Each node snapshot is handed off first and the node
+// streams are disconnected afterwards with a retryable status.
+type Coordinator struct {
+	server  Disconnector
+	handoff HandoffFunc
+	log     log.Logger
+
+	// Number of nodes migrated at once.
+	batchSize int
+	// Pause between consecutive batches.
+	interval time.Duration
+	// Grace period before the streams are closed.
+	drainDelay time.Duration
+	// Status sent to the disconnected streams.
+	status *status.Status
+
+	progress Progress
+	mu       sync.RWMutex
+}
+
+// CoordinatorOption modifies the behavior of the coordinator.
+type CoordinatorOption func(*Coordinator)
+
+// WithBatchSize sets the number of nodes migrated at once. The default is one.
+func WithBatchSize(size int) CoordinatorOption {
+	return func(c *Coordinator) {
+		c.batchSize = size
+	}
+}
+
+// WithInterval sets the pause between consecutive batches.
+func WithInterval(interval time.Duration) CoordinatorOption {
+	return func(c *Coordinator) {
+		c.interval = interval
+	}
+}
+
+// WithDrainDelay sets the delay for closing the streams of a migrated node.
+func WithDrainDelay(delay time.Duration) CoordinatorOption {
+	return func(c *Coordinator) {
+		c.drainDelay = delay
+	}
+}
+
+// WithStatus overrides the status sent to the disconnected streams. The status
+// should be retryable by the proxy, which is the case for the default
+// UNAVAILABLE code.
+func WithStatus(st *status.Status) CoordinatorOption {
+	return func(c *Coordinator) {
+		c.status = st
+	}
+}
+
+// WithLogger sets an optional logger.
+func WithLogger(logger log.Logger) CoordinatorOption {
+	return func(c *Coordinator) {
+		c.log = logger
+	}
+}
+
+// NewCoordinator creates a resharding coordinator for the server streams.
+func NewCoordinator(server Disconnector, handoff HandoffFunc, opts ...CoordinatorOption) *Coordinator {
+	out := &Coordinator{
+		server:    server,
+		handoff:   handoff,
+		batchSize: 1,
+		status:    status.New(codes.Unavailable, "node migrated to another control plane replica"),
+	}
+	for _, opt := range opts {
+		opt(out)
+	}
+	if out.batchSize < 1 {
+		out.batchSize = 1
+	}
+	return out
+}
+
+// Run performs the migrations in batches and blocks until all of them are
+// processed or the context is cancelled. A failed handoff leaves the node
+// connected to this replica and is recorded in the progress.
+func (c *Coordinator) Run(ctx context.Context, migrations []Migration) error {
+	c.mu.Lock()
+	c.progress = Progress{Total: len(migrations), Errors: make(map[string]error)}
+	c.mu.Unlock()
+
+	for start := 0; start < len(migrations); start += c.batchSize {
+		if start > 0 && c.interval > 0 {
+			select {
+			case <-time.After(c.interval):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		end := start + c.batchSize
+		if end > len(migrations) {
+			end = len(migrations)
+		}
+		for _, migration := range migrations[start:end] {
+			c.migrate(ctx, migration)
+		}
+	}
+	return nil
+}
+
+func (c *Coordinator) migrate(ctx context.Context, migration Migration) {
+	if err := c.handoff(ctx, migration.Node, migration.Target); err != nil {
+		if c.log != nil {
+			c.log.Warnf("handoff of node %q to %q failed: %v", migration.Node, migration.Target, err)
+		}
+		c.mu.Lock()
+		c.progress.Failed++
+		c.progress.Errors[migration.Node] = err
+		c.mu.Unlock()
+		return
+	}
+
+	streams := c.server.DisconnectNode(migration.Node, c.status, c.drainDelay)
+	if c.log != nil {
+		c.log.Infof("migrated node %q to %q, disconnected %d streams", migration.Node, migration.Target, streams)
+	}
+	c.mu.Lock()
+	c.progress.Migrated++
+	c.progress.Streams += streams
+	c.mu.Unlock()
+}
+
+// Progress returns a copy of the progress of the current or last run.
+func (c *Coordinator) Progress() Progress {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	out := c.progress
+	out.Errors = make(map[string]error, len(c.progress.Errors))
+	for node, err := range c.progress.Errors {
+		out.Errors[node] = err
+	}
+	return out
+}
@@ -0,0 +1,109 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package reshard_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/envoyproxy/go-control-plane/pkg/server/reshard"
+	serverv2 "github.com/envoyproxy/go-control-plane/pkg/server/v2"
+	serverv3 "github.com/envoyproxy/go-control-plane/pkg/server/v3"
+)
+
+var (
+	_ reshard.Disconnector = serverv2.Server(nil)
+	_ reshard.Disconnector = serverv3.Server(nil)
+)
+
+type mockServer struct {
+	disconnected []string
+	codes        []codes.Code
+}
+
+func (s *mockServer) DisconnectNode(node string, st *status.Status, _ time.Duration) int {
+	s.disconnected = append(s.disconnected, node)
+	s.codes = append(s.codes, st.Code())
+	return 2
+}
+
+func TestCoordinator(t *testing.T) {
+	srv := &mockServer{}
+	handoffs := make(map[string]string)
+	handoff := func(_ context.Context, node string, target string) error {
+		if node == "bad" {
+			return errors.New("handoff error")
+		}
+		handoffs[node] = target
+		return nil
+	}
+	c := reshard.NewCoordinator(srv, handoff, reshard.WithBatchSize(2), reshard.WithInterval(time.Millisecond))
+
+	err := c.Run(context.Background(), []reshard.Migration{
+		{Node: "a", Target: "replica-1"},
+		{Node: "bad", Target: "replica-1"},
+		{Node: "b", Target: "replica-2"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := map[string]string{"a": "replica-1", "b": "replica-2"}; !reflect.DeepEqual(handoffs, want) {
+		t.Errorf("handoffs => got %v, want %v", handoffs, want)
+	}
+	if want := []string{"a", "b"}; !reflect.DeepEqual(srv.disconnected, want) {
+		t.Errorf("disconnected nodes => got %v, want %v", srv.disconnected, want)
+	}
+	for _, code := range srv.codes {
+		if code != codes.Unavailable {
+			t.Errorf("disconnect code => got %v, want %v", code, codes.Unavailable)
+		}
+	}
+
+	progress := c.Progress()
+	if !progress.Done() {
+		t.Errorf("progress => got %+v, want done", progress)
+	}
+	if progress.Total != 3 || progress.Migrated != 2 || progress.Failed != 1 || progress.Streams != 4 {
+		t.Errorf("progress => got %+v", progress)
+	}
+	if _, ok := progress.Errors["bad"]; !ok {
+		t.Errorf("expected handoff error for node %q", "bad")
+	}
+}
+
+func TestCoordinatorCancel(t *testing.T) {
+	srv := &mockServer{}
+	handoff := func(context.Context, string, string) error { return nil }
+	c := reshard.NewCoordinator(srv, handoff, reshard.WithInterval(time.Hour))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	if err := c.Run(ctx, []reshard.Migration{{Node: "a"}, {Node: "b"}}); err != context.Canceled {
+		t.Errorf("Run() => got %v, want %v", err, context.Canceled)
+	}
+	if progress := c.Progress(); progress.Done() || progress.Migrated != 1 {
+		t.Errorf("progress => got %+v, want one migrated node", progress)
+	}
+}
@@ -0,0 +1,152 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package rest
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"path"
+
+	"github.com/golang/protobuf/jsonpb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	discovery "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
+	"github.com/envoyproxy/go-control-plane/pkg/log"
+	"github.com/envoyproxy/go-control-plane/pkg/resource/v2"
+)
+
+// Handler serves the REST-JSON xDS endpoints, e.g. POST /v2/discovery:clusters,
+// from a REST server. The request body is a JSON discovery request, and the
+// type URL is implied by the path.
+//
+// A request with the current version_info gets an empty 304 response, as the
+// cache skips the fetch, so the clients poll with the version of the last
+// response until the configuration changes. The fetch errors are mapped from
+// their gRPC status, e.g. a node without a snapshot gets a 404 response.
+type Handler struct {
+	// Log is an optional log for errors in response write
+	Log log.Logger
+
+	// Server is the underlying REST server
+	Server Server
+
+	// MaxBodySize optionally limits the size of the request bodies, to
+	// DefaultMaxBodySize if zero
+	MaxBodySize int64
+}
+
+// DefaultMaxBodySize is the default limit of the request body size.
+const DefaultMaxBodySize = 1 << 20
+
+var _ http.Handler = &Handler{}
+
+// NewHandler creates an HTTP handler for the REST server.
+func NewHandler(server Server, logger log.Logger) *Handler {
+	return &Handler{Server: server, Log: logger}
+}
+
+// fetchTypes maps the REST paths to the type URLs.
+var fetchTypes = map[string]string{
+	resource.FetchEndpoints:    resource.EndpointType,
+	resource.FetchClusters:     resource.ClusterType,
+	resource.FetchListeners:    resource.ListenerType,
+	resource.FetchRoutes:       resource.RouteType,
+	resource.FetchScopedRoutes: resource.ScopedRouteType,
+	resource.FetchSecrets:      resource.SecretType,
+	resource.FetchRuntimes:     resource.RuntimeType,
+}
+
+func (h *Handler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	typeURL, exists := fetchTypes[path.Clean(req.URL.Path)]
+	if !exists {
+		http.NotFound(resp, req)
+		return
+	}
+	if req.Method != http.MethodPost {
+		resp.Header().Set("Allow", http.MethodPost)
+		http.Error(resp, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if req.Body == nil {
+		http.Error(resp, "empty body", http.StatusBadRequest)
+		return
+	}
+	limit := h.MaxBodySize
+	if limit <= 0 {
+		limit = DefaultMaxBodySize
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(resp, req.Body, limit))
+	if err != nil {
+		if int64(len(body)) >= limit {
+			http.Error(resp, "body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(resp, "cannot read body", http.StatusBadRequest)
+		return
+	}
+
+	in := &discovery.DiscoveryRequest{}
+	if err := (&jsonpb.Unmarshaler{AllowUnknownFields: true}).Unmarshal(bytes.NewReader(body), in); err != nil {
+		http.Error(resp, "cannot parse JSON body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	in.TypeUrl = typeURL
+
+	out, err := h.Server.Fetch(req.Context(), in)
+	if err != nil {
+		// the cache skips the fetch if the request version is current
+		if _, ok := err.(*types.SkipFetchError); ok {
+			resp.WriteHeader(http.StatusNotModified)
+			return
+		}
+		http.Error(resp, "fetch error: "+err.Error(), httpStatus(err))
+		return
+	}
+
+	buf := &bytes.Buffer{}
+	if err := (&jsonpb.Marshaler{OrigName: true}).Marshal(buf, out); err != nil {
+		http.Error(resp, "marshal error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	resp.Header().Set("Content-Type", "application/json")
+	if _, err := resp.Write(buf.Bytes()); err != nil && h.Log != nil {
+		h.Log.Errorf("rest handler error: %v", err)
+	}
+}
+
+// httpStatus maps the gRPC status of a fetch error to an HTTP status.
+func httpStatus(err error) int {
+	switch status.Code(err) {
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	default:
+		return http.StatusInternalServerError
+	}
+}
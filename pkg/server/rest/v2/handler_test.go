@@ -0,0 +1,103 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package rest_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	discovery "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/v2"
+	rsrc "github.com/envoyproxy/go-control-plane/pkg/resource/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/server/rest/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/test/resource/v2"
+)
+
+type callbacks struct{}
+
+func (callbacks) OnFetchRequest(_ context.Context, req *discovery.DiscoveryRequest) error {
+	if req.GetNode().GetId() == "denied" {
+		return status.Error(codes.PermissionDenied, "denied")
+	}
+	return nil
+}
+
+func (callbacks) OnFetchResponse(*discovery.DiscoveryRequest, *discovery.DiscoveryResponse) {}
+
+func TestHandler(t *testing.T) {
+	config := cache.NewSnapshotCache(false, cache.IDHash{}, nil)
+	snapshot := cache.NewSnapshot("1", nil, []types.Resource{resource.MakeCluster(resource.Xds, "cluster0")}, nil, nil, nil, nil)
+	if err := config.SetSnapshot("node", snapshot); err != nil {
+		t.Fatal(err)
+	}
+	handler := rest.NewHandler(rest.NewServer(config, callbacks{}), nil)
+	handler.MaxBodySize = 64
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+
+	cases := []struct {
+		method string
+		path   string
+		body   string
+		expect int
+	}{
+		{method: http.MethodPost, path: "/hello", body: `{}`, expect: http.StatusNotFound},
+		{method: http.MethodGet, path: rsrc.FetchClusters, expect: http.StatusMethodNotAllowed},
+		{method: http.MethodPost, path: rsrc.FetchClusters, body: `{`, expect: http.StatusBadRequest},
+		{method: http.MethodPost, path: rsrc.FetchClusters, body: `{"node": {"id": "denied"}}`, expect: http.StatusForbidden},
+		{method: http.MethodPost, path: rsrc.FetchClusters, body: `{"node": {"id": "other"}}`, expect: http.StatusNotFound},
+		{method: http.MethodPost, path: rsrc.FetchClusters, body: `{"node": {"id": "` + strings.Repeat("x", 64) + `"}}`, expect: http.StatusRequestEntityTooLarge},
+		{method: http.MethodPost, path: rsrc.FetchClusters, body: `{"node": {"id": "node"}, "version_info": "1"}`, expect: http.StatusNotModified},
+		{method: http.MethodPost, path: rsrc.FetchClusters, body: `{"node": {"id": "node"}}`, expect: http.StatusOK},
+	}
+	for _, cs := range cases {
+		req, err := http.NewRequest(cs.method, srv.URL+cs.path, strings.NewReader(cs.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != cs.expect {
+			t.Errorf("%s %s %s => got %d, want %d", cs.method, cs.path, cs.body, resp.StatusCode, cs.expect)
+		}
+		if resp.StatusCode == http.StatusOK {
+			if got := resp.Header.Get("Content-Type"); got != "application/json" {
+				t.Errorf("content type => got %q, want application/json", got)
+			}
+			out := struct {
+				VersionInfo string `json:"version_info"`
+				TypeURL     string `json:"type_url"`
+				Resources   []json.RawMessage
+			}{}
+			if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+				t.Fatal(err)
+			}
+			if out.VersionInfo != "1" || out.TypeURL != rsrc.ClusterType || len(out.Resources) != 1 {
+				t.Errorf("response => got %+v, want version 1 with one cluster", out)
+			}
+		}
+		resp.Body.Close()
+	}
+}
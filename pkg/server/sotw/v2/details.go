@@ -0,0 +1,88 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package sotw
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ProtocolViolation is the type of the precondition failures reported for
+// the requests violating the xDS protocol.
+const ProtocolViolation = "xDS"
+
+// ProtocolError returns an InvalidArgument status with a precondition
+// failure detail, e.g. for a request missing its type URL.
+func ProtocolError(subject string, format string, args ...interface{}) error {
+	description := fmt.Sprintf(format, args...)
+	st, err := status.New(codes.InvalidArgument, description).WithDetails(&errdetails.PreconditionFailure{
+		Violations: []*errdetails.PreconditionFailure_Violation{{
+			Type:        ProtocolViolation,
+			Subject:     subject,
+			Description: description,
+		}},
+	})
+	if err != nil {
+		return status.Error(codes.InvalidArgument, description)
+	}
+	return st.Err()
+}
+
+// RetryError returns a status with a retry delay detail, so that the clients
+// back off, e.g. from a stream closed for exceeding a rate limit.
+func RetryError(code codes.Code, delay time.Duration, format string, args ...interface{}) error {
+	message := fmt.Sprintf(format, args...)
+	st, err := status.New(code, message).WithDetails(&errdetails.RetryInfo{
+		RetryDelay: ptypes.DurationProto(delay),
+	})
+	if err != nil {
+		return status.Error(code, message)
+	}
+	return st.Err()
+}
+
+// withRequestInfo attaches the stream ID, the node ID and the type URL to a
+// terminal stream status as a request info detail. The node and the type are
+// the URL-encoded serving data, e.g. "node=envoy-1&type_url=...". The errors
+// without a status are returned as-is.
+func withRequestInfo(err error, streamID int64, node, typeURL string) error {
+	st, ok := status.FromError(err)
+	if !ok || st.Code() == codes.OK {
+		return err
+	}
+	for _, detail := range st.Details() {
+		if _, exists := detail.(*errdetails.RequestInfo); exists {
+			return err
+		}
+	}
+	data := url.Values{}
+	data.Set("node", node)
+	data.Set("type_url", typeURL)
+	detailed, derr := st.WithDetails(&errdetails.RequestInfo{
+		RequestId:   strconv.FormatInt(streamID, 10),
+		ServingData: data.Encode(),
+	})
+	if derr != nil {
+		return err
+	}
+	return detailed.Err()
+}
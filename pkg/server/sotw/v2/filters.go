@@ -0,0 +1,156 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package sotw
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+
+	discovery "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/resource/v2"
+)
+
+// FilterStage orders the response filters of a type. The stages run in
+// order, and the filters of a stage in the order of registration.
+type FilterStage int
+
+const (
+	// StageAuthz rejects the responses the stream is not allowed to receive.
+	StageAuthz FilterStage = iota
+	// StageTransform rewrites the resources, e.g. per node.
+	StageTransform
+	// StageRedact removes the sensitive fields of the resources.
+	StageRedact
+	// StageCompress reduces the response size, e.g. by dropping the fields
+	// unused by the clients.
+	StageCompress
+)
+
+func (stage FilterStage) String() string {
+	switch stage {
+	case StageAuthz:
+		return "authz"
+	case StageTransform:
+		return "transform"
+	case StageRedact:
+		return "redact"
+	case StageCompress:
+		return "compress"
+	}
+	return "unknown"
+}
+
+// ResponseFilter processes a response before it is sent on a stream. The
+// response is a copy owned by the filter chain, and is modified in place or
+// replaced. Returning an error fails the type, and closes the stream unless
+// the server isolates the type failures.
+type ResponseFilter func(ctx context.Context, streamID int64, req *discovery.DiscoveryRequest, resp *discovery.DiscoveryResponse) (*discovery.DiscoveryResponse, error)
+
+// ResponseFilters is a registry of the response filter chains by type URL,
+// applied by the server with WithResponseFilters:
+//
+//	filters := NewResponseFilters()
+//	filters.Register(StageAuthz, resource.AnyType, authorize)
+//	filters.Register(StageRedact, resource.SecretType, redactKeys)
+//	srv := NewServer(ctx, config, callbacks, WithResponseFilters(filters))
+//
+// The filters registered for resource.AnyType apply to all the types, ahead of
+// the filters of the type in the same stage. The registry is safe for
+// concurrent use, and the filters registered once the server is running apply
+// to the next responses.
+type ResponseFilters struct {
+	mu      sync.RWMutex
+	filters map[string][]stagedFilter
+}
+
+type stagedFilter struct {
+	stage  FilterStage
+	filter ResponseFilter
+}
+
+// NewResponseFilters creates an empty registry.
+func NewResponseFilters() *ResponseFilters {
+	return &ResponseFilters{filters: make(map[string][]stagedFilter)}
+}
+
+// Register appends the filters to a stage of the chain of the type URL.
+func (f *ResponseFilters) Register(stage FilterStage, typeURL string, filters ...ResponseFilter) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, filter := range filters {
+		f.filters[typeURL] = append(f.filters[typeURL], stagedFilter{stage: stage, filter: filter})
+	}
+}
+
+// chain returns the filters of a type in order.
+func (f *ResponseFilters) chain(typeURL string) []ResponseFilter {
+	f.mu.RLock()
+	all := append([]stagedFilter(nil), f.filters[resource.AnyType]...)
+	if typeURL != resource.AnyType {
+		all = append(all, f.filters[typeURL]...)
+	}
+	f.mu.RUnlock()
+
+	sort.SliceStable(all, func(i, j int) bool { return all[i].stage < all[j].stage })
+	out := make([]ResponseFilter, len(all))
+	for i, staged := range all {
+		out[i] = staged.filter
+	}
+	return out
+}
+
+// Apply runs the chain of the response type on a copy of the response, since
+// the cache shares the marshaled responses between the streams. The response
+// is returned as is without filters for its type.
+func (f *ResponseFilters) Apply(ctx context.Context, streamID int64, req *discovery.DiscoveryRequest, resp *discovery.DiscoveryResponse) (*discovery.DiscoveryResponse, error) {
+	chain := f.chain(resp.GetTypeUrl())
+	if len(chain) == 0 {
+		return resp, nil
+	}
+	out := proto.Clone(resp).(*discovery.DiscoveryResponse)
+	for _, filter := range chain {
+		var err error
+		if out, err = filter(ctx, streamID, req, out); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+type clientFeaturesKey struct{}
+
+func withClientFeatures(ctx context.Context, features cache.ClientFeatures) context.Context {
+	return context.WithValue(ctx, clientFeaturesKey{}, features)
+}
+
+// ClientFeatures returns the features advertised by the client of the stream
+// in the context of a response filter, so that the filters only use the
+// features the client supports.
+func ClientFeatures(ctx context.Context) cache.ClientFeatures {
+	features, _ := ctx.Value(clientFeaturesKey{}).(cache.ClientFeatures)
+	return features
+}
+
+// WithResponseFilters applies the filter chains to the responses before the
+// OnStreamResponse callback and the send.
+func WithResponseFilters(filters *ResponseFilters) ServerOption {
+	return func(s *server) {
+		s.filters = filters
+	}
+}
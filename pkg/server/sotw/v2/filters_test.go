@@ -0,0 +1,93 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package sotw
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	discovery "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/resource/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/wellknown"
+)
+
+func appendVersion(suffix string) ResponseFilter {
+	return func(_ context.Context, _ int64, _ *discovery.DiscoveryRequest, resp *discovery.DiscoveryResponse) (*discovery.DiscoveryResponse, error) {
+		resp.VersionInfo += suffix
+		return resp, nil
+	}
+}
+
+func TestResponseFilters(t *testing.T) {
+	filters := NewResponseFilters()
+	filters.Register(StageCompress, resource.ClusterType, appendVersion("-compress"))
+	filters.Register(StageRedact, resource.AnyType, appendVersion("-redact"))
+	filters.Register(StageTransform, resource.ClusterType, appendVersion("-transform1"), appendVersion("-transform2"))
+	filters.Register(StageAuthz, resource.ClusterType, appendVersion("-authz"))
+
+	in := &discovery.DiscoveryResponse{VersionInfo: "v", TypeUrl: resource.ClusterType}
+	out, err := filters.Apply(context.Background(), 1, nil, in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "v-authz-transform1-transform2-redact-compress"; out.VersionInfo != want {
+		t.Errorf("cluster chain => got %q, want %q", out.VersionInfo, want)
+	}
+	if in.VersionInfo != "v" {
+		t.Errorf("input response => got %q, want unmodified", in.VersionInfo)
+	}
+
+	out, err = filters.Apply(context.Background(), 1, nil, &discovery.DiscoveryResponse{VersionInfo: "v", TypeUrl: resource.RouteType})
+	if err != nil || out.VersionInfo != "v-redact" {
+		t.Errorf("route chain => got %v, %v, want v-redact", out, err)
+	}
+
+	unfiltered := &discovery.DiscoveryResponse{VersionInfo: "v", TypeUrl: resource.RouteType}
+	if out, _ := NewResponseFilters().Apply(context.Background(), 1, nil, unfiltered); out != unfiltered {
+		t.Errorf("empty chain => got %v, want the response", out)
+	}
+
+	denied := errors.New("denied")
+	filters.Register(StageAuthz, resource.RouteType, func(context.Context, int64, *discovery.DiscoveryRequest, *discovery.DiscoveryResponse) (*discovery.DiscoveryResponse, error) {
+		return nil, denied
+	})
+	if _, err := filters.Apply(context.Background(), 1, nil, &discovery.DiscoveryResponse{TypeUrl: resource.RouteType}); err != denied {
+		t.Errorf("denied route => got %v, want %v", err, denied)
+	}
+}
+
+func TestClientFeatures(t *testing.T) {
+	subs := newSubscriptions()
+	subs.setNode(&core.Node{ClientFeatures: []string{wellknown.ClientFeatureResourceTTL}})
+
+	var got cache.ClientFeatures
+	filters := NewResponseFilters()
+	filters.Register(StageTransform, resource.AnyType, func(ctx context.Context, _ int64, _ *discovery.DiscoveryRequest, resp *discovery.DiscoveryResponse) (*discovery.DiscoveryResponse, error) {
+		got = ClientFeatures(ctx)
+		return resp, nil
+	})
+	if _, err := filters.Apply(withClientFeatures(context.Background(), subs.features), 1, nil, &discovery.DiscoveryResponse{TypeUrl: resource.ClusterType}); err != nil {
+		t.Fatal(err)
+	}
+	if !got.Has(wellknown.ClientFeatureResourceTTL) {
+		t.Errorf("ClientFeatures() => got %v, want %s", got, wellknown.ClientFeatureResourceTTL)
+	}
+	if features := ClientFeatures(context.Background()); len(features) != 0 {
+		t.Errorf("ClientFeatures() without a stream => got %v, want none", features)
+	}
+}
@@ -0,0 +1,41 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package sotw
+
+import (
+	discovery "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/xdstp"
+)
+
+// canonicalNames rewrites the xdstp resource names of a request to their
+// canonical form, so that the caches see the same names regardless of the
+// order of the context params. The invalid xdstp names, and the names of
+// another resource type, are rejected. The legacy names are unchanged.
+func canonicalNames(req *discovery.DiscoveryRequest) error {
+	for i, name := range req.ResourceNames {
+		if !xdstp.IsXDSTP(name) {
+			continue
+		}
+		urn, err := xdstp.Parse(name)
+		if err != nil {
+			return ProtocolError(name, "%v", err)
+		}
+		if urn.TypeURL() != req.TypeUrl {
+			return ProtocolError(name, "resource %q is not of the requested type %s", name, req.TypeUrl)
+		}
+		req.ResourceNames[i] = urn.String()
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package sotw
+
+import (
+	"github.com/envoyproxy/go-control-plane/pkg/cache/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/resource/v2"
+)
+
+// WithOrderedADS sends the pending responses of the ADS streams in the
+// make-before-break order of the xDS protocol: the clusters, the endpoints,
+// the listeners and then the routes, so that a resource does not reach the
+// client before the resources it references. The secrets are still sent
+// first, and the other types after these.
+//
+// The server only orders the responses pending at the same time. The
+// snapshot cache holds the later types until the earlier ones are
+// acknowledged, see cache.WithOrderedADS.
+func WithOrderedADS() ServerOption {
+	return func(s *server) {
+		s.orderedADS = true
+	}
+}
+
+// sendOrdered sends the first pending response in the make-before-break
+// order, if any.
+func sendOrdered(values *watches, sendTyped func(string, cache.Response, bool, *string) error) (bool, error) {
+	for _, pending := range []struct {
+		typeURL string
+		watch   chan cache.Response
+		nonce   *string
+	}{
+		{resource.ClusterType, values.clusters, &values.clusterNonce},
+		{resource.EndpointType, values.endpoints, &values.endpointNonce},
+		{resource.ListenerType, values.listeners, &values.listenerNonce},
+		{resource.RouteType, values.routes, &values.routeNonce},
+	} {
+		select {
+		case resp, more := <-pending.watch:
+			return true, sendTyped(pending.typeURL, resp, more, pending.nonce)
+		default:
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,221 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package sotw
+
+import (
+	"time"
+
+	discovery "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+)
+
+// WithResponseRateLimit limits the responses of each stream to the rate per
+// second with a burst, so that rapid snapshot updates do not flood the slow
+// clients with every intermediate version.
+//
+// A response is sent once per watch, so the limit holds the requests opening
+// the watches, i.e. the acknowledgements, until a token is available. The
+// watches opened later respond with the latest version, which skips the
+// intermediate ones. A held request is replaced by a newer request of its
+// type.
+func WithResponseRateLimit(rate float64, burst int) ServerOption {
+	return func(s *server) {
+		s.limits.ResponseRate = rate
+		s.limits.ResponseBurst = burst
+	}
+}
+
+// WithRequestRateLimit limits the requests of each stream to the rate per
+// second with a burst, which protects the server from the clients sending
+// requests in a tight loop. The streams exceeding the limit are closed with
+// the ResourceExhausted status and reported to the function with their node
+// ID, so that the misbehaving clients can be identified.
+func WithRequestRateLimit(rate float64, burst int, onFlood func(streamID int64, node string)) ServerOption {
+	return func(s *server) {
+		s.limits.RequestRate = rate
+		s.limits.RequestBurst = burst
+		s.onFlood = onFlood
+	}
+}
+
+// Limits are the rate limits and the response buffer of the streams, as set
+// by WithResponseRateLimit, WithRequestRateLimit and WithMuxBufferSize. A zero
+// rate disables its limit.
+type Limits struct {
+	ResponseRate  float64
+	ResponseBurst int
+
+	RequestRate  float64
+	RequestBurst int
+
+	MuxBufferSize int
+}
+
+// Limits returns the current limits of the streams.
+func (s *server) Limits() Limits {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.limits
+}
+
+// SetLimits replaces the limits of the streams opened from now on. The open
+// streams keep the limits they were opened with, e.g. until they reach the
+// max stream age. A mux buffer size below 1 keeps the current size.
+func (s *server) SetLimits(limits Limits) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if limits.MuxBufferSize < 1 {
+		limits.MuxBufferSize = s.limits.MuxBufferSize
+	}
+	s.limits = limits
+}
+
+// tokenBucket is a token bucket refilled at a rate per second up to a burst.
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int, now time.Time) *tokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst), last: now}
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+}
+
+// take takes a token if available.
+func (b *tokenBucket) take(now time.Time) bool {
+	b.refill(now)
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// wait returns the time until a token is available.
+func (b *tokenBucket) wait(now time.Time) time.Duration {
+	b.refill(now)
+	if b.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
+
+// heldRequest is a request held by the response rate limit.
+type heldRequest struct {
+	req   *discovery.DiscoveryRequest
+	nonce string
+}
+
+// responseLimiter holds the requests of a stream exceeding the response rate
+// limit, in the arrival order of their types.
+type responseLimiter struct {
+	bucket *tokenBucket
+	order  []string
+	held   map[string]heldRequest
+	timer  *time.Timer
+	armed  bool
+}
+
+func newResponseLimiter(rate float64, burst int) *responseLimiter {
+	return &responseLimiter{
+		bucket: newTokenBucket(rate, burst, time.Now()),
+		held:   make(map[string]heldRequest),
+	}
+}
+
+// admit takes a token for the request, or holds the request until release.
+func (l *responseLimiter) admit(req *discovery.DiscoveryRequest, nonce string) bool {
+	if _, exists := l.held[req.TypeUrl]; exists {
+		l.held[req.TypeUrl] = heldRequest{req: req, nonce: nonce}
+		return false
+	}
+	if len(l.order) == 0 && l.bucket.take(time.Now()) {
+		return true
+	}
+	l.order = append(l.order, req.TypeUrl)
+	l.held[req.TypeUrl] = heldRequest{req: req, nonce: nonce}
+	l.arm()
+	return false
+}
+
+// drop forgets the held request of a type, e.g. once the type is
+// unsubscribed.
+func (l *responseLimiter) drop(typeURL string) {
+	if _, exists := l.held[typeURL]; !exists {
+		return
+	}
+	delete(l.held, typeURL)
+	for i, held := range l.order {
+		if held == typeURL {
+			l.order = append(l.order[:i], l.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// release returns the held requests taking the available tokens.
+func (l *responseLimiter) release() []heldRequest {
+	l.armed = false
+	var out []heldRequest
+	now := time.Now()
+	for len(l.order) > 0 && l.bucket.take(now) {
+		out = append(out, l.held[l.order[0]])
+		delete(l.held, l.order[0])
+		l.order = l.order[1:]
+	}
+	if len(l.order) > 0 {
+		l.arm()
+	}
+	return out
+}
+
+func (l *responseLimiter) arm() {
+	if l.armed {
+		return
+	}
+	wait := l.bucket.wait(time.Now())
+	if l.timer == nil {
+		l.timer = time.NewTimer(wait)
+	} else {
+		l.timer.Reset(wait)
+	}
+	l.armed = true
+}
+
+// ready is signaled once a held request may take a token, and is nil when no
+// request is held.
+func (l *responseLimiter) ready() <-chan time.Time {
+	if l == nil || !l.armed {
+		return nil
+	}
+	return l.timer.C
+}
+
+func (l *responseLimiter) stop() {
+	if l != nil && l.timer != nil {
+		l.timer.Stop()
+	}
+}
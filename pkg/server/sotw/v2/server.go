@@ -18,8 +18,13 @@ package sotw
 import (
 	"context"
 	"errors"
+	"math/rand"
+	"runtime/pprof"
+	"runtime/trace"
 	"strconv"
+	"sync"
 	"sync/atomic"
+	"time"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
@@ -28,11 +33,24 @@ import (
 	discovery "github.com/envoyproxy/go-control-plane/envoy/api/v2"
 	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
 	"github.com/envoyproxy/go-control-plane/pkg/cache/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/log"
 	"github.com/envoyproxy/go-control-plane/pkg/resource/v2"
 )
 
 type Server interface {
 	StreamHandler(stream Stream, typeURL string) error
+
+	// DisconnectNode terminates all open streams for the node ID with the given
+	// gRPC status after an optional delay, and returns the number of streams
+	// affected. It is used to evict a node from this server, e.g. once its
+	// snapshot is owned by another control plane replica.
+	DisconnectNode(node string, st *status.Status, delay time.Duration) int
+
+	// Limits returns the current limits of the streams, and SetLimits replaces
+	// them for the streams opened afterwards, e.g. from the settings served by
+	// a cache.SelfConfig.
+	Limits() Limits
+	SetLimits(Limits)
 }
 
 type Callbacks interface {
@@ -49,17 +67,136 @@ type Callbacks interface {
 }
 
 // NewServer creates handlers from a config watcher and callbacks.
-func NewServer(ctx context.Context, config cache.ConfigWatcher, callbacks Callbacks) Server {
-	return &server{cache: config, callbacks: callbacks, ctx: ctx}
+func NewServer(ctx context.Context, config cache.ConfigWatcher, callbacks Callbacks, opts ...ServerOption) Server {
+	s := &server{cache: config, callbacks: callbacks, ctx: ctx, streams: make(map[int64]*streamInfo), log: log.LoggerFuncs{}}
+	s.limits.MuxBufferSize = DefaultMuxBufferSize
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// ServerOption sets a server option.
+type ServerOption func(*server)
+
+// WithTypeIsolation confines the failures of a type on the ADS streams, e.g.
+// a closed watch or a resource failing to marshal, to the type: the watch of
+// the type is cancelled and the failure is reported to the function, while
+// the other types are still served. A new request for the type opens a new
+// watch. The failures close the stream by default.
+func WithTypeIsolation(onFailure func(streamID int64, typeURL string, err error)) ServerOption {
+	return func(s *server) {
+		s.onTypeFailure = onFailure
+	}
+}
+
+// WithLogger sets the logger of the server. The stream logs carry the stream
+// ID, the node ID once known and the type URL of the requests as fields, see
+// log.With. A nil logger keeps the default logger discarding the logs.
+func WithLogger(logger log.Logger) ServerOption {
+	return func(s *server) {
+		if logger != nil {
+			s.log = logger
+		}
+	}
+}
+
+// DefaultMuxBufferSize is the default buffer of the muxed responses.
+const DefaultMuxBufferSize = 5
+
+// WithMuxBufferSize sets the buffer of the responses to the types without a
+// dedicated watch on a stream, i.e. the types other than the endpoints, the
+// clusters, the routes, the listeners, the secrets and the runtimes. The
+// watches of these types block on a full buffer until the stream sends the
+// buffered responses, so the buffer should fit a response of each such type
+// requested over ADS.
+func WithMuxBufferSize(size int) ServerOption {
+	return func(s *server) {
+		s.limits.MuxBufferSize = size
+	}
+}
+
+// WithMaxStreamAge closes the streams older than the max age plus a random
+// jitter with the Unavailable status, so that the clients reconnect and the
+// long-lived connections rebalance across the replicas of the control plane
+// behind a load balancer. The jitter spreads the reconnections of the
+// streams open at the same time, e.g. after a rollout. The clients keep their
+// configuration and resume from their last versions on the new stream.
+func WithMaxStreamAge(maxAge, jitter time.Duration) ServerOption {
+	return func(s *server) {
+		s.maxStreamAge = maxAge
+		s.maxStreamAgeJitter = jitter
+	}
+}
+
+// SlowPolicy is the handling of the sends exceeding the send timeout.
+type SlowPolicy int
+
+const (
+	// SlowWait keeps waiting for the send to complete. The responses of the
+	// other types wait in their watches.
+	SlowWait SlowPolicy = iota
+
+	// SlowTerminate closes the stream with the DeadlineExceeded status, so
+	// that the client reconnects and the watches of the stream are released.
+	// Since gRPC forbids the sends once the stream handler returns, the stream
+	// is closed once the pending send returns, and no other response is sent
+	// meanwhile. The send only returns once the client reads the response or
+	// the connection closes, so the policy is meant to be paired with a
+	// server closing the connections at an age, see the MaxConnectionAge and
+	// MaxConnectionAgeGrace keepalive parameters.
+	SlowTerminate
+)
+
+// WithSendTimeout reports the responses not sent within the timeout, e.g.
+// to a client not reading the stream or over a congested connection, to the
+// function and handles them with the policy. Each send runs in a separate
+// goroutine with the timeout.
+func WithSendTimeout(timeout time.Duration, policy SlowPolicy, onSlow func(streamID int64, typeURL string)) ServerOption {
+	return func(s *server) {
+		s.sendTimeout = timeout
+		s.slowPolicy = policy
+		s.onSlow = onSlow
+	}
 }
 
 type server struct {
-	cache     cache.ConfigWatcher
-	callbacks Callbacks
-	ctx       context.Context
+	cache         cache.ConfigWatcher
+	callbacks     Callbacks
+	ctx           context.Context
+	onTypeFailure func(int64, string, error)
+	filters       *ResponseFilters
+
+	maxStreamAge       time.Duration
+	maxStreamAgeJitter time.Duration
+
+	sendTimeout time.Duration
+	slowPolicy  SlowPolicy
+	onSlow      func(int64, string)
+
+	// limits are guarded by the mutex, and read once per stream
+	limits  Limits
+	onFlood func(int64, string)
+
+	orderedADS bool
+
+	log log.Logger
 
 	// streamCount for counting bi-di streams
 	streamCount int64
+
+	// streams are the open streams indexed by stream ID.
+	streams map[int64]*streamInfo
+	mu      sync.Mutex
+}
+
+// streamInfo tracks an open stream for out-of-band termination.
+type streamInfo struct {
+	// node is the node ID set by the first discovery request.
+	node string
+
+	// disconnect carries the termination error for the stream.
+	disconnect chan error
 }
 
 // Generic RPC stream.
@@ -101,16 +238,24 @@ type watches struct {
 }
 
 // Initialize all watches
-func (values *watches) Init() {
+func (values *watches) Init(muxBufferSize int) {
 	// muxed channel needs a buffer to release go-routines populating it
-	values.responses = make(chan cache.Response, 5)
+	values.responses = make(chan cache.Response, muxBufferSize)
 	values.cancellations = make(map[string]func())
 	values.nonces = make(map[string]string)
 	values.terminations = make(map[string]chan struct{})
 }
 
-// Token response value used to signal a watch failure in muxed watches.
-var errorResponse = &cache.RawResponse{}
+// watchFailure signals the failure of a muxed watch.
+type watchFailure struct {
+	cache.Response
+	typeURL string
+}
+
+// typeFailure is a failure confined to a type, see WithTypeIsolation.
+type typeFailure struct {
+	error
+}
 
 // Cancel all watches
 func (values *watches) Cancel() {
@@ -143,17 +288,61 @@ func (values *watches) Cancel() {
 }
 
 // process handles a bi-di stream request
-func (s *server) process(stream Stream, reqCh <-chan *discovery.DiscoveryRequest, defaultTypeURL string) error {
+func (s *server) process(stream Stream, reqCh <-chan *discovery.DiscoveryRequest, defaultTypeURL string) (err error) {
 	// increment stream count
 	streamID := atomic.AddInt64(&s.streamCount, 1)
 
+	// node may only be set on the first discovery request
+	var node = &core.Node{}
+	var nodeID string
+
+	// the terminal statuses carry the stream, the node and the last type,
+	// including the statuses of the callbacks opening the stream
+	lastTypeURL := defaultTypeURL
+	defer func() {
+		err = withRequestInfo(err, streamID, node.GetId(), lastTypeURL)
+	}()
+
+	// register the stream to allow disconnecting it by the node ID
+	disconnect := make(chan error, 1)
+	s.mu.Lock()
+	s.streams[streamID] = &streamInfo{disconnect: disconnect}
+	limits := s.limits
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.streams, streamID)
+		s.mu.Unlock()
+	}()
+	if s.maxStreamAge > 0 {
+		age := s.maxStreamAge
+		if s.maxStreamAgeJitter > 0 {
+			age += time.Duration(rand.Int63n(int64(s.maxStreamAgeJitter)))
+		}
+		expiry := time.AfterFunc(age, func() {
+			select {
+			case disconnect <- RetryError(codes.Unavailable, 0, "stream max age reached"):
+			default:
+			}
+		})
+		defer expiry.Stop()
+	}
+
+	// the stream logs identify the stream, and the node once known
+	logger := log.With(s.log, log.StreamIDKey, streamID)
+
 	// unique nonce generator for req-resp pairs per xDS stream; the server
 	// ignores stale nonces. nonce is only modified within send() function.
 	var streamNonce int64
 
+	// profiling labels attribute the stream cost to the types and the nodes
+	labels := pprof.WithLabels(stream.Context(), pprof.Labels("stream_type", defaultTypeURL))
+	pprof.SetGoroutineLabels(labels)
+	defer pprof.SetGoroutineLabels(stream.Context())
+
 	// a collection of stack allocated watches per request type
 	var values watches
-	values.Init()
+	values.Init(limits.MuxBufferSize)
 	defer func() {
 		values.Cancel()
 		if s.callbacks != nil {
@@ -161,109 +350,192 @@ func (s *server) process(stream Stream, reqCh <-chan *discovery.DiscoveryRequest
 		}
 	}()
 
+	// wildcard subscription state and client features depend on the node
+	subs := newSubscriptions()
+
 	// sends a response by serializing to protobuf Any
 	send := func(resp cache.Response, typeURL string) (string, error) {
 		if resp == nil {
 			return "", errors.New("missing response")
 		}
 
-		out, err := resp.GetDiscoveryResponse()
+		var nonce string
+		var err error
+		pprof.Do(labels, pprof.Labels("type_url", typeURL), func(ctx context.Context) {
+			defer trace.StartRegion(ctx, "xds.send").End()
+			if trace.IsEnabled() {
+				trace.Log(ctx, "type_url", typeURL)
+			}
+
+			var out *discovery.DiscoveryResponse
+			if out, err = resp.GetDiscoveryResponse(); err != nil {
+				err = typeFailure{err}
+				return
+			}
+			if s.filters != nil {
+				if out, err = s.filters.Apply(withClientFeatures(stream.Context(), subs.features), streamID, resp.GetRequest(), out); err != nil {
+					err = typeFailure{err}
+					return
+				}
+			}
+
+			// increment nonce
+			streamNonce = streamNonce + 1
+			out.Nonce = strconv.FormatInt(streamNonce, 10)
+			nonce = out.Nonce
+			if s.callbacks != nil {
+				s.callbacks.OnStreamResponse(streamID, resp.GetRequest(), out)
+			}
+			err = s.sendResponse(stream, streamID, typeURL, out)
+		})
+		return nonce, err
+	}
+
+	if s.callbacks != nil {
+		if err := s.callbacks.OnStreamOpen(stream.Context(), streamID, defaultTypeURL); err != nil {
+			return err
+		}
+	}
+	logger.Debugf("stream opened for type %q", defaultTypeURL)
+	defer func() {
 		if err != nil {
-			return "", err
+			logger.Infof("stream closed: %v", err)
+		} else {
+			logger.Debugf("stream closed")
 		}
+	}()
 
-		// increment nonce
-		streamNonce = streamNonce + 1
-		out.Nonce = strconv.FormatInt(streamNonce, 10)
-		if s.callbacks != nil {
-			s.callbacks.OnStreamResponse(streamID, resp.GetRequest(), out)
+	// isolate cancels the watch of a failed type on ADS streams with the type
+	// isolation, or returns the error to close the stream
+	isolate := func(typeURL string, err error) error {
+		failure, ok := err.(typeFailure)
+		if !ok {
+			return err
+		}
+		if s.onTypeFailure == nil || defaultTypeURL != resource.AnyType {
+			return failure.error
 		}
-		return out.Nonce, stream.Send(out)
+		values.cancelType(typeURL)
+		log.With(logger, log.TypeURLKey, typeURL).Warnf("type failure isolated: %v", failure.error)
+		s.onTypeFailure(streamID, typeURL, failure.error)
+		return nil
 	}
 
-	if s.callbacks != nil {
-		if err := s.callbacks.OnStreamOpen(stream.Context(), streamID, defaultTypeURL); err != nil {
+	// the requests exceeding the response rate limit are held
+	var limiter *responseLimiter
+	if limits.ResponseRate > 0 {
+		limiter = newResponseLimiter(limits.ResponseRate, limits.ResponseBurst)
+		defer limiter.stop()
+	}
+
+	var requests *tokenBucket
+	if limits.RequestRate > 0 {
+		requests = newTokenBucket(limits.RequestRate, limits.RequestBurst, time.Now())
+	}
+
+	// sends a pending secrets response
+	sendSecrets := func(resp cache.Response, more bool) error {
+		if !more {
+			return typeFailure{status.Errorf(codes.Unavailable, "secrets watch failed")}
+		}
+		nonce, err := send(resp, resource.SecretType)
+		if err != nil {
 			return err
 		}
+		values.secretNonce = nonce
+		return nil
 	}
 
-	// node may only be set on the first discovery request
-	var node = &core.Node{}
+	// sends a pending response of a type with a dedicated watch
+	sendTyped := func(typeURL string, resp cache.Response, more bool, nonce *string) error {
+		if !more {
+			return isolate(typeURL, typeFailure{status.Errorf(codes.Unavailable, "%s watch failed", watchNames[typeURL])})
+		}
+		n, err := send(resp, typeURL)
+		if err != nil {
+			return isolate(typeURL, err)
+		}
+		*nonce = n
+		return nil
+	}
 
 	for {
+		// a pending secrets response is sent ahead of the other pending types,
+		// regardless of the certificate expiry
+		select {
+		case resp, more := <-values.secrets:
+			if err := isolate(resource.SecretType, sendSecrets(resp, more)); err != nil {
+				return err
+			}
+			continue
+		default:
+		}
+
+		if s.orderedADS && defaultTypeURL == resource.AnyType {
+			sent, err := sendOrdered(&values, sendTyped)
+			if err != nil {
+				return err
+			}
+			if sent {
+				continue
+			}
+		}
+
 		select {
 		case <-s.ctx.Done():
 			return nil
+		case err := <-disconnect:
+			return err
+		case <-limiter.ready():
+			for _, held := range limiter.release() {
+				s.watch(&values, held.req, held.nonce)
+			}
 		// config watcher can send the requested resources types in any order
 		case resp, more := <-values.endpoints:
-			if !more {
-				return status.Errorf(codes.Unavailable, "endpoints watch failed")
-			}
-			nonce, err := send(resp, resource.EndpointType)
-			if err != nil {
+			if err := sendTyped(resource.EndpointType, resp, more, &values.endpointNonce); err != nil {
 				return err
 			}
-			values.endpointNonce = nonce
 
 		case resp, more := <-values.clusters:
-			if !more {
-				return status.Errorf(codes.Unavailable, "clusters watch failed")
-			}
-			nonce, err := send(resp, resource.ClusterType)
-			if err != nil {
+			if err := sendTyped(resource.ClusterType, resp, more, &values.clusterNonce); err != nil {
 				return err
 			}
-			values.clusterNonce = nonce
 
 		case resp, more := <-values.routes:
-			if !more {
-				return status.Errorf(codes.Unavailable, "routes watch failed")
-			}
-			nonce, err := send(resp, resource.RouteType)
-			if err != nil {
+			if err := sendTyped(resource.RouteType, resp, more, &values.routeNonce); err != nil {
 				return err
 			}
-			values.routeNonce = nonce
 
 		case resp, more := <-values.listeners:
-			if !more {
-				return status.Errorf(codes.Unavailable, "listeners watch failed")
-			}
-			nonce, err := send(resp, resource.ListenerType)
-			if err != nil {
+			if err := sendTyped(resource.ListenerType, resp, more, &values.listenerNonce); err != nil {
 				return err
 			}
-			values.listenerNonce = nonce
 
 		case resp, more := <-values.secrets:
-			if !more {
-				return status.Errorf(codes.Unavailable, "secrets watch failed")
-			}
-			nonce, err := send(resp, resource.SecretType)
-			if err != nil {
+			if err := isolate(resource.SecretType, sendSecrets(resp, more)); err != nil {
 				return err
 			}
-			values.secretNonce = nonce
 
 		case resp, more := <-values.runtimes:
-			if !more {
-				return status.Errorf(codes.Unavailable, "runtimes watch failed")
-			}
-			nonce, err := send(resp, resource.RuntimeType)
-			if err != nil {
+			if err := sendTyped(resource.RuntimeType, resp, more, &values.runtimeNonce); err != nil {
 				return err
 			}
-			values.runtimeNonce = nonce
 
 		case resp, more := <-values.responses:
 			if more {
-				if resp == errorResponse {
-					return status.Errorf(codes.Unavailable, "resource watch failed")
+				if failure, ok := resp.(watchFailure); ok {
+					if err := isolate(failure.typeURL, typeFailure{status.Errorf(codes.Unavailable, "resource watch failed")}); err != nil {
+						return err
+					}
+					continue
 				}
 				typeUrl := resp.GetRequest().TypeUrl
 				nonce, err := send(resp, typeUrl)
 				if err != nil {
-					return err
+					if err := isolate(typeUrl, err); err != nil {
+						return err
+					}
+					continue
 				}
 				values.nonces[typeUrl] = nonce
 			}
@@ -280,21 +552,30 @@ func (s *server) process(stream Stream, reqCh <-chan *discovery.DiscoveryRequest
 			// node field in discovery request is delta-compressed
 			if req.Node != nil {
 				node = req.Node
+				subs.setNode(node)
 			} else {
 				req.Node = node
 			}
 
+			if requests != nil && !requests.take(time.Now()) {
+				if s.onFlood != nil {
+					s.onFlood(streamID, node.Id)
+				}
+				return RetryError(codes.ResourceExhausted, time.Duration(float64(time.Second)/limits.RequestRate), "request rate limit of %v per second exceeded", limits.RequestRate)
+			}
+
 			// nonces can be reused across streams; we verify nonce only if nonce is not initialized
 			nonce := req.GetResponseNonce()
 
 			// type URL is required for ADS but is implicit for xDS
 			if defaultTypeURL == resource.AnyType {
 				if req.TypeUrl == "" {
-					return status.Errorf(codes.InvalidArgument, "type URL is required for ADS")
+					return ProtocolError("type_url", "type URL is required for ADS")
 				}
 			} else if req.TypeUrl == "" {
 				req.TypeUrl = defaultTypeURL
 			}
+			lastTypeURL = req.TypeUrl
 
 			if s.callbacks != nil {
 				if err := s.callbacks.OnStreamRequest(streamID, req); err != nil {
@@ -302,92 +583,193 @@ func (s *server) process(stream Stream, reqCh <-chan *discovery.DiscoveryRequest
 				}
 			}
 
-			// cancel existing watches to (re-)request a newer version
-			switch {
-			case req.TypeUrl == resource.EndpointType:
-				if values.endpointNonce == "" || values.endpointNonce == nonce {
-					if values.endpointCancel != nil {
-						values.endpointCancel()
-					}
-					values.endpoints, values.endpointCancel = s.cache.CreateWatch(req)
-				}
-			case req.TypeUrl == resource.ClusterType:
-				if values.clusterNonce == "" || values.clusterNonce == nonce {
-					if values.clusterCancel != nil {
-						values.clusterCancel()
-					}
-					values.clusters, values.clusterCancel = s.cache.CreateWatch(req)
-				}
-			case req.TypeUrl == resource.RouteType:
-				if values.routeNonce == "" || values.routeNonce == nonce {
-					if values.routeCancel != nil {
-						values.routeCancel()
-					}
-					values.routes, values.routeCancel = s.cache.CreateWatch(req)
-				}
-			case req.TypeUrl == resource.ListenerType:
-				if values.listenerNonce == "" || values.listenerNonce == nonce {
-					if values.listenerCancel != nil {
-						values.listenerCancel()
-					}
-					values.listeners, values.listenerCancel = s.cache.CreateWatch(req)
-				}
-			case req.TypeUrl == resource.SecretType:
-				if values.secretNonce == "" || values.secretNonce == nonce {
-					if values.secretCancel != nil {
-						values.secretCancel()
-					}
-					values.secrets, values.secretCancel = s.cache.CreateWatch(req)
-				}
-			case req.TypeUrl == resource.RuntimeType:
-				if values.runtimeNonce == "" || values.runtimeNonce == nonce {
-					if values.runtimeCancel != nil {
-						values.runtimeCancel()
-					}
-					values.runtimes, values.runtimeCancel = s.cache.CreateWatch(req)
+			// the node ID is registered once the callbacks may have rewritten it
+			if node.Id != nodeID {
+				nodeID = node.Id
+				s.mu.Lock()
+				s.streams[streamID].node = nodeID
+				s.mu.Unlock()
+				labels = pprof.WithLabels(labels, pprof.Labels("node", nodeID))
+				pprof.SetGoroutineLabels(labels)
+				logger = log.With(s.log, log.StreamIDKey, streamID, log.NodeIDKey, nodeID)
+			}
+
+			if req.ErrorDetail != nil {
+				log.With(logger, log.TypeURLKey, req.TypeUrl).Warnf("NACK of version %q: %s", req.VersionInfo, req.ErrorDetail.GetMessage())
+			} else {
+				log.With(logger, log.TypeURLKey, req.TypeUrl).Debugf("request version %q nonce %q for %v", req.VersionInfo, nonce, req.ResourceNames)
+			}
+
+			if err := canonicalNames(req); err != nil {
+				return err
+			}
+			if !subs.normalize(req) {
+				values.cancelType(req.TypeUrl)
+				if limiter != nil {
+					limiter.drop(req.TypeUrl)
 				}
-			default:
-				typeUrl := req.TypeUrl
-				responseNonce, seen := values.nonces[typeUrl]
-				if !seen || responseNonce == nonce {
-					// We must signal goroutine termination to prevent a race between the cancel closing the watch
-					// and the producer closing the watch.
-					if terminate, exists := values.terminations[typeUrl]; exists {
-						close(terminate)
-					}
-					if cancel, seen := values.cancellations[typeUrl]; seen && cancel != nil {
-						cancel()
-					}
-					var watch chan cache.Response
-					watch, values.cancellations[typeUrl] = s.cache.CreateWatch(req)
-					// Muxing watches across multiple type URLs onto a single channel requires spawning
-					// a go-routine. Golang does not allow selecting over a dynamic set of channels.
-					terminate := make(chan struct{})
-					values.terminations[typeUrl] = terminate
-					go func() {
+				continue
+			}
+
+			if limiter != nil && !limiter.admit(req, nonce) {
+				continue
+			}
+			s.watch(&values, req, nonce)
+		}
+	}
+}
+
+// watch cancels the existing watch of the request type to (re-)request a
+// newer version, unless the request nonce is stale.
+func (s *server) watch(values *watches, req *discovery.DiscoveryRequest, nonce string) {
+	switch {
+	case req.TypeUrl == resource.EndpointType:
+		if values.endpointNonce == "" || values.endpointNonce == nonce {
+			if values.endpointCancel != nil {
+				values.endpointCancel()
+			}
+			values.endpoints, values.endpointCancel = s.cache.CreateWatch(req)
+		}
+	case req.TypeUrl == resource.ClusterType:
+		if values.clusterNonce == "" || values.clusterNonce == nonce {
+			if values.clusterCancel != nil {
+				values.clusterCancel()
+			}
+			values.clusters, values.clusterCancel = s.cache.CreateWatch(req)
+		}
+	case req.TypeUrl == resource.RouteType:
+		if values.routeNonce == "" || values.routeNonce == nonce {
+			if values.routeCancel != nil {
+				values.routeCancel()
+			}
+			values.routes, values.routeCancel = s.cache.CreateWatch(req)
+		}
+	case req.TypeUrl == resource.ListenerType:
+		if values.listenerNonce == "" || values.listenerNonce == nonce {
+			if values.listenerCancel != nil {
+				values.listenerCancel()
+			}
+			values.listeners, values.listenerCancel = s.cache.CreateWatch(req)
+		}
+	case req.TypeUrl == resource.SecretType:
+		if values.secretNonce == "" || values.secretNonce == nonce {
+			if values.secretCancel != nil {
+				values.secretCancel()
+			}
+			values.secrets, values.secretCancel = s.cache.CreateWatch(req)
+		}
+	case req.TypeUrl == resource.RuntimeType:
+		if values.runtimeNonce == "" || values.runtimeNonce == nonce {
+			if values.runtimeCancel != nil {
+				values.runtimeCancel()
+			}
+			values.runtimes, values.runtimeCancel = s.cache.CreateWatch(req)
+		}
+	default:
+		typeUrl := req.TypeUrl
+		responseNonce, seen := values.nonces[typeUrl]
+		if !seen || responseNonce == nonce {
+			// We must signal goroutine termination to prevent a race between the cancel closing the watch
+			// and the producer closing the watch.
+			if terminate, exists := values.terminations[typeUrl]; exists {
+				close(terminate)
+			}
+			if cancel, seen := values.cancellations[typeUrl]; seen && cancel != nil {
+				cancel()
+			}
+			var watch chan cache.Response
+			watch, values.cancellations[typeUrl] = s.cache.CreateWatch(req)
+			// Muxing watches across multiple type URLs onto a single channel requires spawning
+			// a go-routine. Golang does not allow selecting over a dynamic set of channels.
+			terminate := make(chan struct{})
+			values.terminations[typeUrl] = terminate
+			go func() {
+				select {
+				case resp, more := <-watch:
+					if more {
+						values.responses <- resp
+					} else {
+						// Check again if the watch is cancelled.
 						select {
-						case resp, more := <-watch:
-							if more {
-								values.responses <- resp
-							} else {
-								// Check again if the watch is cancelled.
-								select {
-								case <-terminate: // do nothing
-								default:
-									// We cannot close the responses channel since it can be closed twice.
-									// Instead we send a fake error response.
-									values.responses <- errorResponse
-								}
-							}
-							break
-						case <-terminate:
-							break
+						case <-terminate: // do nothing
+						default:
+							// We cannot close the responses channel since it can be closed twice.
+							// Instead we send a fake error response.
+							values.responses <- watchFailure{typeURL: typeUrl}
 						}
-					}()
+					}
+					break
+				case <-terminate:
+					break
 				}
+			}()
+		}
+	}
+}
+
+// watchNames name the types with a dedicated watch in the watch failures.
+var watchNames = map[string]string{
+	resource.EndpointType: "endpoints",
+	resource.ClusterType:  "clusters",
+	resource.RouteType:    "routes",
+	resource.ListenerType: "listeners",
+	resource.RuntimeType:  "runtimes",
+}
+
+// sendResponse sends a response on the stream within the send timeout, if
+// set, or handles the slow send with the policy.
+func (s *server) sendResponse(stream Stream, streamID int64, typeURL string, out *discovery.DiscoveryResponse) error {
+	if s.sendTimeout <= 0 {
+		return stream.Send(out)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- stream.Send(out)
+	}()
+	timer := time.NewTimer(s.sendTimeout)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		return err
+	case <-timer.C:
+	}
+
+	if s.onSlow != nil {
+		s.onSlow(streamID, typeURL)
+	}
+	err := <-done
+	if s.slowPolicy == SlowTerminate {
+		return status.Errorf(codes.DeadlineExceeded, "response for %s not sent within %v", typeURL, s.sendTimeout)
+	}
+	return err
+}
+
+// DisconnectNode closes all streams for the node ID with the status.
+func (s *server) DisconnectNode(node string, st *status.Status, delay time.Duration) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	count := 0
+	for _, info := range s.streams {
+		if info.node != node {
+			continue
+		}
+		count++
+		disconnect := info.disconnect
+		terminate := func() {
+			// the stream is terminated by the first disconnect request
+			select {
+			case disconnect <- st.Err():
+			default:
 			}
 		}
+		if delay > 0 {
+			time.AfterFunc(delay, terminate)
+		} else {
+			terminate()
+		}
 	}
+	return count
 }
 
 // StreamHandler converts a blocking read call to channels and initiates stream processing
@@ -0,0 +1,139 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package sotw
+
+import (
+	discovery "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/resource/v2"
+)
+
+// WildcardResource is the resource name used by newer clients to subscribe to
+// all resources of a type.
+const WildcardResource = "*"
+
+// Envoy releases starting with this version request the wildcard explicitly,
+// and an empty list of names after a named subscription means that the client
+// is no longer interested in any resource of the type.
+const (
+	explicitWildcardMajor = 1
+	explicitWildcardMinor = 19
+)
+
+// ExplicitWildcard detects from the node build version whether the client
+// requests the wildcard with the "*" resource name. Older clients and clients
+// without a build version express the wildcard only with empty resource names.
+func ExplicitWildcard(node *core.Node) bool {
+	if node.GetUserAgentName() != "envoy" {
+		return false
+	}
+	version := node.GetUserAgentBuildVersion().GetVersion()
+	if version == nil {
+		return false
+	}
+	major, minor := version.GetMajorNumber(), version.GetMinorNumber()
+	return major > explicitWildcardMajor || (major == explicitWildcardMajor && minor >= explicitWildcardMinor)
+}
+
+// subscriptions tracks the wildcard state of a stream by type URL.
+type subscriptions struct {
+	// explicit is set for the clients requesting the wildcard with "*".
+	explicit bool
+
+	// features are the client features advertised by the node.
+	features cache.ClientFeatures
+
+	// named records type URLs with a subscription to specific resource names.
+	named map[string]bool
+}
+
+func newSubscriptions() *subscriptions {
+	return &subscriptions{named: make(map[string]bool)}
+}
+
+// setNode updates the client behavior detection from the node.
+func (subs *subscriptions) setNode(node *core.Node) {
+	subs.explicit = ExplicitWildcard(node)
+	subs.features = cache.NewClientFeatures(node)
+}
+
+// normalize rewrites the request resource names to the cache convention, in
+// which empty names stand for the wildcard. It returns false if the request
+// unsubscribes from all resources of the type and no watch should be open.
+func (subs *subscriptions) normalize(req *discovery.DiscoveryRequest) bool {
+	for _, name := range req.ResourceNames {
+		if name == WildcardResource {
+			// the wildcard subsumes any other names in the request
+			req.ResourceNames = nil
+			delete(subs.named, req.TypeUrl)
+			return true
+		}
+	}
+
+	if len(req.ResourceNames) > 0 {
+		subs.named[req.TypeUrl] = true
+		return true
+	}
+
+	// empty names after a named subscription remove all resources for newer
+	// clients, but always mean the wildcard for the legacy ones
+	return !subs.explicit || !subs.named[req.TypeUrl]
+}
+
+// cancelType cancels the open watch for a type URL.
+func (values *watches) cancelType(typeURL string) {
+	switch typeURL {
+	case resource.EndpointType:
+		if values.endpointCancel != nil {
+			values.endpointCancel()
+		}
+		values.endpoints, values.endpointCancel = nil, nil
+	case resource.ClusterType:
+		if values.clusterCancel != nil {
+			values.clusterCancel()
+		}
+		values.clusters, values.clusterCancel = nil, nil
+	case resource.RouteType:
+		if values.routeCancel != nil {
+			values.routeCancel()
+		}
+		values.routes, values.routeCancel = nil, nil
+	case resource.ListenerType:
+		if values.listenerCancel != nil {
+			values.listenerCancel()
+		}
+		values.listeners, values.listenerCancel = nil, nil
+	case resource.SecretType:
+		if values.secretCancel != nil {
+			values.secretCancel()
+		}
+		values.secrets, values.secretCancel = nil, nil
+	case resource.RuntimeType:
+		if values.runtimeCancel != nil {
+			values.runtimeCancel()
+		}
+		values.runtimes, values.runtimeCancel = nil, nil
+	default:
+		if terminate, exists := values.terminations[typeURL]; exists {
+			close(terminate)
+			delete(values.terminations, typeURL)
+		}
+		if cancel := values.cancellations[typeURL]; cancel != nil {
+			cancel()
+		}
+		delete(values.cancellations, typeURL)
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package server_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+
+	discovery "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
+	rsrc "github.com/envoyproxy/go-control-plane/pkg/resource/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/server/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/test/resource/v2"
+)
+
+func TestCompressor(t *testing.T) {
+	c := server.NewCompressor(gzip.BestCompression, rsrc.EndpointType)
+
+	response := func(typeURL string, res types.Resource) []byte {
+		out := &discovery.DiscoveryResponse{VersionInfo: "1", TypeUrl: typeURL, Nonce: "1"}
+		for i := 0; i < 20; i++ {
+			any, err := ptypes.MarshalAny(res)
+			if err != nil {
+				t.Fatal(err)
+			}
+			out.Resources = append(out.Resources, any)
+		}
+		data, err := proto.Marshal(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+	compress := func(data []byte) []byte {
+		buf := &bytes.Buffer{}
+		w, err := c.Compress(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(data); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		r, err := c.Decompress(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := ioutil.ReadAll(r); !bytes.Equal(got, data) {
+			t.Error("Decompress() => got different data")
+		}
+		return data
+	}
+
+	endpoints := compress(response(rsrc.EndpointType, resource.MakeEndpoint("cluster", 8080)))
+	secrets := compress(response(rsrc.SecretType, resource.MakeSecrets("tls", "root")[0]))
+
+	sizes := c.Sizes()
+	eds, sds := sizes[rsrc.EndpointType], sizes[rsrc.SecretType]
+	if eds.Messages != 1 || eds.Uncompressed != int64(len(endpoints)) || eds.Compressed >= eds.Uncompressed/2 {
+		t.Errorf("EDS sizes => got %+v, want compressed", eds)
+	}
+	if sds.Messages != 1 || sds.Uncompressed != int64(len(secrets)) || sds.Compressed <= sds.Uncompressed {
+		t.Errorf("SDS sizes => got %+v, want stored", sds)
+	}
+}
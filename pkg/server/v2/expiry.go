@@ -0,0 +1,216 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package server
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	rpc "google.golang.org/genproto/googleapis/rpc/status"
+
+	discovery "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	auth "github.com/envoyproxy/go-control-plane/envoy/api/v2/auth"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/resource/v2"
+)
+
+// AlertLevel is the severity of an alert.
+type AlertLevel int
+
+const (
+	// AlertWarning is raised for an isolated rejection.
+	AlertWarning AlertLevel = iota
+	// AlertError is raised for repeated rejections.
+	AlertError
+	// AlertCritical is raised for rejections when the certificates in use by
+	// the client are close to the expiry.
+	AlertCritical
+)
+
+func (level AlertLevel) String() string {
+	switch level {
+	case AlertWarning:
+		return "warning"
+	case AlertError:
+		return "error"
+	case AlertCritical:
+		return "critical"
+	}
+	return "unknown"
+}
+
+// SecretAlert reports a client failing to acknowledge a secrets update.
+type SecretAlert struct {
+	StreamID int64
+	Node     string
+
+	// Version of the rejected secrets.
+	Version string
+
+	// Failures is the number of consecutive rejections on the stream.
+	Failures int
+
+	// Expiry is the earliest certificate expiry of the secrets the client last
+	// acknowledged, or zero if unknown.
+	Expiry time.Time
+
+	Level AlertLevel
+	Error *rpc.Status
+}
+
+// SecretExpiryCallbacks tracks the secrets sent on the streams and raises
+// alerts with escalating levels when clients fail to acknowledge the updates.
+// It implements the Callbacks interface and only inspects the SDS traffic.
+type SecretExpiryCallbacks struct {
+	alert     func(SecretAlert)
+	threshold int
+	window    time.Duration
+
+	streams map[int64]*secretStream
+	mu      sync.Mutex
+}
+
+// secretStream is the SDS state of a stream.
+type secretStream struct {
+	node string
+
+	// nonce, version and expiry of the last sent secrets
+	nonce   string
+	version string
+	pending time.Time
+
+	// expiry of the last acknowledged secrets
+	acked time.Time
+
+	failures int
+}
+
+var _ Callbacks = &SecretExpiryCallbacks{}
+
+// NewSecretExpiryCallbacks creates callbacks that invoke the alert function
+// for every rejected secrets response. The alert level is escalated to error
+// after the threshold of consecutive rejections on a stream, and to critical
+// once the certificates in use by the client expire within the window.
+func NewSecretExpiryCallbacks(alert func(SecretAlert), threshold int, window time.Duration) *SecretExpiryCallbacks {
+	return &SecretExpiryCallbacks{
+		alert:     alert,
+		threshold: threshold,
+		window:    window,
+		streams:   make(map[int64]*secretStream),
+	}
+}
+
+// OnStreamOpen starts tracking a stream.
+func (cb *SecretExpiryCallbacks) OnStreamOpen(_ context.Context, streamID int64, _ string) error {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.streams[streamID] = &secretStream{}
+	return nil
+}
+
+// OnStreamClosed stops tracking a stream.
+func (cb *SecretExpiryCallbacks) OnStreamClosed(streamID int64) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	delete(cb.streams, streamID)
+}
+
+// OnStreamRequest detects acknowledgements and rejections of the secrets.
+func (cb *SecretExpiryCallbacks) OnStreamRequest(streamID int64, req *discovery.DiscoveryRequest) error {
+	if req.TypeUrl != resource.SecretType {
+		return nil
+	}
+
+	cb.mu.Lock()
+	st, exists := cb.streams[streamID]
+	if !exists {
+		cb.mu.Unlock()
+		return nil
+	}
+	if req.Node != nil {
+		st.node = req.Node.Id
+	}
+	if st.nonce == "" || req.ResponseNonce != st.nonce {
+		cb.mu.Unlock()
+		return nil
+	}
+	st.nonce = ""
+	if req.ErrorDetail == nil {
+		st.acked = st.pending
+		st.failures = 0
+		cb.mu.Unlock()
+		return nil
+	}
+
+	st.failures++
+	alert := SecretAlert{
+		StreamID: streamID,
+		Node:     st.node,
+		Version:  st.version,
+		Failures: st.failures,
+		Expiry:   st.acked,
+		Level:    AlertWarning,
+		Error:    req.ErrorDetail,
+	}
+	cb.mu.Unlock()
+
+	switch {
+	case !alert.Expiry.IsZero() && time.Until(alert.Expiry) < cb.window:
+		alert.Level = AlertCritical
+	case alert.Failures >= cb.threshold:
+		alert.Level = AlertError
+	}
+	if cb.alert != nil {
+		cb.alert(alert)
+	}
+	return nil
+}
+
+// OnStreamResponse records the expiry of the sent secrets.
+func (cb *SecretExpiryCallbacks) OnStreamResponse(streamID int64, _ *discovery.DiscoveryRequest, resp *discovery.DiscoveryResponse) {
+	if resp.TypeUrl != resource.SecretType {
+		return
+	}
+
+	var expiry time.Time
+	for _, res := range resp.Resources {
+		secret := &auth.Secret{}
+		if err := ptypes.UnmarshalAny(res, secret); err != nil {
+			continue
+		}
+		if t, err := cache.CertificateExpiry(secret); err == nil && !t.IsZero() && (expiry.IsZero() || t.Before(expiry)) {
+			expiry = t
+		}
+	}
+
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	if st, exists := cb.streams[streamID]; exists {
+		st.nonce = resp.Nonce
+		st.version = resp.VersionInfo
+		st.pending = expiry
+	}
+}
+
+// OnFetchRequest is a no-op.
+func (cb *SecretExpiryCallbacks) OnFetchRequest(context.Context, *discovery.DiscoveryRequest) error {
+	return nil
+}
+
+// OnFetchResponse is a no-op.
+func (cb *SecretExpiryCallbacks) OnFetchResponse(*discovery.DiscoveryRequest, *discovery.DiscoveryResponse) {
+}
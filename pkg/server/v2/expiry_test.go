@@ -0,0 +1,84 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package server_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	any "github.com/golang/protobuf/ptypes/any"
+	rpc "google.golang.org/genproto/googleapis/rpc/status"
+
+	discovery "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	rsrc "github.com/envoyproxy/go-control-plane/pkg/resource/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/server/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/test/resource/v2"
+)
+
+func TestSecretExpiryCallbacks(t *testing.T) {
+	var alerts []server.SecretAlert
+	cb := server.NewSecretExpiryCallbacks(func(alert server.SecretAlert) {
+		alerts = append(alerts, alert)
+	}, 2, time.Hour)
+
+	var secrets []*any.Any
+	for _, secret := range resource.MakeSecrets("tls", "root") {
+		packed, err := ptypes.MarshalAny(secret)
+		if err != nil {
+			t.Fatal(err)
+		}
+		secrets = append(secrets, packed)
+	}
+	node := &core.Node{Id: "node"}
+	nack := &rpc.Status{Message: "invalid certificate"}
+
+	// stream without acknowledged certificates escalates by the failure count
+	_ = cb.OnStreamOpen(context.Background(), 1, rsrc.SecretType)
+	for i, nonce := range []string{"1", "2"} {
+		cb.OnStreamResponse(1, nil, &discovery.DiscoveryResponse{TypeUrl: rsrc.SecretType, VersionInfo: "v1", Nonce: nonce})
+		_ = cb.OnStreamRequest(1, &discovery.DiscoveryRequest{Node: node, TypeUrl: rsrc.SecretType, ResponseNonce: nonce, ErrorDetail: nack})
+		if len(alerts) != i+1 {
+			t.Fatalf("alerts => got %d, want %d", len(alerts), i+1)
+		}
+	}
+	if alerts[0].Level != server.AlertWarning || alerts[1].Level != server.AlertError || alerts[1].Failures != 2 {
+		t.Errorf("alerts => got %+v", alerts)
+	}
+	if alerts[0].Node != "node" || alerts[0].Version != "v1" || alerts[0].Error != nack {
+		t.Errorf("alert => got %+v", alerts[0])
+	}
+
+	// stream with acknowledged expired certificates escalates to critical
+	alerts = nil
+	_ = cb.OnStreamOpen(context.Background(), 2, "")
+	cb.OnStreamResponse(2, nil, &discovery.DiscoveryResponse{TypeUrl: rsrc.SecretType, VersionInfo: "v1", Nonce: "1", Resources: secrets})
+	_ = cb.OnStreamRequest(2, &discovery.DiscoveryRequest{Node: node, TypeUrl: rsrc.SecretType, VersionInfo: "v1", ResponseNonce: "1"})
+	cb.OnStreamResponse(2, nil, &discovery.DiscoveryResponse{TypeUrl: rsrc.SecretType, VersionInfo: "v2", Nonce: "2", Resources: secrets})
+	_ = cb.OnStreamRequest(2, &discovery.DiscoveryRequest{TypeUrl: rsrc.SecretType, VersionInfo: "v1", ResponseNonce: "2", ErrorDetail: nack})
+	if len(alerts) != 1 || alerts[0].Level != server.AlertCritical || alerts[0].Expiry.IsZero() {
+		t.Errorf("alerts => got %+v, want one critical alert", alerts)
+	}
+
+	// stale nonces and other types are ignored
+	_ = cb.OnStreamRequest(2, &discovery.DiscoveryRequest{TypeUrl: rsrc.SecretType, ResponseNonce: "2", ErrorDetail: nack})
+	_ = cb.OnStreamRequest(2, &discovery.DiscoveryRequest{TypeUrl: rsrc.ClusterType, ResponseNonce: "3", ErrorDetail: nack})
+	cb.OnStreamClosed(2)
+	if len(alerts) != 1 {
+		t.Errorf("alerts => got %d, want 1", len(alerts))
+	}
+}
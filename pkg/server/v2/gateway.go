@@ -52,10 +52,14 @@ func (h *HTTPGateway) ServeHTTP(req *http.Request) ([]byte, int, error) {
 		typeURL = resource.ListenerType
 	case resource.FetchRoutes:
 		typeURL = resource.RouteType
+	case resource.FetchScopedRoutes:
+		typeURL = resource.ScopedRouteType
 	case resource.FetchSecrets:
 		typeURL = resource.SecretType
 	case resource.FetchRuntimes:
 		typeURL = resource.RuntimeType
+	case OpenAPIPath:
+		return serveOpenAPI(req)
 	default:
 		return nil, http.StatusNotFound, fmt.Errorf("no endpoint")
 	}
@@ -16,6 +16,7 @@ package server_test
 
 import (
 	"context"
+	"encoding/json"
 	"io"
 	"net/http"
 	"strings"
@@ -25,6 +26,7 @@ import (
 	discovery "github.com/envoyproxy/go-control-plane/envoy/api/v2"
 	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
 	"github.com/envoyproxy/go-control-plane/pkg/cache/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/openapi"
 	"github.com/envoyproxy/go-control-plane/pkg/resource/v2"
 	rsrc "github.com/envoyproxy/go-control-plane/pkg/resource/v2"
 	"github.com/envoyproxy/go-control-plane/pkg/server/v2"
@@ -123,4 +125,22 @@ func TestGateway(t *testing.T) {
 			t.Errorf("handler returned wrong status: %d, want %d", status, 200)
 		}
 	}
+
+	req, err := http.NewRequest(http.MethodGet, server.OpenAPIPath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, code, err := gtw.ServeHTTP(req)
+	if code != http.StatusOK || err != nil {
+		t.Fatalf("openapi => got %d %v", code, err)
+	}
+	var doc openapi.Document
+	if err := json.Unmarshal(resp, &doc); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{resource.FetchClusters, resource.FetchRoutes, resource.FetchListeners} {
+		if op := doc.Paths[path]["post"]; op == nil || op.RequestBody == nil {
+			t.Errorf("openapi %s => got %+v", path, doc.Paths[path])
+		}
+	}
 }
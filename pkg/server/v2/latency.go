@@ -0,0 +1,309 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package server
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	discovery "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/v2"
+)
+
+// NodeLatency summarizes the recent ACK latencies of a node.
+type NodeLatency struct {
+	Node    string
+	Samples int
+	Median  time.Duration
+	P90     time.Duration
+
+	// Outlier is set if the node is consistently slower than the fleet.
+	Outlier bool
+}
+
+// LatencyReport summarizes the ACK latencies of the fleet.
+type LatencyReport struct {
+	// Median is the median of the node medians.
+	Median time.Duration
+
+	// Nodes are the node summaries, the slowest first.
+	Nodes []NodeLatency
+}
+
+// Outliers returns the outlier nodes.
+func (r LatencyReport) Outliers() []NodeLatency {
+	var out []NodeLatency
+	for _, node := range r.Nodes {
+		if node.Outlier {
+			out = append(out, node)
+		}
+	}
+	return out
+}
+
+// LatencyDetector tracks the time taken by the nodes to acknowledge the
+// responses, and flags the nodes with a median latency several times the
+// fleet median. Such nodes are likely overloaded or wedged.
+//
+// The median of the recent samples only moves on sustained slowness, so a
+// single slow update does not flag a node. The detector is a set of server
+// callbacks:
+//
+//	detector := NewLatencyDetector(cache.IDHash{}, WithOutlierCallback(page))
+//	srv := NewServer(ctx, snapshotCache, detector)
+//	go detector.Run(ctx, time.Minute)
+type LatencyDetector struct {
+	hash       cache.NodeHash
+	samples    int
+	minSamples int
+	minNodes   int
+	factor     float64
+	floor      time.Duration
+	onOutlier  func(NodeLatency)
+	now        func() time.Time
+
+	streams   map[int64]string
+	pending   map[int64]map[string]pendingResponse
+	latencies map[string][]time.Duration
+	open      map[string]int
+	outliers  map[string]bool
+	mu        sync.Mutex
+}
+
+// LatencyDetectorOption configures the latency detector.
+type LatencyDetectorOption func(*LatencyDetector)
+
+// WithLatencySamples sets the number of recent samples retained by node, and
+// the number required to evaluate a node.
+func WithLatencySamples(samples, minSamples int) LatencyDetectorOption {
+	return func(d *LatencyDetector) {
+		d.samples = samples
+		d.minSamples = minSamples
+	}
+}
+
+// WithOutlierFactor sets the ratio of a node median to the fleet median that
+// flags the node. The medians under the floor are never flagged.
+func WithOutlierFactor(factor float64, floor time.Duration) LatencyDetectorOption {
+	return func(d *LatencyDetector) {
+		d.factor = factor
+		d.floor = floor
+	}
+}
+
+// WithOutlierCallback sets the function called when a node becomes an outlier.
+func WithOutlierCallback(fn func(NodeLatency)) LatencyDetectorOption {
+	return func(d *LatencyDetector) {
+		d.onOutlier = fn
+	}
+}
+
+// WithLatencyClock sets the clock of the latency detector.
+func WithLatencyClock(now func() time.Time) LatencyDetectorOption {
+	return func(d *LatencyDetector) {
+		d.now = now
+	}
+}
+
+// NewLatencyDetector creates a latency detector. By default, it retains 20
+// samples by node, evaluates the nodes with at least 5 samples once 3 nodes are
+// evaluated, and flags the medians 3 times the fleet median and over 1s.
+func NewLatencyDetector(hash cache.NodeHash, opts ...LatencyDetectorOption) *LatencyDetector {
+	d := &LatencyDetector{
+		hash:       hash,
+		samples:    20,
+		minSamples: 5,
+		minNodes:   3,
+		factor:     3,
+		floor:      time.Second,
+		now:        time.Now,
+		streams:    make(map[int64]string),
+		pending:    make(map[int64]map[string]pendingResponse),
+		latencies:  make(map[string][]time.Duration),
+		open:       make(map[string]int),
+		outliers:   make(map[string]bool),
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	return d
+}
+
+// Report returns the latency report of the nodes with enough samples.
+func (d *LatencyDetector) Report() LatencyReport {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.report()
+}
+
+func (d *LatencyDetector) report() LatencyReport {
+	var out LatencyReport
+	medians := make([]time.Duration, 0, len(d.latencies))
+	for node, latencies := range d.latencies {
+		if len(latencies) < d.minSamples {
+			continue
+		}
+		sorted := append([]time.Duration(nil), latencies...)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		summary := NodeLatency{
+			Node:    node,
+			Samples: len(sorted),
+			Median:  percentile(sorted, 0.5),
+			P90:     percentile(sorted, 0.9),
+		}
+		out.Nodes = append(out.Nodes, summary)
+		medians = append(medians, summary.Median)
+	}
+	sort.Slice(medians, func(i, j int) bool { return medians[i] < medians[j] })
+	out.Median = percentile(medians, 0.5)
+
+	if len(out.Nodes) >= d.minNodes {
+		threshold := time.Duration(d.factor * float64(out.Median))
+		for i := range out.Nodes {
+			median := out.Nodes[i].Median
+			out.Nodes[i].Outlier = median > threshold && median > d.floor
+		}
+	}
+	sort.Slice(out.Nodes, func(i, j int) bool {
+		if out.Nodes[i].Median != out.Nodes[j].Median {
+			return out.Nodes[i].Median > out.Nodes[j].Median
+		}
+		return out.Nodes[i].Node < out.Nodes[j].Node
+	})
+	return out
+}
+
+// percentile returns the nearest-rank percentile of the sorted durations.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(p*float64(len(sorted))+0.5) - 1
+	if i < 0 {
+		i = 0
+	}
+	return sorted[i]
+}
+
+// Evaluate calls the outlier callback for the nodes becoming outliers, and
+// returns the report.
+func (d *LatencyDetector) Evaluate() LatencyReport {
+	d.mu.Lock()
+	report := d.report()
+	var flagged []NodeLatency
+	outliers := make(map[string]bool)
+	for _, node := range report.Outliers() {
+		if !d.outliers[node.Node] {
+			flagged = append(flagged, node)
+		}
+		outliers[node.Node] = true
+	}
+	d.outliers = outliers
+	d.mu.Unlock()
+
+	if d.onOutlier != nil {
+		for _, node := range flagged {
+			d.onOutlier(node)
+		}
+	}
+	return report
+}
+
+// Run evaluates the latencies at every interval until the context is done.
+func (d *LatencyDetector) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			d.Evaluate()
+		}
+	}
+}
+
+var _ Callbacks = &LatencyDetector{}
+
+// OnStreamOpen is a no-op.
+func (d *LatencyDetector) OnStreamOpen(context.Context, int64, string) error {
+	return nil
+}
+
+// OnStreamClosed forgets the node once its last stream is closed.
+func (d *LatencyDetector) OnStreamClosed(id int64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.pending, id)
+	node, exists := d.streams[id]
+	if !exists {
+		return
+	}
+	delete(d.streams, id)
+	if d.open[node]--; d.open[node] <= 0 {
+		delete(d.open, node)
+		delete(d.latencies, node)
+		delete(d.outliers, node)
+	}
+}
+
+// OnStreamRequest records the latency of the acknowledged response. The
+// rejections are not samples, as the node did not apply the configuration.
+func (d *LatencyDetector) OnStreamRequest(id int64, req *discovery.DiscoveryRequest) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, exists := d.streams[id]; !exists && req.Node != nil {
+		node := d.hash.ID(req.Node)
+		d.streams[id] = node
+		d.open[node]++
+	}
+
+	response, exists := d.pending[id][req.TypeUrl]
+	if !exists || response.nonce != req.ResponseNonce {
+		return nil
+	}
+	delete(d.pending[id], req.TypeUrl)
+	node, exists := d.streams[id]
+	if !exists || req.ErrorDetail != nil {
+		return nil
+	}
+	latencies := append(d.latencies[node], d.now().Sub(response.sent))
+	if len(latencies) > d.samples {
+		latencies = latencies[len(latencies)-d.samples:]
+	}
+	d.latencies[node] = latencies
+	return nil
+}
+
+// OnStreamResponse records the response awaiting the acknowledgement.
+func (d *LatencyDetector) OnStreamResponse(id int64, _ *discovery.DiscoveryRequest, resp *discovery.DiscoveryResponse) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.pending[id] == nil {
+		d.pending[id] = make(map[string]pendingResponse)
+	}
+	d.pending[id][resp.TypeUrl] = pendingResponse{nonce: resp.Nonce, sent: d.now()}
+}
+
+// OnFetchRequest is a no-op.
+func (d *LatencyDetector) OnFetchRequest(context.Context, *discovery.DiscoveryRequest) error {
+	return nil
+}
+
+// OnFetchResponse is a no-op.
+func (d *LatencyDetector) OnFetchResponse(*discovery.DiscoveryRequest, *discovery.DiscoveryResponse) {
+}
@@ -0,0 +1,93 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package server_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/status"
+
+	discovery "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/v2"
+	rsrc "github.com/envoyproxy/go-control-plane/pkg/resource/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/server/v2"
+)
+
+func TestLatencyDetector(t *testing.T) {
+	now := time.Unix(0, 0)
+	var flagged []server.NodeLatency
+	d := server.NewLatencyDetector(cache.IDHash{},
+		server.WithLatencyClock(func() time.Time { return now }),
+		server.WithOutlierCallback(func(node server.NodeLatency) { flagged = append(flagged, node) }))
+
+	// each node acknowledges the responses after its delay
+	respond := func(id int64, node string, delay time.Duration, nack bool) {
+		nonce := fmt.Sprint(now.UnixNano())
+		d.OnStreamResponse(id, nil, &discovery.DiscoveryResponse{TypeUrl: rsrc.ClusterType, Nonce: nonce})
+		now = now.Add(delay)
+		req := &discovery.DiscoveryRequest{Node: &core.Node{Id: node}, TypeUrl: rsrc.ClusterType, ResponseNonce: nonce}
+		if nack {
+			req.ErrorDetail = &status.Status{Message: "rejected"}
+		}
+		_ = d.OnStreamRequest(id, req)
+	}
+	delays := map[int64]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 3: 300 * time.Millisecond, 4: 5 * time.Second}
+	for i := 0; i < 4; i++ {
+		for id := int64(1); id <= 4; id++ {
+			respond(id, fmt.Sprint("node", id), delays[id], false)
+		}
+	}
+	if got := d.Evaluate(); len(got.Nodes) != 0 || len(flagged) != 0 {
+		t.Errorf("Evaluate() with too few samples => got %+v, %v", got, flagged)
+	}
+
+	// a single slow response does not flag a node, and NACKs are not samples
+	respond(1, "node1", 10*time.Second, true)
+	respond(2, "node2", 10*time.Second, false)
+	for id := int64(1); id <= 4; id++ {
+		respond(id, fmt.Sprint("node", id), delays[id], false)
+	}
+	got := d.Evaluate()
+	if len(got.Nodes) != 4 || got.Median != 200*time.Millisecond {
+		t.Fatalf("Evaluate() => got %+v", got)
+	}
+	if got.Nodes[0].Node != "node4" || !got.Nodes[0].Outlier || got.Nodes[0].Median != 5*time.Second {
+		t.Errorf("Evaluate() slowest => got %+v, want node4 outlier", got.Nodes[0])
+	}
+	if got.Nodes[1].Node != "node3" || got.Nodes[1].Outlier {
+		t.Errorf("Evaluate() => got %+v, want node3 healthy", got.Nodes[1])
+	}
+	if node2 := got.Nodes[2]; node2.Node != "node2" || node2.Outlier || node2.Samples != 6 || node2.Median != 200*time.Millisecond {
+		t.Errorf("Evaluate() => got %+v, want node2 healthy", node2)
+	}
+	if len(got.Outliers()) != 1 || len(flagged) != 1 || flagged[0].Node != "node4" {
+		t.Errorf("outliers => got %+v, %+v, want node4", got.Outliers(), flagged)
+	}
+
+	// the callback is only called when a node becomes an outlier
+	d.Evaluate()
+	if len(flagged) != 1 {
+		t.Errorf("flagged => got %d, want 1", len(flagged))
+	}
+
+	// the node is forgotten with its stream
+	d.OnStreamClosed(4)
+	if got := d.Evaluate(); len(got.Nodes) != 3 || len(got.Outliers()) != 0 {
+		t.Errorf("Evaluate() after close => got %+v", got)
+	}
+}
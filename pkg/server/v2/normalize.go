@@ -0,0 +1,180 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode"
+
+	discovery "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	"github.com/envoyproxy/go-control-plane/pkg/server/sotw/v2"
+)
+
+// NormalizePolicy is the handling of the node identifiers that are valid but
+// not in the canonical form.
+type NormalizePolicy int
+
+const (
+	// NormalizeRewrite replaces the identifiers by their canonical form.
+	NormalizeRewrite NormalizePolicy = iota
+	// NormalizeReject rejects the requests with non-canonical identifiers.
+	NormalizeReject
+)
+
+// DefaultMaxNodeIDLength is the default maximum length of the identifiers.
+const DefaultMaxNodeIDLength = 256
+
+// NodeNormalizer canonicalizes the node IDs and the cluster names of the
+// requests, so that the near-duplicate identifiers, e.g. differing by case or
+// by surrounding spaces, share the cache entry of the node. The identifiers
+// with characters outside the allowed set, or longer than the maximum length,
+// are rejected under both policies.
+//
+// The normalizer is a set of server callbacks that updates the node of the
+// requests in place before the watches are created, and should run first in a
+// callbacks chain:
+//
+//	normalizer := NewNodeNormalizer(WithNormalizePolicy(NormalizeReject))
+//	srv := NewServer(ctx, snapshotCache, normalizer)
+type NodeNormalizer struct {
+	lowerCase bool
+	allowed   func(rune) bool
+	maxLength int
+	policy    NormalizePolicy
+}
+
+// NodeNormalizerOption configures the node normalizer.
+type NodeNormalizerOption func(*NodeNormalizer)
+
+// WithCaseSensitiveIDs keeps the case of the identifiers, which are lower
+// cased by default.
+func WithCaseSensitiveIDs() NodeNormalizerOption {
+	return func(n *NodeNormalizer) {
+		n.lowerCase = false
+	}
+}
+
+// WithAllowedRunes sets the characters allowed in the identifiers. The
+// default is the letters, the digits and "-_.:/@~", the tilde separating the
+// parts of the Istio node IDs.
+func WithAllowedRunes(allowed func(rune) bool) NodeNormalizerOption {
+	return func(n *NodeNormalizer) {
+		n.allowed = allowed
+	}
+}
+
+// WithMaxNodeIDLength sets the maximum length in bytes of the identifiers.
+func WithMaxNodeIDLength(length int) NodeNormalizerOption {
+	return func(n *NodeNormalizer) {
+		n.maxLength = length
+	}
+}
+
+// WithNormalizePolicy sets the handling of the non-canonical identifiers,
+// NormalizeRewrite by default.
+func WithNormalizePolicy(policy NormalizePolicy) NodeNormalizerOption {
+	return func(n *NodeNormalizer) {
+		n.policy = policy
+	}
+}
+
+// NewNodeNormalizer creates a node normalizer.
+func NewNodeNormalizer(opts ...NodeNormalizerOption) *NodeNormalizer {
+	n := &NodeNormalizer{
+		lowerCase: true,
+		allowed:   defaultNodeRune,
+		maxLength: DefaultMaxNodeIDLength,
+	}
+	for _, opt := range opts {
+		opt(n)
+	}
+	return n
+}
+
+func defaultNodeRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("-_.:/@~", r)
+}
+
+var _ Callbacks = &NodeNormalizer{}
+
+// Normalize returns the canonical form of an identifier, or an error if the
+// identifier is invalid.
+func (n *NodeNormalizer) Normalize(id string) (string, error) {
+	out := strings.TrimSpace(id)
+	if n.lowerCase {
+		out = strings.ToLower(out)
+	}
+	if len(out) > n.maxLength {
+		return "", fmt.Errorf("%q is longer than %d bytes", id, n.maxLength)
+	}
+	for _, r := range out {
+		if !n.allowed(r) {
+			return "", fmt.Errorf("%q contains %q", id, r)
+		}
+	}
+	return out, nil
+}
+
+// normalizeNode normalizes the node ID and the cluster name in place.
+func (n *NodeNormalizer) normalizeNode(node *core.Node) error {
+	if node == nil {
+		return nil
+	}
+	for _, field := range []struct {
+		name  string
+		value *string
+	}{{"node ID", &node.Id}, {"node cluster", &node.Cluster}} {
+		if *field.value == "" {
+			continue
+		}
+		canonical, err := n.Normalize(*field.value)
+		if err != nil {
+			return sotw.ProtocolError(field.name, "invalid %s: %v", field.name, err)
+		}
+		if canonical != *field.value && n.policy == NormalizeReject {
+			return sotw.ProtocolError(field.name, "%s %q is not canonical, want %q", field.name, *field.value, canonical)
+		}
+		*field.value = canonical
+	}
+	return nil
+}
+
+// OnStreamOpen is a no-op.
+func (n *NodeNormalizer) OnStreamOpen(context.Context, int64, string) error {
+	return nil
+}
+
+// OnStreamClosed is a no-op.
+func (n *NodeNormalizer) OnStreamClosed(int64) {}
+
+// OnStreamRequest normalizes the node of the request.
+func (n *NodeNormalizer) OnStreamRequest(_ int64, req *discovery.DiscoveryRequest) error {
+	return n.normalizeNode(req.Node)
+}
+
+// OnStreamResponse is a no-op.
+func (n *NodeNormalizer) OnStreamResponse(int64, *discovery.DiscoveryRequest, *discovery.DiscoveryResponse) {
+}
+
+// OnFetchRequest normalizes the node of the request.
+func (n *NodeNormalizer) OnFetchRequest(_ context.Context, req *discovery.DiscoveryRequest) error {
+	return n.normalizeNode(req.Node)
+}
+
+// OnFetchResponse is a no-op.
+func (n *NodeNormalizer) OnFetchResponse(*discovery.DiscoveryRequest, *discovery.DiscoveryResponse) {}
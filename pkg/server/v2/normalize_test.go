@@ -0,0 +1,107 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package server_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	discovery "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	rsrc "github.com/envoyproxy/go-control-plane/pkg/resource/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/server/v2"
+)
+
+func TestNormalize(t *testing.T) {
+	n := server.NewNodeNormalizer(server.WithMaxNodeIDLength(16))
+	tests := []struct {
+		id      string
+		want    string
+		invalid bool
+	}{
+		{id: "Sidecar~10.0.0.1", want: "sidecar~10.0.0.1"},
+		{id: " Ingress-A ", want: "ingress-a"},
+		{id: "zone/us-east-1a", want: "zone/us-east-1a"},
+		{id: "spiffe id", invalid: true},
+		{id: strings.Repeat("a", 17), invalid: true},
+	}
+	for _, test := range tests {
+		got, err := n.Normalize(test.id)
+		if (err != nil) != test.invalid || got != test.want {
+			t.Errorf("Normalize(%q) => got %q, %v, want %q", test.id, got, err, test.want)
+		}
+	}
+
+	istio := "sidecar~10.0.0.1~httpbin-74fb669cc6-8qn5h.default~default.svc.cluster.local"
+	if got, err := server.NewNodeNormalizer().Normalize(istio); err != nil || got != istio {
+		t.Errorf("Normalize(%q) => got %q, %v, want it unchanged", istio, got, err)
+	}
+
+	if got, _ := server.NewNodeNormalizer(server.WithCaseSensitiveIDs()).Normalize("Ingress"); got != "Ingress" {
+		t.Errorf("case sensitive => got %q, want Ingress", got)
+	}
+}
+
+func TestNodeNormalizerPolicies(t *testing.T) {
+	req := &discovery.DiscoveryRequest{Node: &core.Node{Id: "Node-A", Cluster: "Edge"}}
+	if err := server.NewNodeNormalizer().OnStreamRequest(1, req); err != nil {
+		t.Fatal(err)
+	}
+	if req.Node.Id != "node-a" || req.Node.Cluster != "edge" {
+		t.Errorf("rewritten node => got %v, want node-a in edge", req.Node)
+	}
+
+	reject := server.NewNodeNormalizer(server.WithNormalizePolicy(server.NormalizeReject))
+	if err := reject.OnFetchRequest(context.Background(), &discovery.DiscoveryRequest{Node: &core.Node{Id: "Node-A"}}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("rejected node => got %v, want invalid argument", err)
+	}
+	if err := reject.OnFetchRequest(context.Background(), &discovery.DiscoveryRequest{Node: &core.Node{Id: "node-a"}}); err != nil {
+		t.Errorf("canonical node => got %v, want no error", err)
+	}
+	if err := reject.OnStreamRequest(1, &discovery.DiscoveryRequest{}); err != nil {
+		t.Errorf("request without a node => got %v, want no error", err)
+	}
+}
+
+func TestNodeNormalizerStream(t *testing.T) {
+	config := makeMockConfigWatcher()
+	config.responses = makeResponses()
+	s := server.NewServer(context.Background(), config, server.NewNodeNormalizer())
+
+	resp := makeMockStream(t)
+	resp.recv <- &discovery.DiscoveryRequest{Node: &core.Node{Id: "Node-A"}, TypeUrl: rsrc.ClusterType}
+	done := make(chan error)
+	go func() {
+		done <- s.StreamAggregatedResources(resp)
+	}()
+	select {
+	case <-resp.sent:
+	case <-time.After(time.Second):
+		t.Fatal("got no response")
+	}
+
+	if got := s.DisconnectNode("node-a", status.New(codes.Unavailable, "evicted"), 0); got != 1 {
+		t.Errorf("DisconnectNode(node-a) => got %d streams, want 1", got)
+	}
+	if err := <-done; status.Code(err) != codes.Unavailable {
+		t.Errorf("StreamAggregatedResources() => got %v, want unavailable", err)
+	}
+	close(resp.recv)
+}
@@ -0,0 +1,82 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	discovery "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/openapi"
+	"github.com/envoyproxy/go-control-plane/pkg/resource/v2"
+)
+
+// OpenAPIPath is the path of the OpenAPI description served by the gateway.
+const OpenAPIPath = "/openapi.json"
+
+// OpenAPI describes the REST discovery endpoints of the HTTP gateway.
+func OpenAPI() *openapi.Document {
+	// the xDS major version is the first fetch path segment
+	doc := openapi.NewDocument("xDS REST discovery", strings.Split(resource.FetchClusters, "/")[1])
+	doc.Info.Description = "Fetches the xDS resources with JSON discovery requests."
+	request := doc.AddMessage(&discovery.DiscoveryRequest{})
+	response := doc.AddMessage(&discovery.DiscoveryResponse{})
+
+	for _, endpoint := range []struct {
+		path string
+		id   string
+	}{
+		{resource.FetchEndpoints, "fetchEndpoints"},
+		{resource.FetchClusters, "fetchClusters"},
+		{resource.FetchListeners, "fetchListeners"},
+		{resource.FetchRoutes, "fetchRoutes"},
+		{resource.FetchScopedRoutes, "fetchScopedRoutes"},
+		{resource.FetchSecrets, "fetchSecrets"},
+		{resource.FetchRuntimes, "fetchRuntimes"},
+	} {
+		doc.Paths[endpoint.path] = openapi.PathItem{
+			"post": {
+				OperationID: endpoint.id,
+				RequestBody: &openapi.RequestBody{Required: true, Content: openapi.JSON(request)},
+				Responses: map[string]openapi.Response{
+					"200": {Description: "The resources at the current version.", Content: openapi.JSON(response)},
+					"304": {Description: "The requested version is current."},
+					"400": {Description: "The request is not a valid discovery request."},
+					"500": {Description: "The resources cannot be fetched."},
+				},
+			},
+		}
+	}
+	doc.Paths[OpenAPIPath] = openapi.PathItem{
+		"get": {
+			OperationID: "openAPI",
+			Responses:   map[string]openapi.Response{"200": {Description: "This document."}},
+		},
+	}
+	return doc
+}
+
+func serveOpenAPI(req *http.Request) ([]byte, int, error) {
+	if req.Method != http.MethodGet {
+		return nil, http.StatusMethodNotAllowed, fmt.Errorf("method not allowed")
+	}
+	out, err := json.Marshal(OpenAPI())
+	if err != nil {
+		return nil, http.StatusInternalServerError, fmt.Errorf("marshal error: " + err.Error())
+	}
+	return out, http.StatusOK, nil
+}
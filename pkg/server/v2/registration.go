@@ -0,0 +1,338 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	discovery "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/v2"
+)
+
+const (
+	// DefaultTokenMetadataKey is the node metadata field of the onboarding
+	// token.
+	DefaultTokenMetadataKey = "onboarding_token"
+
+	// DefaultTokenHeader is the per-RPC credentials header of the onboarding
+	// token, e.g. set with the initial_metadata of the Envoy gRPC service.
+	DefaultTokenHeader = "x-onboarding-token"
+)
+
+// Registration is the identity assigned to a node on its first connection.
+type Registration struct {
+	NodeID string
+	Tenant string
+	// Peer is the identity of the peer the registration is bound to, set on
+	// the registration, see PeerIdentity.
+	Peer string
+}
+
+// PeerIdentity returns the identity of the peer of a stream or a fetch, which
+// the peer proves to the server, e.g. with its mTLS certificate.
+type PeerIdentity func(ctx context.Context) (string, error)
+
+// CertificateIdentity is the hex SHA-256 fingerprint of the mTLS certificate
+// presented by the peer.
+func CertificateIdentity(ctx context.Context) (string, error) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return "", errors.New("no peer")
+	}
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(info.State.PeerCertificates) == 0 {
+		return "", errors.New("no peer certificate")
+	}
+	sum := sha256.Sum256(info.State.PeerCertificates[0].Raw)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// TokenValidator validates the one-time onboarding token presented by a node,
+// and assigns the node identity.
+type TokenValidator interface {
+	Validate(ctx context.Context, token string, node *core.Node) (Registration, error)
+}
+
+// Tokens issues one-time onboarding tokens for the registrations. The tokens
+// are kept in memory, so a control plane with several replicas needs a shared
+// TokenValidator instead.
+type Tokens struct {
+	mu     sync.Mutex
+	tokens map[string]issuedToken
+	now    func() time.Time
+}
+
+type issuedToken struct {
+	registration Registration
+	expires      time.Time
+}
+
+var _ TokenValidator = &Tokens{}
+
+// NewTokens creates an empty token store.
+func NewTokens() *Tokens {
+	return &Tokens{tokens: make(map[string]issuedToken), now: time.Now}
+}
+
+// Issue returns a new token for the registration, valid for the duration.
+func (t *Tokens) Issue(registration Registration, ttl time.Duration) (string, error) {
+	if registration.NodeID == "" {
+		return "", errors.New("registration without a node ID")
+	}
+	key := make([]byte, 16)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(key)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.now()
+	for existing, issued := range t.tokens {
+		if !now.Before(issued.expires) {
+			delete(t.tokens, existing)
+		}
+	}
+	t.tokens[token] = issuedToken{registration: registration, expires: now.Add(ttl)}
+	return token, nil
+}
+
+// Validate consumes the token.
+func (t *Tokens) Validate(_ context.Context, token string, _ *core.Node) (Registration, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	issued, exists := t.tokens[token]
+	if !exists {
+		return Registration{}, errors.New("unknown onboarding token")
+	}
+	delete(t.tokens, token)
+	if !t.now().Before(issued.expires) {
+		return Registration{}, errors.New("expired onboarding token")
+	}
+	return issued.registration, nil
+}
+
+// Registry registers the nodes presenting an onboarding token on their first
+// connection, and rejects the streams of the unregistered nodes. The token is
+// read from the node metadata or from the per-RPC credentials.
+//
+// The registry is both the server callbacks and the node hash of the cache,
+// which maps the node IDs presented by the proxies to the assigned IDs:
+//
+//	registry := NewRegistry(tokens, WithRegisterCallback(generateSnapshot))
+//	snapshotCache := cache.NewSnapshotCache(true, registry, logger)
+//	srv := NewServer(ctx, snapshotCache, registry)
+//
+// The register callback is invoked before the first watch of the node, so it
+// may set the initial snapshot of the assigned node ID lazily.
+//
+// The node IDs are not secret, so the registrations are bound to the identity
+// of the peer presenting the token, by default the fingerprint of its mTLS
+// certificate. The later streams of the node ID are rejected unless they come
+// from the same peer.
+type Registry struct {
+	validator   TokenValidator
+	metadataKey string
+	header      string
+	identity    PeerIdentity
+	onRegister  func(Registration, *core.Node) error
+
+	mu sync.RWMutex
+	// registrations by presented node ID
+	registrations map[string]Registration
+	// stream contexts for the per-RPC credentials
+	streams map[int64]context.Context
+}
+
+// RegistryOption sets a registry option.
+type RegistryOption func(*Registry)
+
+// WithTokenMetadataKey sets the node metadata field of the token.
+func WithTokenMetadataKey(key string) RegistryOption {
+	return func(r *Registry) {
+		r.metadataKey = key
+	}
+}
+
+// WithTokenHeader sets the per-RPC credentials header of the token.
+func WithTokenHeader(header string) RegistryOption {
+	return func(r *Registry) {
+		r.header = header
+	}
+}
+
+// WithPeerIdentity sets the identity of the peers the registrations are bound
+// to. The default is CertificateIdentity.
+func WithPeerIdentity(identity PeerIdentity) RegistryOption {
+	return func(r *Registry) {
+		r.identity = identity
+	}
+}
+
+// WithRegisterCallback sets a callback invoked on the registration of a node.
+// Errors reject the stream, and the node may register again.
+func WithRegisterCallback(callback func(Registration, *core.Node) error) RegistryOption {
+	return func(r *Registry) {
+		r.onRegister = callback
+	}
+}
+
+// NewRegistry creates a registry with a token validator.
+func NewRegistry(validator TokenValidator, opts ...RegistryOption) *Registry {
+	r := &Registry{
+		validator:     validator,
+		metadataKey:   DefaultTokenMetadataKey,
+		header:        DefaultTokenHeader,
+		identity:      CertificateIdentity,
+		registrations: make(map[string]Registration),
+		streams:       make(map[int64]context.Context),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+var _ Callbacks = &Registry{}
+var _ cache.NodeHash = &Registry{}
+
+// ID returns the assigned ID of a registered node, or the presented ID.
+func (r *Registry) ID(node *core.Node) string {
+	if node == nil {
+		return ""
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if registration, exists := r.registrations[node.Id]; exists {
+		return registration.NodeID
+	}
+	return node.Id
+}
+
+// Lookup returns the registration of a presented node ID.
+func (r *Registry) Lookup(node string) (Registration, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	registration, exists := r.registrations[node]
+	return registration, exists
+}
+
+// Register registers a node out of band, e.g. to restore the registrations
+// after a restart. The registration is bound to its peer identity.
+func (r *Registry) Register(node string, registration Registration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.registrations[node] = registration
+}
+
+// Unregister forgets a presented node ID, which must present a new token to
+// connect again.
+func (r *Registry) Unregister(node string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.registrations, node)
+}
+
+func (r *Registry) register(ctx context.Context, node *core.Node) error {
+	if node == nil {
+		return status.Error(codes.Unauthenticated, "node is required for registration")
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	identity, err := r.identity(ctx)
+	if err != nil {
+		return status.Errorf(codes.Unauthenticated, "node %q: peer identity: %v", node.Id, err)
+	}
+	if registration, exists := r.Lookup(node.Id); exists {
+		if registration.Peer != identity {
+			return status.Errorf(codes.PermissionDenied, "node %q is registered to another peer", node.Id)
+		}
+		return nil
+	}
+
+	token := node.GetMetadata().GetFields()[r.metadataKey].GetStringValue()
+	if token == "" {
+		if md, ok := metadata.FromIncomingContext(ctx); ok && len(md.Get(r.header)) > 0 {
+			token = md.Get(r.header)[0]
+		}
+	}
+	if token == "" {
+		return status.Errorf(codes.Unauthenticated, "node %q is not registered", node.Id)
+	}
+	registration, err := r.validator.Validate(ctx, token, node)
+	if err != nil {
+		return status.Errorf(codes.PermissionDenied, "registration of node %q: %v", node.Id, err)
+	}
+	registration.Peer = identity
+	if r.onRegister != nil {
+		if err := r.onRegister(registration, node); err != nil {
+			return status.Errorf(codes.Unavailable, "registration of node %q: %v", node.Id, err)
+		}
+	}
+	r.Register(node.Id, registration)
+	return nil
+}
+
+// OnStreamOpen retains the stream context for the per-RPC credentials.
+func (r *Registry) OnStreamOpen(ctx context.Context, id int64, _ string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.streams[id] = ctx
+	return nil
+}
+
+// OnStreamClosed forgets the stream context.
+func (r *Registry) OnStreamClosed(id int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.streams, id)
+}
+
+// OnStreamRequest rejects the requests of the unregistered nodes without a
+// valid token.
+func (r *Registry) OnStreamRequest(id int64, req *discovery.DiscoveryRequest) error {
+	r.mu.RLock()
+	ctx := r.streams[id]
+	r.mu.RUnlock()
+	return r.register(ctx, req.Node)
+}
+
+// OnStreamResponse is a no-op.
+func (r *Registry) OnStreamResponse(int64, *discovery.DiscoveryRequest, *discovery.DiscoveryResponse) {
+}
+
+// OnFetchRequest rejects the requests of the unregistered nodes without a
+// valid token.
+func (r *Registry) OnFetchRequest(ctx context.Context, req *discovery.DiscoveryRequest) error {
+	return r.register(ctx, req.Node)
+}
+
+// OnFetchResponse is a no-op.
+func (r *Registry) OnFetchResponse(*discovery.DiscoveryRequest, *discovery.DiscoveryResponse) {
+}
@@ -0,0 +1,114 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package server_test
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"testing"
+	"time"
+
+	pstruct "github.com/golang/protobuf/ptypes/struct"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	discovery "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	"github.com/envoyproxy/go-control-plane/pkg/server/v2"
+)
+
+// withPeer returns a context of a peer presenting a certificate.
+func withPeer(ctx context.Context, cert string) context.Context {
+	return peer.NewContext(ctx, &peer.Peer{AuthInfo: credentials.TLSInfo{State: tls.ConnectionState{
+		PeerCertificates: []*x509.Certificate{{Raw: []byte(cert)}},
+	}}})
+}
+
+func TestRegistry(t *testing.T) {
+	tokens := server.NewTokens()
+	token, err := tokens.Issue(server.Registration{NodeID: "tenant-a/proxy-1", Tenant: "tenant-a"}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var registered []server.Registration
+	registry := server.NewRegistry(tokens, server.WithRegisterCallback(func(registration server.Registration, _ *core.Node) error {
+		registered = append(registered, registration)
+		return nil
+	}))
+
+	// unregistered nodes without a token are rejected
+	node := &core.Node{Id: "proxy-1"}
+	_ = registry.OnStreamOpen(withPeer(context.Background(), "proxy-1"), 1, "")
+	if err := registry.OnStreamRequest(1, &discovery.DiscoveryRequest{Node: node}); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("OnStreamRequest() without a token => got %v, want %v", err, codes.Unauthenticated)
+	}
+	if got := registry.ID(node); got != "proxy-1" {
+		t.Errorf("ID() of an unregistered node => got %q, want the presented ID", got)
+	}
+
+	// the token in the node metadata registers the node once
+	node.Metadata = &pstruct.Struct{Fields: map[string]*pstruct.Value{
+		server.DefaultTokenMetadataKey: {Kind: &pstruct.Value_StringValue{StringValue: token}},
+	}}
+	for i := 0; i < 2; i++ {
+		if err := registry.OnStreamRequest(1, &discovery.DiscoveryRequest{Node: node}); err != nil {
+			t.Fatalf("OnStreamRequest() with a token => got %v", err)
+		}
+	}
+	if got := registry.ID(node); got != "tenant-a/proxy-1" {
+		t.Errorf("ID() of a registered node => got %q, want the assigned ID", got)
+	}
+	if len(registered) != 1 || registered[0].Tenant != "tenant-a" {
+		t.Errorf("registrations => got %v, want one of tenant-a", registered)
+	}
+	registry.OnStreamClosed(1)
+
+	// the registration is bound to the peer that presented the token
+	_ = registry.OnStreamOpen(withPeer(context.Background(), "impostor"), 3, "")
+	if err := registry.OnStreamRequest(3, &discovery.DiscoveryRequest{Node: &core.Node{Id: "proxy-1"}}); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("OnStreamRequest() of another peer => got %v, want %v", err, codes.PermissionDenied)
+	}
+	_ = registry.OnStreamOpen(context.Background(), 4, "")
+	if err := registry.OnStreamRequest(4, &discovery.DiscoveryRequest{Node: &core.Node{Id: "proxy-1"}}); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("OnStreamRequest() without a peer certificate => got %v, want %v", err, codes.Unauthenticated)
+	}
+
+	// the tokens are one-time
+	registry.Unregister("proxy-1")
+	_ = registry.OnStreamOpen(withPeer(context.Background(), "proxy-1"), 2, "")
+	if err := registry.OnStreamRequest(2, &discovery.DiscoveryRequest{Node: node}); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("OnStreamRequest() with a used token => got %v, want %v", err, codes.PermissionDenied)
+	}
+
+	// the token in the per-RPC credentials
+	token, _ = tokens.Issue(server.Registration{NodeID: "tenant-b/proxy-2", Tenant: "tenant-b"}, time.Minute)
+	ctx := metadata.NewIncomingContext(withPeer(context.Background(), "proxy-2"), metadata.Pairs(server.DefaultTokenHeader, token))
+	if err := registry.OnFetchRequest(ctx, &discovery.DiscoveryRequest{Node: &core.Node{Id: "proxy-2"}}); err != nil {
+		t.Fatalf("OnFetchRequest() with a token => got %v", err)
+	}
+	if registration, _ := registry.Lookup("proxy-2"); registration.Tenant != "tenant-b" {
+		t.Errorf("Lookup() => got %v, want tenant-b", registration)
+	}
+
+	// expired tokens are rejected
+	token, _ = tokens.Issue(server.Registration{NodeID: "proxy-3"}, 0)
+	if _, err := tokens.Validate(context.Background(), token, nil); err == nil {
+		t.Error("Validate() of an expired token => got no error")
+	}
+}
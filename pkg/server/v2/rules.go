@@ -0,0 +1,328 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	discovery "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+)
+
+// Signals are the control plane signals evaluated by the alerting rules. The
+// counts are over the sliding window of the rules engine.
+type Signals struct {
+	Window time.Duration
+
+	// Responses and NACKs are the counts by type URL.
+	Responses map[string]int
+	NACKs     map[string]int
+
+	StreamsOpened int
+	StreamsClosed int
+	ActiveStreams int
+
+	// OldestPending is the age of the oldest response neither acknowledged
+	// nor rejected yet, or zero if none.
+	OldestPending time.Duration
+}
+
+// NACKRate returns the ratio of the NACKs to the responses of a type.
+func (s Signals) NACKRate(typeURL string) float64 {
+	if s.Responses[typeURL] == 0 {
+		return 0
+	}
+	return float64(s.NACKs[typeURL]) / float64(s.Responses[typeURL])
+}
+
+// Rule is an alerting predicate over the signals.
+type Rule struct {
+	Name  string
+	Level AlertLevel
+
+	// Condition describes the violation, or returns an empty string if the
+	// signals are healthy.
+	Condition func(Signals) string
+}
+
+// Alert reports a rule starting or ceasing to fire.
+type Alert struct {
+	Rule    string
+	Level   AlertLevel
+	Message string
+	Time    time.Time
+
+	// Resolved is set once the rule stops firing.
+	Resolved bool
+}
+
+// Notifier receives the alerts.
+type Notifier func(Alert)
+
+// DefaultRules encode the xDS operational practices:
+//
+//   - the clients reject under 10% of the responses of a type,
+//   - the clients acknowledge the responses within a minute,
+//   - the streams are long-lived, and do not reconnect within the window.
+func DefaultRules() []Rule {
+	return []Rule{{
+		Name:  "HighNACKRate",
+		Level: AlertError,
+		Condition: func(s Signals) string {
+			typeURLs := make([]string, 0, len(s.Responses))
+			for typeURL := range s.Responses {
+				typeURLs = append(typeURLs, typeURL)
+			}
+			sort.Strings(typeURLs)
+			for _, typeURL := range typeURLs {
+				if s.Responses[typeURL] >= 5 && s.NACKRate(typeURL) > 0.1 {
+					return fmt.Sprintf("%d of %d %s responses rejected", s.NACKs[typeURL], s.Responses[typeURL], typeURL)
+				}
+			}
+			return ""
+		},
+	}, {
+		Name:  "ConvergenceStall",
+		Level: AlertError,
+		Condition: func(s Signals) string {
+			if s.OldestPending > time.Minute {
+				return fmt.Sprintf("a response is not acknowledged for %v", s.OldestPending.Round(time.Second))
+			}
+			return ""
+		},
+	}, {
+		Name:  "StreamChurn",
+		Level: AlertWarning,
+		Condition: func(s Signals) string {
+			if s.StreamsClosed >= 10 && s.StreamsClosed > s.ActiveStreams {
+				return fmt.Sprintf("%d streams closed in %v with %d active", s.StreamsClosed, s.Window, s.ActiveStreams)
+			}
+			return ""
+		},
+	}}
+}
+
+// RulesEngine collects the signals as a set of server callbacks, and notifies
+// the alerts when the rules start or stop firing.
+type RulesEngine struct {
+	window    time.Duration
+	rules     []Rule
+	notifiers []Notifier
+	now       func() time.Time
+
+	responses []typedEvent
+	nacks     []typedEvent
+	opened    []time.Time
+	closed    []time.Time
+	active    map[int64]bool
+	pending   map[int64]map[string]pendingResponse
+	firing    map[string]bool
+	mu        sync.Mutex
+}
+
+type typedEvent struct {
+	time    time.Time
+	typeURL string
+}
+
+type pendingResponse struct {
+	nonce string
+	sent  time.Time
+}
+
+// RulesEngineOption configures the rules engine.
+type RulesEngineOption func(*RulesEngine)
+
+// WithRulesClock sets the clock of the rules engine.
+func WithRulesClock(now func() time.Time) RulesEngineOption {
+	return func(e *RulesEngine) {
+		e.now = now
+	}
+}
+
+// WithNotifiers registers the notifiers of the rules engine.
+func WithNotifiers(notifiers ...Notifier) RulesEngineOption {
+	return func(e *RulesEngine) {
+		e.notifiers = append(e.notifiers, notifiers...)
+	}
+}
+
+// NewRulesEngine creates a rules engine over a sliding window.
+func NewRulesEngine(window time.Duration, rules []Rule, opts ...RulesEngineOption) *RulesEngine {
+	e := &RulesEngine{
+		window:  window,
+		rules:   rules,
+		now:     time.Now,
+		active:  make(map[int64]bool),
+		pending: make(map[int64]map[string]pendingResponse),
+		firing:  make(map[string]bool),
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	return e
+}
+
+// Signals returns the current signals.
+func (e *RulesEngine) Signals() Signals {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	now := e.now()
+	e.prune(now)
+
+	out := Signals{
+		Window:        e.window,
+		Responses:     make(map[string]int),
+		NACKs:         make(map[string]int),
+		StreamsOpened: len(e.opened),
+		StreamsClosed: len(e.closed),
+		ActiveStreams: len(e.active),
+	}
+	for _, event := range e.responses {
+		out.Responses[event.typeURL]++
+	}
+	for _, event := range e.nacks {
+		out.NACKs[event.typeURL]++
+	}
+	for _, types := range e.pending {
+		for _, response := range types {
+			if age := now.Sub(response.sent); age > out.OldestPending {
+				out.OldestPending = age
+			}
+		}
+	}
+	return out
+}
+
+// Evaluate evaluates the rules and notifies the transitions.
+func (e *RulesEngine) Evaluate() {
+	signals := e.Signals()
+	now := e.now()
+
+	var alerts []Alert
+	e.mu.Lock()
+	for _, rule := range e.rules {
+		message := rule.Condition(signals)
+		firing := message != ""
+		if firing == e.firing[rule.Name] {
+			continue
+		}
+		e.firing[rule.Name] = firing
+		alerts = append(alerts, Alert{
+			Rule:     rule.Name,
+			Level:    rule.Level,
+			Message:  message,
+			Time:     now,
+			Resolved: !firing,
+		})
+	}
+	e.mu.Unlock()
+
+	for _, alert := range alerts {
+		for _, notify := range e.notifiers {
+			notify(alert)
+		}
+	}
+}
+
+// Run evaluates the rules at every interval until the context is done.
+func (e *RulesEngine) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			e.Evaluate()
+		}
+	}
+}
+
+// prune drops the events out of the window.
+func (e *RulesEngine) prune(now time.Time) {
+	start := now.Add(-e.window)
+	e.responses = pruneTyped(e.responses, start)
+	e.nacks = pruneTyped(e.nacks, start)
+	e.opened = pruneTimes(e.opened, start)
+	e.closed = pruneTimes(e.closed, start)
+}
+
+func pruneTyped(events []typedEvent, start time.Time) []typedEvent {
+	i := sort.Search(len(events), func(i int) bool { return !events[i].time.Before(start) })
+	return events[i:]
+}
+
+func pruneTimes(times []time.Time, start time.Time) []time.Time {
+	i := sort.Search(len(times), func(i int) bool { return !times[i].Before(start) })
+	return times[i:]
+}
+
+var _ Callbacks = &RulesEngine{}
+
+// OnStreamOpen records the stream.
+func (e *RulesEngine) OnStreamOpen(_ context.Context, id int64, _ string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.opened = append(e.opened, e.now())
+	e.active[id] = true
+	return nil
+}
+
+// OnStreamClosed records the stream closure.
+func (e *RulesEngine) OnStreamClosed(id int64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.closed = append(e.closed, e.now())
+	delete(e.active, id)
+	delete(e.pending, id)
+}
+
+// OnStreamRequest records the acknowledgements and the rejections.
+func (e *RulesEngine) OnStreamRequest(id int64, req *discovery.DiscoveryRequest) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if response, exists := e.pending[id][req.TypeUrl]; exists && response.nonce == req.ResponseNonce {
+		delete(e.pending[id], req.TypeUrl)
+	}
+	if req.ErrorDetail != nil {
+		e.nacks = append(e.nacks, typedEvent{time: e.now(), typeURL: req.TypeUrl})
+	}
+	return nil
+}
+
+// OnStreamResponse records the response awaiting the acknowledgement.
+func (e *RulesEngine) OnStreamResponse(id int64, _ *discovery.DiscoveryRequest, resp *discovery.DiscoveryResponse) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	now := e.now()
+	e.responses = append(e.responses, typedEvent{time: now, typeURL: resp.TypeUrl})
+	if e.pending[id] == nil {
+		e.pending[id] = make(map[string]pendingResponse)
+	}
+	e.pending[id][resp.TypeUrl] = pendingResponse{nonce: resp.Nonce, sent: now}
+}
+
+// OnFetchRequest is a no-op.
+func (e *RulesEngine) OnFetchRequest(context.Context, *discovery.DiscoveryRequest) error {
+	return nil
+}
+
+// OnFetchResponse is a no-op.
+func (e *RulesEngine) OnFetchResponse(*discovery.DiscoveryRequest, *discovery.DiscoveryResponse) {
+}
@@ -0,0 +1,89 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package server_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/status"
+
+	discovery "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	rsrc "github.com/envoyproxy/go-control-plane/pkg/resource/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/server/v2"
+)
+
+func TestRulesEngine(t *testing.T) {
+	now := time.Unix(0, 0)
+	var alerts []server.Alert
+	e := server.NewRulesEngine(time.Minute, server.DefaultRules(),
+		server.WithRulesClock(func() time.Time { return now }),
+		server.WithNotifiers(func(alert server.Alert) { alerts = append(alerts, alert) }))
+
+	// a client rejecting every other cluster response
+	if err := e.OnStreamOpen(context.Background(), 1, ""); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 6; i++ {
+		nonce := fmt.Sprint(i)
+		e.OnStreamResponse(1, nil, &discovery.DiscoveryResponse{TypeUrl: rsrc.ClusterType, Nonce: nonce})
+		req := &discovery.DiscoveryRequest{TypeUrl: rsrc.ClusterType, ResponseNonce: nonce}
+		if i%2 == 1 {
+			req.ErrorDetail = &status.Status{Message: "rejected"}
+		}
+		_ = e.OnStreamRequest(1, req)
+	}
+	if got := e.Signals(); got.NACKRate(rsrc.ClusterType) != 0.5 || got.OldestPending != 0 {
+		t.Errorf("Signals() => got %+v", got)
+	}
+	e.Evaluate()
+	if len(alerts) != 1 || alerts[0].Rule != "HighNACKRate" || alerts[0].Level != server.AlertError || alerts[0].Resolved {
+		t.Fatalf("alerts => got %+v, want high NACK rate", alerts)
+	}
+
+	// the alerts are only notified on transitions
+	e.Evaluate()
+	if len(alerts) != 1 {
+		t.Errorf("alerts => got %+v, want no repeated alert", alerts)
+	}
+
+	// an unacknowledged response stalls, and the NACKs leave the window
+	e.OnStreamResponse(1, nil, &discovery.DiscoveryResponse{TypeUrl: rsrc.RouteType, Nonce: "7"})
+	now = now.Add(2 * time.Minute)
+	e.Evaluate()
+	if len(alerts) != 3 {
+		t.Fatalf("alerts => got %+v, want resolved NACK rate and convergence stall", alerts)
+	}
+	if got := alerts[1]; got.Rule != "HighNACKRate" || !got.Resolved {
+		t.Errorf("NACK rate alert => got %+v, want resolved", got)
+	}
+	if got := alerts[2]; got.Rule != "ConvergenceStall" || got.Resolved || got.Message != "a response is not acknowledged for 2m0s" {
+		t.Errorf("stall alert => got %+v", got)
+	}
+
+	// the stalled stream reconnects repeatedly
+	e.OnStreamClosed(1)
+	for i := int64(2); i < 13; i++ {
+		_ = e.OnStreamOpen(context.Background(), i, "")
+		e.OnStreamClosed(i)
+	}
+	e.Evaluate()
+	last := alerts[len(alerts)-2:]
+	if last[0].Rule != "ConvergenceStall" || !last[0].Resolved || last[1].Rule != "StreamChurn" || last[1].Level != server.AlertWarning {
+		t.Errorf("alerts => got %+v, want resolved stall and stream churn", last)
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package server
+
+import (
+	"context"
+
+	pstruct "github.com/golang/protobuf/ptypes/struct"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	discovery "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/server/sotw/v2"
+)
+
+// The fields of the stream limits in a self configuration layer, see
+// HandleLimits.
+const (
+	ResponseRateField  = "server.response_rate"
+	ResponseBurstField = "server.response_burst"
+	RequestRateField   = "server.request_rate"
+	RequestBurstField  = "server.request_burst"
+	MuxBufferSizeField = "server.mux_buffer_size"
+)
+
+// HandleLimits applies the stream limits set in the layer of a self
+// configuration to the server, for the streams opened afterwards. The fields
+// are numbers, and a removed field restores the limit of the server at the
+// time of the call.
+func HandleLimits(config *cache.SelfConfig, s sotw.Server) {
+	defaults := s.Limits()
+	handle := func(field string, set func(*sotw.Limits, float64), fallback float64) {
+		config.Handle(field, func(value *pstruct.Value) {
+			n := fallback
+			if number, ok := value.GetKind().(*pstruct.Value_NumberValue); ok {
+				n = number.NumberValue
+			}
+			limits := s.Limits()
+			set(&limits, n)
+			s.SetLimits(limits)
+		})
+	}
+	handle(ResponseRateField, func(l *sotw.Limits, n float64) { l.ResponseRate = n }, defaults.ResponseRate)
+	handle(ResponseBurstField, func(l *sotw.Limits, n float64) { l.ResponseBurst = int(n) }, float64(defaults.ResponseBurst))
+	handle(RequestRateField, func(l *sotw.Limits, n float64) { l.RequestRate = n }, defaults.RequestRate)
+	handle(RequestBurstField, func(l *sotw.Limits, n float64) { l.RequestBurst = int(n) }, float64(defaults.RequestBurst))
+	handle(MuxBufferSizeField, func(l *sotw.Limits, n float64) { l.MuxBufferSize = int(n) }, float64(defaults.MuxBufferSize))
+}
+
+// GuardSelfNode wraps the callbacks to refuse the streams and the fetches of
+// the clients using the node ID of the self configuration with the
+// PermissionDenied status, so that the control plane settings are only read
+// in process. The callbacks may be nil.
+func GuardSelfNode(config *cache.SelfConfig, callbacks Callbacks) Callbacks {
+	if callbacks == nil {
+		callbacks = CallbackFuncs{}
+	}
+	return &selfGuard{Callbacks: callbacks, node: config.Node}
+}
+
+type selfGuard struct {
+	Callbacks
+	node string
+}
+
+func (g *selfGuard) check(req *discovery.DiscoveryRequest) error {
+	if req.GetNode().GetId() == g.node {
+		return status.Errorf(codes.PermissionDenied, "node %q is reserved for the control plane", g.node)
+	}
+	return nil
+}
+
+func (g *selfGuard) OnStreamRequest(id int64, req *discovery.DiscoveryRequest) error {
+	if err := g.check(req); err != nil {
+		return err
+	}
+	return g.Callbacks.OnStreamRequest(id, req)
+}
+
+func (g *selfGuard) OnFetchRequest(ctx context.Context, req *discovery.DiscoveryRequest) error {
+	if err := g.check(req); err != nil {
+		return err
+	}
+	return g.Callbacks.OnFetchRequest(ctx, req)
+}
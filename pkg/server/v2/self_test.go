@@ -0,0 +1,89 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package server_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	pstruct "github.com/golang/protobuf/ptypes/struct"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	discovery "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/v2"
+	rsrc "github.com/envoyproxy/go-control-plane/pkg/resource/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/server/sotw/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/server/v2"
+)
+
+func TestHandleLimits(t *testing.T) {
+	self := &cache.SelfConfig{
+		Cache: cache.NewSnapshotCache(false, cache.IDHash{}, nil),
+		Node:  "control-plane",
+		Layer: "self",
+	}
+	s := server.NewServer(context.Background(), makeMockConfigWatcher(), nil, sotw.WithRequestRateLimit(5, 5, nil))
+	server.HandleLimits(self, s)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go self.Run(ctx)
+
+	waitLimits := func(want sotw.Limits) {
+		t.Helper()
+		deadline := time.Now().Add(time.Second)
+		for s.Limits() != want {
+			if time.Now().After(deadline) {
+				t.Fatalf("Limits() => got %+v, want %+v", s.Limits(), want)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	num := func(n float64) *pstruct.Value {
+		return &pstruct.Value{Kind: &pstruct.Value_NumberValue{NumberValue: n}}
+	}
+
+	if err := self.Set(map[string]*pstruct.Value{server.RequestRateField: num(50), server.MuxBufferSizeField: num(16)}); err != nil {
+		t.Fatal(err)
+	}
+	waitLimits(sotw.Limits{RequestRate: 50, RequestBurst: 5, MuxBufferSize: 16})
+
+	// the removed fields restore the limits of the server
+	if err := self.Set(map[string]*pstruct.Value{server.ResponseRateField: num(1)}); err != nil {
+		t.Fatal(err)
+	}
+	waitLimits(sotw.Limits{ResponseRate: 1, RequestRate: 5, RequestBurst: 5, MuxBufferSize: sotw.DefaultMuxBufferSize})
+}
+
+func TestGuardSelfNode(t *testing.T) {
+	self := &cache.SelfConfig{Node: "control-plane", Layer: "self"}
+	callbacks := server.GuardSelfNode(self, nil)
+
+	req := &discovery.DiscoveryRequest{Node: &core.Node{Id: self.Node}, TypeUrl: rsrc.RuntimeType}
+	if err := callbacks.OnStreamRequest(1, req); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("stream request of the self node => got %v, want %v", err, codes.PermissionDenied)
+	}
+	if err := callbacks.OnFetchRequest(context.Background(), req); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("fetch request of the self node => got %v, want %v", err, codes.PermissionDenied)
+	}
+
+	req.Node.Id = "envoy"
+	if err := callbacks.OnStreamRequest(1, req); err != nil {
+		t.Errorf("stream request => got %v, want no error", err)
+	}
+}
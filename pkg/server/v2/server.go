@@ -18,6 +18,8 @@ package server
 import (
 	"context"
 	"errors"
+	"time"
+
 	"github.com/envoyproxy/go-control-plane/pkg/server/rest/v2"
 	"github.com/envoyproxy/go-control-plane/pkg/server/sotw/v2"
 	"google.golang.org/grpc/codes"
@@ -40,6 +42,7 @@ type Server interface {
 	endpointservice.EndpointDiscoveryServiceServer
 	clusterservice.ClusterDiscoveryServiceServer
 	routeservice.RouteDiscoveryServiceServer
+	routeservice.ScopedRoutesDiscoveryServiceServer
 	listenerservice.ListenerDiscoveryServiceServer
 	discoverygrpc.AggregatedDiscoveryServiceServer
 	secretservice.SecretDiscoveryServiceServer
@@ -116,11 +119,13 @@ func (c CallbackFuncs) OnFetchResponse(req *discovery.DiscoveryRequest, resp *di
 	}
 }
 
-// NewServer creates handlers from a config watcher and callbacks.
-func NewServer(ctx context.Context, config cache.Cache, callbacks Callbacks) Server {
-	return NewServerAdvanced(rest.NewServer(config, callbacks), sotw.NewServer(ctx, config, callbacks))
+// NewServer creates handlers from a config watcher and callbacks, with the
+// options of the stream handlers.
+func NewServer(ctx context.Context, config cache.Cache, callbacks Callbacks, opts ...sotw.ServerOption) Server {
+	return NewServerAdvanced(rest.NewServer(config, callbacks), sotw.NewServer(ctx, config, callbacks, opts...))
 }
 
+// NewServerAdvanced creates handlers from the REST and SotW servers.
 func NewServerAdvanced(restServer rest.Server, sotwServer sotw.Server) Server {
 	return &server{rest: restServer, sotw: sotwServer}
 }
@@ -134,6 +139,18 @@ func (s *server) StreamHandler(stream sotw.Stream, typeURL string) error {
 	return s.sotw.StreamHandler(stream, typeURL)
 }
 
+func (s *server) DisconnectNode(node string, st *status.Status, delay time.Duration) int {
+	return s.sotw.DisconnectNode(node, st, delay)
+}
+
+func (s *server) Limits() sotw.Limits {
+	return s.sotw.Limits()
+}
+
+func (s *server) SetLimits(limits sotw.Limits) {
+	s.sotw.SetLimits(limits)
+}
+
 func (s *server) StreamAggregatedResources(stream discoverygrpc.AggregatedDiscoveryService_StreamAggregatedResourcesServer) error {
 	return s.StreamHandler(stream, resource.AnyType)
 }
@@ -150,6 +167,10 @@ func (s *server) StreamRoutes(stream routeservice.RouteDiscoveryService_StreamRo
 	return s.StreamHandler(stream, resource.RouteType)
 }
 
+func (s *server) StreamScopedRoutes(stream routeservice.ScopedRoutesDiscoveryService_StreamScopedRoutesServer) error {
+	return s.StreamHandler(stream, resource.ScopedRouteType)
+}
+
 func (s *server) StreamListeners(stream listenerservice.ListenerDiscoveryService_StreamListenersServer) error {
 	return s.StreamHandler(stream, resource.ListenerType)
 }
@@ -191,6 +212,14 @@ func (s *server) FetchRoutes(ctx context.Context, req *discovery.DiscoveryReques
 	return s.Fetch(ctx, req)
 }
 
+func (s *server) FetchScopedRoutes(ctx context.Context, req *discovery.DiscoveryRequest) (*discovery.DiscoveryResponse, error) {
+	if req == nil {
+		return nil, status.Errorf(codes.Unavailable, "empty request")
+	}
+	req.TypeUrl = resource.ScopedRouteType
+	return s.Fetch(ctx, req)
+}
+
 func (s *server) FetchListeners(ctx context.Context, req *discovery.DiscoveryRequest) (*discovery.DiscoveryResponse, error) {
 	if req == nil {
 		return nil, status.Errorf(codes.Unavailable, "empty request")
@@ -231,6 +260,10 @@ func (s *server) DeltaRoutes(_ routeservice.RouteDiscoveryService_DeltaRoutesSer
 	return errors.New("not implemented")
 }
 
+func (s *server) DeltaScopedRoutes(_ routeservice.ScopedRoutesDiscoveryService_DeltaScopedRoutesServer) error {
+	return errors.New("not implemented")
+}
+
 func (s *server) DeltaListeners(_ listenerservice.ListenerDiscoveryService_DeltaListenersServer) error {
 	return errors.New("not implemented")
 }
@@ -0,0 +1,81 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package server
+
+import (
+	"google.golang.org/grpc"
+
+	clusterservice "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	endpointservice "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	listenerservice "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	routeservice "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	discoverygrpc "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v2"
+	runtimeservice "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v2"
+	secretservice "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/resource/v2"
+)
+
+// RegisterOption sets an option of RegisterServices.
+type RegisterOption func(map[string]bool)
+
+// WithoutADS skips the aggregated discovery service.
+func WithoutADS() RegisterOption {
+	return func(skipped map[string]bool) {
+		skipped[resource.AnyType] = true
+	}
+}
+
+// WithoutServices skips the discovery services of the type URLs, e.g. the
+// secret discovery service of resource.SecretType.
+func WithoutServices(typeURLs ...string) RegisterOption {
+	return func(skipped map[string]bool) {
+		for _, typeURL := range typeURLs {
+			skipped[typeURL] = true
+		}
+	}
+}
+
+// RegisterServices registers the aggregated and the per-type discovery
+// services of the server on a gRPC server.
+func RegisterServices(grpcServer *grpc.Server, srv Server, opts ...RegisterOption) {
+	skipped := make(map[string]bool)
+	for _, opt := range opts {
+		opt(skipped)
+	}
+	if !skipped[resource.AnyType] {
+		discoverygrpc.RegisterAggregatedDiscoveryServiceServer(grpcServer, srv)
+	}
+	if !skipped[resource.EndpointType] {
+		endpointservice.RegisterEndpointDiscoveryServiceServer(grpcServer, srv)
+	}
+	if !skipped[resource.ClusterType] {
+		clusterservice.RegisterClusterDiscoveryServiceServer(grpcServer, srv)
+	}
+	if !skipped[resource.RouteType] {
+		routeservice.RegisterRouteDiscoveryServiceServer(grpcServer, srv)
+	}
+	if !skipped[resource.ScopedRouteType] {
+		routeservice.RegisterScopedRoutesDiscoveryServiceServer(grpcServer, srv)
+	}
+	if !skipped[resource.ListenerType] {
+		listenerservice.RegisterListenerDiscoveryServiceServer(grpcServer, srv)
+	}
+	if !skipped[resource.SecretType] {
+		secretservice.RegisterSecretDiscoveryServiceServer(grpcServer, srv)
+	}
+	if !skipped[resource.RuntimeType] {
+		runtimeservice.RegisterRuntimeDiscoveryServiceServer(grpcServer, srv)
+	}
+}
@@ -0,0 +1,48 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package server_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+
+	rsrc "github.com/envoyproxy/go-control-plane/pkg/resource/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/server/v2"
+)
+
+func TestRegisterServices(t *testing.T) {
+	srv := server.NewServer(context.Background(), makeMockConfigWatcher(), nil)
+
+	all := grpc.NewServer()
+	server.RegisterServices(all, srv)
+	if got := len(all.GetServiceInfo()); got != 8 {
+		t.Errorf("registered services => got %d, want 8", got)
+	}
+
+	some := grpc.NewServer()
+	server.RegisterServices(some, srv, server.WithoutADS(), server.WithoutServices(rsrc.SecretType))
+	info := some.GetServiceInfo()
+	if got := len(info); got != 6 {
+		t.Errorf("registered services without ADS and SDS => got %d, want 6", got)
+	}
+	for name := range info {
+		if strings.HasSuffix(name, "AggregatedDiscoveryService") || strings.HasSuffix(name, "SecretDiscoveryService") {
+			t.Errorf("registered services => got %s, want it skipped", name)
+		}
+	}
+}
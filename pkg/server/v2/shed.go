@@ -0,0 +1,331 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package server
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+
+	discovery "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/server/sotw/v2"
+)
+
+// ShedAction is a load shedding step.
+type ShedAction int
+
+const (
+	// ShedResponseCache evicts the marshaled response cache.
+	ShedResponseCache ShedAction = iota
+	// ShedPauseTypes holds the watches for the low-priority types.
+	ShedPauseTypes
+	// ShedRejectStreams rejects new streams with a retryable status.
+	ShedRejectStreams
+	// ShedRecover resumes the normal operation.
+	ShedRecover
+)
+
+func (action ShedAction) String() string {
+	switch action {
+	case ShedResponseCache:
+		return "evict response cache"
+	case ShedPauseTypes:
+		return "pause low-priority types"
+	case ShedRejectStreams:
+		return "reject new streams"
+	case ShedRecover:
+		return "recover"
+	}
+	return "unknown"
+}
+
+// LoadShedder enforces a soft memory limit. Once the retained memory exceeds
+// the limit, it evicts the response cache, pauses the low-priority types and
+// rejects new streams until the memory falls under the limit again.
+//
+// The shedder is a set of server callbacks rejecting the streams, and a cache
+// wrapper pausing the watches:
+//
+//	shedder := NewLoadShedder(limit, WithLowPriorityTypes(resource.RuntimeType))
+//	srv := NewServer(ctx, shedder.Cache(snapshotCache), shedder)
+//	go shedder.Run(ctx, time.Second)
+type LoadShedder struct {
+	limit       uint64
+	measure     func() uint64
+	responses   *cache.ResponseCache
+	lowPriority map[string]bool
+	observe     func(ShedAction, uint64)
+
+	shedding bool
+	interval time.Duration
+	pending  []*pendingWatch
+	mu       sync.Mutex
+}
+
+// LoadShedderOption configures the load shedder.
+type LoadShedderOption func(*LoadShedder)
+
+// WithMemoryMeasure sets the function measuring the retained memory in bytes.
+// The default is the heap memory in use.
+func WithMemoryMeasure(measure func() uint64) LoadShedderOption {
+	return func(l *LoadShedder) {
+		l.measure = measure
+	}
+}
+
+// WithSheddableResponseCache sets the response cache evicted on overload.
+func WithSheddableResponseCache(responses *cache.ResponseCache) LoadShedderOption {
+	return func(l *LoadShedder) {
+		l.responses = responses
+	}
+}
+
+// WithLowPriorityTypes sets the type URLs paused on overload.
+func WithLowPriorityTypes(typeURLs ...string) LoadShedderOption {
+	return func(l *LoadShedder) {
+		for _, typeURL := range typeURLs {
+			l.lowPriority[typeURL] = true
+		}
+	}
+}
+
+// WithShedObserver sets a hook invoked with each action and the measured memory.
+func WithShedObserver(observe func(ShedAction, uint64)) LoadShedderOption {
+	return func(l *LoadShedder) {
+		l.observe = observe
+	}
+}
+
+// NewLoadShedder creates a load shedder for a memory limit in bytes.
+func NewLoadShedder(limit uint64, opts ...LoadShedderOption) *LoadShedder {
+	l := &LoadShedder{
+		limit:       limit,
+		measure:     heapInUse,
+		lowPriority: make(map[string]bool),
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
+}
+
+func heapInUse() uint64 {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	return stats.HeapInuse
+}
+
+// Shedding reports whether the shedder is active.
+func (l *LoadShedder) Shedding() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.shedding
+}
+
+// Check measures the memory and starts or stops shedding.
+func (l *LoadShedder) Check() {
+	usage := l.measure()
+
+	l.mu.Lock()
+	var actions []ShedAction
+	var resumed []*pendingWatch
+	switch {
+	case usage > l.limit && !l.shedding:
+		l.shedding = true
+		if l.responses != nil {
+			l.responses.Purge()
+			actions = append(actions, ShedResponseCache)
+		}
+		if len(l.lowPriority) > 0 {
+			actions = append(actions, ShedPauseTypes)
+		}
+		actions = append(actions, ShedRejectStreams)
+	case usage <= l.limit && l.shedding:
+		l.shedding = false
+		resumed, l.pending = l.pending, nil
+		actions = append(actions, ShedRecover)
+	}
+	l.mu.Unlock()
+
+	for _, watch := range resumed {
+		watch.resume()
+	}
+	if l.observe != nil {
+		for _, action := range actions {
+			l.observe(action, usage)
+		}
+	}
+}
+
+// Run checks the memory at every interval until the context is done.
+func (l *LoadShedder) Run(ctx context.Context, interval time.Duration) {
+	l.mu.Lock()
+	l.interval = interval
+	l.mu.Unlock()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			l.Check()
+		}
+	}
+}
+
+// Cache wraps a cache to hold the watches for the low-priority types while
+// shedding. The held watches are opened once the shedding stops.
+func (l *LoadShedder) Cache(c cache.Cache) cache.Cache {
+	return &shedCache{Cache: c, shedder: l}
+}
+
+type shedCache struct {
+	cache.Cache
+	shedder *LoadShedder
+}
+
+// pendingWatch is a watch held while shedding.
+type pendingWatch struct {
+	shedder *LoadShedder
+	cache   cache.ConfigWatcher
+	request *cache.Request
+	out     chan cache.Response
+
+	cancelled bool
+	cancel    func()
+	done      chan struct{}
+	mu        sync.Mutex
+}
+
+func (c *shedCache) CreateWatch(request *cache.Request) (chan cache.Response, func()) {
+	l := c.shedder
+	l.mu.Lock()
+	if !l.shedding || !l.lowPriority[request.TypeUrl] {
+		l.mu.Unlock()
+		return c.Cache.CreateWatch(request)
+	}
+	watch := &pendingWatch{
+		shedder: l,
+		cache:   c.Cache,
+		request: request,
+		out:     make(chan cache.Response, 1),
+		done:    make(chan struct{}),
+	}
+	l.pending = append(l.pending, watch)
+	l.mu.Unlock()
+
+	return watch.out, watch.stop
+}
+
+// resume opens the held watch and forwards its response, or its closing.
+func (w *pendingWatch) resume() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.cancelled {
+		return
+	}
+	value, cancel := w.cache.CreateWatch(w.request)
+	w.cancel = cancel
+	go func() {
+		select {
+		case resp, more := <-value:
+			if more {
+				w.out <- resp
+			} else {
+				close(w.out)
+			}
+		case <-w.done:
+		}
+	}()
+}
+
+// stop cancels the watch, and releases it unless it is resumed.
+func (w *pendingWatch) stop() {
+	w.shedder.release(w)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.cancelled {
+		return
+	}
+	w.cancelled = true
+	close(w.done)
+	if w.cancel != nil {
+		w.cancel()
+	}
+}
+
+// release removes a cancelled watch from the held watches.
+func (l *LoadShedder) release(watch *pendingWatch) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i, pending := range l.pending {
+		if pending == watch {
+			l.pending = append(l.pending[:i], l.pending[i+1:]...)
+			return
+		}
+	}
+}
+
+var _ Callbacks = &LoadShedder{}
+
+// shedError asks the clients to retry after the next check of the memory, or
+// after a second if the checks do not run periodically.
+func (l *LoadShedder) shedError() error {
+	l.mu.Lock()
+	delay := l.interval
+	l.mu.Unlock()
+	if delay <= 0 {
+		delay = time.Second
+	}
+	return sotw.RetryError(codes.Unavailable, delay, "control plane is shedding load")
+}
+
+// OnStreamOpen rejects new streams while shedding.
+func (l *LoadShedder) OnStreamOpen(context.Context, int64, string) error {
+	if l.Shedding() {
+		return l.shedError()
+	}
+	return nil
+}
+
+// OnStreamClosed is a no-op.
+func (l *LoadShedder) OnStreamClosed(int64) {}
+
+// OnStreamRequest is a no-op.
+func (l *LoadShedder) OnStreamRequest(int64, *discovery.DiscoveryRequest) error {
+	return nil
+}
+
+// OnStreamResponse is a no-op.
+func (l *LoadShedder) OnStreamResponse(int64, *discovery.DiscoveryRequest, *discovery.DiscoveryResponse) {
+}
+
+// OnFetchRequest rejects fetches while shedding.
+func (l *LoadShedder) OnFetchRequest(context.Context, *discovery.DiscoveryRequest) error {
+	if l.Shedding() {
+		return l.shedError()
+	}
+	return nil
+}
+
+// OnFetchResponse is a no-op.
+func (l *LoadShedder) OnFetchResponse(*discovery.DiscoveryRequest, *discovery.DiscoveryResponse) {
+}
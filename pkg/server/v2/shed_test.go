@@ -0,0 +1,120 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package server_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/envoyproxy/go-control-plane/pkg/cache/v2"
+	rsrc "github.com/envoyproxy/go-control-plane/pkg/resource/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/server/v2"
+)
+
+func TestLoadShedder(t *testing.T) {
+	var usage uint64
+	var actions []server.ShedAction
+	responses := cache.NewResponseCache(0, 0)
+	shedder := server.NewLoadShedder(100,
+		server.WithMemoryMeasure(func() uint64 { return usage }),
+		server.WithSheddableResponseCache(responses),
+		server.WithLowPriorityTypes(rsrc.RuntimeType),
+		server.WithShedObserver(func(action server.ShedAction, _ uint64) {
+			actions = append(actions, action)
+		}))
+
+	config := makeMockConfigWatcher()
+	config.responses = makeResponses()
+	c := shedder.Cache(config)
+
+	shedder.Check()
+	if shedder.Shedding() || len(actions) != 0 {
+		t.Fatalf("shedding under the limit, actions %v", actions)
+	}
+
+	usage = 200
+	shedder.Check()
+	want := []server.ShedAction{server.ShedResponseCache, server.ShedPauseTypes, server.ShedRejectStreams}
+	if !shedder.Shedding() || !reflect.DeepEqual(actions, want) {
+		t.Errorf("actions => got %v, want %v", actions, want)
+	}
+	if err := shedder.OnStreamOpen(context.Background(), 1, ""); status.Code(err) != codes.Unavailable {
+		t.Errorf("OnStreamOpen() => got %v, want %v", err, codes.Unavailable)
+	}
+
+	// low-priority watches are held, others are not
+	runtimes, _ := c.CreateWatch(&cache.Request{TypeUrl: rsrc.RuntimeType})
+	clusters, _ := c.CreateWatch(&cache.Request{TypeUrl: rsrc.ClusterType})
+	if config.counts[rsrc.RuntimeType] != 0 || config.counts[rsrc.ClusterType] != 1 {
+		t.Errorf("watches => got %v", config.counts)
+	}
+	select {
+	case <-clusters:
+	default:
+		t.Error("expected a cluster response")
+	}
+
+	actions = nil
+	usage = 50
+	shedder.Check()
+	if shedder.Shedding() || !reflect.DeepEqual(actions, []server.ShedAction{server.ShedRecover}) {
+		t.Errorf("actions => got %v, want %v", actions, server.ShedRecover)
+	}
+	if err := shedder.OnStreamOpen(context.Background(), 2, ""); err != nil {
+		t.Errorf("OnStreamOpen() => got %v", err)
+	}
+	select {
+	case <-runtimes:
+	case <-time.After(time.Second):
+		t.Error("expected the held runtime watch to be resumed")
+	}
+}
+
+func TestLoadShedderHeldWatches(t *testing.T) {
+	usage := uint64(200)
+	shedder := server.NewLoadShedder(100,
+		server.WithMemoryMeasure(func() uint64 { return usage }),
+		server.WithLowPriorityTypes(rsrc.RuntimeType))
+	config := makeMockConfigWatcher()
+	config.closeWatch = true
+	c := shedder.Cache(config)
+	shedder.Check()
+
+	// the cancelled watches are not resumed
+	_, cancel := c.CreateWatch(&cache.Request{TypeUrl: rsrc.RuntimeType})
+	cancel()
+	runtimes, _ := c.CreateWatch(&cache.Request{TypeUrl: rsrc.RuntimeType})
+
+	usage = 50
+	shedder.Check()
+	if config.counts[rsrc.RuntimeType] != 1 {
+		t.Errorf("resumed watches => got %d, want 1", config.counts[rsrc.RuntimeType])
+	}
+
+	// the closing of the resumed watches is forwarded
+	select {
+	case resp, more := <-runtimes:
+		if more {
+			t.Errorf("resumed watch => got %v, want closed", resp)
+		}
+	case <-time.After(time.Second):
+		t.Error("expected the resumed runtime watch to be closed")
+	}
+}
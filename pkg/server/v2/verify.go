@@ -0,0 +1,132 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/envoyproxy/go-control-plane/pkg/cache/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/log"
+	"github.com/envoyproxy/go-control-plane/pkg/resource/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/server/sotw/v2"
+)
+
+// Wiring describes how a server is put together, for Verify. It is filled in
+// by the caller, with the values it passes to the constructors of the cache,
+// the server and the gRPC server: the servers and the caches do not expose
+// their settings, and Verify cannot tell a Wiring that differs from them.
+type Wiring struct {
+	// Cache is the cache of the server.
+	Cache cache.Cache
+
+	// Callbacks are the server callbacks, if any.
+	Callbacks Callbacks
+
+	// Logger is the logger of the cache.
+	Logger log.Logger
+
+	// ADSTypes are the type URLs the clients request over ADS, if served.
+	ADSTypes []string
+
+	// MuxBufferSize is the buffer set with sotw.WithMuxBufferSize, zero for
+	// the default.
+	MuxBufferSize int
+
+	// Delta is set if the clients use the incremental xDS variants.
+	Delta bool
+
+	// Types are the type URLs the clients request over the per-type
+	// services, one stream each.
+	Types []string
+
+	// MaxConcurrentStreams is the limit set with grpc.MaxConcurrentStreams,
+	// zero if unset.
+	MaxConcurrentStreams uint32
+}
+
+// VerifyError lists the misconfigurations found by Verify.
+type VerifyError struct {
+	Problems []string
+}
+
+func (e *VerifyError) Error() string {
+	return fmt.Sprintf("%d server misconfigurations: %s", len(e.Problems), strings.Join(e.Problems, "; "))
+}
+
+// dedicatedTypes have a dedicated watch on the streams and do not use the
+// muxed response buffer.
+var dedicatedTypes = map[string]bool{
+	resource.EndpointType: true,
+	resource.ClusterType:  true,
+	resource.RouteType:    true,
+	resource.ListenerType: true,
+	resource.SecretType:   true,
+	resource.RuntimeType:  true,
+}
+
+// Verify checks a described wiring for the known misconfigurations, to fail
+// at startup instead of on the first clients:
+//
+//	if err := server.Verify(server.Wiring{Cache: snapshotCache, Logger: logger, ADSTypes: types}); err != nil {
+//		log.Fatal(err)
+//	}
+//
+// All the problems found are reported at once with a *VerifyError.
+func Verify(w Wiring) error {
+	var problems []string
+	if w.Cache == nil {
+		problems = append(problems, "no cache: pass a cache to NewServer")
+	} else if v := reflect.ValueOf(w.Cache); v.Kind() == reflect.Ptr && v.IsNil() {
+		problems = append(problems, fmt.Sprintf("the cache is a nil %T: create it with its constructor", w.Cache))
+	}
+	if w.Callbacks != nil {
+		if v := reflect.ValueOf(w.Callbacks); v.Kind() == reflect.Ptr && v.IsNil() {
+			problems = append(problems, fmt.Sprintf("the callbacks are a nil %T, which panics on the first stream: pass nil callbacks instead", w.Callbacks))
+		}
+	}
+	if w.Logger == nil {
+		problems = append(problems, "no logger: the cache drops its warnings, pass a logger to the cache constructor")
+	}
+	if w.Delta {
+		problems = append(problems, "the server does not implement the incremental xDS variants: configure the clients with the state-of-the-world variants")
+	}
+
+	bufferSize := w.MuxBufferSize
+	if bufferSize == 0 {
+		bufferSize = sotw.DefaultMuxBufferSize
+	}
+	var muxed []string
+	for _, typeURL := range w.ADSTypes {
+		if !dedicatedTypes[typeURL] {
+			muxed = append(muxed, typeURL)
+		}
+	}
+	if len(muxed) > bufferSize {
+		problems = append(problems, fmt.Sprintf("the ADS response buffer of %d is smaller than the %d muxed types %v: raise it with sotw.WithMuxBufferSize",
+			bufferSize, len(muxed), muxed))
+	}
+
+	if w.MaxConcurrentStreams > 0 && len(w.Types) > int(w.MaxConcurrentStreams) {
+		problems = append(problems, fmt.Sprintf("the clients open %d streams, one per type, but the gRPC server allows %d per connection: raise grpc.MaxConcurrentStreams or use ADS",
+			len(w.Types), w.MaxConcurrentStreams))
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+	return &VerifyError{Problems: problems}
+}
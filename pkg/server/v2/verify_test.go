@@ -0,0 +1,60 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package server_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/envoyproxy/go-control-plane/pkg/cache/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/log"
+	rsrc "github.com/envoyproxy/go-control-plane/pkg/resource/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/server/v2"
+)
+
+func TestVerify(t *testing.T) {
+	logger := log.LoggerFuncs{}
+	c := cache.NewSnapshotCache(true, cache.IDHash{}, logger)
+	if err := server.Verify(server.Wiring{Cache: c, Logger: logger, ADSTypes: []string{rsrc.ClusterType, rsrc.ScopedRouteType}}); err != nil {
+		t.Errorf("Verify() => got %v, want no error", err)
+	}
+
+	var nilCallbacks *server.NodeNormalizer
+	muxed := []string{rsrc.ClusterType, rsrc.ScopedRouteType}
+	for i := 0; i < 5; i++ {
+		muxed = append(muxed, "type.googleapis.com/opaque"+string(rune('a'+i)))
+	}
+	err := server.Verify(server.Wiring{
+		Cache:                c,
+		Callbacks:            nilCallbacks,
+		ADSTypes:             muxed,
+		Delta:                true,
+		Types:                []string{rsrc.ClusterType, rsrc.ListenerType},
+		MaxConcurrentStreams: 1,
+	})
+	verr, ok := err.(*server.VerifyError)
+	if !ok || len(verr.Problems) != 5 {
+		t.Fatalf("Verify() => got %v, want 5 problems", err)
+	}
+	for i, want := range []string{"callbacks", "logger", "incremental", "ADS response buffer", "MaxConcurrentStreams"} {
+		if !strings.Contains(verr.Problems[i], want) {
+			t.Errorf("problem %d => got %q, want %q", i, verr.Problems[i], want)
+		}
+	}
+
+	if err := server.Verify(server.Wiring{Cache: c, Logger: logger, ADSTypes: muxed, MuxBufferSize: 8}); err != nil {
+		t.Errorf("Verify() with a larger buffer => got %v, want no error", err)
+	}
+}
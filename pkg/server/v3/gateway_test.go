@@ -17,6 +17,7 @@ package server_test
 
 import (
 	"context"
+	"encoding/json"
 	"io"
 	"net/http"
 	"strings"
@@ -26,6 +27,7 @@ import (
 	discovery "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
 	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
 	"github.com/envoyproxy/go-control-plane/pkg/cache/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/openapi"
 	"github.com/envoyproxy/go-control-plane/pkg/resource/v3"
 	rsrc "github.com/envoyproxy/go-control-plane/pkg/resource/v3"
 	"github.com/envoyproxy/go-control-plane/pkg/server/v3"
@@ -124,4 +126,22 @@ func TestGateway(t *testing.T) {
 			t.Errorf("handler returned wrong status: %d, want %d", status, 200)
 		}
 	}
+
+	req, err := http.NewRequest(http.MethodGet, server.OpenAPIPath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, code, err := gtw.ServeHTTP(req)
+	if code != http.StatusOK || err != nil {
+		t.Fatalf("openapi => got %d %v", code, err)
+	}
+	var doc openapi.Document
+	if err := json.Unmarshal(resp, &doc); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{resource.FetchClusters, resource.FetchRoutes, resource.FetchListeners} {
+		if op := doc.Paths[path]["post"]; op == nil || op.RequestBody == nil {
+			t.Errorf("openapi %s => got %+v", path, doc.Paths[path])
+		}
+	}
 }
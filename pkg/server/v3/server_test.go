@@ -16,26 +16,38 @@
 package server_test
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
+	"net/url"
 	"reflect"
+	"runtime/pprof"
+	"strings"
 	"testing"
 	"time"
 
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	rpcstatus "google.golang.org/genproto/googleapis/rpc/status"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
 	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
 	discovery "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	envoy_type "github.com/envoyproxy/go-control-plane/envoy/type/v3"
 	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
 	"github.com/envoyproxy/go-control-plane/pkg/cache/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/log"
 	rsrc "github.com/envoyproxy/go-control-plane/pkg/resource/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/server/sotw/v3"
 	"github.com/envoyproxy/go-control-plane/pkg/server/v3"
 	"github.com/envoyproxy/go-control-plane/pkg/test/resource/v3"
 )
 
 type mockConfigWatcher struct {
 	counts     map[string]int
+	names      map[string][]string
 	responses  map[string][]cache.Response
 	closeWatch bool
 	watches    int
@@ -43,6 +55,7 @@ type mockConfigWatcher struct {
 
 func (config *mockConfigWatcher) CreateWatch(req *discovery.DiscoveryRequest) (chan cache.Response, func()) {
 	config.counts[req.TypeUrl] = config.counts[req.TypeUrl] + 1
+	config.names[req.TypeUrl] = req.ResourceNames
 	out := make(chan cache.Response, 1)
 	if len(config.responses[req.TypeUrl]) > 0 {
 		out <- config.responses[req.TypeUrl][0]
@@ -72,6 +85,7 @@ func (config *mockConfigWatcher) Fetch(ctx context.Context, req *discovery.Disco
 func makeMockConfigWatcher() *mockConfigWatcher {
 	return &mockConfigWatcher{
 		counts: make(map[string]int),
+		names:  make(map[string][]string),
 	}
 }
 
@@ -448,6 +462,103 @@ func TestWatchClosed(t *testing.T) {
 	}
 }
 
+func TestTypeIsolation(t *testing.T) {
+	for _, typ := range testTypes {
+		if typ == rsrc.ListenerType {
+			continue
+		}
+		t.Run(typ, func(t *testing.T) {
+			config := makeMockConfigWatcher()
+			config.responses = map[string][]cache.Response{rsrc.ListenerType: makeResponses()[rsrc.ListenerType]}
+			config.closeWatch = true
+			failures := make(chan string, 1)
+			s := server.NewServer(context.Background(), config, server.CallbackFuncs{},
+				sotw.WithTypeIsolation(func(_ int64, typeURL string, err error) {
+					if status.Code(err) != codes.Unavailable {
+						t.Errorf("failure => got %v, want unavailable", err)
+					}
+					failures <- typeURL
+				}))
+
+			resp := makeMockStream(t)
+			resp.recv <- &discovery.DiscoveryRequest{Node: node, TypeUrl: typ}
+			resp.recv <- &discovery.DiscoveryRequest{TypeUrl: rsrc.ListenerType}
+			done := make(chan error)
+			go func() {
+				done <- s.StreamAggregatedResources(resp)
+			}()
+
+			select {
+			case got := <-failures:
+				if got != typ {
+					t.Errorf("failed type => got %q, want %q", got, typ)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("no type failure")
+			}
+			select {
+			case out := <-resp.sent:
+				if out.TypeUrl != rsrc.ListenerType {
+					t.Errorf("response => got %q, want %q", out.TypeUrl, rsrc.ListenerType)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("no listener response")
+			}
+			close(resp.recv)
+			if err := <-done; err != nil {
+				t.Errorf("StreamAggregatedResources() => got %v, want no error", err)
+			}
+		})
+	}
+}
+
+func TestResponseFilters(t *testing.T) {
+	filters := sotw.NewResponseFilters()
+	filters.Register(sotw.StageAuthz, rsrc.RouteType, func(context.Context, int64, *discovery.DiscoveryRequest, *discovery.DiscoveryResponse) (*discovery.DiscoveryResponse, error) {
+		return nil, status.Error(codes.PermissionDenied, "routes denied")
+	})
+	filters.Register(sotw.StageRedact, rsrc.ClusterType, func(_ context.Context, _ int64, _ *discovery.DiscoveryRequest, resp *discovery.DiscoveryResponse) (*discovery.DiscoveryResponse, error) {
+		for _, res := range resp.Resources {
+			res.Value = nil
+		}
+		return resp, nil
+	})
+
+	config := makeMockConfigWatcher()
+	config.responses = makeResponses()
+	cluster := config.responses[rsrc.ClusterType][0]
+	var callbackValue []byte
+	s := server.NewServer(context.Background(), config, server.CallbackFuncs{
+		StreamResponseFunc: func(_ int64, _ *discovery.DiscoveryRequest, resp *discovery.DiscoveryResponse) {
+			callbackValue = resp.Resources[0].Value
+		},
+	}, sotw.WithResponseFilters(filters))
+
+	resp := makeMockStream(t)
+	resp.recv <- &discovery.DiscoveryRequest{Node: node, TypeUrl: rsrc.ClusterType}
+	done := make(chan error)
+	go func() {
+		done <- s.StreamAggregatedResources(resp)
+	}()
+	select {
+	case out := <-resp.sent:
+		if len(out.Resources[0].Value) != 0 || len(callbackValue) != 0 {
+			t.Errorf("redacted cluster => got %v sent and %v in callback, want empty", out.Resources[0].Value, callbackValue)
+		}
+		original, _ := cluster.GetDiscoveryResponse()
+		if len(original.Resources[0].Value) == 0 {
+			t.Error("cached cluster => got redacted, want unmodified")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no cluster response")
+	}
+
+	resp.recv <- &discovery.DiscoveryRequest{TypeUrl: rsrc.RouteType}
+	if err := <-done; status.Code(err) != codes.PermissionDenied {
+		t.Errorf("denied routes => got %v, want permission denied", err)
+	}
+}
+
 func TestSendError(t *testing.T) {
 	for _, typ := range testTypes {
 		t.Run(typ, func(t *testing.T) {
@@ -652,3 +763,438 @@ func TestCallbackError(t *testing.T) {
 		})
 	}
 }
+
+func TestDisconnectNode(t *testing.T) {
+	config := makeMockConfigWatcher()
+	config.responses = makeResponses()
+	s := server.NewServer(context.Background(), config, server.CallbackFuncs{})
+
+	resp := makeMockStream(t)
+	resp.recv <- &discovery.DiscoveryRequest{
+		Node:    node,
+		TypeUrl: rsrc.ClusterType,
+	}
+	done := make(chan error)
+	go func() {
+		done <- s.StreamAggregatedResources(resp)
+	}()
+
+	select {
+	case <-resp.sent:
+	case <-time.After(1 * time.Second):
+		t.Fatalf("got no response")
+	}
+
+	if got := s.DisconnectNode("other-id", status.New(codes.Unavailable, "evicted"), 0); got != 0 {
+		t.Errorf("DisconnectNode(other-id) => got %d streams, want 0", got)
+	}
+	if got := s.DisconnectNode(node.Id, status.New(codes.Unavailable, "evicted"), 10*time.Millisecond); got != 1 {
+		t.Errorf("DisconnectNode(%s) => got %d streams, want 1", node.Id, got)
+	}
+
+	select {
+	case err := <-done:
+		if code := status.Code(err); code != codes.Unavailable {
+			t.Errorf("StreamAggregatedResources() => got code %v, want %v", code, codes.Unavailable)
+		}
+	case <-time.After(1 * time.Second):
+		t.Fatalf("stream was not disconnected")
+	}
+	close(resp.recv)
+}
+
+func TestWildcardSubscriptions(t *testing.T) {
+	envoyNode := func(minor uint32) *core.Node {
+		return &core.Node{
+			Id:            node.Id,
+			UserAgentName: "envoy",
+			UserAgentVersionType: &core.Node_UserAgentBuildVersion{
+				UserAgentBuildVersion: &core.BuildVersion{
+					Version: &envoy_type.SemanticVersion{MajorNumber: 1, MinorNumber: minor},
+				},
+			},
+		}
+	}
+
+	for _, tc := range []struct {
+		name  string
+		node  *core.Node
+		count int
+	}{
+		{name: "legacy", node: envoyNode(14), count: 3},
+		{name: "unknown", node: node, count: 3},
+		{name: "explicit", node: envoyNode(19), count: 2},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			config := makeMockConfigWatcher()
+			config.responses = makeResponses()
+			s := server.NewServer(context.Background(), config, server.CallbackFuncs{})
+
+			resp := makeMockStream(t)
+			resp.recv <- &discovery.DiscoveryRequest{
+				Node:          tc.node,
+				TypeUrl:       rsrc.EndpointType,
+				ResourceNames: []string{clusterName},
+			}
+			// unsubscribe from all resources for newer clients
+			resp.recv <- &discovery.DiscoveryRequest{
+				TypeUrl:       rsrc.EndpointType,
+				ResponseNonce: "1",
+			}
+			resp.recv <- &discovery.DiscoveryRequest{
+				TypeUrl:       rsrc.EndpointType,
+				ResponseNonce: "1",
+				ResourceNames: []string{sotw.WildcardResource, clusterName},
+			}
+			close(resp.recv)
+
+			if err := s.StreamAggregatedResources(resp); err != nil {
+				t.Errorf("StreamAggregatedResources() => got %v, want no error", err)
+			}
+			if got := config.counts[rsrc.EndpointType]; got != tc.count {
+				t.Errorf("watch counts => got %d, want %d", got, tc.count)
+			}
+			if got := config.names[rsrc.EndpointType]; len(got) != 0 {
+				t.Errorf("wildcard watch names => got %v, want none", got)
+			}
+		})
+	}
+}
+
+func TestProfilingLabels(t *testing.T) {
+	config := makeMockConfigWatcher()
+	config.responses = makeResponses()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := server.NewServer(ctx, config, server.CallbackFuncs{})
+
+	resp := makeMockStream(t)
+	resp.recv <- &discovery.DiscoveryRequest{Node: node, TypeUrl: rsrc.ClusterType}
+	go func() {
+		_ = s.StreamAggregatedResources(resp)
+	}()
+	select {
+	case <-resp.sent:
+	case <-time.After(1 * time.Second):
+		t.Fatalf("got no response")
+	}
+
+	buf := &bytes.Buffer{}
+	if err := pprof.Lookup("goroutine").WriteTo(buf, 1); err != nil {
+		t.Fatal(err)
+	}
+	for _, label := range []string{`"node":"` + node.Id + `"`, `"stream_type":"` + rsrc.AnyType + `"`} {
+		if !strings.Contains(buf.String(), label) {
+			t.Errorf("goroutine profile => missing label %s", label)
+		}
+	}
+}
+
+func TestMaxStreamAge(t *testing.T) {
+	config := makeMockConfigWatcher()
+	config.responses = makeResponses()
+	s := server.NewServer(context.Background(), config, server.CallbackFuncs{}, sotw.WithMaxStreamAge(20*time.Millisecond, 10*time.Millisecond))
+
+	resp := makeMockStream(t)
+	resp.recv <- &discovery.DiscoveryRequest{Node: node, TypeUrl: rsrc.ClusterType}
+	done := make(chan error)
+	go func() {
+		done <- s.StreamAggregatedResources(resp)
+	}()
+
+	select {
+	case err := <-done:
+		if code := status.Code(err); code != codes.Unavailable {
+			t.Errorf("StreamAggregatedResources() => got code %v, want %v", code, codes.Unavailable)
+		}
+	case <-time.After(1 * time.Second):
+		t.Fatalf("stream was not closed at the max age")
+	}
+	close(resp.recv)
+}
+
+func TestXDSTPNames(t *testing.T) {
+	config := makeMockConfigWatcher()
+	config.responses = makeResponses()
+	s := server.NewServer(context.Background(), config, server.CallbackFuncs{})
+
+	resp := makeMockStream(t)
+	resp.recv <- &discovery.DiscoveryRequest{
+		Node:          node,
+		TypeUrl:       rsrc.EndpointType,
+		ResourceNames: []string{"xdstp://auth/envoy.api.v2.Cluster/backend"},
+	}
+	if err := s.StreamAggregatedResources(resp); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("StreamAggregatedResources() with a name of another type => got %v, want invalid argument", err)
+	}
+	close(resp.recv)
+}
+
+func TestSendTimeout(t *testing.T) {
+	config := makeMockConfigWatcher()
+	config.responses = makeResponses()
+	slow := make(chan string, 1)
+	s := server.NewServer(context.Background(), config, server.CallbackFuncs{},
+		sotw.WithSendTimeout(10*time.Millisecond, sotw.SlowTerminate, func(_ int64, typeURL string) {
+			slow <- typeURL
+		}))
+
+	// the client does not read the responses
+	resp := makeMockStream(t)
+	resp.sent = make(chan *discovery.DiscoveryResponse)
+	resp.recv <- &discovery.DiscoveryRequest{Node: node, TypeUrl: rsrc.ClusterType}
+	done := make(chan error, 1)
+	go func() {
+		done <- s.StreamAggregatedResources(resp)
+	}()
+	if got := <-slow; got != rsrc.ClusterType {
+		t.Errorf("slow send => got %s, want %s", got, rsrc.ClusterType)
+	}
+
+	// the stream is closed once the pending send returns
+	select {
+	case err := <-done:
+		t.Fatalf("StreamAggregatedResources() during the send => got %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	<-resp.sent
+	if err := <-done; status.Code(err) != codes.DeadlineExceeded {
+		t.Errorf("StreamAggregatedResources() => got %v, want deadline exceeded", err)
+	}
+	close(resp.recv)
+}
+
+func TestResponseRateLimit(t *testing.T) {
+	c := cache.NewSnapshotCache(false, cache.IDHash{}, nil)
+	setVersion := func(version string) {
+		t.Helper()
+		if err := c.SetSnapshot(node.Id, cache.NewSnapshot(version, nil, []types.Resource{cluster}, nil, nil, nil, nil)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	setVersion("1")
+
+	// one response per 100ms after the first one
+	s := server.NewServer(context.Background(), c, server.CallbackFuncs{}, sotw.WithResponseRateLimit(10, 1))
+	start := time.Now()
+	resp := makeMockStream(t)
+	done := make(chan error)
+	go func() {
+		done <- s.StreamAggregatedResources(resp)
+	}()
+
+	resp.recv <- &discovery.DiscoveryRequest{Node: node, TypeUrl: rsrc.ClusterType}
+	if got := (<-resp.sent).VersionInfo; got != "1" {
+		t.Errorf("first response => got version %q, want 1", got)
+	}
+
+	// the acknowledgement is held, and replaced by the newer one, while the
+	// intermediate versions are set
+	resp.recv <- &discovery.DiscoveryRequest{Node: node, TypeUrl: rsrc.ClusterType, VersionInfo: "1", ResponseNonce: "1"}
+	resp.recv <- &discovery.DiscoveryRequest{Node: node, TypeUrl: rsrc.ClusterType, VersionInfo: "1", ResponseNonce: "1"}
+	for _, version := range []string{"2", "3", "4"} {
+		setVersion(version)
+	}
+	select {
+	case out := <-resp.sent:
+		if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+			t.Errorf("rate limited response => got after %v, want after 100ms", elapsed)
+		}
+		if out.VersionInfo != "4" {
+			t.Errorf("rate limited response => got version %q, want 4, skipping 2 and 3", out.VersionInfo)
+		}
+	case <-time.After(1 * time.Second):
+		t.Fatal("rate limited response was not sent")
+	}
+
+	close(resp.recv)
+	<-done
+	if len(resp.sent) != 0 {
+		t.Errorf("responses => got %d more, want none", len(resp.sent))
+	}
+}
+
+func TestRequestRateLimit(t *testing.T) {
+	config := makeMockConfigWatcher()
+	var flooded []string
+	s := server.NewServer(context.Background(), config, server.CallbackFuncs{},
+		sotw.WithRequestRateLimit(1, 3, func(_ int64, node string) {
+			flooded = append(flooded, node)
+		}))
+
+	resp := makeMockStream(t)
+	for i := 0; i < 4; i++ {
+		resp.recv <- &discovery.DiscoveryRequest{Node: node, TypeUrl: rsrc.ClusterType}
+	}
+	if err := s.StreamAggregatedResources(resp); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("StreamAggregatedResources() => got %v, want resource exhausted", err)
+	}
+	if len(flooded) != 1 || flooded[0] != node.Id {
+		t.Errorf("flooded nodes => got %v, want [%s]", flooded, node.Id)
+	}
+	if got := config.counts[rsrc.ClusterType]; got != 3 {
+		t.Errorf("cluster watches => got %d, want 3", got)
+	}
+	close(resp.recv)
+}
+
+// batchWatcher responds to the watches at once when all the types are watched.
+type batchWatcher struct {
+	types   []string
+	watches map[string]chan cache.Response
+}
+
+func (config *batchWatcher) CreateWatch(req *discovery.DiscoveryRequest) (chan cache.Response, func()) {
+	out := make(chan cache.Response, 1)
+	config.watches[req.TypeUrl] = out
+	if len(config.watches) == len(config.types) {
+		responses := makeResponses()
+		for _, typeURL := range config.types {
+			config.watches[typeURL] <- responses[typeURL][0]
+		}
+	}
+	return out, nil
+}
+
+func (config *batchWatcher) Fetch(context.Context, *discovery.DiscoveryRequest) (cache.Response, error) {
+	return nil, errors.New("missing")
+}
+
+func TestOrderedADS(t *testing.T) {
+	config := &batchWatcher{
+		types:   []string{rsrc.RouteType, rsrc.ListenerType, rsrc.EndpointType, rsrc.ClusterType},
+		watches: make(map[string]chan cache.Response),
+	}
+	s := server.NewServer(context.Background(), config, server.CallbackFuncs{}, sotw.WithOrderedADS())
+
+	resp := makeMockStream(t)
+	for _, typeURL := range config.types {
+		resp.recv <- &discovery.DiscoveryRequest{Node: node, TypeUrl: typeURL}
+	}
+	go func() {
+		_ = s.StreamAggregatedResources(resp)
+	}()
+
+	want := []string{rsrc.ClusterType, rsrc.EndpointType, rsrc.ListenerType, rsrc.RouteType}
+	for _, typeURL := range want {
+		select {
+		case out := <-resp.sent:
+			if out.TypeUrl != typeURL {
+				t.Errorf("ordered response => got %s, want %s", out.TypeUrl, typeURL)
+			}
+		case <-time.After(1 * time.Second):
+			t.Fatalf("response for %s was not sent", typeURL)
+		}
+	}
+	close(resp.recv)
+}
+
+func TestErrorDetails(t *testing.T) {
+	config := makeMockConfigWatcher()
+	s := server.NewServer(context.Background(), config, server.CallbackFuncs{}, sotw.WithRequestRateLimit(1, 1, nil))
+
+	details := func(err error) (*errdetails.RequestInfo, *errdetails.PreconditionFailure, *errdetails.RetryInfo) {
+		var info *errdetails.RequestInfo
+		var failure *errdetails.PreconditionFailure
+		var retry *errdetails.RetryInfo
+		for _, detail := range status.Convert(err).Details() {
+			switch detail := detail.(type) {
+			case *errdetails.RequestInfo:
+				info = detail
+			case *errdetails.PreconditionFailure:
+				failure = detail
+			case *errdetails.RetryInfo:
+				retry = detail
+			}
+		}
+		return info, failure, retry
+	}
+
+	// a protocol violation
+	resp := makeMockStream(t)
+	resp.recv <- &discovery.DiscoveryRequest{Node: node}
+	err := s.StreamAggregatedResources(resp)
+	info, failure, _ := details(err)
+	if status.Code(err) != codes.InvalidArgument || failure == nil || failure.Violations[0].Subject != "type_url" {
+		t.Errorf("missing type URL => got %v with %v, want a precondition failure", err, failure)
+	}
+	if info == nil || !strings.Contains(info.ServingData, "node="+node.Id) {
+		t.Errorf("missing type URL => got request info %v, want the node %s", info, node.Id)
+	}
+	close(resp.recv)
+
+	// a rate limited stream
+	resp = makeMockStream(t)
+	resp.recv <- &discovery.DiscoveryRequest{Node: node}
+	resp.recv <- &discovery.DiscoveryRequest{Node: node}
+	err = s.StreamClusters(resp)
+	info, _, retry := details(err)
+	if status.Code(err) != codes.ResourceExhausted || retry == nil || retry.RetryDelay.GetSeconds() != 1 {
+		t.Errorf("rate limited stream => got %v with %v, want a retry delay of 1s", err, retry)
+	}
+	if info == nil || !strings.Contains(info.ServingData, "type_url="+url.QueryEscape(rsrc.ClusterType)) {
+		t.Errorf("rate limited stream => got request info %v, want the type %s", info, rsrc.ClusterType)
+	}
+	close(resp.recv)
+
+	// an empty request
+	resp = makeMockStream(t)
+	resp.recv <- nil
+	err = s.StreamClusters(resp)
+	if info, _, _ := details(err); status.Code(err) != codes.Unavailable || info == nil {
+		t.Errorf("empty request => got %v with request info %v, want the request info", err, info)
+	}
+	close(resp.recv)
+
+	// a stream refused by the callbacks
+	s = server.NewServer(context.Background(), config, server.CallbackFuncs{
+		StreamOpenFunc: func(context.Context, int64, string) error {
+			return status.Error(codes.PermissionDenied, "refused")
+		},
+	})
+	resp = makeMockStream(t)
+	err = s.StreamClusters(resp)
+	info, _, _ = details(err)
+	if status.Code(err) != codes.PermissionDenied || info == nil || !strings.Contains(info.ServingData, "type_url="+url.QueryEscape(rsrc.ClusterType)) {
+		t.Errorf("refused stream => got %v with request info %v, want the type %s", err, info, rsrc.ClusterType)
+	}
+	close(resp.recv)
+}
+
+func TestStreamLogger(t *testing.T) {
+	var lines []string
+	record := func(format string, args ...interface{}) { lines = append(lines, fmt.Sprintf(format, args...)) }
+	logger := log.LoggerFuncs{DebugFunc: record, InfoFunc: record, WarnFunc: record, ErrorFunc: record}
+	s := server.NewServer(context.Background(), makeMockConfigWatcher(), server.CallbackFuncs{}, sotw.WithLogger(logger))
+
+	resp := makeMockStream(t)
+	resp.recv <- &discovery.DiscoveryRequest{Node: node, ErrorDetail: &rpcstatus.Status{Message: "rejected"}}
+	close(resp.recv)
+	if err := s.StreamClusters(resp); err != nil {
+		t.Fatal(err)
+	}
+
+	nack := ""
+	for _, line := range lines {
+		if !strings.HasPrefix(line, "stream_id=") {
+			t.Errorf("log line => got %q, want the stream ID field", line)
+		}
+		if strings.Contains(line, "NACK") {
+			nack = line
+		}
+	}
+	want := "node_id=" + node.Id + " type_url=" + rsrc.ClusterType
+	if !strings.Contains(nack, want) || !strings.Contains(nack, "rejected") {
+		t.Errorf("NACK log => got %q, want the fields %q", nack, want)
+	}
+}
+
+func TestStreamNilLogger(t *testing.T) {
+	s := server.NewServer(context.Background(), makeMockConfigWatcher(), server.CallbackFuncs{}, sotw.WithLogger(nil))
+	resp := makeMockStream(t)
+	resp.recv <- &discovery.DiscoveryRequest{Node: node, ErrorDetail: &rpcstatus.Status{Message: "rejected"}}
+	close(resp.recv)
+	if err := s.StreamClusters(resp); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,242 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+// Package simulate estimates the cost of configuration churn for a control
+// plane deployment, to choose between the state-of-the-world and the delta
+// protocols and to size the replicas.
+//
+// The input is a trace of the snapshot updates and of the subscriptions in
+// JSON. The package does not record traces: they are written by hand, or
+// converted from the update logs and the subscription metrics of a control
+// plane:
+//
+//	trace, _ := simulate.ReadTrace(file)
+//	for _, replicas := range []int{2, 4, 8} {
+//		for _, estimate := range simulate.Compare(trace, simulate.Config{Replicas: replicas}) {
+//			fmt.Println(estimate)
+//		}
+//	}
+//
+// The model is deliberately simple: the nodes are spread evenly across the
+// replicas, the changed resources are spread uniformly across the resource
+// names, and the CPU cost is linear in the responses and in the bytes. The
+// default costs are rough figures and should be calibrated with a profile of
+// the actual control plane.
+package simulate
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// Protocol is an xDS protocol variant.
+type Protocol int
+
+const (
+	// SOTW is the state-of-the-world protocol, sending all subscribed
+	// resources of a type in every response.
+	SOTW Protocol = iota
+	// Delta is the incremental protocol, sending the changed resources only.
+	Delta
+)
+
+func (p Protocol) String() string {
+	switch p {
+	case SOTW:
+		return "sotw"
+	case Delta:
+		return "delta"
+	}
+	return "unknown"
+}
+
+// Update is a snapshot update of a node group.
+type Update struct {
+	// Time is the offset of the update from the start of the trace.
+	Time time.Duration `json:"time"`
+
+	// Group is the snapshot key shared by the nodes, e.g. the node hash.
+	Group   string `json:"group"`
+	TypeURL string `json:"type_url"`
+
+	// Resources is the number of resources of the type in the snapshot, and
+	// Changed the number of resources added, modified or removed.
+	Resources int `json:"resources"`
+	Changed   int `json:"changed"`
+
+	// Size is the average marshaled resource size in bytes.
+	Size int `json:"size"`
+}
+
+// Subscription is the interest of the nodes of a group in a type.
+type Subscription struct {
+	Group   string `json:"group"`
+	TypeURL string `json:"type_url"`
+	Nodes   int    `json:"nodes"`
+
+	// Resources is the number of resource names subscribed by each node, or
+	// zero for a wildcard subscription.
+	Resources int `json:"resources"`
+}
+
+// Trace is a session of snapshot updates and subscriptions.
+type Trace struct {
+	Duration      time.Duration  `json:"duration"`
+	Updates       []Update       `json:"updates"`
+	Subscriptions []Subscription `json:"subscriptions"`
+}
+
+// ReadTrace decodes a trace in JSON. The durations are in nanoseconds.
+func ReadTrace(r io.Reader) (Trace, error) {
+	var trace Trace
+	if err := json.NewDecoder(r).Decode(&trace); err != nil {
+		return Trace{}, err
+	}
+	if trace.Duration <= 0 {
+		return Trace{}, fmt.Errorf("trace duration must be positive, got %v", trace.Duration)
+	}
+	return trace, nil
+}
+
+// Config are the parameters of a deployment.
+type Config struct {
+	// Replicas is the number of control plane replicas, one by default.
+	Replicas int
+
+	// ResponseCost is the CPU time to build and send a response, 20µs by
+	// default.
+	ResponseCost time.Duration
+
+	// ByteCost is the CPU time to marshal and send a byte, 5ns by default.
+	ByteCost time.Duration
+
+	// Overhead is the size of the response envelope in bytes, 100 by default.
+	Overhead int
+}
+
+func (c Config) withDefaults() Config {
+	if c.Replicas <= 0 {
+		c.Replicas = 1
+	}
+	if c.ResponseCost <= 0 {
+		c.ResponseCost = 20 * time.Microsecond
+	}
+	if c.ByteCost <= 0 {
+		c.ByteCost = 5 * time.Nanosecond
+	}
+	if c.Overhead <= 0 {
+		c.Overhead = 100
+	}
+	return c
+}
+
+// Estimate is the cost of a trace for each replica.
+type Estimate struct {
+	Protocol Protocol
+	Replicas int
+
+	// Responses is the mean number of responses by second.
+	Responses float64
+
+	// Bandwidth and PeakBandwidth are the mean and the highest bytes sent by
+	// second.
+	Bandwidth     float64
+	PeakBandwidth float64
+
+	// CPU is the mean number of cores busy sending the responses.
+	CPU float64
+}
+
+func (e Estimate) String() string {
+	return fmt.Sprintf("%s with %d replicas: %.1f responses/s, %.0f B/s (peak %.0f B/s), %.3f cores",
+		e.Protocol, e.Replicas, e.Responses, e.Bandwidth, e.PeakBandwidth, e.CPU)
+}
+
+// Simulate estimates the cost of the trace with a protocol.
+func Simulate(trace Trace, protocol Protocol, config Config) Estimate {
+	config = config.withDefaults()
+	subscriptions := make(map[string][]Subscription)
+	for _, sub := range trace.Subscriptions {
+		key := sub.Group + "/" + sub.TypeURL
+		subscriptions[key] = append(subscriptions[key], sub)
+	}
+
+	var responses, bytes float64
+	perSecond := make(map[int64]float64)
+	for _, update := range trace.Updates {
+		for _, sub := range subscriptions[update.Group+"/"+update.TypeURL] {
+			n, b := cost(update, sub, protocol)
+			b += n * float64(config.Overhead)
+			responses += n
+			bytes += b
+			perSecond[int64(update.Time/time.Second)] += b
+		}
+	}
+
+	replicas := float64(config.Replicas)
+	seconds := trace.Duration.Seconds()
+	out := Estimate{
+		Protocol:  protocol,
+		Replicas:  config.Replicas,
+		Responses: responses / replicas / seconds,
+		Bandwidth: bytes / replicas / seconds,
+		CPU: (responses*config.ResponseCost.Seconds() +
+			bytes*config.ByteCost.Seconds()) / replicas / seconds,
+	}
+	for _, b := range perSecond {
+		if peak := b / replicas; peak > out.PeakBandwidth {
+			out.PeakBandwidth = peak
+		}
+	}
+	return out
+}
+
+// Compare estimates the cost of the trace with each protocol.
+func Compare(trace Trace, config Config) []Estimate {
+	return []Estimate{
+		Simulate(trace, SOTW, config),
+		Simulate(trace, Delta, config),
+	}
+}
+
+// cost returns the expected responses and resource bytes sent to the
+// subscribed nodes on an update.
+func cost(update Update, sub Subscription, protocol Protocol) (float64, float64) {
+	if update.Resources == 0 && update.Changed == 0 {
+		return 0, 0
+	}
+	nodes := float64(sub.Nodes)
+	size := float64(update.Size)
+
+	// the fraction of the resources of the type subscribed by a node
+	subscribed := float64(update.Resources)
+	fraction := 1.0
+	if sub.Resources > 0 && sub.Resources < update.Resources {
+		subscribed = float64(sub.Resources)
+		fraction = subscribed / float64(update.Resources)
+	}
+
+	if protocol == SOTW {
+		// every watch is answered on a new version, with the full set
+		return nodes, nodes * subscribed * size
+	}
+
+	// a node is only updated if one of its resources changed
+	changed := float64(update.Changed) * fraction
+	updated := 1 - math.Pow(1-fraction, float64(update.Changed))
+	return nodes * updated, nodes * changed * size
+}
@@ -0,0 +1,104 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package simulate_test
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/envoyproxy/go-control-plane/pkg/simulate"
+)
+
+const endpointType = "type.googleapis.com/envoy.api.v2.ClusterLoadAssignment"
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-6*math.Max(1, math.Abs(b))
+}
+
+func TestSimulate(t *testing.T) {
+	// ten updates changing two of the hundred endpoints, watched by fifty
+	// wildcard nodes and by fifty nodes subscribing to ten endpoints
+	trace := simulate.Trace{
+		Duration: 10 * time.Second,
+		Subscriptions: []simulate.Subscription{
+			{Group: "web", TypeURL: endpointType, Nodes: 50},
+			{Group: "web", TypeURL: endpointType, Nodes: 50, Resources: 10},
+			{Group: "api", TypeURL: endpointType, Nodes: 1000},
+		},
+	}
+	for i := 0; i < 10; i++ {
+		trace.Updates = append(trace.Updates, simulate.Update{
+			Time:      time.Duration(i) * time.Second,
+			Group:     "web",
+			TypeURL:   endpointType,
+			Resources: 100,
+			Changed:   2,
+			Size:      200,
+		})
+	}
+
+	tests := []struct {
+		protocol  simulate.Protocol
+		replicas  int
+		responses float64
+		bandwidth float64
+	}{
+		{simulate.SOTW, 1, 100, 50*100*200 + 50*10*200 + 100*100},
+		{simulate.SOTW, 2, 50, (50*100*200 + 50*10*200 + 100*100) / 2},
+		{simulate.Delta, 1, 59.5, 50*2*200 + 50*0.2*200 + 59.5*100},
+	}
+	for _, test := range tests {
+		got := simulate.Simulate(trace, test.protocol, simulate.Config{Replicas: test.replicas})
+		if !near(got.Responses, test.responses) || !near(got.Bandwidth, test.bandwidth) {
+			t.Errorf("Simulate(%v, %d) => got %v, want %v responses/s and %v B/s",
+				test.protocol, test.replicas, got, test.responses, test.bandwidth)
+		}
+		// one update by second
+		if !near(got.PeakBandwidth, got.Bandwidth) {
+			t.Errorf("Simulate(%v, %d) peak => got %v, want %v", test.protocol, test.replicas, got.PeakBandwidth, got.Bandwidth)
+		}
+		want := got.Responses*20e-6 + got.Bandwidth*5e-9
+		if !near(got.CPU, want) {
+			t.Errorf("Simulate(%v, %d) CPU => got %v, want %v", test.protocol, test.replicas, got.CPU, want)
+		}
+	}
+
+	estimates := simulate.Compare(trace, simulate.Config{})
+	if len(estimates) != 2 || estimates[0].Protocol != simulate.SOTW || estimates[1].Protocol != simulate.Delta ||
+		estimates[1].Bandwidth >= estimates[0].Bandwidth {
+		t.Errorf("Compare() => got %v, want delta cheaper", estimates)
+	}
+}
+
+func TestReadTrace(t *testing.T) {
+	trace, err := simulate.ReadTrace(strings.NewReader(`{
+		"duration": 60000000000,
+		"updates": [{"time": 1000000000, "group": "web", "type_url": "eds", "resources": 5, "changed": 1, "size": 100}],
+		"subscriptions": [{"group": "web", "type_url": "eds", "nodes": 3}]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if trace.Duration != time.Minute || len(trace.Updates) != 1 || trace.Updates[0].Time != time.Second ||
+		len(trace.Subscriptions) != 1 || trace.Subscriptions[0].Nodes != 3 {
+		t.Errorf("ReadTrace() => got %+v", trace)
+	}
+
+	if _, err := simulate.ReadTrace(strings.NewReader(`{"updates": []}`)); err == nil {
+		t.Error("ReadTrace() without duration => got no error")
+	}
+}
@@ -47,6 +47,7 @@ var (
 	upstreamMessage string
 	basePort        uint
 	alsPort         uint
+	adminURL        string
 
 	delay    time.Duration
 	requests int
@@ -90,6 +91,10 @@ func init() {
 	// The control plane accesslog server port (currently unused)
 	flag.UintVar(&alsPort, "als", 18090, "Control plane accesslog server port")
 
+	// The Envoy admin interface that the tests use to verify that Envoy
+	// accepted the pushed configuration
+	flag.StringVar(&adminURL, "admin", "http://127.0.0.1:19000", "Envoy admin URL to assert stats (empty to disable)")
+
 	//
 	// These parameters control Envoy configuration
 	//
@@ -160,16 +165,8 @@ func main() {
 	eds := cachev3.NewLinearCache(typeURL)
 	if mux {
 		configCachev3 = &cachev3.MuxCache{
-			Classify: func(req cachev3.Request) string {
-				if req.TypeUrl == typeURL {
-					return "eds"
-				}
-				return "default"
-			},
-			Caches: map[string]cachev3.Cache{
-				"default": configv3,
-				"eds":     eds,
-			},
+			Caches:  map[string]cachev3.Cache{typeURL: eds},
+			Default: configv3,
 		}
 	}
 	srv3 := serverv3.NewServer(context.Background(), configCachev3, cbv3)
@@ -279,6 +276,16 @@ func main() {
 			log.Printf("failed all requests in a run %d\n", i)
 			os.Exit(1)
 		}
+
+		if adminURL != "" {
+			statsCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+			err := test.WaitForStats(statsCtx, adminURL, delay, test.AcceptedUpdates(uint64(i+1))...)
+			cancel()
+			if err != nil {
+				log.Printf("envoy did not accept the update %d: %v\n", i, err)
+				os.Exit(1)
+			}
+		}
 	}
 
 	log.Printf("Test for %s passed!\n", mode)
@@ -0,0 +1,123 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package resource
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+
+	endpoint "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	listener "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	route "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	endpointv2 "github.com/envoyproxy/go-control-plane/envoy/api/v2/endpoint"
+	listenerv2 "github.com/envoyproxy/go-control-plane/envoy/api/v2/listener"
+	routev2 "github.com/envoyproxy/go-control-plane/envoy/api/v2/route"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
+)
+
+// MakeEndpoints creates a load assignment with a number of localhost
+// endpoints on the consecutive ports starting at the base port.
+func MakeEndpoints(clusterName string, basePort uint32, count int) *endpoint.ClusterLoadAssignment {
+	out := MakeEndpoint(clusterName, basePort)
+	template := out.Endpoints[0].LbEndpoints[0]
+	for i := 1; i < count; i++ {
+		lb := proto.Clone(template).(*endpointv2.LbEndpoint)
+		lb.GetEndpoint().GetAddress().GetSocketAddress().PortSpecifier = &core.SocketAddress_PortValue{
+			PortValue: basePort + uint32(i),
+		}
+		out.Endpoints[0].LbEndpoints = append(out.Endpoints[0].LbEndpoints, lb)
+	}
+	return out
+}
+
+// MakeClusters creates a number of clusters named "{prefix}-{i}".
+func MakeClusters(mode string, prefix string, count int) []types.Resource {
+	out := make([]types.Resource, count)
+	for i := range out {
+		out[i] = MakeCluster(mode, fmt.Sprintf("%s-%d", prefix, i))
+	}
+	return out
+}
+
+// MakeClusterEndpoints creates the load assignments for the clusters named by
+// MakeClusters, each with a number of endpoints.
+func MakeClusterEndpoints(prefix string, basePort uint32, clusters int, endpoints int) []types.Resource {
+	out := make([]types.Resource, clusters)
+	for i := range out {
+		out[i] = MakeEndpoints(fmt.Sprintf("%s-%d", prefix, i), basePort, endpoints)
+	}
+	return out
+}
+
+// MakeRouteTable creates a route configuration with routes for the nested
+// path prefixes up to the depth, e.g. "/l1/l2" for depth 2, ordered from the
+// most specific. The prefixes are assigned the clusters in a round-robin
+// fashion, and a catch-all route forwards to the first cluster.
+func MakeRouteTable(routeName string, clusters []string, depth int) *route.RouteConfiguration {
+	out := MakeRoute(routeName, clusters[0])
+	catchAll := out.VirtualHosts[0].Routes[0]
+
+	var routes []*routev2.Route
+	for d := depth; d > 0; d-- {
+		segments := make([]string, d)
+		for i := range segments {
+			segments[i] = fmt.Sprintf("l%d", i+1)
+		}
+		r := proto.Clone(catchAll).(*routev2.Route)
+		r.Match.PathSpecifier = &routev2.RouteMatch_Prefix{Prefix: "/" + strings.Join(segments, "/")}
+		r.GetRoute().ClusterSpecifier = &routev2.RouteAction_Cluster{Cluster: clusters[(d-1)%len(clusters)]}
+		routes = append(routes, r)
+	}
+	out.VirtualHosts[0].Routes = append(routes, catchAll)
+	return out
+}
+
+// MakeFilterChainListener creates a TCP listener with a filter chain for
+// every permutation of the server names, the transport protocols and the
+// application protocols. An empty list leaves the match field unset.
+func MakeFilterChainListener(listenerName string, port uint32, clusterName string,
+	serverNames, transportProtocols, applicationProtocols []string) *listener.Listener {
+	out := MakeTCPListener(listenerName, port, clusterName)
+	template := out.FilterChains[0]
+	out.FilterChains = nil
+
+	for _, serverName := range orUnset(serverNames) {
+		for _, transportProtocol := range orUnset(transportProtocols) {
+			for _, applicationProtocol := range orUnset(applicationProtocols) {
+				chain := proto.Clone(template).(*listenerv2.FilterChain)
+				chain.FilterChainMatch = &listenerv2.FilterChainMatch{TransportProtocol: transportProtocol}
+				if serverName != "" {
+					chain.FilterChainMatch.ServerNames = []string{serverName}
+				}
+				if applicationProtocol != "" {
+					chain.FilterChainMatch.ApplicationProtocols = []string{applicationProtocol}
+				}
+				out.FilterChains = append(out.FilterChains, chain)
+			}
+		}
+	}
+	return out
+}
+
+// orUnset substitutes an empty list with a single unset value.
+func orUnset(values []string) []string {
+	if len(values) == 0 {
+		return []string{""}
+	}
+	return values
+}
@@ -0,0 +1,157 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package resource_test
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	endpoint "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/v2"
+	rsrc "github.com/envoyproxy/go-control-plane/pkg/resource/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/test/resource/v2"
+)
+
+func names(resources []types.Resource) []string {
+	out := make([]string, len(resources))
+	for i, res := range resources {
+		out[i] = cache.GetResourceName(res)
+	}
+	return out
+}
+
+func TestMakeEndpoints(t *testing.T) {
+	out := resource.MakeEndpoints("cluster", 9000, 3)
+	lbs := out.Endpoints[0].LbEndpoints
+	if len(lbs) != 3 {
+		t.Fatalf("endpoints => got %d, want 3", len(lbs))
+	}
+	for i, lb := range lbs {
+		if got, want := lb.GetEndpoint().GetAddress().GetSocketAddress().GetPortValue(), uint32(9000+i); got != want {
+			t.Errorf("endpoint %d port => got %d, want %d", i, got, want)
+		}
+	}
+}
+
+func TestMakeClusters(t *testing.T) {
+	clusters := resource.MakeClusters(resource.Ads, "backend", 3)
+	endpoints := resource.MakeClusterEndpoints("backend", 9000, 3, 2)
+	want := []string{"backend-0", "backend-1", "backend-2"}
+	if got := names(clusters); !reflect.DeepEqual(got, want) {
+		t.Errorf("cluster names => got %v, want %v", got, want)
+	}
+	if got := names(endpoints); !reflect.DeepEqual(got, want) {
+		t.Errorf("endpoint names => got %v, want %v", got, want)
+	}
+	for _, res := range endpoints {
+		if got := len(res.(*endpoint.ClusterLoadAssignment).Endpoints[0].LbEndpoints); got != 2 {
+			t.Errorf("endpoints of %s => got %d, want 2", cache.GetResourceName(res), got)
+		}
+	}
+
+	snap := cache.NewSnapshot("1", endpoints, clusters, nil, nil, nil, nil)
+	if err := snap.Consistent(); err != nil {
+		t.Errorf("Consistent() => got %v", err)
+	}
+}
+
+func TestMakeRouteTable(t *testing.T) {
+	out := resource.MakeRouteTable("route", []string{"a", "b"}, 3)
+	routes := out.VirtualHosts[0].Routes
+	want := []struct{ prefix, cluster string }{
+		{"/l1/l2/l3", "a"},
+		{"/l1/l2", "b"},
+		{"/l1", "a"},
+		{"/", "a"},
+	}
+	if len(routes) != len(want) {
+		t.Fatalf("routes => got %d, want %d", len(routes), len(want))
+	}
+	for i, w := range want {
+		if got := routes[i].GetMatch().GetPrefix(); got != w.prefix {
+			t.Errorf("route %d prefix => got %q, want %q", i, got, w.prefix)
+		}
+		if got := routes[i].GetRoute().GetCluster(); got != w.cluster {
+			t.Errorf("route %d cluster => got %q, want %q", i, got, w.cluster)
+		}
+	}
+}
+
+func TestMakeFilterChainListener(t *testing.T) {
+	out := resource.MakeFilterChainListener("listener", 10000, "cluster",
+		[]string{"a.example.com", "b.example.com"}, nil, []string{"h2", "http/1.1"})
+	if len(out.FilterChains) != 4 {
+		t.Fatalf("filter chains => got %d, want 4", len(out.FilterChains))
+	}
+	seen := make(map[string]bool)
+	for _, chain := range out.FilterChains {
+		match := chain.FilterChainMatch
+		if match.TransportProtocol != "" {
+			t.Errorf("transport protocol => got %q, want unset", match.TransportProtocol)
+		}
+		seen[fmt.Sprint(match.ServerNames, match.ApplicationProtocols)] = true
+	}
+	if len(seen) != 4 {
+		t.Errorf("filter chain matches => got %v, want 4 distinct permutations", seen)
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	snap := resource.TestSnapshot{
+		Xds:              resource.Ads,
+		Version:          "1",
+		UpstreamPort:     18080,
+		BasePort:         9000,
+		NumClusters:      3,
+		NumEndpoints:     2,
+		RouteDepth:       2,
+		NumHTTPListeners: 2,
+		NumTCPListeners:  1,
+		NumRuntimes:      1,
+		TLS:              true,
+	}.Generate()
+
+	for typeURL, want := range map[string]int{
+		rsrc.ClusterType:  3,
+		rsrc.EndpointType: 3,
+		rsrc.RouteType:    2,
+		rsrc.ListenerType: 3,
+		rsrc.RuntimeType:  1,
+		rsrc.SecretType:   2,
+	} {
+		if got := len(snap.GetResources(typeURL)); got != want {
+			t.Errorf("%s resources => got %d, want %d", typeURL, got, want)
+		}
+	}
+	for _, name := range []string{"cluster-1-0", "route-1-1", "listener-9002"} {
+		found := false
+		for _, typeURL := range []string{rsrc.ClusterType, rsrc.RouteType, rsrc.ListenerType} {
+			if _, exists := snap.GetResources(typeURL)[name]; exists {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("resource %q => got none", name)
+		}
+	}
+	if err := snap.Consistent(); err != nil {
+		t.Errorf("Consistent() => got %v", err)
+	}
+	if err := snap.ConsistentSecrets(); err != nil {
+		t.Errorf("ConsistentSecrets() => got %v", err)
+	}
+}
@@ -302,6 +302,12 @@ type TestSnapshot struct {
 	BasePort uint32
 	// NumClusters is the total number of clusters to generate.
 	NumClusters int
+	// NumEndpoints is the number of endpoints per cluster on the consecutive
+	// ports starting at the upstream port. Defaults to a single endpoint.
+	NumEndpoints int
+	// RouteDepth is the depth of the nested path prefix routes in each route
+	// table. Defaults to a single catch-all route.
+	RouteDepth int
 	// NumHTTPListeners is the total number of HTTP listeners to generate.
 	NumHTTPListeners int
 	// NumTCPListeners is the total number of TCP listeners to generate.
@@ -315,18 +321,18 @@ type TestSnapshot struct {
 
 // Generate produces a snapshot from the parameters.
 func (ts TestSnapshot) Generate() cache.Snapshot {
-	clusters := make([]types.Resource, ts.NumClusters)
-	endpoints := make([]types.Resource, ts.NumClusters)
-	for i := 0; i < ts.NumClusters; i++ {
-		name := fmt.Sprintf("cluster-%s-%d", ts.Version, i)
-		clusters[i] = MakeCluster(ts.Xds, name)
-		endpoints[i] = MakeEndpoint(name, ts.UpstreamPort)
-	}
+	prefix := "cluster-" + ts.Version
+	clusters := MakeClusters(ts.Xds, prefix, ts.NumClusters)
+	endpoints := MakeClusterEndpoints(prefix, ts.UpstreamPort, ts.NumClusters, ts.NumEndpoints)
 
 	routes := make([]types.Resource, ts.NumHTTPListeners)
 	for i := 0; i < ts.NumHTTPListeners; i++ {
 		name := fmt.Sprintf("route-%s-%d", ts.Version, i)
-		routes[i] = MakeRoute(name, cache.GetResourceName(clusters[i%ts.NumClusters]))
+		targets := make([]string, ts.NumClusters)
+		for j := range targets {
+			targets[j] = cache.GetResourceName(clusters[(i+j)%ts.NumClusters])
+		}
+		routes[i] = MakeRouteTable(name, targets, ts.RouteDepth)
 	}
 
 	total := ts.NumHTTPListeners + ts.NumTCPListeners
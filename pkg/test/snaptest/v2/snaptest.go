@@ -0,0 +1,270 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+// Package snaptest compares snapshots against golden files.
+//
+// The golden files are regenerated by running the tests with the update flag:
+//
+//	go test ./... -args -snaptest.update
+package snaptest
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/diff"
+	"github.com/envoyproxy/go-control-plane/pkg/resource/v2"
+)
+
+var update = flag.Bool("snaptest.update", false, "update the snapshot golden files")
+
+// sections are the snapshot resource types in the golden file order.
+var sections = []struct {
+	key     string
+	typeURL string
+}{
+	{"endpoints", resource.EndpointType},
+	{"clusters", resource.ClusterType},
+	{"routes", resource.RouteType},
+	{"scoped_routes", resource.ScopedRouteType},
+	{"listeners", resource.ListenerType},
+	{"secrets", resource.SecretType},
+	{"runtimes", resource.RuntimeType},
+}
+
+// Marshal serializes the snapshot to YAML deterministically. The resource
+// types are listed in a fixed order, the resources are sorted by name, and
+// the resource fields are in the proto field order.
+func Marshal(snapshot cache.Snapshot) ([]byte, error) {
+	marshaler := &jsonpb.Marshaler{OrigName: true}
+	var out yaml.MapSlice
+	for _, section := range sections {
+		items := snapshot.GetResources(section.typeURL)
+		names := make([]string, 0, len(items))
+		for name := range items {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		var resources []interface{}
+		for _, name := range names {
+			js, err := marshaler.MarshalToString(items[name])
+			if err != nil {
+				return nil, fmt.Errorf("marshal error for %q: %v", name, err)
+			}
+			// YAML is a superset of JSON and the map slice retains the field order.
+			var fields yaml.MapSlice
+			if err := yaml.Unmarshal([]byte(js), &fields); err != nil {
+				return nil, err
+			}
+			resources = append(resources, fields)
+		}
+		out = append(out, yaml.MapItem{Key: section.key, Value: yaml.MapSlice{
+			{Key: "version", Value: snapshot.GetVersion(section.typeURL)},
+			{Key: "resources", Value: resources},
+		}})
+	}
+	return yaml.Marshal(out)
+}
+
+// Unmarshal parses a snapshot serialized by Marshal.
+func Unmarshal(data []byte) (cache.Snapshot, error) {
+	var out cache.Snapshot
+	var doc yaml.MapSlice
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return out, err
+	}
+	for _, item := range doc {
+		typeURL := ""
+		for _, section := range sections {
+			if section.key == item.Key {
+				typeURL = section.typeURL
+			}
+		}
+		mt, err := protoregistry.GlobalTypes.FindMessageByURL(typeURL)
+		if err != nil {
+			return out, fmt.Errorf("unknown section %v", item.Key)
+		}
+
+		var group struct {
+			Version   string
+			Resources []interface{}
+		}
+		if err := remarshal(item.Value, &group); err != nil {
+			return out, err
+		}
+		resources := make([]types.Resource, 0, len(group.Resources))
+		for _, fields := range group.Resources {
+			js, err := json.Marshal(jsonValue(fields))
+			if err != nil {
+				return out, err
+			}
+			res := proto.MessageV1(mt.New().Interface())
+			if err := jsonpb.UnmarshalString(string(js), res); err != nil {
+				return out, err
+			}
+			resources = append(resources, res)
+		}
+		out.Resources[cache.GetResponseType(typeURL)] = cache.NewResources(group.Version, resources)
+	}
+	return out, nil
+}
+
+func remarshal(in interface{}, out interface{}) error {
+	data, err := yaml.Marshal(in)
+	if err != nil {
+		return err
+	}
+	return yaml.Unmarshal(data, out)
+}
+
+// jsonValue converts the YAML maps to the JSON objects.
+func jsonValue(in interface{}) interface{} {
+	switch v := in.(type) {
+	case yaml.MapSlice:
+		out := make(map[string]interface{}, len(v))
+		for _, item := range v {
+			out[fmt.Sprint(item.Key)] = jsonValue(item.Value)
+		}
+		return out
+	case map[interface{}]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			out[fmt.Sprint(key)] = jsonValue(value)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, value := range v {
+			out[i] = jsonValue(value)
+		}
+		return out
+	}
+	return in
+}
+
+// Diff renders the semantic differences between the snapshots by resource
+// type, as reported by the diff package.
+func Diff(want, got cache.Snapshot) string {
+	var out strings.Builder
+	for _, section := range sections {
+		changes := diff.Resources(want.GetResources(section.typeURL), got.GetResources(section.typeURL))
+		wantVersion, gotVersion := want.GetVersion(section.typeURL), got.GetVersion(section.typeURL)
+		if len(changes) == 0 && wantVersion == gotVersion {
+			continue
+		}
+		fmt.Fprintf(&out, "%s:\n", section.key)
+		if wantVersion != gotVersion {
+			fmt.Fprintf(&out, "~ version: %q -> %q\n", wantVersion, gotVersion)
+		}
+		out.WriteString(diff.Format(changes))
+	}
+	return out.String()
+}
+
+// AssertSnapshot compares the snapshot against the golden file, and reports
+// the semantic differences on a mismatch, or the differing lines if the
+// golden file cannot be parsed. With the update flag, the golden file is
+// written instead.
+func AssertSnapshot(t testing.TB, snapshot cache.Snapshot, golden string) {
+	t.Helper()
+	got, err := Marshal(snapshot)
+	if err != nil {
+		t.Fatalf("snapshot %s => %v", golden, err)
+		return
+	}
+
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(golden), 0755); err != nil {
+			t.Fatalf("snapshot %s => %v", golden, err)
+			return
+		}
+		if err := ioutil.WriteFile(golden, got, 0644); err != nil {
+			t.Fatalf("snapshot %s => %v", golden, err)
+		}
+		return
+	}
+
+	want, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("snapshot %s => %v (run with -snaptest.update to create it)", golden, err)
+		return
+	}
+	if bytes.Equal(got, want) {
+		return
+	}
+	if parsed, err := Unmarshal(want); err == nil {
+		if changes := Diff(parsed, snapshot); changes != "" {
+			t.Errorf("snapshot %s mismatch (-want +got):\n%s", golden, changes)
+			return
+		}
+	}
+	t.Errorf("snapshot %s mismatch (-want +got):\n%s", golden, diffLines(string(want), string(got)))
+}
+
+// diffLines renders the line differences of the longest common subsequence.
+func diffLines(want, got string) string {
+	a := strings.Split(want, "\n")
+	b := strings.Split(got, "\n")
+
+	// lcs[i][j] is the common subsequence length of a[i:] and b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			switch {
+			case a[i] == b[j]:
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				lcs[i][j] = lcs[i+1][j]
+			default:
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var out strings.Builder
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			i++
+			j++
+		case j == len(b) || (i < len(a) && lcs[i+1][j] >= lcs[i][j+1]):
+			fmt.Fprintf(&out, "%d: - %s\n", i+1, a[i])
+			i++
+		default:
+			fmt.Fprintf(&out, "%d: + %s\n", i+1, b[j])
+			j++
+		}
+	}
+	return out.String()
+}
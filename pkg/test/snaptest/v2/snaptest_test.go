@@ -0,0 +1,117 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package snaptest_test
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	route "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/v2"
+	rsrc "github.com/envoyproxy/go-control-plane/pkg/resource/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/test/resource/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/test/snaptest/v2"
+)
+
+// recorder captures the test failures.
+type recorder struct {
+	testing.TB
+	failures []string
+}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.failures = append(r.failures, fmt.Sprintf(format, args...))
+}
+
+func (r *recorder) Fatalf(format string, args ...interface{}) {
+	r.Errorf(format, args...)
+}
+
+func TestAssertSnapshot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "snaptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	golden := filepath.Join(dir, "testdata", "snapshot.yaml")
+
+	ts := resource.TestSnapshot{
+		Xds:              resource.Ads,
+		Version:          "1",
+		UpstreamPort:     9000,
+		BasePort:         10000,
+		NumClusters:      2,
+		NumEndpoints:     2,
+		NumHTTPListeners: 1,
+	}
+
+	generate := func() cache.Snapshot {
+		snapshot := ts.Generate()
+		return snapshot.WithScopedRoutes("1", []types.Resource{&route.ScopedRouteConfiguration{
+			Name:                   "scope",
+			RouteConfigurationName: "route-0",
+			Key: &route.ScopedRouteConfiguration_Key{Fragments: []*route.ScopedRouteConfiguration_Key_Fragment{{
+				Type: &route.ScopedRouteConfiguration_Key_Fragment_StringKey{StringKey: "tenant"},
+			}}},
+		}})
+	}
+
+	r := &recorder{TB: t}
+	snaptest.AssertSnapshot(r, generate(), golden)
+	if len(r.failures) != 1 || !strings.Contains(r.failures[0], "snaptest.update") {
+		t.Errorf("missing golden file => got %v, want an update hint", r.failures)
+	}
+
+	if err := flag.Set("snaptest.update", "true"); err != nil {
+		t.Fatal(err)
+	}
+	snaptest.AssertSnapshot(t, generate(), golden)
+	if err := flag.Set("snaptest.update", "false"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the serialization is deterministic
+	for i := 0; i < 5; i++ {
+		snaptest.AssertSnapshot(t, generate(), golden)
+	}
+
+	data, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := snaptest.Unmarshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := snaptest.Diff(parsed, generate()); diff != "" {
+		t.Errorf("Unmarshal() => got changes %s, want none", diff)
+	}
+	if got := len(parsed.GetResources(rsrc.ScopedRouteType)); got != 1 {
+		t.Errorf("Unmarshal() => got %d scoped routes, want 1", got)
+	}
+
+	ts.NumEndpoints = 3
+	r = &recorder{TB: t}
+	snaptest.AssertSnapshot(r, generate(), golden)
+	if len(r.failures) != 1 || !strings.Contains(r.failures[0], "+ cluster-1-0.endpoints[0].lb_endpoints[2]: ") {
+		t.Errorf("changed snapshot => got %v, want a diff", r.failures)
+	}
+}
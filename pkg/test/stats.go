@@ -0,0 +1,137 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package test
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Stats are the counters and gauges of an Envoy, by name.
+type Stats map[string]uint64
+
+// FetchStats reads the counters and gauges from the admin interface of an
+// Envoy, e.g. http://127.0.0.1:19000. The histograms are skipped.
+func FetchStats(ctx context.Context, adminURL string) (Stats, error) {
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(adminURL, "/")+"/stats", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("admin stats returned status %d", resp.StatusCode)
+	}
+
+	stats := make(Stats)
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		i := strings.LastIndex(scanner.Text(), ": ")
+		if i < 0 {
+			continue
+		}
+		value, err := strconv.ParseUint(scanner.Text()[i+2:], 10, 64)
+		if err != nil {
+			continue
+		}
+		stats[scanner.Text()[:i]] = value
+	}
+	return stats, scanner.Err()
+}
+
+// StatAssertion checks the value of a stat.
+type StatAssertion struct {
+	Name  string
+	Check func(value uint64) bool
+
+	// Want describes the expected value
+	Want string
+}
+
+// StatEquals asserts that a stat equals the value. A missing stat equals 0.
+func StatEquals(name string, want uint64) StatAssertion {
+	return StatAssertion{
+		Name:  name,
+		Check: func(value uint64) bool { return value == want },
+		Want:  strconv.FormatUint(want, 10),
+	}
+}
+
+// StatAtLeast asserts that a stat is at least the value, e.g. the number of
+// accepted updates after the pushes.
+func StatAtLeast(name string, min uint64) StatAssertion {
+	return StatAssertion{
+		Name:  name,
+		Check: func(value uint64) bool { return value >= min },
+		Want:  ">= " + strconv.FormatUint(min, 10),
+	}
+}
+
+// Assert returns an error listing the failed assertions.
+func (stats Stats) Assert(assertions ...StatAssertion) error {
+	var failures []string
+	for _, assertion := range assertions {
+		if value := stats[assertion.Name]; !assertion.Check(value) {
+			failures = append(failures, fmt.Sprintf("%s = %d, want %s", assertion.Name, value, assertion.Want))
+		}
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("stats assertions failed: %s", strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+// WaitForStats polls the stats of an Envoy until the assertions pass, since
+// the proxy applies the pushed configuration asynchronously. It returns the
+// last failure once the context is done.
+func WaitForStats(ctx context.Context, adminURL string, interval time.Duration, assertions ...StatAssertion) error {
+	for {
+		stats, err := FetchStats(ctx, adminURL)
+		if err == nil {
+			err = stats.Assert(assertions...)
+		}
+		if err == nil {
+			return nil
+		}
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return err
+		}
+	}
+}
+
+// AcceptedUpdates asserts that an Envoy accepted at least the number of
+// cluster and listener updates, rejected none, and completed the warming of
+// the clusters and listeners, i.e. the data plane applied the pushes.
+func AcceptedUpdates(updates uint64) []StatAssertion {
+	return []StatAssertion{
+		StatAtLeast("cluster_manager.cds.update_success", updates),
+		StatAtLeast("listener_manager.lds.update_success", updates),
+		StatEquals("cluster_manager.cds.update_rejected", 0),
+		StatEquals("listener_manager.lds.update_rejected", 0),
+		StatEquals("cluster_manager.warming_clusters", 0),
+		StatEquals("listener_manager.total_listeners_warming", 0),
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package test_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/envoyproxy/go-control-plane/pkg/test"
+)
+
+func TestFetchStats(t *testing.T) {
+	admin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/stats" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, "cluster_manager.cds.update_success: 3\n"+
+			"cluster_manager.warming_clusters: 0\n"+
+			"cluster.service_0.upstream_rq_time: P0(nan,0) P25(nan,0)\n")
+	}))
+	defer admin.Close()
+
+	stats, err := test.FetchStats(context.Background(), admin.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 2 || stats["cluster_manager.cds.update_success"] != 3 {
+		t.Errorf("FetchStats() => got %v, want the counter and the gauge", stats)
+	}
+	if err := stats.Assert(test.StatAtLeast("cluster_manager.cds.update_success", 3), test.StatEquals("cluster_manager.warming_clusters", 0)); err != nil {
+		t.Error(err)
+	}
+	if err := stats.Assert(test.StatAtLeast("cluster_manager.cds.update_success", 4)); err == nil {
+		t.Error("Assert() with a failed assertion => got no error")
+	}
+}
+
+func TestWaitForStats(t *testing.T) {
+	var updates int64
+	admin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "cluster_manager.cds.update_success: %d\n", atomic.AddInt64(&updates, 1))
+	}))
+	defer admin.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := test.WaitForStats(ctx, admin.URL, time.Millisecond, test.StatAtLeast("cluster_manager.cds.update_success", 3)); err != nil {
+		t.Errorf("WaitForStats() => got %v", err)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := test.WaitForStats(ctx, admin.URL, time.Millisecond, test.AcceptedUpdates(1)...); err == nil {
+		t.Error("WaitForStats() with a missing stat => got no error")
+	}
+}
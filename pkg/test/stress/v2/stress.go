@@ -0,0 +1,289 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+// Package stress exercises a snapshot cache behind the server with concurrent
+// snapshot updates and stream churn. It is meant to run under the race
+// detector, including against the cache implementations outside this
+// repository:
+//
+//	func TestStress(t *testing.T) {
+//		if err := stress.Run(NewCustomCache(), stress.Config{ClearEvery: 10}); err != nil {
+//			t.Fatal(err)
+//		}
+//	}
+//
+// Run checks that the streams watching a node receive its final snapshot, and
+// that the streams release their goroutines once closed.
+package stress
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+
+	discovery "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/v2"
+	rsrc "github.com/envoyproxy/go-control-plane/pkg/resource/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/server/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/test/resource/v2"
+)
+
+// FinalVersion is the version of the last snapshot set for each node.
+const FinalVersion = "final"
+
+// Config are the parameters of a run.
+type Config struct {
+	// Nodes is the number of node IDs, 4 if zero.
+	Nodes int
+
+	// Streams is the number of streams per node opened and closed in a loop
+	// during the updates, 4 if zero.
+	Streams int
+
+	// Updates is the number of snapshots set for each node ahead of the final
+	// snapshot, 100 if zero.
+	Updates int
+
+	// ClearEvery clears the snapshot of a node every so many updates, never
+	// if zero. The cleared nodes may drop their watches, so the stream
+	// watching the final version of the node is reopened after each clear.
+	ClearEvery int
+
+	// Snapshot returns the snapshot of a node at a version, with a single
+	// cluster if nil. The streams watch the clusters.
+	Snapshot func(node, version string) cache.Snapshot
+
+	// Seed seeds the stream lifetimes.
+	Seed int64
+
+	// Timeout bounds the delivery of the final snapshots and the release of
+	// the goroutines, 10s if zero.
+	Timeout time.Duration
+}
+
+// Run sets the snapshots of the nodes concurrently with the stream churn, and
+// returns the first failed invariant.
+func Run(c cache.SnapshotCache, config Config) error {
+	if config.Nodes == 0 {
+		config.Nodes = 4
+	}
+	if config.Streams == 0 {
+		config.Streams = 4
+	}
+	if config.Updates == 0 {
+		config.Updates = 100
+	}
+	if config.Snapshot == nil {
+		config.Snapshot = func(node, version string) cache.Snapshot {
+			return cache.NewSnapshot(version, nil, []types.Resource{resource.MakeCluster(resource.Ads, node)}, nil, nil, nil, nil)
+		}
+	}
+	if config.Timeout == 0 {
+		config.Timeout = 10 * time.Second
+	}
+
+	goroutines := runtime.NumGoroutine()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	srv := server.NewServer(ctx, c, nil)
+
+	var handlers sync.WaitGroup
+	open := func(node string) *stream {
+		s := newStream(ctx, node)
+		handlers.Add(1)
+		go func() {
+			defer handlers.Done()
+			_ = srv.StreamHandler(s, rsrc.ClusterType)
+		}()
+		return s
+	}
+
+	nodes := make([]string, config.Nodes)
+	observers := make([]*observer, config.Nodes)
+	for i := range nodes {
+		nodes[i] = "node" + strconv.Itoa(i)
+		observers[i] = &observer{stream: open(nodes[i])}
+	}
+
+	done := make(chan struct{})
+	var churn sync.WaitGroup
+	for i, node := range nodes {
+		for j := 0; j < config.Streams; j++ {
+			churn.Add(1)
+			rng := rand.New(rand.NewSource(config.Seed + int64(i*config.Streams+j)))
+			go func(node string) {
+				defer churn.Done()
+				for {
+					select {
+					case <-done:
+						return
+					default:
+					}
+					s := open(node)
+					time.Sleep(time.Duration(rng.Int63n(int64(time.Millisecond))))
+					s.cancel()
+				}
+			}(node)
+		}
+	}
+
+	errs := make(chan error, config.Nodes)
+	var updates sync.WaitGroup
+	for i, node := range nodes {
+		updates.Add(1)
+		go func(node string, observer *observer) {
+			defer updates.Done()
+			for version := 0; version < config.Updates; version++ {
+				if err := c.SetSnapshot(node, config.Snapshot(node, strconv.Itoa(version))); err != nil {
+					errs <- fmt.Errorf("node %q: %v", node, err)
+					return
+				}
+				if config.ClearEvery > 0 && (version+1)%config.ClearEvery == 0 {
+					c.ClearSnapshot(node)
+					observer.reopen(open(node))
+				}
+			}
+			if err := c.SetSnapshot(node, config.Snapshot(node, FinalVersion)); err != nil {
+				errs <- fmt.Errorf("node %q: %v", node, err)
+			}
+		}(node, observers[i])
+	}
+	updates.Wait()
+	close(done)
+	churn.Wait()
+
+	var err error
+	select {
+	case err = <-errs:
+	default:
+	}
+
+	deadline := time.Now().Add(config.Timeout)
+	for i, observer := range observers {
+		for err == nil && observer.version() != FinalVersion {
+			if time.Now().After(deadline) {
+				err = fmt.Errorf("node %q: got version %q, want %q", nodes[i], observer.version(), FinalVersion)
+			}
+			time.Sleep(time.Millisecond)
+		}
+		observer.reopen(nil)
+	}
+
+	cancel()
+	closed := make(chan struct{})
+	go func() {
+		handlers.Wait()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(time.Until(deadline)):
+		if err == nil {
+			err = fmt.Errorf("streams are still open after %v", config.Timeout)
+		}
+		return err
+	}
+
+	for err == nil && runtime.NumGoroutine() > goroutines {
+		if time.Now().After(deadline) {
+			err = fmt.Errorf("leaked %d goroutines", runtime.NumGoroutine()-goroutines)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return err
+}
+
+// observer is the stream watching the final version of a node.
+type observer struct {
+	mu     sync.Mutex
+	stream *stream
+}
+
+func (o *observer) reopen(s *stream) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.stream.cancel()
+	o.stream = s
+}
+
+func (o *observer) version() string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.stream.version()
+}
+
+// stream is a client acknowledging all the responses.
+type stream struct {
+	ctx      context.Context
+	cancel   func()
+	node     *core.Node
+	requests chan *discovery.DiscoveryRequest
+
+	mu   sync.Mutex
+	last string
+
+	grpc.ServerStream
+}
+
+func newStream(ctx context.Context, node string) *stream {
+	s := &stream{node: &core.Node{Id: node}, requests: make(chan *discovery.DiscoveryRequest, 8)}
+	s.ctx, s.cancel = context.WithCancel(ctx)
+	s.requests <- &discovery.DiscoveryRequest{Node: s.node, TypeUrl: rsrc.ClusterType}
+	return s
+}
+
+func (s *stream) version() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.last
+}
+
+func (s *stream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *stream) Send(resp *discovery.DiscoveryResponse) error {
+	s.mu.Lock()
+	s.last = resp.VersionInfo
+	s.mu.Unlock()
+	select {
+	case s.requests <- &discovery.DiscoveryRequest{
+		Node:          s.node,
+		TypeUrl:       resp.TypeUrl,
+		VersionInfo:   resp.VersionInfo,
+		ResponseNonce: resp.Nonce,
+	}:
+		return nil
+	case <-s.ctx.Done():
+		return s.ctx.Err()
+	}
+}
+
+func (s *stream) Recv() (*discovery.DiscoveryRequest, error) {
+	select {
+	case req := <-s.requests:
+		return req, nil
+	case <-s.ctx.Done():
+		return nil, io.EOF
+	}
+}
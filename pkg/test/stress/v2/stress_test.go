@@ -0,0 +1,33 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package stress_test
+
+import (
+	"testing"
+
+	"github.com/envoyproxy/go-control-plane/pkg/cache/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/test/stress/v2"
+)
+
+func TestRun(t *testing.T) {
+	for _, config := range []stress.Config{
+		{},
+		{ClearEvery: 10, Seed: 1},
+	} {
+		if err := stress.Run(cache.NewSnapshotCache(false, cache.IDHash{}, nil), config); err != nil {
+			t.Errorf("Run(%+v) => got error %v", config, err)
+		}
+	}
+}
@@ -18,14 +18,7 @@ package test
 import (
 	"google.golang.org/grpc"
 
-	clusterservice "github.com/envoyproxy/go-control-plane/envoy/api/v2"
-	endpointservice "github.com/envoyproxy/go-control-plane/envoy/api/v2"
-	listenerservice "github.com/envoyproxy/go-control-plane/envoy/api/v2"
-	routeservice "github.com/envoyproxy/go-control-plane/envoy/api/v2"
 	accessloggrpc "github.com/envoyproxy/go-control-plane/envoy/service/accesslog/v2"
-	discoverygrpc "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v2"
-	runtimeservice "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v2"
-	secretservice "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v2"
 	"github.com/envoyproxy/go-control-plane/pkg/server/v2"
 )
 
@@ -35,13 +28,6 @@ func RegisterAccessLogServer(grpcServer *grpc.Server, als *AccessLogService) {
 }
 
 // RegisterServer registers with v2 services.
-func RegisterServer(grpcServer *grpc.Server, server server.Server) {
-	// register services
-	discoverygrpc.RegisterAggregatedDiscoveryServiceServer(grpcServer, server)
-	endpointservice.RegisterEndpointDiscoveryServiceServer(grpcServer, server)
-	clusterservice.RegisterClusterDiscoveryServiceServer(grpcServer, server)
-	routeservice.RegisterRouteDiscoveryServiceServer(grpcServer, server)
-	listenerservice.RegisterListenerDiscoveryServiceServer(grpcServer, server)
-	secretservice.RegisterSecretDiscoveryServiceServer(grpcServer, server)
-	runtimeservice.RegisterRuntimeDiscoveryServiceServer(grpcServer, server)
+func RegisterServer(grpcServer *grpc.Server, srv server.Server) {
+	server.RegisterServices(grpcServer, srv)
 }
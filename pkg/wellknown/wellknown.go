@@ -134,3 +134,18 @@ const (
 	// TransportSocket Quic
 	TransportSocketQuic = "envoy.transport_sockets.quic"
 )
+
+// Client feature names advertised in the node client_features
+const (
+	// ClientFeatureResourceTTL is advertised by the clients accepting resource TTLs
+	ClientFeatureResourceTTL = "xds.config.supports-resource-ttl"
+	// ClientFeatureResourceInSotW is advertised by the clients accepting the
+	// resources wrapped in the discovery resource envelope in SotW responses
+	ClientFeatureResourceInSotW = "xds.config.resource-in-sotw"
+	// ClientFeatureNoOverprovisioning is advertised by the clients ignoring
+	// the EDS overprovisioning factor
+	ClientFeatureNoOverprovisioning = "envoy.lb.does_not_support_overprovisioning"
+	// ClientFeatureLRSSendAllClusters is advertised by the clients reporting
+	// the load of all the clusters on LRS send_all_clusters
+	ClientFeatureLRSSendAllClusters = "envoy.lrs.supports_send_all_clusters"
+)
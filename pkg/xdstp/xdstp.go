@@ -0,0 +1,163 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+// Package xdstp parses the xDS transport protocol resource names of the form
+//
+//	xdstp://{authority}/{resource type}/{id}?{context params}
+//
+// The names identify the resources across the control planes of a
+// federation. The legacy names, without the xdstp scheme, are opaque and
+// left unchanged by this package.
+package xdstp
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Scheme is the scheme prefix of the xdstp names.
+const Scheme = "xdstp://"
+
+// Glob is the last segment of the ID of a name matching all the resources of
+// a collection, e.g. "xdstp://auth/envoy.config.listener.v3.Listener/foo/*".
+const Glob = "*"
+
+// typeURLPrefix is the prefix of the type URLs to the resource types.
+const typeURLPrefix = "type.googleapis.com/"
+
+// URN is a parsed xdstp resource name.
+type URN struct {
+	// Authority is the control plane authoritative for the resource, empty
+	// for the local authority.
+	Authority string
+
+	// ResourceType is the fully qualified proto message name of the resource,
+	// e.g. "envoy.config.cluster.v3.Cluster".
+	ResourceType string
+
+	// ID is the resource ID, with "/" separated segments.
+	ID string
+
+	// ContextParams are the optional context parameters of the name.
+	ContextParams map[string]string
+}
+
+// IsXDSTP reports whether a resource name uses the xdstp scheme.
+func IsXDSTP(name string) bool {
+	return strings.HasPrefix(name, Scheme)
+}
+
+// Parse parses an xdstp name. The directives, in the URL fragment, are not
+// supported.
+func Parse(name string) (*URN, error) {
+	if !IsXDSTP(name) {
+		return nil, fmt.Errorf("%q is not an xdstp name", name)
+	}
+	u, err := url.Parse(name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid xdstp name %q: %v", name, err)
+	}
+	if u.Fragment != "" {
+		return nil, fmt.Errorf("invalid xdstp name %q: directives are not supported", name)
+	}
+	if u.User != nil || u.Port() != "" {
+		return nil, fmt.Errorf("invalid xdstp name %q: the authority must be a host name", name)
+	}
+	path := strings.TrimPrefix(u.Path, "/")
+	slash := strings.Index(path, "/")
+	if slash <= 0 || slash == len(path)-1 {
+		return nil, fmt.Errorf("invalid xdstp name %q: the resource type and the ID are required", name)
+	}
+
+	out := &URN{
+		Authority:    u.Host,
+		ResourceType: path[:slash],
+		ID:           path[slash+1:],
+	}
+	params, err := url.ParseQuery(u.RawQuery)
+	if err != nil {
+		return nil, fmt.Errorf("invalid xdstp name %q: %v", name, err)
+	}
+	for key, values := range params {
+		if len(values) > 1 {
+			return nil, fmt.Errorf("invalid xdstp name %q: repeated context param %q", name, key)
+		}
+		if out.ContextParams == nil {
+			out.ContextParams = make(map[string]string, len(params))
+		}
+		out.ContextParams[key] = values[0]
+	}
+	return out, nil
+}
+
+// TypeURL returns the type URL of the resource type.
+func (u *URN) TypeURL() string {
+	return typeURLPrefix + u.ResourceType
+}
+
+// IsGlob reports whether the name matches all the resources of a collection.
+func (u *URN) IsGlob() bool {
+	return u.ID == Glob || strings.HasSuffix(u.ID, "/"+Glob)
+}
+
+// String returns the canonical form of the name, with the context params
+// sorted by key.
+func (u *URN) String() string {
+	out := &url.URL{
+		Scheme: "xdstp",
+		Host:   u.Authority,
+		Path:   "/" + u.ResourceType + "/" + u.ID,
+	}
+	if len(u.ContextParams) > 0 {
+		params := make(url.Values, len(u.ContextParams))
+		for key, value := range u.ContextParams {
+			params.Set(key, value)
+		}
+		out.RawQuery = params.Encode()
+	}
+	return out.String()
+}
+
+// Matches reports whether the name, possibly a glob, matches a resource
+// name. The context params must be equal.
+func (u *URN) Matches(resource *URN) bool {
+	if u.Authority != resource.Authority || u.ResourceType != resource.ResourceType || len(u.ContextParams) != len(resource.ContextParams) {
+		return false
+	}
+	for key, value := range u.ContextParams {
+		if got, exists := resource.ContextParams[key]; !exists || got != value {
+			return false
+		}
+	}
+	if !u.IsGlob() {
+		return u.ID == resource.ID
+	}
+	collection := strings.TrimSuffix(u.ID, Glob)
+	return strings.HasPrefix(resource.ID, collection) && !strings.Contains(resource.ID[len(collection):], "/")
+}
+
+// Canonical returns the canonical form of a resource name: the xdstp names
+// have their context params sorted, and the legacy or the invalid names are
+// unchanged.
+func Canonical(name string) string {
+	if !IsXDSTP(name) {
+		return name
+	}
+	urn, err := Parse(name)
+	if err != nil {
+		return name
+	}
+	return urn.String()
+}
@@ -0,0 +1,111 @@
+// Copyright 2020 Envoyproxy Authors
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package xdstp_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/envoyproxy/go-control-plane/pkg/xdstp"
+)
+
+const clusterType = "envoy.config.cluster.v3.Cluster"
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    *xdstp.URN
+		invalid bool
+	}{
+		{
+			name: "xdstp://control.example.com/envoy.config.cluster.v3.Cluster/tenant/backend?zone=b&region=a",
+			want: &xdstp.URN{
+				Authority:     "control.example.com",
+				ResourceType:  clusterType,
+				ID:            "tenant/backend",
+				ContextParams: map[string]string{"zone": "b", "region": "a"},
+			},
+		},
+		{
+			name: "xdstp:///envoy.config.cluster.v3.Cluster/backend",
+			want: &xdstp.URN{ResourceType: clusterType, ID: "backend"},
+		},
+		{name: "backend", invalid: true},
+		{name: "xdstp://auth/envoy.config.cluster.v3.Cluster", invalid: true},
+		{name: "xdstp://auth/envoy.config.cluster.v3.Cluster/", invalid: true},
+		{name: "xdstp://auth/envoy.config.cluster.v3.Cluster/backend#alt=other", invalid: true},
+		{name: "xdstp://auth/envoy.config.cluster.v3.Cluster/backend?a=1&a=2", invalid: true},
+		{name: "xdstp://auth:80/envoy.config.cluster.v3.Cluster/backend", invalid: true},
+	}
+	for _, test := range tests {
+		got, err := xdstp.Parse(test.name)
+		if (err != nil) != test.invalid || !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Parse(%q) => got %+v, %v, want %+v", test.name, got, err, test.want)
+		}
+	}
+}
+
+func TestCanonical(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{
+			name: "xdstp://auth/envoy.config.cluster.v3.Cluster/backend?zone=b&region=a",
+			want: "xdstp://auth/envoy.config.cluster.v3.Cluster/backend?region=a&zone=b",
+		},
+		{
+			name: "xdstp:///envoy.config.cluster.v3.Cluster/backend",
+			want: "xdstp:///envoy.config.cluster.v3.Cluster/backend",
+		},
+		{name: "backend", want: "backend"},
+		{name: "xdstp://auth/invalid", want: "xdstp://auth/invalid"},
+	}
+	for _, test := range tests {
+		if got := xdstp.Canonical(test.name); got != test.want {
+			t.Errorf("Canonical(%q) => got %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestMatches(t *testing.T) {
+	parse := func(name string) *xdstp.URN {
+		urn, err := xdstp.Parse(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return urn
+	}
+	glob := parse("xdstp://auth/envoy.config.cluster.v3.Cluster/tenant/*?zone=a")
+	if !glob.IsGlob() || glob.TypeURL() != "type.googleapis.com/"+clusterType {
+		t.Errorf("glob => got %+v, want a cluster glob", glob)
+	}
+	tests := []struct {
+		resource string
+		want     bool
+	}{
+		{resource: "xdstp://auth/envoy.config.cluster.v3.Cluster/tenant/backend?zone=a", want: true},
+		{resource: "xdstp://auth/envoy.config.cluster.v3.Cluster/tenant/nested/backend?zone=a"},
+		{resource: "xdstp://auth/envoy.config.cluster.v3.Cluster/other/backend?zone=a"},
+		{resource: "xdstp://auth/envoy.config.cluster.v3.Cluster/tenant/backend?zone=b"},
+		{resource: "xdstp://other/envoy.config.cluster.v3.Cluster/tenant/backend?zone=a"},
+		{resource: "xdstp://auth/envoy.config.listener.v3.Listener/tenant/backend?zone=a"},
+	}
+	for _, test := range tests {
+		if got := glob.Matches(parse(test.resource)); got != test.want {
+			t.Errorf("Matches(%q) => got %v, want %v", test.resource, got, test.want)
+		}
+	}
+}
@@ -21,12 +21,15 @@ MODULES=(   'clusterservice "github.com/envoyproxy/go-control-plane/envoy/api/v2
             '"github.com/envoyproxy/go-control-plane/envoy/config/filter/network/http_connection_manager/v2":"github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"'  
             '"github.com/envoyproxy/go-control-plane/envoy/api/v2/core":"github.com/envoyproxy/go-control-plane/envoy/config/core/v3"'  
             '"github.com/envoyproxy/go-control-plane/pkg/cache/v2":"github.com/envoyproxy/go-control-plane/pkg/cache/v3"'
+            '"github.com/envoyproxy/go-control-plane/pkg/bootstrap/v2":"github.com/envoyproxy/go-control-plane/pkg/bootstrap/v3"'
+            '"github.com/envoyproxy/go-control-plane/envoy/config/bootstrap/v2":"github.com/envoyproxy/go-control-plane/envoy/config/bootstrap/v3"'
             '"github.com/envoyproxy/go-control-plane/envoy/api/v2/endpoint":"github.com/envoyproxy/go-control-plane/envoy/config/endpoint/v3"'  
             '"github.com/envoyproxy/go-control-plane/envoy/api/v2/auth":"github.com/envoyproxy/go-control-plane/envoy/extensions/transport_sockets/tls/v3"'  
             '"github.com/envoyproxy/go-control-plane/envoy/api/v2/listener":"github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"'  
             '"github.com/envoyproxy/go-control-plane/envoy/config/accesslog/v2":"github.com/envoyproxy/go-control-plane/envoy/extensions/access_loggers/grpc/v3"'  
             '"github.com/envoyproxy/go-control-plane/envoy/config/filter/accesslog/v2":"github.com/envoyproxy/go-control-plane/envoy/config/accesslog/v3"'  
             '"github.com/envoyproxy/go-control-plane/envoy/config/filter/network/tcp_proxy/v2":"github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/tcp_proxy/v3"'  
+            'hds "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v2":hds "github.com/envoyproxy/go-control-plane/envoy/service/health/v3"'
             'runtime "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v2":runtime "github.com/envoyproxy/go-control-plane/envoy/service/runtime/v3"'
             '"github.com/envoyproxy/go-control-plane/envoy/service/discovery/v2":"github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"'
             '"github.com/envoyproxy/go-control-plane/pkg/test/resource/v2":"github.com/envoyproxy/go-control-plane/pkg/test/resource/v3"'
@@ -34,6 +37,24 @@ MODULES=(   'clusterservice "github.com/envoyproxy/go-control-plane/envoy/api/v2
             '"github.com/envoyproxy/go-control-plane/pkg/server/v2":"github.com/envoyproxy/go-control-plane/pkg/server/v3"'
             '"github.com/envoyproxy/go-control-plane/pkg/server/rest/v2":"github.com/envoyproxy/go-control-plane/pkg/server/rest/v3"'
             '"github.com/envoyproxy/go-control-plane/pkg/server/sotw/v2":"github.com/envoyproxy/go-control-plane/pkg/server/sotw/v3"'
+            '"github.com/envoyproxy/go-control-plane/pkg/server/admin/v2":"github.com/envoyproxy/go-control-plane/pkg/server/admin/v3"'
+            '"github.com/envoyproxy/go-control-plane/pkg/server/callbacks/metrics/v2":"github.com/envoyproxy/go-control-plane/pkg/server/callbacks/metrics/v3"'
+            '"github.com/envoyproxy/go-control-plane/pkg/server/callbacks/tracing/v2":"github.com/envoyproxy/go-control-plane/pkg/server/callbacks/tracing/v3"'
+            '"github.com/envoyproxy/go-control-plane/pkg/server/als/v2":"github.com/envoyproxy/go-control-plane/pkg/server/als/v3"'
+            '"github.com/envoyproxy/go-control-plane/pkg/server/csds/v2":"github.com/envoyproxy/go-control-plane/pkg/server/csds/v3"'
+            '"github.com/envoyproxy/go-control-plane/pkg/server/hds/v2":"github.com/envoyproxy/go-control-plane/pkg/server/hds/v3"'
+            '"github.com/envoyproxy/go-control-plane/pkg/server/extauthz/v2":"github.com/envoyproxy/go-control-plane/pkg/server/extauthz/v3"'
+            '"github.com/envoyproxy/go-control-plane/pkg/server/ratelimit/v2":"github.com/envoyproxy/go-control-plane/pkg/server/ratelimit/v3"'
+            '"github.com/envoyproxy/go-control-plane/pkg/server/callbacks/v2":"github.com/envoyproxy/go-control-plane/pkg/server/callbacks/v3"'
+            '"github.com/envoyproxy/go-control-plane/pkg/test/stress/v2":"github.com/envoyproxy/go-control-plane/pkg/test/stress/v3"'
+            '"github.com/envoyproxy/go-control-plane/pkg/test/snaptest/v2":"github.com/envoyproxy/go-control-plane/pkg/test/snaptest/v3"'
+            '"github.com/envoyproxy/go-control-plane/envoy/admin/v2alpha":"github.com/envoyproxy/go-control-plane/envoy/admin/v3"'
+            '"github.com/envoyproxy/go-control-plane/envoy/service/status/v2":"github.com/envoyproxy/go-control-plane/envoy/service/status/v3"'
+            'auth "github.com/envoyproxy/go-control-plane/envoy/service/auth/v2":auth "github.com/envoyproxy/go-control-plane/envoy/service/auth/v3"'
+            'rls "github.com/envoyproxy/go-control-plane/envoy/service/ratelimit/v2":rls "github.com/envoyproxy/go-control-plane/envoy/service/ratelimit/v3"'
+            '"github.com/envoyproxy/go-control-plane/envoy/api/v2/ratelimit":"github.com/envoyproxy/go-control-plane/envoy/extensions/common/ratelimit/v3"'
+            '"github.com/envoyproxy/go-control-plane/envoy/type/matcher":"github.com/envoyproxy/go-control-plane/envoy/type/matcher/v3"'
+            'envoy_type "github.com/envoyproxy/go-control-plane/envoy/type":envoy_type "github.com/envoyproxy/go-control-plane/envoy/type/v3"'
 )
 
 workdir="$(dirname "$0")"
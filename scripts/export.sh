@@ -4,10 +4,22 @@ set -o nounset
 set -o errexit
 set -o pipefail
 
-DIRS=(  "pkg/cache"
+DIRS=(  "pkg/bootstrap"
+        "pkg/cache"
         "pkg/server"
+        "pkg/server/admin"
+        "pkg/server/als"
+        "pkg/server/callbacks"
+        "pkg/server/callbacks/metrics"
+        "pkg/server/callbacks/tracing"
+        "pkg/server/csds"
+        "pkg/server/extauthz"
+        "pkg/server/hds"
+        "pkg/server/ratelimit"
         "pkg/server/rest"
         "pkg/server/sotw"
         "pkg/test/resource"
+        "pkg/test/snaptest"
+        "pkg/test/stress"
         "pkg/test"
 )